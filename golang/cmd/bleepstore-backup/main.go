@@ -0,0 +1,304 @@
+// Package main is the entry point for bleepstore-backup, which archives and
+// restores SQLite metadata together with local object data.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/bleepstore/bleepstore/internal/backup"
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+const usage = "Usage: bleepstore-backup <create|restore> [flags]"
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "create":
+		os.Exit(runCreate(os.Args[2:]))
+	case "restore":
+		os.Exit(runRestore(os.Args[2:]))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n%s\n", os.Args[1], usage)
+		os.Exit(1)
+	}
+}
+
+// target is the location of an archive: a file, "-" for stdin/stdout, or an
+// s3://bucket/key URL.
+type target struct {
+	endpoint string
+	region   string
+	useS3    bool
+	bucket   string
+	key      string
+}
+
+// addTargetFlags registers the S3 flags and returns the target they fill.
+func addTargetFlags(fs *flag.FlagSet) *target {
+	t := &target{}
+	fs.StringVar(&t.endpoint, "s3-endpoint", "", "S3 endpoint URL for s3:// archives (default: AWS)")
+	fs.StringVar(&t.region, "s3-region", "us-east-1", "S3 region for s3:// archives")
+	return t
+}
+
+// parse sets the archive location. Credentials for s3:// come from the
+// default AWS chain (environment, shared config, instance role).
+func (t *target) parse(path string) error {
+	rest, ok := strings.CutPrefix(path, "s3://")
+	if !ok {
+		return nil
+	}
+	t.useS3 = true
+	t.bucket, t.key, _ = strings.Cut(rest, "/")
+	if t.bucket == "" || t.key == "" {
+		return fmt.Errorf("invalid S3 location %q (want s3://bucket/key)", path)
+	}
+	return nil
+}
+
+// s3Client builds a client for the target's endpoint. A custom endpoint
+// uses path-style addressing, as S3-compatible servers expect.
+func (t *target) s3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(t.region))
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if t.endpoint != "" {
+			o.BaseEndpoint = aws.String(t.endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+// loadConfig returns the database path and storage roots, from the flags
+// or else the config, checking that the config describes a deployment
+// bleepstore-backup can archive.
+func loadConfig(path, dbPath, storageRoot string) (db string, roots []string, err error) {
+	db = dbPath
+	for _, root := range strings.Split(storageRoot, ",") {
+		if root = strings.TrimSpace(root); root != "" {
+			roots = append(roots, root)
+		}
+	}
+	if db != "" && len(roots) > 0 {
+		return db, roots, nil
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading config: %w", err)
+	}
+	if db == "" {
+		if cfg.Metadata.Engine != "sqlite" {
+			return "", nil, fmt.Errorf("metadata engine %q is not supported (sqlite only)", cfg.Metadata.Engine)
+		}
+		db = cfg.Metadata.SQLite.Path
+	}
+	if len(roots) == 0 {
+		if cfg.Storage.Backend != "local" {
+			return "", nil, fmt.Errorf("storage backend %q is not supported (local only)", cfg.Storage.Backend)
+		}
+		roots = cfg.Storage.Local.RootDirs
+		if len(roots) == 0 {
+			roots = []string{cfg.Storage.Local.RootDir}
+		}
+	}
+	return db, roots, nil
+}
+
+func runCreate(args []string) int {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	configPath := fs.String("config", "bleepstore.yaml", "Config file path")
+	dbPath := fs.String("db", "", "SQLite database path (overrides config)")
+	storageRoot := fs.String("storage-root", "", "Comma-separated local storage roots (overrides config)")
+	output := fs.String("output", "", "Archive path, - for stdout, or s3://bucket/key")
+	since := fs.String("since", "", "RFC 3339 time; archive only objects modified after it (incremental)")
+	tgt := addTargetFlags(fs)
+	fs.Parse(args)
+
+	if *output == "" {
+		fmt.Fprintln(os.Stderr, "Error: -output is required")
+		return 1
+	}
+	if err := tgt.parse(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	opts := &backup.Options{
+		OnSkip: func(bucket, key, reason string) {
+			fmt.Fprintf(os.Stderr, "  SKIPPED: %s/%s: %s\n", bucket, key, reason)
+		},
+	}
+	if *since != "" {
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -since: %v\n", err)
+			return 1
+		}
+		opts.Since = t
+	}
+	var err error
+	if opts.DBPath, opts.Roots, err = loadConfig(*configPath, *dbPath, *storageRoot); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	var w io.Writer = os.Stdout
+	var f *os.File
+	switch {
+	case tgt.useS3:
+		// Spool to a temp file so the upload has a known length.
+		f, err = os.CreateTemp("", "bleepstore-backup-*.tar.gz")
+		if err == nil {
+			defer os.Remove(f.Name())
+		}
+	case *output != "-":
+		f, err = os.Create(*output)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		return 1
+	}
+	if f != nil {
+		defer f.Close()
+		w = f
+	}
+
+	result, err := backup.Create(ctx, w, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating backup: %v\n", err)
+		return 1
+	}
+	if tgt.useS3 {
+		if err := upload(ctx, tgt, f); err != nil {
+			fmt.Fprintf(os.Stderr, "Error uploading backup: %v\n", err)
+			return 1
+		}
+	} else if f != nil {
+		if err := f.Sync(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			return 1
+		}
+	}
+
+	kind := "Full"
+	if result.Manifest.Incremental() {
+		kind = "Incremental"
+	}
+	fmt.Fprintf(os.Stderr, "%s backup to %s: %d objects, %d bytes, %d skipped\n",
+		kind, *output, result.Objects, result.Bytes, result.Skipped)
+	fmt.Fprintf(os.Stderr, "Next incremental: -since %s\n", result.Manifest.CreatedAt.Format(time.RFC3339))
+	return 0
+}
+
+// upload copies the spooled archive f to the S3 target.
+func upload(ctx context.Context, tgt *target, f *os.File) error {
+	client, err := tgt.s3Client(ctx)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(tgt.bucket),
+		Key:           aws.String(tgt.key),
+		Body:          f,
+		ContentLength: aws.Int64(info.Size()),
+		ContentType:   aws.String("application/gzip"),
+	})
+	return err
+}
+
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configPath := fs.String("config", "bleepstore.yaml", "Config file path")
+	dbPath := fs.String("db", "", "SQLite database path (overrides config)")
+	storageRoot := fs.String("storage-root", "", "Comma-separated local storage roots (overrides config)")
+	input := fs.String("input", "", "Archive path, - for stdin, or s3://bucket/key")
+	force := fs.Bool("force", false, "Overwrite an existing database, or restore an incremental backup without its base")
+	tgt := addTargetFlags(fs)
+	fs.Parse(args)
+
+	if *input == "" {
+		fmt.Fprintln(os.Stderr, "Error: -input is required")
+		return 1
+	}
+	if err := tgt.parse(*input); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	db, roots, err := loadConfig(*configPath, *dbPath, *storageRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var store storage.StorageBackend
+	if len(roots) > 1 {
+		store, err = storage.NewJBODBackend(roots, storage.JBODOptions{})
+	} else {
+		store, err = storage.NewLocalBackend(roots[0])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening storage: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	var r io.Reader = os.Stdin
+	switch {
+	case tgt.useS3:
+		client, err := tgt.s3Client(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		resp, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(tgt.bucket), Key: aws.String(tgt.key)})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error downloading backup: %v\n", err)
+			return 1
+		}
+		defer resp.Body.Close()
+		r = resp.Body
+	case *input != "-":
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+
+	result, err := backup.Restore(ctx, r, &backup.RestoreOptions{DBPath: db, Store: store, Force: *force})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error restoring backup: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Restored backup of %s to %s: %d objects, %d bytes\n",
+		result.Manifest.CreatedAt.Format(time.RFC3339), db, result.Objects, result.Bytes)
+	return 0
+}
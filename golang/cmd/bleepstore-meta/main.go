@@ -1,14 +1,24 @@
-// Package main is the entry point for bleepstore-meta, the metadata export/import tool.
+// Package main is the entry point for bleepstore-meta, the metadata export/import and migration tool.
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 
+	"github.com/bleepstore/bleepstore/internal/metadata"
 	"github.com/bleepstore/bleepstore/internal/serialization"
 	"gopkg.in/yaml.v3"
 )
@@ -39,7 +49,7 @@ func resolveDBPath(configPath string) (string, error) {
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: bleepstore-meta <export|import> [flags]")
+		fmt.Fprintln(os.Stderr, "Usage: bleepstore-meta <export|import|usage|migrate|schema|verify> [flags]")
 		os.Exit(1)
 	}
 
@@ -52,8 +62,20 @@ func main() {
 	case "import":
 		rc := runImport(os.Args[2:])
 		os.Exit(rc)
+	case "usage":
+		rc := runUsage(os.Args[2:])
+		os.Exit(rc)
+	case "migrate":
+		rc := runMigrate(os.Args[2:])
+		os.Exit(rc)
+	case "schema":
+		rc := runSchema(os.Args[2:])
+		os.Exit(rc)
+	case "verify":
+		rc := runVerify(os.Args[2:])
+		os.Exit(rc)
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\nUsage: bleepstore-meta <export|import> [flags]\n", command)
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\nUsage: bleepstore-meta <export|import|usage|migrate|schema|verify> [flags]\n", command)
 		os.Exit(1)
 	}
 }
@@ -62,13 +84,14 @@ func runExport(args []string) int {
 	fs := flag.NewFlagSet("export", flag.ExitOnError)
 	configPath := fs.String("config", "bleepstore.yaml", "Config file path")
 	dbPath := fs.String("db", "", "SQLite database path (overrides config)")
-	format := fs.String("format", "json", "Output format")
+	format := fs.String("format", "json", "Output format: json, or ndjson to stream rows one per line")
 	output := fs.String("output", "-", "Output file path (- for stdout)")
 	tables := fs.String("tables", "", "Comma-separated table names")
 	includeCreds := fs.Bool("include-credentials", false, "Include real secret keys")
+	buckets := fs.String("bucket", "", "Comma-separated bucket names; export only these buckets' metadata (no credentials)")
 	fs.Parse(args)
 
-	if *format != "json" {
+	if *format != "json" && *format != serialization.FormatNDJSON {
 		fmt.Fprintf(os.Stderr, "Error: unsupported format: %s\n", *format)
 		return 1
 	}
@@ -101,9 +124,20 @@ func runExport(args []string) int {
 		}
 	}
 
+	bucketList := splitList(*buckets)
+	if len(bucketList) > 0 && (*includeCreds || (*tables != "" && slices.Contains(tableList, "credentials"))) {
+		fmt.Fprintln(os.Stderr, "Error: credentials cannot be exported with -bucket")
+		return 1
+	}
+
 	opts := &serialization.ExportOptions{
 		Tables:             tableList,
 		IncludeCredentials: *includeCreds,
+		Buckets:            bucketList,
+	}
+
+	if *format == serialization.FormatNDJSON {
+		return exportNDJSON(db, *output, opts)
 	}
 
 	result, err := serialization.ExportMetadata(db, opts)
@@ -125,14 +159,45 @@ func runExport(args []string) int {
 	return 0
 }
 
+// exportNDJSON streams an NDJSON export to output ("-" for stdout).
+func exportNDJSON(db, output string, opts *serialization.ExportOptions) int {
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := serialization.ExportMetadataNDJSON(db, w, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting: %v\n", err)
+		return 1
+	}
+	if output != "-" {
+		fmt.Fprintf(os.Stderr, "Exported to %s\n", output)
+	}
+	return 0
+}
+
 func runImport(args []string) int {
 	fs := flag.NewFlagSet("import", flag.ExitOnError)
 	configPath := fs.String("config", "bleepstore.yaml", "Config file path")
 	dbPath := fs.String("db", "", "SQLite database path (overrides config)")
 	input := fs.String("input", "-", "Input file path (- for stdin)")
 	replace := fs.Bool("replace", false, "Replace mode (DELETE then INSERT)")
+	format := fs.String("format", "json", "Input format: json or ndjson")
+	buckets := fs.String("bucket", "", "Comma-separated bucket names; import only these buckets' metadata (no credentials)")
+	dryRun := fs.Bool("dry-run", false, "Validate and simulate the import, reporting counts and primary-key conflicts without writing")
 	fs.Parse(args)
 
+	if *format != "json" && *format != serialization.FormatNDJSON {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format: %s\n", *format)
+		return 1
+	}
+
 	db := *dbPath
 	if db == "" {
 		var err error
@@ -143,21 +208,21 @@ func runImport(args []string) int {
 		}
 	}
 
-	var jsonData []byte
+	opts := &serialization.ImportOptions{Replace: *replace, Buckets: splitList(*buckets), DryRun: *dryRun}
+
+	var result *serialization.ImportResult
 	var err error
-	if *input == "-" {
-		jsonData, err = os.ReadFile("/dev/stdin")
+	if *format == serialization.FormatNDJSON {
+		result, err = importNDJSON(db, *input, opts)
 	} else {
-		jsonData, err = os.ReadFile(*input)
-	}
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		return 1
+		var jsonData []byte
+		jsonData, err = readInput(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			return 1
+		}
+		result, err = serialization.ImportMetadata(db, string(jsonData), opts)
 	}
-
-	opts := &serialization.ImportOptions{Replace: *replace}
-
-	result, err := serialization.ImportMetadata(db, string(jsonData), opts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error importing: %v\n", err)
 		return 1
@@ -169,7 +234,11 @@ func runImport(args []string) int {
 			continue
 		}
 		skip := result.Skipped[table]
-		msg := fmt.Sprintf("  %s: %d imported", table, count)
+		verb := "imported"
+		if *dryRun {
+			verb = "would be imported"
+		}
+		msg := fmt.Sprintf("  %s: %d %s", table, count, verb)
 		if skip > 0 {
 			msg += fmt.Sprintf(", %d skipped", skip)
 		}
@@ -180,5 +249,181 @@ func runImport(args []string) int {
 		fmt.Fprintf(os.Stderr, "  WARNING: %s\n", w)
 	}
 
+	if *dryRun {
+		for _, c := range result.Conflicts {
+			fmt.Fprintf(os.Stderr, "  CONFLICT: %s %s\n", c.Table, c.Key)
+		}
+		fmt.Fprintf(os.Stderr, "Dry run: %d conflicts, nothing written\n", len(result.Conflicts))
+	}
+
+	return 0
+}
+
+// importNDJSON streams an NDJSON export from input ("-" for stdin).
+func importNDJSON(db, input string, opts *serialization.ImportOptions) (*serialization.ImportResult, error) {
+	r, err := openInput(input)
+	if err != nil {
+		return nil, fmt.Errorf("reading input: %w", err)
+	}
+	defer r.Close()
+	return serialization.ImportMetadataNDJSON(db, r, opts)
+}
+
+// readInput reads all of input ("-" for stdin), decompressing it if it is
+// gzipped.
+func readInput(input string) ([]byte, error) {
+	r, err := openInput(input)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// openInput opens input ("-" for stdin) for reading. Gzip-compressed input
+// is recognized by its magic bytes and decompressed transparently.
+func openInput(input string) (io.ReadCloser, error) {
+	f := os.Stdin
+	if input != "-" {
+		var err error
+		if f, err = os.Open(input); err != nil {
+			return nil, err
+		}
+	}
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return &inputReader{Reader: br, file: f}, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("opening gzip input: %w", err)
+	}
+	return &inputReader{Reader: zr, file: f, gz: zr}, nil
+}
+
+// inputReader is an opened input. Close closes the gzip reader, if any, and
+// the file unless it is stdin.
+type inputReader struct {
+	io.Reader
+	file *os.File
+	gz   *gzip.Reader
+}
+
+func (r *inputReader) Close() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	if r.file == os.Stdin {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func runUsage(args []string) int {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	configPath := fs.String("config", "bleepstore.yaml", "Config file path")
+	dbPath := fs.String("db", "", "SQLite database path (overrides config)")
+	output := fs.String("output", "-", "Output file path (- for stdout)")
+	accessKey := fs.String("access-key", "", "Only export usage for this access key")
+	bucket := fs.String("bucket", "", "Only export usage for this bucket")
+	since := fs.String("since", "", "Only export periods at or after this time (RFC 3339)")
+	until := fs.String("until", "", "Only export periods before this time (RFC 3339)")
+	fs.Parse(args)
+
+	db := *dbPath
+	if db == "" {
+		var err error
+		db, err = resolveDBPath(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+			return 1
+		}
+	}
+
+	filter := metadata.UsageFilter{AccessKey: *accessKey, Bucket: *bucket}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{{"since", *since, &filter.Since}, {"until", *until, &filter.Until}} {
+		if f.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, f.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid -%s: %v\n", f.name, err)
+			return 1
+		}
+		*f.dst = t
+	}
+
+	store, err := metadata.NewSQLiteStore(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	records, err := store.ListUsage(context.Background(), filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading usage: %v\n", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := writeUsageCSV(w, records); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		return 1
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d usage rows to %s\n", len(records), *output)
+	}
 	return 0
 }
+
+// writeUsageCSV writes usage records as CSV with a header row.
+func writeUsageCSV(w io.Writer, records []metadata.UsageRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"period", "access_key", "bucket", "requests", "bytes_in", "bytes_out"}); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		row := []string{
+			rec.Period.UTC().Format(time.RFC3339),
+			rec.AccessKey,
+			rec.Bucket,
+			strconv.FormatInt(rec.Requests, 10),
+			strconv.FormatInt(rec.BytesIn, 10),
+			strconv.FormatInt(rec.BytesOut, 10),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+// openStore opens the metadata store for engine using the settings in cfg.
+// An empty engine uses cfg.Metadata.Engine.
+func openStore(cfg *config.Config, engine string) (metadata.MetadataStore, error) {
+	if engine == "" {
+		engine = cfg.Metadata.Engine
+	}
+	switch engine {
+	case "memory":
+		return nil, fmt.Errorf("the memory engine does not persist and cannot be migrated")
+	case "local":
+		return metadata.NewLocalStore(&cfg.Metadata.Local)
+	case "bolt":
+		return metadata.NewBoltStore(&cfg.Metadata.Bolt)
+	case "dynamodb":
+		return metadata.NewDynamoDBStore(&cfg.Metadata.DynamoDB)
+	case "firestore":
+		return metadata.NewFirestoreStore(context.Background(), &cfg.Metadata.Firestore)
+	case "cosmos":
+		return metadata.NewCosmosStore(context.Background(), &cfg.Metadata.Cosmos)
+	case "etcd":
+		return metadata.NewEtcdStore(&cfg.Metadata.Etcd)
+	case "", "sqlite":
+		if err := os.MkdirAll(filepath.Dir(cfg.Metadata.SQLite.Path), 0o755); err != nil {
+			return nil, err
+		}
+		return metadata.NewSQLiteStoreWithConfig(&cfg.Metadata.SQLite)
+	default:
+		return nil, fmt.Errorf("unknown metadata engine: %s", engine)
+	}
+}
+
+// loadCheckpoint reads a migration checkpoint, returning nil if the file
+// does not exist yet.
+func loadCheckpoint(path string) (*metadata.MigrateCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp metadata.MigrateCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// saveCheckpoint writes a migration checkpoint atomically.
+func saveCheckpoint(path string, cp metadata.MigrateCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configPath := fs.String("config", "bleepstore.yaml", "Config file path for the source store")
+	toConfigPath := fs.String("to-config", "", "Config file path for the destination store (defaults to -config)")
+	from := fs.String("from", "", "Source metadata engine (defaults to metadata.engine)")
+	to := fs.String("to", "", "Destination metadata engine")
+	batch := fs.Int("batch", 1000, "Records listed and copied per batch")
+	resumeFile := fs.String("resume-file", "", "File recording progress, used to resume an interrupted migration")
+	verify := fs.Bool("verify", true, "Compare row counts and checksums after copying")
+	fs.Parse(args)
+
+	if *to == "" {
+		fmt.Fprintln(os.Stderr, "Error: -to is required")
+		return 1
+	}
+
+	srcCfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		return 1
+	}
+	dstCfg := srcCfg
+	if *toConfigPath != "" {
+		dstCfg, err = config.Load(*toConfigPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+			return 1
+		}
+	}
+
+	src, err := openStore(srcCfg, *from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening source store: %v\n", err)
+		return 1
+	}
+	defer src.Close()
+	dst, err := openStore(dstCfg, *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening destination store: %v\n", err)
+		return 1
+	}
+	defer dst.Close()
+
+	opts := metadata.MigrateOptions{BatchSize: *batch}
+	if *resumeFile != "" {
+		opts.Resume, err = loadCheckpoint(*resumeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading resume file: %v\n", err)
+			return 1
+		}
+		if opts.Resume != nil {
+			fmt.Fprintf(os.Stderr, "Resuming from %s phase (bucket %q, after %q)\n", opts.Resume.Phase, opts.Resume.Bucket, opts.Resume.AfterKey)
+		}
+		opts.Checkpoint = func(cp metadata.MigrateCheckpoint) error {
+			return saveCheckpoint(*resumeFile, cp)
+		}
+	}
+
+	ctx := context.Background()
+	stats, err := metadata.Migrate(ctx, src, dst, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "  credentials: %d copied\n", stats.Credentials)
+	fmt.Fprintf(os.Stderr, "  buckets: %d copied\n", stats.Buckets)
+	fmt.Fprintf(os.Stderr, "  objects: %d copied\n", stats.Objects)
+	fmt.Fprintf(os.Stderr, "  multipart_uploads: %d copied\n", stats.Uploads)
+	fmt.Fprintf(os.Stderr, "  multipart_parts: %d copied\n", stats.Parts)
+
+	if !*verify {
+		return 0
+	}
+	mismatches, err := metadata.VerifyMigration(ctx, src, dst, *batch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying: %v\n", err)
+		return 1
+	}
+	for _, m := range mismatches {
+		fmt.Fprintf(os.Stderr, "  MISMATCH: %s\n", m)
+	}
+	if len(mismatches) > 0 {
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Verification passed")
+	return 0
+}
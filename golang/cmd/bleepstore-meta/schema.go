@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+// runSchema reports the metadata schema version and, with -to, migrates
+// the schema up or down to that version. Opening a store already migrates
+// it to the latest version, so -to is mainly for rolling back before a
+// downgrade.
+func runSchema(args []string) int {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	configPath := fs.String("config", "bleepstore.yaml", "Config file path")
+	engine := fs.String("engine", "", "Metadata engine (defaults to metadata.engine)")
+	to := fs.Int("to", -1, "Target schema version (-1 = report only)")
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		return 1
+	}
+	store, err := openStore(cfg, *engine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	sm, ok := store.(metadata.SchemaMigrator)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "This metadata engine has no versioned schema")
+		return 0
+	}
+	ctx := context.Background()
+	if *to >= 0 {
+		version, err := sm.MigrateSchema(ctx, *to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error migrating schema: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Migrated schema to version %d\n", version)
+	}
+	current, latest, err := sm.SchemaVersion(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading schema version: %v\n", err)
+		return 1
+	}
+	fmt.Printf("schema version %d (latest %d)\n", current, latest)
+	return 0
+}
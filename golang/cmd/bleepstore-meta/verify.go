@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/serialization"
+)
+
+// runVerify cross-checks object metadata against the local storage backend
+// and prints one line per problem. It exits 0 when metadata and storage
+// agree, 2 when problems were found and 1 on error.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	configPath := fs.String("config", "bleepstore.yaml", "Config file path")
+	dbPath := fs.String("db", "", "SQLite database path (overrides config)")
+	storageRoot := fs.String("storage-root", "", "Comma-separated local storage roots (default: storage.local root_dirs or root_dir)")
+	buckets := fs.String("bucket", "", "Comma-separated bucket names; verify only these buckets")
+	rehash := fs.Bool("rehash", false, "Re-read every single-part object and compare its MD5 to the ETag")
+	fs.Parse(args)
+
+	db := *dbPath
+	if db == "" {
+		var err error
+		db, err = resolveDBPath(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+			return 1
+		}
+	}
+	roots := splitList(*storageRoot)
+	if len(roots) == 0 {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+			return 1
+		}
+		roots = cfg.Storage.Local.RootDirs
+		if len(roots) == 0 {
+			roots = []string{cfg.Storage.Local.RootDir}
+		}
+	}
+
+	report, err := serialization.VerifyStorage(db, &serialization.VerifyOptions{
+		Roots:   roots,
+		Buckets: splitList(*buckets),
+		Rehash:  *rehash,
+		OnFinding: func(f serialization.VerifyFinding) {
+			fmt.Printf("%s\t%s/%s\t%s\t%s\n", f.Kind, f.Bucket, f.Key, f.Path, f.Detail)
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Verified %d objects and %d files: %d missing, %d orphans, %d size mismatches",
+		report.Objects, report.Files, report.Missing, report.Orphans, report.SizeMismatches)
+	if *rehash {
+		fmt.Fprintf(os.Stderr, ", %d ETag mismatches (%d rehashed, %d multipart skipped)",
+			report.ETagMismatches, report.Rehashed, report.Unhashable)
+	}
+	fmt.Fprintln(os.Stderr)
+	if report.Problems() > 0 {
+		return 2
+	}
+	return 0
+}
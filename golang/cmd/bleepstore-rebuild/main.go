@@ -0,0 +1,58 @@
+// Package main is the entry point for bleepstore-rebuild, which restores the
+// parity of an erasure-coded storage backend while the server is stopped,
+// e.g. after replacing a failed disk. A running server does the same through
+// POST /admin/rebuild.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+func main() {
+	configPath := flag.String("config", "bleepstore.yaml", "Config file path")
+	dryRun := flag.Bool("dry-run", false, "Report missing and damaged shards without rewriting them")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Storage.Backend != "erasure" {
+		fmt.Fprintf(os.Stderr, "Error: storage backend %q is not erasure-coded\n", cfg.Storage.Backend)
+		os.Exit(1)
+	}
+	ecCfg := cfg.Storage.Erasure
+	backend, err := storage.NewErasureBackend(ecCfg.Disks, ecCfg.ParityShards, ecCfg.BlockSizeBytes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening storage: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := backend.Rebuild(ctx, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rebuilding: %v\n", err)
+		os.Exit(1)
+	}
+
+	verb := "Rewrote"
+	if result.DryRun {
+		verb = "Would rewrite"
+	}
+	fmt.Printf("Checked %d objects. %s %d shards of %d objects.\n", result.Objects, verb, result.Shards, result.Repaired)
+	for _, name := range result.Unrecoverable {
+		fmt.Printf("  UNRECOVERABLE: %s\n", name)
+	}
+	if len(result.Unrecoverable) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,315 @@
+// Package main is the entry point for bleepstore-seed, which populates a
+// running server with generated buckets and objects for demos and load tests.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// sizeBucket is one entry of a weighted object size distribution.
+type sizeBucket struct {
+	size   int64
+	weight int
+}
+
+// parseSize parses a byte count with an optional unit suffix (B, KB, MB,
+// GB, KiB, MiB, GiB).
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+		{"B", 1},
+	}
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSuffix(s, u.suffix), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// parseSizes parses a distribution such as "1KiB:70,1MiB:25,32MiB:5" into
+// sizes and relative weights.
+func parseSizes(spec string) ([]sizeBucket, error) {
+	var dist []sizeBucket
+	for _, entry := range strings.Split(spec, ",") {
+		sizeStr, weightStr, hasWeight := strings.Cut(entry, ":")
+		size, err := parseSize(sizeStr)
+		if err != nil {
+			return nil, err
+		}
+		weight := 1
+		if hasWeight {
+			weight, err = strconv.Atoi(strings.TrimSpace(weightStr))
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("invalid weight in %q", entry)
+			}
+		}
+		dist = append(dist, sizeBucket{size: size, weight: weight})
+	}
+	return dist, nil
+}
+
+// pickSize chooses a size from the distribution.
+func pickSize(rng *rand.Rand, dist []sizeBucket) int64 {
+	total := 0
+	for _, b := range dist {
+		total += b.weight
+	}
+	n := rng.Intn(total)
+	for _, b := range dist {
+		if n < b.weight {
+			return b.size
+		}
+		n -= b.weight
+	}
+	return dist[len(dist)-1].size
+}
+
+// seedObject is one object to upload.
+type seedObject struct {
+	bucket   string
+	key      string
+	size     int64
+	seed     int64
+	metadata map[string]string
+}
+
+// seeder uploads generated objects.
+type seeder struct {
+	client             *s3.Client
+	multipartThreshold int64
+	partSize           int64
+
+	objects atomic.Int64
+	bytes   atomic.Int64
+}
+
+// payload returns size bytes of deterministic pseudo-random data.
+func payload(seed int64, size int64) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// upload stores obj, using a multipart upload above the threshold.
+func (s *seeder) upload(ctx context.Context, obj seedObject) error {
+	if obj.size < s.multipartThreshold {
+		_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(obj.bucket),
+			Key:           aws.String(obj.key),
+			Body:          bytes.NewReader(payload(obj.seed, obj.size)),
+			ContentLength: aws.Int64(obj.size),
+			Metadata:      obj.metadata,
+		})
+		if err != nil {
+			return fmt.Errorf("putting %s/%s: %w", obj.bucket, obj.key, err)
+		}
+		s.objects.Add(1)
+		s.bytes.Add(obj.size)
+		return nil
+	}
+
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(obj.bucket),
+		Key:      aws.String(obj.key),
+		Metadata: obj.metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("creating upload for %s/%s: %w", obj.bucket, obj.key, err)
+	}
+	abort := func() {
+		s.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(obj.bucket),
+			Key:      aws.String(obj.key),
+			UploadId: created.UploadId,
+		})
+	}
+
+	var completed []types.CompletedPart
+	for offset, partNumber := int64(0), int32(1); offset < obj.size; offset, partNumber = offset+s.partSize, partNumber+1 {
+		n := min(s.partSize, obj.size-offset)
+		part, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(obj.bucket),
+			Key:           aws.String(obj.key),
+			UploadId:      created.UploadId,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          bytes.NewReader(payload(obj.seed+int64(partNumber), n)),
+			ContentLength: aws.Int64(n),
+		})
+		if err != nil {
+			abort()
+			return fmt.Errorf("uploading part %d of %s/%s: %w", partNumber, obj.bucket, obj.key, err)
+		}
+		completed = append(completed, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(partNumber)})
+	}
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(obj.bucket),
+		Key:             aws.String(obj.key),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		abort()
+		return fmt.Errorf("completing upload for %s/%s: %w", obj.bucket, obj.key, err)
+	}
+	s.objects.Add(1)
+	s.bytes.Add(obj.size)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("bleepstore-seed", flag.ExitOnError)
+	endpoint := fs.String("endpoint", "http://localhost:9000", "Server endpoint URL")
+	region := fs.String("region", "us-east-1", "Signing region")
+	accessKey := fs.String("access-key", "bleepstore", "Access key ID")
+	secretKey := fs.String("secret-key", "bleepstore-secret", "Secret access key")
+	buckets := fs.Int("buckets", 3, "Number of buckets to create")
+	bucketPrefix := fs.String("bucket-prefix", "seed-", "Prefix for generated bucket names")
+	objects := fs.Int("objects", 100, "Number of objects per bucket")
+	sizes := fs.String("sizes", "1KiB:70,64KiB:25,16MiB:5", "Object size distribution as size:weight pairs")
+	prefixes := fs.String("prefixes", "", "Comma-separated key prefixes objects are spread across")
+	metaCount := fs.Int("metadata", 0, "Number of x-amz-meta-* headers per object")
+	threshold := fs.String("multipart-threshold", "8MiB", "Objects at least this large use multipart upload")
+	partSizeStr := fs.String("part-size", "8MiB", "Multipart part size (minimum 5MiB)")
+	concurrency := fs.Int("concurrency", 8, "Concurrent uploads")
+	seed := fs.Int64("seed", 1, "Random seed; the same seed generates the same data set")
+	fs.Parse(args)
+
+	dist, err := parseSizes(*sizes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -sizes: %v\n", err)
+		return 1
+	}
+	multipartThreshold, err := parseSize(*threshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid -multipart-threshold: %v\n", err)
+		return 1
+	}
+	partSize, err := parseSize(*partSizeStr)
+	if err != nil || partSize < 5<<20 {
+		fmt.Fprintln(os.Stderr, "Error: -part-size must be at least 5MiB")
+		return 1
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+	keyPrefixes := []string{""}
+	if *prefixes != "" {
+		keyPrefixes = strings.Split(*prefixes, ",")
+	}
+
+	ctx := context.Background()
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(*region),
+		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(*accessKey, *secretKey, "")),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading AWS config: %v\n", err)
+		return 1
+	}
+	s := &seeder{
+		client: s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(*endpoint)
+			o.UsePathStyle = true
+		}),
+		multipartThreshold: multipartThreshold,
+		partSize:           partSize,
+	}
+
+	// Generate the whole plan up front from the seed so the data set does
+	// not depend on upload scheduling.
+	rng := rand.New(rand.NewSource(*seed))
+	var plan []seedObject
+	for b := 0; b < *buckets; b++ {
+		bucket := fmt.Sprintf("%s%03d", *bucketPrefix, b)
+		_, err := s.client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+		if err != nil && !strings.Contains(err.Error(), "BucketAlreadyOwnedByYou") {
+			fmt.Fprintf(os.Stderr, "Error creating bucket %s: %v\n", bucket, err)
+			return 1
+		}
+		for i := 0; i < *objects; i++ {
+			obj := seedObject{
+				bucket: bucket,
+				key:    fmt.Sprintf("%sobj-%06d", keyPrefixes[rng.Intn(len(keyPrefixes))], i),
+				size:   pickSize(rng, dist),
+				seed:   rng.Int63(),
+			}
+			if *metaCount > 0 {
+				obj.metadata = make(map[string]string, *metaCount)
+				for m := 0; m < *metaCount; m++ {
+					obj.metadata[fmt.Sprintf("seed-%d", m)] = strconv.FormatInt(rng.Int63(), 36)
+				}
+			}
+			plan = append(plan, obj)
+		}
+	}
+	// Upload large objects first so they do not trail at the end.
+	sort.SliceStable(plan, func(i, j int) bool { return plan[i].size > plan[j].size })
+
+	start := time.Now()
+	work := make(chan seedObject)
+	var (
+		wg       sync.WaitGroup
+		failures atomic.Int64
+	)
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range work {
+				if err := s.upload(ctx, obj); err != nil {
+					failures.Add(1)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+			}
+		}()
+	}
+	for _, obj := range plan {
+		work <- obj
+	}
+	close(work)
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	fmt.Fprintf(os.Stderr, "Seeded %d buckets, %d objects, %d bytes in %s (%.1f MiB/s)\n",
+		*buckets, s.objects.Load(), s.bytes.Load(), elapsed.Round(time.Millisecond),
+		float64(s.bytes.Load())/(1<<20)/elapsed.Seconds())
+	if n := failures.Load(); n > 0 {
+		fmt.Fprintf(os.Stderr, "%d uploads failed\n", n)
+		return 1
+	}
+	return 0
+}
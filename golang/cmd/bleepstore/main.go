@@ -22,6 +22,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "preflight" {
+		os.Exit(runPreflight(os.Args[2:]))
+	}
+
 	configPath := flag.String("config", "config.yaml", "path to configuration file")
 	port := flag.Int("port", 0, "override listening port (default: from config or 9000)")
 	host := flag.String("host", "", "override listening host (default: from config or 0.0.0.0)")
@@ -87,12 +91,28 @@ func main() {
 		}
 		metaStore = localStore
 		slog.Info("Metadata backend initialized", "backend", "local", "root_dir", cfg.Metadata.Local.RootDir)
+	case "bolt":
+		boltStore, err := metadata.NewBoltStore(&cfg.Metadata.Bolt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to initialize bolt metadata store: %v\n", err)
+			os.Exit(1)
+		}
+		metaStore = boltStore
+		slog.Info("Metadata backend initialized", "backend", "bolt", "path", cfg.Metadata.Bolt.Path)
 	case "dynamodb":
 		dynamoStore, err := metadata.NewDynamoDBStore(&cfg.Metadata.DynamoDB)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to initialize DynamoDB metadata store: %v\n", err)
 			os.Exit(1)
 		}
+		if cfg.Metadata.DynamoDB.BackfillListIndex {
+			n, err := dynamoStore.BackfillListIndex(context.Background())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to backfill DynamoDB list index: %v\n", err)
+				os.Exit(1)
+			}
+			slog.Info("DynamoDB list index backfilled", "items", n)
+		}
 		metaStore = dynamoStore
 		slog.Info("Metadata backend initialized", "backend", "dynamodb", "table", cfg.Metadata.DynamoDB.Table)
 	case "firestore":
@@ -111,6 +131,14 @@ func main() {
 		}
 		metaStore = cosmosStore
 		slog.Info("Metadata backend initialized", "backend", "cosmos", "database", cfg.Metadata.Cosmos.Database, "container", cfg.Metadata.Cosmos.Container)
+	case "etcd":
+		etcdStore, err := metadata.NewEtcdStore(&cfg.Metadata.Etcd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to initialize etcd metadata store: %v\n", err)
+			os.Exit(1)
+		}
+		metaStore = etcdStore
+		slog.Info("Metadata backend initialized", "backend", "etcd", "endpoints", cfg.Metadata.Etcd.Endpoints)
 	default:
 		// Default to SQLite metadata store.
 		dbPath := cfg.Metadata.SQLite.Path
@@ -119,7 +147,7 @@ func main() {
 			fmt.Fprintf(os.Stderr, "failed to create metadata directory: %v\n", err)
 			os.Exit(1)
 		}
-		sqliteStore, err := metadata.NewSQLiteStore(dbPath)
+		sqliteStore, err := metadata.NewSQLiteStoreWithConfig(&cfg.Metadata.SQLite)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to initialize SQLite metadata store: %v\n", err)
 			os.Exit(1)
@@ -130,10 +158,28 @@ func main() {
 	defer metaStore.Close()
 
 	// Seed default credentials (idempotent — crash-only recovery step).
-	if err := seedDefaultCredentials(metaStore, cfg); err != nil {
+	var sealer *metadata.SecretSealer
+	if cfg.Auth.MasterKey != "" {
+		if sealer, err = metadata.NewSecretSealer(cfg.Auth.MasterKey); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid auth.master_key: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := seedDefaultCredentials(metaStore, cfg, sealer); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to seed credentials: %v\n", err)
 		os.Exit(1)
 	}
+	// Seal secret keys stored in plaintext (idempotent, like seeding).
+	if sealer != nil {
+		n, err := metadata.SealCredentials(context.Background(), metaStore, sealer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to seal credential secrets: %v\n", err)
+			os.Exit(1)
+		}
+		if n > 0 {
+			slog.Info("Sealed credential secret keys", "count", n)
+		}
+	}
 
 	// Initialize storage backend based on config.
 	var storageBackend storage.StorageBackend
@@ -196,6 +242,7 @@ func main() {
 			memCfg.Persistence,
 			memCfg.SnapshotPath,
 			memCfg.SnapshotIntervalSeconds,
+			memCfg.SnapshotCompression,
 		)
 		if memErr != nil {
 			fmt.Fprintf(os.Stderr, "failed to initialize memory storage backend: %v\n", memErr)
@@ -213,7 +260,91 @@ func main() {
 		}
 		storageBackend = sqliteBackend
 		slog.Info("Storage backend initialized", "backend", "sqlite", "path", cfg.Metadata.SQLite.Path)
+	case "mirror":
+		mirrorCfg := cfg.Storage.Mirror
+		var targets []storage.MirrorTarget
+		for _, tc := range mirrorCfg.Targets {
+			localBackend, localErr := storage.NewLocalBackend(tc.RootDir)
+			if localErr != nil {
+				fmt.Fprintf(os.Stderr, "failed to initialize mirror target %q: %v\n", tc.RootDir, localErr)
+				os.Exit(1)
+			}
+			// Crash-only recovery: clean orphan temp files from incomplete writes.
+			if err := localBackend.CleanTempFiles(); err != nil {
+				slog.Warn("Failed to clean temp files", "root", tc.RootDir, "error", err)
+			}
+			name := tc.Name
+			if name == "" {
+				name = tc.RootDir
+			}
+			targets = append(targets, storage.MirrorTarget{Name: name, Zone: tc.Zone, Backend: localBackend})
+		}
+		mirrorBackend, mirrorErr := storage.NewMirrorBackend(targets, mirrorCfg.Copies, mirrorCfg.MinZones)
+		if mirrorErr != nil {
+			fmt.Fprintf(os.Stderr, "failed to initialize mirror storage backend: %v\n", mirrorErr)
+			os.Exit(1)
+		}
+		storageBackend = mirrorBackend
+		policy := mirrorBackend.PlacementPolicy(context.Background())
+		slog.Info("Storage backend initialized", "backend", "mirror", "targets", len(targets),
+			"zones", policy.Zones, "copies", policy.Copies, "min_zones", policy.MinZones)
+	case "erasure":
+		ecCfg := cfg.Storage.Erasure
+		erasureBackend, ecErr := storage.NewErasureBackend(ecCfg.Disks, ecCfg.ParityShards, ecCfg.BlockSizeBytes)
+		if ecErr != nil {
+			fmt.Fprintf(os.Stderr, "failed to initialize erasure storage backend: %v\n", ecErr)
+			os.Exit(1)
+		}
+		// Crash-only recovery: clean orphan temp files from incomplete writes.
+		if err := erasureBackend.CleanTempFiles(); err != nil {
+			slog.Warn("Failed to clean temp files", "error", err)
+		}
+		storageBackend = erasureBackend
+		slog.Info("Storage backend initialized", "backend", "erasure", "disks", len(ecCfg.Disks),
+			"parity_shards", ecCfg.ParityShards, "block_size_bytes", ecCfg.BlockSizeBytes)
+	case "dedup":
+		dedupCfg := cfg.Storage.Dedup
+		dedupBackend, dedupErr := storage.NewDedupBackend(dedupCfg.RootDir)
+		if dedupErr != nil {
+			fmt.Fprintf(os.Stderr, "failed to initialize dedup storage backend: %v\n", dedupErr)
+			os.Exit(1)
+		}
+		defer dedupBackend.Close()
+		// Crash-only recovery: clean orphan temp files from incomplete writes.
+		if err := dedupBackend.CleanTempFiles(); err != nil {
+			slog.Warn("Failed to clean temp files", "error", err)
+		}
+		storageBackend = dedupBackend
+		slog.Info("Storage backend initialized", "backend", "dedup", "root", dedupCfg.RootDir,
+			"gc_interval_seconds", dedupCfg.GCIntervalSeconds)
 	default:
+		// Multiple data roots: spread objects across disks.
+		if len(cfg.Storage.Local.RootDirs) > 0 {
+			if cfg.Storage.Local.Pack.Enabled {
+				fmt.Fprintf(os.Stderr, "storage.local.pack is not supported with storage.local.root_dirs\n")
+				os.Exit(1)
+			}
+			if cfg.Storage.Local.Naming.Scheme != storage.NamingPlain {
+				fmt.Fprintf(os.Stderr, "storage.local.naming is not supported with storage.local.root_dirs\n")
+				os.Exit(1)
+			}
+			jbodBackend, jbodErr := storage.NewJBODBackend(cfg.Storage.Local.RootDirs,
+				storage.JBODOptions{IndexPath: cfg.Storage.Local.PlacementIndex})
+			if jbodErr != nil {
+				fmt.Fprintf(os.Stderr, "failed to initialize JBOD storage backend: %v\n", jbodErr)
+				os.Exit(1)
+			}
+			defer jbodBackend.Close()
+			// Crash-only recovery: clean orphan temp files from incomplete writes.
+			if err := jbodBackend.CleanTempFiles(); err != nil {
+				slog.Warn("Failed to clean temp files", "error", err)
+			}
+			storageBackend = jbodBackend
+			slog.Info("Storage backend initialized", "backend", "local", "roots", cfg.Storage.Local.RootDirs,
+				"placement_index", cfg.Storage.Local.PlacementIndex)
+			break
+		}
+
 		// Default to local filesystem backend.
 		storageRoot := cfg.Storage.Local.RootDir
 		if err := os.MkdirAll(storageRoot, 0o755); err != nil {
@@ -231,6 +362,49 @@ func main() {
 		}
 		storageBackend = localBackend
 		slog.Info("Storage backend initialized", "backend", "local", "root", storageRoot)
+
+		// Name object files after a keyed hash of bucket and key, recording
+		// each name's key in the metadata store.
+		switch namingCfg := cfg.Storage.Local.Naming; namingCfg.Scheme {
+		case storage.NamingPlain:
+		case storage.NamingHashed:
+			if cfg.Storage.Local.Pack.Enabled {
+				fmt.Fprintf(os.Stderr, "storage.local.naming hashed is not supported with storage.local.pack\n")
+				os.Exit(1)
+			}
+			index, ok := metaStore.(storage.NameIndex)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "storage.local.naming hashed needs the sqlite metadata engine, not %q\n", cfg.Metadata.Engine)
+				os.Exit(1)
+			}
+			namer, namingErr := storage.NewHashedNames(namingCfg.Secret)
+			if namingErr != nil {
+				fmt.Fprintf(os.Stderr, "failed to initialize storage.local.naming: %v\n", namingErr)
+				os.Exit(1)
+			}
+			localBackend.SetNamer(namer, index)
+			slog.Info("Hashed object file names enabled")
+		default:
+			fmt.Fprintf(os.Stderr, "storage.local.naming scheme %q is not supported\n", namingCfg.Scheme)
+			os.Exit(1)
+		}
+
+		// Pack small objects into segment files under the root.
+		if packCfg := cfg.Storage.Local.Pack; packCfg.Enabled {
+			packedBackend, packErr := storage.NewPackedBackend(localBackend, filepath.Join(storageRoot, storage.PackDirName), storage.PackOptions{
+				ThresholdBytes: packCfg.ThresholdBytes,
+				SegmentBytes:   packCfg.SegmentBytes,
+				CompactRatio:   packCfg.CompactRatio,
+			})
+			if packErr != nil {
+				fmt.Fprintf(os.Stderr, "failed to initialize segment packing: %v\n", packErr)
+				os.Exit(1)
+			}
+			defer packedBackend.Close()
+			storageBackend = packedBackend
+			slog.Info("Small object packing enabled", "threshold_bytes", packCfg.ThresholdBytes,
+				"segment_bytes", packCfg.SegmentBytes)
+		}
 	}
 
 	// Crash-only recovery: reap expired multipart uploads (7-day TTL).
@@ -240,10 +414,10 @@ func main() {
 			slog.Warn("Failed to reap expired multipart uploads", "error", reapErr)
 		} else if len(expired) > 0 {
 			slog.Info(fmt.Sprintf("Reaped %d expired multipart uploads", len(expired)))
-			// Clean up storage files for reaped uploads (local backend only).
-			if localBackend, ok := storageBackend.(*storage.LocalBackend); ok {
+			// Clean up storage files for reaped uploads (local backends only).
+			if partsCleaner, ok := storageBackend.(interface{ DeleteUploadParts(string) error }); ok {
 				for _, u := range expired {
-					if err := localBackend.DeleteUploadParts(u.UploadID); err != nil {
+					if err := partsCleaner.DeleteUploadParts(u.UploadID); err != nil {
 						slog.Warn("Failed to clean up parts for reaped upload",
 							"upload_id", u.UploadID, "error", err)
 					}
@@ -252,6 +426,50 @@ func main() {
 		}
 	}
 
+	// Size concurrency to what the backend sustains. The wrapper hides the
+	// backend's own methods, so it goes on after the reaping above.
+	if acCfg := cfg.Storage.AdaptiveConcurrency; acCfg.Enabled {
+		switch cfg.Storage.Backend {
+		case "sqlite", "aws", "gcp", "azure":
+			adaptiveBackend, acErr := storage.NewAdaptiveBackend(storageBackend, storage.AdaptiveOptions{
+				InitialLimit:  acCfg.InitialLimit,
+				MinLimit:      acCfg.MinLimit,
+				MaxLimit:      acCfg.MaxLimit,
+				TargetLatency: time.Duration(acCfg.TargetLatencyMillis) * time.Millisecond,
+				OnChange: func(limit float64, inflight int) {
+					metrics.StorageConcurrencyLimit.Set(limit)
+					metrics.StorageOperationsInFlight.Set(float64(inflight))
+				},
+			})
+			if acErr != nil {
+				fmt.Fprintf(os.Stderr, "invalid storage.adaptive_concurrency: %v\n", acErr)
+				os.Exit(1)
+			}
+			storageBackend = adaptiveBackend
+			slog.Info("Adaptive storage concurrency enabled", "initial_limit", acCfg.InitialLimit,
+				"min_limit", acCfg.MinLimit, "max_limit", acCfg.MaxLimit, "target_latency_ms", acCfg.TargetLatencyMillis)
+		default:
+			slog.Warn("storage.adaptive_concurrency only applies to the sqlite and gateway backends", "backend", cfg.Storage.Backend)
+		}
+	}
+
+	// Share one upstream fetch among concurrent GETs of an object.
+	if cfg.Storage.CoalesceReads {
+		switch cfg.Storage.Backend {
+		case "aws", "gcp", "azure":
+			storageBackend = storage.NewCoalescingBackend(storageBackend, cfg.Storage.CoalesceSpoolDir, func(joined bool) {
+				if joined {
+					metrics.CoalescedGetsTotal.WithLabelValues("joined").Inc()
+				} else {
+					metrics.CoalescedGetsTotal.WithLabelValues("fetched").Inc()
+				}
+			})
+			slog.Info("Read coalescing enabled", "spool_dir", cfg.Storage.CoalesceSpoolDir)
+		default:
+			slog.Warn("storage.coalesce_reads only applies to the gateway backends", "backend", cfg.Storage.Backend)
+		}
+	}
+
 	// Register Prometheus metrics and seed gauges (always enabled for
 	// observability test compatibility).
 	metrics.Register()
@@ -269,7 +487,7 @@ func main() {
 	// Start the server in a goroutine so we can handle shutdown signals.
 	errCh := make(chan error, 1)
 	go func() {
-		slog.Info("BleepStore listening", "addr", addr)
+		slog.Info("BleepStore listening", "addr", addr, "tls", cfg.Server.TLS.Enabled)
 		if err := srv.ListenAndServe(addr); err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
@@ -281,6 +499,21 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
+	// SIGHUP re-reads the config file and applies hot-reloadable settings.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			newCfg, err := config.Load(*configPath)
+			if err != nil {
+				slog.Error("Config reload failed", "error", err)
+				continue
+			}
+			srv.ReloadRateLimits(newCfg.RateLimit)
+			slog.Info("Config reloaded", "path", *configPath)
+		}
+	}()
+
 	select {
 	case sig := <-sigCh:
 		slog.Info("Received signal, shutting down", "signal", sig)
@@ -305,7 +538,7 @@ func main() {
 // seedDefaultCredentials creates the default credential record from the config
 // if it does not already exist. This runs on every startup as part of
 // crash-only recovery.
-func seedDefaultCredentials(store metadata.MetadataStore, cfg *config.Config) error {
+func seedDefaultCredentials(store metadata.MetadataStore, cfg *config.Config, sealer *metadata.SecretSealer) error {
 	ctx := context.Background()
 
 	// Check if the default credential already exists.
@@ -318,9 +551,13 @@ func seedDefaultCredentials(store metadata.MetadataStore, cfg *config.Config) er
 		return nil
 	}
 
+	secret, err := sealer.Seal(cfg.Auth.AccessKey, cfg.Auth.SecretKey)
+	if err != nil {
+		return fmt.Errorf("sealing default credential: %w", err)
+	}
 	cred := &metadata.CredentialRecord{
 		AccessKeyID: cfg.Auth.AccessKey,
-		SecretKey:   cfg.Auth.SecretKey,
+		SecretKey:   secret,
 		OwnerID:     cfg.Auth.AccessKey,
 		DisplayName: cfg.Auth.AccessKey,
 		Active:      true,
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bleepstore/bleepstore/internal/preflight"
+)
+
+// runPreflight checks the config, metadata schema and storage layout of a
+// deployment against this binary and prints one line per finding, without
+// changing anything. Run it with the new binary before switching to it. It
+// exits 0 when the upgrade can go ahead, 2 when something blocks it and 1
+// on error.
+func runPreflight(args []string) int {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "path to configuration file")
+	fs.Parse(args)
+
+	report, err := preflight.Run(context.Background(), *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "preflight failed: %v\n", err)
+		return 1
+	}
+	steps := 0
+	for _, f := range report.Findings {
+		fmt.Printf("%s\t%s\t%s\n", f.Severity, f.Check, f.Message)
+		if f.Severity == preflight.Step {
+			steps++
+		}
+	}
+
+	if n := report.Blockers(); n > 0 {
+		fmt.Fprintf(os.Stderr, "%d blocker(s): resolve them before starting this binary\n", n)
+		return 2
+	}
+	if steps > 0 {
+		fmt.Fprintln(os.Stderr, "Ready to upgrade; the steps above run when this binary starts")
+	} else {
+		fmt.Fprintln(os.Stderr, "Ready to upgrade; nothing to migrate")
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+// VerifyClientCert authenticates a request by its verified TLS client
+// certificate. The leaf certificate's subject is looked up in
+// CertSubjects, first as the full distinguished name and then as the
+// common name, to find the access key whose identity the request assumes.
+// Returns (nil, nil) when the connection carries no verified certificate.
+func (v *SigV4Verifier) VerifyClientCert(r *http.Request) (*metadata.CredentialRecord, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+
+	accessKeyID, ok := v.CertSubjects[subject.String()]
+	if !ok {
+		accessKeyID, ok = v.CertSubjects[subject.CommonName]
+	}
+	if !ok {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Client certificate subject is not mapped to any credentials"}
+	}
+
+	cred, err := v.cachedGetCredential(r.Context(), accessKeyID)
+	if err != nil {
+		return nil, &AuthError{Code: "InternalError", Message: "Failed to look up credentials"}
+	}
+	if cred == nil || !cred.Active {
+		return nil, &AuthError{Code: "InvalidAccessKeyId", Message: "The access key mapped to this client certificate does not exist in our records"}
+	}
+	return cred, nil
+}
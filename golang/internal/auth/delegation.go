@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/s3op"
+)
+
+const (
+	// delegationTokenPrefix versions the token format.
+	delegationTokenPrefix = "bst1."
+
+	// delegationQueryParam carries a delegation token in a URL, so scoped
+	// links can be handed out like presigned URLs.
+	delegationQueryParam = "X-Bleepstore-Token"
+)
+
+// DelegationClaims are the signed contents of a delegation token. A token
+// grants access to keys under Prefix in Bucket until ExpiresAt, acting as
+// the access key that minted it. Tokens are verified with the shared secret
+// alone, without a metadata lookup.
+type DelegationClaims struct {
+	Bucket      string `json:"b"`
+	Prefix      string `json:"p"`
+	Write       bool   `json:"w,omitempty"`
+	ExpiresAt   int64  `json:"exp"`
+	AccessKeyID string `json:"ak"`
+	OwnerID     string `json:"oid"`
+	DisplayName string `json:"odn"`
+}
+
+// SignDelegationToken encodes and signs claims with secret.
+func SignDelegationToken(secret []byte, claims *DelegationClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encoding delegation claims: %w", err)
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return delegationTokenPrefix + body + "." + delegationSignature(secret, body), nil
+}
+
+// delegationSignature returns the encoded HMAC-SHA256 of a token body.
+func delegationSignature(secret []byte, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(delegationTokenPrefix + body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ParseDelegationToken verifies a token's signature and expiry and returns
+// its claims.
+func ParseDelegationToken(secret []byte, token string, now time.Time) (*DelegationClaims, error) {
+	rest, ok := strings.CutPrefix(token, delegationTokenPrefix)
+	if !ok {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Malformed delegation token"}
+	}
+	body, sig, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Malformed delegation token"}
+	}
+	if !hmac.Equal([]byte(sig), []byte(delegationSignature(secret, body))) {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Invalid delegation token signature"}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Malformed delegation token"}
+	}
+	var claims DelegationClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Malformed delegation token"}
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Delegation token has expired"}
+	}
+	return &claims, nil
+}
+
+// Allows reports whether the claims permit the request. Object requests must
+// name a key under the prefix, and writes need a write token. Bucket-level
+// requests are limited to listings whose prefix parameter stays within the
+// token's prefix. Paths are matched path-style; see Scope.
+func (c *DelegationClaims) Allows(r *http.Request) bool {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != c.Bucket {
+		return false
+	}
+
+	q := r.URL.Query()
+	op := s3op.Classify(r.Method, bucket, key, q, r.Header)
+	if key == "" {
+		switch op {
+		case s3op.HeadBucket, s3op.GetBucketLocation:
+			return true
+		case s3op.ListObjects, s3op.ListObjectsV2:
+			return strings.HasPrefix(q.Get("prefix"), c.Prefix)
+		case s3op.ListMultipartUploads:
+			return c.Write && strings.HasPrefix(q.Get("prefix"), c.Prefix)
+		default:
+			return false
+		}
+	}
+
+	if !strings.HasPrefix(key, c.Prefix) {
+		return false
+	}
+	switch {
+	case op.IsRead():
+		return true
+	case op.IsWrite():
+		if !c.Write {
+			return false
+		}
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+			srcKey, _, _ = strings.Cut(srcKey, "?")
+			if decoded, err := url.PathUnescape(srcKey); err == nil {
+				srcKey = decoded
+			}
+			return srcBucket == c.Bucket && strings.HasPrefix(srcKey, c.Prefix)
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// delegationToken extracts a delegation token from an "Authorization:
+// Bearer" header or the X-Bleepstore-Token query parameter.
+func delegationToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get(delegationQueryParam)
+}
+
+// VerifyDelegation authenticates a request carrying a delegation token and
+// checks that the token's scope covers it.
+func (v *SigV4Verifier) VerifyDelegation(r *http.Request) (*DelegationClaims, error) {
+	if len(v.DelegationSecret) == 0 {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Delegation tokens are not enabled"}
+	}
+	claims, err := ParseDelegationToken(v.DelegationSecret, delegationToken(r), v.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !claims.Allows(r) {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Request is outside the delegation token's scope"}
+	}
+	return claims, nil
+}
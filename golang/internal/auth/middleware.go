@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
 	"github.com/bleepstore/bleepstore/internal/xmlutil"
 )
 
@@ -20,10 +21,41 @@ var skipPaths = map[string]bool{
 	"/openapi.json": true,
 }
 
+// Identity is the principal a request authenticated as. The zero Identity,
+// with neither an access key nor an owner, is anonymous.
+type Identity struct {
+	AccessKeyID string
+	OwnerID     string
+	DisplayName string
+	// Scope, when set, limits the identity to the requests it allows, as
+	// for delegation and OIDC tokens.
+	Scope Scope
+}
+
+// Scope limits a token to some requests. Allows matches the request's
+// path-style path, so it is checked when the token is verified and again
+// once virtual-hosted, custom-domain and alias addressing is resolved to
+// the bucket the request really operates on.
+type Scope interface {
+	Allows(r *http.Request) bool
+}
+
 // Middleware returns HTTP middleware that enforces AWS SigV4 authentication
 // on all requests except those to excluded paths (/health, /metrics, /docs, /openapi.json).
-// On success, the authenticated owner identity is set on the request context.
+// See SigV4Verifier.Authenticate for the methods accepted.
+// On success, the authenticated owner identity and access key are set on the
+// request context.
 func Middleware(verifier *SigV4Verifier) func(http.Handler) http.Handler {
+	return MiddlewareFunc(verifier.Authenticate)
+}
+
+// MiddlewareFunc returns HTTP middleware that authenticates every request
+// except those to excluded paths with authenticate, and sets the identity
+// it returns on the request context. Anonymous identities are refused on
+// the admin endpoints, and other identities must name an access key. An
+// *s3err.S3Error from authenticate is sent as it is, an *AuthError as the
+// matching S3 error, and any other error as InternalError.
+func MiddlewareFunc(authenticate func(*http.Request) (Identity, error)) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip authentication for excluded paths.
@@ -33,40 +65,37 @@ func Middleware(verifier *SigV4Verifier) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Detect authentication method.
-			method := DetectAuthMethod(r)
-
-			switch method {
-			case "none":
-				xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
-				return
+			// authenticate may replace the body, as SigV4 does with one
+			// spooled to disk to hash it; close it once served.
+			defer func() {
+				if r.Body != nil {
+					r.Body.Close()
+				}
+			}()
 
-			case "ambiguous":
-				xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
-					Code:       "InvalidArgument",
-					Message:    "Only one auth mechanism allowed; found both Authorization header and query string parameters",
-					HTTPStatus: 400,
-				})
+			id, err := authenticate(r)
+			if err != nil {
+				writeAuthError(w, r, err)
 				return
-
-			case "header":
-				cred, err := verifier.VerifyRequest(r)
-				if err != nil {
-					writeAuthError(w, r, err)
+			}
+			switch {
+			case id == (Identity{}):
+				if strings.HasPrefix(path, "/admin/") {
+					xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
 					return
 				}
-				// Set owner identity on context.
-				ctx := contextWithOwner(r.Context(), cred.OwnerID, cred.DisplayName)
-				r = r.WithContext(ctx)
-
-			case "presigned":
-				cred, err := verifier.VerifyPresigned(r)
-				if err != nil {
-					writeAuthError(w, r, err)
-					return
+				r = r.WithContext(contextWithAnonymous(r.Context()))
+			case id.AccessKeyID == "":
+				// An identity that is not anonymous must name an access
+				// key; one without is refused.
+				xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+				return
+			default:
+				ctx := contextWithOwner(r.Context(), id.OwnerID, id.DisplayName)
+				ctx = contextWithAccessKey(ctx, id.AccessKeyID)
+				if id.Scope != nil {
+					ctx = contextWithScope(ctx, id.Scope)
 				}
-				// Set owner identity on context.
-				ctx := contextWithOwner(r.Context(), cred.OwnerID, cred.DisplayName)
 				r = r.WithContext(ctx)
 			}
 
@@ -75,8 +104,77 @@ func Middleware(verifier *SigV4Verifier) func(http.Handler) http.Handler {
 	}
 }
 
-// writeAuthError maps an AuthError to the appropriate S3 error XML response.
+// Authenticate authenticates r by whichever method it carries: a SigV4
+// Authorization header, a presigned URL, a delegation token, which is
+// limited to the token's prefix, or, when OIDC is set, a bearer JWT, which
+// is limited to its permissions. Bearer tokens never reach the admin
+// endpoints.
+// Unsigned requests may authenticate with a verified TLS client
+// certificate when CertSubjects is configured; with AllowAnonymous set,
+// other unsigned requests are returned as anonymous.
+func (v *SigV4Verifier) Authenticate(r *http.Request) (Identity, error) {
+	var cred *metadata.CredentialRecord
+	var err error
+	switch DetectAuthMethod(r) {
+	case "none":
+		// Unsigned requests may still authenticate with a verified
+		// TLS client certificate (mutual TLS mode).
+		cred, err = v.VerifyClientCert(r)
+		if err == nil && cred == nil {
+			if v.AllowAnonymous {
+				return Identity{}, nil
+			}
+			err = &AuthError{Code: "AccessDenied", Message: "Request is not signed"}
+		}
+
+	case "ambiguous":
+		return Identity{}, &s3err.S3Error{
+			Code:       "InvalidArgument",
+			Message:    "Only one auth mechanism allowed; found both Authorization header and query string parameters",
+			HTTPStatus: 400,
+		}
+
+	case "header":
+		cred, err = v.VerifyRequest(r)
+
+	case "token":
+		// Bearer tokens grant scoped S3 access, never access to the
+		// admin endpoints.
+		if strings.HasPrefix(r.URL.Path, "/admin/") {
+			return Identity{}, &AuthError{Code: "AccessDenied", Message: "Bearer tokens do not reach the admin API"}
+		}
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && v.OIDC != nil && IsOIDCToken(strings.TrimSpace(token)) {
+			claims, err := v.OIDC.Verify(r.Context(), strings.TrimSpace(token))
+			if err != nil {
+				return Identity{}, err
+			}
+			if !claims.Allows(r) {
+				return Identity{}, &AuthError{Code: "AccessDenied", Message: "Request is outside the bearer token's permissions"}
+			}
+			principal := OIDCAccessKeyPrefix + claims.Owner
+			return Identity{AccessKeyID: principal, OwnerID: principal, DisplayName: claims.Owner, Scope: claims}, nil
+		}
+		claims, err := v.VerifyDelegation(r)
+		if err != nil {
+			return Identity{}, err
+		}
+		return Identity{AccessKeyID: claims.AccessKeyID, OwnerID: claims.OwnerID, DisplayName: claims.DisplayName, Scope: claims}, nil
+
+	case "presigned":
+		cred, err = v.VerifyPresigned(r)
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{AccessKeyID: cred.AccessKeyID, OwnerID: cred.OwnerID, DisplayName: cred.DisplayName}, nil
+}
+
+// writeAuthError maps an S3Error or AuthError to the appropriate S3 error XML response.
 func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	if s3e, ok := err.(*s3err.S3Error); ok {
+		xmlutil.WriteErrorResponse(w, r, s3e)
+		return
+	}
 	authErr, ok := err.(*AuthError)
 	if !ok {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
@@ -92,6 +190,16 @@ func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrRequestTimeTooSkewed)
 	case "AccessDenied":
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+	case "AuthorizationHeaderMalformed", "AuthorizationQueryParametersError":
+		base := s3err.ErrAuthorizationHeaderMalformed
+		if authErr.Code == "AuthorizationQueryParametersError" {
+			base = s3err.ErrAuthorizationQueryParametersError
+		}
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       base.Code,
+			Message:    authErr.Message,
+			HTTPStatus: base.HTTPStatus,
+		})
 	default:
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
 	}
@@ -0,0 +1,400 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	"github.com/bleepstore/bleepstore/internal/s3op"
+)
+
+const (
+	// OIDCAccessKeyPrefix prefixes the owner of a bearer JWT to form the
+	// access key ID and owner ID its requests are attributed to, so per-key
+	// rate limits and usage apply and the identity never passes for the
+	// root key or the owner of a static credential.
+	OIDCAccessKeyPrefix = "oidc:"
+
+	// oidcLeeway tolerates clock skew between BleepStore and the issuer.
+	oidcLeeway = time.Minute
+	// jwksMaxAge bounds how long fetched signing keys are trusted.
+	jwksMaxAge = time.Hour
+	// jwksMinRefresh limits refetches for tokens naming an unknown key.
+	jwksMinRefresh = time.Minute
+	// oidcMaxDocument caps the size of discovery and JWKS documents.
+	oidcMaxDocument = 1 << 20
+)
+
+// OIDCVerifier validates bearer JWTs issued by an OpenID Connect provider.
+// Signing keys are fetched from the issuer's JWKS on first use, again once
+// they are an hour old, and when a token names an unknown key (at most once
+// a minute), so key rotations are picked up without a restart.
+type OIDCVerifier struct {
+	// Issuer is the required iss claim.
+	Issuer string
+	// Audience is the required aud claim. Empty accepts any audience.
+	Audience string
+	// JWKSURL is where signing keys are fetched. Empty discovers it from
+	// the issuer's /.well-known/openid-configuration.
+	JWKSURL string
+	// OwnerClaim names the claim used as the caller's owner ID.
+	OwnerClaim string
+	// PermissionsClaim names the claim listing the caller's permissions,
+	// either a space-separated string or an array of strings.
+	PermissionsClaim string
+	// Client fetches the discovery and JWKS documents.
+	Client *http.Client
+	// Clock supplies the current time for expiry checks.
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// NewOIDCVerifier returns a verifier for tokens from issuer that takes the
+// owner from the sub claim and permissions from the scope claim.
+func NewOIDCVerifier(issuer string) *OIDCVerifier {
+	return &OIDCVerifier{
+		Issuer:           issuer,
+		OwnerClaim:       "sub",
+		PermissionsClaim: "scope",
+		Client:           &http.Client{Timeout: 10 * time.Second},
+		Clock:            clock.System{},
+	}
+}
+
+// OIDCClaims are the identity and permissions a verified token carries.
+// Permissions are "s3:read" and "s3:write", for every bucket, or
+// "s3:read:<bucket>" and "s3:write:<bucket>" for one; write implies read.
+// Other entries in the permissions claim are ignored.
+type OIDCClaims struct {
+	Owner       string
+	Permissions []string
+}
+
+// can reports whether the claims grant read or write on bucket.
+func (c *OIDCClaims) can(write bool, bucket string) bool {
+	for _, p := range c.Permissions {
+		rest, ok := strings.CutPrefix(p, "s3:")
+		if !ok {
+			continue
+		}
+		level, scope, _ := strings.Cut(rest, ":")
+		if scope != "" && scope != bucket {
+			continue
+		}
+		if level == "write" || (level == "read" && !write) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the claims permit the request: reads need read on
+// the bucket, writes need write, and a copy also needs read on its source.
+// Listing buckets needs an unscoped permission. Paths are matched
+// path-style, as the client addressed them.
+func (c *OIDCClaims) Allows(r *http.Request) bool {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	op := s3op.Classify(r.Method, bucket, key, r.URL.Query(), r.Header)
+	switch {
+	case op.IsRead():
+		return c.can(false, bucket)
+	case op.IsWrite():
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			srcBucket, _, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+			if decoded, err := url.PathUnescape(srcBucket); err == nil {
+				srcBucket = decoded
+			}
+			if !c.can(false, srcBucket) {
+				return false
+			}
+		}
+		return c.can(true, bucket)
+	default:
+		return false
+	}
+}
+
+// IsOIDCToken reports whether a bearer token is a JWT rather than a
+// delegation token.
+func IsOIDCToken(token string) bool {
+	return !strings.HasPrefix(token, delegationTokenPrefix) && strings.Count(token, ".") == 2
+}
+
+// Verify checks a JWT's signature, issuer, audience and validity period
+// and returns the claims it maps to. Invalid tokens fail with an
+// AccessDenied *AuthError; failing to fetch the issuer's keys returns a
+// plain error.
+func (o *OIDCVerifier) Verify(ctx context.Context, token string) (*OIDCClaims, error) {
+	invalid := func(msg string) error { return &AuthError{Code: "AccessDenied", Message: msg} }
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("Malformed bearer token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, invalid("Malformed bearer token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("Malformed bearer token")
+	}
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, invalid("Bearer token is signed with an unknown key")
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, invalid("Invalid bearer token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, invalid("Malformed bearer token")
+	}
+	if iss, _ := claims["iss"].(string); iss != o.Issuer {
+		return nil, invalid("Bearer token is from another issuer")
+	}
+	if o.Audience != "" && !hasAudience(claims["aud"], o.Audience) {
+		return nil, invalid("Bearer token is for another audience")
+	}
+	now := o.Clock.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcLeeway)) {
+		return nil, invalid("Bearer token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, invalid("Bearer token is not valid yet")
+	}
+	owner, _ := claims[o.OwnerClaim].(string)
+	if owner == "" {
+		return nil, invalid(fmt.Sprintf("Bearer token has no %s claim", o.OwnerClaim))
+	}
+	return &OIDCClaims{Owner: owner, Permissions: stringList(claims[o.PermissionsClaim])}, nil
+}
+
+// decodeJWTPart decodes one base64url JSON segment of a JWT.
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// hasAudience reports whether an aud claim, a string or an array, names aud.
+func hasAudience(claim any, aud string) bool {
+	if s, ok := claim.(string); ok {
+		return s == aud
+	}
+	return slices.Contains(stringList(claim), aud)
+}
+
+// stringList reads a claim holding a space-separated string or an array
+// of strings.
+func stringList(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var out []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// verifyJWTSignature checks sig over input with key under the JWS
+// algorithm alg. Only asymmetric algorithms are accepted.
+func verifyJWTSignature(alg string, key crypto.PublicKey, input string, sig []byte) error {
+	var h hash.Hash
+	var hashID crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		h, hashID = sha256.New(), crypto.SHA256
+	case "384":
+		h, hashID = sha512.New384(), crypto.SHA384
+	case "512":
+		h, hashID = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h.Write([]byte(input))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hashID, digest, sig)
+		case "PS":
+			return rsa.VerifyPSS(k, hashID, digest, sig, nil)
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if ecdsa.Verify(k, digest, r, s) {
+			return nil
+		}
+		return errors.New("signature mismatch")
+	}
+	return fmt.Errorf("algorithm %q does not match the key", alg)
+}
+
+// key returns the signing key named kid, refreshing the JWKS when the
+// cached keys are stale or do not include it. A token without a kid may
+// be signed by the only key. It returns nil if no such key exists.
+func (o *OIDCVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	lookup := func() crypto.PublicKey {
+		if kid == "" && len(o.keys) == 1 {
+			for _, k := range o.keys {
+				return k
+			}
+		}
+		return o.keys[kid]
+	}
+	age := o.Clock.Now().Sub(o.fetched)
+	k := lookup()
+	if o.keys != nil && age < jwksMaxAge && (k != nil || age < jwksMinRefresh) {
+		return k, nil
+	}
+	keys, err := o.fetchKeys(ctx)
+	if err != nil {
+		if o.keys != nil {
+			// Keep serving the keys we have through an issuer outage.
+			return k, nil
+		}
+		return nil, fmt.Errorf("fetching OIDC signing keys: %w", err)
+	}
+	o.keys, o.fetched = keys, o.Clock.Now()
+	return lookup(), nil
+}
+
+// fetchKeys downloads the issuer's JWKS, discovering its URL if needed.
+// Keys of unsupported types are skipped.
+func (o *OIDCVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := o.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := o.getJSON(ctx, strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := o.getJSON(ctx, jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			key, err := ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+			if err != nil {
+				continue
+			}
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches a JSON document.
+func (o *OIDCVerifier) getJSON(ctx context.Context, addr string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", addr, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxDocument)).Decode(v); err != nil {
+		return fmt.Errorf("decoding %s: %w", addr, err)
+	}
+	return nil
+}
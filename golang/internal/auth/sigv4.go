@@ -2,14 +2,14 @@
 package auth
 
 import (
-	"bytes"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"sort"
@@ -17,21 +17,27 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
 	"github.com/bleepstore/bleepstore/internal/metadata"
 )
 
 const (
-	// signingKeyTTL is the TTL for cached signing keys (24 hours).
-	signingKeyTTL = 24 * time.Hour
+	// signingKeyTTL is the TTL for cached signing keys (15 minutes). A hot
+	// access key derives its key a few times an hour instead of on every
+	// request, and keys for past dates age out quickly.
+	signingKeyTTL = 15 * time.Minute
 	// credCacheTTL is the TTL for cached credential lookups (60 seconds).
 	credCacheTTL = 60 * time.Second
 	// maxCacheEntries is the maximum number of entries in each cache map.
 	maxCacheEntries = 1000
 )
 
-// signingKeyCacheEntry holds a cached signing key with its expiration.
+// signingKeyCacheEntry holds a cached signing key, the secret key it was
+// derived from, and its expiration.
 type signingKeyCacheEntry struct {
 	key       []byte
+	secretKey string
 	expiresAt time.Time
 }
 
@@ -63,7 +69,8 @@ const (
 	// maxPresignedExpiry is the maximum presigned URL expiration in seconds (7 days).
 	maxPresignedExpiry = 604800
 
-	// clockSkewTolerance is the maximum allowed clock skew for header-based auth.
+	// clockSkewTolerance is the default for how far a signed request's date
+	// may be ahead of the server's clock, and how old it may be.
 	clockSkewTolerance = 15 * time.Minute
 
 	// amzDateFormat is the format for x-amz-date values.
@@ -81,6 +88,12 @@ const (
 	ownerIDKey contextKey = iota
 	// ownerDisplayKey is the context key for the authenticated owner display name.
 	ownerDisplayKey
+	// accessKeyKey is the context key for the access key ID used to sign the request.
+	accessKeyKey
+	// anonymousKey marks requests admitted without credentials.
+	anonymousKey
+	// scopeKey is the context key for the Scope limiting a token.
+	scopeKey
 )
 
 // OwnerFromContext retrieves the authenticated owner ID from the request context.
@@ -101,6 +114,42 @@ func contextWithOwner(ctx context.Context, ownerID, displayName string) context.
 	return ctx
 }
 
+// AccessKeyFromContext retrieves the access key ID that authenticated the
+// request, or "" for unauthenticated requests.
+func AccessKeyFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(accessKeyKey).(string)
+	return v
+}
+
+// contextWithAccessKey sets the authenticating access key ID on the given context.
+func contextWithAccessKey(ctx context.Context, accessKeyID string) context.Context {
+	return context.WithValue(ctx, accessKeyKey, accessKeyID)
+}
+
+// IsAnonymous reports whether the request was admitted without credentials,
+// which only happens when the authenticator returns an anonymous Identity.
+func IsAnonymous(ctx context.Context) bool {
+	v, _ := ctx.Value(anonymousKey).(bool)
+	return v
+}
+
+// contextWithAnonymous marks the given context as anonymous.
+func contextWithAnonymous(ctx context.Context) context.Context {
+	return context.WithValue(ctx, anonymousKey, true)
+}
+
+// ScopeFromContext returns the Scope the request's token is limited to, or
+// nil if it is not limited.
+func ScopeFromContext(ctx context.Context) Scope {
+	v, _ := ctx.Value(scopeKey).(Scope)
+	return v
+}
+
+// contextWithScope sets the Scope limiting the request on the given context.
+func contextWithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey, scope)
+}
+
 // SigV4Verifier verifies AWS Signature Version 4 signed requests.
 // It looks up credentials from the metadata store to support multiple access keys.
 type SigV4Verifier struct {
@@ -108,8 +157,39 @@ type SigV4Verifier struct {
 	Meta metadata.MetadataStore
 	// Region is the AWS region used in the credential scope.
 	Region string
-
-	// signingKeys caches derived signing keys. Key format: "secretKey\x00dateStr\x00region\x00service".
+	// AcceptedRegions restricts the regions accepted in credential scopes.
+	// Empty, or containing "*", accepts any region.
+	AcceptedRegions []string
+	// CertSubjects maps TLS client certificate subjects (full DN or common
+	// name) to access key IDs for mutual TLS authentication.
+	CertSubjects map[string]string
+	// DelegationSecret signs and verifies prefix-scoped delegation tokens.
+	// Empty disables delegation tokens.
+	DelegationSecret []byte
+	// OIDC verifies bearer JWTs from an OpenID Connect issuer. Nil leaves
+	// bearer tokens to delegation.
+	OIDC *OIDCVerifier
+	// Secrets opens secret keys stored sealed under the master key. Nil
+	// accepts plaintext secrets only.
+	Secrets *metadata.SecretSealer
+	// ClockSkew is how far ahead of the server's clock a request's date
+	// may be. Zero means 15 minutes.
+	ClockSkew time.Duration
+	// MaxRequestAge is how old the X-Amz-Date of a header-signed request
+	// may be. Zero means 15 minutes.
+	MaxRequestAge time.Duration
+	// MaxPresignedExpiry caps X-Amz-Expires on presigned URLs, in
+	// seconds. Zero allows the S3 maximum of seven days.
+	MaxPresignedExpiry int
+	// AllowAnonymous admits unsigned S3 requests as anonymous, leaving
+	// their authorization to bucket and object ACLs. Admin endpoints always
+	// require credentials.
+	AllowAnonymous bool
+	// Clock supplies the current time for clock-skew, expiry and cache
+	// checks.
+	Clock clock.Clock
+
+	// signingKeys caches derived signing keys. Key format: "accessKeyID\x00dateStr\x00region\x00service".
 	signingKeyMu sync.RWMutex
 	signingKeys  map[string]signingKeyCacheEntry
 
@@ -123,22 +203,25 @@ func NewSigV4Verifier(meta metadata.MetadataStore, region string) *SigV4Verifier
 	return &SigV4Verifier{
 		Meta:        meta,
 		Region:      region,
+		Clock:       clock.System{},
 		signingKeys: make(map[string]signingKeyCacheEntry),
 		credCache:   make(map[string]credCacheEntry),
 	}
 }
 
-// cachedDeriveSigningKey returns a cached signing key or derives and caches a new one.
-func (v *SigV4Verifier) cachedDeriveSigningKey(secretKey, dateStr, region, svc string) []byte {
-	cacheKey := secretKey + "\x00" + dateStr + "\x00" + region + "\x00" + svc
-	now := time.Now()
+// cachedDeriveSigningKey returns the signing key for accessKeyID's secret
+// key and the credential scope, deriving and caching it on a miss. An entry
+// derived from a since-rotated secret key is a miss.
+func (v *SigV4Verifier) cachedDeriveSigningKey(accessKeyID, secretKey, dateStr, region, svc string) []byte {
+	cacheKey := accessKeyID + "\x00" + dateStr + "\x00" + region + "\x00" + svc
+	now := v.Clock.Now()
 
 	v.signingKeyMu.RLock()
-	if entry, ok := v.signingKeys[cacheKey]; ok && now.Before(entry.expiresAt) {
-		v.signingKeyMu.RUnlock()
+	entry, ok := v.signingKeys[cacheKey]
+	v.signingKeyMu.RUnlock()
+	if ok && now.Before(entry.expiresAt) && subtle.ConstantTimeCompare([]byte(entry.secretKey), []byte(secretKey)) == 1 {
 		return entry.key
 	}
-	v.signingKeyMu.RUnlock()
 
 	key := deriveSigningKey(secretKey, dateStr, region, svc)
 
@@ -149,6 +232,7 @@ func (v *SigV4Verifier) cachedDeriveSigningKey(secretKey, dateStr, region, svc s
 	}
 	v.signingKeys[cacheKey] = signingKeyCacheEntry{
 		key:       key,
+		secretKey: secretKey,
 		expiresAt: now.Add(signingKeyTTL),
 	}
 	v.signingKeyMu.Unlock()
@@ -158,7 +242,7 @@ func (v *SigV4Verifier) cachedDeriveSigningKey(secretKey, dateStr, region, svc s
 
 // cachedGetCredential returns a cached credential or fetches and caches from the store.
 func (v *SigV4Verifier) cachedGetCredential(ctx context.Context, accessKeyID string) (*metadata.CredentialRecord, error) {
-	now := time.Now()
+	now := v.Clock.Now()
 
 	v.credCacheMu.RLock()
 	if entry, ok := v.credCache[accessKeyID]; ok && now.Before(entry.expiresAt) {
@@ -171,6 +255,14 @@ func (v *SigV4Verifier) cachedGetCredential(ctx context.Context, accessKeyID str
 	if err != nil {
 		return nil, err
 	}
+	if cred != nil && metadata.IsSealedSecret(cred.SecretKey) {
+		opened := *cred
+		if opened.SecretKey, err = v.Secrets.Open(accessKeyID, cred.SecretKey); err != nil {
+			slog.Error("Opening credential secret", "access_key", accessKeyID, "error", err)
+			return nil, err
+		}
+		cred = &opened
+	}
 
 	v.credCacheMu.Lock()
 	if len(v.credCache) >= maxCacheEntries {
@@ -185,6 +277,25 @@ func (v *SigV4Verifier) cachedGetCredential(ctx context.Context, accessKeyID str
 	return cred, nil
 }
 
+// regionAccepted reports whether a credential scope region is allowed.
+func (v *SigV4Verifier) regionAccepted(region string) bool {
+	if len(v.AcceptedRegions) == 0 {
+		return true
+	}
+	for _, r := range v.AcceptedRegions {
+		if r == "*" || r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// wrongRegionMessage formats the S3-style error message for a rejected
+// credential scope region.
+func (v *SigV4Verifier) wrongRegionMessage(region string) string {
+	return fmt.Sprintf("The authorization header is malformed; the region '%s' is wrong; expecting '%s'", region, v.AcceptedRegions[0])
+}
+
 // AuthError represents an authentication failure with an S3-compatible error code.
 type AuthError struct {
 	Code    string // S3 error code (AccessDenied, InvalidAccessKeyId, SignatureDoesNotMatch, etc.)
@@ -303,12 +414,7 @@ func (v *SigV4Verifier) VerifyRequest(r *http.Request) (*metadata.CredentialReco
 	}
 
 	// Check clock skew.
-	now := time.Now().UTC()
-	diff := now.Sub(requestTime)
-	if diff < 0 {
-		diff = -diff
-	}
-	if diff > clockSkewTolerance {
+	if v.skewed(requestTime) {
 		return nil, &AuthError{Code: "RequestTimeTooSkewed", Message: "The difference between the request time and the server's time is too large"}
 	}
 
@@ -323,19 +429,28 @@ func (v *SigV4Verifier) VerifyRequest(r *http.Request) (*metadata.CredentialReco
 	// instead of using UNSIGNED-PAYLOAD. This matches what the client does
 	// when computing the canonical request without sending the header.
 	if r.Header.Get("X-Amz-Content-Sha256") == "" && r.Body != nil {
-		bodyBytes, readErr := io.ReadAll(r.Body)
+		body, bodyHash, readErr := spoolBody(r.Body)
 		if readErr != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(readErr, &tooLarge) {
+				return nil, s3err.ErrEntityTooLarge
+			}
 			return nil, &AuthError{Code: "InternalError", Message: "Failed to read request body"}
 		}
-		// Replace the body so downstream handlers can still read it.
-		r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-		bodyHash := sha256.Sum256(bodyBytes)
-		r.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(bodyHash[:]))
+		// Replace the body so downstream handlers can still read it; the
+		// middleware closes it once the request is served.
+		r.Body.Close()
+		r.Body = body
+		r.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(bodyHash))
 	} else if r.Header.Get("X-Amz-Content-Sha256") == "" {
 		// No body: use the hash of empty string.
 		r.Header.Set("X-Amz-Content-Sha256", emptySHA256)
 	}
 
+	if !v.regionAccepted(parsed.Region) {
+		return nil, &AuthError{Code: "AuthorizationHeaderMalformed", Message: v.wrongRegionMessage(parsed.Region)}
+	}
+
 	// Build canonical request.
 	canonicalRequest := buildCanonicalRequest(r, parsed.SignedHeaders)
 
@@ -344,7 +459,7 @@ func (v *SigV4Verifier) VerifyRequest(r *http.Request) (*metadata.CredentialReco
 	stringToSign := buildStringToSign(amzDate, scope, canonicalRequest)
 
 	// Derive signing key (cached) and compute expected signature.
-	signingKey := v.cachedDeriveSigningKey(cred.SecretKey, parsed.DateStr, parsed.Region, parsed.Service)
+	signingKey := v.cachedDeriveSigningKey(cred.AccessKeyID, cred.SecretKey, parsed.DateStr, parsed.Region, parsed.Service)
 	expectedSignature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
 
 	// Constant-time comparison.
@@ -404,8 +519,14 @@ func (v *SigV4Verifier) VerifyPresigned(r *http.Request) (*metadata.CredentialRe
 	// Parse and validate expiration.
 	var expires int
 	_, scanErr := fmt.Sscanf(expiresStr, "%d", &expires)
-	if scanErr != nil || expires < 1 || expires > maxPresignedExpiry {
-		return nil, &AuthError{Code: "AccessDenied", Message: fmt.Sprintf("Invalid X-Amz-Expires value: %s", expiresStr)}
+	if scanErr != nil || expires < 1 {
+		return nil, &AuthError{Code: "AuthorizationQueryParametersError", Message: "X-Amz-Expires must be a positive number of seconds"}
+	}
+	if expires > maxPresignedExpiry {
+		return nil, &AuthError{Code: "AuthorizationQueryParametersError", Message: fmt.Sprintf("X-Amz-Expires must be less than a week (in seconds) that is %d", maxPresignedExpiry)}
+	}
+	if v.MaxPresignedExpiry > 0 && expires > v.MaxPresignedExpiry {
+		return nil, &AuthError{Code: "AccessDenied", Message: fmt.Sprintf("X-Amz-Expires exceeds the maximum of %d seconds", v.MaxPresignedExpiry)}
 	}
 
 	// Parse the timestamp.
@@ -414,8 +535,13 @@ func (v *SigV4Verifier) VerifyPresigned(r *http.Request) (*metadata.CredentialRe
 		return nil, &AuthError{Code: "AccessDenied", Message: "Invalid X-Amz-Date format"}
 	}
 
-	// Check expiration.
-	if time.Now().UTC().After(requestTime.Add(time.Duration(expires) * time.Second)) {
+	// Check the validity window: from X-Amz-Date, allowing for clock skew,
+	// until it expires.
+	now := v.Clock.Now().UTC()
+	if requestTime.Sub(now) > v.clockSkew() {
+		return nil, &AuthError{Code: "AccessDenied", Message: "Request is not valid yet"}
+	}
+	if now.After(requestTime.Add(time.Duration(expires) * time.Second)) {
 		return nil, &AuthError{Code: "AccessDenied", Message: "Request has expired"}
 	}
 
@@ -433,6 +559,10 @@ func (v *SigV4Verifier) VerifyPresigned(r *http.Request) (*metadata.CredentialRe
 		return nil, &AuthError{Code: "InvalidAccessKeyId", Message: "The AWS Access Key Id you provided does not exist in our records"}
 	}
 
+	if !v.regionAccepted(region) {
+		return nil, &AuthError{Code: "AuthorizationQueryParametersError", Message: v.wrongRegionMessage(region)}
+	}
+
 	// Build canonical request for presigned URL.
 	signedHeaders := strings.Split(signedHeadersStr, ";")
 	canonicalRequest := buildPresignedCanonicalRequest(r, signedHeaders)
@@ -442,7 +572,7 @@ func (v *SigV4Verifier) VerifyPresigned(r *http.Request) (*metadata.CredentialRe
 	stringToSign := buildStringToSign(amzDate, scope, canonicalRequest)
 
 	// Derive signing key (cached) and compute expected signature.
-	signingKey := v.cachedDeriveSigningKey(cred.SecretKey, dateStr, region, svc)
+	signingKey := v.cachedDeriveSigningKey(cred.AccessKeyID, cred.SecretKey, dateStr, region, svc)
 	expectedSignature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
 
 	// Constant-time comparison.
@@ -453,6 +583,25 @@ func (v *SigV4Verifier) VerifyPresigned(r *http.Request) (*metadata.CredentialRe
 	return cred, nil
 }
 
+// clockSkew returns the allowed clock skew.
+func (v *SigV4Verifier) clockSkew() time.Duration {
+	if v.ClockSkew > 0 {
+		return v.ClockSkew
+	}
+	return clockSkewTolerance
+}
+
+// skewed reports whether a header-signed request's date is too far ahead
+// of the server's clock or too old.
+func (v *SigV4Verifier) skewed(requestTime time.Time) bool {
+	maxAge := v.MaxRequestAge
+	if maxAge <= 0 {
+		maxAge = clockSkewTolerance
+	}
+	age := v.Clock.Now().Sub(requestTime)
+	return age > maxAge || -age > v.clockSkew()
+}
+
 // buildCanonicalRequest builds the canonical request string for header-based auth.
 func buildCanonicalRequest(r *http.Request, signedHeaders []string) string {
 	var sb strings.Builder
@@ -513,8 +662,12 @@ func buildPresignedCanonicalRequest(r *http.Request, signedHeaders []string) str
 	sb.WriteString(strings.Join(signedHeaders, ";"))
 	sb.WriteByte('\n')
 
-	// Presigned URLs always use UNSIGNED-PAYLOAD.
-	sb.WriteString(unsignedPayload)
+	// The payload is unsigned unless the URL carries its hash.
+	if hash := r.URL.Query().Get("X-Amz-Content-Sha256"); hash != "" {
+		sb.WriteString(hash)
+	} else {
+		sb.WriteString(unsignedPayload)
+	}
 
 	return sb.String()
 }
@@ -648,13 +801,15 @@ func hmacSHA256(key []byte, data string) []byte {
 }
 
 // DetectAuthMethod returns the authentication method based on the request:
-// "header" for Authorization header, "presigned" for query parameters, or "none".
-// Returns "ambiguous" if both are present.
+// "header" for Authorization header, "presigned" for query parameters,
+// "token" for a delegation token, or "none".
+// Returns "ambiguous" if more than one is present.
 func DetectAuthMethod(r *http.Request) string {
 	hasHeader := strings.HasPrefix(r.Header.Get("Authorization"), algorithm)
 	hasQuery := r.URL.Query().Get("X-Amz-Algorithm") != ""
+	hasToken := delegationToken(r) != ""
 
-	if hasHeader && hasQuery {
+	if (hasHeader && hasQuery) || (hasToken && (hasHeader || hasQuery)) {
 		return "ambiguous"
 	}
 	if hasHeader {
@@ -663,5 +818,8 @@ func DetectAuthMethod(r *http.Request) string {
 	if hasQuery {
 		return "presigned"
 	}
+	if hasToken {
+		return "token"
+	}
 	return "none"
 }
@@ -1,17 +1,32 @@
 package auth
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/bleepstore/bleepstore/internal/clock"
 	"github.com/bleepstore/bleepstore/internal/metadata"
 )
 
@@ -188,6 +203,33 @@ func TestDeriveSigningKey(t *testing.T) {
 	}
 }
 
+func TestCachedDeriveSigningKey(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	v := NewSigV4Verifier(nil, "us-east-1")
+	v.Clock = fake
+
+	key := v.cachedDeriveSigningKey("AKID", "secret", "20260101", "us-east-1", "s3")
+	if want := deriveSigningKey("secret", "20260101", "us-east-1", "s3"); !bytes.Equal(key, want) {
+		t.Fatalf("cached key = %x, want %x", key, want)
+	}
+	// A hit returns the cached slice itself.
+	if again := v.cachedDeriveSigningKey("AKID", "secret", "20260101", "us-east-1", "s3"); &again[0] != &key[0] {
+		t.Error("second lookup derived the key again")
+	}
+
+	// A rotated secret key is a miss, not the old key.
+	rotated := v.cachedDeriveSigningKey("AKID", "new-secret", "20260101", "us-east-1", "s3")
+	if want := deriveSigningKey("new-secret", "20260101", "us-east-1", "s3"); !bytes.Equal(rotated, want) {
+		t.Errorf("key after rotation = %x, want %x", rotated, want)
+	}
+
+	// Entries expire after the TTL.
+	fake.Advance(signingKeyTTL + time.Second)
+	if again := v.cachedDeriveSigningKey("AKID", "new-secret", "20260101", "us-east-1", "s3"); &again[0] == &rotated[0] {
+		t.Error("expired entry was served")
+	}
+}
+
 // --- Canonical request tests ---
 
 func TestCanonicalURI(t *testing.T) {
@@ -353,6 +395,23 @@ func TestDetectAuthMethod(t *testing.T) {
 			},
 			"ambiguous",
 		},
+		{
+			"delegation token",
+			func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer bst1.abc.def")
+			},
+			"token",
+		},
+		{
+			"token and presigned",
+			func(r *http.Request) {
+				q := r.URL.Query()
+				q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+				q.Set("X-Bleepstore-Token", "bst1.abc.def")
+				r.URL.RawQuery = q.Encode()
+			},
+			"ambiguous",
+		},
 	}
 
 	for _, tt := range tests {
@@ -390,6 +449,67 @@ func TestVerifyRequestValidSignature(t *testing.T) {
 	}
 }
 
+func TestVerifyRequestAcceptedRegions(t *testing.T) {
+	store := newTestStore(t)
+	seedTestCredential(t, store, "bleepstore", "bleepstore-secret")
+
+	verifier := NewSigV4Verifier(store, "us-east-1")
+	verifier.AcceptedRegions = []string{"us-east-1", "eu-west-1"}
+
+	for region, wantOK := range map[string]bool{"eu-west-1": true, "us-east-1": true, "ap-south-1": false} {
+		req := httptest.NewRequest("GET", "/test-bucket", nil)
+		req.Host = "localhost:9011"
+		signRequest(req, "bleepstore", "bleepstore-secret", region, time.Now().UTC())
+
+		_, err := verifier.VerifyRequest(req)
+		if wantOK && err != nil {
+			t.Errorf("region %s: VerifyRequest failed: %v", region, err)
+		}
+		if !wantOK {
+			authErr, ok := err.(*AuthError)
+			if !ok || authErr.Code != "AuthorizationHeaderMalformed" {
+				t.Errorf("region %s: err = %v, want AuthorizationHeaderMalformed", region, err)
+			}
+		}
+	}
+
+	verifier.AcceptedRegions = []string{"*"}
+	req := httptest.NewRequest("GET", "/test-bucket", nil)
+	req.Host = "localhost:9011"
+	signRequest(req, "bleepstore", "bleepstore-secret", "ap-south-1", time.Now().UTC())
+	if _, err := verifier.VerifyRequest(req); err != nil {
+		t.Errorf("wildcard: VerifyRequest failed: %v", err)
+	}
+}
+
+func TestVerifyRequestSealedSecret(t *testing.T) {
+	store := newTestStore(t)
+	sealer, err := metadata.NewSecretSealer("master")
+	if err != nil {
+		t.Fatalf("NewSecretSealer: %v", err)
+	}
+	sealed, _ := sealer.Seal("bleepstore", "bleepstore-secret")
+	seedTestCredential(t, store, "bleepstore", sealed)
+
+	verify := func(v *SigV4Verifier) error {
+		req := httptest.NewRequest("GET", "/test-bucket", nil)
+		req.Host = "localhost:9011"
+		signRequest(req, "bleepstore", "bleepstore-secret", "us-east-1", time.Now().UTC())
+		_, err := v.VerifyRequest(req)
+		return err
+	}
+
+	verifier := NewSigV4Verifier(store, "us-east-1")
+	verifier.Secrets = sealer
+	if err := verify(verifier); err != nil {
+		t.Fatalf("VerifyRequest with master key: %v", err)
+	}
+	// Without the master key the sealed secret cannot be used.
+	if err := verify(NewSigV4Verifier(store, "us-east-1")); err == nil {
+		t.Error("VerifyRequest without master key succeeded")
+	}
+}
+
 func TestVerifyRequestWrongSecretKey(t *testing.T) {
 	store := newTestStore(t)
 	seedTestCredential(t, store, "bleepstore", "the-real-secret")
@@ -486,6 +606,43 @@ func TestVerifyRequestClockSkew(t *testing.T) {
 	}
 }
 
+func TestVerifyRequestClockSkewConfigured(t *testing.T) {
+	store := newTestStore(t)
+	seedTestCredential(t, store, "bleepstore", "bleepstore-secret")
+
+	now := time.Now().UTC()
+	verifier := NewSigV4Verifier(store, "us-east-1")
+	verifier.Clock = clock.NewFake(now)
+	verifier.ClockSkew = time.Minute
+	verifier.MaxRequestAge = time.Hour
+
+	tests := []struct {
+		name   string
+		signed time.Time
+		ok     bool
+	}{
+		{"30 minutes old", now.Add(-30 * time.Minute), true},
+		{"2 hours old", now.Add(-2 * time.Hour), false},
+		{"30 seconds ahead", now.Add(30 * time.Second), true},
+		{"5 minutes ahead", now.Add(5 * time.Minute), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/test-bucket", nil)
+		req.Host = "localhost:9011"
+		signRequest(req, "bleepstore", "bleepstore-secret", "us-east-1", tt.signed)
+		_, err := verifier.VerifyRequest(req)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if authErr, ok := err.(*AuthError); !ok || authErr.Code != "RequestTimeTooSkewed" {
+			t.Errorf("%s: err = %v, want RequestTimeTooSkewed", tt.name, err)
+		}
+	}
+}
+
 func TestVerifyRequestPutObject(t *testing.T) {
 	store := newTestStore(t)
 	seedTestCredential(t, store, "bleepstore", "bleepstore-secret")
@@ -533,6 +690,28 @@ func TestVerifyRequestWithQueryParams(t *testing.T) {
 	}
 }
 
+func BenchmarkVerifyRequest(b *testing.B) {
+	store, err := metadata.NewSQLiteStore(b.TempDir() + "/test.db")
+	if err != nil {
+		b.Fatalf("NewSQLiteStore: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+	store.PutCredential(context.Background(), &metadata.CredentialRecord{
+		AccessKeyID: "bleepstore", SecretKey: "bleepstore-secret", Active: true, CreatedAt: time.Now(),
+	})
+	verifier := NewSigV4Verifier(store, "us-east-1")
+
+	req := httptest.NewRequest("GET", "/test-bucket/test-key", nil)
+	req.Host = "localhost:9011"
+	signRequest(req, "bleepstore", "bleepstore-secret", "us-east-1", time.Now())
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := verifier.VerifyRequest(req); err != nil {
+			b.Fatalf("VerifyRequest: %v", err)
+		}
+	}
+}
+
 // --- Presigned URL tests ---
 
 func TestVerifyPresignedValid(t *testing.T) {
@@ -622,6 +801,42 @@ func TestVerifyPresignedExpired(t *testing.T) {
 	}
 }
 
+func TestVerifyPresignedWindow(t *testing.T) {
+	store := newTestStore(t)
+	seedTestCredential(t, store, "bleepstore", "bleepstore-secret")
+
+	now := time.Now().UTC()
+	verifier := NewSigV4Verifier(store, "us-east-1")
+	verifier.Clock = clock.NewFake(now)
+	verifier.MaxPresignedExpiry = 3600
+
+	tests := []struct {
+		name    string
+		date    time.Time
+		expires string
+		code    string
+	}{
+		{"past a week", now, "604801", "AuthorizationQueryParametersError"},
+		{"zero", now, "0", "AuthorizationQueryParametersError"},
+		{"past the configured maximum", now, "3601", "AccessDenied"},
+		{"dated in the future", now.Add(20 * time.Minute), "60", "AccessDenied"},
+		{"expired", now.Add(-2 * time.Minute), "60", "AccessDenied"},
+		// Within the window, the dummy signature is what fails.
+		{"within the window", now.Add(5 * time.Minute), "60", "SignatureDoesNotMatch"},
+	}
+	for _, tt := range tests {
+		credential := fmt.Sprintf("bleepstore/%s/us-east-1/%s/%s", tt.date.Format(amzDateShort), service, scopeTerminator)
+		rawURL := fmt.Sprintf("/test-bucket/test-key?X-Amz-Algorithm=%s&X-Amz-Credential=%s&X-Amz-Date=%s&X-Amz-Expires=%s&X-Amz-SignedHeaders=host&X-Amz-Signature=dummy",
+			algorithm, url.QueryEscape(credential), tt.date.Format(amzDateFormat), tt.expires)
+		req := httptest.NewRequest("GET", rawURL, nil)
+		req.Host = "localhost:9011"
+		_, err := verifier.VerifyPresigned(req)
+		if authErr, ok := err.(*AuthError); !ok || authErr.Code != tt.code {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.code)
+		}
+	}
+}
+
 func TestVerifyPresignedInvalidExpires(t *testing.T) {
 	store := newTestStore(t)
 	seedTestCredential(t, store, "bleepstore", "bleepstore-secret")
@@ -651,6 +866,35 @@ func TestVerifyPresignedInvalidExpires(t *testing.T) {
 
 // --- OwnerFromContext tests ---
 
+func TestSpoolBody(t *testing.T) {
+	for _, size := range []int{0, 100, spoolMemory + 1, 3 * spoolMemory} {
+		data := bytes.Repeat([]byte("b"), size)
+		body, sum, err := spoolBody(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("spoolBody(%d bytes): %v", size, err)
+		}
+		if want := sha256.Sum256(data); !bytes.Equal(sum, want[:]) {
+			t.Errorf("spoolBody(%d bytes) hash = %x, want %x", size, sum, want)
+		}
+		got, err := io.ReadAll(body)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("spoolBody(%d bytes) reread %d bytes, err %v", size, len(got), err)
+		}
+
+		// Bodies past the memory limit go to a file removed on Close.
+		f, spooled := body.(spooledFile)
+		if spooled != (size > spoolMemory) {
+			t.Errorf("spoolBody(%d bytes) spooled to disk = %v", size, spooled)
+		}
+		body.Close()
+		if spooled {
+			if _, err := os.Stat(f.Name()); !os.IsNotExist(err) {
+				t.Errorf("spool file %s not removed on Close: %v", f.Name(), err)
+			}
+		}
+	}
+}
+
 func TestOwnerFromContext(t *testing.T) {
 	ctx := context.Background()
 
@@ -752,3 +996,321 @@ func TestCanonicalHeaders(t *testing.T) {
 		t.Errorf("line 1 = %q, expected host:localhost:9011", lines[1])
 	}
 }
+
+// --- Client certificate tests ---
+
+func TestMiddlewareClientCert(t *testing.T) {
+	store := newTestStore(t)
+	seedTestCredential(t, store, "svc-key", "svc-secret")
+	verifier := NewSigV4Verifier(store, "us-east-1")
+	verifier.CertSubjects = map[string]string{"CN=replicator,O=Example": "svc-key", "backup": "missing-key"}
+
+	var gotKey string
+	handler := Middleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = AccessKeyFromContext(r.Context())
+	}))
+
+	withCert := func(subject pkix.Name) *http.Request {
+		req := httptest.NewRequest("GET", "/bucket", nil)
+		if subject.CommonName != "" {
+			req.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{{Subject: subject}}},
+			}
+		}
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		subject pkix.Name
+		status  int
+		key     string
+	}{
+		{"mapped DN", pkix.Name{CommonName: "replicator", Organization: []string{"Example"}}, http.StatusOK, "svc-key"},
+		{"unmapped subject", pkix.Name{CommonName: "stranger"}, http.StatusForbidden, ""},
+		{"unknown access key", pkix.Name{CommonName: "backup"}, http.StatusForbidden, ""},
+		{"no certificate", pkix.Name{}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		gotKey = ""
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, withCert(tt.subject))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if gotKey != tt.key {
+			t.Errorf("%s: access key = %q, want %q", tt.name, gotKey, tt.key)
+		}
+	}
+}
+
+func TestMiddlewareDelegationToken(t *testing.T) {
+	verifier := NewSigV4Verifier(newTestStore(t), "us-east-1")
+	verifier.DelegationSecret = []byte("delegation-secret")
+
+	mint := func(write bool, expires time.Time, secret string) string {
+		t.Helper()
+		token, err := SignDelegationToken([]byte(secret), &DelegationClaims{
+			Bucket:      "shared",
+			Prefix:      "partner/",
+			Write:       write,
+			ExpiresAt:   expires.Unix(),
+			AccessKeyID: "issuer-key",
+		})
+		if err != nil {
+			t.Fatalf("SignDelegationToken: %v", err)
+		}
+		return token
+	}
+	future := time.Now().Add(time.Hour)
+	readToken := mint(false, future, "delegation-secret")
+	writeToken := mint(true, future, "delegation-secret")
+
+	var gotKey string
+	handler := Middleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = AccessKeyFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		status int
+	}{
+		{"read in scope", "GET", "/shared/partner/a.csv", readToken, http.StatusOK},
+		{"token in query", "GET", "/shared/partner/a.csv?X-Bleepstore-Token=" + readToken, "", http.StatusOK},
+		{"list in scope", "GET", "/shared?prefix=partner/2026/", readToken, http.StatusOK},
+		{"list without prefix", "GET", "/shared", readToken, http.StatusForbidden},
+		{"read outside prefix", "GET", "/shared/internal/b.csv", readToken, http.StatusForbidden},
+		{"other bucket", "GET", "/other/partner/a.csv", readToken, http.StatusForbidden},
+		{"write with read token", "PUT", "/shared/partner/a.csv", readToken, http.StatusForbidden},
+		{"write with write token", "PUT", "/shared/partner/a.csv", writeToken, http.StatusOK},
+		{"delete bucket", "DELETE", "/shared", writeToken, http.StatusForbidden},
+		{"admin endpoint", "POST", "/admin/delegation-tokens", writeToken, http.StatusForbidden},
+		{"expired", "GET", "/shared/partner/a.csv", mint(false, time.Now().Add(-time.Second), "delegation-secret"), http.StatusForbidden},
+		{"wrong secret", "GET", "/shared/partner/a.csv", mint(false, future, "other-secret"), http.StatusForbidden},
+		{"tampered", "GET", "/shared/partner/a.csv", readToken[:len(readToken)-2] + "xx", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		gotKey = ""
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if tt.status == http.StatusOK && gotKey != "issuer-key" {
+			t.Errorf("%s: access key = %q, want issuer-key", tt.name, gotKey)
+		}
+	}
+}
+
+// signTestJWT signs claims as an RS256 or ES256 JWT with key, naming kid.
+func signTestJWT(t *testing.T, key crypto.Signer, kid string, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatalf("signing JWT: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// newTestIssuer serves an OIDC discovery document and a JWKS holding the
+// public halves of an RSA key ("rsa") and an EC key ("ec"). It counts JWKS
+// fetches.
+func newTestIssuer(t *testing.T) (issuer string, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey, fetches *int) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	ecPoint, _ := ecKey.PublicKey.Bytes()
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecPoint[1:33]), "y": b64(ecPoint[33:])},
+	}})
+	fetches = new(int)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q}`, srv.URL, srv.URL+"/keys")
+		case "/keys":
+			*fetches++
+			w.Write(jwks)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, rsaKey, ecKey, fetches
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	issuer, rsaKey, ecKey, fetches := newTestIssuer(t)
+	now := time.Now()
+	v := NewOIDCVerifier(issuer)
+	v.Audience = "bleepstore"
+	v.Clock = clock.NewFake(now)
+
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss": issuer, "aud": []string{"other", "bleepstore"}, "sub": "svc-reports",
+			"exp": now.Add(time.Hour).Unix(), "scope": "openid s3:read s3:write:reports",
+		}
+		for k, val := range overrides {
+			if val == nil {
+				delete(c, k)
+			} else {
+				c[k] = val
+			}
+		}
+		return c
+	}
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"rsa", signTestJWT(t, rsaKey, "rsa", claims(nil)), true},
+		{"ec", signTestJWT(t, ecKey, "ec", claims(nil)), true},
+		{"wrong key", signTestJWT(t, otherKey, "rsa", claims(nil)), false},
+		{"unknown kid", signTestJWT(t, otherKey, "rotated", claims(nil)), false},
+		{"other issuer", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"iss": "https://evil.example"})), false},
+		{"other audience", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"aud": "other"})), false},
+		{"expired", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})), false},
+		{"skewed expiry", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()})), true},
+		{"no expiry", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"exp": nil})), false},
+		{"not yet valid", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"nbf": now.Add(time.Hour).Unix()})), false},
+		{"no subject", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"sub": nil})), false},
+		{"malformed", "a.b.c", false},
+	}
+	for _, tt := range tests {
+		got, err := v.Verify(context.Background(), tt.token)
+		if tt.ok != (err == nil) {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+		if err == nil && (got.Owner != "svc-reports" || len(got.Permissions) != 3) {
+			t.Errorf("%s: claims = %+v", tt.name, got)
+		}
+	}
+	// The unknown kid came within a minute of the first fetch, so the JWKS
+	// was not fetched again; a minute later it is, once.
+	if *fetches != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", *fetches)
+	}
+	v.Clock.(*clock.Fake).Advance(2 * time.Minute)
+	for range 2 {
+		v.Verify(context.Background(), signTestJWT(t, otherKey, "rotated", claims(nil)))
+	}
+	if *fetches != 2 {
+		t.Errorf("JWKS fetched %d times after a minute, want 2", *fetches)
+	}
+
+	// Tokens signed with HMAC are refused, even keyed with a public key.
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"rsa"}`))
+	payload, _ := json.Marshal(claims(nil))
+	forged := header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"
+	if _, err := v.Verify(context.Background(), forged); err == nil {
+		t.Error("HS256 token accepted")
+	}
+}
+
+func TestMiddlewareOIDC(t *testing.T) {
+	issuer, rsaKey, _, _ := newTestIssuer(t)
+	verifier := NewSigV4Verifier(newTestStore(t), "us-east-1")
+	verifier.DelegationSecret = []byte("delegation-secret")
+	verifier.OIDC = NewOIDCVerifier(issuer)
+
+	mint := func(scope any) string {
+		return signTestJWT(t, rsaKey, "rsa", map[string]any{
+			"iss": issuer, "sub": "svc", "exp": time.Now().Add(time.Hour).Unix(), "scope": scope,
+		})
+	}
+	reader := mint("s3:read")
+	reportsWriter := mint([]string{"s3:write:reports"})
+
+	var gotKey, gotOwner string
+	handler := Middleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = AccessKeyFromContext(r.Context())
+		gotOwner, _ = OwnerFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		token   string
+		copySrc string
+		status  int
+	}{
+		{"list buckets", "GET", "/", reader, "", http.StatusOK},
+		{"read", "GET", "/photos/a.jpg", reader, "", http.StatusOK},
+		{"write with read", "PUT", "/photos/a.jpg", reader, "", http.StatusForbidden},
+		{"scoped write", "PUT", "/reports/q1.csv", reportsWriter, "", http.StatusOK},
+		{"scoped read", "GET", "/reports/q1.csv", reportsWriter, "", http.StatusOK},
+		{"outside scope", "GET", "/photos/a.jpg", reportsWriter, "", http.StatusForbidden},
+		{"scoped list buckets", "GET", "/", reportsWriter, "", http.StatusForbidden},
+		{"copy from outside scope", "PUT", "/reports/copy.jpg", reportsWriter, "/photos/a.jpg", http.StatusForbidden},
+		{"copy within scope", "PUT", "/reports/copy.csv", reportsWriter, "/reports/q1.csv", http.StatusOK},
+		{"admin endpoint", "GET", "/admin/v1/usage", reader, "", http.StatusForbidden},
+		{"bad token", "GET", "/photos/a.jpg", reader[:len(reader)-4] + "AAAA", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		gotKey, gotOwner = "", ""
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		if tt.copySrc != "" {
+			req.Header.Set("X-Amz-Copy-Source", tt.copySrc)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if tt.status == http.StatusOK && (gotKey != "oidc:svc" || gotOwner != "oidc:svc") {
+			t.Errorf("%s: access key %q owner %q, want oidc:svc for both", tt.name, gotKey, gotOwner)
+		}
+	}
+
+	// Delegation tokens still work alongside OIDC.
+	token, _ := SignDelegationToken(verifier.DelegationSecret, &DelegationClaims{
+		Bucket: "shared", ExpiresAt: time.Now().Add(time.Hour).Unix(), AccessKeyID: "issuer-key",
+	})
+	req := httptest.NewRequest("GET", "/shared/a", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || gotKey != "issuer-key" {
+		t.Errorf("delegation token with OIDC enabled: status %d, key %q", rec.Code, gotKey)
+	}
+}
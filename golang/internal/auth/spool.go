@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+)
+
+// spoolMemory is the most of a request body that spoolBody holds in memory.
+const spoolMemory = 1 << 20
+
+// spooledFile is a request body spooled to a temporary file, removed when
+// it is closed.
+type spooledFile struct {
+	*os.File
+}
+
+func (f spooledFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// spoolBody reads body to its end and returns a reader over the same bytes
+// along with their SHA-256, so the payload hash can be signed and the body
+// still handed on. Up to spoolMemory bytes stay in memory; a longer body
+// goes to a temporary file, removed when the returned reader is closed.
+func spoolBody(body io.Reader) (io.ReadCloser, []byte, error) {
+	h := sha256.New()
+	tee := io.TeeReader(body, h)
+	var head bytes.Buffer
+	if _, err := io.CopyN(&head, tee, spoolMemory+1); err == io.EOF {
+		return io.NopCloser(&head), h.Sum(nil), nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "bleepstore-body-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	f := spooledFile{tmp}
+	if _, err := head.WriteTo(f); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := io.Copy(f, tee); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, h.Sum(nil), nil
+}
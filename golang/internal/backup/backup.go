@@ -0,0 +1,478 @@
+// Package backup writes and restores archives of a BleepStore deployment's
+// SQLite metadata and local object data.
+//
+// An archive is a gzipped tar whose first entry is manifest.json, followed
+// by metadata.db, a point-in-time copy of the metadata database, and one
+// objects/<bucket>/<key> entry per backed-up object. An incremental archive
+// carries the full metadata but only the objects modified after its Since
+// time; restoring a full archive and then each incremental in order rebuilds
+// the latest state.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+// FormatVersion is the archive layout version written to the manifest.
+const FormatVersion = 1
+
+// Archive entry names.
+const (
+	manifestName  = "manifest.json"
+	metadataName  = "metadata.db"
+	objectsPrefix = "objects/"
+)
+
+// timeFormat is the format of timestamps in the SQLite metadata database.
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Since is set on incremental archives, which hold only the objects
+	// modified after it.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Incremental reports whether the archive only holds recent objects.
+func (m *Manifest) Incremental() bool {
+	return m.Since != nil
+}
+
+// Options configures Create.
+type Options struct {
+	// DBPath is the SQLite metadata database.
+	DBPath string
+	// Roots are the local backend's data roots (one, or several for JBOD).
+	Roots []string
+	// Since, if non-zero, makes an incremental archive of the objects
+	// modified at or after it.
+	Since time.Time
+	// OnSkip, if set, is called for each object whose data changed or
+	// disappeared after the metadata was copied, and so is left out.
+	OnSkip func(bucket, key, reason string)
+}
+
+// Result summarizes a Create or Restore run.
+type Result struct {
+	Manifest Manifest `json:"manifest"`
+	Objects  int64    `json:"objects"`
+	Bytes    int64    `json:"bytes"`
+	Skipped  int64    `json:"skipped"`
+}
+
+// Create writes an archive to w. The metadata is copied with VACUUM INTO,
+// which is safe while the server is running, and the objects to archive are
+// read from that copy. Objects packed into segment files can only be read
+// while the server is stopped. In-progress multipart uploads are not
+// archived.
+func Create(ctx context.Context, w io.Writer, opts *Options) (*Result, error) {
+	if len(opts.Roots) == 0 {
+		return nil, fmt.Errorf("no storage roots to back up")
+	}
+
+	// Stamp the archive before copying the metadata, so an incremental
+	// archive made since CreatedAt misses no write.
+	result := &Result{Manifest: Manifest{Version: FormatVersion, CreatedAt: time.Now().UTC()}}
+	snapshot, err := snapshotDB(ctx, opts.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(snapshot)
+
+	var packs []*storage.PackIndex
+	for _, root := range opts.Roots {
+		pi, err := storage.OpenPackIndex(root)
+		if err != nil {
+			return nil, err
+		}
+		if pi != nil {
+			defer pi.Close()
+			packs = append(packs, pi)
+		}
+	}
+
+	if !opts.Since.IsZero() {
+		since := opts.Since.UTC()
+		result.Manifest.Since = &since
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	manifest, err := json.Marshal(result.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, int64(len(manifest)), bytes.NewReader(manifest)); err != nil {
+		return nil, err
+	}
+	if err := writeFile(tw, metadataName, snapshot); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", snapshot+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("opening metadata copy: %w", err)
+	}
+	defer db.Close()
+
+	a := &archiver{tw: tw, opts: opts, packs: packs, result: result}
+	if err := a.writeObjects(ctx, db); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("finishing archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("finishing archive: %w", err)
+	}
+	return result, nil
+}
+
+// snapshotDB copies the database at dbPath to a temporary file with VACUUM
+// INTO and returns the copy's path. The parts of in-progress uploads are not
+// archived, so the uploads are dropped from the copy.
+func snapshotDB(ctx context.Context, dbPath string) (string, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return "", fmt.Errorf("metadata database: %w", err)
+	}
+	f, err := os.CreateTemp("", "bleepstore-backup-*.db")
+	if err != nil {
+		return "", fmt.Errorf("creating metadata copy: %w", err)
+	}
+	snapshot := f.Name()
+	f.Close()
+	// VACUUM INTO refuses to overwrite an existing file.
+	os.Remove(snapshot)
+
+	db, err := sql.Open("sqlite", dbPath+"?mode=ro")
+	if err != nil {
+		return "", fmt.Errorf("opening database: %w", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", snapshot); err != nil {
+		os.Remove(snapshot)
+		return "", fmt.Errorf("copying metadata: %w", err)
+	}
+
+	if err := dropUploads(ctx, snapshot); err != nil {
+		os.Remove(snapshot)
+		return "", err
+	}
+	return snapshot, nil
+}
+
+// dropUploads deletes the multipart uploads and parts from the database at
+// path.
+func dropUploads(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("opening metadata copy: %w", err)
+	}
+	defer db.Close()
+	for _, table := range []string{"multipart_parts", "multipart_uploads"} {
+		if _, err := db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("dropping %s from metadata copy: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// archiver writes object entries to an archive.
+type archiver struct {
+	tw     *tar.Writer
+	opts   *Options
+	packs  []*storage.PackIndex
+	result *Result
+}
+
+// writeObjects archives the data of every backend-stored object row in db
+// modified after opts.Since. Inline objects live in the metadata.
+func (a *archiver) writeObjects(ctx context.Context, db *sql.DB) error {
+	var hasInline bool
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM pragma_table_info('objects') WHERE name = 'inline_data'`).Scan(&hasInline)
+	if err != nil {
+		return fmt.Errorf("reading objects schema: %w", err)
+	}
+	var hasCompression bool
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM pragma_table_info('objects') WHERE name = 'compression'`).Scan(&hasCompression)
+	if err != nil {
+		return fmt.Errorf("reading objects schema: %w", err)
+	}
+	compressed := "0"
+	if hasCompression {
+		compressed = "compression IS NOT NULL"
+	}
+	query := "SELECT bucket, key, size, " + compressed + " FROM objects WHERE delete_marker = 0"
+	if hasInline {
+		query += " AND inline_data IS NULL"
+	}
+	var args []any
+	if !a.opts.Since.IsZero() {
+		query += " AND last_modified >= ?"
+		args = append(args, a.opts.Since.UTC().Format(timeFormat))
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY bucket, key", args...)
+	if err != nil {
+		return fmt.Errorf("querying objects: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			bucket, key string
+			size        int64
+			compressed  bool
+		)
+		if err := rows.Scan(&bucket, &key, &size, &compressed); err != nil {
+			return fmt.Errorf("scanning object row: %w", err)
+		}
+		if err := a.writeObject(bucket, key, size, compressed); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating objects: %w", err)
+	}
+	return nil
+}
+
+// writeObject archives one object, or skips it if its data no longer
+// matches the metadata copy. Data compressed at rest is archived as stored,
+// so its size is not compared.
+func (a *archiver) writeObject(bucket, key string, size int64, compressed bool) error {
+	rc, actual, err := a.open(bucket, key)
+	if err != nil {
+		return err
+	}
+	if rc == nil {
+		a.skip(bucket, key, "data not found")
+		return nil
+	}
+	defer rc.Close()
+	if compressed {
+		size = actual
+	} else if actual != size {
+		a.skip(bucket, key, fmt.Sprintf("data is %d bytes, metadata says %d", actual, size))
+		return nil
+	}
+	if err := writeEntry(a.tw, objectsPrefix+bucket+"/"+key, size, rc); err != nil {
+		return err
+	}
+	a.result.Objects++
+	a.result.Bytes += size
+	return nil
+}
+
+func (a *archiver) skip(bucket, key, reason string) {
+	a.result.Skipped++
+	if a.opts.OnSkip != nil {
+		a.opts.OnSkip(bucket, key, reason)
+	}
+}
+
+// open returns a reader over the data of bucket/key and its size, from a
+// segment file or the first root holding it, or nil if it is nowhere.
+func (a *archiver) open(bucket, key string) (io.ReadCloser, int64, error) {
+	for _, pi := range a.packs {
+		size, ok, err := pi.Lookup(bucket, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			rc, err := pi.Open(bucket, key)
+			return rc, size, err
+		}
+	}
+	for _, root := range a.opts.Roots {
+		f, err := os.Open(filepath.Join(root, bucket, filepath.FromSlash(key)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+		// Stat the open file: an overwrite renames a new file into place
+		// and leaves this one intact.
+		info, err := f.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			f.Close()
+			continue
+		}
+		return f, info.Size(), nil
+	}
+	return nil, 0, nil
+}
+
+// writeEntry writes a regular file entry of size bytes read from r.
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: time.Now(),
+		Format:  tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeFile writes the file at path as entry name.
+func writeFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return writeEntry(tw, name, info.Size(), f)
+}
+
+// RestoreOptions configures Restore.
+type RestoreOptions struct {
+	// DBPath is where the metadata database is restored.
+	DBPath string
+	// Store receives the archived objects.
+	Store storage.StorageBackend
+	// Force allows a full archive to overwrite an existing database, and an
+	// incremental archive to be restored without one.
+	Force bool
+}
+
+// Restore unpacks an archive read from r. The metadata database is
+// replaced as a whole; objects are written through opts.Store. A full
+// archive refuses to overwrite an existing database, and an incremental
+// archive expects the database of the archive it follows, unless
+// opts.Force is set. The server must be stopped.
+func Restore(ctx context.Context, r io.Reader, opts *RestoreOptions) (*Result, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("not a bleepstore backup: %s is missing", manifestName)
+	}
+	result := &Result{}
+	if err := json.NewDecoder(tr).Decode(&result.Manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	if v := result.Manifest.Version; v < 1 || v > FormatVersion {
+		return nil, fmt.Errorf("unsupported backup version: %d", v)
+	}
+
+	_, statErr := os.Stat(opts.DBPath)
+	exists := statErr == nil
+	switch {
+	case opts.Force:
+	case result.Manifest.Incremental() && !exists:
+		return nil, fmt.Errorf("incremental backup: restore the backup it follows into %s first (or use force)", opts.DBPath)
+	case !result.Manifest.Incremental() && exists:
+		return nil, fmt.Errorf("%s exists (use force to overwrite)", opts.DBPath)
+	}
+
+	if hdr, err = tr.Next(); err != nil || hdr.Name != metadataName {
+		return nil, fmt.Errorf("corrupt backup: %s is missing", metadataName)
+	}
+	if err := restoreDB(tr, opts.DBPath); err != nil {
+		return nil, err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+		bucket, key, err := objectName(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		if err := opts.Store.CreateBucket(ctx, bucket); err != nil {
+			return nil, fmt.Errorf("creating bucket %s: %w", bucket, err)
+		}
+		n, _, err := opts.Store.PutObject(ctx, bucket, key, tr, hdr.Size)
+		if err != nil {
+			return nil, fmt.Errorf("restoring %s/%s: %w", bucket, key, err)
+		}
+		result.Objects++
+		result.Bytes += n
+	}
+	return result, nil
+}
+
+// restoreDB writes the archived database to dbPath, replacing any existing
+// database and its journal files.
+func restoreDB(r io.Reader, dbPath string) error {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return fmt.Errorf("creating metadata directory: %w", err)
+	}
+	tmp := dbPath + ".restore"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("restoring metadata: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("restoring metadata: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("restoring metadata: %w", err)
+	}
+	f.Close()
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(dbPath + suffix)
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("restoring metadata: %w", err)
+	}
+	return nil
+}
+
+// objectName splits an objects/<bucket>/<key> entry name, rejecting names
+// that would escape the bucket.
+func objectName(name string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(name, objectsPrefix)
+	if ok {
+		bucket, key, ok = strings.Cut(rest, "/")
+	}
+	if !ok || bucket == "" || bucket == "." || bucket == ".." || key == "" || path.Clean("/"+key) != "/"+key {
+		return "", "", fmt.Errorf("corrupt backup: unexpected entry %q", name)
+	}
+	return bucket, key, nil
+}
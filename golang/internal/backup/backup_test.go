@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// deployment is a SQLite metadata store and local backend in a temp dir.
+type deployment struct {
+	dbPath string
+	root   string
+	meta   *metadata.SQLiteStore
+	store  *storage.LocalBackend
+}
+
+func newDeployment(t *testing.T) *deployment {
+	t.Helper()
+	dir := t.TempDir()
+	d := &deployment{dbPath: filepath.Join(dir, "metadata.db"), root: filepath.Join(dir, "objects")}
+	var err error
+	if d.meta, err = metadata.NewSQLiteStore(d.dbPath); err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { d.meta.Close() })
+	if d.store, err = storage.NewLocalBackend(d.root); err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	ctx := context.Background()
+	if err := d.meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "data", OwnerID: "o", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	d.store.CreateBucket(ctx, "data")
+	return d
+}
+
+// put stores an object in both the backend and the metadata.
+func (d *deployment) put(t *testing.T, key, body string, modified time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	n, etag, err := d.store.PutObject(ctx, "data", key, strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if err := d.meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "data", Key: key, Size: n, ETag: etag, LastModified: modified}); err != nil {
+		t.Fatalf("metadata PutObject: %v", err)
+	}
+}
+
+// restored opens a restored deployment and returns key's metadata and data.
+func restored(t *testing.T, dbPath string, store storage.StorageBackend, key string) (*metadata.ObjectRecord, string) {
+	t.Helper()
+	meta, err := metadata.NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("opening restored metadata: %v", err)
+	}
+	defer meta.Close()
+	obj, err := meta.GetObject(context.Background(), "data", key)
+	if err != nil || obj == nil {
+		t.Fatalf("restored metadata for %s: %v, %v", key, obj, err)
+	}
+	rc, _, _, err := store.GetObject(context.Background(), "data", key)
+	if err != nil {
+		t.Fatalf("restored data for %s: %v", key, err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	return obj, string(data)
+}
+
+func TestCreateRestore(t *testing.T) {
+	src := newDeployment(t)
+	src.put(t, "a.txt", "alpha", time.Now())
+	src.put(t, "nested/dir/b.txt", "bravo", time.Now())
+
+	var archive bytes.Buffer
+	result, err := Create(context.Background(), &archive, &Options{DBPath: src.dbPath, Roots: []string{src.root}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if result.Objects != 2 || result.Bytes != 10 || result.Manifest.Incremental() {
+		t.Errorf("Create = %+v, want 2 objects / 10 bytes, full", result)
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "metadata.db")
+	store, _ := storage.NewLocalBackend(filepath.Join(dir, "objects"))
+	data := archive.Bytes()
+	if _, err := Restore(context.Background(), bytes.NewReader(data), &RestoreOptions{DBPath: dbPath, Store: store}); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if obj, body := restored(t, dbPath, store, "nested/dir/b.txt"); body != "bravo" || obj.Size != 5 {
+		t.Errorf("restored b.txt = %q (%d bytes)", body, obj.Size)
+	}
+
+	if _, err := Restore(context.Background(), bytes.NewReader(data), &RestoreOptions{DBPath: dbPath, Store: store}); err == nil {
+		t.Error("full restore over an existing database should fail without Force")
+	}
+	if _, err := Restore(context.Background(), bytes.NewReader(data), &RestoreOptions{DBPath: dbPath, Store: store, Force: true}); err != nil {
+		t.Errorf("forced restore: %v", err)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	src := newDeployment(t)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	src.put(t, "old.txt", "old", base)
+	src.put(t, "changed.txt", "before", base)
+
+	ctx := context.Background()
+	var full bytes.Buffer
+	if _, err := Create(ctx, &full, &Options{DBPath: src.dbPath, Roots: []string{src.root}}); err != nil {
+		t.Fatalf("full Create: %v", err)
+	}
+
+	since := base.Add(time.Hour)
+	src.put(t, "changed.txt", "after!", since.Add(time.Minute))
+	src.put(t, "new.txt", "new", since.Add(time.Minute))
+	var incr bytes.Buffer
+	result, err := Create(ctx, &incr, &Options{DBPath: src.dbPath, Roots: []string{src.root}, Since: since})
+	if err != nil {
+		t.Fatalf("incremental Create: %v", err)
+	}
+	if result.Objects != 2 || !result.Manifest.Incremental() {
+		t.Errorf("incremental Create = %+v, want 2 objects", result)
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "metadata.db")
+	store, _ := storage.NewLocalBackend(filepath.Join(dir, "objects"))
+	if _, err := Restore(ctx, bytes.NewReader(incr.Bytes()), &RestoreOptions{DBPath: dbPath, Store: store}); err == nil {
+		t.Fatal("incremental restore without its base should fail")
+	}
+	for _, archive := range []*bytes.Buffer{&full, &incr} {
+		if _, err := Restore(ctx, archive, &RestoreOptions{DBPath: dbPath, Store: store}); err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+	}
+	for key, want := range map[string]string{"old.txt": "old", "changed.txt": "after!", "new.txt": "new"} {
+		if _, body := restored(t, dbPath, store, key); body != want {
+			t.Errorf("restored %s = %q, want %q", key, body, want)
+		}
+	}
+}
+
+func TestCreateSkipsChangedData(t *testing.T) {
+	src := newDeployment(t)
+	src.put(t, "gone.txt", "gone", time.Now())
+	src.put(t, "kept.txt", "kept", time.Now())
+	os.Remove(filepath.Join(src.root, "data", "gone.txt"))
+
+	var skipped []string
+	result, err := Create(context.Background(), io.Discard, &Options{
+		DBPath: src.dbPath,
+		Roots:  []string{src.root},
+		OnSkip: func(bucket, key, reason string) { skipped = append(skipped, key) },
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if result.Objects != 1 || result.Skipped != 1 || len(skipped) != 1 || skipped[0] != "gone.txt" {
+		t.Errorf("Create = %+v, skipped %v", result, skipped)
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	for name, ok := range map[string]bool{
+		"objects/b/k":         true,
+		"objects/b/a/b/c.txt": true,
+		"objects/b/../x":      false,
+		"objects/../k":        false,
+		"objects/b/":          false,
+		"objects/b/k/":        false,
+		"metadata.db":         false,
+	} {
+		if _, _, err := objectName(name); (err == nil) != ok {
+			t.Errorf("objectName(%q) err = %v, want ok %v", name, err, ok)
+		}
+	}
+}
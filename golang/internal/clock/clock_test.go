@@ -0,0 +1,35 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := NewFake(start)
+	if !f.Now().Equal(start) {
+		t.Errorf("Now = %v, want %v", f.Now(), start)
+	}
+	f.Advance(90 * time.Second)
+	if want := start.Add(90 * time.Second); !f.Now().Equal(want) {
+		t.Errorf("after Advance, Now = %v, want %v", f.Now(), want)
+	}
+	f.Set(start)
+	if !f.Now().Equal(start) {
+		t.Errorf("after Set, Now = %v, want %v", f.Now(), start)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	var s Sequence
+	if id := s.NewID(); id != "00000000000000000000000000000001" {
+		t.Errorf("first ID = %q", id)
+	}
+	if id := s.NewID(); id != "00000000000000000000000000000002" {
+		t.Errorf("second ID = %q", id)
+	}
+	if id := (Random{}).NewID(); len(id) != 32 {
+		t.Errorf("random ID %q has length %d, want 32", id, len(id))
+	}
+}
@@ -18,6 +18,179 @@ type Config struct {
 	Cluster       ClusterConfig       `yaml:"cluster"`
 	Logging       LoggingConfig       `yaml:"logging"`
 	Observability ObservabilityConfig `yaml:"observability"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+	Provision     ProvisionConfig     `yaml:"provision"`
+	// BucketReplication copies objects selected by bucket replication rules
+	// (PutBucketReplication) to a remote S3-compatible endpoint.
+	BucketReplication BucketReplicationConfig `yaml:"bucket_replication"`
+	// Inventory writes scheduled reports listing a bucket's objects
+	// (PutBucketInventoryConfiguration) to a destination bucket.
+	Inventory InventoryConfig `yaml:"inventory"`
+	// ErasureRequests enables the admin workflow that erases the objects
+	// of a data subject and signs a report of it.
+	ErasureRequests ErasureRequestsConfig `yaml:"erasure_requests"`
+	// BackupHooks configures the pre/post backup admin hooks that quiesce
+	// writes around a filesystem-level backup.
+	BackupHooks BackupHooksConfig `yaml:"backup_hooks"`
+	// HA runs this instance as one of an active-passive pair sharing
+	// metadata and storage.
+	HA HAConfig `yaml:"ha"`
+}
+
+// HAConfig holds the leader election settings of an active-passive pair:
+// instances sharing a metadata store compete for a lease in it, and only
+// the holder accepts writes and runs background workers. Needs a metadata
+// engine that can arbitrate leases (sqlite, dynamodb or etcd).
+type HAConfig struct {
+	// Enabled turns on leader election.
+	Enabled bool `yaml:"enabled"`
+	// NodeID identifies this instance in the lease and in the
+	// x-bleepstore-leader header, e.g. its URL (default: hostname:port).
+	NodeID string `yaml:"node_id"`
+	// LeaseTTLMillis is how long a lease lasts unless renewed; a standby
+	// takes over at most this long after the leader fails (default: 15000).
+	LeaseTTLMillis int `yaml:"lease_ttl_ms"`
+	// RenewIntervalMillis is how often the lease is renewed or, by a
+	// standby, claimed (default: 5000). It must be below lease_ttl_ms.
+	RenewIntervalMillis int `yaml:"renew_interval_ms"`
+}
+
+// BackupHooksConfig holds the settings of POST /admin/backup/pre and
+// /admin/backup/post.
+type BackupHooksConfig struct {
+	// DrainTimeoutMillis bounds the wait for writes in progress when writes
+	// are quiesced (default: 30000).
+	DrainTimeoutMillis int `yaml:"drain_timeout_ms"`
+	// MaxQuiesceMillis resumes writes automatically if the post hook has not
+	// been called by then (default: 600000).
+	MaxQuiesceMillis int `yaml:"max_quiesce_ms"`
+	// MarkerPath is the file the pre hook writes its marker to (default:
+	// backup-marker.json beside the SQLite database).
+	MarkerPath string `yaml:"marker_path"`
+}
+
+// BucketReplicationConfig holds the remote endpoint that bucket replication
+// rules copy to, and the settings of the background worker that drains the
+// replication queue. Replication needs the sqlite metadata engine.
+type BucketReplicationConfig struct {
+	// Enabled turns on the replication API and worker.
+	Enabled bool `yaml:"enabled"`
+	// EndpointURL is the destination service's endpoint (empty = AWS S3).
+	EndpointURL string `yaml:"endpoint_url"`
+	// Region is the destination's region (default: us-east-1).
+	Region string `yaml:"region"`
+	// UsePathStyle forces path-style URL addressing.
+	UsePathStyle bool `yaml:"use_path_style"`
+	// AccessKeyID is an explicit access key (falls back to env/credential chain).
+	AccessKeyID string `yaml:"access_key_id"`
+	// SecretAccessKey is an explicit secret key (falls back to env/credential chain).
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// PollIntervalMillis is how often the worker checks the queue for due
+	// tasks (default: 1000).
+	PollIntervalMillis int `yaml:"poll_interval_ms"`
+	// MaxAttempts is how many times a write is tried before the object is
+	// marked FAILED (default: 10). Retries back off exponentially.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Verify configures the job that checks replicas against their source
+	// objects.
+	Verify ReplicationVerifyConfig `yaml:"verify"`
+}
+
+// ReplicationVerifyConfig holds the settings of the replication
+// verification job, which compares the size and MD5 of replicated objects
+// with their replicas and writes a divergence report.
+type ReplicationVerifyConfig struct {
+	// ReportBucket is the local bucket reports are written to. The job is
+	// available only when it is set.
+	ReportBucket string `yaml:"report_bucket"`
+	// ReportPrefix is prepended to report keys (default: "replication-verify/").
+	ReportPrefix string `yaml:"report_prefix"`
+	// IntervalSeconds is how often the job runs on its own (0 = only on
+	// demand, through /admin/bucket-replication/verify).
+	IntervalSeconds int `yaml:"interval_seconds"`
+	// SampleRate is the fraction of replicated objects checked, between 0
+	// and 1 (default: 1, every object).
+	SampleRate float64 `yaml:"sample_rate"`
+}
+
+// InventoryConfig holds the settings of the bucket inventory API and the
+// background worker that writes the reports it schedules. Inventory needs
+// the sqlite metadata engine.
+type InventoryConfig struct {
+	// Enabled turns on the inventory API and worker.
+	Enabled bool `yaml:"enabled"`
+	// CheckIntervalSeconds is how often the worker looks for configurations
+	// whose next report is due (default: 3600).
+	CheckIntervalSeconds int `yaml:"check_interval_seconds"`
+}
+
+// ErasureRequestsConfig holds the settings of the erasure request workflow
+// (/admin/erasure-requests), which needs the sqlite metadata engine.
+type ErasureRequestsConfig struct {
+	// Enabled turns on the workflow.
+	Enabled bool `yaml:"enabled"`
+	// SigningKey is the HMAC-SHA256 key that signs erasure reports. It is
+	// required when Enabled is set.
+	SigningKey string `yaml:"signing_key"`
+}
+
+// ProvisionConfig declares buckets and objects created at startup, so test
+// and integration environments come up populated. Provisioning only adds
+// what is missing: existing buckets and objects are left as they are.
+type ProvisionConfig struct {
+	Buckets []ProvisionBucketConfig `yaml:"buckets"`
+}
+
+// ProvisionBucketConfig declares one bucket and the objects seeded into it.
+type ProvisionBucketConfig struct {
+	// Name is the bucket name.
+	Name string `yaml:"name"`
+	// ACL is the canned ACL the bucket is created with (default: private).
+	ACL string `yaml:"acl"`
+	// Objects are written to the bucket if they do not exist.
+	Objects []ProvisionObjectConfig `yaml:"objects"`
+}
+
+// ProvisionObjectConfig declares one seeded object.
+type ProvisionObjectConfig struct {
+	// Key is the object key.
+	Key string `yaml:"key"`
+	// Content is the object body.
+	Content string `yaml:"content"`
+	// File names a file to read the body from instead of Content.
+	File string `yaml:"file"`
+	// ContentType defaults to application/octet-stream.
+	ContentType string `yaml:"content_type"`
+	// Metadata holds user metadata (stored as x-amz-meta-* headers).
+	Metadata map[string]string `yaml:"metadata"`
+	// ACL is the canned ACL the object is created with (default: private).
+	ACL string `yaml:"acl"`
+}
+
+// RateLimitConfig holds token-bucket request rate limits. A rate of zero
+// disables the corresponding scope. Limits are re-read on SIGHUP.
+type RateLimitConfig struct {
+	// Enabled turns on rate limiting.
+	Enabled bool `yaml:"enabled"`
+	// Global limits the total request rate across all clients.
+	Global RateLimitRule `yaml:"global"`
+	// PerIP limits the request rate of each client IP address.
+	PerIP RateLimitRule `yaml:"per_ip"`
+	// PerAccessKey limits the request rate of each authenticated access key.
+	PerAccessKey RateLimitRule `yaml:"per_access_key"`
+	// PersistIntervalSeconds is how often token balances are saved to the
+	// metadata store, when it can keep them, so a restart does not hand
+	// every client a fresh burst. 0 (default) disables saving. Read at
+	// startup only.
+	PersistIntervalSeconds int `yaml:"persist_interval_seconds"`
+}
+
+// RateLimitRule is a single token-bucket limit.
+type RateLimitRule struct {
+	// RequestsPerSecond is the sustained refill rate.
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// Burst is the bucket capacity (default: max(1, RequestsPerSecond)).
+	Burst int `yaml:"burst"`
 }
 
 // ObservabilityConfig holds settings for metrics and health check endpoints.
@@ -26,6 +199,20 @@ type ObservabilityConfig struct {
 	Metrics bool `yaml:"metrics"`
 	// HealthCheck enables the /healthz and /readyz liveness/readiness probes.
 	HealthCheck bool `yaml:"health_check"`
+	// Usage configures per-access-key usage accounting.
+	Usage UsageConfig `yaml:"usage"`
+	// ServerTiming adds a Server-Timing header with auth, metadata and storage
+	// durations to every response. Debug aid; exposes internal timings.
+	ServerTiming bool `yaml:"server_timing"`
+}
+
+// UsageConfig holds settings for per-access-key usage accounting.
+type UsageConfig struct {
+	// Enabled turns on usage accounting and the /admin/usage endpoint.
+	Enabled bool `yaml:"enabled"`
+	// FlushIntervalSeconds is how often aggregated counters are written to
+	// the metadata store (default: 60). Counters not yet flushed are lost on crash.
+	FlushIntervalSeconds int `yaml:"flush_interval_seconds"`
 }
 
 // LoggingConfig holds structured logging settings.
@@ -34,15 +221,167 @@ type LoggingConfig struct {
 	Level string `yaml:"level"`
 	// Format is the log output format: "text" or "json".
 	Format string `yaml:"format"`
+	// RequestSampleRate is the fraction of S3 requests logged at info level
+	// when they complete, from 0 (default) to 1. Overrides set through
+	// /admin/request-logging raise it for one bucket for a while.
+	RequestSampleRate float64 `yaml:"request_sample_rate"`
 }
 
 // ServerConfig holds HTTP server settings.
 type ServerConfig struct {
-	Host            string `yaml:"host"`
-	Port            int    `yaml:"port"`
-	Region          string `yaml:"region"`
-	ShutdownTimeout int    `yaml:"shutdown_timeout"` // Graceful shutdown timeout in seconds (default: 30).
-	MaxObjectSize   int64  `yaml:"max_object_size"`  // Maximum object size in bytes (default: 5 GiB).
+	Host            string            `yaml:"host"`
+	Port            int               `yaml:"port"`
+	Region          string            `yaml:"region"`
+	ShutdownTimeout int               `yaml:"shutdown_timeout"` // Graceful shutdown timeout in seconds (default: 30).
+	MaxObjectSize   int64             `yaml:"max_object_size"`  // Maximum object size in bytes (default: 5 GiB).
+	TLS             TLSConfig         `yaml:"tls"`
+	Compression     CompressionConfig `yaml:"compression"`
+	// AcceptedRegions lists the SigV4 credential scope regions accepted.
+	// Empty or "*" accepts any region.
+	AcceptedRegions []string `yaml:"accepted_regions"`
+	// BucketRegions overrides the region advertised for individual buckets
+	// in GetBucketLocation, HeadBucket and ListBuckets.
+	BucketRegions map[string]string `yaml:"bucket_regions"`
+	// VirtualHostDomain enables virtual-hosted-style addressing: requests
+	// for "{name}.{domain}" address the bucket or alias {name}. Names of
+	// the admin API and infrastructure endpoints, such as "admin" and
+	// "metrics", are reserved and refused.
+	VirtualHostDomain string `yaml:"virtual_host_domain"`
+	// Aliases maps alternate bucket names to scoped views of a real bucket.
+	Aliases map[string]AliasConfig `yaml:"aliases"`
+	// PrefixQuotas limits the bytes and object count stored under prefixes
+	// within a bucket.
+	PrefixQuotas []PrefixQuotaConfig `yaml:"prefix_quotas"`
+	// DisabledOperations lists S3 operation names (e.g. "DeleteBucket")
+	// that are rejected with NotImplemented.
+	DisabledOperations []string `yaml:"disabled_operations"`
+	// MultiRange is how GetObject answers a Range header listing several
+	// ranges: "multipart" (default) streams a multipart/byteranges
+	// response, "ignore" serves the whole object as Amazon S3 does, and
+	// "reject" answers 416 InvalidRange.
+	MultiRange string `yaml:"multi_range"`
+	// Website configures the static website endpoint.
+	Website WebsiteConfig `yaml:"website"`
+	// CustomDomains maps hostnames, CNAMEs pointing at this server, to the
+	// bucket each serves.
+	CustomDomains map[string]CustomDomainConfig `yaml:"custom_domains"`
+}
+
+// CustomDomainConfig maps a hostname to a bucket. Requests for the
+// hostname address the bucket, either as an S3 endpoint, like a
+// virtual-hosted-style hostname of it, or as its website.
+type CustomDomainConfig struct {
+	// Bucket is the bucket, or alias, the hostname serves.
+	Bucket string `yaml:"bucket"`
+	// Website serves the hostname as the bucket's website endpoint.
+	Website bool `yaml:"website"`
+	// CertFile and KeyFile are the hostname's certificate, served to TLS
+	// clients asking for it by SNI. Without them it is served with the
+	// server certificate, or with ACME enabled, one obtained for it.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// WebsiteConfig holds settings for the static website endpoint, which
+// serves objects readable by everyone to anonymous GET and HEAD requests
+// and follows their x-amz-website-redirect-location.
+type WebsiteConfig struct {
+	// Domain enables the endpoint: requests for "{bucket}.{domain}" are
+	// website requests for the bucket. It must differ from
+	// VirtualHostDomain.
+	Domain string `yaml:"domain"`
+	// IndexDocument is the key suffix served for paths ending in "/"
+	// (default: index.html).
+	IndexDocument string `yaml:"index_document"`
+}
+
+// PrefixQuotaConfig limits the data stored under a key prefix. Writes that
+// would exceed a limit are rejected with QuotaExceeded; deletes are always
+// allowed. A zero limit is unlimited.
+type PrefixQuotaConfig struct {
+	// Bucket is the bucket the quota applies to.
+	Bucket string `yaml:"bucket"`
+	// Prefix selects the keys counted against the quota. A "*" matches one
+	// path segment, giving each matching prefix its own quota: with
+	// "projects/*/" every project is limited separately.
+	Prefix string `yaml:"prefix"`
+	// MaxBytes limits the total size of objects under the prefix.
+	MaxBytes int64 `yaml:"max_bytes"`
+	// MaxObjects limits the number of objects under the prefix.
+	MaxObjects int64 `yaml:"max_objects"`
+}
+
+// AliasConfig defines an access-point-like alias for a bucket. Requests
+// through the alias operate on the underlying bucket, restricted to Prefix
+// and to the operations the alias's policy allows. Bucket-level writes
+// (create, delete, ACL changes) are never allowed through an alias.
+type AliasConfig struct {
+	// Bucket is the underlying bucket name.
+	Bucket string `yaml:"bucket"`
+	// Prefix, if set, confines the alias to keys beginning with it. Listings
+	// are narrowed to the prefix and other keys are denied.
+	Prefix string `yaml:"prefix"`
+	// ReadOnly allows only GET and HEAD requests.
+	ReadOnly bool `yaml:"read_only"`
+	// AccessKeys, if non-empty, lists the only access keys that may use the alias.
+	AccessKeys []string `yaml:"access_keys"`
+}
+
+// CompressionConfig holds settings for gzip compression of API responses.
+// Only small XML/JSON/text bodies without a Content-Length (listings, errors,
+// ACLs) are compressed; object data is never touched.
+type CompressionConfig struct {
+	// Enabled turns on response compression for clients sending Accept-Encoding: gzip.
+	Enabled bool `yaml:"enabled"`
+	// MinSizeBytes is the smallest body worth compressing (default: 1024).
+	MinSizeBytes int `yaml:"min_size_bytes"`
+	// MaxSizeBytes is the largest body buffered for compression (default: 1 MiB).
+	MaxSizeBytes int `yaml:"max_size_bytes"`
+}
+
+// TLSConfig holds native HTTPS termination settings.
+type TLSConfig struct {
+	// Enabled serves HTTPS on the main port instead of plain HTTP.
+	Enabled bool `yaml:"enabled"`
+	// CertFile is the PEM certificate chain path. Re-read when it changes on disk.
+	CertFile string `yaml:"cert_file"`
+	// KeyFile is the PEM private key path.
+	KeyFile string `yaml:"key_file"`
+	// HTTPPort, if non-zero, starts a plain HTTP listener on this port that
+	// redirects to HTTPS and answers ACME HTTP-01 challenges.
+	HTTPPort int `yaml:"http_port"`
+	// ACME obtains certificates automatically instead of using CertFile/KeyFile.
+	ACME ACMEConfig `yaml:"acme"`
+	// ClientAuth configures mutual TLS client certificate authentication.
+	ClientAuth ClientAuthConfig `yaml:"client_auth"`
+}
+
+// ClientAuthConfig holds mutual TLS settings. Requests presenting a
+// certificate signed by CAFile authenticate as the mapped access key without
+// a SigV4 signature; signed requests are still verified as usual.
+type ClientAuthConfig struct {
+	// Mode is "none" (default), "optional" (verify if presented) or
+	// "require" (reject handshakes without a valid client certificate).
+	Mode string `yaml:"mode"`
+	// CAFile is the PEM bundle of CAs trusted to issue client certificates.
+	CAFile string `yaml:"ca_file"`
+	// Subjects maps certificate subjects (full DN such as "CN=svc,O=Example",
+	// or just the common name) to access key IDs.
+	Subjects map[string]string `yaml:"subjects"`
+}
+
+// ACMEConfig holds automatic certificate management settings.
+type ACMEConfig struct {
+	// Enabled turns on ACME certificate issuance and renewal.
+	Enabled bool `yaml:"enabled"`
+	// Hostnames lists the names certificates may be requested for.
+	Hostnames []string `yaml:"hostnames"`
+	// Email is the contact address registered with the CA.
+	Email string `yaml:"email"`
+	// CacheDir stores issued certificates and the account key (default: ./data/acme).
+	CacheDir string `yaml:"cache_dir"`
+	// DirectoryURL is the ACME directory (default: Let's Encrypt production).
+	DirectoryURL string `yaml:"directory_url"`
 }
 
 // AuthConfig holds authentication and authorization settings.
@@ -51,11 +390,69 @@ type AuthConfig struct {
 	AccessKey string `yaml:"access_key"`
 	// SecretKey is the S3 secret key used for SigV4 authentication.
 	SecretKey string `yaml:"secret_key"`
+	// Delegation configures prefix-scoped delegation tokens.
+	Delegation DelegationConfig `yaml:"delegation"`
+	// ClockSkewSeconds is how far ahead of the server's clock a signed
+	// request's date may be (default: 900).
+	ClockSkewSeconds int `yaml:"clock_skew_seconds"`
+	// MaxRequestAgeSeconds is how old the X-Amz-Date of a header-signed
+	// request may be before it is refused as RequestTimeTooSkewed
+	// (default: 900).
+	MaxRequestAgeSeconds int `yaml:"max_request_age_seconds"`
+	// PresignedMaxExpirySeconds caps X-Amz-Expires on presigned URLs. Zero
+	// allows the S3 maximum of 604800 (seven days).
+	PresignedMaxExpirySeconds int `yaml:"presigned_max_expiry_seconds"`
+	// OIDC configures bearer JWT authentication against an OpenID Connect
+	// issuer.
+	OIDC OIDCConfig `yaml:"oidc"`
+	// MasterKey encrypts credential secret keys in the metadata store.
+	// Plaintext secrets are sealed at startup once it is set. Empty stores
+	// them in plaintext.
+	MasterKey string `yaml:"master_key"`
+	// EnforceACLs authorizes requests from other access keys, and unsigned
+	// anonymous requests, against bucket and object ACLs. When false, any
+	// authenticated request is allowed and unsigned requests are refused.
+	EnforceACLs bool `yaml:"enforce_acls"`
+}
+
+// DelegationConfig holds settings for delegation tokens: signed, time-limited
+// grants of read or read-write access to one bucket prefix, minted via
+// POST /admin/delegation-tokens and verified without a metadata lookup.
+type DelegationConfig struct {
+	// Secret is the HMAC key tokens are signed with. Empty disables
+	// delegation tokens. Replicas must share the same secret; changing it
+	// revokes all outstanding tokens.
+	Secret string `yaml:"secret"`
+	// MaxTTLSeconds caps the lifetime of a minted token (default: 86400).
+	MaxTTLSeconds int `yaml:"max_ttl_seconds"`
+}
+
+// OIDCConfig holds settings for bearer JWT authentication, for services
+// that hold tokens from an OpenID Connect provider rather than S3 keys.
+// Tokens arrive as "Authorization: Bearer <jwt>" and act as the owner their
+// OwnerClaim names, limited to the s3:read and s3:write permissions in
+// PermissionsClaim.
+type OIDCConfig struct {
+	// Issuer is the required iss claim. Empty disables OIDC
+	// authentication.
+	Issuer string `yaml:"issuer"`
+	// Audience is the required aud claim. Empty accepts any audience.
+	Audience string `yaml:"audience"`
+	// JWKSURL is where signing keys are fetched. Empty discovers it from
+	// the issuer's /.well-known/openid-configuration.
+	JWKSURL string `yaml:"jwks_url"`
+	// OwnerClaim names the claim used as the caller's owner ID
+	// (default: sub).
+	OwnerClaim string `yaml:"owner_claim"`
+	// PermissionsClaim names the claim listing permissions: "s3:read" and
+	// "s3:write" for every bucket, or "s3:read:<bucket>" and
+	// "s3:write:<bucket>" for one (default: scope).
+	PermissionsClaim string `yaml:"permissions_claim"`
 }
 
 // MetadataConfig holds metadata store settings.
 type MetadataConfig struct {
-	// Engine is the metadata backend engine (e.g., "sqlite", "memory", "local", "dynamodb", "firestore", "cosmos").
+	// Engine is the metadata backend engine (e.g., "sqlite", "memory", "local", "dynamodb", "firestore", "cosmos", "etcd", "bolt").
 	Engine string `yaml:"engine"`
 	// SQLite holds SQLite-specific settings.
 	SQLite SQLiteConfig `yaml:"sqlite"`
@@ -67,12 +464,49 @@ type MetadataConfig struct {
 	Firestore FirestoreConfig `yaml:"firestore"`
 	// Cosmos holds Cosmos DB-specific settings.
 	Cosmos CosmosConfig `yaml:"cosmos"`
+	// Etcd holds etcd-specific settings.
+	Etcd EtcdConfig `yaml:"etcd"`
+	// Bolt holds embedded bbolt key-value store settings.
+	Bolt BoltConfig `yaml:"bolt"`
 }
 
 // SQLiteConfig holds SQLite-specific metadata store settings.
 type SQLiteConfig struct {
 	// Path is the filesystem path for the SQLite database file.
 	Path string `yaml:"path"`
+	// MaxOpenConns limits open connections in the write pool (0 = unlimited).
+	MaxOpenConns int `yaml:"max_open_conns"`
+	// MaxIdleConns sets idle connections kept in each pool (0 = database/sql default).
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// ReadConns sizes a separate read-only pool for lookups and listings, so
+	// reads do not queue behind writes. 0 serves reads from the write pool.
+	ReadConns int `yaml:"read_conns"`
+	// Maintenance schedules WAL checkpoints, vacuuming and ANALYZE.
+	Maintenance MaintenanceConfig `yaml:"maintenance"`
+}
+
+// MaintenanceConfig holds settings for periodic metadata database
+// maintenance. Each interval is in seconds; a negative interval disables
+// that task.
+type MaintenanceConfig struct {
+	// Enabled turns on the background maintenance scheduler.
+	Enabled bool `yaml:"enabled"`
+	// CheckpointIntervalSeconds is how often the WAL is checkpointed and
+	// truncated (default: 300).
+	CheckpointIntervalSeconds int `yaml:"checkpoint_interval_seconds"`
+	// VacuumIntervalSeconds is how often free pages are released (default: 3600).
+	VacuumIntervalSeconds int `yaml:"vacuum_interval_seconds"`
+	// VacuumPages caps the pages released per vacuum run (0 = all).
+	VacuumPages int `yaml:"vacuum_pages"`
+	// AnalyzeIntervalSeconds is how often planner statistics are refreshed
+	// (default: 86400).
+	AnalyzeIntervalSeconds int `yaml:"analyze_interval_seconds"`
+}
+
+// BoltConfig holds embedded bbolt metadata store settings.
+type BoltConfig struct {
+	// Path is the filesystem path for the bbolt database file (default: ./data/metadata.bolt).
+	Path string `yaml:"path"`
 }
 
 // LocalMetaConfig holds local JSONL file-based metadata store settings.
@@ -91,6 +525,14 @@ type DynamoDBConfig struct {
 	Region string `yaml:"region"`
 	// EndpointURL is a custom DynamoDB endpoint (for local testing).
 	EndpointURL string `yaml:"endpoint_url"`
+	// BackfillListIndex adds list index attributes to items written before
+	// the "list-index" GSI existed, with one table scan at startup. Enable
+	// once after upgrading, then turn off.
+	BackfillListIndex bool `yaml:"backfill_list_index"`
+	// UploadTTLSeconds sets the expires_at TTL attribute on multipart upload
+	// and part items, so DynamoDB deletes abandoned uploads natively even if
+	// the startup sweep never reaches them. Defaults to 7 days.
+	UploadTTLSeconds int `yaml:"upload_ttl_seconds"`
 }
 
 // FirestoreConfig holds Firestore-specific metadata store settings.
@@ -115,15 +557,129 @@ type CosmosConfig struct {
 	MasterKey string `yaml:"master_key"`
 }
 
+// EtcdConfig holds etcd-specific metadata store settings.
+type EtcdConfig struct {
+	// Endpoints lists the etcd client URLs.
+	Endpoints []string `yaml:"endpoints"`
+	// Prefix namespaces all BleepStore keys (default: "/bleepstore/").
+	Prefix string `yaml:"prefix"`
+	// Username and Password enable etcd authentication when set.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// DialTimeoutSeconds bounds the initial connection (default: 5).
+	DialTimeoutSeconds int `yaml:"dial_timeout_seconds"`
+}
+
 // StorageConfig holds object storage backend settings.
 type StorageConfig struct {
-	// Backend is the storage backend type (e.g., "local", "memory", "sqlite", "aws", "gcp", "azure").
-	Backend string       `yaml:"backend"`
-	Local   LocalConfig  `yaml:"local"`
-	Memory  MemoryConfig `yaml:"memory"`
-	AWS     AWSConfig    `yaml:"aws"`
-	GCP     GCPConfig    `yaml:"gcp"`
-	Azure   AzureConfig  `yaml:"azure"`
+	// Backend is the storage backend type (e.g., "local", "memory", "sqlite", "mirror", "erasure", "dedup", "aws", "gcp", "azure").
+	Backend string        `yaml:"backend"`
+	Local   LocalConfig   `yaml:"local"`
+	Memory  MemoryConfig  `yaml:"memory"`
+	Mirror  MirrorConfig  `yaml:"mirror"`
+	Erasure ErasureConfig `yaml:"erasure"`
+	Dedup   DedupConfig   `yaml:"dedup"`
+	AWS     AWSConfig     `yaml:"aws"`
+	GCP     GCPConfig     `yaml:"gcp"`
+	Azure   AzureConfig   `yaml:"azure"`
+	Defrag  DefragConfig  `yaml:"defrag"`
+	// Prefetch warms objects named in x-bleepstore-prefetch GET headers.
+	Prefetch PrefetchConfig `yaml:"prefetch"`
+	// Scrub periodically re-hashes stored objects to detect corruption.
+	Scrub ScrubConfig `yaml:"scrub"`
+	// CoalesceReads shares one backend fetch among concurrent GETs of the
+	// same object on the gateway backends (aws, gcp, azure), spooling it to
+	// a temporary file. Range GETs, which otherwise each fetch the object
+	// from its start, gain the most.
+	CoalesceReads bool `yaml:"coalesce_reads"`
+	// CoalesceSpoolDir is where shared fetches are spooled (default: the
+	// system temporary directory).
+	CoalesceSpoolDir string `yaml:"coalesce_spool_dir"`
+	// AdaptiveConcurrency limits concurrent operations on the sqlite and
+	// gateway backends to what they sustain.
+	AdaptiveConcurrency AdaptiveConcurrencyConfig `yaml:"adaptive_concurrency"`
+	// InlineThresholdBytes stores objects up to this size in their metadata
+	// row instead of the backend (0 = disabled). Needs the sqlite or memory
+	// metadata engine.
+	InlineThresholdBytes int64 `yaml:"inline_threshold_bytes"`
+}
+
+// ScrubConfig holds settings for the background scrubber, which reads every
+// object back and compares its hash with the stored ETag.
+type ScrubConfig struct {
+	// Enabled turns on periodic scrub passes.
+	Enabled bool `yaml:"enabled"`
+	// IntervalSeconds is the time between the starts of passes (default: 86400).
+	IntervalSeconds int `yaml:"interval_seconds"`
+	// BytesPerSecond caps the rate at which a pass reads object data
+	// (default: 10485760).
+	BytesPerSecond int64 `yaml:"bytes_per_second"`
+	// Repair rewrites corrupt or missing objects with RepairSource's copy.
+	Repair bool `yaml:"repair"`
+	// RepairSource is the S3-compatible service holding good copies.
+	RepairSource ScrubSourceConfig `yaml:"repair_source"`
+}
+
+// ScrubSourceConfig locates copies of this instance's objects on an
+// S3-compatible service: another BleepStore instance with the same buckets,
+// or, with Bucket set, the upstream bucket of an AWS gateway deployment.
+type ScrubSourceConfig struct {
+	// EndpointURL is the source's endpoint (empty = AWS S3).
+	EndpointURL string `yaml:"endpoint_url"`
+	// Region is the source's region (default: us-east-1).
+	Region string `yaml:"region"`
+	// UsePathStyle forces path-style URL addressing.
+	UsePathStyle bool `yaml:"use_path_style"`
+	// AccessKeyID is an explicit access key (falls back to env/credential chain).
+	AccessKeyID string `yaml:"access_key_id"`
+	// SecretAccessKey is an explicit secret key (falls back to env/credential chain).
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// Bucket is the upstream bucket of a gateway layout, where objects are
+	// stored at {Prefix}{bucket}/{key} (empty = same bucket and key).
+	Bucket string `yaml:"bucket"`
+	// Prefix is the key prefix of the gateway layout.
+	Prefix string `yaml:"prefix"`
+}
+
+// DefragConfig holds settings for background defragmentation of
+// multipart-assembled objects on backends that store them as part chains.
+type DefragConfig struct {
+	// Enabled turns on the background defragmenter.
+	Enabled bool `yaml:"enabled"`
+	// IdleSeconds is how long the server must see no requests before
+	// defragmentation runs (default: 30).
+	IdleSeconds int `yaml:"idle_seconds"`
+	// IntervalSeconds is how often the defragmenter checks for work (default: 60).
+	IntervalSeconds int `yaml:"interval_seconds"`
+}
+
+// PrefetchConfig holds settings for warming objects that clients name in an
+// x-bleepstore-prefetch header on GET. Only backends that can preload
+// objects (local, mirror) act on the hints.
+type PrefetchConfig struct {
+	// Enabled turns on prefetch hints.
+	Enabled bool `yaml:"enabled"`
+	// Workers is the number of objects warmed concurrently (default: 4).
+	Workers int `yaml:"workers"`
+	// QueueSize is the number of hinted keys that may wait for a worker;
+	// further hints are dropped (default: 1024).
+	QueueSize int `yaml:"queue_size"`
+}
+
+// AdaptiveConcurrencyConfig holds settings for the adaptive concurrency
+// limit, which rises while the backend keeps up and halves when operations
+// fail or exceed the target latency.
+type AdaptiveConcurrencyConfig struct {
+	// Enabled turns on the limit.
+	Enabled bool `yaml:"enabled"`
+	// InitialLimit is the limit at startup (default: 16).
+	InitialLimit int `yaml:"initial_limit"`
+	// MinLimit and MaxLimit bound the limit (defaults: 1 and 256).
+	MinLimit int `yaml:"min_limit"`
+	MaxLimit int `yaml:"max_limit"`
+	// TargetLatencyMillis is the latency above which an operation counts
+	// as a sign of overload (default: 500).
+	TargetLatencyMillis int `yaml:"target_latency_ms"`
 }
 
 // MemoryConfig holds in-memory storage backend settings.
@@ -136,6 +692,69 @@ type MemoryConfig struct {
 	SnapshotPath string `yaml:"snapshot_path"`
 	// SnapshotIntervalSeconds is the interval between periodic snapshots (0 = only on shutdown).
 	SnapshotIntervalSeconds int `yaml:"snapshot_interval_seconds"`
+	// SnapshotCompression is "zstd" (default) or "none".
+	SnapshotCompression string `yaml:"snapshot_compression"`
+	// Replication streams objects between a primary and a replica.
+	Replication MemoryReplicationConfig `yaml:"replication"`
+}
+
+// MemoryReplicationConfig pairs two memory-backend instances so that either
+// can be restarted without losing objects. The replica follows the primary
+// and rejects writes; a primary that starts empty copies the replica's
+// objects back before serving.
+type MemoryReplicationConfig struct {
+	// Role is "primary", "replica" or "" (replication disabled).
+	Role string `yaml:"role"`
+	// Peer is the base URL of the other instance, e.g. "http://bleepstore-1:9000".
+	Peer string `yaml:"peer"`
+}
+
+// MirrorConfig holds mirror backend settings. Each object is copied to
+// several local targets, spread across zones first so that losing a rack or
+// zone loses no data.
+type MirrorConfig struct {
+	// Targets lists the copy locations.
+	Targets []MirrorTargetConfig `yaml:"targets"`
+	// Copies is the number of targets each object is written to (default: all).
+	Copies int `yaml:"copies"`
+	// MinZones is the number of distinct zones a write must reach to succeed
+	// (default: as many zones as Copies can cover).
+	MinZones int `yaml:"min_zones"`
+}
+
+// MirrorTargetConfig describes one mirror target.
+type MirrorTargetConfig struct {
+	// Name identifies the target in placement reports (default: RootDir).
+	Name string `yaml:"name"`
+	// Zone is the failure domain of the target, e.g. a rack or availability
+	// zone (default: a zone of its own).
+	Zone string `yaml:"zone"`
+	// RootDir is the base directory for the target's objects.
+	RootDir string `yaml:"root_dir"`
+}
+
+// ErasureConfig holds erasure-coded storage backend settings. Objects are
+// striped across Disks with Reed-Solomon parity, so any ParityShards disks
+// can fail without losing data.
+type ErasureConfig struct {
+	// Disks lists one data directory per disk. Their order fixes which shard
+	// each disk holds and must not change.
+	Disks []string `yaml:"disks"`
+	// ParityShards is the number of disks holding parity (default: 2 with
+	// five or more disks, otherwise 1).
+	ParityShards int `yaml:"parity_shards"`
+	// BlockSizeBytes is the shard data per stripe (default: 65536).
+	BlockSizeBytes int `yaml:"block_size_bytes"`
+}
+
+// DedupConfig holds content-addressable storage backend settings. Each
+// distinct object body is stored once and shared by every key holding it.
+type DedupConfig struct {
+	// RootDir is the base directory for blobs and their index.
+	RootDir string `yaml:"root_dir"`
+	// GCIntervalSeconds is how often unreferenced blobs are removed
+	// (default: 3600).
+	GCIntervalSeconds int `yaml:"gc_interval_seconds"`
 }
 
 // AWSConfig holds AWS S3 gateway backend settings.
@@ -188,6 +807,78 @@ type AzureConfig struct {
 type LocalConfig struct {
 	// RootDir is the base directory for local object storage.
 	RootDir string `yaml:"root_dir"`
+	// RootDirs lists multiple data roots (one per disk). When set, objects
+	// are spread across them and RootDir is ignored.
+	RootDirs []string `yaml:"root_dirs"`
+	// PlacementIndex is the file recording which of RootDirs holds each
+	// object (default: .placement/index.db in the first root).
+	PlacementIndex string `yaml:"placement_index"`
+	// Pack stores small objects in large segment files (single root only).
+	Pack PackConfig `yaml:"pack"`
+	// Compression compresses object data at rest.
+	Compression DataCompressionConfig `yaml:"compression"`
+	// OrphanGC removes data files no metadata record refers to (single
+	// root, unpacked storage only).
+	OrphanGC OrphanGCConfig `yaml:"orphan_gc"`
+	// Naming selects how object files are named on disk (single root,
+	// unpacked storage only).
+	Naming NamingConfig `yaml:"naming"`
+}
+
+// NamingConfig holds settings for naming object files on the local
+// backend.
+type NamingConfig struct {
+	// Scheme is "plain" to name files after their keys, or "hashed" to
+	// name them after a keyed hash of bucket and key, so disk contents do
+	// not reveal key names (default: plain).
+	Scheme string `yaml:"scheme"`
+	// Secret keys the hash. Changing it, like changing Scheme, loses track
+	// of the objects already stored.
+	Secret string `yaml:"secret"`
+}
+
+// OrphanGCConfig holds settings for the orphaned data collector, which
+// finds object and part files left behind by writes that failed between
+// storing the data and committing its metadata.
+type OrphanGCConfig struct {
+	// Enabled turns on periodic collection passes.
+	Enabled bool `yaml:"enabled"`
+	// IntervalSeconds is the time between the starts of passes (default: 86400).
+	IntervalSeconds int `yaml:"interval_seconds"`
+	// MinAgeSeconds is how old a file must be before it is considered, so
+	// writes in progress are not mistaken for orphans (default: 3600).
+	MinAgeSeconds int `yaml:"min_age_seconds"`
+	// Quarantine moves orphans under .quarantine in the storage root
+	// instead of deleting them.
+	Quarantine bool `yaml:"quarantine"`
+	// DryRun makes periodic passes only report orphans.
+	DryRun bool `yaml:"dry_run"`
+}
+
+// DataCompressionConfig holds settings for compressing object data at rest.
+// Objects written while it is enabled record their codec in metadata and
+// stay readable after it is turned off.
+type DataCompressionConfig struct {
+	// Codec is "zstd" or "gzip" ("" = disabled).
+	Codec string `yaml:"codec"`
+	// Buckets limits compression to the listed buckets (empty = all).
+	Buckets []string `yaml:"buckets"`
+}
+
+// PackConfig holds settings for packing small objects into segment files.
+type PackConfig struct {
+	// Enabled turns on segment packing.
+	Enabled bool `yaml:"enabled"`
+	// ThresholdBytes is the largest object that is packed (default: 65536).
+	ThresholdBytes int64 `yaml:"threshold_bytes"`
+	// SegmentBytes is the size at which a segment file is sealed
+	// (default: 268435456).
+	SegmentBytes int64 `yaml:"segment_bytes"`
+	// CompactRatio is the fraction of a sealed segment that must be dead
+	// (overwritten or deleted) before it is compacted (default: 0.5).
+	CompactRatio float64 `yaml:"compact_ratio"`
+	// CompactIntervalSeconds is how often compaction runs (default: 3600).
+	CompactIntervalSeconds int `yaml:"compact_interval_seconds"`
 }
 
 // ClusterConfig holds clustering and replication settings.
@@ -267,6 +958,7 @@ func defaultConfig() *Config {
 				Persistence:             "none",
 				SnapshotPath:            "./data/memory.snap",
 				SnapshotIntervalSeconds: 300,
+				SnapshotCompression:     "zstd",
 			},
 			AWS: AWSConfig{
 				Region: "us-east-1",
@@ -291,18 +983,45 @@ func applyDefaults(cfg *Config) {
 	if cfg.Server.Region == "" {
 		cfg.Server.Region = "us-east-1"
 	}
+	if cfg.Server.Website.IndexDocument == "" {
+		cfg.Server.Website.IndexDocument = "index.html"
+	}
 	if cfg.Auth.AccessKey == "" {
 		cfg.Auth.AccessKey = "bleepstore"
 	}
 	if cfg.Auth.SecretKey == "" {
 		cfg.Auth.SecretKey = "bleepstore-secret"
 	}
+	if cfg.Auth.Delegation.MaxTTLSeconds == 0 {
+		cfg.Auth.Delegation.MaxTTLSeconds = 86400
+	}
+	if cfg.Auth.ClockSkewSeconds == 0 {
+		cfg.Auth.ClockSkewSeconds = 900
+	}
+	if cfg.Auth.MaxRequestAgeSeconds == 0 {
+		cfg.Auth.MaxRequestAgeSeconds = 900
+	}
+	if cfg.Auth.OIDC.OwnerClaim == "" {
+		cfg.Auth.OIDC.OwnerClaim = "sub"
+	}
+	if cfg.Auth.OIDC.PermissionsClaim == "" {
+		cfg.Auth.OIDC.PermissionsClaim = "scope"
+	}
 	if cfg.Metadata.Engine == "" {
 		cfg.Metadata.Engine = "sqlite"
 	}
 	if cfg.Metadata.SQLite.Path == "" {
 		cfg.Metadata.SQLite.Path = "./data/metadata.db"
 	}
+	if cfg.Metadata.SQLite.Maintenance.CheckpointIntervalSeconds == 0 {
+		cfg.Metadata.SQLite.Maintenance.CheckpointIntervalSeconds = 300
+	}
+	if cfg.Metadata.SQLite.Maintenance.VacuumIntervalSeconds == 0 {
+		cfg.Metadata.SQLite.Maintenance.VacuumIntervalSeconds = 3600
+	}
+	if cfg.Metadata.SQLite.Maintenance.AnalyzeIntervalSeconds == 0 {
+		cfg.Metadata.SQLite.Maintenance.AnalyzeIntervalSeconds = 86400
+	}
 	if cfg.Metadata.Local.RootDir == "" {
 		cfg.Metadata.Local.RootDir = "./data/metadata"
 	}
@@ -312,12 +1031,72 @@ func applyDefaults(cfg *Config) {
 	if cfg.Server.MaxObjectSize == 0 {
 		cfg.Server.MaxObjectSize = 5368709120 // 5 GiB
 	}
+	if cfg.Server.Compression.MinSizeBytes == 0 {
+		cfg.Server.Compression.MinSizeBytes = 1024
+	}
+	if cfg.Server.Compression.MaxSizeBytes == 0 {
+		cfg.Server.Compression.MaxSizeBytes = 1 << 20
+	}
+	if cfg.Server.TLS.ClientAuth.Mode == "" {
+		cfg.Server.TLS.ClientAuth.Mode = "none"
+	}
+	if cfg.Server.TLS.ACME.CacheDir == "" {
+		cfg.Server.TLS.ACME.CacheDir = "./data/acme"
+	}
 	if cfg.Storage.Backend == "" {
 		cfg.Storage.Backend = "local"
 	}
 	if cfg.Storage.Local.RootDir == "" {
 		cfg.Storage.Local.RootDir = "./data/objects"
 	}
+	if cfg.Storage.Local.Naming.Scheme == "" {
+		cfg.Storage.Local.Naming.Scheme = "plain"
+	}
+	if len(cfg.Storage.Local.RootDirs) > 0 && cfg.Storage.Local.PlacementIndex == "" {
+		cfg.Storage.Local.PlacementIndex = filepath.Join(cfg.Storage.Local.RootDirs[0], ".placement", "index.db")
+	}
+	if cfg.Storage.Local.Pack.ThresholdBytes == 0 {
+		cfg.Storage.Local.Pack.ThresholdBytes = 64 * 1024
+	}
+	if cfg.Storage.Local.Pack.SegmentBytes == 0 {
+		cfg.Storage.Local.Pack.SegmentBytes = 256 * 1024 * 1024
+	}
+	if cfg.Storage.Local.Pack.CompactRatio == 0 {
+		cfg.Storage.Local.Pack.CompactRatio = 0.5
+	}
+	if cfg.Storage.Local.Pack.CompactIntervalSeconds == 0 {
+		cfg.Storage.Local.Pack.CompactIntervalSeconds = 3600
+	}
+	if cfg.Storage.Erasure.ParityShards == 0 {
+		cfg.Storage.Erasure.ParityShards = 1
+		if len(cfg.Storage.Erasure.Disks) >= 5 {
+			cfg.Storage.Erasure.ParityShards = 2
+		}
+	}
+	if cfg.Storage.Erasure.BlockSizeBytes == 0 {
+		cfg.Storage.Erasure.BlockSizeBytes = 64 * 1024
+	}
+	if cfg.Storage.Dedup.RootDir == "" {
+		cfg.Storage.Dedup.RootDir = "./data/dedup"
+	}
+	if cfg.Storage.Dedup.GCIntervalSeconds == 0 {
+		cfg.Storage.Dedup.GCIntervalSeconds = 3600
+	}
+	if cfg.Storage.Local.OrphanGC.IntervalSeconds == 0 {
+		cfg.Storage.Local.OrphanGC.IntervalSeconds = 86400
+	}
+	if cfg.Storage.Local.OrphanGC.MinAgeSeconds == 0 {
+		cfg.Storage.Local.OrphanGC.MinAgeSeconds = 3600
+	}
+	if cfg.Storage.Scrub.IntervalSeconds == 0 {
+		cfg.Storage.Scrub.IntervalSeconds = 86400
+	}
+	if cfg.Storage.Scrub.BytesPerSecond == 0 {
+		cfg.Storage.Scrub.BytesPerSecond = 10 * 1024 * 1024
+	}
+	if cfg.Storage.Scrub.RepairSource.Region == "" {
+		cfg.Storage.Scrub.RepairSource.Region = "us-east-1"
+	}
 	if cfg.Storage.Memory.Persistence == "" {
 		cfg.Storage.Memory.Persistence = "none"
 	}
@@ -327,7 +1106,70 @@ func applyDefaults(cfg *Config) {
 	if cfg.Storage.Memory.SnapshotIntervalSeconds == 0 && cfg.Storage.Memory.Persistence == "none" {
 		cfg.Storage.Memory.SnapshotIntervalSeconds = 300
 	}
+	if cfg.Storage.Memory.SnapshotCompression == "" {
+		cfg.Storage.Memory.SnapshotCompression = "zstd"
+	}
 	if cfg.Storage.AWS.Region == "" {
 		cfg.Storage.AWS.Region = "us-east-1"
 	}
+	if cfg.Storage.Defrag.IdleSeconds == 0 {
+		cfg.Storage.Defrag.IdleSeconds = 30
+	}
+	if cfg.Storage.Defrag.IntervalSeconds == 0 {
+		cfg.Storage.Defrag.IntervalSeconds = 60
+	}
+	if cfg.Storage.Prefetch.Workers == 0 {
+		cfg.Storage.Prefetch.Workers = 4
+	}
+	if cfg.Storage.Prefetch.QueueSize == 0 {
+		cfg.Storage.Prefetch.QueueSize = 1024
+	}
+	if cfg.Storage.AdaptiveConcurrency.MinLimit == 0 {
+		cfg.Storage.AdaptiveConcurrency.MinLimit = 1
+	}
+	if cfg.Storage.AdaptiveConcurrency.MaxLimit == 0 {
+		cfg.Storage.AdaptiveConcurrency.MaxLimit = 256
+	}
+	if cfg.Storage.AdaptiveConcurrency.InitialLimit == 0 {
+		cfg.Storage.AdaptiveConcurrency.InitialLimit = min(16, cfg.Storage.AdaptiveConcurrency.MaxLimit)
+	}
+	if cfg.Storage.AdaptiveConcurrency.TargetLatencyMillis == 0 {
+		cfg.Storage.AdaptiveConcurrency.TargetLatencyMillis = 500
+	}
+	if cfg.Observability.Usage.FlushIntervalSeconds == 0 {
+		cfg.Observability.Usage.FlushIntervalSeconds = 60
+	}
+	if cfg.BucketReplication.Region == "" {
+		cfg.BucketReplication.Region = "us-east-1"
+	}
+	if cfg.BucketReplication.PollIntervalMillis == 0 {
+		cfg.BucketReplication.PollIntervalMillis = 1000
+	}
+	if cfg.BucketReplication.MaxAttempts == 0 {
+		cfg.BucketReplication.MaxAttempts = 10
+	}
+	if cfg.BucketReplication.Verify.ReportPrefix == "" {
+		cfg.BucketReplication.Verify.ReportPrefix = "replication-verify/"
+	}
+	if cfg.BucketReplication.Verify.SampleRate == 0 {
+		cfg.BucketReplication.Verify.SampleRate = 1
+	}
+	if cfg.Inventory.CheckIntervalSeconds == 0 {
+		cfg.Inventory.CheckIntervalSeconds = 3600
+	}
+	if cfg.BackupHooks.DrainTimeoutMillis == 0 {
+		cfg.BackupHooks.DrainTimeoutMillis = 30000
+	}
+	if cfg.BackupHooks.MaxQuiesceMillis == 0 {
+		cfg.BackupHooks.MaxQuiesceMillis = 600000
+	}
+	if cfg.HA.LeaseTTLMillis == 0 {
+		cfg.HA.LeaseTTLMillis = 15000
+	}
+	if cfg.HA.RenewIntervalMillis == 0 {
+		cfg.HA.RenewIntervalMillis = 5000
+	}
+	if cfg.BackupHooks.MarkerPath == "" {
+		cfg.BackupHooks.MarkerPath = filepath.Join(filepath.Dir(cfg.Metadata.SQLite.Path), "backup-marker.json")
+	}
 }
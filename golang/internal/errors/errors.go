@@ -96,6 +96,14 @@ var (
 		HTTPStatus: 400,
 	}
 
+	// ErrInvalidPartNumber is returned when a GET or HEAD names a part
+	// beyond the object's part count.
+	ErrInvalidPartNumber = &S3Error{
+		Code:       "InvalidPartNumber",
+		Message:    "The requested partnumber is not satisfiable",
+		HTTPStatus: 416,
+	}
+
 	// ErrInvalidPartOrder is returned when parts are not in ascending order.
 	ErrInvalidPartOrder = &S3Error{
 		Code:       "InvalidPartOrder",
@@ -201,6 +209,29 @@ var (
 		HTTPStatus: 503,
 	}
 
+	// ErrSlowDown is returned when the caller exceeds the configured request rate.
+	ErrSlowDown = &S3Error{
+		Code:       "SlowDown",
+		Message:    "Please reduce your request rate.",
+		HTTPStatus: 503,
+	}
+
+	// ErrAuthorizationHeaderMalformed is returned when the Authorization
+	// header's credential scope names a region the server does not accept.
+	ErrAuthorizationHeaderMalformed = &S3Error{
+		Code:       "AuthorizationHeaderMalformed",
+		Message:    "The authorization header is malformed; the region is wrong.",
+		HTTPStatus: 400,
+	}
+
+	// ErrAuthorizationQueryParametersError is returned when a presigned URL's
+	// credential scope names a region the server does not accept.
+	ErrAuthorizationQueryParametersError = &S3Error{
+		Code:       "AuthorizationQueryParametersError",
+		Message:    "Error parsing the X-Amz-Credential parameter; the region is wrong.",
+		HTTPStatus: 400,
+	}
+
 	// ErrKeyTooLongError is returned when the object key exceeds the maximum length.
 	ErrKeyTooLongError = &S3Error{
 		Code:       "KeyTooLongError",
@@ -222,6 +253,14 @@ var (
 		HTTPStatus: 400,
 	}
 
+	// ErrXAmzContentSHA256Mismatch is returned when the x-amz-content-sha256
+	// header does not match the body.
+	ErrXAmzContentSHA256Mismatch = &S3Error{
+		Code:       "XAmzContentSHA256Mismatch",
+		Message:    "The provided 'x-amz-content-sha256' header does not match what was computed",
+		HTTPStatus: 400,
+	}
+
 	// ErrIncompleteBody is returned when the body is shorter than Content-Length.
 	ErrIncompleteBody = &S3Error{
 		Code:       "IncompleteBody",
@@ -270,4 +309,42 @@ var (
 		Message:    "Your socket connection to the server was not read from or written to within the timeout period",
 		HTTPStatus: 400,
 	}
+
+	// ErrQuotaExceeded is returned when a write would exceed a prefix quota.
+	ErrQuotaExceeded = &S3Error{
+		Code:       "QuotaExceeded",
+		Message:    "The write would exceed the quota configured for this prefix",
+		HTTPStatus: 403,
+	}
+
+	// ErrBucketFrozen is returned for a write or delete in a frozen bucket.
+	ErrBucketFrozen = &S3Error{
+		Code:       "BucketFrozen",
+		Message:    "The bucket is frozen; its objects can be read but not written or deleted",
+		HTTPStatus: 403,
+	}
+
+	// ErrReplicationConfigurationNotFound is returned when a bucket has no
+	// replication configuration.
+	ErrReplicationConfigurationNotFound = &S3Error{
+		Code:       "ReplicationConfigurationNotFoundError",
+		Message:    "The replication configuration was not found",
+		HTTPStatus: 404,
+	}
+
+	// ErrNoSuchConfiguration is returned when a bucket has no inventory
+	// configuration with the requested ID.
+	ErrNoSuchConfiguration = &S3Error{
+		Code:       "NoSuchConfiguration",
+		Message:    "The specified configuration does not exist",
+		HTTPStatus: 404,
+	}
+
+	// ErrNoSuchWebsiteConfiguration is returned when a bucket has no
+	// website configuration.
+	ErrNoSuchWebsiteConfiguration = &S3Error{
+		Code:       "NoSuchWebsiteConfiguration",
+		Message:    "The specified bucket does not have a website configuration",
+		HTTPStatus: 404,
+	}
 )
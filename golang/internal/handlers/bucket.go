@@ -4,15 +4,19 @@ package handlers
 import (
 	"context"
 	"encoding/xml"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
-	"time"
 
+	"github.com/bleepstore/bleepstore/internal/clock"
 	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/inventory"
 	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/replication"
 	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/website"
 	"github.com/bleepstore/bleepstore/internal/xmlutil"
 )
 
@@ -23,6 +27,13 @@ type BucketHandler struct {
 	ownerID      string
 	ownerDisplay string
 	region       string
+
+	// bucketRegions overrides the advertised region of individual buckets.
+	bucketRegions map[string]string
+	clock         clock.Clock
+	replication   *replication.Rules
+	inventory     *inventory.Configs
+	websites      metadata.WebsiteStore
 }
 
 // NewBucketHandler creates a new BucketHandler with the given dependencies.
@@ -33,9 +44,52 @@ func NewBucketHandler(meta metadata.MetadataStore, store storage.StorageBackend,
 		ownerID:      ownerID,
 		ownerDisplay: ownerDisplay,
 		region:       region,
+		clock:        clock.System{},
 	}
 }
 
+// SetClock replaces the clock used for bucket creation times.
+func (h *BucketHandler) SetClock(c clock.Clock) {
+	h.clock = c
+}
+
+// SetBucketRegions overrides the region advertised by GetBucketLocation,
+// HeadBucket and ListBuckets for the named buckets.
+func (h *BucketHandler) SetBucketRegions(regions map[string]string) {
+	h.bucketRegions = regions
+}
+
+// SetReplication serves the bucket replication operations from rules.
+// Passing nil makes them return NotImplemented.
+func (h *BucketHandler) SetReplication(rules *replication.Rules) {
+	h.replication = rules
+}
+
+// SetInventory serves the bucket inventory operations from configs.
+// Passing nil makes them return NotImplemented.
+func (h *BucketHandler) SetInventory(configs *inventory.Configs) {
+	h.inventory = configs
+}
+
+// SetWebsite serves the bucket website operations from store. Passing nil
+// makes them return NotImplemented.
+func (h *BucketHandler) SetWebsite(store metadata.WebsiteStore) {
+	h.websites = store
+}
+
+// advertisedRegion returns the region reported to clients for a bucket:
+// the configured override, else the region recorded at creation, else the
+// server default.
+func (h *BucketHandler) advertisedRegion(bucket *metadata.BucketRecord) string {
+	if r, ok := h.bucketRegions[bucket.Name]; ok && r != "" {
+		return r
+	}
+	if bucket.Region != "" {
+		return bucket.Region
+	}
+	return h.region
+}
+
 // ListBuckets handles GET / and returns a list of all buckets owned by the
 // authenticated sender of the request.
 func (h *BucketHandler) ListBuckets(w http.ResponseWriter, r *http.Request) {
@@ -58,6 +112,7 @@ func (h *BucketHandler) ListBuckets(w http.ResponseWriter, r *http.Request) {
 		xmlBuckets = append(xmlBuckets, xmlutil.Bucket{
 			Name:         b.Name,
 			CreationDate: xmlutil.FormatTimeS3(b.CreatedAt),
+			BucketRegion: h.advertisedRegion(&b),
 		})
 	}
 
@@ -81,7 +136,8 @@ func (h *BucketHandler) CreateBucket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
+	rc := requestContext(r)
+	bucketName := rc.Bucket
 
 	// Validate bucket name.
 	if errMsg := validateBucketName(bucketName); errMsg != "" {
@@ -89,26 +145,14 @@ func (h *BucketHandler) CreateBucket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse optional canned ACL from header.
-	cannedACL := r.Header.Get("x-amz-acl")
-
-	// Validate mutually exclusive ACL modes: canned ACL and grant headers
-	// cannot be specified together.
-	if cannedACL != "" && hasGrantHeaders(r.Header) {
-		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
-			Code:       "InvalidArgument",
-			Message:    "Specifying both x-amz-acl and x-amz-grant headers is not allowed",
-			HTTPStatus: 400,
-		})
+	// Build ACL from grant headers, canned ACL, or default private.
+	acp, aclErr := aclFromHeaders(r.Header, h.ownerID, h.ownerDisplay)
+	if aclErr != nil {
+		xmlutil.WriteErrorResponse(w, r, aclErr)
 		return
 	}
-
-	// Build ACL from grant headers, canned ACL, or default private.
-	var acp *xmlutil.AccessControlPolicy
-	if hasGrantHeaders(r.Header) {
-		acp = parseGrantHeaders(r.Header, h.ownerID, h.ownerDisplay)
-	} else {
-		acp = parseCannedACL(cannedACL, h.ownerID, h.ownerDisplay)
+	if acp == nil {
+		acp = parseCannedACL("private", h.ownerID, h.ownerDisplay)
 	}
 	aclJSON := aclToJSON(acp)
 
@@ -149,7 +193,7 @@ func (h *BucketHandler) CreateBucket(w http.ResponseWriter, r *http.Request) {
 		OwnerID:      h.ownerID,
 		OwnerDisplay: h.ownerDisplay,
 		ACL:          aclJSON,
-		CreatedAt:    time.Now().UTC(),
+		CreatedAt:    h.clock.Now().UTC(),
 	}
 
 	if err := h.meta.CreateBucket(ctx, record); err != nil {
@@ -184,7 +228,8 @@ func (h *BucketHandler) DeleteBucket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
+	rc := requestContext(r)
+	bucketName := rc.Bucket
 
 	// Delete from metadata store (validates existence and emptiness).
 	if err := h.meta.DeleteBucket(ctx, bucketName); err != nil {
@@ -201,6 +246,9 @@ func (h *BucketHandler) DeleteBucket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.replication.Forget(bucketName)
+	h.inventory.Forget(bucketName)
+
 	// Remove bucket directory from storage backend (best effort).
 	if err := h.store.DeleteBucket(ctx, bucketName); err != nil {
 		slog.Error("DeleteBucket storage cleanup error", "error", err)
@@ -218,7 +266,8 @@ func (h *BucketHandler) HeadBucket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
+	rc := requestContext(r)
+	bucketName := rc.Bucket
 
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
 	if err != nil {
@@ -233,7 +282,7 @@ func (h *BucketHandler) HeadBucket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("x-amz-bucket-region", bucket.Region)
+	w.Header().Set("x-amz-bucket-region", h.advertisedRegion(bucket))
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -246,7 +295,8 @@ func (h *BucketHandler) GetBucketLocation(w http.ResponseWriter, r *http.Request
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
+	rc := requestContext(r)
+	bucketName := rc.Bucket
 
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
 	if err != nil {
@@ -261,7 +311,7 @@ func (h *BucketHandler) GetBucketLocation(w http.ResponseWriter, r *http.Request
 	}
 
 	// us-east-1 quirk: return empty LocationConstraint (effectively null).
-	location := bucket.Region
+	location := h.advertisedRegion(bucket)
 	if location == "us-east-1" {
 		location = ""
 	}
@@ -278,7 +328,8 @@ func (h *BucketHandler) GetBucketAcl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
+	rc := requestContext(r)
+	bucketName := rc.Bucket
 
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
 	if err != nil {
@@ -317,7 +368,8 @@ func (h *BucketHandler) PutBucketAcl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
+	rc := requestContext(r)
+	bucketName := rc.Bucket
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -332,31 +384,16 @@ func (h *BucketHandler) PutBucketAcl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate mutually exclusive ACL modes: canned ACL and grant headers
-	// cannot be specified together.
-	cannedACL := r.Header.Get("x-amz-acl")
-	if cannedACL != "" && hasGrantHeaders(r.Header) {
-		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
-			Code:       "InvalidArgument",
-			Message:    "Specifying both x-amz-acl and x-amz-grant headers is not allowed",
-			HTTPStatus: 400,
-		})
-		return
-	}
-
-	var acp *xmlutil.AccessControlPolicy
-
 	// Three mutually exclusive modes:
 	// 1. Canned ACL via x-amz-acl header
 	// 2. Explicit grants via x-amz-grant-* headers
 	// 3. XML body
-	if cannedACL != "" {
-		// Mode 1: Canned ACL.
-		acp = parseCannedACL(cannedACL, bucket.OwnerID, bucket.OwnerDisplay)
-	} else if hasGrantHeaders(r.Header) {
-		// Mode 2: Explicit grants via x-amz-grant-* headers.
-		acp = parseGrantHeaders(r.Header, bucket.OwnerID, bucket.OwnerDisplay)
-	} else if r.ContentLength > 0 {
+	acp, aclErr := aclFromHeaders(r.Header, bucket.OwnerID, bucket.OwnerDisplay)
+	if aclErr != nil {
+		xmlutil.WriteErrorResponse(w, r, aclErr)
+		return
+	}
+	if acp == nil && r.ContentLength > 0 {
 		// Mode 3: XML body.
 		body, readErr := io.ReadAll(io.LimitReader(r.Body, 1<<20)) // 1 MB max
 		if readErr != nil {
@@ -368,10 +405,11 @@ func (h *BucketHandler) PutBucketAcl(w http.ResponseWriter, r *http.Request) {
 			xmlutil.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
 			return
 		}
-	} else {
+	} else if acp == nil {
 		// No canned ACL, no grant headers, and no body: default to private.
 		acp = parseCannedACL("private", bucket.OwnerID, bucket.OwnerDisplay)
 	}
+	acp.Owner = xmlutil.Owner{ID: bucket.OwnerID, DisplayName: bucket.OwnerDisplay}
 
 	// Store the ACL.
 	aclJSON := aclToJSON(acp)
@@ -384,6 +422,343 @@ func (h *BucketHandler) PutBucketAcl(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// replicationBucket checks the preconditions of the bucket replication
+// operations and reports whether the bucket exists, writing the error
+// response otherwise.
+func (h *BucketHandler) replicationBucket(w http.ResponseWriter, r *http.Request, op string) bool {
+	if h.replication == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return false
+	}
+	exists, err := h.meta.BucketExists(r.Context(), requestContext(r).Bucket)
+	if err != nil {
+		slog.Error(op+" error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return false
+	}
+	if !exists {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return false
+	}
+	return true
+}
+
+// PutBucketReplication handles PUT /{bucket}?replication and sets the rules
+// that queue the bucket's new writes and deletes for replication.
+func (h *BucketHandler) PutBucketReplication(w http.ResponseWriter, r *http.Request) {
+	if !h.replicationBucket(w, r, "PutBucketReplication") {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20)) // 1 MB max
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
+		return
+	}
+	cfg := &xmlutil.ReplicationConfiguration{}
+	if err := xml.Unmarshal(body, cfg); err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
+		return
+	}
+	cfg.Xmlns = ""
+
+	if err := h.replication.Put(r.Context(), requestContext(r).Bucket, cfg); err != nil {
+		if errors.Is(err, replication.ErrInvalidConfig) {
+			xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+				Code:       "InvalidRequest",
+				Message:    err.Error(),
+				HTTPStatus: 400,
+			})
+			return
+		}
+		slog.Error("PutBucketReplication error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetBucketReplication handles GET /{bucket}?replication and returns the
+// bucket's replication configuration.
+func (h *BucketHandler) GetBucketReplication(w http.ResponseWriter, r *http.Request) {
+	if !h.replicationBucket(w, r, "GetBucketReplication") {
+		return
+	}
+	cfg := h.replication.Get(requestContext(r).Bucket)
+	if cfg == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrReplicationConfigurationNotFound)
+		return
+	}
+	xmlutil.RenderReplicationConfiguration(w, cfg)
+}
+
+// DeleteBucketReplication handles DELETE /{bucket}?replication and removes
+// the bucket's replication configuration.
+func (h *BucketHandler) DeleteBucketReplication(w http.ResponseWriter, r *http.Request) {
+	if !h.replicationBucket(w, r, "DeleteBucketReplication") {
+		return
+	}
+	if err := h.replication.Delete(r.Context(), requestContext(r).Bucket); err != nil {
+		slog.Error("DeleteBucketReplication error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inventoryListPageSize is the number of configurations returned per
+// ListBucketInventoryConfigurations page, as in S3.
+const inventoryListPageSize = 100
+
+// inventoryBucket checks the preconditions of the bucket inventory
+// operations and reports whether the bucket exists, writing the error
+// response otherwise.
+func (h *BucketHandler) inventoryBucket(w http.ResponseWriter, r *http.Request, op string) bool {
+	if h.inventory == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return false
+	}
+	exists, err := h.meta.BucketExists(r.Context(), requestContext(r).Bucket)
+	if err != nil {
+		slog.Error(op+" error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return false
+	}
+	if !exists {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return false
+	}
+	return true
+}
+
+// inventoryID returns the "id" query parameter, writing an error response
+// and returning "" if it is missing.
+func inventoryID(w http.ResponseWriter, r *http.Request) string {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "InvalidArgument",
+			Message:    "The inventory configuration ID is required",
+			HTTPStatus: 400,
+		})
+	}
+	return id
+}
+
+// PutBucketInventoryConfiguration handles PUT /{bucket}?inventory&id= and
+// sets an inventory configuration, which schedules reports listing the
+// bucket's objects into its destination bucket.
+func (h *BucketHandler) PutBucketInventoryConfiguration(w http.ResponseWriter, r *http.Request) {
+	if !h.inventoryBucket(w, r, "PutBucketInventoryConfiguration") {
+		return
+	}
+	id := inventoryID(w, r)
+	if id == "" {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20)) // 1 MB max
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
+		return
+	}
+	cfg := &xmlutil.InventoryConfiguration{}
+	if err := xml.Unmarshal(body, cfg); err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
+		return
+	}
+	cfg.Xmlns = ""
+	if cfg.ID != id {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "InvalidArgument",
+			Message:    "The configuration ID does not match the id query parameter",
+			HTTPStatus: 400,
+		})
+		return
+	}
+
+	if err := h.inventory.Put(r.Context(), requestContext(r).Bucket, cfg); err != nil {
+		if errors.Is(err, inventory.ErrInvalidConfig) {
+			xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+				Code:       "InvalidArgument",
+				Message:    err.Error(),
+				HTTPStatus: 400,
+			})
+			return
+		}
+		slog.Error("PutBucketInventoryConfiguration error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetBucketInventoryConfiguration handles GET /{bucket}?inventory&id= and
+// returns one inventory configuration.
+func (h *BucketHandler) GetBucketInventoryConfiguration(w http.ResponseWriter, r *http.Request) {
+	if !h.inventoryBucket(w, r, "GetBucketInventoryConfiguration") {
+		return
+	}
+	id := inventoryID(w, r)
+	if id == "" {
+		return
+	}
+	cfg := h.inventory.Get(requestContext(r).Bucket, id)
+	if cfg == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchConfiguration)
+		return
+	}
+	xmlutil.RenderInventoryConfiguration(w, cfg)
+}
+
+// ListBucketInventoryConfigurations handles GET /{bucket}?inventory and
+// returns the bucket's inventory configurations ordered by ID, 100 at a
+// time. The continuation token is the last ID of the previous page.
+func (h *BucketHandler) ListBucketInventoryConfigurations(w http.ResponseWriter, r *http.Request) {
+	if !h.inventoryBucket(w, r, "ListBucketInventoryConfigurations") {
+		return
+	}
+	token := r.URL.Query().Get("continuation-token")
+	result := &xmlutil.ListInventoryConfigurationsResult{ContinuationToken: token}
+	for _, cfg := range h.inventory.List(requestContext(r).Bucket) {
+		if token != "" && cfg.ID <= token {
+			continue
+		}
+		if len(result.InventoryConfigurations) == inventoryListPageSize {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.InventoryConfigurations[inventoryListPageSize-1].ID
+			break
+		}
+		result.InventoryConfigurations = append(result.InventoryConfigurations, *cfg)
+	}
+	xmlutil.RenderListInventoryConfigurationsResult(w, result)
+}
+
+// DeleteBucketInventoryConfiguration handles DELETE /{bucket}?inventory&id=
+// and removes an inventory configuration. Reports already written are kept.
+func (h *BucketHandler) DeleteBucketInventoryConfiguration(w http.ResponseWriter, r *http.Request) {
+	if !h.inventoryBucket(w, r, "DeleteBucketInventoryConfiguration") {
+		return
+	}
+	id := inventoryID(w, r)
+	if id == "" {
+		return
+	}
+	bucket := requestContext(r).Bucket
+	if h.inventory.Get(bucket, id) == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchConfiguration)
+		return
+	}
+	if err := h.inventory.Delete(r.Context(), bucket, id); err != nil {
+		slog.Error("DeleteBucketInventoryConfiguration error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// websiteBucket checks the preconditions of the bucket website operations
+// and reports whether the bucket exists, writing the error response
+// otherwise.
+func (h *BucketHandler) websiteBucket(w http.ResponseWriter, r *http.Request, op string) bool {
+	if h.websites == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return false
+	}
+	exists, err := h.meta.BucketExists(r.Context(), requestContext(r).Bucket)
+	if err != nil {
+		slog.Error(op+" error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return false
+	}
+	if !exists {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return false
+	}
+	return true
+}
+
+// PutBucketWebsite handles PUT /{bucket}?website and sets how the website
+// endpoint serves the bucket.
+func (h *BucketHandler) PutBucketWebsite(w http.ResponseWriter, r *http.Request) {
+	if !h.websiteBucket(w, r, "PutBucketWebsite") {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20)) // 1 MB max
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
+		return
+	}
+	cfg := &xmlutil.WebsiteConfiguration{}
+	if err := xml.Unmarshal(body, cfg); err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
+		return
+	}
+	cfg.Xmlns = ""
+	if err := website.Validate(cfg); err != nil {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "InvalidArgument",
+			Message:    err.Error(),
+			HTTPStatus: 400,
+		})
+		return
+	}
+
+	doc, err := xml.Marshal(cfg)
+	if err == nil {
+		err = h.websites.PutBucketWebsite(r.Context(), requestContext(r).Bucket, doc)
+	}
+	if err != nil {
+		slog.Error("PutBucketWebsite error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetBucketWebsite handles GET /{bucket}?website and returns the bucket's
+// website configuration.
+func (h *BucketHandler) GetBucketWebsite(w http.ResponseWriter, r *http.Request) {
+	if !h.websiteBucket(w, r, "GetBucketWebsite") {
+		return
+	}
+	doc, err := h.websites.GetBucketWebsite(r.Context(), requestContext(r).Bucket)
+	if err != nil {
+		slog.Error("GetBucketWebsite error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	if doc == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchWebsiteConfiguration)
+		return
+	}
+	cfg := &xmlutil.WebsiteConfiguration{}
+	if err := xml.Unmarshal(doc, cfg); err != nil {
+		slog.Error("GetBucketWebsite error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	xmlutil.RenderWebsiteConfiguration(w, cfg)
+}
+
+// DeleteBucketWebsite handles DELETE /{bucket}?website and removes the
+// bucket's website configuration.
+func (h *BucketHandler) DeleteBucketWebsite(w http.ResponseWriter, r *http.Request) {
+	if !h.websiteBucket(w, r, "DeleteBucketWebsite") {
+		return
+	}
+	if err := h.websites.DeleteBucketWebsite(r.Context(), requestContext(r).Bucket); err != nil {
+		slog.Error("DeleteBucketWebsite error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // parseCreateBucketRegion parses a CreateBucketConfiguration XML body to
 // extract the LocationConstraint value. Returns the default region if
 // parsing fails or no LocationConstraint is specified.
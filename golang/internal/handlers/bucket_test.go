@@ -298,6 +298,40 @@ func TestGetBucketLocation(t *testing.T) {
 	}
 }
 
+func TestGetBucketLocationOverride(t *testing.T) {
+	h := newTestBucketHandler(t)
+	h.SetBucketRegions(map[string]string{"eu-bucket": "eu-west-1"})
+
+	req := httptest.NewRequest("PUT", "/eu-bucket", nil)
+	rec := httptest.NewRecorder()
+	h.CreateBucket(rec, req)
+
+	req = httptest.NewRequest("GET", "/eu-bucket?location", nil)
+	rec = httptest.NewRecorder()
+	h.GetBucketLocation(rec, req)
+	var loc xmlutil.LocationConstraint
+	if err := xml.Unmarshal(rec.Body.Bytes(), &loc); err != nil {
+		t.Fatalf("Failed to parse LocationConstraint XML: %v", err)
+	}
+	if loc.Location != "eu-west-1" {
+		t.Errorf("Location = %q, want eu-west-1", loc.Location)
+	}
+
+	req = httptest.NewRequest("HEAD", "/eu-bucket", nil)
+	rec = httptest.NewRecorder()
+	h.HeadBucket(rec, req)
+	if got := rec.Header().Get("x-amz-bucket-region"); got != "eu-west-1" {
+		t.Errorf("x-amz-bucket-region = %q, want eu-west-1", got)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	rec = httptest.NewRecorder()
+	h.ListBuckets(rec, req)
+	if !strings.Contains(rec.Body.String(), "<BucketRegion>eu-west-1</BucketRegion>") {
+		t.Errorf("ListBuckets body missing BucketRegion: %s", rec.Body.String())
+	}
+}
+
 func TestGetBucketLocationNotFound(t *testing.T) {
 	h := newTestBucketHandler(t)
 
@@ -375,6 +409,61 @@ func TestPutBucketAclCanned(t *testing.T) {
 	}
 }
 
+func TestPutBucketAclGrantHeaders(t *testing.T) {
+	h := newTestBucketHandler(t)
+
+	req := httptest.NewRequest("PUT", "/my-test-bucket", nil)
+	rec := httptest.NewRecorder()
+	h.CreateBucket(rec, req)
+
+	req = httptest.NewRequest("PUT", "/my-test-bucket?acl", nil)
+	req.Header.Set("x-amz-grant-read", `id="alice", uri="http://acs.amazonaws.com/groups/global/AuthenticatedUsers"`)
+	req.Header.Set("x-amz-grant-write-acp", `id="bob"`)
+	rec = httptest.NewRecorder()
+	h.PutBucketAcl(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PutBucketAcl status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/my-test-bucket?acl", nil)
+	rec = httptest.NewRecorder()
+	h.GetBucketAcl(rec, req)
+	body := rec.Body.String()
+	for _, want := range []string{"<ID>alice</ID>", "AuthenticatedUsers", "<ID>bob</ID>", "WRITE_ACP"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("ACL missing %q: %s", want, body)
+		}
+	}
+}
+
+func TestBucketAclHeaderErrors(t *testing.T) {
+	h := newTestBucketHandler(t)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+	}{
+		{"unknown canned", map[string]string{"x-amz-acl": "world-writable"}},
+		{"canned and grants", map[string]string{"x-amz-acl": "private", "x-amz-grant-read": `id="alice"`}},
+		{"malformed grantee", map[string]string{"x-amz-grant-read": "alice"}},
+		{"unknown grantee type", map[string]string{"x-amz-grant-read": `arn="alice"`}},
+		{"unknown group", map[string]string{"x-amz-grant-read": `uri="http://acs.amazonaws.com/groups/global/Everyone"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/acl-errors", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.CreateBucket(rec, req)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "InvalidArgument") {
+				t.Errorf("CreateBucket status = %d, want 400 InvalidArgument; body: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
 func TestParseCannedACL(t *testing.T) {
 	tests := []struct {
 		cannedACL  string
@@ -385,6 +474,9 @@ func TestParseCannedACL(t *testing.T) {
 		{"public-read", 2, []string{"FULL_CONTROL", "READ"}},
 		{"public-read-write", 3, []string{"FULL_CONTROL", "READ", "WRITE"}},
 		{"authenticated-read", 2, []string{"FULL_CONTROL", "READ"}},
+		{"bucket-owner-read", 1, []string{"FULL_CONTROL"}},
+		{"bucket-owner-full-control", 1, []string{"FULL_CONTROL"}},
+		{"log-delivery-write", 3, []string{"FULL_CONTROL", "WRITE", "READ_ACP"}},
 	}
 
 	for _, tt := range tests {
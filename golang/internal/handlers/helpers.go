@@ -2,24 +2,161 @@
 package handlers
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	s3err "github.com/bleepstore/bleepstore/internal/errors"
 	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/quota"
+	"github.com/bleepstore/bleepstore/internal/replication"
+	"github.com/bleepstore/bleepstore/internal/storage"
 	"github.com/bleepstore/bleepstore/internal/xmlutil"
 )
 
+// openObjectData opens obj's payload: from the metadata row for an inline
+// object, otherwise from the storage backend, decompressing data stored
+// compressed.
+func openObjectData(ctx context.Context, store storage.StorageBackend, obj *metadata.ObjectRecord) (io.ReadCloser, error) {
+	if obj.InlineData != nil {
+		return inlineReader{bytes.NewReader(obj.InlineData)}, nil
+	}
+	reader, _, _, err := store.GetObject(ctx, obj.Bucket, obj.Key)
+	if err != nil || obj.Compression == "" {
+		return reader, err
+	}
+	return storage.NewDecompressReader(obj.Compression, reader)
+}
+
+// prefetchHeader lists keys in the same bucket that a client expects to GET
+// next, comma-separated and each URL-encoded.
+const prefetchHeader = "x-bleepstore-prefetch"
+
+// maxPrefetchKeys bounds the keys taken from one prefetch header.
+const maxPrefetchKeys = 64
+
+// parsePrefetchHeader returns the keys named in a prefetch header value,
+// skipping self (the key being read), empty entries, and entries that are
+// not valid URL encoding. Keys beyond maxPrefetchKeys are ignored.
+func parsePrefetchHeader(value, self string) []string {
+	if value == "" {
+		return nil
+	}
+	var keys []string
+	for _, part := range strings.Split(value, ",") {
+		key, err := url.PathUnescape(strings.TrimSpace(part))
+		if err != nil || key == "" || key == self {
+			continue
+		}
+		keys = append(keys, key)
+		if len(keys) == maxPrefetchKeys {
+			break
+		}
+	}
+	return keys
+}
+
+// maxPartNumber is the highest part number S3 accepts.
+const maxPartNumber = 10000
+
+// objectPart is the byte range of one part of an object, selected by a
+// ?partNumber=N GET or HEAD.
+type objectPart struct {
+	start, size int64
+	// count is the object's number of parts, or 0 if its part boundaries
+	// are not recorded and it is served as a single part.
+	count int
+}
+
+// requestedPart resolves the request's partNumber query parameter against
+// obj. It returns nil if the parameter is absent. Parts are numbered 1..n
+// in the order they were completed, which is what clients iterate when
+// downloading parts in parallel. An object without recorded part sizes
+// (not multipart, or completed before sizes were recorded) has one part.
+func requestedPart(r *http.Request, obj *metadata.ObjectRecord) (*objectPart, *s3err.S3Error) {
+	v := requestContext(r).Query.Get("partNumber")
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxPartNumber {
+		return nil, s3err.ErrInvalidArgument
+	}
+	if r.Header.Get("Range") != "" {
+		// S3 rejects a request naming both a range and a part.
+		return nil, s3err.ErrInvalidRequest
+	}
+	if len(obj.PartSizes) == 0 {
+		if n != 1 {
+			return nil, s3err.ErrInvalidPartNumber
+		}
+		return &objectPart{size: obj.Size}, nil
+	}
+	if n > len(obj.PartSizes) {
+		return nil, s3err.ErrInvalidPartNumber
+	}
+	part := &objectPart{size: obj.PartSizes[n-1], count: len(obj.PartSizes)}
+	for _, size := range obj.PartSizes[:n-1] {
+		part.start += size
+	}
+	return part, nil
+}
+
+// setHeaders sets the Content-Length, Content-Range and
+// x-amz-mp-parts-count headers for p of an object of total bytes, and
+// returns the status code to send.
+func (p *objectPart) setHeaders(w http.ResponseWriter, total int64) int {
+	w.Header().Set("Content-Length", strconv.FormatInt(p.size, 10))
+	if p.count > 0 {
+		w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(p.count))
+	}
+	if p.size == 0 {
+		return http.StatusOK
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", p.start, p.start+p.size-1, total))
+	return http.StatusPartialContent
+}
+
+// skipTo advances reader to offset start, seeking if it can and otherwise
+// discarding bytes.
+func skipTo(reader io.Reader, start int64) error {
+	if start == 0 {
+		return nil
+	}
+	if seeker, ok := reader.(io.Seeker); ok {
+		_, err := seeker.Seek(start, io.SeekStart)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, reader, start)
+	return err
+}
+
+// inlineReader serves an inline payload; it stays seekable for ranges.
+type inlineReader struct {
+	*bytes.Reader
+}
+
+func (inlineReader) Close() error { return nil }
+
 // bucketNameRegex validates bucket names per S3 naming rules:
 // - 3-63 characters
 // - Lowercase letters, numbers, hyphens, and periods only
@@ -89,8 +226,26 @@ func defaultPrivateACL(ownerID, ownerDisplay string) json.RawMessage {
 	return data
 }
 
+// ACL group grantee URIs.
+const (
+	allUsersURI           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	authenticatedUsersURI = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	logDeliveryURI        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+// cannedACLs are the canned ACL names x-amz-acl accepts.
+var cannedACLs = []string{
+	"private", "public-read", "public-read-write", "authenticated-read", "aws-exec-read",
+	"bucket-owner-read", "bucket-owner-full-control", "log-delivery-write",
+}
+
 // parseCannedACL converts a canned ACL name into an AccessControlPolicy
-// with the appropriate grants for the given owner.
+// with the appropriate grants for the given owner. bucket-owner-read and
+// bucket-owner-full-control give the owner's FULL_CONTROL alone, as in S3
+// when the writer owns the bucket; addBucketOwnerGrant adds the bucket
+// owner's grant otherwise. aws-exec-read is private here, since EC2 is not
+// a principal. Callers validate the name; an unknown one gets the private
+// ACL.
 func parseCannedACL(cannedACL, ownerID, ownerDisplay string) *xmlutil.AccessControlPolicy {
 	acp := &xmlutil.AccessControlPolicy{
 		Owner: xmlutil.Owner{
@@ -107,82 +262,41 @@ func parseCannedACL(cannedACL, ownerID, ownerDisplay string) *xmlutil.AccessCont
 		},
 		Permission: "FULL_CONTROL",
 	}
+	group := func(uri, permission string) xmlutil.Grant {
+		return xmlutil.Grant{Grantee: xmlutil.Grantee{Type: "Group", URI: uri}, Permission: permission}
+	}
 
+	grants := []xmlutil.Grant{ownerGrant}
 	switch cannedACL {
-	case "private", "":
-		acp.AccessControlList = xmlutil.ACL{
-			Grants: []xmlutil.Grant{ownerGrant},
-		}
 	case "public-read":
-		acp.AccessControlList = xmlutil.ACL{
-			Grants: []xmlutil.Grant{
-				ownerGrant,
-				{
-					Grantee: xmlutil.Grantee{
-						Type: "Group",
-						URI:  "http://acs.amazonaws.com/groups/global/AllUsers",
-					},
-					Permission: "READ",
-				},
-			},
-		}
+		grants = append(grants, group(allUsersURI, "READ"))
 	case "public-read-write":
-		acp.AccessControlList = xmlutil.ACL{
-			Grants: []xmlutil.Grant{
-				ownerGrant,
-				{
-					Grantee: xmlutil.Grantee{
-						Type: "Group",
-						URI:  "http://acs.amazonaws.com/groups/global/AllUsers",
-					},
-					Permission: "READ",
-				},
-				{
-					Grantee: xmlutil.Grantee{
-						Type: "Group",
-						URI:  "http://acs.amazonaws.com/groups/global/AllUsers",
-					},
-					Permission: "WRITE",
-				},
-			},
-		}
+		grants = append(grants, group(allUsersURI, "READ"), group(allUsersURI, "WRITE"))
 	case "authenticated-read":
-		acp.AccessControlList = xmlutil.ACL{
-			Grants: []xmlutil.Grant{
-				ownerGrant,
-				{
-					Grantee: xmlutil.Grantee{
-						Type: "Group",
-						URI:  "http://acs.amazonaws.com/groups/global/AuthenticatedUsers",
-					},
-					Permission: "READ",
-				},
-			},
-		}
-	default:
-		// Unknown canned ACL: fall back to private.
-		acp.AccessControlList = xmlutil.ACL{
-			Grants: []xmlutil.Grant{ownerGrant},
-		}
+		grants = append(grants, group(authenticatedUsersURI, "READ"))
+	case "log-delivery-write":
+		grants = append(grants, group(logDeliveryURI, "WRITE"), group(logDeliveryURI, "READ_ACP"))
 	}
-
+	acp.AccessControlList = xmlutil.ACL{Grants: grants}
 	return acp
 }
 
-// grantHeaderMap maps x-amz-grant-* header names to the corresponding S3
-// permission string.
-var grantHeaderMap = map[string]string{
-	"X-Amz-Grant-Full-Control": "FULL_CONTROL",
-	"X-Amz-Grant-Read":         "READ",
-	"X-Amz-Grant-Read-Acp":     "READ_ACP",
-	"X-Amz-Grant-Write":        "WRITE",
-	"X-Amz-Grant-Write-Acp":    "WRITE_ACP",
+// grantHeaders lists the x-amz-grant-* headers with the S3 permission each
+// grants, in the order their grants are recorded.
+var grantHeaders = []struct {
+	header, permission string
+}{
+	{"X-Amz-Grant-Full-Control", "FULL_CONTROL"},
+	{"X-Amz-Grant-Read", "READ"},
+	{"X-Amz-Grant-Read-Acp", "READ_ACP"},
+	{"X-Amz-Grant-Write", "WRITE"},
+	{"X-Amz-Grant-Write-Acp", "WRITE_ACP"},
 }
 
 // hasGrantHeaders returns true if any x-amz-grant-* header is present in the request.
 func hasGrantHeaders(headers http.Header) bool {
-	for headerName := range grantHeaderMap {
-		if headers.Get(headerName) != "" {
+	for _, g := range grantHeaders {
+		if headers.Get(g.header) != "" {
 			return true
 		}
 	}
@@ -190,68 +304,55 @@ func hasGrantHeaders(headers http.Header) bool {
 }
 
 // parseGrantHeaders parses x-amz-grant-* headers into an AccessControlPolicy.
-// The header values use the format: id="canonical-user-id" or
-// uri="http://acs.amazonaws.com/groups/...", comma-separated for multiple grantees.
-// Returns nil if no grant headers are present.
-func parseGrantHeaders(headers http.Header, ownerID, ownerDisplay string) *xmlutil.AccessControlPolicy {
+// The header values use the format: id="canonical-user-id",
+// uri="http://acs.amazonaws.com/groups/..." or emailAddress="...",
+// comma-separated for multiple grantees. It returns an error for a grantee
+// in another format or a group S3 does not define, and nil if no grant
+// headers are present.
+func parseGrantHeaders(headers http.Header, ownerID, ownerDisplay string) (*xmlutil.AccessControlPolicy, error) {
 	var grants []xmlutil.Grant
 
-	for headerName, permission := range grantHeaderMap {
-		headerVal := headers.Get(headerName)
+	for _, g := range grantHeaders {
+		headerVal := headers.Get(g.header)
 		if headerVal == "" {
 			continue
 		}
 
 		// Split by comma for multiple grantees.
-		entries := strings.Split(headerVal, ",")
-		for _, entry := range entries {
+		for _, entry := range strings.Split(headerVal, ",") {
 			entry = strings.TrimSpace(entry)
 			if entry == "" {
 				continue
 			}
-
-			// Parse key="value" pairs within each entry.
-			// An entry may contain multiple key=value separated by commas,
-			// but we already split by comma above, so each entry is a single grantee.
-			grant := xmlutil.Grant{
-				Permission: permission,
+			kind, value, ok := strings.Cut(entry, "=")
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			if !ok || value == "" {
+				return nil, fmt.Errorf("%s: malformed grantee %q", g.header, entry)
 			}
 
-			if strings.HasPrefix(entry, "id=") {
+			grant := xmlutil.Grant{Permission: g.permission}
+			switch strings.TrimSpace(kind) {
+			case "id":
 				// Canonical user grant: id="user-id"
-				idVal := strings.TrimPrefix(entry, "id=")
-				idVal = strings.Trim(idVal, `"`)
-				grant.Grantee = xmlutil.Grantee{
-					Type: "CanonicalUser",
-					ID:   idVal,
-				}
-			} else if strings.HasPrefix(entry, "uri=") {
+				grant.Grantee = xmlutil.Grantee{Type: "CanonicalUser", ID: value}
+			case "uri":
 				// Group grant: uri="http://acs.amazonaws.com/groups/..."
-				uriVal := strings.TrimPrefix(entry, "uri=")
-				uriVal = strings.Trim(uriVal, `"`)
-				grant.Grantee = xmlutil.Grantee{
-					Type: "Group",
-					URI:  uriVal,
+				if value != allUsersURI && value != authenticatedUsersURI && value != logDeliveryURI {
+					return nil, fmt.Errorf("%s: unknown group %q", g.header, value)
 				}
-			} else if strings.HasPrefix(entry, "emailAddress=") {
+				grant.Grantee = xmlutil.Grantee{Type: "Group", URI: value}
+			case "emailAddress":
 				// Email grant: emailAddress="email@example.com" — treat as canonical user.
-				emailVal := strings.TrimPrefix(entry, "emailAddress=")
-				emailVal = strings.Trim(emailVal, `"`)
-				grant.Grantee = xmlutil.Grantee{
-					Type: "AmazonCustomerByEmail",
-					ID:   emailVal,
-				}
-			} else {
-				// Unknown format: skip.
-				continue
+				grant.Grantee = xmlutil.Grantee{Type: "AmazonCustomerByEmail", ID: value}
+			default:
+				return nil, fmt.Errorf("%s: unknown grantee type %q", g.header, kind)
 			}
-
 			grants = append(grants, grant)
 		}
 	}
 
 	if len(grants) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	return &xmlutil.AccessControlPolicy{
@@ -262,7 +363,68 @@ func parseGrantHeaders(headers http.Header, ownerID, ownerDisplay string) *xmlut
 		AccessControlList: xmlutil.ACL{
 			Grants: grants,
 		},
+	}, nil
+}
+
+// aclFromHeaders builds the ACL a request sets with x-amz-acl or
+// x-amz-grant-* headers, or returns nil if it sets neither. The two are
+// mutually exclusive, and an unknown canned ACL or a malformed grant is an
+// InvalidArgument error.
+func aclFromHeaders(headers http.Header, ownerID, ownerDisplay string) (*xmlutil.AccessControlPolicy, *s3err.S3Error) {
+	invalid := func(msg string) *s3err.S3Error {
+		return &s3err.S3Error{Code: "InvalidArgument", Message: msg, HTTPStatus: http.StatusBadRequest}
+	}
+	cannedACL := headers.Get("x-amz-acl")
+	if cannedACL != "" && hasGrantHeaders(headers) {
+		return nil, invalid("Specifying both x-amz-acl and x-amz-grant headers is not allowed")
+	}
+	if cannedACL != "" {
+		if !slices.Contains(cannedACLs, cannedACL) {
+			return nil, invalid(fmt.Sprintf("Unknown canned ACL %q", cannedACL))
+		}
+		return parseCannedACL(cannedACL, ownerID, ownerDisplay), nil
+	}
+	acp, err := parseGrantHeaders(headers, ownerID, ownerDisplay)
+	if err != nil {
+		return nil, invalid("Invalid grant header " + err.Error())
+	}
+	return acp, nil
+}
+
+// addBucketOwnerGrant adds the grant the bucket-owner-read and
+// bucket-owner-full-control canned ACLs give the bucket owner when someone
+// else writes the object.
+func addBucketOwnerGrant(acp *xmlutil.AccessControlPolicy, cannedACL string, bucket *metadata.BucketRecord) {
+	var permission string
+	switch cannedACL {
+	case "bucket-owner-read":
+		permission = "READ"
+	case "bucket-owner-full-control":
+		permission = "FULL_CONTROL"
+	default:
+		return
+	}
+	if acp == nil || acp.Owner.ID == bucket.OwnerID {
+		return
+	}
+	acp.AccessControlList.Grants = append(acp.AccessControlList.Grants, xmlutil.Grant{
+		Grantee: xmlutil.Grantee{
+			Type:        "CanonicalUser",
+			ID:          bucket.OwnerID,
+			DisplayName: bucket.OwnerDisplay,
+		},
+		Permission: permission,
+	})
+}
+
+// objectOwner returns the owner recorded in an object's ACL, which is the
+// identity that wrote it, or the given default for objects stored without
+// one.
+func objectOwner(obj *metadata.ObjectRecord, defaultID, defaultDisplay string) (id, display string) {
+	if acp := aclFromJSON(obj.ACL); acp != nil && acp.Owner.ID != "" {
+		return acp.Owner.ID, acp.Owner.DisplayName
 	}
+	return defaultID, defaultDisplay
 }
 
 // aclToJSON converts an AccessControlPolicy to a JSON-encoded RawMessage.
@@ -284,18 +446,16 @@ func aclFromJSON(data json.RawMessage) *xmlutil.AccessControlPolicy {
 	return &acp
 }
 
-// extractBucketName extracts the bucket name from the URL path.
-func extractBucketName(r *http.Request) string {
-	path := r.URL.Path
-	if len(path) > 0 && path[0] == '/' {
-		path = path[1:]
+// listingOwner returns the Owner reported for obj in an object listing: the
+// owner recorded in its ACL, else the owner of bucket, else the handler's.
+func (h *ObjectHandler) listingOwner(obj *metadata.ObjectRecord, bucket *metadata.BucketRecord) *xmlutil.Owner {
+	if acp := aclFromJSON(obj.ACL); acp != nil && acp.Owner.ID != "" {
+		return &xmlutil.Owner{ID: acp.Owner.ID, DisplayName: acp.Owner.DisplayName}
 	}
-	// Find the first slash (if any) to separate bucket from key.
-	idx := strings.IndexByte(path, '/')
-	if idx >= 0 {
-		return path[:idx]
+	if bucket.OwnerID != "" {
+		return &xmlutil.Owner{ID: bucket.OwnerID, DisplayName: bucket.OwnerDisplay}
 	}
-	return path
+	return &xmlutil.Owner{ID: h.ownerID, DisplayName: h.ownerDisplay}
 }
 
 // extractUserMetadata scans request headers for x-amz-meta-* prefixed headers
@@ -317,6 +477,28 @@ func extractUserMetadata(r *http.Request) map[string]string {
 	return meta
 }
 
+// maxWebsiteRedirectLength is the longest x-amz-website-redirect-location
+// S3 accepts.
+const maxWebsiteRedirectLength = 2048
+
+// websiteRedirectLocation returns the request's x-amz-website-redirect-location
+// header, which must be a path starting with "/" or an http(s) URL.
+func websiteRedirectLocation(r *http.Request) (string, *s3err.S3Error) {
+	v := r.Header.Get("x-amz-website-redirect-location")
+	if v == "" {
+		return "", nil
+	}
+	if len(v) > maxWebsiteRedirectLength ||
+		!(strings.HasPrefix(v, "/") || strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://")) {
+		return "", &s3err.S3Error{
+			Code:       "InvalidArgument",
+			Message:    "The website redirect location must have a prefix of 'http://' or 'https://' or '/'.",
+			HTTPStatus: http.StatusBadRequest,
+		}
+	}
+	return v, nil
+}
+
 // parseDeleteRequest parses a DeleteObjects XML request body into a DeleteRequest struct.
 func parseDeleteRequest(body io.Reader) (*xmlutil.DeleteRequest, error) {
 	var req xmlutil.DeleteRequest
@@ -326,6 +508,106 @@ func parseDeleteRequest(body io.Reader) (*xmlutil.DeleteRequest, error) {
 	return &req, nil
 }
 
+// payloadVerifier checks a request body against its Content-MD5 and
+// x-amz-content-sha256 as it is read. Once the declared length has been
+// read, or at EOF, a mismatch fails that Read and every later one, so a
+// storage backend aborts the write rather than committing the data. A body
+// that runs past the size limit fails the same way with EntityTooLarge.
+type payloadVerifier struct {
+	r          io.Reader
+	md5, sha   hash.Hash
+	wantMD5    []byte
+	wantSHA    []byte
+	size, read int64
+	limit      int64
+	checked    bool
+	err        *s3err.S3Error
+}
+
+// newPayloadVerifier wraps r's body to verify its Content-MD5 and, when it
+// is a hash rather than UNSIGNED-PAYLOAD or a streaming mode, its
+// x-amz-content-sha256 (a presigned URL may carry it as a query
+// parameter). A malformed digest is an error up front. Bodies of unknown
+// length are cut off after limit bytes; a limit of 0 disables the check.
+func newPayloadVerifier(r *http.Request, limit int64) (*payloadVerifier, *s3err.S3Error) {
+	v := &payloadVerifier{r: r.Body, size: r.ContentLength, limit: limit}
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		want, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(want) != md5.Size {
+			return nil, s3err.ErrInvalidDigest
+		}
+		v.md5, v.wantMD5 = md5.New(), want
+	}
+	contentSHA := r.Header.Get("X-Amz-Content-Sha256")
+	if contentSHA == "" {
+		contentSHA = r.URL.Query().Get("X-Amz-Content-Sha256")
+	}
+	if contentSHA != "" && contentSHA != "UNSIGNED-PAYLOAD" && !strings.HasPrefix(contentSHA, "STREAMING-") {
+		want, err := hex.DecodeString(contentSHA)
+		if err != nil || len(want) != sha256.Size {
+			return nil, &s3err.S3Error{
+				Code:       "InvalidArgument",
+				Message:    "x-amz-content-sha256 must be UNSIGNED-PAYLOAD, STREAMING-AWS4-HMAC-SHA256-PAYLOAD, or a valid sha256 value",
+				HTTPStatus: 400,
+			}
+		}
+		v.sha, v.wantSHA = sha256.New(), want
+	}
+	return v, nil
+}
+
+func (v *payloadVerifier) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	if v.limit > 0 && int64(len(p)) > v.limit-v.read {
+		p = p[:v.limit-v.read+1]
+	}
+	n, err := v.r.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (v.limit > 0 && v.read+int64(n) > v.limit) {
+		v.err = s3err.ErrEntityTooLarge
+		return 0, v.err
+	}
+	if v.md5 != nil {
+		v.md5.Write(p[:n])
+	}
+	if v.sha != nil {
+		v.sha.Write(p[:n])
+	}
+	v.read += int64(n)
+	if err == io.EOF || (v.size >= 0 && v.read >= v.size) {
+		if e := v.check(); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+// check compares the digests once the whole body has been read.
+func (v *payloadVerifier) check() *s3err.S3Error {
+	if !v.checked {
+		v.checked = true
+		if v.md5 != nil && !bytes.Equal(v.md5.Sum(nil), v.wantMD5) {
+			v.err = s3err.ErrBadDigest
+		} else if v.sha != nil && !bytes.Equal(v.sha.Sum(nil), v.wantSHA) {
+			v.err = s3err.ErrXAmzContentSHA256Mismatch
+		}
+	}
+	return v.err
+}
+
+// Err returns the digest mismatch found reading the body, if any. Callers
+// check it after the body was consumed, whether or not that failed, since
+// readers such as io.ReadFull drop an error that arrives with the last
+// bytes, and skip reading an empty body.
+func (v *payloadVerifier) Err() *s3err.S3Error {
+	if v.size >= 0 && v.read >= v.size {
+		return v.check()
+	}
+	return v.err
+}
+
 // parseCopySource parses the X-Amz-Copy-Source header and returns the source
 // bucket and key. The header value is URL-decoded and expected in the format
 // "/bucket/key" or "bucket/key".
@@ -360,7 +642,7 @@ func parseCopySource(header string) (bucket, key string, ok bool) {
 // Returns an error for unsatisfiable ranges or invalid syntax.
 func parseRange(rangeHeader string, objectSize int64) (start, end int64, err error) {
 	if objectSize == 0 {
-		return 0, 0, fmt.Errorf("empty object")
+		return 0, 0, fmt.Errorf("empty object: %w", errRangeNotSatisfiable)
 	}
 
 	// Must start with "bytes=".
@@ -406,7 +688,7 @@ func parseRange(rangeHeader string, objectSize int64) (start, end int64, err err
 	}
 
 	if start >= objectSize {
-		return 0, 0, fmt.Errorf("range start %d beyond object size %d", start, objectSize)
+		return 0, 0, fmt.Errorf("range start %d beyond object size %d: %w", start, objectSize, errRangeNotSatisfiable)
 	}
 
 	if endStr == "" {
@@ -431,6 +713,105 @@ func parseRange(rangeHeader string, objectSize int64) (start, end int64, err err
 	return start, end, nil
 }
 
+// errRangeNotSatisfiable marks a well-formed range that selects no bytes
+// of the object.
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// maxRanges caps the ranges one Range header may list.
+const maxRanges = 100
+
+// byteRange is an inclusive range of object bytes.
+type byteRange struct {
+	start, end int64
+}
+
+// parseRanges parses a Range header that may list several ranges, such as
+// "bytes=0-4,10-20". Ranges selecting no bytes are dropped, and overlapping
+// or adjacent ones merged, leaving them in ascending order so the object
+// can be read once from start to end. It fails if any range is malformed
+// or none is satisfiable.
+func parseRanges(rangeHeader string, objectSize int64) ([]byteRange, error) {
+	if !strings.HasPrefix(rangeHeader, "bytes=") {
+		return nil, fmt.Errorf("invalid range header: missing bytes= prefix")
+	}
+	specs := strings.Split(strings.TrimPrefix(rangeHeader, "bytes="), ",")
+	if len(specs) > maxRanges {
+		return nil, fmt.Errorf("more than %d ranges", maxRanges)
+	}
+	var ranges []byteRange
+	for _, spec := range specs {
+		start, end, err := parseRange("bytes="+strings.TrimSpace(spec), objectSize)
+		if errors.Is(err, errRangeNotSatisfiable) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, byteRange{start: start, end: end})
+	}
+	if len(ranges) == 0 {
+		return nil, errRangeNotSatisfiable
+	}
+	slices.SortFunc(ranges, func(a, b byteRange) int { return cmp.Compare(a.start, b.start) })
+	merged := ranges[:1]
+	for _, rg := range ranges[1:] {
+		if last := &merged[len(merged)-1]; rg.start <= last.end+1 {
+			last.end = max(last.end, rg.end)
+			continue
+		}
+		merged = append(merged, rg)
+	}
+	return merged, nil
+}
+
+// writeCondition returns the condition of a conditional PutObject: If-None-Match
+// "*" or If-Match with an ETag or "*". Other If-None-Match values are
+// ignored.
+func writeCondition(r *http.Request) (metadata.WriteCondition, bool) {
+	cond := metadata.WriteCondition{
+		IfNoneMatch: strings.TrimSpace(r.Header.Get("If-None-Match")) == "*",
+		IfMatch:     strings.TrimSpace(r.Header.Get("If-Match")),
+	}
+	return cond, cond.IfNoneMatch || cond.IfMatch != ""
+}
+
+// keyLocks holds a mutex per key while it is in use. The zero value is
+// ready to use.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock locks key and returns the unlock function.
+func (l *keyLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	kl := l.locks[key]
+	if kl == nil {
+		kl = &keyLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	kl.mu.Lock()
+	return func() {
+		kl.mu.Unlock()
+		l.mu.Lock()
+		if kl.refs--; kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
 // checkCopySourceConditionals evaluates x-amz-copy-source-if-* headers against
 // the source object's ETag and LastModified time. Used by CopyObject and UploadPartCopy.
 // Returns true if the copy should proceed, false if a precondition failed.
@@ -627,6 +1008,12 @@ func setObjectResponseHeaders(w http.ResponseWriter, obj *metadata.ObjectRecord)
 	if obj.StorageClass != "" && obj.StorageClass != "STANDARD" {
 		w.Header().Set("x-amz-storage-class", obj.StorageClass)
 	}
+	if obj.ReplicationStatus != "" {
+		w.Header().Set("x-amz-replication-status", obj.ReplicationStatus)
+	}
+	if obj.WebsiteRedirectLocation != "" {
+		w.Header().Set("x-amz-website-redirect-location", obj.WebsiteRedirectLocation)
+	}
 
 	// Emit user metadata as x-amz-meta-* headers.
 	for key, value := range obj.UserMetadata {
@@ -640,7 +1027,7 @@ func setObjectResponseHeaders(w http.ResponseWriter, obj *metadata.ObjectRecord)
 // applyResponseOverrides applies response-* query parameter overrides to the
 // response headers. These are used for presigned URLs to override content headers.
 func applyResponseOverrides(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
+	q := requestContext(r).Query
 	if v := q.Get("response-content-type"); v != "" {
 		w.Header().Set("Content-Type", v)
 	}
@@ -705,3 +1092,51 @@ func computeCompositeETag(partETags []string) string {
 	}
 	return fmt.Sprintf(`"%x-%d"`, h.Sum(nil), len(partETags))
 }
+
+// enqueueReplication queues a committed object for replication if a rule
+// applies to it. Best-effort: the write has succeeded, and a failure leaves
+// the object PENDING.
+func enqueueReplication(ctx context.Context, rules *replication.Rules, obj *metadata.ObjectRecord) {
+	if err := rules.EnqueueWrite(ctx, obj); err != nil {
+		slog.Error("Replication enqueue error", "bucket", obj.Bucket, "key", obj.Key, "error", err)
+	}
+}
+
+// enqueueReplicatedDelete queues a deletion for replication if a rule
+// applies to it and replicates deletes. Best-effort, like enqueueReplication.
+func enqueueReplicatedDelete(ctx context.Context, rules *replication.Rules, bucket, key string) {
+	if err := rules.EnqueueDelete(ctx, bucket, key); err != nil {
+		slog.Error("Replication enqueue error", "bucket", bucket, "key", key, "error", err)
+	}
+}
+
+// reserveQuota reserves prefix quota for replacing bucket/key with an object
+// of size bytes, or for removing it when remove is set. It returns a nil
+// reservation when no quota covers the key.
+func reserveQuota(ctx context.Context, q *quota.Tracker, meta metadata.MetadataStore, bucket, key string, size int64, remove bool) (*quota.Reservation, *s3err.S3Error) {
+	if !q.Applies(bucket, key) {
+		return nil, nil
+	}
+	existing, err := meta.GetObject(ctx, bucket, key)
+	if err != nil {
+		slog.Error("Quota GetObject error", "error", err)
+		return nil, s3err.ErrInternalError
+	}
+	var bytes, objects int64
+	if existing != nil {
+		bytes, objects = -existing.Size, -1
+	}
+	if !remove {
+		bytes += size
+		objects++
+	}
+	reservation, err := q.Reserve(ctx, bucket, key, bytes, objects)
+	if errors.Is(err, quota.ErrExceeded) {
+		return nil, s3err.ErrQuotaExceeded
+	}
+	if err != nil {
+		slog.Error("Quota reserve error", "error", err)
+		return nil, s3err.ErrInternalError
+	}
+	return reservation, nil
+}
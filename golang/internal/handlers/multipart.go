@@ -1,18 +1,18 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/clock"
 	s3err "github.com/bleepstore/bleepstore/internal/errors"
 	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/quota"
+	"github.com/bleepstore/bleepstore/internal/replication"
 	"github.com/bleepstore/bleepstore/internal/storage"
 	"github.com/bleepstore/bleepstore/internal/xmlutil"
 )
@@ -24,6 +24,11 @@ type MultipartHandler struct {
 	ownerID       string
 	ownerDisplay  string
 	maxObjectSize int64
+	defragQueue   metadata.DefragQueue
+	quotas        *quota.Tracker
+	replication   *replication.Rules
+	clock         clock.Clock
+	ids           clock.IDGenerator
 }
 
 // NewMultipartHandler creates a new MultipartHandler with the given dependencies.
@@ -34,9 +39,40 @@ func NewMultipartHandler(meta metadata.MetadataStore, store storage.StorageBacke
 		ownerID:       ownerID,
 		ownerDisplay:  ownerDisplay,
 		maxObjectSize: maxObjectSize,
+		clock:         clock.System{},
+		ids:           clock.Random{},
 	}
 }
 
+// SetClock replaces the clock used for upload and part timestamps.
+func (h *MultipartHandler) SetClock(c clock.Clock) {
+	h.clock = c
+}
+
+// SetIDGenerator replaces the generator of new upload IDs.
+func (h *MultipartHandler) SetIDGenerator(ids clock.IDGenerator) {
+	h.ids = ids
+}
+
+// SetDefragQueue makes CompleteMultipartUpload queue each assembled object
+// for background defragmentation. Passing nil disables queueing.
+func (h *MultipartHandler) SetDefragQueue(q metadata.DefragQueue) {
+	h.defragQueue = q
+}
+
+// SetQuotas makes CompleteMultipartUpload enforce and track the given prefix
+// quotas. Passing nil disables enforcement.
+func (h *MultipartHandler) SetQuotas(q *quota.Tracker) {
+	h.quotas = q
+}
+
+// SetReplication makes CompleteMultipartUpload queue assembled objects that
+// a replication rule applies to for replication. Passing nil disables
+// replication.
+func (h *MultipartHandler) SetReplication(rules *replication.Rules) {
+	h.replication = rules
+}
+
 // CreateMultipartUpload handles POST /{bucket}/{object}?uploads and initiates
 // a new multipart upload, returning an upload ID.
 func (h *MultipartHandler) CreateMultipartUpload(w http.ResponseWriter, r *http.Request) {
@@ -46,8 +82,8 @@ func (h *MultipartHandler) CreateMultipartUpload(w http.ResponseWriter, r *http.
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
 
 	if key == "" {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
@@ -67,11 +103,7 @@ func (h *MultipartHandler) CreateMultipartUpload(w http.ResponseWriter, r *http.
 	}
 
 	// Determine owner from context (auth middleware sets this) or fall back to handler default.
-	ownerID, ownerDisplay := h.ownerID, h.ownerDisplay
-	if ctxOwner, ctxDisplay := auth.OwnerFromContext(ctx); ctxOwner != "" {
-		ownerID = ctxOwner
-		ownerDisplay = ctxDisplay
-	}
+	ownerID, ownerDisplay := rc.Owner(h.ownerID, h.ownerDisplay)
 
 	// Extract content type, defaulting to application/octet-stream.
 	contentType := r.Header.Get("Content-Type")
@@ -85,37 +117,46 @@ func (h *MultipartHandler) CreateMultipartUpload(w http.ResponseWriter, r *http.
 	contentDisposition := r.Header.Get("Content-Disposition")
 	cacheControl := r.Header.Get("Cache-Control")
 	expires := r.Header.Get("Expires")
+	redirect, redirectErr := websiteRedirectLocation(r)
+	if redirectErr != nil {
+		xmlutil.WriteErrorResponse(w, r, redirectErr)
+		return
+	}
 
 	// Extract user metadata (x-amz-meta-* headers).
 	userMeta := extractUserMetadata(r)
 
-	// Extract optional canned ACL.
-	cannedACL := r.Header.Get("x-amz-acl")
-	var aclJSON json.RawMessage
-	if cannedACL != "" {
-		acp := parseCannedACL(cannedACL, ownerID, ownerDisplay)
+	// Optional canned ACL or grants; private by default.
+	acp, aclErr := aclFromHeaders(r.Header, ownerID, ownerDisplay)
+	if aclErr != nil {
+		xmlutil.WriteErrorResponse(w, r, aclErr)
+		return
+	}
+	addBucketOwnerGrant(acp, r.Header.Get("x-amz-acl"), bucket)
+	aclJSON := defaultPrivateACL(ownerID, ownerDisplay)
+	if acp != nil {
 		aclJSON = aclToJSON(acp)
-	} else {
-		aclJSON = defaultPrivateACL(ownerID, ownerDisplay)
 	}
 
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 
 	upload := &metadata.MultipartUploadRecord{
-		Bucket:             bucketName,
-		Key:                key,
-		ContentType:        contentType,
-		ContentEncoding:    contentEncoding,
-		ContentLanguage:    contentLanguage,
-		ContentDisposition: contentDisposition,
-		CacheControl:       cacheControl,
-		Expires:            expires,
-		StorageClass:       "STANDARD",
-		ACL:                aclJSON,
-		UserMetadata:       userMeta,
-		OwnerID:            ownerID,
-		OwnerDisplay:       ownerDisplay,
-		InitiatedAt:        now,
+		UploadID:                h.ids.NewID(),
+		Bucket:                  bucketName,
+		Key:                     key,
+		ContentType:             contentType,
+		ContentEncoding:         contentEncoding,
+		ContentLanguage:         contentLanguage,
+		ContentDisposition:      contentDisposition,
+		CacheControl:            cacheControl,
+		Expires:                 expires,
+		StorageClass:            "STANDARD",
+		ACL:                     aclJSON,
+		UserMetadata:            userMeta,
+		OwnerID:                 ownerID,
+		OwnerDisplay:            ownerDisplay,
+		InitiatedAt:             now,
+		WebsiteRedirectLocation: redirect,
 	}
 
 	uploadID, err := h.meta.CreateMultipartUpload(ctx, upload)
@@ -142,10 +183,10 @@ func (h *MultipartHandler) UploadPart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
 
-	q := r.URL.Query()
+	q := rc.Query
 
 	// Check for UploadPartCopy (X-Amz-Copy-Source header present).
 	copySource := r.Header.Get("X-Amz-Copy-Source")
@@ -187,8 +228,18 @@ func (h *MultipartHandler) UploadPart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Write part data to storage backend (atomic: temp-fsync-rename).
-	etag, err := h.store.PutPart(ctx, bucketName, key, uploadID, partNumber, r.Body, r.ContentLength)
+	// Write part data to storage backend (atomic: temp-fsync-rename),
+	// verifying Content-MD5, x-amz-content-sha256 and the size on the way.
+	body, digestErr := newPayloadVerifier(r, h.maxObjectSize)
+	if digestErr != nil {
+		xmlutil.WriteErrorResponse(w, r, digestErr)
+		return
+	}
+	etag, err := h.store.PutPart(ctx, bucketName, key, uploadID, partNumber, body, r.ContentLength)
+	if digestErr = body.Err(); digestErr != nil {
+		xmlutil.WriteErrorResponse(w, r, digestErr)
+		return
+	}
 	if err != nil {
 		slog.Error("UploadPart storage error", "error", err)
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
@@ -216,7 +267,7 @@ func (h *MultipartHandler) UploadPart(w http.ResponseWriter, r *http.Request) {
 		partSize = 0
 	}
 
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 
 	// Record part metadata in SQLite.
 	partRecord := &metadata.PartRecord{
@@ -308,8 +359,8 @@ func (h *MultipartHandler) uploadPartCopy(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Open source object data from storage.
-	reader, _, _, err := h.store.GetObject(ctx, srcBucket, srcKey)
+	// Open source object data from the metadata row or storage.
+	reader, err := openObjectData(ctx, h.store, srcObj)
 	if err != nil {
 		slog.Error("UploadPartCopy GetObject storage error", "error", err)
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
@@ -364,7 +415,7 @@ func (h *MultipartHandler) uploadPartCopy(w http.ResponseWriter, r *http.Request
 		partSize = srcObj.Size
 	}
 
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 
 	// Record part metadata.
 	partRecord := &metadata.PartRecord{
@@ -398,9 +449,9 @@ func (h *MultipartHandler) CompleteMultipartUpload(w http.ResponseWriter, r *htt
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
-	uploadID := r.URL.Query().Get("uploadId")
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
+	uploadID := rc.Query.Get("uploadId")
 
 	if uploadID == "" {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
@@ -460,8 +511,11 @@ func (h *MultipartHandler) CompleteMultipartUpload(w http.ResponseWriter, r *htt
 		storedMap[sp.PartNumber] = sp
 	}
 
-	// Validate each requested part exists and ETags match.
+	// Validate each requested part exists and ETags match, totalling the
+	// final object size.
 	const minPartSize = 5 * 1024 * 1024 // 5 MiB
+	var totalSize int64
+	partSizes := make([]int64, len(parts))
 	for i, p := range parts {
 		stored, ok := storedMap[p.PartNumber]
 		if !ok {
@@ -482,49 +536,66 @@ func (h *MultipartHandler) CompleteMultipartUpload(w http.ResponseWriter, r *htt
 			xmlutil.WriteErrorResponse(w, r, s3err.ErrEntityTooSmall)
 			return
 		}
+		totalSize += stored.Size
+		partSizes[i] = stored.Size
+	}
+
+	reservation, quotaErr := reserveQuota(ctx, h.quotas, h.meta, bucketName, key, totalSize, false)
+	if quotaErr != nil {
+		xmlutil.WriteErrorResponse(w, r, quotaErr)
+		return
 	}
 
 	// Assemble part files into the final object via the storage backend.
 	compositeETag, err := h.store.AssembleParts(ctx, bucketName, key, uploadID, partNumbers)
 	if err != nil {
+		reservation.Cancel()
 		slog.Error("CompleteMultipartUpload AssembleParts error", "error", err)
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
 		return
 	}
 
-	// Compute total size from stored parts.
-	var totalSize int64
-	for _, p := range parts {
-		totalSize += storedMap[p.PartNumber].Size
-	}
-
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 
 	// Build the final object record from upload metadata.
 	obj := &metadata.ObjectRecord{
-		Bucket:             bucketName,
-		Key:                key,
-		Size:               totalSize,
-		ETag:               compositeETag,
-		ContentType:        upload.ContentType,
-		ContentEncoding:    upload.ContentEncoding,
-		ContentLanguage:    upload.ContentLanguage,
-		ContentDisposition: upload.ContentDisposition,
-		CacheControl:       upload.CacheControl,
-		Expires:            upload.Expires,
-		StorageClass:       upload.StorageClass,
-		ACL:                upload.ACL,
-		UserMetadata:       upload.UserMetadata,
-		LastModified:       now,
+		Bucket:                  bucketName,
+		Key:                     key,
+		Size:                    totalSize,
+		ETag:                    compositeETag,
+		ContentType:             upload.ContentType,
+		ContentEncoding:         upload.ContentEncoding,
+		ContentLanguage:         upload.ContentLanguage,
+		ContentDisposition:      upload.ContentDisposition,
+		CacheControl:            upload.CacheControl,
+		Expires:                 upload.Expires,
+		StorageClass:            upload.StorageClass,
+		ACL:                     upload.ACL,
+		UserMetadata:            upload.UserMetadata,
+		LastModified:            now,
+		PartSizes:               partSizes,
+		ReplicationStatus:       h.replication.Status(bucketName, key),
+		WebsiteRedirectLocation: upload.WebsiteRedirectLocation,
 	}
 
 	// Finalize in metadata: insert object, delete parts and upload record (transactional).
 	if err := h.meta.CompleteMultipartUpload(ctx, bucketName, key, uploadID, obj); err != nil {
+		reservation.Cancel()
 		slog.Error("CompleteMultipartUpload metadata error", "error", err)
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
 		return
 	}
 
+	// Queue the assembled object for background defragmentation. Best-effort:
+	// a missed entry only means the object stays fragmented.
+	if h.defragQueue != nil {
+		task := metadata.DefragTask{Bucket: bucketName, Key: key, ETag: compositeETag, EnqueuedAt: now}
+		if err := h.defragQueue.EnqueueDefrag(ctx, task); err != nil {
+			slog.Warn("CompleteMultipartUpload defrag enqueue error", "error", err)
+		}
+	}
+	enqueueReplication(ctx, h.replication, obj)
+
 	// Build location URL.
 	location := fmt.Sprintf("/%s/%s", bucketName, key)
 
@@ -546,9 +617,9 @@ func (h *MultipartHandler) AbortMultipartUpload(w http.ResponseWriter, r *http.R
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
-	uploadID := r.URL.Query().Get("uploadId")
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
+	uploadID := rc.Query.Get("uploadId")
 
 	if uploadID == "" {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
@@ -596,8 +667,9 @@ func (h *MultipartHandler) ListMultipartUploads(w http.ResponseWriter, r *http.R
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	q := r.URL.Query()
+	rc := requestContext(r)
+	bucketName := rc.Bucket
+	q := rc.Query
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -697,9 +769,9 @@ func (h *MultipartHandler) ListParts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
-	q := r.URL.Query()
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
+	q := rc.Query
 
 	uploadID := q.Get("uploadId")
 	if uploadID == "" {
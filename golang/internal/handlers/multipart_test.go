@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -146,6 +149,53 @@ func TestUploadPart(t *testing.T) {
 	}
 }
 
+func TestUploadPartPayloadDigests(t *testing.T) {
+	mh, _, meta, store := newTestMultipartHandler(t)
+	bucketName := "test-bucket"
+	createTestBucketForMultipart(t, meta, store, bucketName)
+
+	req := httptest.NewRequest("POST", "/"+bucketName+"/test-key?uploads", nil)
+	rec := httptest.NewRecorder()
+	mh.CreateMultipartUpload(rec, req)
+	var initResult xmlutil.InitiateMultipartUploadResult
+	xml.NewDecoder(rec.Body).Decode(&initResult)
+	uploadID := initResult.UploadID
+
+	upload := func(data []byte, header, value string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("PUT",
+			fmt.Sprintf("/%s/test-key?partNumber=1&uploadId=%s", bucketName, uploadID),
+			bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		mh.UploadPart(rec, req)
+		return rec
+	}
+
+	sum := md5.Sum([]byte("expected part"))
+	if rec := upload([]byte("corrupted part"), "Content-MD5", base64.StdEncoding.EncodeToString(sum[:])); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "BadDigest") {
+		t.Errorf("UploadPart with mismatched Content-MD5 = %d %s, want 400 BadDigest", rec.Code, rec.Body)
+	}
+	sha := sha256.Sum256([]byte("expected part"))
+	if rec := upload([]byte("corrupted part"), "X-Amz-Content-Sha256", hex.EncodeToString(sha[:])); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "XAmzContentSHA256Mismatch") {
+		t.Errorf("UploadPart with mismatched sha256 = %d %s, want 400 XAmzContentSHA256Mismatch", rec.Code, rec.Body)
+	}
+
+	// Neither rejected part was recorded.
+	parts, err := meta.ListParts(context.Background(), uploadID, metadata.ListPartsOptions{})
+	if err != nil {
+		t.Fatalf("ListParts: %v", err)
+	}
+	if len(parts.Parts) != 0 {
+		t.Errorf("ListParts = %d parts, want 0", len(parts.Parts))
+	}
+
+	if rec := upload([]byte("expected part"), "X-Amz-Content-Sha256", hex.EncodeToString(sha[:])); rec.Code != http.StatusOK {
+		t.Errorf("UploadPart with matching sha256 = %d %s", rec.Code, rec.Body)
+	}
+}
+
 func TestUploadPartInvalidPartNumber(t *testing.T) {
 	mh, _, meta, store := newTestMultipartHandler(t)
 	bucketName := "test-bucket"
@@ -658,6 +708,91 @@ func TestCreateMultipartUploadWithContentType(t *testing.T) {
 	}
 }
 
+func TestCreateMultipartUploadGrantHeaders(t *testing.T) {
+	mh, _, meta, store := newTestMultipartHandler(t)
+	bucketName := "test-bucket"
+	createTestBucketForMultipart(t, meta, store, bucketName)
+
+	req := httptest.NewRequest("POST", "/"+bucketName+"/granted?uploads", nil)
+	req.Header.Set("x-amz-grant-full-control", `id="alice"`)
+	rec := httptest.NewRecorder()
+	mh.CreateMultipartUpload(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var result xmlutil.InitiateMultipartUploadResult
+	xml.NewDecoder(rec.Body).Decode(&result)
+	upload, err := meta.GetMultipartUpload(context.Background(), bucketName, "granted", result.UploadID)
+	if err != nil {
+		t.Fatalf("GetMultipartUpload error: %v", err)
+	}
+	acp := aclFromJSON(upload.ACL)
+	if acp == nil || len(acp.AccessControlList.Grants) != 1 || acp.AccessControlList.Grants[0].Grantee.ID != "alice" {
+		t.Errorf("upload ACL = %s, want one grant to alice", upload.ACL)
+	}
+
+	req = httptest.NewRequest("POST", "/"+bucketName+"/granted?uploads", nil)
+	req.Header.Set("x-amz-grant-read", `uri="http://example.com/group"`)
+	rec = httptest.NewRecorder()
+	mh.CreateMultipartUpload(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown group status = %d, want 400", rec.Code)
+	}
+}
+
+func TestMultipartUploadWebsiteRedirectLocation(t *testing.T) {
+	mh, _, meta, store := newTestMultipartHandler(t)
+	bucketName := "test-bucket"
+	createTestBucketForMultipart(t, meta, store, bucketName)
+
+	req := httptest.NewRequest("POST", "/"+bucketName+"/bad?uploads", nil)
+	req.Header.Set("x-amz-website-redirect-location", "elsewhere")
+	rec := httptest.NewRecorder()
+	mh.CreateMultipartUpload(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("CreateMultipartUpload with an invalid redirect status = %d, want 400", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/"+bucketName+"/page.html?uploads", nil)
+	req.Header.Set("x-amz-website-redirect-location", "/new.html")
+	rec = httptest.NewRecorder()
+	mh.CreateMultipartUpload(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CreateMultipartUpload status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var initResult xmlutil.InitiateMultipartUploadResult
+	xml.NewDecoder(rec.Body).Decode(&initResult)
+
+	req = httptest.NewRequest("PUT",
+		fmt.Sprintf("/%s/page.html?partNumber=1&uploadId=%s", bucketName, initResult.UploadID),
+		strings.NewReader("part"))
+	req.ContentLength = 4
+	rec = httptest.NewRecorder()
+	mh.UploadPart(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("UploadPart status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	xmlBody := completeMultipartUploadXML([]CompletePart{{PartNumber: 1, ETag: rec.Header().Get("ETag")}})
+	req = httptest.NewRequest("POST",
+		fmt.Sprintf("/%s/page.html?uploadId=%s", bucketName, initResult.UploadID),
+		strings.NewReader(xmlBody))
+	rec = httptest.NewRecorder()
+	mh.CompleteMultipartUpload(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CompleteMultipartUpload status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	// The completed object keeps the redirect the upload was created with.
+	obj, err := meta.GetObject(context.Background(), bucketName, "page.html")
+	if err != nil || obj == nil {
+		t.Fatalf("GetObject = %v, %v", obj, err)
+	}
+	if obj.WebsiteRedirectLocation != "/new.html" {
+		t.Errorf("WebsiteRedirectLocation = %q, want /new.html", obj.WebsiteRedirectLocation)
+	}
+}
+
 func TestListPartsXMLStructure(t *testing.T) {
 	mh, _, meta, store := newTestMultipartHandler(t)
 	bucketName := "test-bucket"
@@ -1283,3 +1418,167 @@ func TestCompleteMultipartUploadFullLifecycle(t *testing.T) {
 		t.Errorf("Content-Type = %q, want %q", ct, "text/plain")
 	}
 }
+
+func TestGetObjectPartNumber(t *testing.T) {
+	mh, oh, meta, store := newTestMultipartHandler(t)
+	createTestBucketForMultipart(t, meta, store, "test-bucket")
+	const minPartSize = 5 * 1024 * 1024
+	uploadID, etags := uploadTestParts(t, mh, meta, "test-bucket", "parts", []int{minPartSize, minPartSize, 10})
+	body := completeMultipartUploadXML([]CompletePart{
+		{PartNumber: 1, ETag: etags[0]}, {PartNumber: 2, ETag: etags[1]}, {PartNumber: 3, ETag: etags[2]},
+	})
+	req := httptest.NewRequest("POST", "/test-bucket/parts?uploadId="+uploadID, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	mh.CompleteMultipartUpload(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CompleteMultipartUpload status = %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/test-bucket/parts?partNumber=2", nil)
+	rec = httptest.NewRecorder()
+	oh.GetObject(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("GetObject part 2 status = %d, want 206", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Range"); got != fmt.Sprintf("bytes %d-%d/%d", minPartSize, 2*minPartSize-1, 2*minPartSize+10) {
+		t.Errorf("Content-Range = %q", got)
+	}
+	if got := rec.Header().Get("x-amz-mp-parts-count"); got != "3" {
+		t.Errorf("x-amz-mp-parts-count = %q, want 3", got)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), bytes.Repeat([]byte("B"), minPartSize)) {
+		t.Errorf("part 2 body has %d bytes, want %d of B", rec.Body.Len(), minPartSize)
+	}
+
+	req = httptest.NewRequest("HEAD", "/test-bucket/parts?partNumber=3", nil)
+	rec = httptest.NewRecorder()
+	oh.HeadObject(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Header().Get("Content-Length") != "10" ||
+		rec.Header().Get("x-amz-mp-parts-count") != "3" {
+		t.Errorf("HeadObject part 3 = %d, Content-Length %q", rec.Code, rec.Header().Get("Content-Length"))
+	}
+
+	for _, tc := range []struct {
+		query, rangeHeader string
+		want               int
+	}{
+		{"partNumber=4", "", http.StatusRequestedRangeNotSatisfiable},
+		{"partNumber=0", "", http.StatusBadRequest},
+		{"partNumber=x", "", http.StatusBadRequest},
+		{"partNumber=1", "bytes=0-1", http.StatusBadRequest},
+	} {
+		req = httptest.NewRequest("GET", "/test-bucket/parts?"+tc.query, nil)
+		if tc.rangeHeader != "" {
+			req.Header.Set("Range", tc.rangeHeader)
+		}
+		rec = httptest.NewRecorder()
+		oh.GetObject(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("GetObject ?%s (Range %q) status = %d, want %d", tc.query, tc.rangeHeader, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestHeadObjectPartsCount(t *testing.T) {
+	mh, oh, meta, store := newTestMultipartHandler(t)
+	createTestBucketForMultipart(t, meta, store, "test-bucket")
+	const minPartSize = 5 * 1024 * 1024
+	uploadID, etags := uploadTestParts(t, mh, meta, "test-bucket", "parts", []int{minPartSize, 10})
+	body := completeMultipartUploadXML([]CompletePart{{PartNumber: 1, ETag: etags[0]}, {PartNumber: 2, ETag: etags[1]}})
+	req := httptest.NewRequest("POST", "/test-bucket/parts?uploadId="+uploadID, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	mh.CompleteMultipartUpload(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CompleteMultipartUpload status = %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("HEAD", "/test-bucket/parts", nil)
+	rec = httptest.NewRecorder()
+	oh.HeadObject(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HeadObject status = %d", rec.Code)
+	}
+	if got := rec.Header().Get("x-amz-mp-parts-count"); got != "2" {
+		t.Errorf("x-amz-mp-parts-count = %q, want 2", got)
+	}
+	if etag := rec.Header().Get("ETag"); !strings.HasSuffix(etag, `-2"`) {
+		t.Errorf("ETag = %s, want a composite ETag of 2 parts", etag)
+	}
+	if got := rec.Header().Get("Content-Length"); got != fmt.Sprint(minPartSize+10) {
+		t.Errorf("Content-Length = %q", got)
+	}
+
+	putTestObjects(t, oh, []string{"single"})
+	req = httptest.NewRequest("HEAD", "/test-bucket/single", nil)
+	rec = httptest.NewRecorder()
+	oh.HeadObject(rec, req)
+	if got := rec.Header().Get("x-amz-mp-parts-count"); got != "" {
+		t.Errorf("single-part object x-amz-mp-parts-count = %q, want none", got)
+	}
+
+	// A single-part object is its own part 1 and has no other.
+	req = httptest.NewRequest("HEAD", "/test-bucket/single?partNumber=1", nil)
+	rec = httptest.NewRecorder()
+	oh.HeadObject(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Header().Get("x-amz-mp-parts-count") != "" ||
+		rec.Header().Get("Content-Length") != fmt.Sprint(len("data for single")) {
+		t.Errorf("single-part HeadObject part 1 = %d, headers %v", rec.Code, rec.Header())
+	}
+	req = httptest.NewRequest("HEAD", "/test-bucket/single?partNumber=2", nil)
+	rec = httptest.NewRecorder()
+	oh.HeadObject(rec, req)
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("single-part HeadObject part 2 = %d, want 416", rec.Code)
+	}
+}
+
+func TestUploadPartCopyConditional(t *testing.T) {
+	mh, oh, meta, store := newTestMultipartHandler(t)
+	createTestBucketForMultipart(t, meta, store, "test-bucket")
+
+	body := "part copy source"
+	req := httptest.NewRequest("PUT", "/test-bucket/src", strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	rec := httptest.NewRecorder()
+	oh.PutObject(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PutObject status = %d", rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+
+	req = httptest.NewRequest("POST", "/test-bucket/dst?uploads", nil)
+	rec = httptest.NewRecorder()
+	mh.CreateMultipartUpload(rec, req)
+	var initResult xmlutil.InitiateMultipartUploadResult
+	xml.NewDecoder(rec.Body).Decode(&initResult)
+
+	futureDate := time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)
+	for i, tc := range []struct {
+		header, value string
+		want          int
+	}{
+		{"x-amz-copy-source-if-match", etag, http.StatusOK},
+		{"x-amz-copy-source-if-match", `"wrong-etag"`, http.StatusPreconditionFailed},
+		{"x-amz-copy-source-if-none-match", etag, http.StatusPreconditionFailed},
+		{"x-amz-copy-source-if-modified-since", futureDate, http.StatusPreconditionFailed},
+		{"x-amz-copy-source-if-unmodified-since", futureDate, http.StatusOK},
+	} {
+		req = httptest.NewRequest("PUT",
+			fmt.Sprintf("/test-bucket/dst?partNumber=%d&uploadId=%s", i+1, initResult.UploadID), nil)
+		req.Header.Set("X-Amz-Copy-Source", "/test-bucket/src")
+		req.Header.Set(tc.header, tc.value)
+		rec = httptest.NewRecorder()
+		mh.UploadPart(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("UploadPartCopy %s: %s status = %d, want %d; body: %s", tc.header, tc.value, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+
+	parts, err := meta.ListParts(context.Background(), initResult.UploadID, metadata.ListPartsOptions{MaxParts: 1000})
+	if err != nil {
+		t.Fatalf("ListParts: %v", err)
+	}
+	if len(parts.Parts) != 2 || parts.Parts[0].PartNumber != 1 || parts.Parts[1].PartNumber != 5 {
+		t.Errorf("parts after conditional copies = %+v, want parts 1 and 5", parts.Parts)
+	}
+}
@@ -2,22 +2,30 @@
 package handlers
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"strconv"
 	"strings"
-	"time"
 
+	"github.com/bleepstore/bleepstore/internal/clock"
 	s3err "github.com/bleepstore/bleepstore/internal/errors"
 	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/quota"
+	"github.com/bleepstore/bleepstore/internal/replication"
 	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/uid"
 	"github.com/bleepstore/bleepstore/internal/xmlutil"
 )
 
@@ -28,8 +36,39 @@ type ObjectHandler struct {
 	ownerID       string
 	ownerDisplay  string
 	maxObjectSize int64
+	quotas        *quota.Tracker
+	clock         clock.Clock
+	// inlineThreshold is the largest object stored in its metadata row
+	// instead of the storage backend (0 = never).
+	inlineThreshold int64
+	// prefetch receives the keys of x-bleepstore-prefetch hints (nil = ignored).
+	prefetch func(bucket string, keys []string)
+	// compression is the codec new objects are stored with ("" = none),
+	// limited to compressBuckets when that is non-nil.
+	compression     string
+	compressBuckets map[string]bool
+	replication     *replication.Rules
+	// multiRange is how GetObject answers a Range header listing several
+	// ranges ("" = MultiRangeMultipart).
+	multiRange string
+	// conditional commits conditional PutObjects atomically (nil = checked
+	// before committing).
+	conditional metadata.ConditionalPutStore
+	// conditionalWrites serializes conditional PutObjects of one key.
+	conditionalWrites keyLocks
 }
 
+// How GetObject answers a Range header listing several ranges.
+const (
+	// MultiRangeMultipart streams the ranges as a multipart/byteranges
+	// response.
+	MultiRangeMultipart = "multipart"
+	// MultiRangeIgnore serves the whole object, as Amazon S3 does.
+	MultiRangeIgnore = "ignore"
+	// MultiRangeReject answers 416 InvalidRange.
+	MultiRangeReject = "reject"
+)
+
 // NewObjectHandler creates a new ObjectHandler with the given dependencies.
 func NewObjectHandler(meta metadata.MetadataStore, store storage.StorageBackend, ownerID, ownerDisplay string, maxObjectSize int64) *ObjectHandler {
 	return &ObjectHandler{
@@ -38,9 +77,80 @@ func NewObjectHandler(meta metadata.MetadataStore, store storage.StorageBackend,
 		ownerID:       ownerID,
 		ownerDisplay:  ownerDisplay,
 		maxObjectSize: maxObjectSize,
+		clock:         clock.System{},
 	}
 }
 
+// SetClock replaces the clock used for object modification times.
+func (h *ObjectHandler) SetClock(c clock.Clock) {
+	h.clock = c
+}
+
+// SetQuotas makes writes and deletes enforce and track the given prefix
+// quotas. Passing nil disables enforcement.
+func (h *ObjectHandler) SetQuotas(q *quota.Tracker) {
+	h.quotas = q
+}
+
+// SetInlineThreshold stores objects of up to n bytes in their metadata row
+// instead of the storage backend. The metadata store must implement
+// metadata.InlineDataStore. Passing 0 disables inlining.
+func (h *ObjectHandler) SetInlineThreshold(n int64) {
+	h.inlineThreshold = n
+}
+
+// SetPrefetch makes GetObject pass the keys named in an x-bleepstore-prefetch
+// request header to fn, which must queue them for warming without blocking.
+// Passing nil ignores the header.
+func (h *ObjectHandler) SetPrefetch(fn func(bucket string, keys []string)) {
+	h.prefetch = fn
+}
+
+// SetCompression compresses the data of objects written by PutObject with
+// codec (storage.CodecZstd or storage.CodecGzip) before it reaches the
+// storage backend. If buckets is non-empty only those buckets are
+// compressed. Passing "" disables compression; existing compressed objects
+// stay readable either way.
+func (h *ObjectHandler) SetCompression(codec string, buckets []string) {
+	h.compression = codec
+	h.compressBuckets = nil
+	if len(buckets) > 0 {
+		h.compressBuckets = make(map[string]bool, len(buckets))
+		for _, b := range buckets {
+			h.compressBuckets[b] = true
+		}
+	}
+}
+
+// SetReplication marks new objects that a replication rule applies to as
+// PENDING and queues them, and the deletions of such objects, for
+// replication. Passing nil disables replication.
+func (h *ObjectHandler) SetReplication(rules *replication.Rules) {
+	h.replication = rules
+}
+
+// SetMultiRange sets how GetObject answers a Range header listing several
+// ranges: MultiRangeMultipart (the default), MultiRangeIgnore or
+// MultiRangeReject.
+func (h *ObjectHandler) SetMultiRange(mode string) {
+	h.multiRange = mode
+}
+
+// SetConditionalPuts makes PutObject commit writes with If-None-Match or
+// If-Match through cs, which checks the condition atomically with the
+// write. Passing nil checks the condition before committing.
+func (h *ObjectHandler) SetConditionalPuts(cs metadata.ConditionalPutStore) {
+	h.conditional = cs
+}
+
+// compressionFor returns the codec for new objects in bucket, or "".
+func (h *ObjectHandler) compressionFor(bucket string) string {
+	if h.compressBuckets != nil && !h.compressBuckets[bucket] {
+		return ""
+	}
+	return h.compression
+}
+
 // PutObject handles PUT /{bucket}/{object} and stores an object in the
 // specified bucket. Follows crash-only design: writes to temp file, fsyncs,
 // renames atomically, then commits metadata. Never acknowledges before commit.
@@ -51,8 +161,8 @@ func (h *ObjectHandler) PutObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
 
 	if key == "" {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
@@ -83,44 +193,31 @@ func (h *ObjectHandler) PutObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check If-None-Match: * header (create-only / no-overwrite semantics).
-	ifNoneMatch := r.Header.Get("If-None-Match")
-	if ifNoneMatch == "*" {
-		exists, existErr := h.meta.ObjectExists(ctx, bucketName, key)
-		if existErr != nil {
-			slog.Error("PutObject ObjectExists error", "error", existErr)
+	// If-None-Match: * only creates the object; If-Match only replaces the
+	// version with that ETag. The condition is checked here to fail before
+	// the body is stored, and again as the metadata is committed. Holding
+	// the key serializes conditional writes to it on this server.
+	cond, conditional := writeCondition(r)
+	if conditional {
+		defer h.conditionalWrites.lock(bucketName + "/" + key)()
+		current, curErr := h.meta.GetObject(ctx, bucketName, key)
+		if curErr != nil {
+			slog.Error("PutObject GetObject error", "error", curErr)
 			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
 			return
 		}
-		if exists {
+		if cond.Check(current) != nil {
 			xmlutil.WriteErrorResponse(w, r, s3err.ErrPreconditionFailed)
 			return
 		}
 	}
 
-	// Validate Content-MD5 if present.
-	contentMD5 := r.Header.Get("Content-MD5")
-	var bodyReader io.Reader = r.Body
-	if contentMD5 != "" {
-		expected, decodeErr := base64.StdEncoding.DecodeString(contentMD5)
-		if decodeErr != nil || len(expected) != 16 {
-			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidDigest)
-			return
-		}
-		// Read the entire body to compute MD5.
-		bodyBytes, readErr := io.ReadAll(r.Body)
-		if readErr != nil {
-			slog.Error("PutObject body read error", "error", readErr)
-			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
-			return
-		}
-		actual := md5.Sum(bodyBytes)
-		if !bytes.Equal(actual[:], expected) {
-			xmlutil.WriteErrorResponse(w, r, s3err.ErrBadDigest)
-			return
-		}
-		// Replace body with buffered reader for downstream consumption.
-		bodyReader = bytes.NewReader(bodyBytes)
+	// Verify Content-MD5 and x-amz-content-sha256, and cut off a body of
+	// unknown length at the size limit, as the body is stored.
+	bodyReader, digestErr := newPayloadVerifier(r, h.maxObjectSize)
+	if digestErr != nil {
+		xmlutil.WriteErrorResponse(w, r, digestErr)
+		return
 	}
 
 	// Extract content type, defaulting to application/octet-stream.
@@ -138,71 +235,258 @@ func (h *ObjectHandler) PutObject(w http.ResponseWriter, r *http.Request) {
 	contentDisposition := r.Header.Get("Content-Disposition")
 	cacheControl := r.Header.Get("Cache-Control")
 	expires := r.Header.Get("Expires")
-
-	// Extract optional canned ACL.
-	cannedACL := r.Header.Get("x-amz-acl")
-
-	// Validate mutually exclusive ACL modes.
-	if cannedACL != "" && hasGrantHeaders(r.Header) {
-		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
-			Code:       "InvalidArgument",
-			Message:    "Specifying both x-amz-acl and x-amz-grant headers is not allowed",
-			HTTPStatus: 400,
-		})
+	redirect, redirectErr := websiteRedirectLocation(r)
+	if redirectErr != nil {
+		xmlutil.WriteErrorResponse(w, r, redirectErr)
 		return
 	}
 
-	var aclJSON json.RawMessage
-	if cannedACL != "" {
-		acp := parseCannedACL(cannedACL, h.ownerID, h.ownerDisplay)
-		aclJSON = aclToJSON(acp)
-	} else if hasGrantHeaders(r.Header) {
-		acp := parseGrantHeaders(r.Header, h.ownerID, h.ownerDisplay)
+	// Optional canned ACL or grants; private by default. The object
+	// belongs to whoever writes it.
+	ownerID, ownerDisplay := rc.Owner(h.ownerID, h.ownerDisplay)
+	acp, aclErr := aclFromHeaders(r.Header, ownerID, ownerDisplay)
+	if aclErr != nil {
+		xmlutil.WriteErrorResponse(w, r, aclErr)
+		return
+	}
+	addBucketOwnerGrant(acp, r.Header.Get("x-amz-acl"), bucket)
+	aclJSON := defaultPrivateACL(ownerID, ownerDisplay)
+	if acp != nil {
 		aclJSON = aclToJSON(acp)
-	} else {
-		aclJSON = defaultPrivateACL(h.ownerID, h.ownerDisplay)
 	}
 
-	// Write object data to storage backend (atomic: temp-fsync-rename).
-	bytesWritten, etag, err := h.store.PutObject(ctx, bucketName, key, bodyReader, r.ContentLength)
-	if err != nil {
-		slog.Error("PutObject storage error", "error", err)
-		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+	// Reserve prefix quota before touching storage, since the write may
+	// replace existing data. Quota checks need the size up front.
+	if h.quotas.Applies(bucketName, key) && r.ContentLength < 0 {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrMissingContentLength)
 		return
 	}
+	reservation, quotaErr := reserveQuota(ctx, h.quotas, h.meta, bucketName, key, r.ContentLength, false)
+	if quotaErr != nil {
+		xmlutil.WriteErrorResponse(w, r, quotaErr)
+		return
+	}
+
+	var (
+		bytesWritten int64
+		etag         string
+		inline       []byte
+		compression  string
+		prev         *metadata.ObjectRecord
+		dataKey      = key
+	)
+	if h.inlineThreshold > 0 && r.ContentLength >= 0 && r.ContentLength <= h.inlineThreshold {
+		// Small objects live in the metadata row, committed below.
+		inline, err = readInline(bodyReader, r.ContentLength)
+		if digestErr = bodyReader.Err(); digestErr != nil {
+			reservation.Cancel()
+			xmlutil.WriteErrorResponse(w, r, digestErr)
+			return
+		}
+		if err == nil {
+			prev, err = h.meta.GetObject(ctx, bucketName, key)
+		}
+		if err != nil {
+			reservation.Cancel()
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				xmlutil.WriteErrorResponse(w, r, s3err.ErrIncompleteBody)
+				return
+			}
+			slog.Error("PutObject inline read error", "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		bytesWritten = int64(len(inline))
+		etag = inlineETag(inline)
+	} else {
+		// A conditional write committed by the metadata store stages its
+		// data under a key of its own and moves it into place once the
+		// condition holds, so a writer on another server that loses the
+		// race never replaces the winner's data.
+		if conditional && h.conditional != nil {
+			dataKey = stagingKey()
+		}
+		// Write object data to storage backend (atomic: temp-fsync-rename).
+		if compression = h.compressionFor(bucketName); compression != "" {
+			bytesWritten, etag, err = h.putCompressed(ctx, bucketName, dataKey, compression, bodyReader)
+		} else {
+			bytesWritten, etag, err = h.store.PutObject(ctx, bucketName, dataKey, bodyReader, r.ContentLength)
+		}
+		if digestErr = bodyReader.Err(); digestErr != nil {
+			reservation.Cancel()
+			h.dropStagedData(ctx, bucketName, key, dataKey)
+			xmlutil.WriteErrorResponse(w, r, digestErr)
+			return
+		}
+		if err != nil {
+			reservation.Cancel()
+			h.dropStagedData(ctx, bucketName, key, dataKey)
+			slog.Error("PutObject storage error", "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+	}
 
 	// Commit metadata to SQLite.
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	objRecord := &metadata.ObjectRecord{
-		Bucket:             bucketName,
-		Key:                key,
-		Size:               bytesWritten,
-		ETag:               etag,
-		ContentType:        contentType,
-		ContentEncoding:    contentEncoding,
-		ContentLanguage:    contentLanguage,
-		ContentDisposition: contentDisposition,
-		CacheControl:       cacheControl,
-		Expires:            expires,
-		StorageClass:       "STANDARD",
-		ACL:                aclJSON,
-		UserMetadata:       userMeta,
-		LastModified:       now,
-	}
-
-	if err := h.meta.PutObject(ctx, objRecord); err != nil {
+		Bucket:                  bucketName,
+		Key:                     key,
+		Size:                    bytesWritten,
+		ETag:                    etag,
+		ContentType:             contentType,
+		ContentEncoding:         contentEncoding,
+		ContentLanguage:         contentLanguage,
+		ContentDisposition:      contentDisposition,
+		CacheControl:            cacheControl,
+		Expires:                 expires,
+		StorageClass:            "STANDARD",
+		ACL:                     aclJSON,
+		UserMetadata:            userMeta,
+		LastModified:            now,
+		InlineData:              inline,
+		Compression:             compression,
+		ReplicationStatus:       h.replication.Status(bucketName, key),
+		WebsiteRedirectLocation: redirect,
+	}
+
+	if conditional && h.conditional != nil {
+		err = h.conditional.PutObjectIf(ctx, objRecord, cond)
+	} else {
+		err = h.meta.PutObject(ctx, objRecord)
+	}
+	if errors.Is(err, metadata.ErrPreconditionFailed) {
+		// Another server or an unconditional write changed the object
+		// after it was checked.
+		reservation.Cancel()
+		h.dropStagedData(ctx, bucketName, key, dataKey)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrPreconditionFailed)
+		return
+	}
+	if err != nil {
+		reservation.Cancel()
+		h.dropStagedData(ctx, bucketName, key, dataKey)
 		slog.Error("PutObject metadata error", "error", err)
 		// Storage write succeeded but metadata failed. The orphan file on disk
 		// is safe (crash-only: storage is the data, metadata is the index).
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
 		return
 	}
+	if err := h.promoteStagedData(ctx, objRecord, dataKey); err != nil {
+		slog.Error("PutObject staged data error", "bucket", bucketName, "key", key, "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	h.dropReplacedData(ctx, prev)
+	enqueueReplication(ctx, h.replication, objRecord)
 
 	// Success: set response headers and return 200.
 	w.Header().Set("ETag", etag)
 	w.WriteHeader(http.StatusOK)
 }
 
+// putCompressed writes body to the storage backend compressed with codec
+// and returns the size and ETag of the uncompressed body, which are what
+// the object's metadata records.
+func (h *ObjectHandler) putCompressed(ctx context.Context, bucket, key, codec string, body io.Reader) (int64, string, error) {
+	hash := md5.New()
+	counter := &countingReader{r: io.TeeReader(body, hash)}
+	compressed, err := storage.CompressReader(codec, counter)
+	if err != nil {
+		return 0, "", err
+	}
+	_, _, err = h.store.PutObject(ctx, bucket, key, compressed, -1)
+	compressed.Close()
+	if err != nil {
+		return 0, "", err
+	}
+	return counter.n, fmt.Sprintf(`"%x"`, hash.Sum(nil)), nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readInline reads exactly size bytes of an object body for inline storage.
+// A short body returns io.ErrUnexpectedEOF.
+func readInline(r io.Reader, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// inlineETag returns the ETag of an inline payload, computed as the storage
+// backends do.
+func inlineETag(data []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(data))
+}
+
+// stagingPrefix holds the data of conditional writes until their metadata
+// is committed.
+const stagingPrefix = ".bleepstore-staging/"
+
+// stagingKey returns a fresh storage key to stage a conditional write's
+// data under.
+func stagingKey() string {
+	return stagingPrefix + uid.New()
+}
+
+// dropStagedData removes the data staged under dataKey for a write of key
+// that failed. It does nothing for data written in place.
+func (h *ObjectHandler) dropStagedData(ctx context.Context, bucket, key, dataKey string) {
+	if dataKey == key {
+		return
+	}
+	if err := h.store.DeleteObject(context.WithoutCancel(ctx), bucket, dataKey); err != nil {
+		slog.Error("Staged data cleanup error", "bucket", bucket, "key", dataKey, "error", err)
+	}
+}
+
+// promoteStagedData moves the data staged under dataKey for the committed
+// write obj to obj's key. If a later write with other content has already
+// replaced obj's record, its data is the one in place and the staged copy
+// is dropped.
+func (h *ObjectHandler) promoteStagedData(ctx context.Context, obj *metadata.ObjectRecord, dataKey string) error {
+	if dataKey == obj.Key {
+		return nil
+	}
+	ctx = context.WithoutCancel(ctx)
+	defer h.dropStagedData(ctx, obj.Bucket, obj.Key, dataKey)
+	current, err := h.meta.GetObject(ctx, obj.Bucket, obj.Key)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.ETag != obj.ETag {
+		return nil
+	}
+	_, err = h.store.CopyObject(ctx, obj.Bucket, dataKey, obj.Bucket, obj.Key)
+	return err
+}
+
+// dropReplacedData removes prev's payload from the storage backend after an
+// inline write replaced it. Failures leave a safe orphan.
+func (h *ObjectHandler) dropReplacedData(ctx context.Context, prev *metadata.ObjectRecord) {
+	if prev == nil || prev.InlineData != nil {
+		return
+	}
+	if err := h.store.DeleteObject(ctx, prev.Bucket, prev.Key); err != nil {
+		slog.Error("Inline write storage cleanup error", "bucket", prev.Bucket, "key", prev.Key, "error", err)
+	}
+}
+
 // GetObject handles GET /{bucket}/{object} and retrieves the object data
 // and metadata from the specified bucket. Supports range requests (Range header)
 // and conditional requests (If-Match, If-None-Match, If-Modified-Since,
@@ -214,8 +498,8 @@ func (h *ObjectHandler) GetObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -254,8 +538,14 @@ func (h *ObjectHandler) GetObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Open object data from storage.
-	reader, _, _, err := h.store.GetObject(ctx, bucketName, key)
+	part, partErr := requestedPart(r, objMeta)
+	if partErr != nil {
+		xmlutil.WriteErrorResponse(w, r, partErr)
+		return
+	}
+
+	// Open object data from the metadata row or storage.
+	reader, err := openObjectData(ctx, h.store, objMeta)
 	if err != nil {
 		slog.Error("GetObject storage error", "error", err)
 		// Metadata exists but file is missing: log error, return 500.
@@ -264,31 +554,60 @@ func (h *ObjectHandler) GetObject(w http.ResponseWriter, r *http.Request) {
 	}
 	defer reader.Close()
 
+	if h.prefetch != nil {
+		if keys := parsePrefetchHeader(r.Header.Get(prefetchHeader), key); len(keys) > 0 {
+			h.prefetch(bucketName, keys)
+		}
+	}
+
+	// A partNumber request streams one part of the object.
+	if part != nil {
+		if err := skipTo(reader, part.start); err != nil {
+			slog.Error("GetObject seek error", "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		setObjectResponseHeaders(w, objMeta)
+		applyResponseOverrides(w, r)
+		w.WriteHeader(part.setHeaders(w, objMeta.Size))
+		io.CopyN(w, reader, part.size)
+		return
+	}
+
 	// Check for range request.
 	rangeHeader := r.Header.Get("Range")
+	if h.multiRange == MultiRangeIgnore && strings.Contains(rangeHeader, ",") {
+		rangeHeader = ""
+	}
 	if rangeHeader != "" {
-		start, end, rangeErr := parseRange(rangeHeader, objMeta.Size)
+		var ranges []byteRange
+		var rangeErr error
+		if h.multiRange == MultiRangeReject {
+			var rg byteRange
+			rg.start, rg.end, rangeErr = parseRange(rangeHeader, objMeta.Size)
+			ranges = []byteRange{rg}
+		} else {
+			ranges, rangeErr = parseRanges(rangeHeader, objMeta.Size)
+		}
 		if rangeErr != nil {
 			// 416 Range Not Satisfiable.
 			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", objMeta.Size))
 			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidRange)
 			return
 		}
+		if len(ranges) > 1 {
+			setObjectResponseHeaders(w, objMeta)
+			applyResponseOverrides(w, r)
+			writeByteRanges(w, reader, objMeta.Size, ranges)
+			return
+		}
+		start, end := ranges[0].start, ranges[0].end
 
 		// Seek to the start position.
-		if seeker, ok := reader.(io.ReadSeeker); ok {
-			if _, seekErr := seeker.Seek(start, io.SeekStart); seekErr != nil {
-				slog.Error("GetObject seek error", "error", seekErr)
-				xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
-				return
-			}
-		} else {
-			// Fall back to discarding bytes.
-			if _, discardErr := io.CopyN(io.Discard, reader, start); discardErr != nil {
-				slog.Error("GetObject discard error", "error", discardErr)
-				xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
-				return
-			}
+		if err := skipTo(reader, start); err != nil {
+			slog.Error("GetObject seek error", "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
 		}
 
 		rangeLen := end - start + 1
@@ -314,9 +633,71 @@ func (h *ObjectHandler) GetObject(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, reader)
 }
 
+// writeByteRanges streams ranges of an object of size bytes from reader,
+// which is at its start, as a 206 multipart/byteranges response. Each part
+// carries the Content-Type already set on w.
+func writeByteRanges(w http.ResponseWriter, reader io.Reader, size int64, ranges []byteRange) {
+	partType := w.Header().Get("Content-Type")
+	partHeader := func(rg byteRange) textproto.MIMEHeader {
+		return textproto.MIMEHeader{
+			"Content-Type":  {partType},
+			"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", rg.start, rg.end, size)},
+		}
+	}
+
+	// Size the body by writing the part framing alone.
+	counter := &countingWriter{}
+	mw := multipart.NewWriter(counter)
+	length := int64(0)
+	for _, rg := range ranges {
+		mw.CreatePart(partHeader(rg))
+		length += rg.end - rg.start + 1
+	}
+	mw.Close()
+	length += counter.n
+
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+
+	pw := multipart.NewWriter(w)
+	pw.SetBoundary(mw.Boundary())
+	pos := int64(0)
+	for _, rg := range ranges {
+		part, err := pw.CreatePart(partHeader(rg))
+		if err != nil {
+			return
+		}
+		if seeker, ok := reader.(io.Seeker); ok {
+			_, err = seeker.Seek(rg.start, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, reader, rg.start-pos)
+		}
+		if err != nil {
+			slog.Error("GetObject range read error", "error", err)
+			return
+		}
+		if _, err := io.CopyN(part, reader, rg.end-rg.start+1); err != nil {
+			return
+		}
+		pos = rg.end + 1
+	}
+	pw.Close()
+}
+
+// countingWriter counts the bytes written to it and discards them.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
 // HeadObject handles HEAD /{bucket}/{object} and returns the object metadata
 // without the object body. Supports conditional requests (If-Match,
-// If-None-Match, If-Modified-Since, If-Unmodified-Since).
+// If-None-Match, If-Modified-Since, If-Unmodified-Since) and ?partNumber=N.
 func (h *ObjectHandler) HeadObject(w http.ResponseWriter, r *http.Request) {
 	if h.meta == nil || h.store == nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -324,8 +705,8 @@ func (h *ObjectHandler) HeadObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -360,10 +741,27 @@ func (h *ObjectHandler) HeadObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	part, partErr := requestedPart(r, objMeta)
+	if partErr != nil {
+		w.WriteHeader(partErr.HTTPStatus)
+		return
+	}
+
 	// Set response headers from metadata (includes Content-Length, ETag, etc.).
 	setObjectResponseHeaders(w, objMeta)
 	applyResponseOverrides(w, r)
 
+	if part != nil {
+		w.WriteHeader(part.setHeaders(w, objMeta.Size))
+		return
+	}
+	// Advertise the part count of multipart objects so parallel downloaders
+	// can size their requests from a plain HEAD. It matches the -N suffix of
+	// the composite ETag. Objects completed before part sizes were recorded
+	// are served as one part and do not advertise a count.
+	if n := len(objMeta.PartSizes); n > 0 {
+		w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(n))
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -376,8 +774,8 @@ func (h *ObjectHandler) DeleteObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -391,8 +789,15 @@ func (h *ObjectHandler) DeleteObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	reservation, quotaErr := reserveQuota(ctx, h.quotas, h.meta, bucketName, key, 0, true)
+	if quotaErr != nil {
+		xmlutil.WriteErrorResponse(w, r, quotaErr)
+		return
+	}
+
 	// Delete metadata first (the authoritative record).
 	if err := h.meta.DeleteObject(ctx, bucketName, key); err != nil {
+		reservation.Cancel()
 		slog.Error("DeleteObject metadata error", "error", err)
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
 		return
@@ -403,6 +808,7 @@ func (h *ObjectHandler) DeleteObject(w http.ResponseWriter, r *http.Request) {
 		slog.Error("DeleteObject storage error", "error", err)
 		// Don't fail the request -- metadata is already deleted.
 	}
+	enqueueReplicatedDelete(ctx, h.replication, bucketName, key)
 
 	// S3 always returns 204 for DeleteObject, even if the key didn't exist.
 	w.WriteHeader(http.StatusNoContent)
@@ -417,7 +823,8 @@ func (h *ObjectHandler) DeleteObjects(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
+	rc := requestContext(r)
+	bucketName := rc.Bucket
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -464,15 +871,28 @@ func (h *ObjectHandler) DeleteObjects(w http.ResponseWriter, r *http.Request) {
 
 	result := &xmlutil.DeleteResult{}
 
-	// Collect all keys for batch metadata delete.
+	// Collect all keys for batch metadata delete, releasing their quota.
 	allKeys := make([]string, len(deleteReq.Objects))
+	var reservations []*quota.Reservation
 	for i, obj := range deleteReq.Objects {
 		allKeys[i] = obj.Key
+		reservation, quotaErr := reserveQuota(ctx, h.quotas, h.meta, bucketName, obj.Key, 0, true)
+		if quotaErr != nil {
+			for _, res := range reservations {
+				res.Cancel()
+			}
+			xmlutil.WriteErrorResponse(w, r, quotaErr)
+			return
+		}
+		reservations = append(reservations, reservation)
 	}
 
 	// Batch delete metadata (authoritative record).
 	deleted, errs := h.meta.DeleteObjectsMeta(ctx, bucketName, allKeys)
 	if len(errs) > 0 {
+		for _, res := range reservations {
+			res.Cancel()
+		}
 		for _, e := range errs {
 			slog.Error("DeleteObjects metadata batch error", "error", e)
 		}
@@ -493,6 +913,7 @@ func (h *ObjectHandler) DeleteObjects(w http.ResponseWriter, r *http.Request) {
 		if err := h.store.DeleteObject(ctx, bucketName, key); err != nil {
 			slog.Error("DeleteObjects storage error", "key", key, "error", err)
 		}
+		enqueueReplicatedDelete(ctx, h.replication, bucketName, key)
 	}
 
 	// Report successful deletes (unless quiet mode).
@@ -505,6 +926,301 @@ func (h *ObjectHandler) DeleteObjects(w http.ResponseWriter, r *http.Request) {
 	xmlutil.RenderDeleteResult(w, result)
 }
 
+const (
+	// maxBatchKeys is the most keys one HeadObjects or BulkGetObjects
+	// request may name, matching the DeleteObjects limit.
+	maxBatchKeys = 1000
+	// maxBatchBody bounds a batch request body: 1000 keys of the maximum
+	// 1024 bytes, JSON-escaped, fit comfortably.
+	maxBatchBody = 8 << 20
+	// headBatchWorkers is the number of metadata lookups run at once, so a
+	// remote metadata engine does not pay its round trip once per key.
+	headBatchWorkers = 16
+)
+
+// headBatchRequest is the JSON body of a HeadObjects request.
+type headBatchRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// headBatchObject is one key's entry in a HeadObjects response. Only Key and
+// Found are set for a key that does not exist, and Error as well for one
+// the caller may not read.
+type headBatchObject struct {
+	Key                string            `json:"key"`
+	Found              bool              `json:"found"`
+	Error              string            `json:"error,omitempty"`
+	Size               int64             `json:"size,omitempty"`
+	ETag               string            `json:"etag,omitempty"`
+	LastModified       string            `json:"last_modified,omitempty"`
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentLanguage    string            `json:"content_language,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	Expires            string            `json:"expires,omitempty"`
+	StorageClass       string            `json:"storage_class,omitempty"`
+	PartsCount         int               `json:"parts_count,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// headBatchResponse is the JSON body returned by HeadObjects.
+type headBatchResponse struct {
+	Bucket  string            `json:"bucket"`
+	Objects []headBatchObject `json:"objects"`
+}
+
+// HeadObjects handles the BleepStore extension POST /{bucket}?bleepstore-head-batch,
+// returning the metadata of up to 1000 objects in one response. The body is
+// {"keys": [...]}; the response lists one entry per key in request order,
+// with "found": false for keys that do not exist, and "error":
+// "AccessDenied" as well for objects whose ACL refuses the caller.
+func (h *ObjectHandler) HeadObjects(w http.ResponseWriter, r *http.Request) {
+	if h.meta == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	ctx := r.Context()
+	rc := requestContext(r)
+	bucketName := rc.Bucket
+
+	bucket, err := h.meta.GetBucket(ctx, bucketName)
+	if err != nil {
+		slog.Error("HeadObjects GetBucket error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	if bucket == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return
+	}
+
+	var req headBatchRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBody)).Decode(&req); err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidRequest)
+		return
+	}
+	if len(req.Keys) == 0 || len(req.Keys) > maxBatchKeys {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidRequest)
+		return
+	}
+
+	objects := make([]headBatchObject, len(req.Keys))
+	errs := make([]error, len(req.Keys))
+	next := make(chan int)
+	done := make(chan struct{})
+	workers := min(headBatchWorkers, len(req.Keys))
+	for range workers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for i := range next {
+				var obj *metadata.ObjectRecord
+				obj, errs[i] = h.meta.GetObject(ctx, bucketName, req.Keys[i])
+				if obj != nil && !rc.readable(obj) {
+					objects[i] = headBatchObject{Key: req.Keys[i], Error: s3err.ErrAccessDenied.Code}
+					continue
+				}
+				objects[i] = newHeadBatchObject(req.Keys[i], obj)
+			}
+		}()
+	}
+	for i := range req.Keys {
+		next <- i
+	}
+	close(next)
+	for range workers {
+		<-done
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			slog.Error("HeadObjects metadata error", "key", req.Keys[i], "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(headBatchResponse{Bucket: bucketName, Objects: objects})
+}
+
+// newHeadBatchObject converts an object record, or nil for a missing key, to
+// its HeadObjects entry.
+func newHeadBatchObject(key string, obj *metadata.ObjectRecord) headBatchObject {
+	if obj == nil {
+		return headBatchObject{Key: key}
+	}
+	return headBatchObject{
+		Key:                key,
+		Found:              true,
+		Size:               obj.Size,
+		ETag:               obj.ETag,
+		LastModified:       xmlutil.FormatTimeS3(obj.LastModified),
+		ContentType:        obj.ContentType,
+		ContentEncoding:    obj.ContentEncoding,
+		ContentLanguage:    obj.ContentLanguage,
+		ContentDisposition: obj.ContentDisposition,
+		CacheControl:       obj.CacheControl,
+		Expires:            obj.Expires,
+		StorageClass:       obj.StorageClass,
+		PartsCount:         len(obj.PartSizes),
+		Metadata:           obj.UserMetadata,
+	}
+}
+
+// bulkGetRequest is the JSON body of a BulkGetObjects request: either a key
+// list, or a prefix to stream every object under in key order.
+type bulkGetRequest struct {
+	Keys   []string `json:"keys"`
+	Prefix *string  `json:"prefix"`
+	// StartAfter resumes a prefix stream after the last key received.
+	StartAfter string `json:"start_after"`
+	// MaxKeys caps the objects in a prefix stream (0 = no limit).
+	MaxKeys int `json:"max_keys"`
+}
+
+// BulkGet PAX records added to each tar entry.
+const (
+	bulkGetETagRecord        = "BLEEPSTORE.etag"
+	bulkGetContentTypeRecord = "BLEEPSTORE.content-type"
+	bulkGetErrorRecord       = "BLEEPSTORE.error"
+)
+
+// BulkGetObjects handles the BleepStore extension POST /{bucket}?bleepstore-bulk-get,
+// streaming many objects in one response as a tar archive so colocated
+// consumers avoid a request per small object. The body is {"keys": [...]}
+// (up to 1000, streamed in request order) or {"prefix": "..."} with optional
+// "start_after" and "max_keys" (streamed in key order).
+//
+// Each object is a regular file entry named by its key, with its ETag and
+// Content-Type in BLEEPSTORE.etag and BLEEPSTORE.content-type PAX records. A
+// key that does not exist, whose ACL refuses the caller, or that cannot be
+// read is an empty entry with a BLEEPSTORE.error record ("NoSuchKey",
+// "AccessDenied" or "InternalError"). If an object
+// fails mid-copy the stream ends without the tar end-of-archive marker, which
+// tar readers report as a truncated archive.
+func (h *ObjectHandler) BulkGetObjects(w http.ResponseWriter, r *http.Request) {
+	if h.meta == nil || h.store == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	ctx := r.Context()
+	rc := requestContext(r)
+	bucketName := rc.Bucket
+
+	bucket, err := h.meta.GetBucket(ctx, bucketName)
+	if err != nil {
+		slog.Error("BulkGetObjects GetBucket error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	if bucket == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return
+	}
+
+	var req bulkGetRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBody)).Decode(&req); err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidRequest)
+		return
+	}
+	if (len(req.Keys) == 0) == (req.Prefix == nil) || len(req.Keys) > maxBatchKeys || req.MaxKeys < 0 {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.WriteHeader(http.StatusOK)
+	tw := tar.NewWriter(w)
+
+	if req.Prefix == nil {
+		for _, key := range req.Keys {
+			if !h.writeBulkGetEntry(ctx, tw, rc, key) {
+				return
+			}
+		}
+		tw.Close()
+		return
+	}
+
+	marker := req.StartAfter
+	sent := 0
+	for {
+		pageSize := maxBatchKeys
+		if req.MaxKeys > 0 {
+			pageSize = min(pageSize, req.MaxKeys-sent)
+		}
+		page, err := h.meta.ListObjects(ctx, bucketName, metadata.ListObjectsOptions{
+			Prefix:  *req.Prefix,
+			Marker:  marker,
+			MaxKeys: pageSize,
+		})
+		if err != nil {
+			slog.Error("BulkGetObjects list error", "bucket", bucketName, "error", err)
+			return
+		}
+		for _, obj := range page.Objects {
+			if !h.writeBulkGetEntry(ctx, tw, rc, obj.Key) {
+				return
+			}
+			marker = obj.Key
+			sent++
+		}
+		if !page.IsTruncated || len(page.Objects) == 0 || (req.MaxKeys > 0 && sent >= req.MaxKeys) {
+			break
+		}
+	}
+	tw.Close()
+}
+
+// writeBulkGetEntry writes key of the request's bucket to tw as one tar
+// entry, or an error entry if the caller may not read it. It returns false
+// if the stream is broken and must end without the end-of-archive marker.
+func (h *ObjectHandler) writeBulkGetEntry(ctx context.Context, tw *tar.Writer, rc *RequestContext, key string) bool {
+	bucket := rc.Bucket
+	hdr := &tar.Header{Name: key, Mode: 0o644, Typeflag: tar.TypeReg, Format: tar.FormatPAX}
+	fail := func(code string) bool {
+		hdr.PAXRecords = map[string]string{bulkGetErrorRecord: code}
+		return tw.WriteHeader(hdr) == nil
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	obj, err := h.meta.GetObject(ctx, bucket, key)
+	if err != nil {
+		slog.Error("BulkGetObjects metadata error", "key", key, "error", err)
+		return fail(s3err.ErrInternalError.Code)
+	}
+	if obj == nil {
+		return fail(s3err.ErrNoSuchKey.Code)
+	}
+	if !rc.readable(obj) {
+		return fail(s3err.ErrAccessDenied.Code)
+	}
+	reader, err := openObjectData(ctx, h.store, obj)
+	if err != nil {
+		slog.Error("BulkGetObjects storage error", "key", key, "error", err)
+		return fail(s3err.ErrInternalError.Code)
+	}
+	defer reader.Close()
+
+	hdr.Size = obj.Size
+	hdr.ModTime = obj.LastModified
+	hdr.PAXRecords = map[string]string{bulkGetETagRecord: obj.ETag, bulkGetContentTypeRecord: obj.ContentType}
+	if err := tw.WriteHeader(hdr); err != nil {
+		slog.Error("BulkGetObjects write error", "key", key, "error", err)
+		return false
+	}
+	if _, err := io.CopyN(tw, reader, obj.Size); err != nil {
+		slog.Error("BulkGetObjects copy error", "key", key, "error", err)
+		return false
+	}
+	return true
+}
+
 // CopyObject handles PUT /{bucket}/{object} with an X-Amz-Copy-Source header,
 // copying an object from one location to another. Supports x-amz-metadata-directive:
 // COPY (default, copy source metadata) or REPLACE (use request headers).
@@ -515,8 +1231,8 @@ func (h *ObjectHandler) CopyObject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	dstBucket := extractBucketName(r)
-	dstKey := extractObjectKey(r)
+	rc := requestContext(r)
+	dstBucket, dstKey := rc.Bucket, rc.Key
 
 	if dstKey == "" {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
@@ -530,6 +1246,17 @@ func (h *ObjectHandler) CopyObject(w http.ResponseWriter, r *http.Request) {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
 		return
 	}
+	redirect, redirectErr := websiteRedirectLocation(r)
+	if redirectErr != nil {
+		xmlutil.WriteErrorResponse(w, r, redirectErr)
+		return
+	}
+	ownerID, ownerDisplay := rc.Owner(h.ownerID, h.ownerDisplay)
+	acp, aclErr := aclFromHeaders(r.Header, ownerID, ownerDisplay)
+	if aclErr != nil {
+		xmlutil.WriteErrorResponse(w, r, aclErr)
+		return
+	}
 
 	// Verify destination bucket exists.
 	dstBucketRec, err := h.meta.GetBucket(ctx, dstBucket)
@@ -542,6 +1269,7 @@ func (h *ObjectHandler) CopyObject(w http.ResponseWriter, r *http.Request) {
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
 		return
 	}
+	addBucketOwnerGrant(acp, r.Header.Get("x-amz-acl"), dstBucketRec)
 
 	// Verify source bucket exists.
 	srcBucketRec, err := h.meta.GetBucket(ctx, srcBucket)
@@ -573,9 +1301,31 @@ func (h *ObjectHandler) CopyObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Copy file data via storage backend (atomic).
-	newETag, err := h.store.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey)
+	reservation, quotaErr := reserveQuota(ctx, h.quotas, h.meta, dstBucket, dstKey, srcObj.Size, false)
+	if quotaErr != nil {
+		xmlutil.WriteErrorResponse(w, r, quotaErr)
+		return
+	}
+
+	// Copy file data via storage backend (atomic). An inline source is
+	// copied inline, replacing whatever the destination held. A compressed
+	// source is copied as stored, so the backend's ETag describes the
+	// compressed bytes and the source's ETag is kept instead.
+	var (
+		newETag string
+		prev    *metadata.ObjectRecord
+	)
+	if srcObj.InlineData != nil {
+		newETag = srcObj.ETag
+		prev, err = h.meta.GetObject(ctx, dstBucket, dstKey)
+	} else {
+		newETag, err = h.store.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey)
+		if err == nil && srcObj.Compression != "" {
+			newETag = srcObj.ETag
+		}
+	}
 	if err != nil {
+		reservation.Cancel()
 		slog.Error("CopyObject storage error", "error", err)
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
 		return
@@ -587,7 +1337,7 @@ func (h *ObjectHandler) CopyObject(w http.ResponseWriter, r *http.Request) {
 		directive = "COPY"
 	}
 
-	now := time.Now().UTC()
+	now := h.clock.Now().UTC()
 	var dstObj *metadata.ObjectRecord
 
 	if directive == "REPLACE" {
@@ -599,13 +1349,9 @@ func (h *ObjectHandler) CopyObject(w http.ResponseWriter, r *http.Request) {
 
 		userMeta := extractUserMetadata(r)
 
-		cannedACL := r.Header.Get("x-amz-acl")
-		var aclJSON json.RawMessage
-		if cannedACL != "" {
-			acp := parseCannedACL(cannedACL, h.ownerID, h.ownerDisplay)
+		aclJSON := defaultPrivateACL(ownerID, ownerDisplay)
+		if acp != nil {
 			aclJSON = aclToJSON(acp)
-		} else {
-			aclJSON = defaultPrivateACL(h.ownerID, h.ownerDisplay)
 		}
 
 		dstObj = &metadata.ObjectRecord{
@@ -642,14 +1388,33 @@ func (h *ObjectHandler) CopyObject(w http.ResponseWriter, r *http.Request) {
 			UserMetadata:       srcObj.UserMetadata,
 			LastModified:       now,
 		}
+		// An ACL in the request applies whatever the directive, and the
+		// source ACL is only kept for a copy by its owner.
+		if acp != nil {
+			dstObj.ACL = aclToJSON(acp)
+		} else if srcOwner, _ := objectOwner(srcObj, h.ownerID, h.ownerDisplay); srcOwner != ownerID {
+			dstObj.ACL = defaultPrivateACL(ownerID, ownerDisplay)
+		}
 	}
 
+	dstObj.InlineData = srcObj.InlineData
+	dstObj.Compression = srcObj.Compression
+	dstObj.ReplicationStatus = h.replication.Status(dstBucket, dstKey)
+	// Like S3, the redirect is never copied from the source, whatever the
+	// metadata directive: it comes from the request or is not set.
+	dstObj.WebsiteRedirectLocation = redirect
+
 	// Commit metadata for the destination object.
 	if err := h.meta.PutObject(ctx, dstObj); err != nil {
+		reservation.Cancel()
 		slog.Error("CopyObject metadata error", "error", err)
 		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
 		return
 	}
+	if srcObj.InlineData != nil {
+		h.dropReplacedData(ctx, prev)
+	}
+	enqueueReplication(ctx, h.replication, dstObj)
 
 	// Return CopyObjectResult XML.
 	result := &xmlutil.CopyObjectResult{
@@ -668,8 +1433,9 @@ func (h *ObjectHandler) ListObjectsV2(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	q := r.URL.Query()
+	rc := requestContext(r)
+	bucketName := rc.Bucket
+	q := rc.Query
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -689,6 +1455,7 @@ func (h *ObjectHandler) ListObjectsV2(w http.ResponseWriter, r *http.Request) {
 	startAfter := q.Get("start-after")
 	continuationToken := q.Get("continuation-token")
 	encodingType := q.Get("encoding-type")
+	fetchOwner := q.Get("fetch-owner") == "true"
 
 	maxKeys := 1000 // Default
 	if mk := q.Get("max-keys"); mk != "" {
@@ -697,6 +1464,15 @@ func (h *ObjectHandler) ListObjectsV2(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if encodingType != "" && encodingType != "url" {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "InvalidEncodingType",
+			Message:    "Invalid EncodingType specified",
+			HTTPStatus: 400,
+		})
+		return
+	}
+
 	opts := metadata.ListObjectsOptions{
 		Prefix:            prefix,
 		Delimiter:         delimiter,
@@ -712,19 +1488,11 @@ func (h *ObjectHandler) ListObjectsV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if encodingType != "" && encodingType != "url" {
-		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
-			Code:       "InvalidEncodingType",
-			Message:    "Invalid EncodingType specified",
-			HTTPStatus: 400,
-		})
-		return
-	}
-
-	// Build XML response.
+	// Build XML response. With encoding-type=url every key-valued element
+	// is URL-encoded, so keys holding characters XML cannot carry survive.
 	result := &xmlutil.ListBucketV2Result{
 		Name:         bucketName,
-		Prefix:       prefix,
+		Prefix:       xmlutil.EncodeKeyURL(prefix, encodingType),
 		MaxKeys:      maxKeys,
 		KeyCount:     len(listResult.Objects),
 		IsTruncated:  listResult.IsTruncated,
@@ -732,11 +1500,11 @@ func (h *ObjectHandler) ListObjectsV2(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if delimiter != "" {
-		result.Delimiter = delimiter
+		result.Delimiter = xmlutil.EncodeKeyURL(delimiter, encodingType)
 	}
 
 	if startAfter != "" {
-		result.StartAfter = startAfter
+		result.StartAfter = xmlutil.EncodeKeyURL(startAfter, encodingType)
 	}
 
 	if continuationToken != "" {
@@ -747,15 +1515,20 @@ func (h *ObjectHandler) ListObjectsV2(w http.ResponseWriter, r *http.Request) {
 		result.NextContinuationToken = listResult.NextContinuationToken
 	}
 
-	// Convert objects to XML Objects.
-	for _, obj := range listResult.Objects {
-		result.Contents = append(result.Contents, xmlutil.Object{
+	// Convert objects to XML Objects. V2 reports owners only on request.
+	for i := range listResult.Objects {
+		obj := &listResult.Objects[i]
+		item := xmlutil.Object{
 			Key:          xmlutil.EncodeKeyURL(obj.Key, encodingType),
 			LastModified: xmlutil.FormatTimeS3(obj.LastModified),
 			ETag:         obj.ETag,
 			Size:         obj.Size,
 			StorageClass: obj.StorageClass,
-		})
+		}
+		if fetchOwner {
+			item.Owner = h.listingOwner(obj, bucket)
+		}
+		result.Contents = append(result.Contents, item)
 	}
 
 	// Convert common prefixes.
@@ -777,8 +1550,9 @@ func (h *ObjectHandler) ListObjects(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	q := r.URL.Query()
+	rc := requestContext(r)
+	bucketName := rc.Bucket
+	q := rc.Query
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -805,6 +1579,15 @@ func (h *ObjectHandler) ListObjects(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if encodingType != "" && encodingType != "url" {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "InvalidEncodingType",
+			Message:    "Invalid EncodingType specified",
+			HTTPStatus: 400,
+		})
+		return
+	}
+
 	opts := metadata.ListObjectsOptions{
 		Prefix:    prefix,
 		Delimiter: delimiter,
@@ -819,41 +1602,34 @@ func (h *ObjectHandler) ListObjects(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if encodingType != "" && encodingType != "url" {
-		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
-			Code:       "InvalidEncodingType",
-			Message:    "Invalid EncodingType specified",
-			HTTPStatus: 400,
-		})
-		return
-	}
-
-	// Build XML response.
+	// Build XML response, URL-encoding key-valued elements as for V2.
 	result := &xmlutil.ListBucketResult{
 		Name:         bucketName,
-		Prefix:       prefix,
-		Marker:       marker,
+		Prefix:       xmlutil.EncodeKeyURL(prefix, encodingType),
+		Marker:       xmlutil.EncodeKeyURL(marker, encodingType),
 		MaxKeys:      maxKeys,
 		IsTruncated:  listResult.IsTruncated,
 		EncodingType: encodingType,
 	}
 
 	if delimiter != "" {
-		result.Delimiter = delimiter
+		result.Delimiter = xmlutil.EncodeKeyURL(delimiter, encodingType)
 	}
 
 	if listResult.IsTruncated && listResult.NextMarker != "" {
-		result.NextMarker = listResult.NextMarker
+		result.NextMarker = xmlutil.EncodeKeyURL(listResult.NextMarker, encodingType)
 	}
 
-	// Convert objects to XML Objects.
-	for _, obj := range listResult.Objects {
+	// Convert objects to XML Objects. V1 always reports owners.
+	for i := range listResult.Objects {
+		obj := &listResult.Objects[i]
 		result.Contents = append(result.Contents, xmlutil.Object{
 			Key:          xmlutil.EncodeKeyURL(obj.Key, encodingType),
 			LastModified: xmlutil.FormatTimeS3(obj.LastModified),
 			ETag:         obj.ETag,
 			Size:         obj.Size,
 			StorageClass: obj.StorageClass,
+			Owner:        h.listingOwner(obj, bucket),
 		})
 	}
 
@@ -876,8 +1652,8 @@ func (h *ObjectHandler) GetObjectAcl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -904,16 +1680,17 @@ func (h *ObjectHandler) GetObjectAcl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse ACL from stored JSON.
+	ownerID, ownerDisplay := objectOwner(objMeta, h.ownerID, h.ownerDisplay)
 	acp := aclFromJSON(objMeta.ACL)
 	if acp == nil {
 		// No ACL stored: return default private ACL.
-		acp = parseCannedACL("private", h.ownerID, h.ownerDisplay)
+		acp = parseCannedACL("private", ownerID, ownerDisplay)
 	}
 
 	// Ensure Owner is set correctly.
 	acp.Owner = xmlutil.Owner{
-		ID:          h.ownerID,
-		DisplayName: h.ownerDisplay,
+		ID:          ownerID,
+		DisplayName: ownerDisplay,
 	}
 
 	xmlutil.RenderAccessControlPolicy(w, acp)
@@ -928,8 +1705,8 @@ func (h *ObjectHandler) PutObjectAcl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	bucketName := extractBucketName(r)
-	key := extractObjectKey(r)
+	rc := requestContext(r)
+	bucketName, key := rc.Bucket, rc.Key
 
 	// Verify bucket exists.
 	bucket, err := h.meta.GetBucket(ctx, bucketName)
@@ -955,31 +1732,19 @@ func (h *ObjectHandler) PutObjectAcl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate mutually exclusive ACL modes: canned ACL and grant headers
-	// cannot be specified together.
-	cannedACL := r.Header.Get("x-amz-acl")
-	if cannedACL != "" && hasGrantHeaders(r.Header) {
-		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
-			Code:       "InvalidArgument",
-			Message:    "Specifying both x-amz-acl and x-amz-grant headers is not allowed",
-			HTTPStatus: 400,
-		})
-		return
-	}
-
-	var acp *xmlutil.AccessControlPolicy
-
 	// Three mutually exclusive modes:
 	// 1. Canned ACL via x-amz-acl header
 	// 2. Explicit grants via x-amz-grant-* headers
 	// 3. XML body
-	if cannedACL != "" {
-		// Mode 1: Canned ACL.
-		acp = parseCannedACL(cannedACL, h.ownerID, h.ownerDisplay)
-	} else if hasGrantHeaders(r.Header) {
-		// Mode 2: Explicit grants via x-amz-grant-* headers.
-		acp = parseGrantHeaders(r.Header, h.ownerID, h.ownerDisplay)
-	} else if r.ContentLength > 0 {
+	// The object keeps its owner whatever the new ACL says.
+	ownerID, ownerDisplay := objectOwner(objMeta, h.ownerID, h.ownerDisplay)
+	acp, aclErr := aclFromHeaders(r.Header, ownerID, ownerDisplay)
+	if aclErr != nil {
+		xmlutil.WriteErrorResponse(w, r, aclErr)
+		return
+	}
+	addBucketOwnerGrant(acp, r.Header.Get("x-amz-acl"), bucket)
+	if acp == nil && r.ContentLength > 0 {
 		// Mode 3: XML body.
 		body, readErr := io.ReadAll(io.LimitReader(r.Body, 1<<20)) // 1 MB max
 		if readErr != nil {
@@ -991,10 +1756,11 @@ func (h *ObjectHandler) PutObjectAcl(w http.ResponseWriter, r *http.Request) {
 			xmlutil.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
 			return
 		}
-	} else {
+	} else if acp == nil {
 		// No canned ACL, no grant headers, and no body: default to private.
-		acp = parseCannedACL("private", h.ownerID, h.ownerDisplay)
+		acp = parseCannedACL("private", ownerID, ownerDisplay)
 	}
+	acp.Owner = xmlutil.Owner{ID: ownerID, DisplayName: ownerDisplay}
 
 	// Store the ACL.
 	aclJSON := aclToJSON(acp)
@@ -1006,18 +1772,3 @@ func (h *ObjectHandler) PutObjectAcl(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
-
-// extractObjectKey extracts the object key from the request URL path.
-// The key is everything after the bucket name in the path.
-func extractObjectKey(r *http.Request) string {
-	path := r.URL.Path
-	if len(path) > 0 && path[0] == '/' {
-		path = path[1:]
-	}
-	// Find the first slash to separate bucket from key.
-	idx := strings.IndexByte(path, '/')
-	if idx < 0 {
-		return ""
-	}
-	return path[idx+1:]
-}
@@ -1,16 +1,32 @@
 package handlers
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/bleepstore/bleepstore/internal/metadata"
 	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
 )
 
 // newTestObjectHandler creates an ObjectHandler backed by real in-memory
@@ -329,6 +345,60 @@ func TestPutObjectWithUserMetadata(t *testing.T) {
 	}
 }
 
+func TestPutObjectWebsiteRedirectLocation(t *testing.T) {
+	h := newTestObjectHandler(t)
+	put := func(key, redirect string) int {
+		req := httptest.NewRequest("PUT", "/test-bucket/"+key, strings.NewReader("x"))
+		req.Header.Set("x-amz-website-redirect-location", redirect)
+		req.ContentLength = 1
+		rec := httptest.NewRecorder()
+		h.PutObject(rec, req)
+		return rec.Code
+	}
+	head := func(key string) string {
+		req := httptest.NewRequest("HEAD", "/test-bucket/"+key, nil)
+		rec := httptest.NewRecorder()
+		h.HeadObject(rec, req)
+		return rec.Header().Get("x-amz-website-redirect-location")
+	}
+
+	for _, loc := range []string{"/new/page.html", "https://example.com/"} {
+		if code := put("old.html", loc); code != http.StatusOK {
+			t.Fatalf("PutObject with redirect %q status = %d", loc, code)
+		}
+		if got := head("old.html"); got != loc {
+			t.Errorf("HeadObject redirect = %q, want %q", got, loc)
+		}
+	}
+	for _, loc := range []string{"page.html", "ftp://example.com/", "/" + strings.Repeat("a", maxWebsiteRedirectLength)} {
+		if code := put("bad.html", loc); code != http.StatusBadRequest {
+			t.Errorf("PutObject with redirect %.20q status = %d, want 400", loc, code)
+		}
+	}
+
+	// A copy takes the redirect from the request, never from the source.
+	copyObject := func(directive, redirect string) string {
+		req := httptest.NewRequest("PUT", "/test-bucket/copy.html", nil)
+		req.Header.Set("X-Amz-Copy-Source", "/test-bucket/old.html")
+		req.Header.Set("x-amz-metadata-directive", directive)
+		if redirect != "" {
+			req.Header.Set("x-amz-website-redirect-location", redirect)
+		}
+		rec := httptest.NewRecorder()
+		h.CopyObject(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("CopyObject (%s) status = %d; body: %s", directive, rec.Code, rec.Body.String())
+		}
+		return head("copy.html")
+	}
+	if got := copyObject("COPY", ""); got != "" {
+		t.Errorf("redirect after COPY = %q, want none", got)
+	}
+	if got := copyObject("REPLACE", "/elsewhere"); got != "/elsewhere" {
+		t.Errorf("redirect after REPLACE = %q, want /elsewhere", got)
+	}
+}
+
 func TestPutObjectDefaultContentType(t *testing.T) {
 	h := newTestObjectHandler(t)
 
@@ -412,6 +482,95 @@ func TestPutObjectEmptyBody(t *testing.T) {
 	}
 }
 
+func TestPutObjectPayloadDigests(t *testing.T) {
+	for _, inline := range []int64{0, 1024} {
+		h := newTestObjectHandler(t)
+		h.SetInlineThreshold(inline)
+
+		put := func(body string, header map[string]string) *httptest.ResponseRecorder {
+			t.Helper()
+			req := httptest.NewRequest("PUT", "/test-bucket/digest.txt", strings.NewReader(body))
+			req.ContentLength = int64(len(body))
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.PutObject(rec, req)
+			return rec
+		}
+		md5Of := func(s string) string {
+			sum := md5.Sum([]byte(s))
+			return base64.StdEncoding.EncodeToString(sum[:])
+		}
+		shaOf := func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}
+
+		good := "the original body"
+		if rec := put(good, map[string]string{"Content-MD5": md5Of(good), "X-Amz-Content-Sha256": shaOf(good)}); rec.Code != http.StatusOK {
+			t.Fatalf("inline=%d: PutObject with matching digests = %d: %s", inline, rec.Code, rec.Body)
+		}
+
+		tests := []struct {
+			name     string
+			header   map[string]string
+			wantCode int
+			wantErr  string
+		}{
+			{"md5 mismatch", map[string]string{"Content-MD5": md5Of("something else")}, 400, "BadDigest"},
+			{"sha256 mismatch", map[string]string{"X-Amz-Content-Sha256": shaOf("something else")}, 400, "XAmzContentSHA256Mismatch"},
+			{"malformed md5", map[string]string{"Content-MD5": "not-base64!"}, 400, "InvalidDigest"},
+			{"malformed sha256", map[string]string{"X-Amz-Content-Sha256": "abc"}, 400, "InvalidArgument"},
+		}
+		for _, tt := range tests {
+			rec := put("a corrupted body", tt.header)
+			if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Errorf("inline=%d %s: PutObject = %d %s, want %d %s", inline, tt.name, rec.Code, rec.Body, tt.wantCode, tt.wantErr)
+			}
+		}
+		if rec := put("", map[string]string{"Content-MD5": md5Of("x")}); rec.Code != http.StatusBadRequest {
+			t.Errorf("inline=%d: empty PutObject with wrong Content-MD5 = %d, want 400", inline, rec.Code)
+		}
+
+		// The rejected uploads left the good version in place.
+		req := httptest.NewRequest("GET", "/test-bucket/digest.txt", nil)
+		rec := httptest.NewRecorder()
+		h.GetObject(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != good {
+			t.Errorf("inline=%d: GetObject = %d %q, want %q", inline, rec.Code, rec.Body, good)
+		}
+
+		if rec := put("unsigned", map[string]string{"X-Amz-Content-Sha256": "UNSIGNED-PAYLOAD"}); rec.Code != http.StatusOK {
+			t.Errorf("inline=%d: PutObject with UNSIGNED-PAYLOAD = %d", inline, rec.Code)
+		}
+	}
+}
+
+func TestPutObjectChunkedTooLarge(t *testing.T) {
+	h := newTestObjectHandler(t)
+	h.maxObjectSize = 8
+
+	put := func(body string, length int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/test-bucket/limited.bin", strings.NewReader(body))
+		req.ContentLength = length
+		rec := httptest.NewRecorder()
+		h.PutObject(rec, req)
+		return rec
+	}
+	for _, length := range []int64{9, -1} {
+		if rec := put("123456789", length); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "EntityTooLarge") {
+			t.Errorf("PutObject of 9 bytes (Content-Length %d) = %d %s, want 400 EntityTooLarge", length, rec.Code, rec.Body)
+		}
+	}
+	if obj, _ := h.meta.GetObject(context.Background(), "test-bucket", "limited.bin"); obj != nil {
+		t.Error("oversized object was stored")
+	}
+	if rec := put("12345678", -1); rec.Code != http.StatusOK {
+		t.Errorf("chunked PutObject at the limit = %d: %s", rec.Code, rec.Body)
+	}
+}
+
 func TestExtractObjectKey(t *testing.T) {
 	tests := []struct {
 		path    string
@@ -427,9 +586,9 @@ func TestExtractObjectKey(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.path, func(t *testing.T) {
 			req := httptest.NewRequest("GET", tt.path, nil)
-			got := extractObjectKey(req)
+			got := ParseRequest(nil, req).Key
 			if got != tt.wantKey {
-				t.Errorf("extractObjectKey(%q) = %q, want %q", tt.path, got, tt.wantKey)
+				t.Errorf("ParseRequest(%q).Key = %q, want %q", tt.path, got, tt.wantKey)
 			}
 		})
 	}
@@ -569,6 +728,82 @@ func TestCopyObjectWithReplaceDirective(t *testing.T) {
 	}
 }
 
+func TestCopyObjectACLHeaders(t *testing.T) {
+	h := newTestObjectHandler(t)
+
+	body := "acl copy"
+	req := httptest.NewRequest("PUT", "/test-bucket/acl-src.txt", strings.NewReader(body))
+	req.Header.Set("x-amz-acl", "public-read")
+	req.ContentLength = int64(len(body))
+	rec := httptest.NewRecorder()
+	h.PutObject(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PutObject status = %d", rec.Code)
+	}
+
+	// A copy keeps the source ACL unless the request sets one, whatever
+	// the metadata directive.
+	req = httptest.NewRequest("PUT", "/test-bucket/acl-dst.txt", nil)
+	req.Header.Set("X-Amz-Copy-Source", "/test-bucket/acl-src.txt")
+	req.Header.Set("x-amz-grant-read", `id="alice"`)
+	rec = httptest.NewRecorder()
+	h.CopyObject(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CopyObject status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/test-bucket/acl-dst.txt?acl", nil)
+	rec = httptest.NewRecorder()
+	h.GetObjectAcl(rec, req)
+	if got := rec.Body.String(); !strings.Contains(got, "<ID>alice</ID>") || strings.Contains(got, "AllUsers") {
+		t.Errorf("copy ACL = %s, want the alice grant only", got)
+	}
+
+	req = httptest.NewRequest("PUT", "/test-bucket/acl-bad.txt", nil)
+	req.Header.Set("X-Amz-Copy-Source", "/test-bucket/acl-src.txt")
+	req.Header.Set("x-amz-acl", "public")
+	rec = httptest.NewRecorder()
+	h.CopyObject(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("CopyObject with unknown canned ACL status = %d, want 400", rec.Code)
+	}
+}
+
+func TestPutObjectOwnedByWriter(t *testing.T) {
+	h := newTestObjectHandler(t)
+
+	body := "alice's"
+	req := httptest.NewRequest("PUT", "/test-bucket/alice.txt", strings.NewReader(body))
+	req.Header.Set("x-amz-acl", "bucket-owner-full-control")
+	rc := ParseRequest(nil, req)
+	rc.OwnerID, rc.OwnerDisplay = "alice", "Alice"
+	req = WithRequestContext(req, rc)
+	rec := httptest.NewRecorder()
+	h.PutObject(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PutObject status = %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/test-bucket/alice.txt?acl", nil)
+	rec = httptest.NewRecorder()
+	h.GetObjectAcl(rec, req)
+	var acp xmlutil.AccessControlPolicy
+	if err := xml.Unmarshal(rec.Body.Bytes(), &acp); err != nil {
+		t.Fatalf("decoding ACL: %v", err)
+	}
+	if acp.Owner.ID != "alice" {
+		t.Errorf("owner = %q, want alice", acp.Owner.ID)
+	}
+	// The bucket owner gets full control next to the writer.
+	var grantees []string
+	for _, g := range acp.AccessControlList.Grants {
+		grantees = append(grantees, g.Grantee.ID+":"+g.Permission)
+	}
+	if want := []string{"alice:FULL_CONTROL", "bleepstore:FULL_CONTROL"}; !slices.Equal(grantees, want) {
+		t.Errorf("grants = %v, want %v", grantees, want)
+	}
+}
+
 func TestCopyObjectNonexistentSource(t *testing.T) {
 	h := newTestObjectHandler(t)
 
@@ -706,6 +941,157 @@ func TestDeleteObjectsMalformedXML(t *testing.T) {
 	}
 }
 
+func TestHeadObjects(t *testing.T) {
+	h := newTestObjectHandler(t)
+	putTestObjects(t, h, []string{"a.txt", "dir/b.txt"})
+
+	var keys []string
+	for i := 0; i < 40; i++ {
+		keys = append(keys, fmt.Sprintf("missing-%d", i))
+	}
+	keys = append(keys, "dir/b.txt", "a.txt")
+	body, _ := json.Marshal(map[string][]string{"keys": keys})
+	req := httptest.NewRequest("POST", "/test-bucket?bleepstore-head-batch", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.HeadObjects(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HeadObjects status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp headBatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(resp.Objects) != len(keys) {
+		t.Fatalf("got %d entries, want %d", len(resp.Objects), len(keys))
+	}
+	for i, obj := range resp.Objects {
+		if obj.Key != keys[i] {
+			t.Fatalf("entry %d is %q, want %q (request order)", i, obj.Key, keys[i])
+		}
+	}
+	if resp.Objects[0].Found {
+		t.Errorf("missing key reported found: %+v", resp.Objects[0])
+	}
+	a := resp.Objects[len(keys)-1]
+	want := fmt.Sprintf(`"%x"`, md5.Sum([]byte("data for a.txt")))
+	if !a.Found || a.Size != int64(len("data for a.txt")) || a.ETag != want || a.LastModified == "" {
+		t.Errorf("a.txt = %+v", a)
+	}
+}
+
+func TestHeadObjectsInvalidRequest(t *testing.T) {
+	h := newTestObjectHandler(t)
+	tooMany, _ := json.Marshal(map[string][]string{"keys": make([]string, maxBatchKeys+1)})
+	for _, body := range []string{"not json", `{"keys": []}`, string(tooMany)} {
+		req := httptest.NewRequest("POST", "/test-bucket?bleepstore-head-batch", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.HeadObjects(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("HeadObjects(%.20q) status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/no-such-bucket?bleepstore-head-batch", strings.NewReader(`{"keys":["a"]}`))
+	rec := httptest.NewRecorder()
+	h.HeadObjects(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("HeadObjects (missing bucket) status = %d, want 404", rec.Code)
+	}
+}
+
+// readBulkGet runs a BulkGetObjects request and returns the tar entries and
+// their contents in stream order.
+func readBulkGet(t *testing.T, h *ObjectHandler, body string) ([]*tar.Header, []string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/test-bucket?bleepstore-bulk-get", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.BulkGetObjects(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("BulkGetObjects status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-tar" {
+		t.Errorf("Content-Type = %q, want application/x-tar", ct)
+	}
+	var hdrs []*tar.Header
+	var data []string
+	tr := tar.NewReader(rec.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar stream: %v", err)
+		}
+		b, _ := io.ReadAll(tr)
+		hdrs = append(hdrs, hdr)
+		data = append(data, string(b))
+	}
+	return hdrs, data
+}
+
+func TestBulkGetObjectsKeys(t *testing.T) {
+	h := newTestObjectHandler(t)
+	putTestObjects(t, h, []string{"a.txt", "dir/b.txt"})
+
+	hdrs, data := readBulkGet(t, h, `{"keys": ["dir/b.txt", "missing", "a.txt"]}`)
+	if len(hdrs) != 3 {
+		t.Fatalf("got %d entries, want 3", len(hdrs))
+	}
+	if hdrs[0].Name != "dir/b.txt" || data[0] != "data for dir/b.txt" {
+		t.Errorf("entry 0 = %q %q", hdrs[0].Name, data[0])
+	}
+	want := fmt.Sprintf(`"%x"`, md5.Sum([]byte("data for dir/b.txt")))
+	if got := hdrs[0].PAXRecords[bulkGetETagRecord]; got != want {
+		t.Errorf("etag record = %q, want %q", got, want)
+	}
+	if hdrs[1].Name != "missing" || hdrs[1].Size != 0 || hdrs[1].PAXRecords[bulkGetErrorRecord] != "NoSuchKey" {
+		t.Errorf("missing entry = %+v", hdrs[1])
+	}
+	if hdrs[2].Name != "a.txt" || data[2] != "data for a.txt" || hdrs[2].PAXRecords[bulkGetErrorRecord] != "" {
+		t.Errorf("entry 2 = %q %q", hdrs[2].Name, data[2])
+	}
+}
+
+func TestBulkGetObjectsPrefix(t *testing.T) {
+	h := newTestObjectHandler(t)
+	putTestObjects(t, h, []string{"dir/a", "dir/b", "dir/c", "dir/d", "other"})
+
+	hdrs, data := readBulkGet(t, h, `{"prefix": "dir/"}`)
+	if len(hdrs) != 4 || hdrs[0].Name != "dir/a" || hdrs[3].Name != "dir/d" || data[3] != "data for dir/d" {
+		t.Fatalf("prefix stream = %d entries", len(hdrs))
+	}
+
+	hdrs, _ = readBulkGet(t, h, `{"prefix": "dir/", "start_after": "dir/a", "max_keys": 2}`)
+	if len(hdrs) != 2 || hdrs[0].Name != "dir/b" || hdrs[1].Name != "dir/c" {
+		t.Fatalf("resumed stream = %d entries", len(hdrs))
+	}
+}
+
+func TestBulkGetObjectsInvalidRequest(t *testing.T) {
+	h := newTestObjectHandler(t)
+	tooMany, _ := json.Marshal(map[string][]string{"keys": make([]string, maxBatchKeys+1)})
+	for _, body := range []string{
+		"not json", `{}`, `{"keys": []}`, `{"keys": ["a"], "prefix": ""}`,
+		`{"prefix": "", "max_keys": -1}`, string(tooMany),
+	} {
+		req := httptest.NewRequest("POST", "/test-bucket?bleepstore-bulk-get", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.BulkGetObjects(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("BulkGetObjects(%.20q) status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/no-such-bucket?bleepstore-bulk-get", strings.NewReader(`{"keys":["a"]}`))
+	rec := httptest.NewRecorder()
+	h.BulkGetObjects(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("BulkGetObjects (missing bucket) status = %d, want 404", rec.Code)
+	}
+}
+
 // --- Stage 5a: ListObjectsV2 Tests ---
 
 func putTestObjects(t *testing.T, h *ObjectHandler, keys []string) {
@@ -1014,6 +1400,63 @@ func TestListObjectsV1WithMarker(t *testing.T) {
 	}
 }
 
+func TestListObjectsOwner(t *testing.T) {
+	h := newTestObjectHandler(t)
+	ctx := context.Background()
+	if err := h.meta.CreateBucket(ctx, &metadata.BucketRecord{
+		Name: "owned-bucket", Region: "us-east-1", OwnerID: "alice", OwnerDisplay: "Alice",
+	}); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	acl, _ := json.Marshal(&xmlutil.AccessControlPolicy{Owner: xmlutil.Owner{ID: "bob", DisplayName: "Bob"}})
+	for _, obj := range []*metadata.ObjectRecord{
+		{Bucket: "owned-bucket", Key: "by-acl", ETag: `"e"`, StorageClass: "STANDARD", ACL: acl, LastModified: time.Now()},
+		{Bucket: "owned-bucket", Key: "by-bucket", ETag: `"e"`, StorageClass: "STANDARD", LastModified: time.Now()},
+	} {
+		if err := h.meta.PutObject(ctx, obj); err != nil {
+			t.Fatalf("PutObject %s failed: %v", obj.Key, err)
+		}
+	}
+
+	list := func(target string, v2 bool) []xmlutil.Object {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		if v2 {
+			h.ListObjectsV2(rec, httptest.NewRequest("GET", target, nil))
+		} else {
+			h.ListObjects(rec, httptest.NewRequest("GET", target, nil))
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d; body: %s", target, rec.Code, rec.Body.String())
+		}
+		var result xmlutil.ListBucketV2Result
+		if err := xml.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("parsing %s response: %v", target, err)
+		}
+		return result.Contents
+	}
+	want := []xmlutil.Owner{{ID: "bob", DisplayName: "Bob"}, {ID: "alice", DisplayName: "Alice"}}
+	check := func(name string, contents []xmlutil.Object) {
+		t.Helper()
+		if len(contents) != len(want) {
+			t.Fatalf("%s: %d objects, want %d", name, len(contents), len(want))
+		}
+		for i, obj := range contents {
+			if obj.Owner == nil || *obj.Owner != want[i] {
+				t.Errorf("%s: %s owner = %+v, want %+v", name, obj.Key, obj.Owner, want[i])
+			}
+		}
+	}
+
+	for _, obj := range list("/owned-bucket?list-type=2", true) {
+		if obj.Owner != nil {
+			t.Errorf("V2 without fetch-owner: %s owner = %+v", obj.Key, obj.Owner)
+		}
+	}
+	check("V2 fetch-owner", list("/owned-bucket?list-type=2&fetch-owner=true", true))
+	check("V1", list("/owned-bucket", false))
+}
+
 func TestListObjectsV2NoSuchBucket(t *testing.T) {
 	h := newTestObjectHandler(t)
 
@@ -1116,6 +1559,58 @@ func TestParseRange(t *testing.T) {
 	}
 }
 
+func TestGetObjectPrefetchHint(t *testing.T) {
+	h := newTestObjectHandler(t)
+	putTestObjects(t, h, []string{"a.txt"})
+	var gotBucket string
+	var gotKeys []string
+	h.SetPrefetch(func(bucket string, keys []string) {
+		gotBucket, gotKeys = bucket, keys
+	})
+
+	req := httptest.NewRequest("GET", "/test-bucket/a.txt", nil)
+	req.Header.Set("x-bleepstore-prefetch", "b.txt, dir/c%2Cd.txt,,a.txt,%zz")
+	rec := httptest.NewRecorder()
+	h.GetObject(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "data for a.txt" {
+		t.Fatalf("GetObject status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if gotBucket != "test-bucket" || strings.Join(gotKeys, "|") != "b.txt|dir/c,d.txt" {
+		t.Errorf("prefetch(%q, %q), want b.txt and dir/c,d.txt", gotBucket, gotKeys)
+	}
+
+	// No hint is passed on for a missing object.
+	gotKeys = nil
+	req = httptest.NewRequest("GET", "/test-bucket/missing", nil)
+	req.Header.Set("x-bleepstore-prefetch", "b.txt")
+	h.GetObject(httptest.NewRecorder(), req)
+	if gotKeys != nil {
+		t.Errorf("prefetch called for a missing object: %q", gotKeys)
+	}
+}
+
+func TestGetObjectPartNumberSinglePart(t *testing.T) {
+	h := newTestObjectHandler(t)
+	putTestObjects(t, h, []string{"a.txt"})
+
+	req := httptest.NewRequest("GET", "/test-bucket/a.txt?partNumber=1", nil)
+	rec := httptest.NewRecorder()
+	h.GetObject(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "data for a.txt" {
+		t.Fatalf("GetObject part 1 = %d %q, want the whole object", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("x-amz-mp-parts-count"); got != "" {
+		t.Errorf("x-amz-mp-parts-count = %q for a single-part object", got)
+	}
+
+	req = httptest.NewRequest("GET", "/test-bucket/a.txt?partNumber=2", nil)
+	rec = httptest.NewRecorder()
+	h.GetObject(rec, req)
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable || !strings.Contains(rec.Body.String(), "InvalidPartNumber") {
+		t.Errorf("GetObject part 2 = %d %s, want 416 InvalidPartNumber", rec.Code, rec.Body.String())
+	}
+}
+
 // --- Stage 5b: Range Request Handler Tests ---
 
 func TestGetObjectRangeFirstBytes(t *testing.T) {
@@ -1248,6 +1743,87 @@ func TestGetObjectRangeUnsatisfiable(t *testing.T) {
 	}
 }
 
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []byteRange
+	}{
+		{"bytes=0-4", []byteRange{{0, 4}}},
+		{"bytes=10-20,0-4", []byteRange{{0, 4}, {10, 20}}},
+		{"bytes=0-4, 3-8,9-9", []byteRange{{0, 9}}},
+		{"bytes=0-1,-2", []byteRange{{0, 1}, {98, 99}}},
+		{"bytes=0-1,500-600", []byteRange{{0, 1}}},
+	}
+	for _, tt := range tests {
+		got, err := parseRanges(tt.header, 100)
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseRanges(%q) = %v, %v; want %v", tt.header, got, err, tt.want)
+		}
+	}
+	for _, header := range []string{"bytes=500-600,700-", "bytes=0-4,x", "bytes=0-4,", "items=0-4,5-6"} {
+		if got, err := parseRanges(header, 100); err == nil {
+			t.Errorf("parseRanges(%q) = %v, want error", header, got)
+		}
+	}
+}
+
+func TestGetObjectMultiRange(t *testing.T) {
+	h := newTestObjectHandler(t)
+
+	body := "abcdefghijklmnopqrstuvwxyz"
+	req := httptest.NewRequest("PUT", "/test-bucket/multi-range.txt", strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	h.PutObject(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PutObject status = %d", rec.Code)
+	}
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/test-bucket/multi-range.txt", nil)
+		req.Header.Set("Range", "bytes=20-21,0-4")
+		rec := httptest.NewRecorder()
+		h.GetObject(rec, req)
+		return rec
+	}
+
+	rec = get()
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("GetObject multi-range status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != strconv.Itoa(rec.Body.Len()) {
+		t.Errorf("Content-Length = %s, body is %d bytes", cl, rec.Body.Len())
+	}
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	mr := multipart.NewReader(rec.Body, params["boundary"])
+	for _, want := range []struct{ contentRange, data string }{{"bytes 0-4/26", "abcde"}, {"bytes 20-21/26", "uv"}} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		data, _ := io.ReadAll(part)
+		if cr := part.Header.Get("Content-Range"); cr != want.contentRange || string(data) != want.data ||
+			part.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("part = %s %q %q, want %s %q", cr, part.Header.Get("Content-Type"), data, want.contentRange, want.data)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("extra part: %v", err)
+	}
+
+	h.SetMultiRange(MultiRangeIgnore)
+	if rec = get(); rec.Code != http.StatusOK || rec.Body.String() != body {
+		t.Errorf("ignored multi-range = %d %q, want the whole object", rec.Code, rec.Body.String())
+	}
+	h.SetMultiRange(MultiRangeReject)
+	if rec = get(); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("rejected multi-range = %d, want 416", rec.Code)
+	}
+}
+
 // --- Stage 5b: Conditional Request Handler Tests ---
 
 func TestGetObjectIfMatch(t *testing.T) {
@@ -1282,6 +1858,142 @@ func TestGetObjectIfMatch(t *testing.T) {
 	}
 }
 
+func TestPutObjectConditional(t *testing.T) {
+	h := newTestObjectHandler(t)
+	h.SetConditionalPuts(h.meta.(metadata.ConditionalPutStore))
+	put := func(body string, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/test-bucket/cond.txt", strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		h.PutObject(rec, req)
+		return rec
+	}
+
+	if rec := put("v0", "If-Match", "*"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match * on a missing object = %d, want 412", rec.Code)
+	}
+	rec := put("v1", "If-None-Match", "*")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("If-None-Match * on a missing object = %d", rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	if rec := put("v2", "If-None-Match", "*"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-None-Match * on an existing object = %d, want 412", rec.Code)
+	}
+	if rec := put("v2", "If-Match", `"stale"`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match with a stale ETag = %d, want 412", rec.Code)
+	}
+	if rec := put("v2", "If-Match", etag); rec.Code != http.StatusOK {
+		t.Errorf("If-Match with the current ETag = %d, want 200", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/test-bucket/cond.txt", nil)
+	rec = httptest.NewRecorder()
+	h.GetObject(rec, req)
+	if rec.Body.String() != "v2" {
+		t.Errorf("object = %q, want v2", rec.Body.String())
+	}
+}
+
+func TestPutObjectIfNoneMatchRace(t *testing.T) {
+	h := newTestObjectHandler(t)
+	h.SetConditionalPuts(h.meta.(metadata.ConditionalPutStore))
+
+	const writers = 8
+	codes := make([]int, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf("writer-%d", i)
+			req := httptest.NewRequest("PUT", "/test-bucket/race.txt", strings.NewReader(body))
+			req.ContentLength = int64(len(body))
+			req.Header.Set("If-None-Match", "*")
+			rec := httptest.NewRecorder()
+			h.PutObject(rec, req)
+			codes[i] = rec.Code
+		}()
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, code := range codes {
+		switch {
+		case code == http.StatusOK && winner < 0:
+			winner = i
+		case code != http.StatusPreconditionFailed:
+			t.Fatalf("writer %d = %d; codes %v", i, code, codes)
+		}
+	}
+	if winner < 0 {
+		t.Fatalf("no writer succeeded: %v", codes)
+	}
+	rec := httptest.NewRecorder()
+	h.GetObject(rec, httptest.NewRequest("GET", "/test-bucket/race.txt", nil))
+	if want := fmt.Sprintf("writer-%d", winner); rec.Body.String() != want {
+		t.Errorf("object = %q, want the winner's %q", rec.Body.String(), want)
+	}
+}
+
+func TestPutObjectIfNoneMatchRaceAcrossServers(t *testing.T) {
+	h := newTestObjectHandler(t)
+
+	// Each writer goes through a server of its own, sharing only the
+	// metadata store and the storage backend.
+	const writers = 8
+	codes := make([]int, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		server := NewObjectHandler(h.meta, h.store, "bleepstore", "bleepstore", 5368709120)
+		server.SetConditionalPuts(h.meta.(metadata.ConditionalPutStore))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf("writer-%d", i)
+			req := httptest.NewRequest("PUT", "/test-bucket/race.txt", strings.NewReader(body))
+			req.ContentLength = int64(len(body))
+			req.Header.Set("If-None-Match", "*")
+			rec := httptest.NewRecorder()
+			server.PutObject(rec, req)
+			codes[i] = rec.Code
+		}()
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, code := range codes {
+		switch {
+		case code == http.StatusOK && winner < 0:
+			winner = i
+		case code != http.StatusPreconditionFailed:
+			t.Fatalf("writer %d = %d; codes %v", i, code, codes)
+		}
+	}
+	if winner < 0 {
+		t.Fatalf("no writer succeeded: %v", codes)
+	}
+	rec := httptest.NewRecorder()
+	h.GetObject(rec, httptest.NewRequest("GET", "/test-bucket/race.txt", nil))
+	if want := fmt.Sprintf("writer-%d", winner); rec.Body.String() != want {
+		t.Errorf("object = %q, want the winner's %q", rec.Body.String(), want)
+	}
+
+	// The losers' staged data is gone.
+	var files []string
+	err := h.store.(*storage.LocalBackend).WalkFiles(context.Background(), func(f storage.StoredFile) error {
+		files = append(files, f.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkFiles: %v", err)
+	}
+	if len(files) != 1 || files[0] != "race.txt" {
+		t.Errorf("stored files = %v, want only race.txt", files)
+	}
+}
+
 func TestGetObjectIfNoneMatch(t *testing.T) {
 	h := newTestObjectHandler(t)
 
@@ -1867,6 +2579,77 @@ func TestCopyObjectIfUnmodifiedSince(t *testing.T) {
 	}
 }
 
+// TestCopyObjectConditionalCombinations checks the S3 rules for combined
+// copy-source conditions: a matching if-match overrides a failing
+// if-unmodified-since, and a matching if-none-match fails even when
+// if-modified-since holds. A failed condition must not create the target.
+func TestCopyObjectConditionalCombinations(t *testing.T) {
+	h := newTestObjectHandler(t)
+
+	body := "copy source combined"
+	req := httptest.NewRequest("PUT", "/test-bucket/src-combo.txt", strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	rec := httptest.NewRecorder()
+	h.PutObject(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PutObject status = %d", rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	pastDate := time.Now().Add(-24 * time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"if-match overrides if-unmodified-since", map[string]string{
+			"x-amz-copy-source-if-match":            etag,
+			"x-amz-copy-source-if-unmodified-since": pastDate,
+		}, http.StatusOK},
+		{"if-match list", map[string]string{
+			"x-amz-copy-source-if-match": `"other", ` + etag,
+		}, http.StatusOK},
+		{"if-match star", map[string]string{
+			"x-amz-copy-source-if-match": "*",
+		}, http.StatusOK},
+		{"if-none-match fails despite if-modified-since", map[string]string{
+			"x-amz-copy-source-if-none-match":     etag,
+			"x-amz-copy-source-if-modified-since": pastDate,
+		}, http.StatusPreconditionFailed},
+		{"if-none-match star", map[string]string{
+			"x-amz-copy-source-if-none-match": "*",
+		}, http.StatusPreconditionFailed},
+		{"if-match and failing if-none-match", map[string]string{
+			"x-amz-copy-source-if-match":      etag,
+			"x-amz-copy-source-if-none-match": etag,
+		}, http.StatusPreconditionFailed},
+	}
+	for i, tt := range tests {
+		dst := fmt.Sprintf("/test-bucket/dst-combo-%d.txt", i)
+		req := httptest.NewRequest("PUT", dst, nil)
+		req.Header.Set("X-Amz-Copy-Source", "/test-bucket/src-combo.txt")
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.CopyObject(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d; body: %s", tt.name, rec.Code, tt.want, rec.Body.String())
+			continue
+		}
+		if tt.want == http.StatusPreconditionFailed {
+			if !strings.Contains(rec.Body.String(), "PreconditionFailed") {
+				t.Errorf("%s: body = %s, want PreconditionFailed", tt.name, rec.Body.String())
+			}
+			rec = httptest.NewRecorder()
+			h.HeadObject(rec, httptest.NewRequest("HEAD", dst, nil))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("%s: target after failed copy = %d, want 404", tt.name, rec.Code)
+			}
+		}
+	}
+}
+
 // --- Encoding-Type URL Tests ---
 
 func TestListObjectsV2EncodingTypeURL(t *testing.T) {
@@ -1915,6 +2698,77 @@ func TestListObjectsV1EncodingTypeURL(t *testing.T) {
 	}
 }
 
+// TestListObjectsEncodingTypeURLControlChars lists keys holding runes XML
+// cannot carry: with encoding-type=url the response must parse and every
+// key-valued element must decode back to the original.
+func TestListObjectsEncodingTypeURLControlChars(t *testing.T) {
+	h := newTestObjectHandler(t)
+
+	// The request paths are escaped; the stored keys are "ctl\x01/a b",
+	// "ctl\x01/sub/c" and "ctl\x01/\x1fd".
+	putTestObjects(t, h, []string{"ctl%01/a%20b", "ctl%01/sub/c", "ctl%01/%1Fd"})
+	prefix := "ctl\x01/"
+
+	decode := func(t *testing.T, s string) string {
+		t.Helper()
+		v, err := url.QueryUnescape(s)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", s, err)
+		}
+		return v
+	}
+
+	q := url.Values{"list-type": {"2"}, "encoding-type": {"url"}, "prefix": {prefix},
+		"delimiter": {"/"}, "start-after": {prefix + "\x1e"}}
+	req := httptest.NewRequest("GET", "/test-bucket?"+q.Encode(), nil)
+	rec := httptest.NewRecorder()
+	h.ListObjectsV2(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ListObjectsV2 status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	var v2 xmlutil.ListBucketV2Result
+	if err := xml.Unmarshal(rec.Body.Bytes(), &v2); err != nil {
+		t.Fatalf("parsing ListObjectsV2 response: %v\n%s", err, rec.Body.String())
+	}
+	if got := decode(t, v2.Prefix); got != prefix {
+		t.Errorf("Prefix = %q, want %q", got, prefix)
+	}
+	if got := decode(t, v2.Delimiter); got != "/" {
+		t.Errorf("Delimiter = %q, want /", got)
+	}
+	if got := decode(t, v2.StartAfter); got != prefix+"\x1e" {
+		t.Errorf("StartAfter = %q, want %q", got, prefix+"\x1e")
+	}
+	var keys []string
+	for _, obj := range v2.Contents {
+		keys = append(keys, decode(t, obj.Key))
+	}
+	if want := []string{prefix + "\x1fd", prefix + "a b"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %q, want %q", keys, want)
+	}
+	if len(v2.CommonPrefixes) != 1 || decode(t, v2.CommonPrefixes[0].Prefix) != prefix+"sub/" {
+		t.Errorf("CommonPrefixes = %+v, want %q", v2.CommonPrefixes, prefix+"sub/")
+	}
+
+	q = url.Values{"encoding-type": {"url"}, "prefix": {prefix}, "marker": {prefix + "\x1fd"}, "max-keys": {"1"}}
+	req = httptest.NewRequest("GET", "/test-bucket?"+q.Encode(), nil)
+	rec = httptest.NewRecorder()
+	h.ListObjects(rec, req)
+	var v1 xmlutil.ListBucketResult
+	if err := xml.Unmarshal(rec.Body.Bytes(), &v1); err != nil {
+		t.Fatalf("parsing ListObjects response: %v\n%s", err, rec.Body.String())
+	}
+	if got := decode(t, v1.Marker); got != prefix+"\x1fd" {
+		t.Errorf("Marker = %q, want %q", got, prefix+"\x1fd")
+	}
+	if len(v1.Contents) != 1 || decode(t, v1.Contents[0].Key) != prefix+"a b" {
+		t.Errorf("Contents = %+v", v1.Contents)
+	}
+	if got := decode(t, v1.NextMarker); v1.IsTruncated && got != prefix+"a b" {
+		t.Errorf("NextMarker = %q, want %q", got, prefix+"a b")
+	}
+}
+
 func TestListObjectsV2InvalidEncodingType(t *testing.T) {
 	h := newTestObjectHandler(t)
 
@@ -1970,3 +2824,187 @@ func TestListObjectsV2CommonPrefixEncodingTypeURL(t *testing.T) {
 		t.Errorf("ListObjectsV2 response missing URL-encoded common prefix: %s", respBody)
 	}
 }
+
+func TestInlineSmallObjects(t *testing.T) {
+	h := newTestObjectHandler(t)
+	h.SetInlineThreshold(16)
+	ctx := context.Background()
+
+	put := func(key, body string) string {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/test-bucket/"+key, strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		rec := httptest.NewRecorder()
+		h.PutObject(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PutObject %s status = %d; body: %s", key, rec.Code, rec.Body.String())
+		}
+		return rec.Header().Get("ETag")
+	}
+	get := func(key, rangeHeader string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/test-bucket/"+key, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		h.GetObject(rec, req)
+		if rec.Code != http.StatusOK && rec.Code != http.StatusPartialContent {
+			t.Fatalf("GetObject %s status = %d", key, rec.Code)
+		}
+		return rec.Body.String()
+	}
+	inStorage := func(key string) bool {
+		rc, _, _, err := h.store.GetObject(ctx, "test-bucket", key)
+		if err == nil {
+			rc.Close()
+		}
+		return err == nil
+	}
+
+	// A small object lives only in its metadata row, with the usual ETag.
+	etag := put("small.json", `{"a":1}`)
+	if etag != fmt.Sprintf(`"%x"`, md5.Sum([]byte(`{"a":1}`))) {
+		t.Errorf("inline ETag = %s", etag)
+	}
+	if inStorage("small.json") {
+		t.Error("small object was written to the storage backend")
+	}
+	if got := get("small.json", ""); got != `{"a":1}` {
+		t.Errorf("GET = %q", got)
+	}
+	if got := get("small.json", "bytes=2-4"); got != `a":` {
+		t.Errorf("range GET = %q", got)
+	}
+	put("empty", "")
+	if got := get("empty", ""); got != "" || inStorage("empty") {
+		t.Errorf("empty inline object = %q (in storage: %v)", got, inStorage("empty"))
+	}
+
+	// Larger objects still go to the backend.
+	put("big.bin", strings.Repeat("x", 17))
+	if !inStorage("big.bin") {
+		t.Error("large object was not written to the storage backend")
+	}
+
+	// Shrinking an object below the threshold removes the backend copy.
+	put("big.bin", "tiny")
+	if inStorage("big.bin") {
+		t.Error("backend copy of a replaced object was left behind")
+	}
+	if got := get("big.bin", ""); got != "tiny" {
+		t.Errorf("GET after shrink = %q", got)
+	}
+
+	// Copies of inline objects stay inline.
+	req := httptest.NewRequest("PUT", "/test-bucket/copy.json", nil)
+	req.Header.Set("X-Amz-Copy-Source", "/test-bucket/small.json")
+	rec := httptest.NewRecorder()
+	h.CopyObject(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CopyObject status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	if got := get("copy.json", ""); got != `{"a":1}` || inStorage("copy.json") {
+		t.Errorf("inline copy = %q (in storage: %v)", got, inStorage("copy.json"))
+	}
+
+	// A body shorter than its Content-Length is rejected.
+	req = httptest.NewRequest("PUT", "/test-bucket/short", strings.NewReader("abc"))
+	req.ContentLength = 10
+	rec = httptest.NewRecorder()
+	h.PutObject(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("short body status = %d, want 400", rec.Code)
+	}
+}
+
+func TestCompressionAtRest(t *testing.T) {
+	for _, codec := range []string{storage.CodecZstd, storage.CodecGzip} {
+		t.Run(codec, func(t *testing.T) {
+			h := newTestObjectHandler(t)
+			h.SetCompression(codec, nil)
+			ctx := context.Background()
+			body := strings.Repeat("compressible data ", 500)
+
+			put := func(key string) string {
+				t.Helper()
+				req := httptest.NewRequest("PUT", "/test-bucket/"+key, strings.NewReader(body))
+				rec := httptest.NewRecorder()
+				h.PutObject(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("PutObject %s status = %d; body: %s", key, rec.Code, rec.Body.String())
+				}
+				return rec.Header().Get("ETag")
+			}
+			get := func(key, rangeHeader string) string {
+				t.Helper()
+				req := httptest.NewRequest("GET", "/test-bucket/"+key, nil)
+				if rangeHeader != "" {
+					req.Header.Set("Range", rangeHeader)
+				}
+				rec := httptest.NewRecorder()
+				h.GetObject(rec, req)
+				if rec.Code != http.StatusOK && rec.Code != http.StatusPartialContent {
+					t.Fatalf("GetObject %s status = %d", key, rec.Code)
+				}
+				return rec.Body.String()
+			}
+			storedSize := func(key string) int64 {
+				t.Helper()
+				rc, size, _, err := h.store.GetObject(ctx, "test-bucket", key)
+				if err != nil {
+					t.Fatalf("storage GetObject %s: %v", key, err)
+				}
+				rc.Close()
+				return size
+			}
+
+			// Size and ETag describe the object as sent; the backend holds
+			// fewer bytes.
+			etag := put("data.txt")
+			if want := fmt.Sprintf(`"%x"`, md5.Sum([]byte(body))); etag != want {
+				t.Errorf("ETag = %s, want %s", etag, want)
+			}
+			if n := storedSize("data.txt"); n >= int64(len(body)) {
+				t.Errorf("stored %d bytes for a %d byte object", n, len(body))
+			}
+			obj, _ := h.meta.GetObject(ctx, "test-bucket", "data.txt")
+			if obj == nil || obj.Compression != codec || obj.Size != int64(len(body)) {
+				t.Fatalf("metadata = %+v", obj)
+			}
+			if got := get("data.txt", ""); got != body {
+				t.Errorf("GET returned %d bytes, want the original %d", len(got), len(body))
+			}
+			if got := get("data.txt", "bytes=1000-1016"); got != body[1000:1017] {
+				t.Errorf("range GET = %q, want %q", got, body[1000:1017])
+			}
+
+			// Copies keep the codec and the original ETag.
+			req := httptest.NewRequest("PUT", "/test-bucket/copy.txt", nil)
+			req.Header.Set("X-Amz-Copy-Source", "/test-bucket/data.txt")
+			rec := httptest.NewRecorder()
+			h.CopyObject(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("CopyObject status = %d; body: %s", rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), strings.Trim(etag, `"`)) {
+				t.Errorf("CopyObject result %s does not carry ETag %s", rec.Body.String(), etag)
+			}
+			if got := get("copy.txt", ""); got != body {
+				t.Errorf("GET of copy returned %d bytes", len(got))
+			}
+
+			// Buckets outside the configured list are stored as sent, and
+			// compressed objects stay readable once compression is off.
+			h.SetCompression(codec, []string{"other-bucket"})
+			put("plain.txt")
+			if n := storedSize("plain.txt"); n != int64(len(body)) {
+				t.Errorf("uncompressed bucket stored %d bytes, want %d", n, len(body))
+			}
+			h.SetCompression("", nil)
+			if got := get("data.txt", ""); got != body {
+				t.Error("compressed object unreadable after disabling compression")
+			}
+		})
+	}
+}
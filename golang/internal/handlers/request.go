@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/s3op"
+)
+
+// subresources are the query parameters that select an S3 subresource, in
+// the order they take precedence when a request names more than one.
+var subresources = []string{"uploadId", "uploads", "acl", "delete", "location"}
+
+// RequestContext is the parsed addressing and identity of an S3 request.
+// The server parses it once, before dispatch, and attaches it to the request
+// so handlers read the bucket, key and principal from one place instead of
+// re-parsing the URL.
+type RequestContext struct {
+	// Bucket is the bucket named in the path, or "" for service requests.
+	Bucket string
+	// Key is the object key, or "" for bucket and service requests.
+	Key string
+	// Subresource is the S3 subresource selected by the query string
+	// (e.g. "acl", "uploads", "uploadId"), or "" for none.
+	Subresource string
+	// Operation is the S3 operation the request maps to in the route table.
+	Operation s3op.Operation
+	// Query is the parsed query string.
+	Query url.Values
+	// AccessKey is the authenticated access key ID, or "" if the request
+	// was not authenticated.
+	AccessKey string
+	// OwnerID and OwnerDisplay identify the authenticated principal.
+	OwnerID      string
+	OwnerDisplay string
+	// RequestID is the x-amz-request-id assigned to the request.
+	RequestID string
+	// CanRead, when set, reports whether the caller may read an object
+	// under its ACL. Batch reads, which are authorized on the bucket,
+	// check each object they return with it.
+	CanRead func(obj *metadata.ObjectRecord) bool
+}
+
+// readable reports whether the caller may read obj. Every object is
+// readable when no CanRead check is set.
+func (rc *RequestContext) readable(obj *metadata.ObjectRecord) bool {
+	return rc.CanRead == nil || rc.CanRead(obj)
+}
+
+// Owner returns the authenticated principal, or the given default identity
+// for unauthenticated requests.
+func (rc *RequestContext) Owner(defaultID, defaultDisplay string) (id, display string) {
+	if rc.OwnerID == "" {
+		return defaultID, defaultDisplay
+	}
+	return rc.OwnerID, rc.OwnerDisplay
+}
+
+// SplitPath splits a path-style request path into bucket and key. It returns
+// ("", "") for "/", ("bucket", "") for "/bucket" or "/bucket/", and
+// ("bucket", "key/path") for "/bucket/key/path".
+func SplitPath(path string) (bucket, key string) {
+	path = strings.TrimPrefix(path, "/")
+	bucket, key, _ = strings.Cut(path, "/")
+	return bucket, key
+}
+
+// ParseRequest builds the RequestContext for r. The request ID is read from
+// the x-amz-request-id response header when w is non-nil.
+func ParseRequest(w http.ResponseWriter, r *http.Request) *RequestContext {
+	rc := &RequestContext{Query: r.URL.Query()}
+	rc.Bucket, rc.Key = SplitPath(r.URL.Path)
+	for _, name := range subresources {
+		if rc.Query.Has(name) {
+			rc.Subresource = name
+			break
+		}
+	}
+	rc.Operation = s3op.Classify(r.Method, rc.Bucket, rc.Key, rc.Query, r.Header)
+	rc.AccessKey = auth.AccessKeyFromContext(r.Context())
+	rc.OwnerID, rc.OwnerDisplay = auth.OwnerFromContext(r.Context())
+	if w != nil {
+		rc.RequestID = w.Header().Get("x-amz-request-id")
+	}
+	return rc
+}
+
+type requestContextKey struct{}
+
+// WithRequestContext returns a shallow copy of r carrying rc.
+func WithRequestContext(r *http.Request, rc *RequestContext) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestContextKey{}, rc))
+}
+
+// RequestFromContext returns the RequestContext attached to ctx, or nil.
+func RequestFromContext(ctx context.Context) *RequestContext {
+	rc, _ := ctx.Value(requestContextKey{}).(*RequestContext)
+	return rc
+}
+
+// requestContext returns the RequestContext attached to r, parsing one if
+// the handler was invoked directly rather than through the server.
+func requestContext(r *http.Request) *RequestContext {
+	if rc := RequestFromContext(r.Context()); rc != nil {
+		return rc
+	}
+	return ParseRequest(nil, r)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	req := httptest.NewRequest("POST", "/bucket/dir/key.txt?uploadId=abc&acl", nil)
+	rec := httptest.NewRecorder()
+	rec.Header().Set("x-amz-request-id", "REQ1")
+
+	rc := ParseRequest(rec, req)
+	if rc.Bucket != "bucket" || rc.Key != "dir/key.txt" {
+		t.Errorf("bucket, key = %q, %q", rc.Bucket, rc.Key)
+	}
+	if rc.Subresource != "uploadId" || rc.Query.Get("uploadId") != "abc" {
+		t.Errorf("subresource = %q, query = %v", rc.Subresource, rc.Query)
+	}
+	if rc.RequestID != "REQ1" {
+		t.Errorf("request ID = %q", rc.RequestID)
+	}
+	if id, display := rc.Owner("default", "Default"); id != "default" || display != "Default" {
+		t.Errorf("unauthenticated owner = %q, %q", id, display)
+	}
+
+	// Handlers read the attached context rather than re-parsing the URL.
+	attached := &RequestContext{Bucket: "resolved", Key: "k"}
+	if got := requestContext(WithRequestContext(req, attached)); got != attached {
+		t.Errorf("requestContext = %+v, want the attached context", got)
+	}
+}
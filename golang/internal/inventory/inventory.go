@@ -0,0 +1,272 @@
+// Package inventory holds bucket inventory configurations, which schedule
+// reports listing a bucket's objects, and writes the reports in the CSV
+// and Parquet formats of S3 Inventory.
+package inventory
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// ErrInvalidConfig is wrapped by the errors Put returns for an inventory
+// configuration it does not accept.
+var ErrInvalidConfig = errors.New("invalid inventory configuration")
+
+// maxConfigs is the most inventory configurations a bucket may have, as in
+// S3.
+const maxConfigs = 1000
+
+// arnPrefix begins a destination bucket ARN.
+const arnPrefix = "arn:aws:s3:::"
+
+// Report formats.
+const (
+	FormatCSV     = "CSV"
+	FormatParquet = "Parquet"
+)
+
+// Schedule frequencies.
+const (
+	Daily  = "Daily"
+	Weekly = "Weekly"
+)
+
+// Scheduled is one inventory configuration of a bucket.
+type Scheduled struct {
+	Bucket string
+	Config *xmlutil.InventoryConfiguration
+	// LastRun is when the configuration last produced a report, or zero.
+	LastRun time.Time
+}
+
+// Configs holds the inventory configurations of every bucket. Like
+// replication rules, they are cached in memory, so replicas sharing a
+// metadata store see a configuration changed through another replica only
+// after a restart.
+type Configs struct {
+	store metadata.InventoryStore
+
+	mu      sync.RWMutex
+	configs map[string]map[string]*Scheduled // bucket, then ID
+}
+
+// New loads the stored inventory configurations.
+func New(ctx context.Context, store metadata.InventoryStore) (*Configs, error) {
+	stored, err := store.ListBucketInventories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &Configs{store: store, configs: make(map[string]map[string]*Scheduled)}
+	for _, s := range stored {
+		cfg := &xmlutil.InventoryConfiguration{}
+		if err := xml.Unmarshal(s.Config, cfg); err != nil {
+			return nil, fmt.Errorf("decoding inventory configuration %s of %s: %w", s.ID, s.Bucket, err)
+		}
+		c.set(&Scheduled{Bucket: s.Bucket, Config: cfg, LastRun: s.LastRun})
+	}
+	return c, nil
+}
+
+// set caches a configuration; the caller holds mu or has not shared c yet.
+func (c *Configs) set(s *Scheduled) {
+	byID := c.configs[s.Bucket]
+	if byID == nil {
+		byID = make(map[string]*Scheduled)
+		c.configs[s.Bucket] = byID
+	}
+	byID[s.Config.ID] = s
+}
+
+// Get returns a bucket's configuration with id, or nil if it has none.
+func (c *Configs) Get(bucket, id string) *xmlutil.InventoryConfiguration {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if s := c.configs[bucket][id]; s != nil {
+		return s.Config
+	}
+	return nil
+}
+
+// List returns a bucket's configurations ordered by ID.
+func (c *Configs) List(bucket string) []*xmlutil.InventoryConfiguration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]*xmlutil.InventoryConfiguration, 0, len(c.configs[bucket]))
+	for _, s := range c.configs[bucket] {
+		out = append(out, s.Config)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out
+}
+
+// Put validates and stores a configuration of a bucket, replacing the one
+// with the same ID. A replaced configuration keeps its schedule.
+func (c *Configs) Put(ctx context.Context, bucket string, cfg *xmlutil.InventoryConfiguration) error {
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	c.mu.RLock()
+	existing := c.configs[bucket]
+	full := len(existing) >= maxConfigs && existing[cfg.ID] == nil
+	c.mu.RUnlock()
+	if full {
+		return fmt.Errorf("%w: a bucket may have at most %d inventory configurations", ErrInvalidConfig, maxConfigs)
+	}
+
+	doc, err := xml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := c.store.PutBucketInventory(ctx, bucket, cfg.ID, doc); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := &Scheduled{Bucket: bucket, Config: cfg}
+	if prev := c.configs[bucket][cfg.ID]; prev != nil {
+		s.LastRun = prev.LastRun
+	}
+	c.set(s)
+	return nil
+}
+
+// Delete removes a bucket's configuration with id.
+func (c *Configs) Delete(ctx context.Context, bucket, id string) error {
+	if err := c.store.DeleteBucketInventory(ctx, bucket, id); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.configs[bucket], id)
+	c.mu.Unlock()
+	return nil
+}
+
+// Forget drops a bucket's cached configurations after the bucket itself
+// was deleted, which removes the stored ones.
+func (c *Configs) Forget(bucket string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.configs, bucket)
+	c.mu.Unlock()
+}
+
+// Enabled returns every enabled configuration, ordered by bucket and ID.
+func (c *Configs) Enabled() []Scheduled {
+	c.mu.RLock()
+	var out []Scheduled
+	for _, byID := range c.configs {
+		for _, s := range byID {
+			if s.Config.IsEnabled {
+				out = append(out, *s)
+			}
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Bucket != out[b].Bucket {
+			return out[a].Bucket < out[b].Bucket
+		}
+		return out[a].Config.ID < out[b].Config.ID
+	})
+	return out
+}
+
+// Due returns the enabled configurations whose next report is due at now:
+// those that never ran, and those whose last report is a schedule period
+// old.
+func (c *Configs) Due(now time.Time) []Scheduled {
+	var due []Scheduled
+	for _, s := range c.Enabled() {
+		if s.LastRun.IsZero() || !now.Before(s.LastRun.Add(Period(s.Config.Schedule.Frequency))) {
+			due = append(due, s)
+		}
+	}
+	return due
+}
+
+// MarkRun records that a configuration produced a report at at.
+func (c *Configs) MarkRun(ctx context.Context, bucket, id string, at time.Time) error {
+	if err := c.store.SetInventoryLastRun(ctx, bucket, id, at); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if s := c.configs[bucket][id]; s != nil {
+		s.LastRun = at
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// Period returns the time between reports of a schedule frequency.
+func Period(frequency string) time.Duration {
+	if frequency == Weekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Validate checks a configuration. Encrypted reports and the ORC format
+// are rejected, as are optional fields describing object attributes this
+// server does not keep.
+func Validate(cfg *xmlutil.InventoryConfiguration) error {
+	if cfg.ID == "" {
+		return fmt.Errorf("%w: Id is required", ErrInvalidConfig)
+	}
+	dest := &cfg.Destination.S3BucketDestination
+	if DestinationBucket(cfg) == "" {
+		return fmt.Errorf("%w: destination bucket is required", ErrInvalidConfig)
+	}
+	if dest.Format != FormatCSV && dest.Format != FormatParquet {
+		return fmt.Errorf("%w: format must be CSV or Parquet", ErrInvalidConfig)
+	}
+	if dest.Encryption != nil {
+		return fmt.Errorf("%w: report encryption is not supported", ErrInvalidConfig)
+	}
+	if v := cfg.IncludedObjectVersions; v != "All" && v != "Current" {
+		return fmt.Errorf("%w: IncludedObjectVersions must be All or Current", ErrInvalidConfig)
+	}
+	if f := cfg.Schedule.Frequency; f != Daily && f != Weekly {
+		return fmt.Errorf("%w: frequency must be Daily or Weekly", ErrInvalidConfig)
+	}
+	if cfg.OptionalFields != nil {
+		seen := map[string]bool{}
+		for _, name := range cfg.OptionalFields.Fields {
+			if fieldByName(name) == nil {
+				return fmt.Errorf("%w: unsupported optional field %q", ErrInvalidConfig, name)
+			}
+			if seen[name] {
+				return fmt.Errorf("%w: duplicate optional field %q", ErrInvalidConfig, name)
+			}
+			seen[name] = true
+		}
+	}
+	return nil
+}
+
+// DestinationBucket returns the name of a configuration's destination
+// bucket, given as an ARN or a plain name, or "" if it is missing.
+func DestinationBucket(cfg *xmlutil.InventoryConfiguration) string {
+	return strings.TrimPrefix(cfg.Destination.S3BucketDestination.Bucket, arnPrefix)
+}
+
+// Prefix returns the key prefix of the objects a configuration lists.
+func Prefix(cfg *xmlutil.InventoryConfiguration) string {
+	if cfg.Filter == nil {
+		return ""
+	}
+	return cfg.Filter.Prefix
+}
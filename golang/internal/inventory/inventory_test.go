@@ -0,0 +1,112 @@
+package inventory
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+func parse(t *testing.T, doc string) *xmlutil.InventoryConfiguration {
+	t.Helper()
+	cfg := &xmlutil.InventoryConfiguration{}
+	if err := xml.Unmarshal([]byte(doc), cfg); err != nil {
+		t.Fatalf("decoding %s: %v", doc, err)
+	}
+	return cfg
+}
+
+// config returns a configuration document with the given ID, format,
+// frequency and optional fields.
+func config(id, format, frequency string, fields ...string) string {
+	doc := `<InventoryConfiguration><Id>` + id + `</Id><IsEnabled>true</IsEnabled>
+		<Destination><S3BucketDestination><Bucket>arn:aws:s3:::reports</Bucket><Format>` + format + `</Format>
+		<Prefix>inv</Prefix></S3BucketDestination></Destination>
+		<Filter><Prefix>data/</Prefix></Filter>
+		<IncludedObjectVersions>Current</IncludedObjectVersions>
+		<Schedule><Frequency>` + frequency + `</Frequency></Schedule><OptionalFields>`
+	for _, f := range fields {
+		doc += `<Field>` + f + `</Field>`
+	}
+	return doc + `</OptionalFields></InventoryConfiguration>`
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(parse(t, config("ok", "Parquet", "Weekly", "Size", "ETag"))); err != nil {
+		t.Fatalf("Validate(valid) = %v", err)
+	}
+	for name, doc := range map[string]string{
+		"no id":          config("", "CSV", "Daily"),
+		"orc":            config("i", "ORC", "Daily"),
+		"hourly":         config("i", "CSV", "Hourly"),
+		"unknown field":  config("i", "CSV", "Daily", "ObjectOwner"),
+		"repeated field": config("i", "CSV", "Daily", "Size", "Size"),
+		"no destination": `<InventoryConfiguration><Id>i</Id><IncludedObjectVersions>All</IncludedObjectVersions>
+			<Schedule><Frequency>Daily</Frequency></Schedule></InventoryConfiguration>`,
+	} {
+		if err := Validate(parse(t, doc)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: Validate = %v, want ErrInvalidConfig", name, err)
+		}
+	}
+}
+
+func TestConfigs(t *testing.T) {
+	ctx := context.Background()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "src", CreatedAt: time.Now()})
+
+	c, err := New(ctx, meta)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c.Put(ctx, "src", parse(t, config("weekly", "CSV", "Weekly")))
+	c.Put(ctx, "src", parse(t, config("daily", "CSV", "Daily")))
+	if got := c.List("src"); len(got) != 2 || got[0].ID != "daily" || got[1].ID != "weekly" {
+		t.Fatalf("List = %+v", got)
+	}
+
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if due := c.Due(now); len(due) != 2 {
+		t.Fatalf("Due before any run = %d configurations, want 2", len(due))
+	}
+	c.MarkRun(ctx, "src", "daily", now)
+	c.MarkRun(ctx, "src", "weekly", now)
+	if due := c.Due(now.Add(23 * time.Hour)); len(due) != 0 {
+		t.Errorf("Due after 23h = %+v", due)
+	}
+	if due := c.Due(now.Add(24 * time.Hour)); len(due) != 1 || due[0].Config.ID != "daily" {
+		t.Errorf("Due after 24h = %+v, want daily", due)
+	}
+
+	// Schedules and configurations survive a reload; replacing a
+	// configuration keeps its schedule.
+	c.Put(ctx, "src", parse(t, config("daily", "Parquet", "Daily")))
+	c, err = New(ctx, meta)
+	if err != nil {
+		t.Fatalf("reloading: %v", err)
+	}
+	if due := c.Due(now.Add(time.Hour)); len(due) != 0 {
+		t.Errorf("Due after reload = %+v", due)
+	}
+	if cfg := c.Get("src", "daily"); cfg == nil || cfg.Destination.S3BucketDestination.Format != FormatParquet {
+		t.Errorf("Get(daily) = %+v", cfg)
+	}
+
+	c.Delete(ctx, "src", "weekly")
+	if c.Get("src", "weekly") != nil {
+		t.Error("deleted configuration still cached")
+	}
+	c.Forget("src")
+	if len(c.List("src")) != 0 {
+		t.Error("Forget left configurations")
+	}
+}
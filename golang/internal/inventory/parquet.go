@@ -0,0 +1,359 @@
+package inventory
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// parquetMagic begins and ends a Parquet file.
+const parquetMagic = "PAR1"
+
+// Parquet enum values used in the file metadata.
+const (
+	parquetBoolean   = 0 // Type
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0 // FieldRepetitionType
+
+	parquetUTF8            = 0 // ConvertedType
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0 // Encoding
+	parquetRLE   = 3
+
+	parquetSnappy   = 1 // CompressionCodec
+	parquetDataPage = 0 // PageType
+)
+
+// parquetRowGroupRows is how many rows the Parquet writer buffers before
+// writing them out as a row group.
+const parquetRowGroupRows = 64 << 10
+
+// parquetWriter buffers a report's rows by column and writes them as a
+// Parquet row group every groupRows rows, so a report of any size needs
+// memory for one row group only; the footer follows when closed. Every
+// column is required and PLAIN-encoded in a single Snappy-compressed data
+// page per row group, which any Parquet reader accepts.
+type parquetWriter struct {
+	w         io.Writer
+	cols      Columns
+	groupRows int
+	rows      int64 // rows buffered in the current row group
+	offset    int64 // bytes written to w so far
+	groups    []parquetRowGroup
+
+	strings [][]string
+	ints    [][]int64
+	bools   [][]bool
+}
+
+// parquetRowGroup records a written row group for the file footer.
+type parquetRowGroup struct {
+	rows   int64
+	size   int64 // total uncompressed size
+	chunks []parquetChunk
+}
+
+// parquetChunk locates one column's data page in the file.
+type parquetChunk struct {
+	offset                           int64
+	uncompressedSize, compressedSize int64
+}
+
+func newParquetWriter(w io.Writer, cols Columns) *parquetWriter {
+	n := len(cols)
+	return &parquetWriter{w: w, cols: cols, groupRows: parquetRowGroupRows,
+		strings: make([][]string, n), ints: make([][]int64, n), bools: make([][]bool, n)}
+}
+
+// parquetDecl returns a column's declaration in a Parquet message type.
+func parquetDecl(f *field) string {
+	switch f.kind {
+	case kindInt64:
+		return "int64 " + f.column
+	case kindTimestamp:
+		return "int64 " + f.column + " (TIMESTAMP_MILLIS)"
+	case kindBool:
+		return "boolean " + f.column
+	}
+	return "binary " + f.column + " (UTF8)"
+}
+
+func (p *parquetWriter) Write(row *Row) error {
+	for i, f := range p.cols {
+		switch x := f.value(row).(type) {
+		case string:
+			p.strings[i] = append(p.strings[i], x)
+		case int64:
+			p.ints[i] = append(p.ints[i], x)
+		case time.Time:
+			p.ints[i] = append(p.ints[i], x.UnixMilli())
+		case bool:
+			p.bools[i] = append(p.bools[i], x)
+		}
+	}
+	p.rows++
+	if p.rows < int64(p.groupRows) {
+		return nil
+	}
+	return p.flush()
+}
+
+// write writes b to the file, starting it with the magic if needed.
+func (p *parquetWriter) write(b []byte) error {
+	if p.offset == 0 {
+		b = append([]byte(parquetMagic), b...)
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// flush writes the buffered rows as a row group and resets the buffers.
+func (p *parquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: p.rows, chunks: make([]parquetChunk, len(p.cols))}
+	var out []byte
+	for i := range p.cols {
+		data := p.plain(i)
+		compressed := s2.EncodeSnappy(nil, data)
+
+		var hdr thriftWriter
+		hdr.i32(1, parquetDataPage)
+		hdr.i32(2, int32(len(data)))
+		hdr.i32(3, int32(len(compressed)))
+		hdr.beginStruct(5) // DataPageHeader
+		hdr.i32(1, int32(p.rows))
+		hdr.i32(2, parquetPlain)
+		hdr.i32(3, parquetRLE)
+		hdr.i32(4, parquetRLE)
+		hdr.endStruct()
+		hdr.stop()
+
+		offset := p.offset + int64(len(out))
+		if p.offset == 0 {
+			offset += int64(len(parquetMagic))
+		}
+		group.chunks[i] = parquetChunk{
+			offset:           offset,
+			uncompressedSize: int64(len(hdr.buf) + len(data)),
+			compressedSize:   int64(len(hdr.buf) + len(compressed)),
+		}
+		group.size += group.chunks[i].uncompressedSize
+		out = append(out, hdr.buf...)
+		out = append(out, compressed...)
+
+		p.strings[i], p.ints[i], p.bools[i] = p.strings[i][:0], p.ints[i][:0], p.bools[i][:0]
+	}
+	p.groups = append(p.groups, group)
+	p.rows = 0
+	return p.write(out)
+}
+
+// plain returns the PLAIN encoding of column i.
+func (p *parquetWriter) plain(i int) []byte {
+	var b []byte
+	switch p.cols[i].kind {
+	case kindString:
+		for _, s := range p.strings[i] {
+			b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+			b = append(b, s...)
+		}
+	case kindInt64, kindTimestamp:
+		for _, v := range p.ints[i] {
+			b = binary.LittleEndian.AppendUint64(b, uint64(v))
+		}
+	case kindBool:
+		b = make([]byte, (len(p.bools[i])+7)/8)
+		for j, v := range p.bools[i] {
+			if v {
+				b[j/8] |= 1 << (j % 8)
+			}
+		}
+	}
+	return b
+}
+
+// physicalType returns the Parquet type of a column kind.
+func physicalType(kind int) int32 {
+	switch kind {
+	case kindInt64, kindTimestamp:
+		return parquetInt64
+	case kindBool:
+		return parquetBoolean
+	}
+	return parquetByteArray
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1) // version
+	meta.beginStructList(2, len(p.cols)+1)
+	meta.beginElem()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(p.cols)))
+	meta.endStruct()
+	for _, f := range p.cols {
+		meta.beginElem()
+		meta.i32(1, physicalType(f.kind))
+		meta.i32(3, parquetRequired)
+		meta.binary(4, f.column)
+		switch f.kind {
+		case kindString:
+			meta.i32(6, parquetUTF8)
+		case kindTimestamp:
+			meta.i32(6, parquetTimestampMillis)
+		}
+		meta.endStruct()
+	}
+	var rows int64
+	for _, g := range p.groups {
+		rows += g.rows
+	}
+	meta.i64(3, rows)
+	meta.beginStructList(4, len(p.groups))
+	for _, g := range p.groups {
+		meta.beginElem() // RowGroup
+		meta.beginStructList(1, len(g.chunks))
+		for i, c := range g.chunks {
+			meta.beginElem()
+			meta.i64(2, c.offset) // file_offset
+			meta.beginStruct(3)   // ColumnMetaData
+			meta.i32(1, physicalType(p.cols[i].kind))
+			meta.i32List(2, parquetPlain, parquetRLE)
+			meta.stringList(3, p.cols[i].column)
+			meta.i32(4, parquetSnappy)
+			meta.i64(5, g.rows)
+			meta.i64(6, c.uncompressedSize)
+			meta.i64(7, c.compressedSize)
+			meta.i64(9, c.offset) // data_page_offset
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.i64(2, g.size)
+		meta.i64(3, g.rows)
+		meta.endStruct()
+	}
+	meta.binary(6, "bleepstore")
+	meta.stop()
+
+	out := append(meta.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(out[len(meta.buf):], uint32(len(meta.buf)))
+	out = append(out, parquetMagic...)
+	return p.write(out)
+}
+
+// Thrift compact protocol type codes.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the Thrift compact protocol, which Parquet uses for
+// its page headers and file metadata. Only what those need is supported.
+type thriftWriter struct {
+	buf    []byte
+	lastID int16
+	stack  []int16 // lastID of the enclosing structs
+}
+
+func (t *thriftWriter) uvarint(v uint64) {
+	t.buf = binary.AppendUvarint(t.buf, v)
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.uvarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+// field writes a field header, in the short form when the ID delta allows.
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.zigzag(int64(id))
+	}
+	t.lastID = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.uvarint(uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftWriter) listHeader(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+	} else {
+		t.buf = append(t.buf, 0xf0|elem)
+		t.uvarint(uint64(n))
+	}
+}
+
+func (t *thriftWriter) i32List(id int16, vs ...int32) {
+	t.listHeader(id, thriftI32, len(vs))
+	for _, v := range vs {
+		t.zigzag(int64(v))
+	}
+}
+
+func (t *thriftWriter) stringList(id int16, vs ...string) {
+	t.listHeader(id, thriftBinary, len(vs))
+	for _, v := range vs {
+		t.uvarint(uint64(len(v)))
+		t.buf = append(t.buf, v...)
+	}
+}
+
+// beginStruct opens a struct field; endStruct closes it.
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.beginElem()
+}
+
+// beginStructList writes the header of a list of n structs, each of which
+// is then written between beginElem and endStruct.
+func (t *thriftWriter) beginStructList(id int16, n int) {
+	t.listHeader(id, thriftStruct, n)
+}
+
+func (t *thriftWriter) beginElem() {
+	t.stack = append(t.stack, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftWriter) endStruct() {
+	t.stop()
+	t.lastID = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// stop ends the fields of the current struct.
+func (t *thriftWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
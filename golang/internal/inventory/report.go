@@ -0,0 +1,184 @@
+package inventory
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// Row is one object in an inventory report.
+type Row struct {
+	Bucket            string
+	Key               string
+	Size              int64
+	LastModified      time.Time
+	ETag              string // without quotes
+	StorageClass      string
+	Multipart         bool
+	ReplicationStatus string
+	// ChecksumAlgorithm names the additional checksum of the object. It is
+	// always empty here: objects carry only their ETag, which is the MD5
+	// of objects not uploaded in parts.
+	ChecksumAlgorithm string
+}
+
+// Column kinds, which select the Parquet type of a column.
+const (
+	kindString = iota
+	kindInt64
+	kindTimestamp
+	kindBool
+)
+
+// field is one column of a report.
+type field struct {
+	name   string // S3 optional field name, and CSV schema name
+	column string // Parquet column name
+	kind   int
+	value  func(*Row) any
+}
+
+// requiredFields start every report.
+var requiredFields = []*field{
+	{"Bucket", "bucket", kindString, func(r *Row) any { return r.Bucket }},
+	{"Key", "key", kindString, func(r *Row) any { return r.Key }},
+}
+
+// optionalFields are the supported optional fields, in the order their
+// columns appear in a report.
+var optionalFields = []*field{
+	{"Size", "size", kindInt64, func(r *Row) any { return r.Size }},
+	{"LastModifiedDate", "last_modified_date", kindTimestamp, func(r *Row) any { return r.LastModified }},
+	{"ETag", "e_tag", kindString, func(r *Row) any { return r.ETag }},
+	{"StorageClass", "storage_class", kindString, func(r *Row) any { return r.StorageClass }},
+	{"IsMultipartUploaded", "is_multipart_uploaded", kindBool, func(r *Row) any { return r.Multipart }},
+	{"ReplicationStatus", "replication_status", kindString, func(r *Row) any { return r.ReplicationStatus }},
+	{"ChecksumAlgorithm", "checksum_algorithm", kindString, func(r *Row) any { return r.ChecksumAlgorithm }},
+}
+
+// fieldByName returns the optional field named name, or nil.
+func fieldByName(name string) *field {
+	for _, f := range optionalFields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Columns lists the columns of a configuration's reports.
+type Columns []*field
+
+// ColumnsOf returns the columns of a configuration's reports: Bucket and
+// Key, then the optional fields it selects.
+func ColumnsOf(cfg *xmlutil.InventoryConfiguration) Columns {
+	cols := append(Columns{}, requiredFields...)
+	selected := map[string]bool{}
+	if cfg.OptionalFields != nil {
+		for _, name := range cfg.OptionalFields.Fields {
+			selected[name] = true
+		}
+	}
+	for _, f := range optionalFields {
+		if selected[f.name] {
+			cols = append(cols, f)
+		}
+	}
+	return cols
+}
+
+// Schema returns the fileSchema of a report manifest: the comma-separated
+// field names for CSV, or the Parquet message type.
+func (cols Columns) Schema(format string) string {
+	if format == FormatParquet {
+		var b strings.Builder
+		b.WriteString("message s3.inventory { ")
+		for _, f := range cols {
+			fmt.Fprintf(&b, "required %s; ", parquetDecl(f))
+		}
+		b.WriteString("}")
+		return b.String()
+	}
+	names := make([]string, len(cols))
+	for i, f := range cols {
+		names[i] = f.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Extension returns the file name extension of a format's data files.
+func Extension(format string) string {
+	if format == FormatParquet {
+		return ".parquet"
+	}
+	return ".csv.gz"
+}
+
+// Writer writes the rows of one report data file.
+type Writer interface {
+	// Write adds a row.
+	Write(row *Row) error
+	// Close finishes the file. It does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer of format with cols to w.
+func NewWriter(format string, w io.Writer, cols Columns) Writer {
+	if format == FormatParquet {
+		return newParquetWriter(w, cols)
+	}
+	return newCSVWriter(w, cols)
+}
+
+// csvWriter writes gzip-compressed CSV without a header, as S3 does: every
+// value quoted, keys URL-encoded and times in ISO 8601.
+type csvWriter struct {
+	cols Columns
+	gz   *gzip.Writer
+	buf  *bufio.Writer
+}
+
+func newCSVWriter(w io.Writer, cols Columns) *csvWriter {
+	gz := gzip.NewWriter(w)
+	return &csvWriter{cols: cols, gz: gz, buf: bufio.NewWriter(gz)}
+}
+
+func (c *csvWriter) Write(row *Row) error {
+	for i, f := range c.cols {
+		if i > 0 {
+			c.buf.WriteByte(',')
+		}
+		var v string
+		switch x := f.value(row).(type) {
+		case string:
+			v = x
+			if f.name == "Key" {
+				v = url.QueryEscape(x)
+			}
+		case int64:
+			v = strconv.FormatInt(x, 10)
+		case bool:
+			v = strconv.FormatBool(x)
+		case time.Time:
+			v = xmlutil.FormatTimeS3(x)
+		}
+		c.buf.WriteByte('"')
+		c.buf.WriteString(strings.ReplaceAll(v, `"`, `""`))
+		c.buf.WriteByte('"')
+	}
+	return c.buf.WriteByte('\n')
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.buf.Flush(); err != nil {
+		return err
+	}
+	return c.gz.Close()
+}
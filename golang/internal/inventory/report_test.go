@@ -0,0 +1,198 @@
+package inventory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+)
+
+var testRows = []Row{
+	{Bucket: "src", Key: "data/a b.txt", Size: 3, LastModified: time.Date(2026, 1, 2, 3, 4, 5, 6e6, time.UTC),
+		ETag: "900150983cd24fb0d6963f7d28e17f72", StorageClass: "STANDARD"},
+	{Bucket: "src", Key: `data/"q"`, Size: 1 << 40, LastModified: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC),
+		ETag: "d41d8cd98f00b204e9800998ecf8427e-2", StorageClass: "STANDARD", Multipart: true, ReplicationStatus: "COMPLETED"},
+}
+
+func TestCSVWriter(t *testing.T) {
+	cols := ColumnsOf(parse(t, config("i", "CSV", "Daily", "ETag", "Size", "LastModifiedDate", "IsMultipartUploaded")))
+	if got := cols.Schema(FormatCSV); got != "Bucket, Key, Size, LastModifiedDate, ETag, IsMultipartUploaded" {
+		t.Errorf("Schema = %q", got)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(FormatCSV, &buf, cols)
+	for i := range testRows {
+		w.Write(&testRows[i])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("report is not gzip: %v", err)
+	}
+	got, _ := io.ReadAll(zr)
+	want := `"src","data%2Fa+b.txt","3","2026-01-02T03:04:05.006Z","900150983cd24fb0d6963f7d28e17f72","false"
+"src","data%2F%22q%22","1099511627776","2026-01-03T00:00:00.000Z","d41d8cd98f00b204e9800998ecf8427e-2","true"
+`
+	if string(got) != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	cols := ColumnsOf(parse(t, config("i", "Parquet", "Daily",
+		"Size", "LastModifiedDate", "ETag", "IsMultipartUploaded", "ReplicationStatus")))
+	if got, want := cols.Schema(FormatParquet), "message s3.inventory { required binary bucket (UTF8); "+
+		"required binary key (UTF8); required int64 size; required int64 last_modified_date (TIMESTAMP_MILLIS); "+
+		"required binary e_tag (UTF8); required boolean is_multipart_uploaded; "+
+		"required binary replication_status (UTF8); }"; got != want {
+		t.Errorf("Schema = %q", got)
+	}
+
+	for _, groupRows := range []int{parquetRowGroupRows, 1} {
+		var buf bytes.Buffer
+		w := newParquetWriter(&buf, cols)
+		w.groupRows = groupRows
+		for i := range testRows {
+			w.Write(&testRows[i])
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		file := buf.Bytes()
+		if string(file[:4]) != "PAR1" || string(file[len(file)-4:]) != "PAR1" {
+			t.Fatalf("missing Parquet magic")
+		}
+
+		// Decode the footer and read each column back through its metadata.
+		n := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+		meta := readStruct(t, &thriftReader{b: file[len(file)-8-n : len(file)-8]})
+		if meta[3] != int64(2) {
+			t.Errorf("num_rows = %v", meta[3])
+		}
+		schema := meta[2].([]any)
+		if len(schema) != len(cols)+1 || schema[0].(map[int16]any)[5] != int64(len(cols)) {
+			t.Fatalf("schema = %v", schema)
+		}
+		groups := meta[4].([]any)
+		if want := (len(testRows) + groupRows - 1) / groupRows; len(groups) != want {
+			t.Fatalf("%d row groups of %d rows, want %d", len(groups), groupRows, want)
+		}
+		values := map[string][]any{}
+		for _, g := range groups {
+			rows := int(g.(map[int16]any)[3].(int64))
+			for i, c := range g.(map[int16]any)[1].([]any) {
+				cm := c.(map[int16]any)[3].(map[int16]any)
+				name := cm[3].([]any)[0].(string)
+				if want := schema[i+1].(map[int16]any)[4]; name != want {
+					t.Errorf("column %d is %s, schema says %v", i, name, want)
+				}
+				if cm[5] != int64(rows) {
+					t.Errorf("column %s: num_values = %v, row group has %d", name, cm[5], rows)
+				}
+				r := &thriftReader{b: file[cm[9].(int64):]}
+				page := readStruct(t, r)
+				data, err := s2.Decode(nil, r.b[:page[3].(int64)])
+				if err != nil || len(data) != int(page[2].(int64)) {
+					t.Fatalf("column %s: page of %d bytes, header says %v (%v)", name, len(data), page[2], err)
+				}
+				for j := 0; j < rows; j++ {
+					switch cm[1] {
+					case int64(parquetByteArray):
+						l := binary.LittleEndian.Uint32(data)
+						values[name] = append(values[name], string(data[4:4+l]))
+						data = data[4+l:]
+					case int64(parquetInt64):
+						values[name] = append(values[name], int64(binary.LittleEndian.Uint64(data[8*j:])))
+					case int64(parquetBoolean):
+						values[name] = append(values[name], data[0]&(1<<j) != 0)
+					}
+				}
+			}
+		}
+		for name, want := range map[string][]any{
+			"key":                   {"data/a b.txt", `data/"q"`},
+			"size":                  {int64(3), int64(1 << 40)},
+			"last_modified_date":    {testRows[0].LastModified.UnixMilli(), testRows[1].LastModified.UnixMilli()},
+			"is_multipart_uploaded": {false, true},
+			"replication_status":    {"", "COMPLETED"},
+		} {
+			if got := values[name]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+				t.Errorf("%s = %v, want %v", name, got, want)
+			}
+		}
+	}
+}
+
+// thriftReader decodes the Thrift compact protocol for TestParquetWriter.
+type thriftReader struct{ b []byte }
+
+func (r *thriftReader) uvarint(t *testing.T) uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		t.Fatalf("bad varint")
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) value(t *testing.T, typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case thriftI32, thriftI64:
+		u := r.uvarint(t)
+		return int64(u>>1) ^ -int64(u&1)
+	case thriftBinary:
+		n := r.uvarint(t)
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case thriftList:
+		h := r.b[0]
+		r.b = r.b[1:]
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint(t))
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(t, h&0x0f)
+		}
+		return list
+	case thriftStruct:
+		return readStruct(t, r)
+	}
+	t.Fatalf("unexpected Thrift type %d", typ)
+	return nil
+}
+
+// readStruct decodes a struct's fields by ID.
+func readStruct(t *testing.T, r *thriftReader) map[int16]any {
+	fields := map[int16]any{}
+	var id int16
+	for {
+		h := r.b[0]
+		r.b = r.b[1:]
+		if h == 0 {
+			return fields
+		}
+		if delta := h >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			u := r.uvarint(t)
+			if u > math.MaxUint16 {
+				t.Fatalf("bad field ID")
+			}
+			id = int16(int64(u>>1) ^ -int64(u&1))
+		}
+		fields[id] = r.value(t, h&0x0f)
+	}
+}
@@ -0,0 +1,140 @@
+package metadata
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+)
+
+// newTestBoltStore creates a BoltStore backed by a temporary database file.
+func newTestBoltStore(t *testing.T) *BoltStore {
+	t.Helper()
+	store, err := NewBoltStore(&config.BoltConfig{Path: filepath.Join(t.TempDir(), "meta.bolt")})
+	if err != nil {
+		t.Fatalf("NewBoltStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBoltBucketLifecycle(t *testing.T) {
+	store := newTestBoltStore(t)
+	ctx := context.Background()
+
+	if err := store.CreateBucket(ctx, &BucketRecord{Name: "b", OwnerID: "o"}); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	if err := store.CreateBucket(ctx, &BucketRecord{Name: "b", OwnerID: "o"}); err == nil {
+		t.Error("expected error creating duplicate bucket")
+	}
+	if err := store.PutObject(ctx, &ObjectRecord{Bucket: "missing", Key: "k"}); err == nil {
+		t.Error("expected error putting object into missing bucket")
+	}
+	if err := store.PutObject(ctx, &ObjectRecord{Bucket: "b", Key: "k", Size: 3}); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	obj, err := store.GetObject(ctx, "b", "k")
+	if err != nil || obj == nil || obj.Size != 3 || obj.ContentType != "application/octet-stream" {
+		t.Fatalf("GetObject = %+v, %v", obj, err)
+	}
+	if err := store.DeleteBucket(ctx, "b"); err == nil {
+		t.Error("expected error deleting non-empty bucket")
+	}
+	if deleted, errs := store.DeleteObjectsMeta(ctx, "b", []string{"k"}); len(deleted) != 1 || len(errs) != 0 {
+		t.Fatalf("DeleteObjectsMeta = %v, %v", deleted, errs)
+	}
+	if err := store.DeleteBucket(ctx, "b"); err != nil {
+		t.Fatalf("DeleteBucket: %v", err)
+	}
+	if exists, _ := store.BucketExists(ctx, "b"); exists {
+		t.Error("bucket still exists after delete")
+	}
+}
+
+func TestBoltListObjectsDelimiter(t *testing.T) {
+	store := newTestBoltStore(t)
+	ctx := context.Background()
+	store.CreateBucket(ctx, &BucketRecord{Name: "b"})
+	for _, key := range []string{"a", "dir/1", "dir/2", "dir/sub/3", "other/4", "z"} {
+		if err := store.PutObject(ctx, &ObjectRecord{Bucket: "b", Key: key}); err != nil {
+			t.Fatalf("PutObject(%q): %v", key, err)
+		}
+	}
+
+	keys := func(res *ListObjectsResult) []string {
+		var out []string
+		for _, obj := range res.Objects {
+			out = append(out, obj.Key)
+		}
+		return out
+	}
+
+	res, err := store.ListObjects(ctx, "b", ListObjectsOptions{Delimiter: "/"})
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if got := keys(res); !reflect.DeepEqual(got, []string{"a", "z"}) {
+		t.Errorf("objects = %v", got)
+	}
+	if !reflect.DeepEqual(res.CommonPrefixes, []string{"dir/", "other/"}) {
+		t.Errorf("common prefixes = %v", res.CommonPrefixes)
+	}
+
+	// Paginate across a common prefix boundary.
+	res, _ = store.ListObjects(ctx, "b", ListObjectsOptions{Delimiter: "/", MaxKeys: 2})
+	if !res.IsTruncated || res.NextContinuationToken != "dir/" {
+		t.Fatalf("page 1 = %+v", res)
+	}
+	res, _ = store.ListObjects(ctx, "b", ListObjectsOptions{Delimiter: "/", MaxKeys: 2, ContinuationToken: res.NextContinuationToken})
+	if got := keys(res); !reflect.DeepEqual(got, []string{"z"}) || !reflect.DeepEqual(res.CommonPrefixes, []string{"other/"}) || res.IsTruncated {
+		t.Errorf("page 2 = %v %v truncated=%v", got, res.CommonPrefixes, res.IsTruncated)
+	}
+
+	res, _ = store.ListObjects(ctx, "b", ListObjectsOptions{Prefix: "dir/", Delimiter: "/"})
+	if got := keys(res); !reflect.DeepEqual(got, []string{"dir/1", "dir/2"}) || !reflect.DeepEqual(res.CommonPrefixes, []string{"dir/sub/"}) {
+		t.Errorf("prefixed listing = %v %v", got, res.CommonPrefixes)
+	}
+}
+
+func TestBoltMultipartAndReap(t *testing.T) {
+	store := newTestBoltStore(t)
+	ctx := context.Background()
+	store.CreateBucket(ctx, &BucketRecord{Name: "b"})
+
+	uploadID, err := store.CreateMultipartUpload(ctx, &MultipartUploadRecord{Bucket: "b", Key: "k", InitiatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	for _, pn := range []int{3, 1, 2, 300} {
+		if err := store.PutPart(ctx, &PartRecord{UploadID: uploadID, PartNumber: pn, Size: 1}); err != nil {
+			t.Fatalf("PutPart(%d): %v", pn, err)
+		}
+	}
+	parts, _ := store.ListParts(ctx, uploadID, ListPartsOptions{MaxParts: 3})
+	if len(parts.Parts) != 3 || parts.Parts[2].PartNumber != 3 || !parts.IsTruncated || parts.NextPartNumberMarker != 3 {
+		t.Errorf("ListParts = %+v", parts)
+	}
+	if err := store.DeleteBucket(ctx, "b"); err == nil {
+		t.Error("expected error deleting bucket with in-progress upload")
+	}
+	if err := store.CompleteMultipartUpload(ctx, "b", "k", uploadID, &ObjectRecord{Bucket: "b", Key: "k", Size: 4}); err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	if err := store.PutPart(ctx, &PartRecord{UploadID: uploadID, PartNumber: 4}); err == nil {
+		t.Error("expected error adding part to completed upload")
+	}
+
+	old, _ := store.CreateMultipartUpload(ctx, &MultipartUploadRecord{Bucket: "b", Key: "old", InitiatedAt: time.Now().Add(-2 * time.Hour)})
+	store.CreateMultipartUpload(ctx, &MultipartUploadRecord{Bucket: "b", Key: "new", InitiatedAt: time.Now()})
+	expired, err := store.ReapExpiredUploads(3600)
+	if err != nil {
+		t.Fatalf("ReapExpiredUploads: %v", err)
+	}
+	if len(expired) != 1 || expired[0].UploadID != old {
+		t.Errorf("expired = %+v, want only %s", expired, old)
+	}
+}
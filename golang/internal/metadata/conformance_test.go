@@ -0,0 +1,112 @@
+package metadata_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metadata/metadatatest"
+)
+
+func TestConformanceSQLite(t *testing.T) {
+	metadatatest.RunSuite(t, func(t *testing.T) metadata.MetadataStore {
+		store, err := metadata.NewSQLiteStore(filepath.Join(t.TempDir(), "meta.db"))
+		if err != nil {
+			t.Fatalf("NewSQLiteStore: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestConformanceSQLiteReadPool(t *testing.T) {
+	metadatatest.RunSuite(t, func(t *testing.T) metadata.MetadataStore {
+		store, err := metadata.NewSQLiteStoreWithConfig(&config.SQLiteConfig{
+			Path:         filepath.Join(t.TempDir(), "meta.db"),
+			MaxOpenConns: 1,
+			ReadConns:    4,
+		})
+		if err != nil {
+			t.Fatalf("NewSQLiteStoreWithConfig: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestConformanceMemory(t *testing.T) {
+	metadatatest.RunSuite(t, func(t *testing.T) metadata.MetadataStore {
+		return metadata.NewMemoryStore()
+	})
+}
+
+func TestConformanceBolt(t *testing.T) {
+	metadatatest.RunSuite(t, func(t *testing.T) metadata.MetadataStore {
+		store, err := metadata.NewBoltStore(&config.BoltConfig{Path: filepath.Join(t.TempDir(), "meta.bolt")})
+		if err != nil {
+			t.Fatalf("NewBoltStore: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestConformanceLocal(t *testing.T) {
+	metadatatest.RunSuite(t, func(t *testing.T) metadata.MetadataStore {
+		store, err := metadata.NewLocalStore(&config.LocalMetaConfig{RootDir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("NewLocalStore: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+// TestConformanceDynamoDB runs the suite against DynamoDB Local when
+// BLEEPSTORE_TEST_DYNAMODB_ENDPOINT is set (e.g. http://localhost:8000).
+// Each case gets its own table.
+func TestConformanceDynamoDB(t *testing.T) {
+	client, endpoint := dynamoDBTestClient(t)
+	metadatatest.RunSuite(t, func(t *testing.T) metadata.MetadataStore {
+		store, _ := newDynamoDBTestStore(t, client, &config.DynamoDBConfig{EndpointURL: endpoint})
+		return store
+	})
+}
+
+// TestConformanceEtcd runs the suite against an etcd cluster when
+// BLEEPSTORE_TEST_ETCD_ENDPOINTS is set to its comma-separated client URLs
+// (e.g. http://localhost:2379). Each case gets its own key prefix.
+func TestConformanceEtcd(t *testing.T) {
+	endpoints := os.Getenv("BLEEPSTORE_TEST_ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("BLEEPSTORE_TEST_ETCD_ENDPOINTS not set")
+	}
+	client, err := clientv3.New(clientv3.Config{Endpoints: strings.Split(endpoints, ",")})
+	if err != nil {
+		t.Fatalf("connecting to etcd: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	var n atomic.Int64
+	metadatatest.RunSuite(t, func(t *testing.T) metadata.MetadataStore {
+		prefix := fmt.Sprintf("/bleepstore-conformance-%d-%d/", os.Getpid(), n.Add(1))
+		t.Cleanup(func() {
+			client.Delete(context.Background(), prefix, clientv3.WithPrefix())
+		})
+
+		store, err := metadata.NewEtcdStore(&config.EtcdConfig{Endpoints: strings.Split(endpoints, ","), Prefix: prefix})
+		if err != nil {
+			t.Fatalf("NewEtcdStore: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
@@ -126,6 +126,10 @@ type cosmosItem struct {
 	UserMetadata       string                 `json:"user_metadata,omitempty"`
 	LastModified       string                 `json:"last_modified,omitempty"`
 	DeleteMarker       bool                   `json:"delete_marker,omitempty"`
+	PartSizes          []int64                `json:"part_sizes,omitempty"`
+	Compression        string                 `json:"compression,omitempty"`
+	ReplicationStatus  string                 `json:"replication_status,omitempty"`
+	WebsiteRedirect    string                 `json:"website_redirect_location,omitempty"`
 	UploadID           string                 `json:"upload_id,omitempty"`
 	PartNumber         int                    `json:"part_number,omitempty"`
 	InitiatedAt        string                 `json:"initiated_at,omitempty"`
@@ -237,6 +241,10 @@ func (s *CosmosStore) ListBuckets(ctx context.Context, owner string) ([]BucketRe
 	return buckets, nil
 }
 
+func (s *CosmosStore) ListAllBuckets(ctx context.Context) ([]BucketRecord, error) {
+	return s.ListBuckets(ctx, "")
+}
+
 func (s *CosmosStore) BucketExists(ctx context.Context, name string) (bool, error) {
 	_, err := s.client.ReadItem(ctx, azcosmos.NewPartitionKeyString("bucket"), docIDBucketCosmos(name), nil)
 	if err != nil {
@@ -306,6 +314,10 @@ func (s *CosmosStore) PutObject(ctx context.Context, obj *ObjectRecord) error {
 		UserMetadata:       userMeta,
 		LastModified:       obj.LastModified.UTC().Format(cosmosTimeFormat),
 		DeleteMarker:       obj.DeleteMarker,
+		PartSizes:          obj.PartSizes,
+		Compression:        obj.Compression,
+		ReplicationStatus:  obj.ReplicationStatus,
+		WebsiteRedirect:    obj.WebsiteRedirectLocation,
 	}
 
 	data, err := json.Marshal(item)
@@ -564,6 +576,7 @@ func (s *CosmosStore) CreateMultipartUpload(ctx context.Context, upload *Multipa
 		OwnerID:            upload.OwnerID,
 		OwnerDisplay:       upload.OwnerDisplay,
 		InitiatedAt:        upload.InitiatedAt.UTC().Format(cosmosTimeFormat),
+		WebsiteRedirect:    upload.WebsiteRedirectLocation,
 	}
 
 	data, err := json.Marshal(item)
@@ -848,6 +861,38 @@ func (s *CosmosStore) GetCredential(ctx context.Context, accessKeyID string) (*C
 	}, nil
 }
 
+func (s *CosmosStore) ListCredentials(ctx context.Context) ([]CredentialRecord, error) {
+	pager := s.client.NewQueryItemsPager("SELECT * FROM c WHERE c.type = 'credential'", azcosmos.NewPartitionKeyString("credential"), nil)
+
+	var creds []CredentialRecord
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing credentials: %w", err)
+		}
+		for _, data := range resp.Items {
+			var item cosmosItem
+			if err := json.Unmarshal(data, &item); err != nil {
+				continue
+			}
+			createdAt, _ := time.Parse(cosmosTimeFormat, item.CreatedAt)
+			creds = append(creds, CredentialRecord{
+				AccessKeyID: item.AccessKeyID,
+				SecretKey:   item.SecretKey,
+				OwnerID:     item.OwnerID,
+				DisplayName: item.DisplayName,
+				Active:      item.Active,
+				CreatedAt:   createdAt,
+			})
+		}
+	}
+
+	sort.Slice(creds, func(i, j int) bool {
+		return creds[i].AccessKeyID < creds[j].AccessKeyID
+	})
+	return creds, nil
+}
+
 func (s *CosmosStore) PutCredential(ctx context.Context, cred *CredentialRecord) error {
 	item := &cosmosItem{
 		ID:          docIDCredentialCosmos(cred.AccessKeyID),
@@ -920,20 +965,24 @@ func (s *CosmosStore) ReapExpiredUploads(ttlSeconds int) ([]ExpiredUpload, error
 func (s *CosmosStore) itemToObject(item *cosmosItem) *ObjectRecord {
 	lastModified, _ := time.Parse(cosmosTimeFormat, item.LastModified)
 	obj := &ObjectRecord{
-		Bucket:             item.Bucket,
-		Key:                item.Key,
-		Size:               item.Size,
-		ETag:               item.ETag,
-		ContentType:        item.ContentType,
-		ContentEncoding:    item.ContentEncoding,
-		ContentLanguage:    item.ContentLanguage,
-		ContentDisposition: item.ContentDisposition,
-		CacheControl:       item.CacheControl,
-		Expires:            item.Expires,
-		StorageClass:       item.StorageClass,
-		ACL:                json.RawMessage(item.ACL),
-		LastModified:       lastModified,
-		DeleteMarker:       item.DeleteMarker,
+		Bucket:                  item.Bucket,
+		Key:                     item.Key,
+		Size:                    item.Size,
+		ETag:                    item.ETag,
+		ContentType:             item.ContentType,
+		ContentEncoding:         item.ContentEncoding,
+		ContentLanguage:         item.ContentLanguage,
+		ContentDisposition:      item.ContentDisposition,
+		CacheControl:            item.CacheControl,
+		Expires:                 item.Expires,
+		StorageClass:            item.StorageClass,
+		ACL:                     json.RawMessage(item.ACL),
+		LastModified:            lastModified,
+		DeleteMarker:            item.DeleteMarker,
+		PartSizes:               item.PartSizes,
+		Compression:             item.Compression,
+		ReplicationStatus:       item.ReplicationStatus,
+		WebsiteRedirectLocation: item.WebsiteRedirect,
 	}
 	if item.UserMetadata != "" && item.UserMetadata != "{}" {
 		obj.UserMetadata = make(map[string]string)
@@ -945,20 +994,21 @@ func (s *CosmosStore) itemToObject(item *cosmosItem) *ObjectRecord {
 func (s *CosmosStore) itemToUpload(item *cosmosItem) *MultipartUploadRecord {
 	initiatedAt, _ := time.Parse(cosmosTimeFormat, item.InitiatedAt)
 	upload := &MultipartUploadRecord{
-		UploadID:           item.UploadID,
-		Bucket:             item.Bucket,
-		Key:                item.Key,
-		ContentType:        item.ContentType,
-		ContentEncoding:    item.ContentEncoding,
-		ContentLanguage:    item.ContentLanguage,
-		ContentDisposition: item.ContentDisposition,
-		CacheControl:       item.CacheControl,
-		Expires:            item.Expires,
-		StorageClass:       item.StorageClass,
-		ACL:                json.RawMessage(item.ACL),
-		OwnerID:            item.OwnerID,
-		OwnerDisplay:       item.OwnerDisplay,
-		InitiatedAt:        initiatedAt,
+		UploadID:                item.UploadID,
+		Bucket:                  item.Bucket,
+		Key:                     item.Key,
+		ContentType:             item.ContentType,
+		ContentEncoding:         item.ContentEncoding,
+		ContentLanguage:         item.ContentLanguage,
+		ContentDisposition:      item.ContentDisposition,
+		CacheControl:            item.CacheControl,
+		Expires:                 item.Expires,
+		StorageClass:            item.StorageClass,
+		ACL:                     json.RawMessage(item.ACL),
+		OwnerID:                 item.OwnerID,
+		OwnerDisplay:            item.OwnerDisplay,
+		InitiatedAt:             initiatedAt,
+		WebsiteRedirectLocation: item.WebsiteRedirect,
 	}
 	if item.UserMetadata != "" && item.UserMetadata != "{}" {
 		upload.UserMetadata = make(map[string]string)
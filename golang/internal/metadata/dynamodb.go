@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -17,13 +19,24 @@ import (
 
 const (
 	dynamoTimeFormat = "2006-01-02T15:04:05.000Z"
+
+	// dynamoListIndex is the global secondary index listings query. Its
+	// partition key list_pk groups a bucket's objects (OBJECTS#bucket) or
+	// uploads (UPLOADS#bucket), and its sort key list_sk orders them by key,
+	// so listings are ranged Queries instead of table Scans. The index must
+	// project all attributes.
+	dynamoListIndex = "list-index"
 )
 
 type DynamoDBStore struct {
 	client    *dynamodb.Client
 	tableName string
+	uploadTTL time.Duration
 }
 
+// dynamoDefaultUploadTTL is the upload item TTL used when none is configured.
+const dynamoDefaultUploadTTL = 7 * 24 * time.Hour
+
 func NewDynamoDBStore(cfg *config.DynamoDBConfig) (*DynamoDBStore, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("dynamodb config is required")
@@ -59,9 +72,15 @@ func NewDynamoDBStore(cfg *config.DynamoDBConfig) (*DynamoDBStore, error) {
 
 	client := dynamodb.NewFromConfig(awsCfg)
 
+	uploadTTL := time.Duration(cfg.UploadTTLSeconds) * time.Second
+	if uploadTTL <= 0 {
+		uploadTTL = dynamoDefaultUploadTTL
+	}
+
 	return &DynamoDBStore{
 		client:    client,
 		tableName: cfg.Table,
+		uploadTTL: uploadTTL,
 	}, nil
 }
 
@@ -76,6 +95,13 @@ func (s *DynamoDBStore) Close() error {
 	return nil
 }
 
+// Consistency reports that reads may miss recent writes: GetItem is issued
+// without ConsistentRead, and listings query a global secondary index, which
+// DynamoDB only updates asynchronously.
+func (s *DynamoDBStore) Consistency() Consistency {
+	return Consistency{}
+}
+
 func pkBucket(bucket string) string {
 	return "BUCKET#" + bucket
 }
@@ -92,6 +118,26 @@ func pkCredential(accessKey string) string {
 	return "CRED#" + accessKey
 }
 
+func listPKObjects(bucket string) string {
+	return "OBJECTS#" + bucket
+}
+
+func listPKUploads(bucket string) string {
+	return "UPLOADS#" + bucket
+}
+
+// listSKUpload orders uploads by key, then initiation time, then upload ID.
+// NUL separators sort a key's uploads before any longer key.
+func listSKUpload(key, initiatedAt, uploadID string) string {
+	return key + "\x00" + initiatedAt + "\x00" + uploadID
+}
+
+// expiresAt returns the TTL attribute value for an upload started at t, in
+// epoch seconds as DynamoDB TTL requires.
+func (s *DynamoDBStore) expiresAt(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Add(s.uploadTTL).Unix(), 10)}
+}
+
 func skMetadata() string {
 	return "#METADATA"
 }
@@ -205,6 +251,10 @@ func (s *DynamoDBStore) ListBuckets(ctx context.Context, owner string) ([]Bucket
 	return buckets, nil
 }
 
+func (s *DynamoDBStore) ListAllBuckets(ctx context.Context) ([]BucketRecord, error) {
+	return s.ListBuckets(ctx, "")
+}
+
 func (s *DynamoDBStore) BucketExists(ctx context.Context, name string) (bool, error) {
 	resp, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(s.tableName),
@@ -234,6 +284,50 @@ func (s *DynamoDBStore) UpdateBucketAcl(ctx context.Context, name string, acl js
 }
 
 func (s *DynamoDBStore) PutObject(ctx context.Context, obj *ObjectRecord) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      objectItem(obj),
+	})
+	return err
+}
+
+// PutObjectIf writes obj if the current record meets cond, with the
+// condition checked by DynamoDB as part of the write.
+func (s *DynamoDBStore) PutObjectIf(ctx context.Context, obj *ObjectRecord, cond WriteCondition) error {
+	var conds []string
+	values := map[string]types.AttributeValue{}
+	if cond.IfNoneMatch {
+		conds = append(conds, "attribute_not_exists(pk)")
+	}
+	switch etag := strings.Trim(cond.IfMatch, `"`); {
+	case cond.IfMatch == "":
+	case etag == "*":
+		conds = append(conds, "attribute_exists(pk)")
+	default:
+		// Stored ETags may or may not be quoted.
+		conds = append(conds, "etag IN (:etag, :quoted_etag)")
+		values[":etag"] = &types.AttributeValueMemberS{Value: etag}
+		values[":quoted_etag"] = &types.AttributeValueMemberS{Value: `"` + etag + `"`}
+	}
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      objectItem(obj),
+	}
+	if len(conds) > 0 {
+		input.ConditionExpression = aws.String(strings.Join(conds, " AND "))
+	}
+	if len(values) > 0 {
+		input.ExpressionAttributeValues = values
+	}
+	_, err := s.client.PutItem(ctx, input)
+	if err != nil && strings.Contains(err.Error(), "ConditionalCheckFailedException") {
+		return ErrPreconditionFailed
+	}
+	return err
+}
+
+// objectItem encodes obj as an object metadata item.
+func objectItem(obj *ObjectRecord) map[string]types.AttributeValue {
 	acl := "{}"
 	if obj.ACL != nil {
 		acl = string(obj.ACL)
@@ -265,11 +359,25 @@ func (s *DynamoDBStore) PutObject(ctx context.Context, obj *ObjectRecord) error
 		"acl":           &types.AttributeValueMemberS{Value: acl},
 		"user_metadata": &types.AttributeValueMemberS{Value: userMeta},
 		"last_modified": &types.AttributeValueMemberS{Value: obj.LastModified.UTC().Format(dynamoTimeFormat)},
+		"list_pk":       &types.AttributeValueMemberS{Value: listPKObjects(obj.Bucket)},
+		"list_sk":       &types.AttributeValueMemberS{Value: obj.Key},
 	}
 
 	if obj.ContentEncoding != "" {
 		item["content_encoding"] = &types.AttributeValueMemberS{Value: obj.ContentEncoding}
 	}
+	if obj.PartSizes != nil {
+		item["part_sizes"] = &types.AttributeValueMemberS{Value: encodePartSizes(obj.PartSizes)}
+	}
+	if obj.Compression != "" {
+		item["compression"] = &types.AttributeValueMemberS{Value: obj.Compression}
+	}
+	if obj.ReplicationStatus != "" {
+		item["replication_status"] = &types.AttributeValueMemberS{Value: obj.ReplicationStatus}
+	}
+	if obj.WebsiteRedirectLocation != "" {
+		item["website_redirect_location"] = &types.AttributeValueMemberS{Value: obj.WebsiteRedirectLocation}
+	}
 	if obj.ContentLanguage != "" {
 		item["content_language"] = &types.AttributeValueMemberS{Value: obj.ContentLanguage}
 	}
@@ -282,12 +390,7 @@ func (s *DynamoDBStore) PutObject(ctx context.Context, obj *ObjectRecord) error
 	if obj.Expires != "" {
 		item["expires"] = &types.AttributeValueMemberS{Value: obj.Expires}
 	}
-
-	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(s.tableName),
-		Item:      item,
-	})
-	return err
+	return item
 }
 
 func (s *DynamoDBStore) GetObject(ctx context.Context, bucket, key string) (*ObjectRecord, error) {
@@ -388,6 +491,31 @@ func (s *DynamoDBStore) UpdateObjectAcl(ctx context.Context, bucket, key string,
 	return err
 }
 
+// queryList reads one page of the list index for listPK, starting at lower
+// (or just after it when exclusive). An empty lower starts at the beginning.
+func (s *DynamoDBStore) queryList(ctx context.Context, listPK, lower string, exclusive bool, limit int, startKey map[string]types.AttributeValue) (*dynamodb.QueryOutput, error) {
+	cond := "list_pk = :pk"
+	values := map[string]types.AttributeValue{
+		":pk": &types.AttributeValueMemberS{Value: listPK},
+	}
+	if lower != "" {
+		if exclusive {
+			cond += " AND list_sk > :lower"
+		} else {
+			cond += " AND list_sk >= :lower"
+		}
+		values[":lower"] = &types.AttributeValueMemberS{Value: lower}
+	}
+	return s.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(s.tableName),
+		IndexName:                 aws.String(dynamoListIndex),
+		KeyConditionExpression:    aws.String(cond),
+		ExpressionAttributeValues: values,
+		Limit:                     aws.Int32(int32(limit)),
+		ExclusiveStartKey:         startKey,
+	})
+}
+
 func (s *DynamoDBStore) ListObjects(ctx context.Context, bucket string, opts ListObjectsOptions) (*ListObjectsResult, error) {
 	maxKeys := opts.MaxKeys
 	if maxKeys <= 0 {
@@ -402,128 +530,88 @@ func (s *DynamoDBStore) ListObjects(ctx context.Context, bucket string, opts Lis
 		startAfter = opts.Marker
 	}
 
-	prefixFilter := "OBJECT#" + bucket + "#"
-	if opts.Prefix != "" {
-		prefixFilter = pkObject(bucket, opts.Prefix)
+	// Start at the prefix, or just after the marker if it sorts later.
+	lower, exclusive := opts.Prefix, false
+	if startAfter != "" && startAfter >= opts.Prefix {
+		lower, exclusive = startAfter, true
 	}
 
-	var allObjects []ObjectRecord
-	var exclusiveStartKey map[string]types.AttributeValue
+	result := &ListObjectsResult{}
+	count := 0
+	var last, skip string
+	var startKey map[string]types.AttributeValue
 
-	for len(allObjects) <= maxKeys {
-		input := &dynamodb.ScanInput{
-			TableName:        aws.String(s.tableName),
-			FilterExpression: aws.String("begins_with(pk, :prefix) AND sk = :meta"),
-			ExpressionAttributeValues: map[string]types.AttributeValue{
-				":prefix": &types.AttributeValueMemberS{Value: prefixFilter},
-				":meta":   &types.AttributeValueMemberS{Value: skMetadata()},
-			},
-			Limit: aws.Int32(int32(maxKeys + 1)),
-		}
-		if exclusiveStartKey != nil {
-			input.ExclusiveStartKey = exclusiveStartKey
-		}
-
-		resp, err := s.client.Scan(ctx, input)
+	for {
+		resp, err := s.queryList(ctx, listPKObjects(bucket), lower, exclusive, maxKeys+1, startKey)
 		if err != nil {
 			return nil, fmt.Errorf("listing objects: %w", err)
 		}
 
+		done, restart := false, false
 		for _, item := range resp.Items {
 			obj := s.itemToObject(item)
-			if opts.Prefix != "" && !strings.HasPrefix(obj.Key, opts.Prefix) {
-				continue
+			if !strings.HasPrefix(obj.Key, opts.Prefix) {
+				// Keys are sorted, so nothing later matches the prefix.
+				done = true
+				break
 			}
-			if startAfter != "" && obj.Key <= startAfter {
+			if skip != "" && strings.HasPrefix(obj.Key, skip) {
 				continue
 			}
-			allObjects = append(allObjects, *obj)
-			if len(allObjects) > maxKeys {
-				break
+
+			if opts.Delimiter != "" {
+				rest := obj.Key[len(opts.Prefix):]
+				if idx := strings.Index(rest, opts.Delimiter); idx >= 0 {
+					cp := opts.Prefix + rest[:idx+len(opts.Delimiter)]
+					if cp > startAfter {
+						if count == maxKeys {
+							result.IsTruncated = true
+							done = true
+							break
+						}
+						result.CommonPrefixes = append(result.CommonPrefixes, cp)
+						count++
+						last = cp
+					}
+					// Skip the rest of the common prefix with a new Query
+					// when its end is a valid key, otherwise item by item.
+					if end := prefixEnd([]byte(cp)); end != nil && utf8.Valid(end) {
+						lower, exclusive = string(end), false
+						restart = true
+						break
+					}
+					skip = cp
+					continue
+				}
 			}
-		}
 
-		if resp.LastEvaluatedKey == nil {
-			break
+			if count == maxKeys {
+				result.IsTruncated = true
+				done = true
+				break
+			}
+			result.Objects = append(result.Objects, *obj)
+			count++
+			last = obj.Key
 		}
-		exclusiveStartKey = resp.LastEvaluatedKey
 
-		if len(allObjects) > maxKeys {
+		if done {
 			break
 		}
-	}
-
-	sort.Slice(allObjects, func(i, j int) bool {
-		return allObjects[i].Key < allObjects[j].Key
-	})
-
-	if opts.Delimiter == "" {
-		isTruncated := len(allObjects) > maxKeys
-		if isTruncated {
-			allObjects = allObjects[:maxKeys]
-		}
-		result := &ListObjectsResult{
-			Objects:     allObjects,
-			IsTruncated: isTruncated,
-		}
-		if isTruncated && len(allObjects) > 0 {
-			lastKey := allObjects[len(allObjects)-1].Key
-			result.NextMarker = lastKey
-			result.NextContinuationToken = lastKey
-		}
-		return result, nil
-	}
-
-	var objects []ObjectRecord
-	prefixSet := make(map[string]bool)
-
-	for _, obj := range allObjects {
-		keyAfterPrefix := obj.Key
-		if opts.Prefix != "" {
-			keyAfterPrefix = obj.Key[len(opts.Prefix):]
-		}
-
-		delimIdx := strings.Index(keyAfterPrefix, opts.Delimiter)
-		if delimIdx >= 0 {
-			commonPrefix := opts.Prefix + keyAfterPrefix[:delimIdx+len(opts.Delimiter)]
-			prefixSet[commonPrefix] = true
-		} else {
-			objects = append(objects, obj)
+		if restart {
+			startKey = nil
+			continue
 		}
-
-		if len(objects)+len(prefixSet) >= maxKeys {
+		if resp.LastEvaluatedKey == nil {
 			break
 		}
+		startKey = resp.LastEvaluatedKey
 	}
 
-	var commonPrefixes []string
-	for p := range prefixSet {
-		commonPrefixes = append(commonPrefixes, p)
-	}
-	sort.Strings(commonPrefixes)
-
-	isTruncated := len(objects)+len(commonPrefixes) > maxKeys || len(allObjects) > maxKeys
-
-	result := &ListObjectsResult{
-		Objects:        objects,
-		CommonPrefixes: commonPrefixes,
-		IsTruncated:    isTruncated,
+	if result.IsTruncated {
+		result.NextMarker = last
+		result.NextContinuationToken = last
 	}
-	if isTruncated {
-		var lastKey string
-		if len(objects) > 0 {
-			lastKey = objects[len(objects)-1].Key
-		}
-		if len(commonPrefixes) > 0 {
-			lastPrefix := commonPrefixes[len(commonPrefixes)-1]
-			if lastPrefix > lastKey {
-				lastKey = lastPrefix
-			}
-		}
-		result.NextMarker = lastKey
-		result.NextContinuationToken = lastKey
-	}
-
 	return result, nil
 }
 
@@ -554,6 +642,7 @@ func (s *DynamoDBStore) CreateMultipartUpload(ctx context.Context, upload *Multi
 	if storageClass == "" {
 		storageClass = "STANDARD"
 	}
+	initiatedAt := upload.InitiatedAt.UTC().Format(dynamoTimeFormat)
 
 	item := map[string]types.AttributeValue{
 		"pk":            &types.AttributeValueMemberS{Value: pkUpload(uploadID)},
@@ -568,7 +657,10 @@ func (s *DynamoDBStore) CreateMultipartUpload(ctx context.Context, upload *Multi
 		"user_metadata": &types.AttributeValueMemberS{Value: userMeta},
 		"owner_id":      &types.AttributeValueMemberS{Value: upload.OwnerID},
 		"owner_display": &types.AttributeValueMemberS{Value: upload.OwnerDisplay},
-		"initiated_at":  &types.AttributeValueMemberS{Value: upload.InitiatedAt.UTC().Format(dynamoTimeFormat)},
+		"initiated_at":  &types.AttributeValueMemberS{Value: initiatedAt},
+		"list_pk":       &types.AttributeValueMemberS{Value: listPKUploads(upload.Bucket)},
+		"list_sk":       &types.AttributeValueMemberS{Value: listSKUpload(upload.Key, initiatedAt, uploadID)},
+		"expires_at":    s.expiresAt(upload.InitiatedAt),
 	}
 
 	if upload.ContentEncoding != "" {
@@ -586,6 +678,9 @@ func (s *DynamoDBStore) CreateMultipartUpload(ctx context.Context, upload *Multi
 	if upload.Expires != "" {
 		item["expires"] = &types.AttributeValueMemberS{Value: upload.Expires}
 	}
+	if upload.WebsiteRedirectLocation != "" {
+		item["website_redirect_location"] = &types.AttributeValueMemberS{Value: upload.WebsiteRedirectLocation}
+	}
 
 	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(s.tableName),
@@ -632,6 +727,7 @@ func (s *DynamoDBStore) PutPart(ctx context.Context, part *PartRecord) error {
 			"size":          &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", part.Size)},
 			"etag":          &types.AttributeValueMemberS{Value: part.ETag},
 			"last_modified": &types.AttributeValueMemberS{Value: part.LastModified.UTC().Format(dynamoTimeFormat)},
+			"expires_at":    s.expiresAt(time.Now()),
 		},
 	})
 	return err
@@ -804,34 +900,51 @@ func (s *DynamoDBStore) CompleteMultipartUpload(ctx context.Context, bucket, key
 }
 
 func (s *DynamoDBStore) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
-	parts, _ := s.GetPartsForCompletion(ctx, uploadID, nil)
-
-	if len(parts) > 0 {
-		for i := 0; i < len(parts); i += 25 {
-			end := i + 25
-			if end > len(parts) {
-				end = len(parts)
-			}
-			batch := parts[i:end]
+	return s.deleteUploadItems(ctx, uploadID)
+}
 
-			var writeRequests []types.WriteRequest
-			for _, p := range batch {
-				writeRequests = append(writeRequests, types.WriteRequest{
-					DeleteRequest: &types.DeleteRequest{
-						Key: map[string]types.AttributeValue{
-							"pk": &types.AttributeValueMemberS{Value: pkUpload(uploadID)},
-							"sk": &types.AttributeValueMemberS{Value: skPart(p.PartNumber)},
-						},
-					},
-				})
-			}
+// deleteUploadItems deletes an upload's part items and then its metadata
+// item. The parts are found with a Query on the upload's partition.
+func (s *DynamoDBStore) deleteUploadItems(ctx context.Context, uploadID string) error {
+	var keys []map[string]types.AttributeValue
+	var exclusiveStartKey map[string]types.AttributeValue
+	for {
+		resp, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.tableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :part_prefix)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":          &types.AttributeValueMemberS{Value: pkUpload(uploadID)},
+				":part_prefix": &types.AttributeValueMemberS{Value: "PART#"},
+			},
+			ProjectionExpression: aws.String("pk, sk"),
+			ExclusiveStartKey:    exclusiveStartKey,
+		})
+		if err != nil {
+			return fmt.Errorf("querying parts of upload %s: %w", uploadID, err)
+		}
+		keys = append(keys, resp.Items...)
+		if resp.LastEvaluatedKey == nil {
+			break
+		}
+		exclusiveStartKey = resp.LastEvaluatedKey
+	}
 
-			_, _ = s.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-				RequestItems: map[string][]types.WriteRequest{
-					s.tableName: writeRequests,
-				},
+	for i := 0; i < len(keys); i += 25 {
+		end := min(i+25, len(keys))
+		var writeRequests []types.WriteRequest
+		for _, k := range keys[i:end] {
+			writeRequests = append(writeRequests, types.WriteRequest{
+				DeleteRequest: &types.DeleteRequest{Key: k},
 			})
 		}
+		_, err := s.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				s.tableName: writeRequests,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("deleting parts of upload %s: %w", uploadID, err)
+		}
 	}
 
 	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
@@ -841,7 +954,6 @@ func (s *DynamoDBStore) AbortMultipartUpload(ctx context.Context, bucket, key, u
 			"sk": &types.AttributeValueMemberS{Value: skMetadata()},
 		},
 	})
-
 	return err
 }
 
@@ -851,84 +963,65 @@ func (s *DynamoDBStore) ListMultipartUploads(ctx context.Context, bucket string,
 		maxUploads = 1000
 	}
 
-	var allUploads []MultipartUploadRecord
-	var exclusiveStartKey map[string]types.AttributeValue
-
-	filterExpr := "begins_with(pk, :upload_prefix) AND sk = :meta AND #bucket = :bucket"
-	exprValues := map[string]types.AttributeValue{
-		":upload_prefix": &types.AttributeValueMemberS{Value: "UPLOAD#"},
-		":meta":          &types.AttributeValueMemberS{Value: skMetadata()},
-		":bucket":        &types.AttributeValueMemberS{Value: bucket},
-	}
-	exprNames := map[string]string{"#bucket": "bucket"}
-
-	if opts.Prefix != "" {
-		filterExpr += " AND begins_with(#key, :prefix)"
-		exprValues[":prefix"] = &types.AttributeValueMemberS{Value: opts.Prefix}
-		exprNames["#key"] = "key"
-	}
-
-	for len(allUploads) < maxUploads+1 {
-		input := &dynamodb.ScanInput{
-			TableName:                 aws.String(s.tableName),
-			FilterExpression:          aws.String(filterExpr),
-			ExpressionAttributeValues: exprValues,
-			ExpressionAttributeNames:  exprNames,
-			Limit:                     aws.Int32(int32(maxUploads + 1)),
+	// Resolve the markers to a position in the index. An upload ID marker
+	// needs the upload's initiation time; if the upload is gone, resume
+	// after every upload for the key marker.
+	lower, exclusive := opts.Prefix, false
+	if opts.KeyMarker != "" {
+		marker, markerExclusive := opts.KeyMarker+"\x01", false
+		if opts.UploadIDMarker != "" {
+			upload, err := s.GetMultipartUpload(ctx, bucket, opts.KeyMarker, opts.UploadIDMarker)
+			if err != nil {
+				return nil, fmt.Errorf("listing multipart uploads: %w", err)
+			}
+			if upload != nil && upload.Bucket == bucket && upload.Key == opts.KeyMarker {
+				marker = listSKUpload(upload.Key, upload.InitiatedAt.UTC().Format(dynamoTimeFormat), upload.UploadID)
+				markerExclusive = true
+			}
 		}
-		if exclusiveStartKey != nil {
-			input.ExclusiveStartKey = exclusiveStartKey
+		if marker > lower {
+			lower, exclusive = marker, markerExclusive
 		}
+	}
 
-		resp, err := s.client.Scan(ctx, input)
+	var uploads []MultipartUploadRecord
+	var startKey map[string]types.AttributeValue
+	for len(uploads) <= maxUploads {
+		resp, err := s.queryList(ctx, listPKUploads(bucket), lower, exclusive, maxUploads+1, startKey)
 		if err != nil {
 			return nil, fmt.Errorf("listing multipart uploads: %w", err)
 		}
 
+		done := false
 		for _, item := range resp.Items {
-			allUploads = append(allUploads, *s.itemToUpload(item))
+			upload := s.itemToUpload(item)
+			if !strings.HasPrefix(upload.Key, opts.Prefix) {
+				done = true
+				break
+			}
+			uploads = append(uploads, *upload)
+			if len(uploads) > maxUploads {
+				break
+			}
 		}
 
-		if resp.LastEvaluatedKey == nil {
+		if done || resp.LastEvaluatedKey == nil {
 			break
 		}
-		exclusiveStartKey = resp.LastEvaluatedKey
+		startKey = resp.LastEvaluatedKey
 	}
 
-	sort.Slice(allUploads, func(i, j int) bool {
-		if allUploads[i].Key != allUploads[j].Key {
-			return allUploads[i].Key < allUploads[j].Key
-		}
-		return allUploads[i].InitiatedAt.Before(allUploads[j].InitiatedAt)
-	})
-
-	if opts.KeyMarker != "" || opts.UploadIDMarker != "" {
-		var filtered []MultipartUploadRecord
-		passedMarker := opts.KeyMarker == ""
-		for _, u := range allUploads {
-			if !passedMarker {
-				if u.Key > opts.KeyMarker || (u.Key == opts.KeyMarker && u.UploadID > opts.UploadIDMarker) {
-					passedMarker = true
-				}
-			}
-			if passedMarker {
-				filtered = append(filtered, u)
-			}
-		}
-		allUploads = filtered
-	}
-
-	isTruncated := len(allUploads) > maxUploads
+	isTruncated := len(uploads) > maxUploads
 	if isTruncated {
-		allUploads = allUploads[:maxUploads]
+		uploads = uploads[:maxUploads]
 	}
 
 	result := &ListUploadsResult{
-		Uploads:     allUploads,
+		Uploads:     uploads,
 		IsTruncated: isTruncated,
 	}
-	if isTruncated && len(allUploads) > 0 {
-		last := allUploads[len(allUploads)-1]
+	if isTruncated && len(uploads) > 0 {
+		last := uploads[len(uploads)-1]
 		result.NextKeyMarker = last.Key
 		result.NextUploadIDMarker = last.UploadID
 	}
@@ -936,6 +1029,63 @@ func (s *DynamoDBStore) ListMultipartUploads(ctx context.Context, bucket string,
 	return result, nil
 }
 
+// BackfillListIndex adds the list index attributes to object and upload
+// items written before the index existed, so they appear in listings. It
+// scans the table once and returns the number of items updated.
+func (s *DynamoDBStore) BackfillListIndex(ctx context.Context) (int, error) {
+	updated := 0
+	var exclusiveStartKey map[string]types.AttributeValue
+	for {
+		input := &dynamodb.ScanInput{
+			TableName:        aws.String(s.tableName),
+			FilterExpression: aws.String("(begins_with(pk, :object_prefix) OR begins_with(pk, :upload_prefix)) AND sk = :meta AND attribute_not_exists(list_pk)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":object_prefix": &types.AttributeValueMemberS{Value: "OBJECT#"},
+				":upload_prefix": &types.AttributeValueMemberS{Value: "UPLOAD#"},
+				":meta":          &types.AttributeValueMemberS{Value: skMetadata()},
+			},
+			ExclusiveStartKey: exclusiveStartKey,
+		}
+
+		resp, err := s.client.Scan(ctx, input)
+		if err != nil {
+			return updated, fmt.Errorf("scanning for list index backfill: %w", err)
+		}
+
+		for _, item := range resp.Items {
+			var listPK, listSK string
+			if getString(item, "type") == "upload" {
+				listPK = listPKUploads(getString(item, "bucket"))
+				listSK = listSKUpload(getString(item, "key"), getString(item, "initiated_at"), getString(item, "upload_id"))
+			} else {
+				listPK = listPKObjects(getString(item, "bucket"))
+				listSK = getString(item, "key")
+			}
+			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(s.tableName),
+				Key: map[string]types.AttributeValue{
+					"pk": item["pk"],
+					"sk": item["sk"],
+				},
+				UpdateExpression: aws.String("SET list_pk = :list_pk, list_sk = :list_sk"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":list_pk": &types.AttributeValueMemberS{Value: listPK},
+					":list_sk": &types.AttributeValueMemberS{Value: listSK},
+				},
+			})
+			if err != nil {
+				return updated, fmt.Errorf("backfilling list index for %s: %w", getString(item, "pk"), err)
+			}
+			updated++
+		}
+
+		if resp.LastEvaluatedKey == nil {
+			return updated, nil
+		}
+		exclusiveStartKey = resp.LastEvaluatedKey
+	}
+}
+
 func (s *DynamoDBStore) GetCredential(ctx context.Context, accessKeyID string) (*CredentialRecord, error) {
 	resp, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(s.tableName),
@@ -954,12 +1104,44 @@ func (s *DynamoDBStore) GetCredential(ctx context.Context, accessKeyID string) (
 	return s.itemToCredential(resp.Item), nil
 }
 
-func (s *DynamoDBStore) PutCredential(ctx context.Context, cred *CredentialRecord) error {
-	active := "true"
-	if !cred.Active {
-		active = "false"
+func (s *DynamoDBStore) ListCredentials(ctx context.Context) ([]CredentialRecord, error) {
+	var creds []CredentialRecord
+
+	var exclusiveStartKey map[string]types.AttributeValue
+	for {
+		input := &dynamodb.ScanInput{
+			TableName:        aws.String(s.tableName),
+			FilterExpression: aws.String("begins_with(pk, :prefix) AND sk = :meta"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":prefix": &types.AttributeValueMemberS{Value: "CRED#"},
+				":meta":   &types.AttributeValueMemberS{Value: skMetadata()},
+			},
+		}
+		if exclusiveStartKey != nil {
+			input.ExclusiveStartKey = exclusiveStartKey
+		}
+
+		resp, err := s.client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("listing credentials: %w", err)
+		}
+		for _, item := range resp.Items {
+			creds = append(creds, *s.itemToCredential(item))
+		}
+
+		if resp.LastEvaluatedKey == nil {
+			break
+		}
+		exclusiveStartKey = resp.LastEvaluatedKey
 	}
 
+	sort.Slice(creds, func(i, j int) bool {
+		return creds[i].AccessKeyID < creds[j].AccessKeyID
+	})
+	return creds, nil
+}
+
+func (s *DynamoDBStore) PutCredential(ctx context.Context, cred *CredentialRecord) error {
 	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(s.tableName),
 		Item: map[string]types.AttributeValue{
@@ -971,94 +1153,128 @@ func (s *DynamoDBStore) PutCredential(ctx context.Context, cred *CredentialRecor
 			"owner_id":      &types.AttributeValueMemberS{Value: cred.OwnerID},
 			"display_name":  &types.AttributeValueMemberS{Value: cred.DisplayName},
 			"active":        &types.AttributeValueMemberBOOL{Value: cred.Active},
-			"created_at":    &types.AttributeValueMemberS{Value: active},
+			"created_at":    &types.AttributeValueMemberS{Value: cred.CreatedAt.UTC().Format(dynamoTimeFormat)},
 		},
 	})
 	return err
 }
 
-func (s *DynamoDBStore) ReapExpiredUploads(ttlSeconds int) ([]ExpiredUpload, error) {
-	cutoff := time.Now().Add(-time.Duration(ttlSeconds) * time.Second).UTC().Format(dynamoTimeFormat)
-
-	var items []map[string]types.AttributeValue
-	var exclusiveStartKey map[string]types.AttributeValue
+func pkLease(name string) string {
+	return "LEASE#" + name
+}
 
-	for {
-		input := &dynamodb.ScanInput{
-			TableName:        aws.String(s.tableName),
-			FilterExpression: aws.String("begins_with(pk, :upload_prefix) AND sk = :meta AND initiated_at < :cutoff"),
-			ExpressionAttributeValues: map[string]types.AttributeValue{
-				":upload_prefix": &types.AttributeValueMemberS{Value: "UPLOAD#"},
-				":meta":          &types.AttributeValueMemberS{Value: skMetadata()},
-				":cutoff":        &types.AttributeValueMemberS{Value: cutoff},
-			},
-		}
-		if exclusiveStartKey != nil {
-			input.ExclusiveStartKey = exclusiveStartKey
-		}
+// AcquireLease claims the named lease with a conditional write, reading
+// the holder back strongly consistently when the condition fails.
+func (s *DynamoDBStore) AcquireLease(ctx context.Context, name, holder string, now, expires time.Time) (*Lease, error) {
+	key := map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: pkLease(name)},
+		"sk": &types.AttributeValueMemberS{Value: skMetadata()},
+	}
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]types.AttributeValue{
+			"pk":         key["pk"],
+			"sk":         key["sk"],
+			"type":       &types.AttributeValueMemberS{Value: "lease"},
+			"holder":     &types.AttributeValueMemberS{Value: holder},
+			"expires_ms": &types.AttributeValueMemberN{Value: strconv.FormatInt(expires.UnixMilli(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR holder = :holder OR expires_ms < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":holder": &types.AttributeValueMemberS{Value: holder},
+			":now":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+		},
+	})
+	if err == nil {
+		return &Lease{Name: name, Holder: holder, Expires: expires}, nil
+	}
+	if !strings.Contains(err.Error(), "ConditionalCheckFailedException") {
+		return nil, fmt.Errorf("acquiring lease %q: %w", name, err)
+	}
+	resp, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tableName),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading lease %q: %w", name, err)
+	}
+	return &Lease{
+		Name:    name,
+		Holder:  getString(resp.Item, "holder"),
+		Expires: time.UnixMilli(getNInt(resp.Item, "expires_ms")),
+	}, nil
+}
 
-		resp, err := s.client.Scan(context.Background(), input)
-		if err != nil {
-			return nil, fmt.Errorf("scanning expired uploads: %w", err)
-		}
+// ReleaseLease deletes the named lease if holder holds it.
+func (s *DynamoDBStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: pkLease(name)},
+			"sk": &types.AttributeValueMemberS{Value: skMetadata()},
+		},
+		ConditionExpression: aws.String("holder = :holder"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":holder": &types.AttributeValueMemberS{Value: holder},
+		},
+	})
+	if err != nil && !strings.Contains(err.Error(), "ConditionalCheckFailedException") {
+		return fmt.Errorf("releasing lease %q: %w", name, err)
+	}
+	return nil
+}
 
-		items = append(items, resp.Items...)
+func (s *DynamoDBStore) ReapExpiredUploads(ttlSeconds int) ([]ExpiredUpload, error) {
+	ctx := context.Background()
+	cutoff := time.Now().Add(-time.Duration(ttlSeconds) * time.Second).UTC().Format(dynamoTimeFormat)
 
-		if resp.LastEvaluatedKey == nil {
-			break
-		}
-		exclusiveStartKey = resp.LastEvaluatedKey
+	// Sweep each bucket's in-progress uploads through the list index rather
+	// than scanning the table, so the cost follows the number of open
+	// uploads instead of the number of objects. Uploads the sweep misses
+	// (e.g. in a bucket that no longer exists) are removed by the native
+	// TTL on expires_at.
+	buckets, err := s.ListAllBuckets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing buckets for upload sweep: %w", err)
 	}
 
 	var reaped []ExpiredUpload
-	for _, item := range items {
-		upload := s.itemToUpload(item)
-		uploadID := upload.UploadID
-		bucket := upload.Bucket
-		key := upload.Key
-
-		parts, _ := s.GetPartsForCompletion(context.Background(), uploadID, nil)
-		if len(parts) > 0 {
-			for i := 0; i < len(parts); i += 25 {
-				end := i + 25
-				if end > len(parts) {
-					end = len(parts)
-				}
-				batch := parts[i:end]
-
-				var writeRequests []types.WriteRequest
-				for _, p := range batch {
-					writeRequests = append(writeRequests, types.WriteRequest{
-						DeleteRequest: &types.DeleteRequest{
-							Key: map[string]types.AttributeValue{
-								"pk": &types.AttributeValueMemberS{Value: pkUpload(uploadID)},
-								"sk": &types.AttributeValueMemberS{Value: skPart(p.PartNumber)},
-							},
-						},
-					})
-				}
+	for _, b := range buckets {
+		var exclusiveStartKey map[string]types.AttributeValue
+		for {
+			resp, err := s.client.Query(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(s.tableName),
+				IndexName:              aws.String(dynamoListIndex),
+				KeyConditionExpression: aws.String("list_pk = :pk"),
+				FilterExpression:       aws.String("initiated_at < :cutoff"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":pk":     &types.AttributeValueMemberS{Value: listPKUploads(b.Name)},
+					":cutoff": &types.AttributeValueMemberS{Value: cutoff},
+				},
+				ExclusiveStartKey: exclusiveStartKey,
+			})
+			if err != nil {
+				return reaped, fmt.Errorf("querying expired uploads in %s: %w", b.Name, err)
+			}
 
-				_, _ = s.client.BatchWriteItem(context.Background(), &dynamodb.BatchWriteItemInput{
-					RequestItems: map[string][]types.WriteRequest{
-						s.tableName: writeRequests,
-					},
+			for _, item := range resp.Items {
+				upload := s.itemToUpload(item)
+				if err := s.deleteUploadItems(ctx, upload.UploadID); err != nil {
+					return reaped, fmt.Errorf("reaping upload %s: %w", upload.UploadID, err)
+				}
+				reaped = append(reaped, ExpiredUpload{
+					UploadID:   upload.UploadID,
+					BucketName: upload.Bucket,
+					ObjectKey:  upload.Key,
 				})
 			}
-		}
-
-		_, _ = s.client.DeleteItem(context.Background(), &dynamodb.DeleteItemInput{
-			TableName: aws.String(s.tableName),
-			Key: map[string]types.AttributeValue{
-				"pk": &types.AttributeValueMemberS{Value: pkUpload(uploadID)},
-				"sk": &types.AttributeValueMemberS{Value: skMetadata()},
-			},
-		})
 
-		reaped = append(reaped, ExpiredUpload{
-			UploadID:   uploadID,
-			BucketName: bucket,
-			ObjectKey:  key,
-		})
+			if resp.LastEvaluatedKey == nil {
+				break
+			}
+			exclusiveStartKey = resp.LastEvaluatedKey
+		}
 	}
 
 	return reaped, nil
@@ -1119,19 +1335,23 @@ func (s *DynamoDBStore) itemToBucket(item map[string]types.AttributeValue) *Buck
 func (s *DynamoDBStore) itemToObject(item map[string]types.AttributeValue) *ObjectRecord {
 	lastModified, _ := time.Parse(dynamoTimeFormat, getString(item, "last_modified"))
 	obj := &ObjectRecord{
-		Bucket:             getString(item, "bucket"),
-		Key:                getString(item, "key"),
-		Size:               getNInt(item, "size"),
-		ETag:               getString(item, "etag"),
-		ContentType:        getString(item, "content_type"),
-		ContentEncoding:    getString(item, "content_encoding"),
-		ContentLanguage:    getString(item, "content_language"),
-		ContentDisposition: getString(item, "content_disposition"),
-		CacheControl:       getString(item, "cache_control"),
-		Expires:            getString(item, "expires"),
-		StorageClass:       getString(item, "storage_class"),
-		ACL:                json.RawMessage(getString(item, "acl")),
-		LastModified:       lastModified,
+		Bucket:                  getString(item, "bucket"),
+		Key:                     getString(item, "key"),
+		Size:                    getNInt(item, "size"),
+		ETag:                    getString(item, "etag"),
+		ContentType:             getString(item, "content_type"),
+		ContentEncoding:         getString(item, "content_encoding"),
+		ContentLanguage:         getString(item, "content_language"),
+		ContentDisposition:      getString(item, "content_disposition"),
+		CacheControl:            getString(item, "cache_control"),
+		Expires:                 getString(item, "expires"),
+		StorageClass:            getString(item, "storage_class"),
+		ACL:                     json.RawMessage(getString(item, "acl")),
+		LastModified:            lastModified,
+		PartSizes:               decodePartSizes(getString(item, "part_sizes")),
+		Compression:             getString(item, "compression"),
+		ReplicationStatus:       getString(item, "replication_status"),
+		WebsiteRedirectLocation: getString(item, "website_redirect_location"),
 	}
 	userMeta := getString(item, "user_metadata")
 	if userMeta != "" && userMeta != "{}" {
@@ -1144,20 +1364,21 @@ func (s *DynamoDBStore) itemToObject(item map[string]types.AttributeValue) *Obje
 func (s *DynamoDBStore) itemToUpload(item map[string]types.AttributeValue) *MultipartUploadRecord {
 	initiatedAt, _ := time.Parse(dynamoTimeFormat, getString(item, "initiated_at"))
 	upload := &MultipartUploadRecord{
-		UploadID:           getString(item, "upload_id"),
-		Bucket:             getString(item, "bucket"),
-		Key:                getString(item, "key"),
-		ContentType:        getString(item, "content_type"),
-		ContentEncoding:    getString(item, "content_encoding"),
-		ContentLanguage:    getString(item, "content_language"),
-		ContentDisposition: getString(item, "content_disposition"),
-		CacheControl:       getString(item, "cache_control"),
-		Expires:            getString(item, "expires"),
-		StorageClass:       getString(item, "storage_class"),
-		ACL:                json.RawMessage(getString(item, "acl")),
-		OwnerID:            getString(item, "owner_id"),
-		OwnerDisplay:       getString(item, "owner_display"),
-		InitiatedAt:        initiatedAt,
+		UploadID:                getString(item, "upload_id"),
+		Bucket:                  getString(item, "bucket"),
+		Key:                     getString(item, "key"),
+		ContentType:             getString(item, "content_type"),
+		ContentEncoding:         getString(item, "content_encoding"),
+		ContentLanguage:         getString(item, "content_language"),
+		ContentDisposition:      getString(item, "content_disposition"),
+		CacheControl:            getString(item, "cache_control"),
+		Expires:                 getString(item, "expires"),
+		StorageClass:            getString(item, "storage_class"),
+		ACL:                     json.RawMessage(getString(item, "acl")),
+		OwnerID:                 getString(item, "owner_id"),
+		OwnerDisplay:            getString(item, "owner_display"),
+		InitiatedAt:             initiatedAt,
+		WebsiteRedirectLocation: getString(item, "website_redirect_location"),
 	}
 	userMeta := getString(item, "user_metadata")
 	if userMeta != "" && userMeta != "{}" {
@@ -0,0 +1,232 @@
+package metadata_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+// dynamoDBTestClient returns a client for the DynamoDB Local endpoint in
+// BLEEPSTORE_TEST_DYNAMODB_ENDPOINT, and the endpoint, or skips the test
+// when it is not set.
+func dynamoDBTestClient(t *testing.T) (*dynamodb.Client, string) {
+	t.Helper()
+	endpoint := os.Getenv("BLEEPSTORE_TEST_DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("BLEEPSTORE_TEST_DYNAMODB_ENDPOINT not set")
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion("us-east-1"))
+	if err != nil {
+		t.Fatalf("loading aws config: %v", err)
+	}
+	awsCfg.BaseEndpoint = aws.String(endpoint)
+	return dynamodb.NewFromConfig(awsCfg), endpoint
+}
+
+var dynamoDBTables atomic.Int64
+
+// newDynamoDBTestStore creates a table with the schema and list index the
+// store expects, dropped when the test ends, and opens a store on it with
+// cfg.
+func newDynamoDBTestStore(t *testing.T, client *dynamodb.Client, cfg *config.DynamoDBConfig) (*metadata.DynamoDBStore, string) {
+	t.Helper()
+	table := fmt.Sprintf("bleepstore-test-%d-%d", os.Getpid(), dynamoDBTables.Add(1))
+	str := func(name string) types.AttributeDefinition {
+		return types.AttributeDefinition{AttributeName: aws.String(name), AttributeType: types.ScalarAttributeTypeS}
+	}
+	key := func(hash, rng string) []types.KeySchemaElement {
+		return []types.KeySchemaElement{
+			{AttributeName: aws.String(hash), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String(rng), KeyType: types.KeyTypeRange},
+		}
+	}
+	_, err := client.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName:            aws.String(table),
+		AttributeDefinitions: []types.AttributeDefinition{str("pk"), str("sk"), str("list_pk"), str("list_sk")},
+		KeySchema:            key("pk", "sk"),
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+			IndexName:  aws.String("list-index"),
+			KeySchema:  key("list_pk", "list_sk"),
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		t.Fatalf("creating table %s: %v", table, err)
+	}
+	t.Cleanup(func() {
+		client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+	})
+
+	storeCfg := *cfg
+	storeCfg.Table = table
+	store, err := metadata.NewDynamoDBStore(&storeCfg)
+	if err != nil {
+		t.Fatalf("NewDynamoDBStore: %v", err)
+	}
+	return store, table
+}
+
+func TestDynamoDBListIndex(t *testing.T) {
+	client, endpoint := dynamoDBTestClient(t)
+	store, table := newDynamoDBTestStore(t, client, &config.DynamoDBConfig{EndpointURL: endpoint})
+	ctx := context.Background()
+
+	for _, b := range []string{"photos", "photos-archive"} {
+		if err := store.CreateBucket(ctx, &metadata.BucketRecord{Name: b, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateBucket %s: %v", b, err)
+		}
+	}
+	keys := []string{"2024/a.jpg", "2024/b.jpg", "2025/c.jpg", "2025/d/e.jpg", "readme"}
+	for _, k := range keys {
+		if err := store.PutObject(ctx, &metadata.ObjectRecord{Bucket: "photos", Key: k, ETag: `"e"`, LastModified: time.Now()}); err != nil {
+			t.Fatalf("PutObject %s: %v", k, err)
+		}
+	}
+	// A bucket whose name extends the first must not leak into its listing.
+	if err := store.PutObject(ctx, &metadata.ObjectRecord{Bucket: "photos-archive", Key: "2024/z.jpg", LastModified: time.Now()}); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	// Objects carry the list index keys: their bucket and their key.
+	item, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "OBJECT#photos#readme"},
+			"sk": &types.AttributeValueMemberS{Value: "#METADATA"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GetItem: %v", err)
+	}
+	if pk, ok := item.Item["list_pk"].(*types.AttributeValueMemberS); !ok || pk.Value != "OBJECTS#photos" {
+		t.Errorf("list_pk = %v, want OBJECTS#photos", item.Item["list_pk"])
+	}
+
+	// Pages of two walk the bucket in key order.
+	var got []string
+	opts := metadata.ListObjectsOptions{MaxKeys: 2}
+	for page := 0; ; page++ {
+		res, err := store.ListObjects(ctx, "photos", opts)
+		if err != nil {
+			t.Fatalf("ListObjects: %v", err)
+		}
+		for _, o := range res.Objects {
+			got = append(got, o.Key)
+		}
+		if !res.IsTruncated {
+			break
+		}
+		if page > len(keys) {
+			t.Fatalf("listing did not end: %v", got)
+		}
+		opts.ContinuationToken = res.NextContinuationToken
+	}
+	if fmt.Sprint(got) != fmt.Sprint(keys) {
+		t.Errorf("paged listing = %v, want %v", got, keys)
+	}
+
+	// Prefix and delimiter narrow the range and roll up subdirectories.
+	res, err := store.ListObjects(ctx, "photos", metadata.ListObjectsOptions{Prefix: "2025/", Delimiter: "/", MaxKeys: 1000})
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if len(res.Objects) != 1 || res.Objects[0].Key != "2025/c.jpg" || fmt.Sprint(res.CommonPrefixes) != "[2025/d/]" {
+		t.Errorf("prefix listing = %+v, prefixes %v", res.Objects, res.CommonPrefixes)
+	}
+
+	// Uploads are listed through the index too, by key then initiation.
+	started := time.Now().Add(-time.Minute)
+	var ids []string
+	for i, k := range []string{"b", "a", "a"} {
+		id, err := store.CreateMultipartUpload(ctx, &metadata.MultipartUploadRecord{
+			Bucket: "photos", Key: k, InitiatedAt: started.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("CreateMultipartUpload: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	uploads, err := store.ListMultipartUploads(ctx, "photos", metadata.ListUploadsOptions{MaxUploads: 1000})
+	if err != nil {
+		t.Fatalf("ListMultipartUploads: %v", err)
+	}
+	var order []string
+	for _, u := range uploads.Uploads {
+		order = append(order, u.UploadID)
+	}
+	if want := []string{ids[1], ids[2], ids[0]}; fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("uploads = %v, want %v", order, want)
+	}
+}
+
+func TestDynamoDBReapExpiredUploads(t *testing.T) {
+	client, endpoint := dynamoDBTestClient(t)
+	store, table := newDynamoDBTestStore(t, client, &config.DynamoDBConfig{EndpointURL: endpoint, UploadTTLSeconds: 3600})
+	ctx := context.Background()
+
+	if err := store.CreateBucket(ctx, &metadata.BucketRecord{Name: "bkt", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	oldStart := time.Now().Add(-2 * time.Hour)
+	old, err := store.CreateMultipartUpload(ctx, &metadata.MultipartUploadRecord{Bucket: "bkt", Key: "old", InitiatedAt: oldStart})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	if err := store.PutPart(ctx, &metadata.PartRecord{UploadID: old, PartNumber: 1, Size: 5, ETag: `"p"`, LastModified: time.Now()}); err != nil {
+		t.Fatalf("PutPart: %v", err)
+	}
+	fresh, err := store.CreateMultipartUpload(ctx, &metadata.MultipartUploadRecord{Bucket: "bkt", Key: "fresh", InitiatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+
+	// Upload items carry the native TTL: initiation plus upload_ttl_seconds.
+	item, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "UPLOAD#" + old},
+			"sk": &types.AttributeValueMemberS{Value: "#METADATA"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GetItem: %v", err)
+	}
+	want := strconv.FormatInt(oldStart.Add(time.Hour).Unix(), 10)
+	if ttl, ok := item.Item["expires_at"].(*types.AttributeValueMemberN); !ok || ttl.Value != want {
+		t.Errorf("expires_at = %v, want %s", item.Item["expires_at"], want)
+	}
+
+	reaped, err := store.ReapExpiredUploads(3600)
+	if err != nil {
+		t.Fatalf("ReapExpiredUploads: %v", err)
+	}
+	if len(reaped) != 1 || reaped[0].UploadID != old || reaped[0].BucketName != "bkt" || reaped[0].ObjectKey != "old" {
+		t.Fatalf("reaped = %+v, want only %s", reaped, old)
+	}
+	if u, err := store.GetMultipartUpload(ctx, "bkt", "old", old); err != nil || u != nil {
+		t.Errorf("expired upload after reaping = %+v, %v", u, err)
+	}
+	parts, err := store.ListParts(ctx, old, metadata.ListPartsOptions{MaxParts: 1000})
+	if err != nil {
+		t.Fatalf("ListParts: %v", err)
+	}
+	if len(parts.Parts) != 0 {
+		t.Errorf("expired upload's parts after reaping = %+v", parts.Parts)
+	}
+	if u, err := store.GetMultipartUpload(ctx, "bkt", "fresh", fresh); err != nil || u == nil {
+		t.Errorf("fresh upload after reaping = %+v, %v", u, err)
+	}
+}
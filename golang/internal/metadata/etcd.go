@@ -0,0 +1,876 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdMaxTxnOps stays under etcd's default --max-txn-ops of 128.
+const etcdMaxTxnOps = 128
+
+// etcdPageSize is the number of keys fetched per range read while listing.
+const etcdPageSize = 1000
+
+// EtcdStore is a MetadataStore backed by etcd. Records are stored as JSON
+// under a configurable prefix with a lexicographic key layout, so listings
+// are range reads and multi-key changes are single transactions:
+//
+//	{prefix}buckets/{bucket}
+//	{prefix}objects/{bucket}/{key}
+//	{prefix}uploads/{bucket}/{uploadID}
+//	{prefix}uploadids/{uploadID}            -> bucket name
+//	{prefix}parts/{uploadID}/{partNumber:05d}
+//	{prefix}credentials/{accessKeyID}
+//	{prefix}leases/{name}
+//
+// Several BleepStore replicas can share one etcd cluster and see
+// linearizable metadata.
+type EtcdStore struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdStore connects to the configured etcd cluster.
+func NewEtcdStore(cfg *config.EtcdConfig) (*EtcdStore, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("etcd config is required")
+	}
+	if len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("etcd endpoints are required")
+	}
+
+	dialTimeout := time.Duration(cfg.DialTimeoutSeconds) * time.Second
+	if dialTimeout <= 0 {
+		dialTimeout = 5 * time.Second
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		DialTimeout: dialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating etcd client: %w", err)
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "/bleepstore/"
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &EtcdStore{client: client, prefix: prefix}, nil
+}
+
+func (s *EtcdStore) bucketKey(bucket string) string {
+	return s.prefix + "buckets/" + bucket
+}
+
+func (s *EtcdStore) objectPrefix(bucket string) string {
+	return s.prefix + "objects/" + bucket + "/"
+}
+
+func (s *EtcdStore) objectKey(bucket, key string) string {
+	return s.objectPrefix(bucket) + key
+}
+
+func (s *EtcdStore) uploadPrefix(bucket string) string {
+	return s.prefix + "uploads/" + bucket + "/"
+}
+
+func (s *EtcdStore) uploadKey(bucket, uploadID string) string {
+	return s.uploadPrefix(bucket) + uploadID
+}
+
+func (s *EtcdStore) uploadIDKey(uploadID string) string {
+	return s.prefix + "uploadids/" + uploadID
+}
+
+func (s *EtcdStore) partPrefix(uploadID string) string {
+	return s.prefix + "parts/" + uploadID + "/"
+}
+
+func (s *EtcdStore) partKey(uploadID string, partNumber int) string {
+	return fmt.Sprintf("%s%05d", s.partPrefix(uploadID), partNumber)
+}
+
+func (s *EtcdStore) credentialKey(accessKeyID string) string {
+	return s.prefix + "credentials/" + accessKeyID
+}
+
+func (s *EtcdStore) leaseKey(name string) string {
+	return s.prefix + "leases/" + name
+}
+
+// bucketExists is a transaction guard that the bucket record is present.
+func (s *EtcdStore) bucketExists(bucket string) clientv3.Cmp {
+	return clientv3.Compare(clientv3.CreateRevision(s.bucketKey(bucket)), "!=", 0)
+}
+
+// getJSON reads a single key into v. Returns false if the key is absent.
+func (s *EtcdStore) getJSON(ctx context.Context, key string, v interface{}) (bool, error) {
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(resp.Kvs[0].Value, v); err != nil {
+		return false, fmt.Errorf("decoding %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func mustJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		// Records contain only JSON-safe types; this cannot fail.
+		panic(fmt.Sprintf("encoding metadata record: %v", err))
+	}
+	return string(data)
+}
+
+// normalizeObject fills defaults the same way the other stores do.
+func normalizeObject(obj *ObjectRecord) ObjectRecord {
+	objCopy := *obj
+	if objCopy.ContentType == "" {
+		objCopy.ContentType = "application/octet-stream"
+	}
+	if objCopy.StorageClass == "" {
+		objCopy.StorageClass = "STANDARD"
+	}
+	if objCopy.ACL == nil {
+		objCopy.ACL = json.RawMessage("{}")
+	}
+	if objCopy.UserMetadata == nil {
+		objCopy.UserMetadata = make(map[string]string)
+	}
+	return objCopy
+}
+
+func (s *EtcdStore) Ping(ctx context.Context) error {
+	_, err := s.client.Get(ctx, s.prefix, clientv3.WithCountOnly())
+	return err
+}
+
+func (s *EtcdStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *EtcdStore) CreateBucket(ctx context.Context, bucket *BucketRecord) error {
+	bucketCopy := *bucket
+	if bucketCopy.ACL == nil {
+		bucketCopy.ACL = json.RawMessage("{}")
+	}
+	key := s.bucketKey(bucket.Name)
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, mustJSON(&bucketCopy))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("creating bucket: %w", err)
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("bucket already exists: %s", bucket.Name)
+	}
+	return nil
+}
+
+func (s *EtcdStore) GetBucket(ctx context.Context, name string) (*BucketRecord, error) {
+	var bucket BucketRecord
+	found, err := s.getJSON(ctx, s.bucketKey(name), &bucket)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+// DeleteBucket removes an empty bucket. Emptiness is checked at a read
+// revision and enforced in the delete transaction: if any object or upload
+// key under the bucket was written after that revision, the transaction
+// fails and the check is repeated.
+func (s *EtcdStore) DeleteBucket(ctx context.Context, name string) error {
+	for attempt := 0; attempt < 3; attempt++ {
+		objResp, err := s.client.Get(ctx, s.objectPrefix(name), clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err != nil {
+			return fmt.Errorf("checking bucket objects: %w", err)
+		}
+		rev := objResp.Header.Revision
+		upResp, err := s.client.Get(ctx, s.uploadPrefix(name), clientv3.WithPrefix(), clientv3.WithCountOnly(), clientv3.WithRev(rev))
+		if err != nil {
+			return fmt.Errorf("checking bucket uploads: %w", err)
+		}
+		if objResp.Count > 0 || upResp.Count > 0 {
+			return fmt.Errorf("bucket not empty: %s", name)
+		}
+
+		resp, err := s.client.Txn(ctx).
+			If(
+				s.bucketExists(name),
+				clientv3.Compare(clientv3.ModRevision(s.objectPrefix(name)), "<", rev+1).WithPrefix(),
+				clientv3.Compare(clientv3.ModRevision(s.uploadPrefix(name)), "<", rev+1).WithPrefix(),
+			).
+			Then(clientv3.OpDelete(s.bucketKey(name))).
+			Commit()
+		if err != nil {
+			return fmt.Errorf("deleting bucket: %w", err)
+		}
+		if resp.Succeeded {
+			return nil
+		}
+		if exists, err := s.BucketExists(ctx, name); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("bucket not found: %s", name)
+		}
+	}
+	return fmt.Errorf("bucket not empty: %s", name)
+}
+
+func (s *EtcdStore) ListBuckets(ctx context.Context, owner string) ([]BucketRecord, error) {
+	all, err := s.ListAllBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var buckets []BucketRecord
+	for _, b := range all {
+		if b.OwnerID == owner {
+			buckets = append(buckets, b)
+		}
+	}
+	return buckets, nil
+}
+
+func (s *EtcdStore) ListAllBuckets(ctx context.Context) ([]BucketRecord, error) {
+	resp, err := s.client.Get(ctx, s.prefix+"buckets/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("listing buckets: %w", err)
+	}
+	buckets := make([]BucketRecord, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var b BucketRecord
+		if err := json.Unmarshal(kv.Value, &b); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", kv.Key, err)
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+func (s *EtcdStore) BucketExists(ctx context.Context, name string) (bool, error) {
+	resp, err := s.client.Get(ctx, s.bucketKey(name), clientv3.WithCountOnly())
+	if err != nil {
+		return false, err
+	}
+	return resp.Count > 0, nil
+}
+
+func (s *EtcdStore) UpdateBucketAcl(ctx context.Context, name string, acl json.RawMessage) error {
+	bucket, err := s.GetBucket(ctx, name)
+	if err != nil {
+		return err
+	}
+	if bucket == nil {
+		return fmt.Errorf("bucket not found: %s", name)
+	}
+	bucket.ACL = acl
+	resp, err := s.client.Txn(ctx).
+		If(s.bucketExists(name)).
+		Then(clientv3.OpPut(s.bucketKey(name), mustJSON(bucket))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("updating bucket ACL: %w", err)
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("bucket not found: %s", name)
+	}
+	return nil
+}
+
+func (s *EtcdStore) PutObject(ctx context.Context, obj *ObjectRecord) error {
+	objCopy := normalizeObject(obj)
+	resp, err := s.client.Txn(ctx).
+		If(s.bucketExists(obj.Bucket)).
+		Then(clientv3.OpPut(s.objectKey(obj.Bucket, obj.Key), mustJSON(&objCopy))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("putting object: %w", err)
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("bucket not found: %s", obj.Bucket)
+	}
+	return nil
+}
+
+// PutObjectIf writes obj if the current record meets cond. The write is a
+// transaction conditioned on the revision the record was read at, retried
+// if another replica changed the object meanwhile.
+func (s *EtcdStore) PutObjectIf(ctx context.Context, obj *ObjectRecord, cond WriteCondition) error {
+	objCopy := normalizeObject(obj)
+	objKey := s.objectKey(obj.Bucket, obj.Key)
+	for attempt := 0; attempt < 3; attempt++ {
+		resp, err := s.client.Get(ctx, objKey)
+		if err != nil {
+			return fmt.Errorf("reading object: %w", err)
+		}
+		var current *ObjectRecord
+		cmp := clientv3.Compare(clientv3.CreateRevision(objKey), "=", 0)
+		if len(resp.Kvs) > 0 {
+			current = new(ObjectRecord)
+			if err := json.Unmarshal(resp.Kvs[0].Value, current); err != nil {
+				return fmt.Errorf("decoding %s: %w", objKey, err)
+			}
+			cmp = clientv3.Compare(clientv3.ModRevision(objKey), "=", resp.Kvs[0].ModRevision)
+		}
+		if err := cond.Check(current); err != nil {
+			return err
+		}
+		txn, err := s.client.Txn(ctx).
+			If(s.bucketExists(obj.Bucket), cmp).
+			Then(clientv3.OpPut(objKey, mustJSON(&objCopy))).
+			Commit()
+		if err != nil {
+			return fmt.Errorf("putting object: %w", err)
+		}
+		if txn.Succeeded {
+			return nil
+		}
+		if ok, err := s.BucketExists(ctx, obj.Bucket); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("bucket not found: %s", obj.Bucket)
+		}
+	}
+	return ErrPreconditionFailed
+}
+
+func (s *EtcdStore) GetObject(ctx context.Context, bucket, key string) (*ObjectRecord, error) {
+	var obj ObjectRecord
+	found, err := s.getJSON(ctx, s.objectKey(bucket, key), &obj)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (s *EtcdStore) DeleteObject(ctx context.Context, bucket, key string) error {
+	if _, err := s.client.Delete(ctx, s.objectKey(bucket, key)); err != nil {
+		return fmt.Errorf("deleting object: %w", err)
+	}
+	return nil
+}
+
+func (s *EtcdStore) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	resp, err := s.client.Get(ctx, s.objectKey(bucket, key), clientv3.WithCountOnly())
+	if err != nil {
+		return false, err
+	}
+	return resp.Count > 0, nil
+}
+
+// DeleteObjectsMeta deletes keys in transactions of up to etcdMaxTxnOps
+// operations. A failed batch reports an error for each of its keys.
+func (s *EtcdStore) DeleteObjectsMeta(ctx context.Context, bucket string, keys []string) ([]string, []error) {
+	var deleted []string
+	var errs []error
+	for start := 0; start < len(keys); start += etcdMaxTxnOps {
+		end := start + etcdMaxTxnOps
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+		ops := make([]clientv3.Op, 0, len(batch))
+		for _, key := range batch {
+			ops = append(ops, clientv3.OpDelete(s.objectKey(bucket, key)))
+		}
+		if _, err := s.client.Txn(ctx).Then(ops...).Commit(); err != nil {
+			for _, key := range batch {
+				errs = append(errs, fmt.Errorf("deleting %s: %w", key, err))
+			}
+			continue
+		}
+		deleted = append(deleted, batch...)
+	}
+	return deleted, errs
+}
+
+func (s *EtcdStore) UpdateObjectAcl(ctx context.Context, bucket, key string, acl json.RawMessage) error {
+	objKey := s.objectKey(bucket, key)
+	resp, err := s.client.Get(ctx, objKey)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return fmt.Errorf("object not found: %s/%s", bucket, key)
+	}
+	var obj ObjectRecord
+	if err := json.Unmarshal(resp.Kvs[0].Value, &obj); err != nil {
+		return fmt.Errorf("decoding %s: %w", objKey, err)
+	}
+	obj.ACL = acl
+
+	// Only apply the ACL to the version that was read; a concurrent
+	// overwrite wins.
+	txn, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(objKey), "=", resp.Kvs[0].ModRevision)).
+		Then(clientv3.OpPut(objKey, mustJSON(&obj))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("updating object ACL: %w", err)
+	}
+	if !txn.Succeeded {
+		return fmt.Errorf("object modified concurrently: %s/%s", bucket, key)
+	}
+	return nil
+}
+
+// ListObjects walks the bucket's key range in order. With a delimiter,
+// each common prefix is emitted once and the walk then skips past the rest
+// of that prefix's range, so deep hierarchies cost one read per prefix.
+func (s *EtcdStore) ListObjects(ctx context.Context, bucket string, opts ListObjectsOptions) (*ListObjectsResult, error) {
+	maxKeys := opts.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	startAfter := opts.StartAfter
+	if opts.ContinuationToken != "" {
+		startAfter = opts.ContinuationToken
+	}
+	if opts.Marker != "" && startAfter == "" {
+		startAfter = opts.Marker
+	}
+
+	base := s.objectPrefix(bucket)
+	from := base + opts.Prefix
+	if startAfter != "" && base+startAfter >= from {
+		from = base + startAfter + "\x00"
+	}
+	end := clientv3.GetPrefixRangeEnd(base + opts.Prefix)
+
+	result := &ListObjectsResult{}
+	count := 0
+	var last string
+
+scan:
+	for {
+		resp, err := s.client.Get(ctx, from, clientv3.WithRange(end), clientv3.WithLimit(etcdPageSize))
+		if err != nil {
+			return nil, fmt.Errorf("listing objects: %w", err)
+		}
+		if len(resp.Kvs) == 0 {
+			break
+		}
+
+		for _, kv := range resp.Kvs {
+			key := strings.TrimPrefix(string(kv.Key), base)
+
+			if opts.Delimiter != "" {
+				rest := key[len(opts.Prefix):]
+				if idx := strings.Index(rest, opts.Delimiter); idx >= 0 {
+					cp := opts.Prefix + rest[:idx+len(opts.Delimiter)]
+					if cp > startAfter {
+						if count == maxKeys {
+							result.IsTruncated = true
+							break scan
+						}
+						result.CommonPrefixes = append(result.CommonPrefixes, cp)
+						count++
+						last = cp
+					}
+					// Skip the remainder of this common prefix.
+					from = clientv3.GetPrefixRangeEnd(base + cp)
+					continue scan
+				}
+			}
+
+			if count == maxKeys {
+				result.IsTruncated = true
+				break scan
+			}
+			var obj ObjectRecord
+			if err := json.Unmarshal(kv.Value, &obj); err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", kv.Key, err)
+			}
+			result.Objects = append(result.Objects, obj)
+			count++
+			last = key
+			from = string(kv.Key) + "\x00"
+		}
+
+		if !resp.More {
+			break
+		}
+	}
+
+	if result.IsTruncated {
+		result.NextMarker = last
+		result.NextContinuationToken = last
+	}
+	return result, nil
+}
+
+func (s *EtcdStore) CreateMultipartUpload(ctx context.Context, upload *MultipartUploadRecord) (string, error) {
+	uploadID := upload.UploadID
+	if uploadID == "" {
+		var err error
+		uploadID, err = generateUploadID()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	uploadCopy := *upload
+	uploadCopy.UploadID = uploadID
+	if uploadCopy.ContentType == "" {
+		uploadCopy.ContentType = "application/octet-stream"
+	}
+	if uploadCopy.StorageClass == "" {
+		uploadCopy.StorageClass = "STANDARD"
+	}
+	if uploadCopy.ACL == nil {
+		uploadCopy.ACL = json.RawMessage("{}")
+	}
+	if uploadCopy.UserMetadata == nil {
+		uploadCopy.UserMetadata = make(map[string]string)
+	}
+
+	resp, err := s.client.Txn(ctx).
+		If(s.bucketExists(upload.Bucket)).
+		Then(
+			clientv3.OpPut(s.uploadKey(upload.Bucket, uploadID), mustJSON(&uploadCopy)),
+			clientv3.OpPut(s.uploadIDKey(uploadID), upload.Bucket),
+		).
+		Commit()
+	if err != nil {
+		return "", fmt.Errorf("creating multipart upload: %w", err)
+	}
+	if !resp.Succeeded {
+		return "", fmt.Errorf("bucket not found: %s", upload.Bucket)
+	}
+	return uploadID, nil
+}
+
+func (s *EtcdStore) GetMultipartUpload(ctx context.Context, bucket, key, uploadID string) (*MultipartUploadRecord, error) {
+	var upload MultipartUploadRecord
+	found, err := s.getJSON(ctx, s.uploadKey(bucket, uploadID), &upload)
+	if err != nil || !found {
+		return nil, err
+	}
+	if upload.Key != key {
+		return nil, nil
+	}
+	return &upload, nil
+}
+
+func (s *EtcdStore) PutPart(ctx context.Context, part *PartRecord) error {
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(s.uploadIDKey(part.UploadID)), "!=", 0)).
+		Then(clientv3.OpPut(s.partKey(part.UploadID, part.PartNumber), mustJSON(part))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("putting part: %w", err)
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("upload not found: %s", part.UploadID)
+	}
+	return nil
+}
+
+func (s *EtcdStore) ListParts(ctx context.Context, uploadID string, opts ListPartsOptions) (*ListPartsResult, error) {
+	maxParts := opts.MaxParts
+	if maxParts <= 0 {
+		maxParts = 1000
+	}
+
+	from := s.partKey(uploadID, opts.PartNumberMarker+1)
+	end := clientv3.GetPrefixRangeEnd(s.partPrefix(uploadID))
+	resp, err := s.client.Get(ctx, from, clientv3.WithRange(end), clientv3.WithLimit(int64(maxParts+1)))
+	if err != nil {
+		return nil, fmt.Errorf("listing parts: %w", err)
+	}
+
+	result := &ListPartsResult{}
+	for _, kv := range resp.Kvs {
+		if len(result.Parts) == maxParts {
+			result.IsTruncated = true
+			break
+		}
+		var part PartRecord
+		if err := json.Unmarshal(kv.Value, &part); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", kv.Key, err)
+		}
+		result.Parts = append(result.Parts, part)
+	}
+	if result.IsTruncated {
+		result.NextPartNumberMarker = result.Parts[len(result.Parts)-1].PartNumber
+	}
+	return result, nil
+}
+
+func (s *EtcdStore) GetPartsForCompletion(ctx context.Context, uploadID string, partNumbers []int) ([]PartRecord, error) {
+	resp, err := s.client.Get(ctx, s.partPrefix(uploadID), clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("reading parts: %w", err)
+	}
+
+	wanted := make(map[int]bool, len(partNumbers))
+	for _, pn := range partNumbers {
+		wanted[pn] = true
+	}
+	var parts []PartRecord
+	for _, kv := range resp.Kvs {
+		var part PartRecord
+		if err := json.Unmarshal(kv.Value, &part); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", kv.Key, err)
+		}
+		if wanted[part.PartNumber] {
+			parts = append(parts, part)
+		}
+	}
+	return parts, nil
+}
+
+// uploadCleanupOps returns the operations that remove an upload record,
+// its ID index entry and all of its parts.
+func (s *EtcdStore) uploadCleanupOps(bucket, uploadID string) []clientv3.Op {
+	return []clientv3.Op{
+		clientv3.OpDelete(s.uploadKey(bucket, uploadID)),
+		clientv3.OpDelete(s.uploadIDKey(uploadID)),
+		clientv3.OpDelete(s.partPrefix(uploadID), clientv3.WithPrefix()),
+	}
+}
+
+func (s *EtcdStore) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, obj *ObjectRecord) error {
+	objCopy := normalizeObject(obj)
+	ops := append([]clientv3.Op{
+		clientv3.OpPut(s.objectKey(obj.Bucket, obj.Key), mustJSON(&objCopy)),
+	}, s.uploadCleanupOps(bucket, uploadID)...)
+
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(s.uploadKey(bucket, uploadID)), "!=", 0)).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("completing multipart upload: %w", err)
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("upload not found: %s", uploadID)
+	}
+	return nil
+}
+
+func (s *EtcdStore) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	upload, err := s.GetMultipartUpload(ctx, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	if upload == nil {
+		return fmt.Errorf("upload not found: %s", uploadID)
+	}
+	if _, err := s.client.Txn(ctx).Then(s.uploadCleanupOps(bucket, uploadID)...).Commit(); err != nil {
+		return fmt.Errorf("aborting multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (s *EtcdStore) ListMultipartUploads(ctx context.Context, bucket string, opts ListUploadsOptions) (*ListUploadsResult, error) {
+	maxUploads := opts.MaxUploads
+	if maxUploads <= 0 {
+		maxUploads = 1000
+	}
+
+	resp, err := s.client.Get(ctx, s.uploadPrefix(bucket), clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("listing multipart uploads: %w", err)
+	}
+
+	var allUploads []MultipartUploadRecord
+	for _, kv := range resp.Kvs {
+		var upload MultipartUploadRecord
+		if err := json.Unmarshal(kv.Value, &upload); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", kv.Key, err)
+		}
+		if opts.Prefix != "" && !strings.HasPrefix(upload.Key, opts.Prefix) {
+			continue
+		}
+		if opts.KeyMarker != "" {
+			if upload.Key < opts.KeyMarker {
+				continue
+			}
+			if upload.Key == opts.KeyMarker && opts.UploadIDMarker != "" && upload.UploadID <= opts.UploadIDMarker {
+				continue
+			}
+		}
+		allUploads = append(allUploads, upload)
+	}
+
+	sort.Slice(allUploads, func(i, j int) bool {
+		if allUploads[i].Key != allUploads[j].Key {
+			return allUploads[i].Key < allUploads[j].Key
+		}
+		return allUploads[i].InitiatedAt.Before(allUploads[j].InitiatedAt)
+	})
+
+	isTruncated := len(allUploads) > maxUploads
+	if isTruncated {
+		allUploads = allUploads[:maxUploads]
+	}
+
+	result := &ListUploadsResult{
+		Uploads:     allUploads,
+		IsTruncated: isTruncated,
+	}
+	if isTruncated && len(allUploads) > 0 {
+		last := allUploads[len(allUploads)-1]
+		result.NextKeyMarker = last.Key
+		result.NextUploadIDMarker = last.UploadID
+	}
+	return result, nil
+}
+
+func (s *EtcdStore) GetCredential(ctx context.Context, accessKeyID string) (*CredentialRecord, error) {
+	var cred CredentialRecord
+	found, err := s.getJSON(ctx, s.credentialKey(accessKeyID), &cred)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+func (s *EtcdStore) ListCredentials(ctx context.Context) ([]CredentialRecord, error) {
+	resp, err := s.client.Get(ctx, s.prefix+"credentials/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("listing credentials: %w", err)
+	}
+	creds := make([]CredentialRecord, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var cred CredentialRecord
+		if err := json.Unmarshal(kv.Value, &cred); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", kv.Key, err)
+		}
+		creds = append(creds, cred)
+	}
+	return creds, nil
+}
+
+func (s *EtcdStore) PutCredential(ctx context.Context, cred *CredentialRecord) error {
+	if _, err := s.client.Put(ctx, s.credentialKey(cred.AccessKeyID), mustJSON(cred)); err != nil {
+		return fmt.Errorf("putting credential: %w", err)
+	}
+	return nil
+}
+
+// AcquireLease claims the named lease if it is unheld, expired or already
+// held by holder. The claim is a transaction conditioned on the revision
+// the lease was read at, retried if another replica changed it meanwhile.
+func (s *EtcdStore) AcquireLease(ctx context.Context, name, holder string, now, expires time.Time) (*Lease, error) {
+	key := s.leaseKey(name)
+	for attempt := 0; attempt < 3; attempt++ {
+		resp, err := s.client.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("reading lease %q: %w", name, err)
+		}
+		var cmp clientv3.Cmp
+		if len(resp.Kvs) == 0 {
+			cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		} else {
+			var cur Lease
+			if err := json.Unmarshal(resp.Kvs[0].Value, &cur); err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", key, err)
+			}
+			if cur.Holder != holder && !cur.Expires.Before(now) {
+				return &cur, nil
+			}
+			cmp = clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)
+		}
+		lease := &Lease{Name: name, Holder: holder, Expires: expires}
+		txn, err := s.client.Txn(ctx).If(cmp).Then(clientv3.OpPut(key, mustJSON(lease))).Commit()
+		if err != nil {
+			return nil, fmt.Errorf("acquiring lease %q: %w", name, err)
+		}
+		if txn.Succeeded {
+			return lease, nil
+		}
+	}
+	var cur Lease
+	if _, err := s.getJSON(ctx, key, &cur); err != nil {
+		return nil, fmt.Errorf("reading lease %q: %w", name, err)
+	}
+	return &cur, nil
+}
+
+// ReleaseLease deletes the named lease if holder holds it.
+func (s *EtcdStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	key := s.leaseKey(name)
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("reading lease %q: %w", name, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil
+	}
+	var cur Lease
+	if err := json.Unmarshal(resp.Kvs[0].Value, &cur); err != nil {
+		return fmt.Errorf("decoding %s: %w", key, err)
+	}
+	if cur.Holder != holder {
+		return nil
+	}
+	_, err = s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("releasing lease %q: %w", name, err)
+	}
+	return nil
+}
+
+// ReapExpiredUploads removes uploads initiated more than ttlSeconds ago.
+// Every replica may run the reaper; each removal is guarded so only one
+// replica reports a given upload.
+func (s *EtcdStore) ReapExpiredUploads(ttlSeconds int) ([]ExpiredUpload, error) {
+	ctx := context.Background()
+	resp, err := s.client.Get(ctx, s.prefix+"uploads/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("scanning uploads: %w", err)
+	}
+
+	cutoff := time.Now().Add(-time.Duration(ttlSeconds) * time.Second)
+	var expired []ExpiredUpload
+	for _, kv := range resp.Kvs {
+		var upload MultipartUploadRecord
+		if err := json.Unmarshal(kv.Value, &upload); err != nil {
+			return expired, fmt.Errorf("decoding %s: %w", kv.Key, err)
+		}
+		if !upload.InitiatedAt.Before(cutoff) {
+			continue
+		}
+		txn, err := s.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)).
+			Then(s.uploadCleanupOps(upload.Bucket, upload.UploadID)...).
+			Commit()
+		if err != nil {
+			return expired, fmt.Errorf("reaping upload %s: %w", upload.UploadID, err)
+		}
+		if txn.Succeeded {
+			expired = append(expired, ExpiredUpload{
+				UploadID:   upload.UploadID,
+				BucketName: upload.Bucket,
+				ObjectKey:  upload.Key,
+			})
+		}
+	}
+	return expired, nil
+}
@@ -175,6 +175,10 @@ func (s *FirestoreStore) ListBuckets(ctx context.Context, owner string) ([]Bucke
 	return buckets, nil
 }
 
+func (s *FirestoreStore) ListAllBuckets(ctx context.Context) ([]BucketRecord, error) {
+	return s.ListBuckets(ctx, "")
+}
+
 func (s *FirestoreStore) BucketExists(ctx context.Context, name string) (bool, error) {
 	docRef := s.collectionRef().Doc(docIDBucket(name))
 	doc, err := docRef.Get(ctx)
@@ -230,6 +234,18 @@ func (s *FirestoreStore) PutObject(ctx context.Context, obj *ObjectRecord) error
 	if obj.ContentEncoding != "" {
 		data["content_encoding"] = obj.ContentEncoding
 	}
+	if obj.PartSizes != nil {
+		data["part_sizes"] = encodePartSizes(obj.PartSizes)
+	}
+	if obj.Compression != "" {
+		data["compression"] = obj.Compression
+	}
+	if obj.ReplicationStatus != "" {
+		data["replication_status"] = obj.ReplicationStatus
+	}
+	if obj.WebsiteRedirectLocation != "" {
+		data["website_redirect_location"] = obj.WebsiteRedirectLocation
+	}
 	if obj.ContentLanguage != "" {
 		data["content_language"] = obj.ContentLanguage
 	}
@@ -478,6 +494,9 @@ func (s *FirestoreStore) CreateMultipartUpload(ctx context.Context, upload *Mult
 	if upload.Expires != "" {
 		data["expires"] = upload.Expires
 	}
+	if upload.WebsiteRedirectLocation != "" {
+		data["website_redirect_location"] = upload.WebsiteRedirectLocation
+	}
 
 	docRef := s.collectionRef().Doc(docIDUpload(uploadID))
 	_, err := docRef.Set(ctx, data)
@@ -702,6 +721,23 @@ func (s *FirestoreStore) GetCredential(ctx context.Context, accessKeyID string)
 	return cred, nil
 }
 
+func (s *FirestoreStore) ListCredentials(ctx context.Context) ([]CredentialRecord, error) {
+	docs, err := s.collectionRef().Where("type", "==", "credential").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("listing credentials: %w", err)
+	}
+
+	var creds []CredentialRecord
+	for _, doc := range docs {
+		creds = append(creds, *s.docToCredential(doc.Data()))
+	}
+
+	sort.Slice(creds, func(i, j int) bool {
+		return creds[i].AccessKeyID < creds[j].AccessKeyID
+	})
+	return creds, nil
+}
+
 func (s *FirestoreStore) PutCredential(ctx context.Context, cred *CredentialRecord) error {
 	docRef := s.collectionRef().Doc(docIDCredential(cred.AccessKeyID))
 
@@ -821,19 +857,23 @@ func (s *FirestoreStore) docToBucket(m map[string]interface{}) *BucketRecord {
 func (s *FirestoreStore) docToObject(m map[string]interface{}) *ObjectRecord {
 	lastModified, _ := time.Parse(firestoreTimeFormat, getStringFromMap(m, "last_modified"))
 	obj := &ObjectRecord{
-		Bucket:             getStringFromMap(m, "bucket"),
-		Key:                getStringFromMap(m, "key"),
-		Size:               getInt64FromMap(m, "size"),
-		ETag:               getStringFromMap(m, "etag"),
-		ContentType:        getStringFromMap(m, "content_type"),
-		ContentEncoding:    getStringFromMap(m, "content_encoding"),
-		ContentLanguage:    getStringFromMap(m, "content_language"),
-		ContentDisposition: getStringFromMap(m, "content_disposition"),
-		CacheControl:       getStringFromMap(m, "cache_control"),
-		Expires:            getStringFromMap(m, "expires"),
-		StorageClass:       getStringFromMap(m, "storage_class"),
-		ACL:                json.RawMessage(getStringFromMap(m, "acl")),
-		LastModified:       lastModified,
+		Bucket:                  getStringFromMap(m, "bucket"),
+		Key:                     getStringFromMap(m, "key"),
+		Size:                    getInt64FromMap(m, "size"),
+		ETag:                    getStringFromMap(m, "etag"),
+		ContentType:             getStringFromMap(m, "content_type"),
+		ContentEncoding:         getStringFromMap(m, "content_encoding"),
+		ContentLanguage:         getStringFromMap(m, "content_language"),
+		ContentDisposition:      getStringFromMap(m, "content_disposition"),
+		CacheControl:            getStringFromMap(m, "cache_control"),
+		Expires:                 getStringFromMap(m, "expires"),
+		StorageClass:            getStringFromMap(m, "storage_class"),
+		ACL:                     json.RawMessage(getStringFromMap(m, "acl")),
+		LastModified:            lastModified,
+		PartSizes:               decodePartSizes(getStringFromMap(m, "part_sizes")),
+		Compression:             getStringFromMap(m, "compression"),
+		ReplicationStatus:       getStringFromMap(m, "replication_status"),
+		WebsiteRedirectLocation: getStringFromMap(m, "website_redirect_location"),
 	}
 	userMeta := getStringFromMap(m, "user_metadata")
 	if userMeta != "" && userMeta != "{}" {
@@ -846,20 +886,21 @@ func (s *FirestoreStore) docToObject(m map[string]interface{}) *ObjectRecord {
 func (s *FirestoreStore) docToUpload(m map[string]interface{}) *MultipartUploadRecord {
 	initiatedAt, _ := time.Parse(firestoreTimeFormat, getStringFromMap(m, "initiated_at"))
 	upload := &MultipartUploadRecord{
-		UploadID:           getStringFromMap(m, "upload_id"),
-		Bucket:             getStringFromMap(m, "bucket"),
-		Key:                getStringFromMap(m, "key"),
-		ContentType:        getStringFromMap(m, "content_type"),
-		ContentEncoding:    getStringFromMap(m, "content_encoding"),
-		ContentLanguage:    getStringFromMap(m, "content_language"),
-		ContentDisposition: getStringFromMap(m, "content_disposition"),
-		CacheControl:       getStringFromMap(m, "cache_control"),
-		Expires:            getStringFromMap(m, "expires"),
-		StorageClass:       getStringFromMap(m, "storage_class"),
-		ACL:                json.RawMessage(getStringFromMap(m, "acl")),
-		OwnerID:            getStringFromMap(m, "owner_id"),
-		OwnerDisplay:       getStringFromMap(m, "owner_display"),
-		InitiatedAt:        initiatedAt,
+		UploadID:                getStringFromMap(m, "upload_id"),
+		Bucket:                  getStringFromMap(m, "bucket"),
+		Key:                     getStringFromMap(m, "key"),
+		ContentType:             getStringFromMap(m, "content_type"),
+		ContentEncoding:         getStringFromMap(m, "content_encoding"),
+		ContentLanguage:         getStringFromMap(m, "content_language"),
+		ContentDisposition:      getStringFromMap(m, "content_disposition"),
+		CacheControl:            getStringFromMap(m, "cache_control"),
+		Expires:                 getStringFromMap(m, "expires"),
+		StorageClass:            getStringFromMap(m, "storage_class"),
+		ACL:                     json.RawMessage(getStringFromMap(m, "acl")),
+		OwnerID:                 getStringFromMap(m, "owner_id"),
+		OwnerDisplay:            getStringFromMap(m, "owner_display"),
+		InitiatedAt:             initiatedAt,
+		WebsiteRedirectLocation: getStringFromMap(m, "website_redirect_location"),
 	}
 	userMeta := getStringFromMap(m, "user_metadata")
 	if userMeta != "" && userMeta != "{}" {
@@ -490,6 +490,34 @@ func (s *LocalStore) ListBuckets(ctx context.Context, owner string) ([]BucketRec
 	return buckets, nil
 }
 
+func (s *LocalStore) ListAllBuckets(ctx context.Context) ([]BucketRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buckets := make([]BucketRecord, 0, len(s.buckets))
+	for _, bucket := range s.buckets {
+		buckets = append(buckets, *bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+	return buckets, nil
+}
+
+func (s *LocalStore) ListCredentials(ctx context.Context) ([]CredentialRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	creds := make([]CredentialRecord, 0, len(s.credentials))
+	for _, cred := range s.credentials {
+		creds = append(creds, *cred)
+	}
+	sort.Slice(creds, func(i, j int) bool {
+		return creds[i].AccessKeyID < creds[j].AccessKeyID
+	})
+	return creds, nil
+}
+
 func (s *LocalStore) BucketExists(ctx context.Context, name string) (bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -10,6 +10,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
 )
 
 type MemoryStore struct {
@@ -19,6 +21,15 @@ type MemoryStore struct {
 	uploads     map[string]*MultipartUploadRecord
 	parts       map[string]map[int]*PartRecord
 	credentials map[string]*CredentialRecord
+	usage       map[usageKey]*UsageRecord
+	clock       clock.Clock
+}
+
+// usageKey identifies a usage row in the in-memory store.
+type usageKey struct {
+	accessKey string
+	bucket    string
+	period    int64
 }
 
 func NewMemoryStore() *MemoryStore {
@@ -28,9 +39,16 @@ func NewMemoryStore() *MemoryStore {
 		uploads:     make(map[string]*MultipartUploadRecord),
 		parts:       make(map[string]map[int]*PartRecord),
 		credentials: make(map[string]*CredentialRecord),
+		usage:       make(map[usageKey]*UsageRecord),
+		clock:       clock.System{},
 	}
 }
 
+// SetClock replaces the clock used for upload expiry.
+func (s *MemoryStore) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
 func (s *MemoryStore) Ping(ctx context.Context) error {
 	return nil
 }
@@ -108,6 +126,34 @@ func (s *MemoryStore) ListBuckets(ctx context.Context, owner string) ([]BucketRe
 	return buckets, nil
 }
 
+func (s *MemoryStore) ListAllBuckets(ctx context.Context) ([]BucketRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buckets := make([]BucketRecord, 0, len(s.buckets))
+	for _, bucket := range s.buckets {
+		buckets = append(buckets, *bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+	return buckets, nil
+}
+
+func (s *MemoryStore) ListCredentials(ctx context.Context) ([]CredentialRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	creds := make([]CredentialRecord, 0, len(s.credentials))
+	for _, cred := range s.credentials {
+		creds = append(creds, *cred)
+	}
+	sort.Slice(creds, func(i, j int) bool {
+		return creds[i].AccessKeyID < creds[j].AccessKeyID
+	})
+	return creds, nil
+}
+
 func (s *MemoryStore) BucketExists(ctx context.Context, name string) (bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -132,7 +178,21 @@ func (s *MemoryStore) UpdateBucketAcl(ctx context.Context, name string, acl json
 func (s *MemoryStore) PutObject(ctx context.Context, obj *ObjectRecord) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.putObjectLocked(obj)
+}
+
+// PutObjectIf writes obj if the current record meets cond.
+func (s *MemoryStore) PutObjectIf(ctx context.Context, obj *ObjectRecord, cond WriteCondition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := cond.Check(s.objects[obj.Bucket][obj.Key]); err != nil {
+		return err
+	}
+	return s.putObjectLocked(obj)
+}
 
+// putObjectLocked writes obj. The caller must hold s.mu.
+func (s *MemoryStore) putObjectLocked(obj *ObjectRecord) error {
 	if _, exists := s.buckets[obj.Bucket]; !exists {
 		return fmt.Errorf("bucket not found: %s", obj.Bucket)
 	}
@@ -182,6 +242,10 @@ func (s *MemoryStore) DeleteObject(ctx context.Context, bucket, key string) erro
 	return nil
 }
 
+// SupportsInlineData reports that object records, including inline
+// payloads, are kept as given.
+func (s *MemoryStore) SupportsInlineData() bool { return true }
+
 func (s *MemoryStore) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -634,7 +698,7 @@ func (s *MemoryStore) ReapExpiredUploads(ttlSeconds int) ([]ExpiredUpload, error
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	cutoff := time.Now().Add(-time.Duration(ttlSeconds) * time.Second)
+	cutoff := s.clock.Now().Add(-time.Duration(ttlSeconds) * time.Second)
 	var expired []ExpiredUpload
 
 	for uploadID, upload := range s.uploads {
@@ -652,6 +716,59 @@ func (s *MemoryStore) ReapExpiredUploads(ttlSeconds int) ([]ExpiredUpload, error
 	return expired, nil
 }
 
+func (s *MemoryStore) AddUsage(ctx context.Context, records []UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rec := range records {
+		k := usageKey{accessKey: rec.AccessKey, bucket: rec.Bucket, period: rec.Period.Unix()}
+		existing, ok := s.usage[k]
+		if !ok {
+			recCopy := rec
+			recCopy.Period = rec.Period.UTC()
+			s.usage[k] = &recCopy
+			continue
+		}
+		existing.Requests += rec.Requests
+		existing.BytesIn += rec.BytesIn
+		existing.BytesOut += rec.BytesOut
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListUsage(ctx context.Context, filter UsageFilter) ([]UsageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []UsageRecord
+	for _, rec := range s.usage {
+		if filter.AccessKey != "" && rec.AccessKey != filter.AccessKey {
+			continue
+		}
+		if filter.Bucket != "" && rec.Bucket != filter.Bucket {
+			continue
+		}
+		if !filter.Since.IsZero() && rec.Period.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && !rec.Period.Before(filter.Until) {
+			continue
+		}
+		records = append(records, *rec)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Period.Equal(records[j].Period) {
+			return records[i].Period.Before(records[j].Period)
+		}
+		if records[i].AccessKey != records[j].AccessKey {
+			return records[i].AccessKey < records[j].AccessKey
+		}
+		return records[i].Bucket < records[j].Bucket
+	})
+	return records, nil
+}
+
 func generateMemoryUploadID() (string, error) {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
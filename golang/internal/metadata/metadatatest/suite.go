@@ -0,0 +1,715 @@
+// Package metadatatest provides a conformance suite for metadata.MetadataStore
+// implementations. Every store runs the same cases, so a new backend cannot
+// drift from the behavior the handlers rely on.
+//
+// A store's test file calls RunSuite with a factory returning an empty store:
+//
+//	func TestConformance(t *testing.T) {
+//		metadatatest.RunSuite(t, func(t *testing.T) metadata.MetadataStore {
+//			return newTestStore(t)
+//		})
+//	}
+package metadatatest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+// Factory returns a new, empty store. It should register any cleanup with
+// t.Cleanup.
+type Factory func(t *testing.T) metadata.MetadataStore
+
+// RunSuite runs every conformance case as a subtest, each against a fresh
+// store from factory.
+func RunSuite(t *testing.T, factory Factory) {
+	cases := []struct {
+		name string
+		fn   func(t *testing.T, s metadata.MetadataStore)
+	}{
+		{"Buckets", testBuckets},
+		{"DeleteBucket", testDeleteBucket},
+		{"Objects", testObjects},
+		{"DeleteObjectsMeta", testDeleteObjectsMeta},
+		{"PutObjectIf", testPutObjectIf},
+		{"ListObjects", testListObjects},
+		{"ListObjectsDelimiter", testListObjectsDelimiter},
+		{"ListObjectsPagination", testListObjectsPagination},
+		{"MultipartUpload", testMultipartUpload},
+		{"ListParts", testListParts},
+		{"AbortMultipartUpload", testAbortMultipartUpload},
+		{"ListMultipartUploads", testListMultipartUploads},
+		{"Credentials", testCredentials},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := factory(t)
+			c.fn(t, s)
+		})
+	}
+}
+
+// ts is a fixed timestamp with millisecond precision, which every store
+// preserves.
+var ts = time.Date(2024, 5, 6, 7, 8, 9, 123e6, time.UTC)
+
+func createBucket(t *testing.T, s metadata.MetadataStore, name, owner string) {
+	t.Helper()
+	err := s.CreateBucket(context.Background(), &metadata.BucketRecord{
+		Name:         name,
+		Region:       "us-east-1",
+		OwnerID:      owner,
+		OwnerDisplay: owner,
+		ACL:          json.RawMessage(`{}`),
+		CreatedAt:    ts,
+	})
+	if err != nil {
+		t.Fatalf("CreateBucket(%s): %v", name, err)
+	}
+}
+
+func putObject(t *testing.T, s metadata.MetadataStore, bucket, key string, size int64) {
+	t.Helper()
+	err := s.PutObject(context.Background(), &metadata.ObjectRecord{
+		Bucket:       bucket,
+		Key:          key,
+		Size:         size,
+		ETag:         fmt.Sprintf(`"%x"`, size),
+		ContentType:  "application/octet-stream",
+		LastModified: ts,
+	})
+	if err != nil {
+		t.Fatalf("PutObject(%s/%s): %v", bucket, key, err)
+	}
+}
+
+func objectKeys(objs []metadata.ObjectRecord) []string {
+	keys := []string{}
+	for _, o := range objs {
+		keys = append(keys, o.Key)
+	}
+	return keys
+}
+
+func testBuckets(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+
+	if b, err := s.GetBucket(ctx, "missing"); err != nil || b != nil {
+		t.Fatalf("GetBucket(missing) = %v, %v; want nil, nil", b, err)
+	}
+	if ok, err := s.BucketExists(ctx, "missing"); err != nil || ok {
+		t.Fatalf("BucketExists(missing) = %v, %v", ok, err)
+	}
+
+	createBucket(t, s, "bravo", "alice")
+	createBucket(t, s, "alpha", "alice")
+	createBucket(t, s, "charlie", "bob")
+
+	if err := s.CreateBucket(ctx, &metadata.BucketRecord{Name: "alpha", OwnerID: "alice", CreatedAt: ts}); err == nil {
+		t.Error("CreateBucket(duplicate) succeeded")
+	}
+
+	b, err := s.GetBucket(ctx, "alpha")
+	if err != nil || b == nil {
+		t.Fatalf("GetBucket(alpha) = %v, %v", b, err)
+	}
+	if b.Name != "alpha" || b.Region != "us-east-1" || b.OwnerID != "alice" || !b.CreatedAt.Equal(ts) {
+		t.Errorf("GetBucket(alpha) = %+v", b)
+	}
+	if ok, err := s.BucketExists(ctx, "alpha"); err != nil || !ok {
+		t.Errorf("BucketExists(alpha) = %v, %v", ok, err)
+	}
+
+	buckets, err := s.ListBuckets(ctx, "alice")
+	if err != nil {
+		t.Fatalf("ListBuckets: %v", err)
+	}
+	var names []string
+	for _, b := range buckets {
+		names = append(names, b.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"alpha", "bravo"}) {
+		t.Errorf("ListBuckets(alice) = %v, want [alpha bravo]", names)
+	}
+
+	acl := json.RawMessage(`{"owner":"alice","grants":[]}`)
+	if err := s.UpdateBucketAcl(ctx, "alpha", acl); err != nil {
+		t.Fatalf("UpdateBucketAcl: %v", err)
+	}
+	b, _ = s.GetBucket(ctx, "alpha")
+	if b == nil || !jsonEqual(b.ACL, acl) {
+		t.Errorf("bucket ACL after update = %s", b.ACL)
+	}
+}
+
+func testDeleteBucket(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "full", "alice")
+	putObject(t, s, "full", "obj", 1)
+
+	if err := s.DeleteBucket(ctx, "full"); err == nil {
+		t.Error("DeleteBucket(non-empty) succeeded")
+	}
+	if err := s.DeleteObject(ctx, "full", "obj"); err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if err := s.DeleteBucket(ctx, "full"); err != nil {
+		t.Fatalf("DeleteBucket(empty): %v", err)
+	}
+	if ok, _ := s.BucketExists(ctx, "full"); ok {
+		t.Error("bucket still exists after DeleteBucket")
+	}
+}
+
+func testObjects(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "objs", "alice")
+
+	if o, err := s.GetObject(ctx, "objs", "missing"); err != nil || o != nil {
+		t.Fatalf("GetObject(missing) = %v, %v; want nil, nil", o, err)
+	}
+
+	want := &metadata.ObjectRecord{
+		Bucket:                  "objs",
+		Key:                     "dir/file.txt",
+		Size:                    42,
+		ETag:                    `"abc"`,
+		ContentType:             "text/plain",
+		ContentEncoding:         "gzip",
+		ContentLanguage:         "en",
+		ContentDisposition:      "inline",
+		CacheControl:            "no-cache",
+		Expires:                 "Thu, 01 Jan 2099 00:00:00 GMT",
+		StorageClass:            "STANDARD",
+		ACL:                     json.RawMessage(`{}`),
+		UserMetadata:            map[string]string{"color": "blue"},
+		LastModified:            ts,
+		Compression:             "zstd",
+		ReplicationStatus:       metadata.ReplicationPending,
+		WebsiteRedirectLocation: "/other.html",
+	}
+	if err := s.PutObject(ctx, want); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	got, err := s.GetObject(ctx, "objs", "dir/file.txt")
+	if err != nil || got == nil {
+		t.Fatalf("GetObject = %v, %v", got, err)
+	}
+	if got.Size != want.Size || got.ETag != want.ETag || got.ContentType != want.ContentType ||
+		got.ContentEncoding != want.ContentEncoding || got.ContentLanguage != want.ContentLanguage ||
+		got.ContentDisposition != want.ContentDisposition || got.CacheControl != want.CacheControl ||
+		got.Expires != want.Expires || got.StorageClass != want.StorageClass ||
+		got.Compression != want.Compression || got.ReplicationStatus != want.ReplicationStatus ||
+		got.WebsiteRedirectLocation != want.WebsiteRedirectLocation ||
+		!reflect.DeepEqual(got.UserMetadata, want.UserMetadata) || !got.LastModified.Equal(ts) {
+		t.Errorf("GetObject = %+v, want %+v", got, want)
+	}
+
+	// PutObject replaces an existing object.
+	putObject(t, s, "objs", "dir/file.txt", 7)
+	got, _ = s.GetObject(ctx, "objs", "dir/file.txt")
+	if got == nil || got.Size != 7 || got.ETag != `"7"` {
+		t.Errorf("GetObject after overwrite = %+v", got)
+	}
+
+	acl := json.RawMessage(`{"owner":"alice","grants":[{"permission":"READ"}]}`)
+	if err := s.UpdateObjectAcl(ctx, "objs", "dir/file.txt", acl); err != nil {
+		t.Fatalf("UpdateObjectAcl: %v", err)
+	}
+	got, _ = s.GetObject(ctx, "objs", "dir/file.txt")
+	if got == nil || !jsonEqual(got.ACL, acl) {
+		t.Errorf("object ACL after update = %s", got.ACL)
+	}
+
+	if ok, err := s.ObjectExists(ctx, "objs", "dir/file.txt"); err != nil || !ok {
+		t.Errorf("ObjectExists = %v, %v", ok, err)
+	}
+	if err := s.DeleteObject(ctx, "objs", "dir/file.txt"); err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if ok, err := s.ObjectExists(ctx, "objs", "dir/file.txt"); err != nil || ok {
+		t.Errorf("ObjectExists after delete = %v, %v", ok, err)
+	}
+	// Deleting a missing object is not an error.
+	if err := s.DeleteObject(ctx, "objs", "dir/file.txt"); err != nil {
+		t.Errorf("DeleteObject(missing): %v", err)
+	}
+}
+
+func testDeleteObjectsMeta(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "batch", "alice")
+	for _, k := range []string{"a", "b", "c"} {
+		putObject(t, s, "batch", k, 1)
+	}
+
+	deleted, errs := s.DeleteObjectsMeta(ctx, "batch", []string{"a", "c", "missing"})
+	if len(errs) != 0 {
+		t.Fatalf("DeleteObjectsMeta errs = %v", errs)
+	}
+	// S3 reports missing keys as deleted.
+	if len(deleted) != 3 {
+		t.Errorf("DeleteObjectsMeta deleted = %v, want 3 keys", deleted)
+	}
+	res, err := s.ListObjects(ctx, "batch", metadata.ListObjectsOptions{})
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if keys := objectKeys(res.Objects); !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Errorf("remaining keys = %v, want [b]", keys)
+	}
+}
+
+func testPutObjectIf(t *testing.T, s metadata.MetadataStore) {
+	cs, ok := s.(metadata.ConditionalPutStore)
+	if !ok {
+		t.Skip("store does not implement metadata.ConditionalPutStore")
+	}
+	ctx := context.Background()
+	createBucket(t, s, "b", "owner")
+	put := func(size int64, cond metadata.WriteCondition) error {
+		return cs.PutObjectIf(ctx, &metadata.ObjectRecord{
+			Bucket: "b", Key: "k", Size: size, ETag: fmt.Sprintf(`"%x"`, size),
+			ContentType: "application/octet-stream", LastModified: ts,
+		}, cond)
+	}
+	size := func() int64 {
+		t.Helper()
+		obj, err := s.GetObject(ctx, "b", "k")
+		if err != nil || obj == nil {
+			t.Fatalf("GetObject: %v, %v", obj, err)
+		}
+		return obj.Size
+	}
+
+	if err := put(10, metadata.WriteCondition{IfMatch: "*"}); !errors.Is(err, metadata.ErrPreconditionFailed) {
+		t.Errorf("If-Match * on a missing object = %v, want ErrPreconditionFailed", err)
+	}
+	if err := put(10, metadata.WriteCondition{IfNoneMatch: true}); err != nil {
+		t.Fatalf("If-None-Match on a missing object: %v", err)
+	}
+	if err := put(11, metadata.WriteCondition{IfNoneMatch: true}); !errors.Is(err, metadata.ErrPreconditionFailed) {
+		t.Errorf("If-None-Match on an existing object = %v, want ErrPreconditionFailed", err)
+	}
+	if err := put(12, metadata.WriteCondition{IfMatch: `"b"`}); !errors.Is(err, metadata.ErrPreconditionFailed) {
+		t.Errorf("If-Match with a stale ETag = %v, want ErrPreconditionFailed", err)
+	}
+	if got := size(); got != 10 {
+		t.Errorf("size after failed writes = %d, want 10", got)
+	}
+	if err := put(13, metadata.WriteCondition{IfMatch: "a"}); err != nil {
+		t.Fatalf("If-Match with the current ETag: %v", err)
+	}
+	if err := put(14, metadata.WriteCondition{IfMatch: "*"}); err != nil {
+		t.Fatalf("If-Match * on an existing object: %v", err)
+	}
+	if got := size(); got != 14 {
+		t.Errorf("size = %d, want 14", got)
+	}
+}
+
+func testListObjects(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "list", "alice")
+	createBucket(t, s, "other", "alice")
+	for _, k := range []string{"b", "a", "c/1", "c/2", "d"} {
+		putObject(t, s, "list", k, 1)
+	}
+	putObject(t, s, "other", "a", 1)
+
+	res, err := s.ListObjects(ctx, "list", metadata.ListObjectsOptions{})
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if keys := objectKeys(res.Objects); !reflect.DeepEqual(keys, []string{"a", "b", "c/1", "c/2", "d"}) {
+		t.Errorf("ListObjects keys = %v", keys)
+	}
+	if res.IsTruncated {
+		t.Error("ListObjects truncated without MaxKeys")
+	}
+
+	res, err = s.ListObjects(ctx, "list", metadata.ListObjectsOptions{Prefix: "c/"})
+	if err != nil {
+		t.Fatalf("ListObjects(prefix): %v", err)
+	}
+	if keys := objectKeys(res.Objects); !reflect.DeepEqual(keys, []string{"c/1", "c/2"}) {
+		t.Errorf("ListObjects(prefix c/) keys = %v", keys)
+	}
+
+	res, err = s.ListObjects(ctx, "list", metadata.ListObjectsOptions{StartAfter: "b"})
+	if err != nil {
+		t.Fatalf("ListObjects(start-after): %v", err)
+	}
+	if keys := objectKeys(res.Objects); !reflect.DeepEqual(keys, []string{"c/1", "c/2", "d"}) {
+		t.Errorf("ListObjects(start-after b) keys = %v", keys)
+	}
+
+	res, err = s.ListObjects(ctx, "empty-or-missing", metadata.ListObjectsOptions{})
+	if err == nil && len(res.Objects) != 0 {
+		t.Errorf("ListObjects(missing bucket) = %v", objectKeys(res.Objects))
+	}
+}
+
+func testListObjectsDelimiter(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "delim", "alice")
+	for _, k := range []string{"a.txt", "photos/2023/x", "photos/2024/y", "photos/top", "videos/v", "z.txt"} {
+		putObject(t, s, "delim", k, 1)
+	}
+
+	res, err := s.ListObjects(ctx, "delim", metadata.ListObjectsOptions{Delimiter: "/"})
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if keys := objectKeys(res.Objects); !reflect.DeepEqual(keys, []string{"a.txt", "z.txt"}) {
+		t.Errorf("keys = %v", keys)
+	}
+	if !reflect.DeepEqual(res.CommonPrefixes, []string{"photos/", "videos/"}) {
+		t.Errorf("common prefixes = %v", res.CommonPrefixes)
+	}
+
+	res, err = s.ListObjects(ctx, "delim", metadata.ListObjectsOptions{Prefix: "photos/", Delimiter: "/"})
+	if err != nil {
+		t.Fatalf("ListObjects(prefix): %v", err)
+	}
+	if keys := objectKeys(res.Objects); !reflect.DeepEqual(keys, []string{"photos/top"}) {
+		t.Errorf("keys under photos/ = %v", keys)
+	}
+	if !reflect.DeepEqual(res.CommonPrefixes, []string{"photos/2023/", "photos/2024/"}) {
+		t.Errorf("common prefixes under photos/ = %v", res.CommonPrefixes)
+	}
+
+	// Prefixes match case-sensitively, and LIKE wildcards match literally.
+	for _, k := range []string{"PHOTOS/2025/q", "PHOTOS/r", "Photos/2025/p", "Photos/s", "B%/y", "b%/x", "bz/w"} {
+		putObject(t, s, "delim", k, 1)
+	}
+	for _, tc := range []struct {
+		prefix   string
+		keys     []string
+		prefixes []string
+	}{
+		{"Photos/", []string{"Photos/s"}, []string{"Photos/2025/"}},
+		{"photos/", []string{"photos/top"}, []string{"photos/2023/", "photos/2024/"}},
+		{"PHOTOS/", []string{"PHOTOS/r"}, []string{"PHOTOS/2025/"}},
+		{"b%", []string{}, []string{"b%/"}},
+	} {
+		res, err := s.ListObjects(ctx, "delim", metadata.ListObjectsOptions{Prefix: tc.prefix, Delimiter: "/"})
+		if err != nil {
+			t.Fatalf("ListObjects(%q): %v", tc.prefix, err)
+		}
+		if keys := objectKeys(res.Objects); !reflect.DeepEqual(keys, tc.keys) {
+			t.Errorf("keys under %q = %v, want %v", tc.prefix, keys, tc.keys)
+		}
+		if !reflect.DeepEqual(res.CommonPrefixes, tc.prefixes) {
+			t.Errorf("common prefixes under %q = %v, want %v", tc.prefix, res.CommonPrefixes, tc.prefixes)
+		}
+	}
+}
+
+func testListObjectsPagination(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "pages", "alice")
+	var want []string
+	for i := 0; i < 7; i++ {
+		k := fmt.Sprintf("key-%02d", i)
+		want = append(want, k)
+		putObject(t, s, "pages", k, 1)
+	}
+
+	var got []string
+	opts := metadata.ListObjectsOptions{MaxKeys: 3}
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatal("pagination did not terminate")
+		}
+		res, err := s.ListObjects(ctx, "pages", opts)
+		if err != nil {
+			t.Fatalf("ListObjects: %v", err)
+		}
+		if len(res.Objects) > 3 {
+			t.Fatalf("page has %d objects, MaxKeys is 3", len(res.Objects))
+		}
+		got = append(got, objectKeys(res.Objects)...)
+		if !res.IsTruncated {
+			break
+		}
+		if res.NextContinuationToken == "" {
+			t.Fatal("truncated page without NextContinuationToken")
+		}
+		opts.ContinuationToken = res.NextContinuationToken
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paginated keys = %v, want %v", got, want)
+	}
+
+	// V1 listing resumes from Marker.
+	res, err := s.ListObjects(ctx, "pages", metadata.ListObjectsOptions{Marker: "key-04", MaxKeys: 10})
+	if err != nil {
+		t.Fatalf("ListObjects(marker): %v", err)
+	}
+	if keys := objectKeys(res.Objects); !reflect.DeepEqual(keys, want[5:]) {
+		t.Errorf("keys after marker = %v, want %v", keys, want[5:])
+	}
+}
+
+func createUpload(t *testing.T, s metadata.MetadataStore, bucket, key string, initiated time.Time) string {
+	t.Helper()
+	id, err := s.CreateMultipartUpload(context.Background(), &metadata.MultipartUploadRecord{
+		Bucket:                  bucket,
+		Key:                     key,
+		ContentType:             "text/plain",
+		StorageClass:            "STANDARD",
+		UserMetadata:            map[string]string{"k": "v"},
+		OwnerID:                 "alice",
+		OwnerDisplay:            "alice",
+		InitiatedAt:             initiated,
+		WebsiteRedirectLocation: "https://example.com/",
+	})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload(%s/%s): %v", bucket, key, err)
+	}
+	if id == "" {
+		t.Fatal("CreateMultipartUpload returned an empty upload ID")
+	}
+	return id
+}
+
+func putPart(t *testing.T, s metadata.MetadataStore, uploadID string, n int, size int64) {
+	t.Helper()
+	err := s.PutPart(context.Background(), &metadata.PartRecord{
+		UploadID:     uploadID,
+		PartNumber:   n,
+		Size:         size,
+		ETag:         fmt.Sprintf(`"part%d"`, n),
+		LastModified: ts,
+	})
+	if err != nil {
+		t.Fatalf("PutPart(%d): %v", n, err)
+	}
+}
+
+func testMultipartUpload(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "mp", "alice")
+	id := createUpload(t, s, "mp", "big", ts)
+
+	// A caller-supplied upload ID is kept.
+	fixed, err := s.CreateMultipartUpload(ctx, &metadata.MultipartUploadRecord{UploadID: "fixed-id", Bucket: "mp", Key: "other", InitiatedAt: ts})
+	if err != nil || fixed != "fixed-id" {
+		t.Errorf("CreateMultipartUpload(fixed) = %q, %v", fixed, err)
+	}
+
+	up, err := s.GetMultipartUpload(ctx, "mp", "big", id)
+	if err != nil || up == nil {
+		t.Fatalf("GetMultipartUpload = %v, %v", up, err)
+	}
+	if up.UploadID != id || up.Bucket != "mp" || up.Key != "big" || up.ContentType != "text/plain" ||
+		!reflect.DeepEqual(up.UserMetadata, map[string]string{"k": "v"}) || !up.InitiatedAt.Equal(ts) ||
+		up.WebsiteRedirectLocation != "https://example.com/" {
+		t.Errorf("GetMultipartUpload = %+v", up)
+	}
+	if up, err := s.GetMultipartUpload(ctx, "mp", "big", "no-such-upload"); err != nil || up != nil {
+		t.Errorf("GetMultipartUpload(missing) = %v, %v; want nil, nil", up, err)
+	}
+
+	putPart(t, s, id, 1, 5)
+	putPart(t, s, id, 2, 5)
+	putPart(t, s, id, 3, 2)
+	// Re-uploading a part replaces it.
+	putPart(t, s, id, 2, 6)
+
+	parts, err := s.GetPartsForCompletion(ctx, id, []int{1, 2})
+	if err != nil {
+		t.Fatalf("GetPartsForCompletion: %v", err)
+	}
+	if len(parts) != 2 || parts[0].PartNumber != 1 || parts[1].PartNumber != 2 || parts[1].Size != 6 {
+		t.Errorf("GetPartsForCompletion = %+v", parts)
+	}
+
+	err = s.CompleteMultipartUpload(ctx, "mp", "big", id, &metadata.ObjectRecord{
+		Bucket:       "mp",
+		Key:          "big",
+		Size:         11,
+		ETag:         `"final-2"`,
+		ContentType:  "text/plain",
+		LastModified: ts,
+		PartSizes:    []int64{5, 6},
+	})
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	obj, err := s.GetObject(ctx, "mp", "big")
+	if err != nil || obj == nil || obj.Size != 11 || obj.ETag != `"final-2"` {
+		t.Errorf("object after complete = %+v, %v", obj, err)
+	}
+	if obj != nil && (len(obj.PartSizes) != 2 || obj.PartSizes[0] != 5 || obj.PartSizes[1] != 6) {
+		t.Errorf("PartSizes after complete = %v, want [5 6]", obj.PartSizes)
+	}
+	if up, _ := s.GetMultipartUpload(ctx, "mp", "big", id); up != nil {
+		t.Error("upload still exists after complete")
+	}
+	if res, err := s.ListParts(ctx, id, metadata.ListPartsOptions{}); err == nil && len(res.Parts) != 0 {
+		t.Errorf("parts remain after complete: %+v", res.Parts)
+	}
+}
+
+func testListParts(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "parts", "alice")
+	id := createUpload(t, s, "parts", "obj", ts)
+	for _, n := range []int{3, 1, 5, 2, 4} {
+		putPart(t, s, id, n, int64(n))
+	}
+
+	var got []int
+	opts := metadata.ListPartsOptions{MaxParts: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		res, err := s.ListParts(ctx, id, opts)
+		if err != nil {
+			t.Fatalf("ListParts: %v", err)
+		}
+		if len(res.Parts) > 2 {
+			t.Fatalf("page has %d parts, MaxParts is 2", len(res.Parts))
+		}
+		for _, p := range res.Parts {
+			got = append(got, p.PartNumber)
+			if p.Size != int64(p.PartNumber) || p.ETag != fmt.Sprintf(`"part%d"`, p.PartNumber) {
+				t.Errorf("part %+v", p)
+			}
+		}
+		if !res.IsTruncated {
+			break
+		}
+		opts.PartNumberMarker = res.NextPartNumberMarker
+	}
+	if !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("listed parts = %v", got)
+	}
+}
+
+func testAbortMultipartUpload(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "abort", "alice")
+	id := createUpload(t, s, "abort", "obj", ts)
+	putPart(t, s, id, 1, 5)
+
+	if err := s.AbortMultipartUpload(ctx, "abort", "obj", id); err != nil {
+		t.Fatalf("AbortMultipartUpload: %v", err)
+	}
+	if up, _ := s.GetMultipartUpload(ctx, "abort", "obj", id); up != nil {
+		t.Error("upload still exists after abort")
+	}
+	if res, err := s.ListParts(ctx, id, metadata.ListPartsOptions{}); err == nil && len(res.Parts) != 0 {
+		t.Errorf("parts remain after abort: %+v", res.Parts)
+	}
+	if ok, _ := s.ObjectExists(ctx, "abort", "obj"); ok {
+		t.Error("abort created an object")
+	}
+	// With the upload gone the bucket can be deleted.
+	if err := s.DeleteBucket(ctx, "abort"); err != nil {
+		t.Errorf("DeleteBucket after abort: %v", err)
+	}
+}
+
+func testListMultipartUploads(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	createBucket(t, s, "uploads", "alice")
+	createBucket(t, s, "elsewhere", "alice")
+	createUpload(t, s, "uploads", "b", ts)
+	createUpload(t, s, "uploads", "a", ts.Add(time.Second))
+	createUpload(t, s, "uploads", "dir/c", ts.Add(2*time.Second))
+	createUpload(t, s, "elsewhere", "a", ts)
+
+	res, err := s.ListMultipartUploads(ctx, "uploads", metadata.ListUploadsOptions{})
+	if err != nil {
+		t.Fatalf("ListMultipartUploads: %v", err)
+	}
+	var keys []string
+	for _, u := range res.Uploads {
+		keys = append(keys, u.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b", "dir/c"}) {
+		t.Errorf("upload keys = %v, want [a b dir/c]", keys)
+	}
+
+	res, err = s.ListMultipartUploads(ctx, "uploads", metadata.ListUploadsOptions{Prefix: "dir/"})
+	if err != nil {
+		t.Fatalf("ListMultipartUploads(prefix): %v", err)
+	}
+	if len(res.Uploads) != 1 || res.Uploads[0].Key != "dir/c" {
+		t.Errorf("uploads under dir/ = %+v", res.Uploads)
+	}
+
+	res, err = s.ListMultipartUploads(ctx, "uploads", metadata.ListUploadsOptions{MaxUploads: 2})
+	if err != nil {
+		t.Fatalf("ListMultipartUploads(max): %v", err)
+	}
+	if len(res.Uploads) != 2 || !res.IsTruncated || res.NextKeyMarker != "b" {
+		t.Errorf("first page = %d uploads, truncated %v, next key %q", len(res.Uploads), res.IsTruncated, res.NextKeyMarker)
+	}
+	res, err = s.ListMultipartUploads(ctx, "uploads", metadata.ListUploadsOptions{
+		KeyMarker:      res.NextKeyMarker,
+		UploadIDMarker: res.NextUploadIDMarker,
+		MaxUploads:     2,
+	})
+	if err != nil {
+		t.Fatalf("ListMultipartUploads(marker): %v", err)
+	}
+	if len(res.Uploads) != 1 || res.Uploads[0].Key != "dir/c" || res.IsTruncated {
+		t.Errorf("second page = %+v, truncated %v", res.Uploads, res.IsTruncated)
+	}
+}
+
+func testCredentials(t *testing.T, s metadata.MetadataStore) {
+	ctx := context.Background()
+	if c, err := s.GetCredential(ctx, "missing"); err != nil || c != nil {
+		t.Fatalf("GetCredential(missing) = %v, %v; want nil, nil", c, err)
+	}
+
+	cred := &metadata.CredentialRecord{
+		AccessKeyID: "AKIDEXAMPLE",
+		SecretKey:   "secret",
+		OwnerID:     "alice",
+		DisplayName: "Alice",
+		Active:      true,
+		CreatedAt:   ts,
+	}
+	if err := s.PutCredential(ctx, cred); err != nil {
+		t.Fatalf("PutCredential: %v", err)
+	}
+	got, err := s.GetCredential(ctx, "AKIDEXAMPLE")
+	if err != nil || got == nil {
+		t.Fatalf("GetCredential = %v, %v", got, err)
+	}
+	if got.SecretKey != "secret" || got.OwnerID != "alice" || got.DisplayName != "Alice" || !got.Active {
+		t.Errorf("GetCredential = %+v", got)
+	}
+
+	// PutCredential updates an existing credential.
+	cred.SecretKey = "rotated"
+	if err := s.PutCredential(ctx, cred); err != nil {
+		t.Fatalf("PutCredential(update): %v", err)
+	}
+	if got, _ := s.GetCredential(ctx, "AKIDEXAMPLE"); got == nil || got.SecretKey != "rotated" {
+		t.Errorf("GetCredential after update = %+v", got)
+	}
+}
+
+// jsonEqual reports whether a and b hold equivalent JSON.
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,301 @@
+package metadata
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// Migration phases recorded in a MigrateCheckpoint.
+const (
+	MigratePhaseObjects = "objects"
+	MigratePhaseUploads = "uploads"
+	MigratePhaseDone    = "done"
+)
+
+// defaultMigrateBatchSize is the listing page size used when
+// MigrateOptions.BatchSize is not set.
+const defaultMigrateBatchSize = 1000
+
+// MigrateCheckpoint records how far a migration has progressed so an
+// interrupted run can resume. Bucket and AfterKey identify the last object
+// copied; during the uploads phase Bucket is the last bucket whose uploads
+// were fully copied.
+type MigrateCheckpoint struct {
+	Phase    string `json:"phase"`
+	Bucket   string `json:"bucket,omitempty"`
+	AfterKey string `json:"after_key,omitempty"`
+}
+
+// MigrateOptions controls a migration.
+type MigrateOptions struct {
+	// BatchSize is the number of objects listed and copied per batch.
+	BatchSize int
+	// Resume, if set, skips records the checkpoint says were already copied.
+	Resume *MigrateCheckpoint
+	// Checkpoint, if set, is called after each batch. Returning an error
+	// aborts the migration.
+	Checkpoint func(MigrateCheckpoint) error
+}
+
+// MigrateStats counts the records copied by a migration.
+type MigrateStats struct {
+	Credentials int
+	Buckets     int
+	Objects     int
+	Uploads     int
+	Parts       int
+}
+
+// Migrate copies credentials, buckets, objects, multipart uploads and parts
+// from src to dst. Every step is idempotent, so a migration may be re-run or
+// resumed from a checkpoint after a failure. src must implement Enumerator.
+func Migrate(ctx context.Context, src, dst MetadataStore, opts MigrateOptions) (*MigrateStats, error) {
+	enum, ok := src.(Enumerator)
+	if !ok {
+		return nil, fmt.Errorf("source store cannot be used as a migration source")
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultMigrateBatchSize
+	}
+	resume := MigrateCheckpoint{Phase: MigratePhaseObjects}
+	if opts.Resume != nil {
+		resume = *opts.Resume
+	}
+	checkpoint := func(cp MigrateCheckpoint) error {
+		if opts.Checkpoint == nil {
+			return nil
+		}
+		return opts.Checkpoint(cp)
+	}
+
+	stats := &MigrateStats{}
+	if resume.Phase == MigratePhaseDone {
+		return stats, nil
+	}
+
+	// Credentials and buckets are small and cheap to re-check, so they are
+	// always copied in full.
+	creds, err := enum.ListCredentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing source credentials: %w", err)
+	}
+	for i := range creds {
+		if err := dst.PutCredential(ctx, &creds[i]); err != nil {
+			return stats, fmt.Errorf("copying credential %s: %w", creds[i].AccessKeyID, err)
+		}
+		stats.Credentials++
+	}
+
+	buckets, err := enum.ListAllBuckets(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("listing source buckets: %w", err)
+	}
+	for i := range buckets {
+		exists, err := dst.BucketExists(ctx, buckets[i].Name)
+		if err != nil {
+			return stats, fmt.Errorf("checking bucket %s: %w", buckets[i].Name, err)
+		}
+		if exists {
+			continue
+		}
+		if err := dst.CreateBucket(ctx, &buckets[i]); err != nil {
+			return stats, fmt.Errorf("copying bucket %s: %w", buckets[i].Name, err)
+		}
+		stats.Buckets++
+	}
+
+	if resume.Phase == MigratePhaseObjects {
+		for _, bucket := range buckets {
+			if bucket.Name < resume.Bucket {
+				continue
+			}
+			after := ""
+			if bucket.Name == resume.Bucket {
+				after = resume.AfterKey
+			}
+			for {
+				page, err := src.ListObjects(ctx, bucket.Name, ListObjectsOptions{StartAfter: after, MaxKeys: batchSize})
+				if err != nil {
+					return stats, fmt.Errorf("listing objects in %s: %w", bucket.Name, err)
+				}
+				for i := range page.Objects {
+					if err := dst.PutObject(ctx, &page.Objects[i]); err != nil {
+						return stats, fmt.Errorf("copying object %s/%s: %w", bucket.Name, page.Objects[i].Key, err)
+					}
+					stats.Objects++
+				}
+				if len(page.Objects) > 0 {
+					after = page.Objects[len(page.Objects)-1].Key
+					if err := checkpoint(MigrateCheckpoint{Phase: MigratePhaseObjects, Bucket: bucket.Name, AfterKey: after}); err != nil {
+						return stats, err
+					}
+				}
+				if !page.IsTruncated || len(page.Objects) == 0 {
+					break
+				}
+			}
+		}
+		resume = MigrateCheckpoint{Phase: MigratePhaseUploads}
+	}
+
+	for _, bucket := range buckets {
+		if bucket.Name <= resume.Bucket {
+			continue
+		}
+		if err := migrateUploads(ctx, src, dst, bucket.Name, batchSize, stats); err != nil {
+			return stats, err
+		}
+		if err := checkpoint(MigrateCheckpoint{Phase: MigratePhaseUploads, Bucket: bucket.Name}); err != nil {
+			return stats, err
+		}
+	}
+
+	if err := checkpoint(MigrateCheckpoint{Phase: MigratePhaseDone}); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// migrateUploads copies the in-progress multipart uploads of one bucket and
+// their parts. Uploads already present in dst keep their record, but their
+// parts are still copied so a partially migrated upload is completed.
+func migrateUploads(ctx context.Context, src, dst MetadataStore, bucket string, batchSize int, stats *MigrateStats) error {
+	opts := ListUploadsOptions{MaxUploads: batchSize}
+	for {
+		page, err := src.ListMultipartUploads(ctx, bucket, opts)
+		if err != nil {
+			return fmt.Errorf("listing uploads in %s: %w", bucket, err)
+		}
+		for i := range page.Uploads {
+			upload := &page.Uploads[i]
+			existing, err := dst.GetMultipartUpload(ctx, bucket, upload.Key, upload.UploadID)
+			if err != nil {
+				return fmt.Errorf("checking upload %s: %w", upload.UploadID, err)
+			}
+			if existing == nil {
+				if _, err := dst.CreateMultipartUpload(ctx, upload); err != nil {
+					return fmt.Errorf("copying upload %s: %w", upload.UploadID, err)
+				}
+				stats.Uploads++
+			}
+
+			partOpts := ListPartsOptions{MaxParts: batchSize}
+			for {
+				parts, err := src.ListParts(ctx, upload.UploadID, partOpts)
+				if err != nil {
+					return fmt.Errorf("listing parts of %s: %w", upload.UploadID, err)
+				}
+				for j := range parts.Parts {
+					if err := dst.PutPart(ctx, &parts.Parts[j]); err != nil {
+						return fmt.Errorf("copying part %d of %s: %w", parts.Parts[j].PartNumber, upload.UploadID, err)
+					}
+					stats.Parts++
+				}
+				if !parts.IsTruncated {
+					break
+				}
+				partOpts.PartNumberMarker = parts.NextPartNumberMarker
+			}
+		}
+		if !page.IsTruncated {
+			return nil
+		}
+		opts.KeyMarker = page.NextKeyMarker
+		opts.UploadIDMarker = page.NextUploadIDMarker
+	}
+}
+
+// bucketDigest summarizes a bucket's objects for verification.
+type bucketDigest struct {
+	objects  int
+	checksum string
+}
+
+// digestBucket counts a bucket's objects and hashes their keys, ETags and
+// sizes in key order.
+func digestBucket(ctx context.Context, store MetadataStore, bucket string, batchSize int) (bucketDigest, error) {
+	h := sha256.New()
+	var d bucketDigest
+	after := ""
+	for {
+		page, err := store.ListObjects(ctx, bucket, ListObjectsOptions{StartAfter: after, MaxKeys: batchSize})
+		if err != nil {
+			return d, fmt.Errorf("listing objects in %s: %w", bucket, err)
+		}
+		for _, obj := range page.Objects {
+			h.Write([]byte(obj.Key + "\x00" + obj.ETag + "\x00" + strconv.FormatInt(obj.Size, 10) + "\n"))
+			d.objects++
+		}
+		if !page.IsTruncated || len(page.Objects) == 0 {
+			break
+		}
+		after = page.Objects[len(page.Objects)-1].Key
+	}
+	d.checksum = hex.EncodeToString(h.Sum(nil))
+	return d, nil
+}
+
+// VerifyMigration compares dst against src after a migration. It checks that
+// every credential and bucket exists in dst and that each bucket holds the
+// same number of objects with the same keys, ETags and sizes. It returns a
+// description of each mismatch found; an empty result means the stores agree.
+func VerifyMigration(ctx context.Context, src, dst MetadataStore, batchSize int) ([]string, error) {
+	enum, ok := src.(Enumerator)
+	if !ok {
+		return nil, fmt.Errorf("source store cannot be used as a migration source")
+	}
+	if batchSize <= 0 {
+		batchSize = defaultMigrateBatchSize
+	}
+
+	var mismatches []string
+	creds, err := enum.ListCredentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing source credentials: %w", err)
+	}
+	for _, cred := range creds {
+		got, err := dst.GetCredential(ctx, cred.AccessKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("reading credential %s: %w", cred.AccessKeyID, err)
+		}
+		switch {
+		case got == nil:
+			mismatches = append(mismatches, fmt.Sprintf("credential %s: missing", cred.AccessKeyID))
+		case got.SecretKey != cred.SecretKey || got.OwnerID != cred.OwnerID || got.Active != cred.Active:
+			mismatches = append(mismatches, fmt.Sprintf("credential %s: fields differ", cred.AccessKeyID))
+		}
+	}
+
+	buckets, err := enum.ListAllBuckets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing source buckets: %w", err)
+	}
+	for _, bucket := range buckets {
+		exists, err := dst.BucketExists(ctx, bucket.Name)
+		if err != nil {
+			return nil, fmt.Errorf("checking bucket %s: %w", bucket.Name, err)
+		}
+		if !exists {
+			mismatches = append(mismatches, fmt.Sprintf("bucket %s: missing", bucket.Name))
+			continue
+		}
+		want, err := digestBucket(ctx, src, bucket.Name, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		got, err := digestBucket(ctx, dst, bucket.Name, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		if got.objects != want.objects {
+			mismatches = append(mismatches, fmt.Sprintf("bucket %s: %d objects, want %d", bucket.Name, got.objects, want.objects))
+		} else if got.checksum != want.checksum {
+			mismatches = append(mismatches, fmt.Sprintf("bucket %s: object checksum mismatch", bucket.Name))
+		}
+	}
+	return mismatches, nil
+}
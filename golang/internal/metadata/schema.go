@@ -0,0 +1,158 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaTooNew is returned when a store's schema was written by a newer
+// BleepStore that knows migrations this binary does not.
+var ErrSchemaTooNew = errors.New("metadata schema is newer than this binary")
+
+// SchemaMigration is one step of an engine's schema history. Up applies the
+// step and Down reverts it. Each runs in the engine's write transaction
+// together with the version bookkeeping, so a failed step leaves the store
+// at the previous version.
+//
+// Migrations are listed in order with versions 1, 2, 3, ...; once released a
+// migration must never change. New columns, tables and indexes are added by
+// appending a migration to the engine's list.
+type SchemaMigration[Tx any] struct {
+	Version int
+	Name    string
+	Up      func(tx Tx) error
+	// Down may be nil for a step that cannot be reverted.
+	Down func(tx Tx) error
+}
+
+// SchemaMigrator is an optional interface for metadata stores with a
+// versioned schema. Stores migrate to the latest version when opened;
+// MigrateSchema is for inspecting and rolling back.
+type SchemaMigrator interface {
+	// SchemaVersion returns the applied version and the latest version this
+	// binary knows.
+	SchemaVersion(ctx context.Context) (current, latest int, err error)
+
+	// MigrateSchema applies or reverts migrations until the schema is at
+	// target (-1 = latest) and returns the resulting version.
+	MigrateSchema(ctx context.Context, target int) (int, error)
+}
+
+// schemaTarget adapts an engine's transactions and version bookkeeping to
+// migrateSchema.
+type schemaTarget[Tx any] struct {
+	// update runs fn in a write transaction, committing if it returns nil.
+	update func(fn func(tx Tx) error) error
+	// version returns the highest applied version, or 0 for a new store.
+	version func(tx Tx) (int, error)
+	// record marks version as applied, or as reverted when applied is false.
+	record func(tx Tx, version int, applied bool) error
+}
+
+// latestSchemaVersion validates that migrations are numbered 1..n and
+// returns n.
+func latestSchemaVersion[Tx any](migrations []SchemaMigration[Tx]) (int, error) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return 0, fmt.Errorf("schema migration %q has version %d, want %d", m.Name, m.Version, i+1)
+		}
+	}
+	return len(migrations), nil
+}
+
+// migrateSchema steps the schema one migration per transaction until it is
+// at target (-1 = latest). The applied version is re-read in every
+// transaction, so concurrent runners against the same store do not apply a
+// step twice. It returns the last committed version.
+func migrateSchema[Tx any](t schemaTarget[Tx], migrations []SchemaMigration[Tx], target int) (int, error) {
+	latest, err := latestSchemaVersion(migrations)
+	if err != nil {
+		return 0, err
+	}
+	if target < 0 {
+		target = latest
+	}
+	if target > latest {
+		return 0, fmt.Errorf("target schema version %d is beyond the latest known version %d", target, latest)
+	}
+
+	committed := 0
+	for {
+		var next int
+		done := false
+		err := t.update(func(tx Tx) error {
+			current, err := t.version(tx)
+			if err != nil {
+				return fmt.Errorf("reading schema version: %w", err)
+			}
+			switch {
+			case current > latest:
+				return fmt.Errorf("%w: store is at version %d, this binary knows up to %d", ErrSchemaTooNew, current, latest)
+			case current < target:
+				m := migrations[current]
+				if err := m.Up(tx); err != nil {
+					return fmt.Errorf("applying schema migration %d (%s): %w", m.Version, m.Name, err)
+				}
+				next = m.Version
+				return t.record(tx, m.Version, true)
+			case current > target:
+				m := migrations[current-1]
+				if m.Down == nil {
+					return fmt.Errorf("schema migration %d (%s) cannot be reverted", m.Version, m.Name)
+				}
+				if err := m.Down(tx); err != nil {
+					return fmt.Errorf("reverting schema migration %d (%s): %w", m.Version, m.Name, err)
+				}
+				next = m.Version - 1
+				return t.record(tx, m.Version, false)
+			default:
+				next = current
+				done = true
+				return nil
+			}
+		})
+		if err != nil {
+			return committed, err
+		}
+		committed = next
+		if done {
+			return committed, nil
+		}
+	}
+}
+
+// SchemaStatus describes a store's schema as found on disk, read without
+// migrating it.
+type SchemaStatus struct {
+	// Exists is false for a store not created yet.
+	Exists bool
+	// Current is the applied version, or 0 for a store created before
+	// versioning.
+	Current int
+	// Latest is the latest version this binary knows.
+	Latest int
+	// Pending lists the migrations opening the store will apply, in order.
+	Pending []SchemaStep
+}
+
+// SchemaStep names one pending migration.
+type SchemaStep struct {
+	Version int
+	Name    string
+}
+
+// TooNew reports whether the store was migrated by a newer binary, which
+// this one refuses to open.
+func (s *SchemaStatus) TooNew() bool {
+	return s.Current > s.Latest
+}
+
+// schemaStatus compares current against migrations.
+func schemaStatus[Tx any](exists bool, current int, migrations []SchemaMigration[Tx]) *SchemaStatus {
+	st := &SchemaStatus{Exists: exists, Current: current, Latest: len(migrations)}
+	for _, m := range migrations[min(current, len(migrations)):] {
+		st.Pending = append(st.Pending, SchemaStep{Version: m.Version, Name: m.Name})
+	}
+	return st
+}
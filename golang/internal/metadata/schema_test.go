@@ -0,0 +1,158 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+)
+
+// fakeSchema is an in-memory migration target. A transaction works on a
+// copy of the state that is kept only if the step succeeds.
+type fakeSchema struct {
+	version int
+	columns []string
+}
+
+func (f *fakeSchema) target() schemaTarget[*fakeSchema] {
+	return schemaTarget[*fakeSchema]{
+		update: func(fn func(tx *fakeSchema) error) error {
+			tx := &fakeSchema{version: f.version, columns: append([]string(nil), f.columns...)}
+			if err := fn(tx); err != nil {
+				return err
+			}
+			*f = *tx
+			return nil
+		},
+		version: func(tx *fakeSchema) (int, error) { return tx.version, nil },
+		record: func(tx *fakeSchema, version int, applied bool) error {
+			if applied {
+				tx.version = version
+			} else {
+				tx.version = version - 1
+			}
+			return nil
+		},
+	}
+}
+
+func addColumn(name string) SchemaMigration[*fakeSchema] {
+	return SchemaMigration[*fakeSchema]{
+		Name: "add " + name,
+		Up: func(tx *fakeSchema) error {
+			tx.columns = append(tx.columns, name)
+			return nil
+		},
+		Down: func(tx *fakeSchema) error {
+			tx.columns = tx.columns[:len(tx.columns)-1]
+			return nil
+		},
+	}
+}
+
+func TestMigrateSchemaUpAndDown(t *testing.T) {
+	migrations := []SchemaMigration[*fakeSchema]{addColumn("a"), addColumn("b"), addColumn("c")}
+	for i := range migrations {
+		migrations[i].Version = i + 1
+	}
+	f := &fakeSchema{}
+
+	if v, err := migrateSchema(f.target(), migrations, -1); err != nil || v != 3 {
+		t.Fatalf("migrate to latest = %d, %v; want 3", v, err)
+	}
+	if !reflect.DeepEqual(f.columns, []string{"a", "b", "c"}) {
+		t.Errorf("columns = %v", f.columns)
+	}
+	if v, err := migrateSchema(f.target(), migrations, 1); err != nil || v != 1 {
+		t.Fatalf("migrate to 1 = %d, %v", v, err)
+	}
+	if !reflect.DeepEqual(f.columns, []string{"a"}) {
+		t.Errorf("columns after down = %v", f.columns)
+	}
+
+	// A failing step rolls back and leaves the last committed version.
+	migrations[2].Up = func(tx *fakeSchema) error {
+		tx.columns = append(tx.columns, "partial")
+		return errors.New("boom")
+	}
+	if v, err := migrateSchema(f.target(), migrations, -1); err == nil || v != 2 {
+		t.Fatalf("failing migration = %d, %v; want 2 and an error", v, err)
+	}
+	if f.version != 2 || !reflect.DeepEqual(f.columns, []string{"a", "b"}) {
+		t.Errorf("state after failure = %d %v", f.version, f.columns)
+	}
+
+	// A store written by a newer binary is refused.
+	f.version = 7
+	if _, err := migrateSchema(f.target(), migrations, -1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("newer store: err = %v, want ErrSchemaTooNew", err)
+	}
+
+	// Versions must be numbered 1..n.
+	migrations[1].Version = 5
+	if _, err := migrateSchema((&fakeSchema{}).target(), migrations, -1); err == nil {
+		t.Error("misnumbered migrations accepted")
+	}
+}
+
+func TestSQLiteSchemaMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	ctx := context.Background()
+	current, latest, err := store.SchemaVersion(ctx)
+	if err != nil || current != latest || latest != len(sqliteMigrations) {
+		t.Fatalf("SchemaVersion = %d, %d, %v", current, latest, err)
+	}
+
+	if v, err := store.MigrateSchema(ctx, 0); err != nil || v != 0 {
+		t.Fatalf("MigrateSchema(0) = %d, %v", v, err)
+	}
+	var tables int
+	store.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'objects'").Scan(&tables)
+	if tables != 0 {
+		t.Error("objects table survived migrating to version 0")
+	}
+	store.Close()
+
+	// Reopening migrates back to the latest version.
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer store.Close()
+	if current, _, _ := store.SchemaVersion(ctx); current != len(sqliteMigrations) {
+		t.Errorf("version after reopen = %d", current)
+	}
+	seedBucket(t, store, "after-migrate")
+}
+
+func TestBoltSchemaMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta.bolt")
+	store, err := NewBoltStore(&config.BoltConfig{Path: path})
+	if err != nil {
+		t.Fatalf("NewBoltStore: %v", err)
+	}
+	ctx := context.Background()
+	if current, latest, err := store.SchemaVersion(ctx); err != nil || current != latest {
+		t.Fatalf("SchemaVersion = %d, %d, %v", current, latest, err)
+	}
+	if v, err := store.MigrateSchema(ctx, 0); err != nil || v != 0 {
+		t.Fatalf("MigrateSchema(0) = %d, %v", v, err)
+	}
+	store.Close()
+
+	store, err = NewBoltStore(&config.BoltConfig{Path: path})
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer store.Close()
+	if err := store.CreateBucket(ctx, &BucketRecord{Name: "b", OwnerID: "o"}); err != nil {
+		t.Fatalf("CreateBucket after reopen: %v", err)
+	}
+}
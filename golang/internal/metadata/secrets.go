@@ -0,0 +1,119 @@
+package metadata
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedSecretPrefix marks a secret key stored encrypted. SigV4 signing
+// keys are derived from the secret itself, so it cannot be stored as a
+// one-way hash.
+const sealedSecretPrefix = "sealed:v1:"
+
+// SecretSealer encrypts credential secret keys at rest with AES-256-GCM
+// under a key derived from the server master key. Each secret is bound to
+// its access key ID, so a sealed secret copied to another credential row
+// does not open. A nil *SecretSealer stores secrets in plaintext and
+// refuses to open sealed ones.
+type SecretSealer struct {
+	aead cipher.AEAD
+}
+
+// NewSecretSealer returns a sealer keyed by masterKey, which must not be
+// empty.
+func NewSecretSealer(masterKey string) (*SecretSealer, error) {
+	if masterKey == "" {
+		return nil, errors.New("master key is empty")
+	}
+	key, err := hkdf.Key(sha256.New, []byte(masterKey), nil, "bleepstore credential secrets", 32)
+	if err != nil {
+		return nil, fmt.Errorf("deriving secret key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretSealer{aead: aead}, nil
+}
+
+// IsSealedSecret reports whether a stored secret key is encrypted.
+func IsSealedSecret(stored string) bool {
+	return strings.HasPrefix(stored, sealedSecretPrefix)
+}
+
+// Seal returns the form of accessKeyID's secret to store.
+func (s *SecretSealer) Seal(accessKeyID, secret string) (string, error) {
+	if s == nil {
+		return secret, nil
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(secret), []byte(accessKeyID))
+	return sealedSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open returns the secret key stored for accessKeyID, decrypting it if it
+// is sealed. Plaintext secrets are returned as they are.
+func (s *SecretSealer) Open(accessKeyID, stored string) (string, error) {
+	encoded, sealed := strings.CutPrefix(stored, sealedSecretPrefix)
+	if !sealed {
+		return stored, nil
+	}
+	if s == nil {
+		return "", fmt.Errorf("secret of %s is sealed but no master key is configured", accessKeyID)
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", fmt.Errorf("secret of %s is malformed", accessKeyID)
+	}
+	n := s.aead.NonceSize()
+	secret, err := s.aead.Open(nil, data[:n], data[n:], []byte(accessKeyID))
+	if err != nil {
+		return "", fmt.Errorf("secret of %s does not open with the master key", accessKeyID)
+	}
+	return string(secret), nil
+}
+
+// SealCredentials encrypts every plaintext secret key in store, leaving
+// sealed ones alone, and returns how many it sealed. It is idempotent, so
+// it can run on every startup to migrate rows written before a master key
+// was configured.
+func SealCredentials(ctx context.Context, store MetadataStore, sealer *SecretSealer) (int, error) {
+	enum, ok := store.(Enumerator)
+	if !ok {
+		return 0, errors.New("metadata engine cannot list credentials")
+	}
+	creds, err := enum.ListCredentials(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("listing credentials: %w", err)
+	}
+	sealed := 0
+	for i := range creds {
+		cred := &creds[i]
+		if IsSealedSecret(cred.SecretKey) {
+			continue
+		}
+		if cred.SecretKey, err = sealer.Seal(cred.AccessKeyID, cred.SecretKey); err != nil {
+			return sealed, err
+		}
+		if err := store.PutCredential(ctx, cred); err != nil {
+			return sealed, fmt.Errorf("sealing credential %s: %w", cred.AccessKeyID, err)
+		}
+		sealed++
+	}
+	return sealed, nil
+}
@@ -0,0 +1,78 @@
+package metadata
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretSealer(t *testing.T) {
+	sealer, err := NewSecretSealer("master")
+	if err != nil {
+		t.Fatalf("NewSecretSealer: %v", err)
+	}
+	sealed, err := sealer.Seal("AK", "s3cret")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !IsSealedSecret(sealed) || strings.Contains(sealed, "s3cret") {
+		t.Fatalf("sealed = %q", sealed)
+	}
+	if again, _ := sealer.Seal("AK", "s3cret"); again == sealed {
+		t.Error("sealing twice gave the same ciphertext")
+	}
+	if got, err := sealer.Open("AK", sealed); err != nil || got != "s3cret" {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+
+	// A sealed secret only opens for its own access key, with the same
+	// master key.
+	if _, err := sealer.Open("OTHER", sealed); err == nil {
+		t.Error("opened under another access key")
+	}
+	other, _ := NewSecretSealer("other-master")
+	if _, err := other.Open("AK", sealed); err == nil {
+		t.Error("opened with another master key")
+	}
+	var none *SecretSealer
+	if _, err := none.Open("AK", sealed); err == nil {
+		t.Error("opened without a master key")
+	}
+
+	// Plaintext passes through either way.
+	if got, err := sealer.Open("AK", "plain"); err != nil || got != "plain" {
+		t.Errorf("Open(plaintext) = %q, %v", got, err)
+	}
+	if got, _ := none.Seal("AK", "plain"); got != "plain" {
+		t.Errorf("nil Seal = %q", got)
+	}
+	if _, err := NewSecretSealer(""); err == nil {
+		t.Error("empty master key accepted")
+	}
+}
+
+func TestSealCredentials(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	sealer, _ := NewSecretSealer("master")
+	for _, ak := range []string{"AK1", "AK2"} {
+		store.PutCredential(ctx, &CredentialRecord{AccessKeyID: ak, SecretKey: "secret-" + ak, OwnerID: ak, Active: true, CreatedAt: time.Now()})
+	}
+
+	if n, err := SealCredentials(ctx, store, sealer); err != nil || n != 2 {
+		t.Fatalf("SealCredentials = %d, %v; want 2", n, err)
+	}
+	for _, ak := range []string{"AK1", "AK2"} {
+		cred, _ := store.GetCredential(ctx, ak)
+		if got, err := sealer.Open(ak, cred.SecretKey); !IsSealedSecret(cred.SecretKey) || err != nil || got != "secret-"+ak {
+			t.Errorf("%s: stored %q opens to %q, %v", ak, cred.SecretKey, got, err)
+		}
+		if !cred.Active || cred.OwnerID != ak {
+			t.Errorf("%s: record changed: %+v", ak, cred)
+		}
+	}
+	if n, err := SealCredentials(ctx, store, sealer); err != nil || n != 0 {
+		t.Errorf("second SealCredentials = %d, %v; want 0", n, err)
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"sort"
+	"io/fs"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/bleepstore/bleepstore/internal/clock"
+	"github.com/bleepstore/bleepstore/internal/config"
 	_ "modernc.org/sqlite" // Pure-Go SQLite driver
 )
 
@@ -23,30 +27,128 @@ const (
 // backing database. It provides durable, ACID-compliant metadata storage
 // suitable for single-node deployments.
 type SQLiteStore struct {
-	db *sql.DB
+	db    *sql.DB // read-write pool
+	rdb   *sql.DB // read-only pool; the same as db when none is configured
+	stmts sqliteStmts
+	clock clock.Clock
+	path  string // database file, or "" for in-memory databases
+}
+
+// sqliteStmts are prepared statements for the hot per-request queries.
+// database/sql prepares each on every connection of its pool as needed.
+type sqliteStmts struct {
+	getObject    *sql.Stmt
+	putObject    *sql.Stmt
+	objectExists *sql.Stmt
+	listObjects  *sql.Stmt
 }
 
 // NewSQLiteStore creates a new SQLiteStore with the given DSN and initializes
 // the database schema.
 func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite", dsn)
+	return NewSQLiteStoreWithConfig(&config.SQLiteConfig{Path: dsn})
+}
+
+// NewSQLiteStoreWithConfig creates a SQLiteStore using the pool settings in
+// cfg and initializes the database schema.
+func NewSQLiteStoreWithConfig(cfg *config.SQLiteConfig) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(cfg.Path, false))
 	if err != nil {
 		return nil, fmt.Errorf("opening SQLite database: %w", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
 
-	s := &SQLiteStore{db: db}
+	s := &SQLiteStore{db: db, rdb: db, clock: clock.System{}}
+	if !strings.Contains(cfg.Path, ":memory:") {
+		s.path, _, _ = strings.Cut(strings.TrimPrefix(cfg.Path, "file:"), "?")
+	}
 	if err := s.initDB(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("initializing SQLite database: %w", err)
 	}
+
+	// An in-memory database is private to its connection, so it cannot
+	// be shared with a second pool.
+	if cfg.ReadConns > 0 && cfg.Path != "" && !strings.Contains(cfg.Path, ":memory:") {
+		rdb, err := sql.Open("sqlite", sqliteDSN(cfg.Path, true))
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("opening SQLite read pool: %w", err)
+		}
+		rdb.SetMaxOpenConns(cfg.ReadConns)
+		rdb.SetMaxIdleConns(cfg.ReadConns)
+		s.rdb = rdb
+	}
+
+	if err := s.prepare(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("preparing SQLite statements: %w", err)
+	}
 	return s, nil
 }
 
-// initDB applies PRAGMAs and creates the required tables and indexes.
-// This is safe to call multiple times (idempotent via IF NOT EXISTS).
+// sqliteDSN adds per-connection PRAGMAs to path. PRAGMAs issued with Exec
+// only reach one connection of the pool, so the ones every connection
+// needs are set through the DSN instead.
+func sqliteDSN(path string, readOnly bool) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	dsn := path + sep + "_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	if readOnly {
+		dsn += "&_pragma=query_only(1)"
+	}
+	return dsn
+}
+
+// prepare prepares the hot-path statements: writes on the read-write pool
+// and lookups on the read pool.
+func (s *SQLiteStore) prepare() error {
+	var err error
+	prep := func(db *sql.DB, query string) *sql.Stmt {
+		if err != nil {
+			return nil
+		}
+		var stmt *sql.Stmt
+		stmt, err = db.Prepare(query)
+		return stmt
+	}
+	s.stmts.putObject = prep(s.db, `INSERT OR REPLACE INTO objects
+			(bucket, key, size, etag, content_type, content_encoding, content_language,
+			 content_disposition, cache_control, expires, storage_class, acl,
+			 user_metadata, last_modified, delete_marker, part_sizes, compression,
+			 replication_status, website_redirect_location, inline_data)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	s.stmts.getObject = prep(s.rdb, `SELECT `+objectColumns+`, inline_data
+		 FROM objects WHERE bucket = ? AND key = ?`)
+	s.stmts.objectExists = prep(s.rdb, `SELECT COUNT(*) FROM objects WHERE bucket = ? AND key = ?`)
+	// Listings page through a key range: [prefix, prefix+"\xff") bounds the
+	// prefix (no valid UTF-8 key contains 0xFF), and key > ? resumes after
+	// the marker.
+	s.stmts.listObjects = prep(s.rdb, `SELECT `+objectColumns+`
+		 FROM objects WHERE bucket = ? AND key >= ? AND key < ? AND key > ?
+		 ORDER BY key LIMIT ?`)
+	return err
+}
+
+// objectColumns is the column list scanned by scanObjectRow(s).
+const objectColumns = `bucket, key, size, etag, content_type, content_encoding,
+				content_language, content_disposition, cache_control, expires,
+				storage_class, acl, user_metadata, last_modified, delete_marker, part_sizes,
+				compression, replication_status, website_redirect_location`
+
+// initDB applies PRAGMAs and migrates the schema to the latest version.
+// This is safe to call multiple times.
 func (s *SQLiteStore) initDB() error {
 	// Apply PRAGMAs for performance and correctness.
+	// auto_vacuum must be set before the first table is created; databases
+	// created without it need a one-off VACUUM before Vacuum has any effect.
 	pragmas := []string{
+		"PRAGMA auto_vacuum = INCREMENTAL",
 		"PRAGMA journal_mode = WAL",
 		"PRAGMA synchronous = NORMAL",
 		"PRAGMA foreign_keys = ON",
@@ -58,13 +160,21 @@ func (s *SQLiteStore) initDB() error {
 		}
 	}
 
-	// Create all tables and indexes.
-	schema := `
-		CREATE TABLE IF NOT EXISTS schema_version (
-			version    INTEGER PRIMARY KEY,
-			applied_at TEXT NOT NULL
-		);
+	if _, err := s.MigrateSchema(context.Background(), -1); err != nil {
+		return err
+	}
+	return nil
+}
 
+// sqliteMigrations is the SQLite schema history. Version 1 is the schema
+// that predates the migration runner; databases created before it already
+// record version 1 in schema_version.
+var sqliteMigrations = []SchemaMigration[*sql.Tx]{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
 		CREATE TABLE IF NOT EXISTS buckets (
 			name           TEXT PRIMARY KEY,
 			region         TEXT NOT NULL DEFAULT 'us-east-1',
@@ -140,22 +250,352 @@ func (s *SQLiteStore) initDB() error {
 			active        INTEGER NOT NULL DEFAULT 1,
 			created_at    TEXT NOT NULL
 		);
-	`
 
-	if _, err := s.db.Exec(schema); err != nil {
-		return fmt.Errorf("creating schema: %w", err)
+		CREATE TABLE IF NOT EXISTS usage (
+			access_key TEXT NOT NULL,
+			bucket     TEXT NOT NULL,
+			period     TEXT NOT NULL,
+			requests   INTEGER NOT NULL DEFAULT 0,
+			bytes_in   INTEGER NOT NULL DEFAULT 0,
+			bytes_out  INTEGER NOT NULL DEFAULT 0,
+
+			PRIMARY KEY (access_key, bucket, period)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_usage_period ON usage(period);
+
+		CREATE TABLE IF NOT EXISTS defrag_queue (
+			bucket      TEXT NOT NULL,
+			key         TEXT NOT NULL,
+			etag        TEXT NOT NULL,
+			enqueued_at TEXT NOT NULL,
+
+			PRIMARY KEY (bucket, key)
+		);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			for _, table := range []string{"defrag_queue", "usage", "credentials", "multipart_parts",
+				"multipart_uploads", "objects", "buckets"} {
+				if _, err := tx.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "inline_data",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`ALTER TABLE objects ADD COLUMN inline_data BLOB`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`ALTER TABLE objects DROP COLUMN inline_data`)
+			return err
+		},
+	},
+	{
+		Version: 3,
+		Name:    "part_sizes",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`ALTER TABLE objects ADD COLUMN part_sizes TEXT`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`ALTER TABLE objects DROP COLUMN part_sizes`)
+			return err
+		},
+	},
+	{
+		Version: 4,
+		Name:    "compression",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`ALTER TABLE objects ADD COLUMN compression TEXT`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`ALTER TABLE objects DROP COLUMN compression`)
+			return err
+		},
+	},
+	{
+		Version: 5,
+		Name:    "bucket_replication",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		ALTER TABLE objects ADD COLUMN replication_status TEXT;
+
+		CREATE TABLE IF NOT EXISTS bucket_replication (
+			bucket TEXT PRIMARY KEY,
+			config BLOB NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS replication_queue (
+			bucket          TEXT NOT NULL,
+			key             TEXT NOT NULL,
+			is_delete       INTEGER NOT NULL DEFAULT 0,
+			etag            TEXT NOT NULL,
+			enqueued_at     TEXT NOT NULL,
+			attempts        INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TEXT NOT NULL,
+			last_error      TEXT NOT NULL DEFAULT '',
+
+			PRIMARY KEY (bucket, key)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_replication_queue_due ON replication_queue(next_attempt_at);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		DROP TABLE IF EXISTS replication_queue;
+		DROP TABLE IF EXISTS bucket_replication;
+		ALTER TABLE objects DROP COLUMN replication_status;
+			`)
+			return err
+		},
+	},
+	{
+		Version: 6,
+		Name:    "leases",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS leases (
+			name       TEXT PRIMARY KEY,
+			holder     TEXT NOT NULL,
+			expires_at TEXT NOT NULL
+		);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE IF EXISTS leases;`)
+			return err
+		},
+	},
+	{
+		Version: 7,
+		Name:    "bucket_inventory",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS bucket_inventory (
+			bucket   TEXT NOT NULL,
+			id       TEXT NOT NULL,
+			config   BLOB NOT NULL,
+			last_run TEXT NOT NULL DEFAULT '',
+
+			PRIMARY KEY (bucket, id)
+		);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE IF EXISTS bucket_inventory;`)
+			return err
+		},
+	},
+	{
+		Version: 8,
+		Name:    "object_names",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS object_names (
+			bucket TEXT NOT NULL,
+			name   TEXT NOT NULL,
+			key    TEXT NOT NULL,
+
+			PRIMARY KEY (bucket, name)
+		);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE IF EXISTS object_names;`)
+			return err
+		},
+	},
+	{
+		Version: 9,
+		Name:    "erasure_requests",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS erasure_requests (
+			id         TEXT PRIMARY KEY,
+			created_at TEXT NOT NULL,
+			state      TEXT NOT NULL,
+			spec       BLOB NOT NULL,
+			report     BLOB
+		);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE IF EXISTS erasure_requests;`)
+			return err
+		},
+	},
+	{
+		Version: 10,
+		Name:    "bucket_freezes",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS bucket_freezes (
+			bucket    TEXT PRIMARY KEY,
+			frozen_at TEXT NOT NULL,
+			reason    TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (bucket) REFERENCES buckets(name) ON DELETE CASCADE
+		);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE IF EXISTS bucket_freezes;`)
+			return err
+		},
+	},
+	{
+		Version: 11,
+		Name:    "rate_limit_state",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS rate_limit_state (
+			scope      TEXT NOT NULL,
+			id         TEXT NOT NULL,
+			tokens     REAL NOT NULL,
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY (scope, id)
+		);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE IF EXISTS rate_limit_state;`)
+			return err
+		},
+	},
+	{
+		Version: 12,
+		Name:    "website_redirect_location",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		ALTER TABLE objects ADD COLUMN website_redirect_location TEXT;
+		ALTER TABLE multipart_uploads ADD COLUMN website_redirect_location TEXT;
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		ALTER TABLE multipart_uploads DROP COLUMN website_redirect_location;
+		ALTER TABLE objects DROP COLUMN website_redirect_location;
+			`)
+			return err
+		},
+	},
+	{
+		Version: 13,
+		Name:    "bucket_website",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS bucket_website (
+			bucket TEXT PRIMARY KEY,
+			config BLOB NOT NULL,
+			FOREIGN KEY (bucket) REFERENCES buckets(name) ON DELETE CASCADE
+		);
+			`)
+			return err
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE IF EXISTS bucket_website;`)
+			return err
+		},
+	},
+}
+
+// schemaTarget records applied migrations in the schema_version table.
+func (s *SQLiteStore) schemaTarget(ctx context.Context) schemaTarget[*sql.Tx] {
+	return schemaTarget[*sql.Tx]{
+		update: func(fn func(tx *sql.Tx) error) error {
+			tx, err := s.db.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(tx); err != nil {
+				tx.Rollback()
+				return err
+			}
+			return tx.Commit()
+		},
+		version: func(tx *sql.Tx) (int, error) {
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+				version    INTEGER PRIMARY KEY,
+				applied_at TEXT NOT NULL
+			)`)
+			if err != nil {
+				return 0, err
+			}
+			var version int
+			err = tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+			return version, err
+		},
+		record: func(tx *sql.Tx, version int, applied bool) error {
+			if !applied {
+				_, err := tx.Exec("DELETE FROM schema_version WHERE version = ?", version)
+				return err
+			}
+			_, err := tx.Exec("INSERT OR REPLACE INTO schema_version (version, applied_at) VALUES (?, ?)",
+				version, s.clock.Now().UTC().Format(timeFormat))
+			return err
+		},
 	}
+}
 
-	// Insert initial schema version if not present.
-	_, err := s.db.Exec(
-		`INSERT OR IGNORE INTO schema_version (version, applied_at) VALUES (1, ?)`,
-		time.Now().UTC().Format(timeFormat),
-	)
+// SchemaVersion returns the applied and latest SQLite schema versions.
+func (s *SQLiteStore) SchemaVersion(ctx context.Context) (current, latest int, err error) {
+	err = s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
 	if err != nil {
-		return fmt.Errorf("inserting schema version: %w", err)
+		return 0, 0, fmt.Errorf("reading schema version: %w", err)
 	}
+	return current, len(sqliteMigrations), nil
+}
 
-	return nil
+// InspectSQLiteSchema reads the schema version of the SQLite database at
+// path without opening it for writing or migrating it. A database that does
+// not exist yet is reported at version 0.
+func InspectSQLiteSchema(ctx context.Context, path string) (*SchemaStatus, error) {
+	file, _, _ := strings.Cut(strings.TrimPrefix(path, "file:"), "?")
+	if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		return schemaStatus(false, 0, sqliteMigrations), nil
+	} else if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(path, true))
+	if err != nil {
+		return nil, fmt.Errorf("opening SQLite database: %w", err)
+	}
+	defer db.Close()
+
+	var current, tables int
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&tables)
+	if err == nil && tables > 0 {
+		err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading schema version: %w", err)
+	}
+	return schemaStatus(true, current, sqliteMigrations), nil
+}
+
+// MigrateSchema migrates the SQLite schema to target (-1 = latest).
+func (s *SQLiteStore) MigrateSchema(ctx context.Context, target int) (int, error) {
+	version, err := migrateSchema(s.schemaTarget(ctx), sqliteMigrations, target)
+	if err != nil {
+		return version, fmt.Errorf("migrating SQLite schema: %w", err)
+	}
+	return version, nil
 }
 
 // Ping checks connectivity to the SQLite database.
@@ -163,8 +603,78 @@ func (s *SQLiteStore) Ping(ctx context.Context) error {
 	return s.db.PingContext(ctx)
 }
 
+// SetClock replaces the clock used for default timestamps and upload
+// expiry.
+func (s *SQLiteStore) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Checkpoint runs wal_checkpoint(TRUNCATE), copying every WAL frame into
+// the database and truncating the WAL file to zero bytes. Without it the WAL
+// only shrinks when the last connection closes.
+func (s *SQLiteStore) Checkpoint(ctx context.Context) error {
+	var busy, logFrames, checkpointed int
+	err := s.db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		return fmt.Errorf("checkpointing WAL: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("checkpointing WAL: blocked by an active reader or writer (%d of %d frames copied)", checkpointed, logFrames)
+	}
+	return nil
+}
+
+// Vacuum runs incremental_vacuum, releasing up to pages pages from the
+// freelist (0 = all).
+func (s *SQLiteStore) Vacuum(ctx context.Context, pages int) error {
+	// The pragma frees one page per step, so its rows must be drained.
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("PRAGMA incremental_vacuum(%d)", pages))
+	if err != nil {
+		return fmt.Errorf("incremental vacuum: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("incremental vacuum: %w", err)
+	}
+	return nil
+}
+
+// Analyze runs ANALYZE so the query planner sees current table and index
+// statistics.
+func (s *SQLiteStore) Analyze(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "ANALYZE"); err != nil {
+		return fmt.Errorf("analyzing database: %w", err)
+	}
+	return nil
+}
+
+// WALSize returns the size of the -wal file, or 0 when it does not exist.
+func (s *SQLiteStore) WALSize() (int64, error) {
+	if s.path == "" {
+		return 0, nil
+	}
+	info, err := os.Stat(s.path + "-wal")
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("stat WAL: %w", err)
+	}
+	return info.Size(), nil
+}
+
 // Close closes the underlying SQLite database connection.
 func (s *SQLiteStore) Close() error {
+	for _, stmt := range []*sql.Stmt{s.stmts.getObject, s.stmts.putObject, s.stmts.objectExists, s.stmts.listObjects} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	if s.rdb != nil && s.rdb != s.db {
+		s.rdb.Close()
+	}
 	if s.db != nil {
 		return s.db.Close()
 	}
@@ -265,16 +775,37 @@ func (s *SQLiteStore) DeleteBucket(ctx context.Context, name string) error {
 	if err != nil {
 		return fmt.Errorf("deleting bucket %q: %w", name, err)
 	}
+	if err := s.DeleteBucketReplication(ctx, name); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM bucket_inventory WHERE bucket = ?`, name)
+	if err != nil {
+		return fmt.Errorf("deleting inventory of %q: %w", name, err)
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM object_names WHERE bucket = ?`, name)
+	if err != nil {
+		return fmt.Errorf("deleting object names of %q: %w", name, err)
+	}
 	return nil
 }
 
 // ListBuckets returns all buckets owned by the given owner.
 func (s *SQLiteStore) ListBuckets(ctx context.Context, owner string) ([]BucketRecord, error) {
+	return s.queryBuckets(ctx, `WHERE owner_id = ?`, owner)
+}
+
+// ListAllBuckets returns every bucket regardless of owner.
+func (s *SQLiteStore) ListAllBuckets(ctx context.Context) ([]BucketRecord, error) {
+	return s.queryBuckets(ctx, "")
+}
+
+// queryBuckets returns the buckets matching an optional WHERE clause, ordered by name.
+func (s *SQLiteStore) queryBuckets(ctx context.Context, where string, args ...interface{}) ([]BucketRecord, error) {
 	rows, err := s.db.QueryContext(ctx,
 		`SELECT name, region, owner_id, owner_display, acl, created_at
-		 FROM buckets WHERE owner_id = ?
+		 FROM buckets `+where+`
 		 ORDER BY name`,
-		owner,
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("listing buckets: %w", err)
@@ -333,11 +864,30 @@ func (s *SQLiteStore) UpdateBucketAcl(ctx context.Context, name string, acl json
 
 // PutObject creates or replaces the metadata for an object.
 func (s *SQLiteStore) PutObject(ctx context.Context, obj *ObjectRecord) error {
+	args, err := objectRowArgs(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := s.stmts.putObject.ExecContext(ctx, args...); err != nil {
+		return fmt.Errorf("putting object %q/%q: %w", obj.Bucket, obj.Key, err)
+	}
+	return nil
+}
+
+// objectRowColumns are the objects columns after bucket and key, in the
+// order of the putObject statement.
+var objectRowColumns = []string{"size", "etag", "content_type", "content_encoding", "content_language",
+	"content_disposition", "cache_control", "expires", "storage_class", "acl",
+	"user_metadata", "last_modified", "delete_marker", "part_sizes", "compression",
+	"replication_status", "website_redirect_location", "inline_data"}
+
+// objectRowArgs returns the putObject statement arguments for obj.
+func objectRowArgs(obj *ObjectRecord) ([]any, error) {
 	userMeta := "{}"
 	if obj.UserMetadata != nil {
 		b, err := json.Marshal(obj.UserMetadata)
 		if err != nil {
-			return fmt.Errorf("marshaling user metadata: %w", err)
+			return nil, fmt.Errorf("marshaling user metadata: %w", err)
 		}
 		userMeta = string(b)
 	}
@@ -362,12 +912,7 @@ func (s *SQLiteStore) PutObject(ctx context.Context, obj *ObjectRecord) error {
 		deleteMarker = 1
 	}
 
-	_, err := s.db.ExecContext(ctx,
-		`INSERT OR REPLACE INTO objects
-			(bucket, key, size, etag, content_type, content_encoding, content_language,
-			 content_disposition, cache_control, expires, storage_class, acl,
-			 user_metadata, last_modified, delete_marker)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	return []any{
 		obj.Bucket,
 		obj.Key,
 		obj.Size,
@@ -383,24 +928,64 @@ func (s *SQLiteStore) PutObject(ctx context.Context, obj *ObjectRecord) error {
 		userMeta,
 		obj.LastModified.UTC().Format(timeFormat),
 		deleteMarker,
-	)
+		nullString(encodePartSizes(obj.PartSizes)),
+		nullString(obj.Compression),
+		nullString(obj.ReplicationStatus),
+		nullString(obj.WebsiteRedirectLocation),
+		inlineBlob(obj.InlineData),
+	}, nil
+}
+
+// PutObjectIf writes obj if the current record meets cond. The condition
+// is part of the single statement writing the row, so it holds when the
+// row is written.
+func (s *SQLiteStore) PutObjectIf(ctx context.Context, obj *ObjectRecord, cond WriteCondition) error {
+	args, err := objectRowArgs(obj)
+	if err != nil {
+		return err
+	}
+	var query string
+	switch {
+	case cond.IfNoneMatch && cond.IfMatch != "":
+		return ErrPreconditionFailed
+	case cond.IfMatch != "":
+		// Only an existing row is updated.
+		sets := make([]string, len(objectRowColumns))
+		for i, c := range objectRowColumns {
+			sets[i] = c + " = ?"
+		}
+		query = `UPDATE objects SET ` + strings.Join(sets, ", ") + `
+			WHERE bucket = ? AND key = ? AND delete_marker = 0 AND (? = '*' OR trim(etag, '"') = ?)`
+		match := strings.Trim(cond.IfMatch, `"`)
+		args = append(args[2:], obj.Bucket, obj.Key, match, match)
+	case cond.IfNoneMatch:
+		// A conflicting row is only replaced if it is a delete marker.
+		sets := make([]string, len(objectRowColumns))
+		for i, c := range objectRowColumns {
+			sets[i] = c + " = excluded." + c
+		}
+		query = `INSERT INTO objects (bucket, key, ` + strings.Join(objectRowColumns, ", ") + `)
+			VALUES (?` + strings.Repeat(", ?", len(objectRowColumns)+1) + `)
+			ON CONFLICT (bucket, key) DO UPDATE SET ` + strings.Join(sets, ", ") + `
+			WHERE objects.delete_marker = 1`
+	default:
+		return s.PutObject(ctx, obj)
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("putting object %q/%q: %w", obj.Bucket, obj.Key, err)
 	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrPreconditionFailed
+	}
 	return nil
 }
 
 // GetObject retrieves object metadata by bucket and key.
 func (s *SQLiteStore) GetObject(ctx context.Context, bucket, key string) (*ObjectRecord, error) {
-	row := s.db.QueryRowContext(ctx,
-		`SELECT bucket, key, size, etag, content_type, content_encoding,
-				content_language, content_disposition, cache_control, expires,
-				storage_class, acl, user_metadata, last_modified, delete_marker
-		 FROM objects WHERE bucket = ? AND key = ?`,
-		bucket, key,
-	)
-
-	obj, err := scanObjectRow(row)
+	obj, err := scanObjectRow(s.stmts.getObject.QueryRowContext(ctx, bucket, key))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -410,6 +995,9 @@ func (s *SQLiteStore) GetObject(ctx context.Context, bucket, key string) (*Objec
 	return obj, nil
 }
 
+// SupportsInlineData reports that SQLite stores inline object payloads.
+func (s *SQLiteStore) SupportsInlineData() bool { return true }
+
 // DeleteObject removes object metadata by bucket and key.
 func (s *SQLiteStore) DeleteObject(ctx context.Context, bucket, key string) error {
 	_, err := s.db.ExecContext(ctx,
@@ -425,57 +1013,75 @@ func (s *SQLiteStore) DeleteObject(ctx context.Context, bucket, key string) erro
 // ObjectExists checks whether the named object exists.
 func (s *SQLiteStore) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
 	var count int
-	err := s.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM objects WHERE bucket = ? AND key = ?`,
-		bucket, key,
-	).Scan(&count)
+	err := s.stmts.objectExists.QueryRowContext(ctx, bucket, key).Scan(&count)
 	if err != nil {
 		return false, fmt.Errorf("checking object existence %q/%q: %w", bucket, key, err)
 	}
 	return count > 0, nil
 }
 
-// DeleteObjectsMeta removes metadata for multiple objects using batch SQL.
-// Returns the list of keys that were successfully deleted and any errors.
-// Uses batches of 998 keys to stay within SQLite's 999-variable limit.
+// sqliteMaxVariables is SQLite's default limit on bound parameters per
+// statement (SQLITE_MAX_VARIABLE_NUMBER in builds before 3.32).
+const sqliteMaxVariables = 999
+
+// DeleteObjectsMeta removes metadata for multiple objects in one transaction,
+// using multi-value DELETE ... IN statements chunked to stay within SQLite's
+// parameter limit. The batch is all-or-nothing: on error no keys are deleted
+// and the returned errors describe the failure.
 func (s *SQLiteStore) DeleteObjectsMeta(ctx context.Context, bucket string, keys []string) ([]string, []error) {
 	if len(keys) == 0 {
 		return nil, nil
 	}
 
-	var deleted []string
-	var errs []error
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, []error{fmt.Errorf("beginning transaction: %w", err)}
+	}
+	defer tx.Rollback()
 
-	const batchSize = 998 // SQLite 999-variable limit minus 1 for bucket
+	const batchSize = sqliteMaxVariables - 1 // one variable is the bucket
 
+	// Full chunks share one prepared statement; only the final partial
+	// chunk needs its own.
+	var full *sql.Stmt
 	for i := 0; i < len(keys); i += batchSize {
-		end := i + batchSize
-		if end > len(keys) {
-			end = len(keys)
-		}
-		batch := keys[i:end]
+		batch := keys[i:min(i+batchSize, len(keys))]
 
-		// Build DELETE ... WHERE bucket=? AND key IN (?,?,...)
-		placeholders := make([]string, len(batch))
 		args := make([]interface{}, 0, len(batch)+1)
 		args = append(args, bucket)
-		for j, key := range batch {
-			placeholders[j] = "?"
+		for _, key := range batch {
 			args = append(args, key)
 		}
 
-		query := `DELETE FROM objects WHERE bucket = ? AND key IN (` + strings.Join(placeholders, ",") + `)`
-		_, err := s.db.ExecContext(ctx, query, args...)
+		if len(batch) == batchSize {
+			if full == nil {
+				full, err = tx.PrepareContext(ctx, deleteObjectsQuery(batchSize))
+				if err != nil {
+					return nil, []error{fmt.Errorf("preparing batch delete: %w", err)}
+				}
+				defer full.Close()
+			}
+			_, err = full.ExecContext(ctx, args...)
+		} else {
+			_, err = tx.ExecContext(ctx, deleteObjectsQuery(len(batch)), args...)
+		}
 		if err != nil {
-			errs = append(errs, fmt.Errorf("batch deleting keys: %w", err))
-			continue
+			return nil, []error{fmt.Errorf("batch deleting keys: %w", err)}
 		}
+	}
 
-		// S3 reports deletion even if the key didn't exist.
-		deleted = append(deleted, batch...)
+	if err := tx.Commit(); err != nil {
+		return nil, []error{fmt.Errorf("committing batch delete: %w", err)}
 	}
 
-	return deleted, errs
+	// S3 reports deletion even if the key didn't exist.
+	return keys, nil
+}
+
+// deleteObjectsQuery returns DELETE ... WHERE bucket = ? AND key IN (?,...)
+// for n keys.
+func deleteObjectsQuery(n int) string {
+	return `DELETE FROM objects WHERE bucket = ? AND key IN (?` + strings.Repeat(",?", n-1) + `)`
 }
 
 // UpdateObjectAcl updates the ACL for the specified object.
@@ -513,29 +1119,12 @@ func (s *SQLiteStore) ListObjects(ctx context.Context, bucket string, opts ListO
 		startAfter = opts.Marker
 	}
 
-	// Build query: select all keys matching prefix, after the start key.
-	var args []interface{}
-	query := `SELECT bucket, key, size, etag, content_type, content_encoding,
-					 content_language, content_disposition, cache_control, expires,
-					 storage_class, acl, user_metadata, last_modified, delete_marker
-			  FROM objects WHERE bucket = ?`
-	args = append(args, bucket)
-
-	if opts.Prefix != "" {
-		query += ` AND key LIKE ? || '%' ESCAPE '\'`
-		args = append(args, escapeLikePattern(opts.Prefix))
-	}
-
-	if startAfter != "" {
-		query += ` AND key > ?`
-		args = append(args, startAfter)
+	if opts.Delimiter != "" {
+		return s.listObjectsDelimited(ctx, bucket, opts.Prefix, opts.Delimiter, startAfter, maxKeys)
 	}
 
-	query += ` ORDER BY key`
 	// Fetch one extra to determine truncation.
-	query += fmt.Sprintf(` LIMIT %d`, maxKeys+1)
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.stmts.listObjects.QueryContext(ctx, bucket, opts.Prefix, opts.Prefix+"\xff", startAfter, maxKeys+1)
 	if err != nil {
 		return nil, fmt.Errorf("listing objects in %q: %w", bucket, err)
 	}
@@ -553,126 +1142,89 @@ func (s *SQLiteStore) ListObjects(ctx context.Context, bucket string, opts ListO
 		return nil, fmt.Errorf("iterating object rows: %w", err)
 	}
 
-	// If no delimiter, return directly.
-	if opts.Delimiter == "" {
-		isTruncated := len(allObjects) > maxKeys
-		if isTruncated {
-			allObjects = allObjects[:maxKeys]
-		}
-		result := &ListObjectsResult{
-			Objects:     allObjects,
-			IsTruncated: isTruncated,
-		}
-		if isTruncated && len(allObjects) > 0 {
-			lastKey := allObjects[len(allObjects)-1].Key
-			result.NextMarker = lastKey
-			result.NextContinuationToken = lastKey
-		}
-		return result, nil
+	isTruncated := len(allObjects) > maxKeys
+	if isTruncated {
+		allObjects = allObjects[:maxKeys]
 	}
-
-	// With delimiter: group into objects and common prefixes.
-	var objects []ObjectRecord
-	prefixSet := make(map[string]bool)
-
-	for _, obj := range allObjects {
-		// Get the part of the key after the prefix.
-		keyAfterPrefix := obj.Key
-		if opts.Prefix != "" {
-			keyAfterPrefix = obj.Key[len(opts.Prefix):]
-		}
-
-		// Find delimiter in the key after the prefix.
-		delimIdx := strings.Index(keyAfterPrefix, opts.Delimiter)
-		if delimIdx >= 0 {
-			// This key has the delimiter: it becomes a common prefix.
-			commonPrefix := opts.Prefix + keyAfterPrefix[:delimIdx+len(opts.Delimiter)]
-			prefixSet[commonPrefix] = true
-		} else {
-			objects = append(objects, obj)
-		}
+	result := &ListObjectsResult{
+		Objects:     allObjects,
+		IsTruncated: isTruncated,
 	}
-
-	// Sort common prefixes.
-	var commonPrefixes []string
-	for p := range prefixSet {
-		commonPrefixes = append(commonPrefixes, p)
+	if isTruncated && len(allObjects) > 0 {
+		lastKey := allObjects[len(allObjects)-1].Key
+		result.NextMarker = lastKey
+		result.NextContinuationToken = lastKey
 	}
-	sort.Strings(commonPrefixes)
-
-	// Count total entries (objects + prefixes) and truncate if needed.
-	totalEntries := len(objects) + len(commonPrefixes)
-	isTruncated := totalEntries > maxKeys
-
-	// Merge objects and prefixes to determine the correct truncation point.
-	// We need to interleave them by key order and take only maxKeys.
-	if isTruncated {
-		// Simple approach: merge all keys (object keys + prefix keys), sort, take maxKeys.
-		type entry struct {
-			key      string
-			isPrefix bool
-		}
-		var entries []entry
-		for _, obj := range objects {
-			entries = append(entries, entry{key: obj.Key, isPrefix: false})
-		}
-		for _, p := range commonPrefixes {
-			entries = append(entries, entry{key: p, isPrefix: true})
-		}
-		sort.Slice(entries, func(i, j int) bool {
-			return entries[i].key < entries[j].key
-		})
+	return result, nil
+}
 
-		// Take maxKeys entries.
-		if len(entries) > maxKeys {
-			entries = entries[:maxKeys]
+// listObjectsDelimited lists a page of a delimiter listing. It walks the
+// keys in order through the listObjects range statement, and on reaching a
+// key that rolls up into a common prefix, records the prefix and seeks past
+// every key under it, so a page reads about one row per entry however many
+// keys each prefix holds.
+func (s *SQLiteStore) listObjectsDelimited(ctx context.Context, bucket, prefix, delimiter, startAfter string, maxKeys int) (*ListObjectsResult, error) {
+	result := &ListObjectsResult{}
+	entries := 0
+	after := startAfter
+	for {
+		// The lower bound doubles as the seek position: SQLite walks the
+		// index from key >= ?, and only filters by key > ?.
+		limit := maxKeys + 1 - entries
+		rows, err := s.stmts.listObjects.QueryContext(ctx, bucket, max(prefix, after), prefix+"\xff", after, limit)
+		if err != nil {
+			return nil, fmt.Errorf("listing objects in %q: %w", bucket, err)
 		}
-
-		// Separate back.
-		objects = nil
-		prefixSet = make(map[string]bool)
-		for _, e := range entries {
-			if e.isPrefix {
-				prefixSet[e.key] = true
-			} else {
-				// Re-find the object.
-				for _, obj := range allObjects {
-					if obj.Key == e.key {
-						objects = append(objects, obj)
-						break
-					}
+		n, seek := 0, ""
+		for rows.Next() {
+			n++
+			obj, err := scanObjectRows(rows)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scanning object row: %w", err)
+			}
+			entry := obj.Key
+			if i := strings.Index(obj.Key[len(prefix):], delimiter); i >= 0 {
+				entry = obj.Key[:len(prefix)+i+len(delimiter)]
+				// No key holds the byte 0xff, so every key under the
+				// common prefix sorts below entry+"\xff".
+				seek = entry + "\xff"
+			}
+			// Keys after a marker that is itself a common prefix still
+			// roll up to it, so the marker applies to entries as well.
+			if entry > startAfter {
+				if entries == maxKeys {
+					result.IsTruncated = true
+					break
 				}
+				entries++
+				if seek != "" {
+					result.CommonPrefixes = append(result.CommonPrefixes, entry)
+				} else {
+					result.Objects = append(result.Objects, *obj)
+				}
+				result.NextMarker = entry
 			}
+			if seek != "" {
+				break
+			}
+			after = obj.Key
 		}
-		commonPrefixes = nil
-		for p := range prefixSet {
-			commonPrefixes = append(commonPrefixes, p)
-		}
-		sort.Strings(commonPrefixes)
-	}
-
-	result := &ListObjectsResult{
-		Objects:        objects,
-		CommonPrefixes: commonPrefixes,
-		IsTruncated:    isTruncated,
-	}
-	if isTruncated {
-		// NextMarker is the last key in the combined set.
-		var lastKey string
-		if len(objects) > 0 {
-			lastKey = objects[len(objects)-1].Key
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("iterating object rows: %w", err)
 		}
-		if len(commonPrefixes) > 0 {
-			lastPrefix := commonPrefixes[len(commonPrefixes)-1]
-			if lastPrefix > lastKey {
-				lastKey = lastPrefix
-			}
+		switch {
+		case result.IsTruncated:
+			result.NextContinuationToken = result.NextMarker
+			return result, nil
+		case seek != "":
+			after = seek
+		case n < limit:
+			result.NextMarker = ""
+			return result, nil
 		}
-		result.NextMarker = lastKey
-		result.NextContinuationToken = lastKey
 	}
-
-	return result, nil
 }
 
 // ---- Multipart upload operations ----
@@ -723,8 +1275,8 @@ func (s *SQLiteStore) CreateMultipartUpload(ctx context.Context, upload *Multipa
 		`INSERT INTO multipart_uploads
 			(upload_id, bucket, key, content_type, content_encoding, content_language,
 			 content_disposition, cache_control, expires, storage_class, acl,
-			 user_metadata, owner_id, owner_display, initiated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			 user_metadata, owner_id, owner_display, initiated_at, website_redirect_location)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		uploadID,
 		upload.Bucket,
 		upload.Key,
@@ -740,6 +1292,7 @@ func (s *SQLiteStore) CreateMultipartUpload(ctx context.Context, upload *Multipa
 		upload.OwnerID,
 		upload.OwnerDisplay,
 		upload.InitiatedAt.UTC().Format(timeFormat),
+		nullString(upload.WebsiteRedirectLocation),
 	)
 	if err != nil {
 		return "", fmt.Errorf("creating multipart upload: %w", err)
@@ -752,14 +1305,15 @@ func (s *SQLiteStore) GetMultipartUpload(ctx context.Context, bucket, key, uploa
 	row := s.db.QueryRowContext(ctx,
 		`SELECT upload_id, bucket, key, content_type, content_encoding,
 				content_language, content_disposition, cache_control, expires,
-				storage_class, acl, user_metadata, owner_id, owner_display, initiated_at
+				storage_class, acl, user_metadata, owner_id, owner_display, initiated_at,
+				website_redirect_location
 		 FROM multipart_uploads
 		 WHERE upload_id = ? AND bucket = ? AND key = ?`,
 		uploadID, bucket, key,
 	)
 
 	var u MultipartUploadRecord
-	var contentEncoding, contentLanguage, contentDisposition, cacheControl, expires sql.NullString
+	var contentEncoding, contentLanguage, contentDisposition, cacheControl, expires, redirect sql.NullString
 	var aclStr, userMetaStr, initiatedAtStr string
 
 	err := row.Scan(
@@ -767,7 +1321,7 @@ func (s *SQLiteStore) GetMultipartUpload(ctx context.Context, bucket, key, uploa
 		&contentEncoding, &contentLanguage, &contentDisposition,
 		&cacheControl, &expires,
 		&u.StorageClass, &aclStr, &userMetaStr,
-		&u.OwnerID, &u.OwnerDisplay, &initiatedAtStr,
+		&u.OwnerID, &u.OwnerDisplay, &initiatedAtStr, &redirect,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -781,6 +1335,7 @@ func (s *SQLiteStore) GetMultipartUpload(ctx context.Context, bucket, key, uploa
 	u.ContentDisposition = contentDisposition.String
 	u.CacheControl = cacheControl.String
 	u.Expires = expires.String
+	u.WebsiteRedirectLocation = redirect.String
 	u.ACL = json.RawMessage(aclStr)
 	u.InitiatedAt, _ = time.Parse(timeFormat, initiatedAtStr)
 
@@ -943,13 +1498,16 @@ func (s *SQLiteStore) CompleteMultipartUpload(ctx context.Context, bucket, key,
 		`INSERT OR REPLACE INTO objects
 			(bucket, key, size, etag, content_type, content_encoding, content_language,
 			 content_disposition, cache_control, expires, storage_class, acl,
-			 user_metadata, last_modified, delete_marker)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			 user_metadata, last_modified, delete_marker, part_sizes, replication_status,
+			 website_redirect_location)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		obj.Bucket, obj.Key, obj.Size, obj.ETag, contentType,
 		nullString(obj.ContentEncoding), nullString(obj.ContentLanguage),
 		nullString(obj.ContentDisposition), nullString(obj.CacheControl),
 		nullString(obj.Expires), storageClass, acl, userMeta,
 		obj.LastModified.UTC().Format(timeFormat), deleteMarker,
+		nullString(encodePartSizes(obj.PartSizes)), nullString(obj.ReplicationStatus),
+		nullString(obj.WebsiteRedirectLocation),
 	)
 	if err != nil {
 		return fmt.Errorf("inserting object during completion: %w", err)
@@ -1022,7 +1580,8 @@ func (s *SQLiteStore) ListMultipartUploads(ctx context.Context, bucket string, o
 	var args []interface{}
 	query := `SELECT upload_id, bucket, key, content_type, content_encoding,
 					 content_language, content_disposition, cache_control, expires,
-					 storage_class, acl, user_metadata, owner_id, owner_display, initiated_at
+					 storage_class, acl, user_metadata, owner_id, owner_display, initiated_at,
+					 website_redirect_location
 			  FROM multipart_uploads WHERE bucket = ?`
 	args = append(args, bucket)
 
@@ -1053,7 +1612,7 @@ func (s *SQLiteStore) ListMultipartUploads(ctx context.Context, bucket string, o
 	var uploads []MultipartUploadRecord
 	for rows.Next() {
 		var u MultipartUploadRecord
-		var contentEncoding, contentLanguage, contentDisposition, cacheControl, expires sql.NullString
+		var contentEncoding, contentLanguage, contentDisposition, cacheControl, expires, redirect sql.NullString
 		var aclStr, userMetaStr, initiatedAtStr string
 
 		if err := rows.Scan(
@@ -1061,7 +1620,7 @@ func (s *SQLiteStore) ListMultipartUploads(ctx context.Context, bucket string, o
 			&contentEncoding, &contentLanguage, &contentDisposition,
 			&cacheControl, &expires,
 			&u.StorageClass, &aclStr, &userMetaStr,
-			&u.OwnerID, &u.OwnerDisplay, &initiatedAtStr,
+			&u.OwnerID, &u.OwnerDisplay, &initiatedAtStr, &redirect,
 		); err != nil {
 			return nil, fmt.Errorf("scanning upload row: %w", err)
 		}
@@ -1071,6 +1630,7 @@ func (s *SQLiteStore) ListMultipartUploads(ctx context.Context, bucket string, o
 		u.ContentDisposition = contentDisposition.String
 		u.CacheControl = cacheControl.String
 		u.Expires = expires.String
+		u.WebsiteRedirectLocation = redirect.String
 		u.ACL = json.RawMessage(aclStr)
 		u.InitiatedAt, _ = time.Parse(timeFormat, initiatedAtStr)
 
@@ -1114,11 +1674,13 @@ func (s *SQLiteStore) ReapExpiredUploads(ttlSeconds int) ([]ExpiredUpload, error
 	}
 	defer tx.Rollback()
 
-	// Find expired uploads.
+	// Find expired uploads. Timestamps are stored in timeFormat, so the
+	// cutoff is compared in the same format.
+	cutoff := s.clock.Now().Add(-time.Duration(ttlSeconds) * time.Second).UTC().Format(timeFormat)
 	rows, err := tx.Query(
 		`SELECT upload_id, bucket, key FROM multipart_uploads
-		 WHERE initiated_at < datetime('now', '-' || ? || ' seconds')`,
-		ttlSeconds,
+		 WHERE initiated_at < ?`,
+		cutoff,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("querying expired uploads: %w", err)
@@ -1180,6 +1742,35 @@ func (s *SQLiteStore) GetCredential(ctx context.Context, accessKeyID string) (*C
 	return &c, nil
 }
 
+// ListCredentials returns every credential record, including inactive ones.
+func (s *SQLiteStore) ListCredentials(ctx context.Context) ([]CredentialRecord, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT access_key_id, secret_key, owner_id, display_name, active, created_at
+		 FROM credentials ORDER BY access_key_id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var creds []CredentialRecord
+	for rows.Next() {
+		var c CredentialRecord
+		var active int
+		var createdAtStr string
+		if err := rows.Scan(&c.AccessKeyID, &c.SecretKey, &c.OwnerID, &c.DisplayName, &active, &createdAtStr); err != nil {
+			return nil, fmt.Errorf("scanning credential row: %w", err)
+		}
+		c.Active = active != 0
+		c.CreatedAt, _ = time.Parse(timeFormat, createdAtStr)
+		creds = append(creds, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating credential rows: %w", err)
+	}
+	return creds, nil
+}
+
 // PutCredential creates or updates a credential record.
 func (s *SQLiteStore) PutCredential(ctx context.Context, cred *CredentialRecord) error {
 	active := 0
@@ -1204,41 +1795,678 @@ func (s *SQLiteStore) PutCredential(ctx context.Context, cred *CredentialRecord)
 	return nil
 }
 
-// ---- Helper functions ----
+// ---- Usage operations ----
 
-// nullString converts a Go string to sql.NullString. Empty strings become NULL.
-func nullString(s string) sql.NullString {
-	if s == "" {
-		return sql.NullString{}
+// AddUsage adds the given counters to the usage table inside a single
+// transaction, so a flush is either fully applied or not at all.
+func (s *SQLiteStore) AddUsage(ctx context.Context, records []UsageRecord) error {
+	if len(records) == 0 {
+		return nil
 	}
-	return sql.NullString{String: s, Valid: true}
-}
 
-// escapeLikePattern escapes special LIKE characters (%, _) in a pattern
-// using backslash as the escape character. The caller must append
-// ESCAPE '\' to the LIKE clause.
-func escapeLikePattern(s string) string {
-	s = strings.ReplaceAll(s, `\`, `\\`)
-	s = strings.ReplaceAll(s, "%", `\%`)
-	s = strings.ReplaceAll(s, "_", `\_`)
-	return s
-}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning usage transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-// scanObjectRow scans an object row from a *sql.Row.
-func scanObjectRow(row *sql.Row) (*ObjectRecord, error) {
-	var obj ObjectRecord
-	var contentEncoding, contentLanguage, contentDisposition, cacheControl, expires sql.NullString
-	var aclStr, userMetaStr, lastModifiedStr string
-	var deleteMarker int
+	for _, rec := range records {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO usage (access_key, bucket, period, requests, bytes_in, bytes_out)
+			 VALUES (?, ?, ?, ?, ?, ?)
+			 ON CONFLICT (access_key, bucket, period) DO UPDATE SET
+			   requests  = requests + excluded.requests,
+			   bytes_in  = bytes_in + excluded.bytes_in,
+			   bytes_out = bytes_out + excluded.bytes_out`,
+			rec.AccessKey, rec.Bucket, rec.Period.UTC().Format(timeFormat),
+			rec.Requests, rec.BytesIn, rec.BytesOut,
+		)
+		if err != nil {
+			return fmt.Errorf("adding usage for %q/%q: %w", rec.AccessKey, rec.Bucket, err)
+		}
+	}
 
-	err := row.Scan(
-		&obj.Bucket, &obj.Key, &obj.Size, &obj.ETag, &obj.ContentType,
-		&contentEncoding, &contentLanguage, &contentDisposition,
-		&cacheControl, &expires,
-		&obj.StorageClass, &aclStr, &userMetaStr, &lastModifiedStr, &deleteMarker,
-	)
-	if err != nil {
-		return nil, err
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing usage transaction: %w", err)
+	}
+	return nil
+}
+
+// ListUsage returns usage records matching the filter.
+func (s *SQLiteStore) ListUsage(ctx context.Context, filter UsageFilter) ([]UsageRecord, error) {
+	query := `SELECT access_key, bucket, period, requests, bytes_in, bytes_out FROM usage WHERE 1=1`
+	var args []interface{}
+	if filter.AccessKey != "" {
+		query += ` AND access_key = ?`
+		args = append(args, filter.AccessKey)
+	}
+	if filter.Bucket != "" {
+		query += ` AND bucket = ?`
+		args = append(args, filter.Bucket)
+	}
+	if !filter.Since.IsZero() {
+		query += ` AND period >= ?`
+		args = append(args, filter.Since.UTC().Format(timeFormat))
+	}
+	if !filter.Until.IsZero() {
+		query += ` AND period < ?`
+		args = append(args, filter.Until.UTC().Format(timeFormat))
+	}
+	query += ` ORDER BY period, access_key, bucket`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing usage: %w", err)
+	}
+	defer rows.Close()
+
+	var records []UsageRecord
+	for rows.Next() {
+		var rec UsageRecord
+		var periodStr string
+		if err := rows.Scan(&rec.AccessKey, &rec.Bucket, &periodStr, &rec.Requests, &rec.BytesIn, &rec.BytesOut); err != nil {
+			return nil, fmt.Errorf("scanning usage row: %w", err)
+		}
+		rec.Period, _ = time.Parse(timeFormat, periodStr)
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// ---- Defragmentation queue operations ----
+
+// EnqueueDefrag queues an object for background defragmentation.
+func (s *SQLiteStore) EnqueueDefrag(ctx context.Context, task DefragTask) error {
+	enqueuedAt := task.EnqueuedAt
+	if enqueuedAt.IsZero() {
+		enqueuedAt = s.clock.Now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO defrag_queue (bucket, key, etag, enqueued_at) VALUES (?, ?, ?, ?)`,
+		task.Bucket, task.Key, task.ETag, enqueuedAt.UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("enqueueing defrag for %q/%q: %w", task.Bucket, task.Key, err)
+	}
+	return nil
+}
+
+// ListDefrag returns up to limit queued defragmentation tasks, oldest first.
+func (s *SQLiteStore) ListDefrag(ctx context.Context, limit int) ([]DefragTask, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT bucket, key, etag, enqueued_at FROM defrag_queue
+		 ORDER BY enqueued_at, bucket, key LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing defrag queue: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []DefragTask
+	for rows.Next() {
+		var t DefragTask
+		var enqueuedAtStr string
+		if err := rows.Scan(&t.Bucket, &t.Key, &t.ETag, &enqueuedAtStr); err != nil {
+			return nil, fmt.Errorf("scanning defrag task: %w", err)
+		}
+		t.EnqueuedAt, _ = time.Parse(timeFormat, enqueuedAtStr)
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// RemoveDefrag removes a queued task if its ETag still matches.
+func (s *SQLiteStore) RemoveDefrag(ctx context.Context, task DefragTask) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM defrag_queue WHERE bucket = ? AND key = ? AND etag = ?`,
+		task.Bucket, task.Key, task.ETag,
+	)
+	if err != nil {
+		return fmt.Errorf("removing defrag task %q/%q: %w", task.Bucket, task.Key, err)
+	}
+	return nil
+}
+
+// ---- Bucket replication operations ----
+
+// GetBucketReplication returns a bucket's replication configuration, or nil.
+func (s *SQLiteStore) GetBucketReplication(ctx context.Context, bucket string) ([]byte, error) {
+	var config []byte
+	err := s.rdb.QueryRowContext(ctx,
+		`SELECT config FROM bucket_replication WHERE bucket = ?`, bucket,
+	).Scan(&config)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting replication of %q: %w", bucket, err)
+	}
+	return config, nil
+}
+
+// PutBucketReplication stores a bucket's replication configuration.
+func (s *SQLiteStore) PutBucketReplication(ctx context.Context, bucket string, config []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO bucket_replication (bucket, config) VALUES (?, ?)`, bucket, config,
+	)
+	if err != nil {
+		return fmt.Errorf("putting replication of %q: %w", bucket, err)
+	}
+	return nil
+}
+
+// DeleteBucketReplication removes a bucket's replication configuration.
+func (s *SQLiteStore) DeleteBucketReplication(ctx context.Context, bucket string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM bucket_replication WHERE bucket = ?`, bucket)
+	if err != nil {
+		return fmt.Errorf("deleting replication of %q: %w", bucket, err)
+	}
+	return nil
+}
+
+// ListBucketReplications returns every stored replication configuration.
+func (s *SQLiteStore) ListBucketReplications(ctx context.Context) (map[string][]byte, error) {
+	rows, err := s.rdb.QueryContext(ctx, `SELECT bucket, config FROM bucket_replication`)
+	if err != nil {
+		return nil, fmt.Errorf("listing bucket replication: %w", err)
+	}
+	defer rows.Close()
+
+	configs := map[string][]byte{}
+	for rows.Next() {
+		var bucket string
+		var config []byte
+		if err := rows.Scan(&bucket, &config); err != nil {
+			return nil, fmt.Errorf("scanning bucket replication: %w", err)
+		}
+		configs[bucket] = config
+	}
+	return configs, rows.Err()
+}
+
+// ---- Bucket inventory operations ----
+
+// PutBucketInventory stores an inventory configuration of a bucket.
+func (s *SQLiteStore) PutBucketInventory(ctx context.Context, bucket, id string, config []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO bucket_inventory (bucket, id, config) VALUES (?, ?, ?)
+		 ON CONFLICT (bucket, id) DO UPDATE SET config = excluded.config`,
+		bucket, id, config,
+	)
+	if err != nil {
+		return fmt.Errorf("putting inventory %q of %q: %w", id, bucket, err)
+	}
+	return nil
+}
+
+// DeleteBucketInventory removes an inventory configuration of a bucket.
+func (s *SQLiteStore) DeleteBucketInventory(ctx context.Context, bucket, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM bucket_inventory WHERE bucket = ? AND id = ?`, bucket, id)
+	if err != nil {
+		return fmt.Errorf("deleting inventory %q of %q: %w", id, bucket, err)
+	}
+	return nil
+}
+
+// ListBucketInventories returns every stored inventory configuration.
+func (s *SQLiteStore) ListBucketInventories(ctx context.Context) ([]InventoryConfig, error) {
+	rows, err := s.rdb.QueryContext(ctx,
+		`SELECT bucket, id, config, last_run FROM bucket_inventory ORDER BY bucket, id`)
+	if err != nil {
+		return nil, fmt.Errorf("listing bucket inventory: %w", err)
+	}
+	defer rows.Close()
+
+	var configs []InventoryConfig
+	for rows.Next() {
+		var c InventoryConfig
+		var lastRun string
+		if err := rows.Scan(&c.Bucket, &c.ID, &c.Config, &lastRun); err != nil {
+			return nil, fmt.Errorf("scanning bucket inventory: %w", err)
+		}
+		if lastRun != "" {
+			c.LastRun, _ = time.Parse(timeFormat, lastRun)
+		}
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+// SetInventoryLastRun records when an inventory configuration last
+// produced a report.
+func (s *SQLiteStore) SetInventoryLastRun(ctx context.Context, bucket, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE bucket_inventory SET last_run = ? WHERE bucket = ? AND id = ?`,
+		at.UTC().Format(timeFormat), bucket, id,
+	)
+	if err != nil {
+		return fmt.Errorf("recording inventory run %q of %q: %w", id, bucket, err)
+	}
+	return nil
+}
+
+// ---- Object file name operations ----
+
+// RecordObjectName records the key an object file name stands for, for a
+// local storage backend with hashed file names (storage.NameIndex).
+func (s *SQLiteStore) RecordObjectName(ctx context.Context, bucket, name, key string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO object_names (bucket, name, key) VALUES (?, ?, ?)
+		 ON CONFLICT (bucket, name) DO UPDATE SET key = excluded.key`,
+		bucket, name, key,
+	)
+	if err != nil {
+		return fmt.Errorf("recording object name %q in %q: %w", name, bucket, err)
+	}
+	return nil
+}
+
+// ObjectNameKey returns the key recorded for an object file name, or "".
+func (s *SQLiteStore) ObjectNameKey(ctx context.Context, bucket, name string) (string, error) {
+	var key string
+	err := s.rdb.QueryRowContext(ctx,
+		`SELECT key FROM object_names WHERE bucket = ? AND name = ?`, bucket, name,
+	).Scan(&key)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("looking up object name %q in %q: %w", name, bucket, err)
+	}
+	return key, nil
+}
+
+// ---- Erasure request operations ----
+
+// PutErasureRequest creates or replaces an erasure request.
+func (s *SQLiteStore) PutErasureRequest(ctx context.Context, req *ErasureRequest) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO erasure_requests (id, created_at, state, spec, report) VALUES (?, ?, ?, ?, ?)`,
+		req.ID, req.CreatedAt.UTC().Format(timeFormat), req.State, req.Spec, req.Report,
+	)
+	if err != nil {
+		return fmt.Errorf("putting erasure request %q: %w", req.ID, err)
+	}
+	return nil
+}
+
+// GetErasureRequest returns an erasure request, or nil if not found.
+func (s *SQLiteStore) GetErasureRequest(ctx context.Context, id string) (*ErasureRequest, error) {
+	req := &ErasureRequest{}
+	var createdAt string
+	err := s.rdb.QueryRowContext(ctx,
+		`SELECT id, created_at, state, spec, report FROM erasure_requests WHERE id = ?`, id,
+	).Scan(&req.ID, &createdAt, &req.State, &req.Spec, &req.Report)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting erasure request %q: %w", id, err)
+	}
+	req.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+	return req, nil
+}
+
+// ListErasureRequests returns every erasure request, oldest first, without
+// reports.
+func (s *SQLiteStore) ListErasureRequests(ctx context.Context) ([]ErasureRequest, error) {
+	rows, err := s.rdb.QueryContext(ctx,
+		`SELECT id, created_at, state, spec FROM erasure_requests ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("listing erasure requests: %w", err)
+	}
+	defer rows.Close()
+
+	var reqs []ErasureRequest
+	for rows.Next() {
+		var req ErasureRequest
+		var createdAt string
+		if err := rows.Scan(&req.ID, &createdAt, &req.State, &req.Spec); err != nil {
+			return nil, fmt.Errorf("scanning erasure request: %w", err)
+		}
+		req.CreatedAt, _ = time.Parse(timeFormat, createdAt)
+		reqs = append(reqs, req)
+	}
+	return reqs, rows.Err()
+}
+
+// FreezeBucket records that a bucket is frozen.
+func (s *SQLiteStore) FreezeBucket(ctx context.Context, f *BucketFreeze) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO bucket_freezes (bucket, frozen_at, reason) VALUES (?, ?, ?)`,
+		f.Bucket, f.FrozenAt.UTC().Format(timeFormat), f.Reason,
+	)
+	if err != nil {
+		return fmt.Errorf("freezing bucket %q: %w", f.Bucket, err)
+	}
+	return nil
+}
+
+// UnfreezeBucket removes a bucket's freeze.
+func (s *SQLiteStore) UnfreezeBucket(ctx context.Context, bucket string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM bucket_freezes WHERE bucket = ?`, bucket); err != nil {
+		return fmt.Errorf("unfreezing bucket %q: %w", bucket, err)
+	}
+	return nil
+}
+
+// GetBucketFreeze returns a bucket's freeze, or nil if it is not frozen.
+func (s *SQLiteStore) GetBucketFreeze(ctx context.Context, bucket string) (*BucketFreeze, error) {
+	f := &BucketFreeze{}
+	var frozenAt string
+	err := s.rdb.QueryRowContext(ctx,
+		`SELECT bucket, frozen_at, reason FROM bucket_freezes WHERE bucket = ?`, bucket,
+	).Scan(&f.Bucket, &frozenAt, &f.Reason)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting freeze of bucket %q: %w", bucket, err)
+	}
+	f.FrozenAt, _ = time.Parse(timeFormat, frozenAt)
+	return f, nil
+}
+
+// ListBucketFreezes returns every freeze, by bucket name.
+func (s *SQLiteStore) ListBucketFreezes(ctx context.Context) ([]BucketFreeze, error) {
+	rows, err := s.rdb.QueryContext(ctx, `SELECT bucket, frozen_at, reason FROM bucket_freezes ORDER BY bucket`)
+	if err != nil {
+		return nil, fmt.Errorf("listing bucket freezes: %w", err)
+	}
+	defer rows.Close()
+
+	var freezes []BucketFreeze
+	for rows.Next() {
+		var f BucketFreeze
+		var frozenAt string
+		if err := rows.Scan(&f.Bucket, &frozenAt, &f.Reason); err != nil {
+			return nil, fmt.Errorf("scanning bucket freeze: %w", err)
+		}
+		f.FrozenAt, _ = time.Parse(timeFormat, frozenAt)
+		freezes = append(freezes, f)
+	}
+	return freezes, rows.Err()
+}
+
+// GetBucketWebsite returns a bucket's website configuration, or nil.
+func (s *SQLiteStore) GetBucketWebsite(ctx context.Context, bucket string) ([]byte, error) {
+	var config []byte
+	err := s.rdb.QueryRowContext(ctx,
+		`SELECT config FROM bucket_website WHERE bucket = ?`, bucket,
+	).Scan(&config)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting website of %q: %w", bucket, err)
+	}
+	return config, nil
+}
+
+// PutBucketWebsite stores a bucket's website configuration.
+func (s *SQLiteStore) PutBucketWebsite(ctx context.Context, bucket string, config []byte) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO bucket_website (bucket, config) VALUES (?, ?)`, bucket, config,
+	)
+	if err != nil {
+		return fmt.Errorf("putting website of %q: %w", bucket, err)
+	}
+	return nil
+}
+
+// DeleteBucketWebsite removes a bucket's website configuration.
+func (s *SQLiteStore) DeleteBucketWebsite(ctx context.Context, bucket string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM bucket_website WHERE bucket = ?`, bucket); err != nil {
+		return fmt.Errorf("deleting website of %q: %w", bucket, err)
+	}
+	return nil
+}
+
+// SaveRateLimitState replaces the saved rate limiter balances.
+func (s *SQLiteStore) SaveRateLimitState(ctx context.Context, states []RateLimitState) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rate_limit_state`); err != nil {
+		return fmt.Errorf("clearing rate limit state: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT OR REPLACE INTO rate_limit_state (scope, id, tokens, updated_at) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("preparing rate limit state insert: %w", err)
+	}
+	defer stmt.Close()
+	for _, st := range states {
+		if _, err := stmt.ExecContext(ctx, st.Scope, st.ID, st.Tokens, st.Updated.UTC().Format(timeFormat)); err != nil {
+			return fmt.Errorf("saving rate limit state %s/%s: %w", st.Scope, st.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadRateLimitState returns the saved rate limiter balances.
+func (s *SQLiteStore) LoadRateLimitState(ctx context.Context) ([]RateLimitState, error) {
+	rows, err := s.rdb.QueryContext(ctx, `SELECT scope, id, tokens, updated_at FROM rate_limit_state ORDER BY scope, id`)
+	if err != nil {
+		return nil, fmt.Errorf("loading rate limit state: %w", err)
+	}
+	defer rows.Close()
+
+	var states []RateLimitState
+	for rows.Next() {
+		var st RateLimitState
+		var updated string
+		if err := rows.Scan(&st.Scope, &st.ID, &st.Tokens, &updated); err != nil {
+			return nil, fmt.Errorf("scanning rate limit state: %w", err)
+		}
+		st.Updated, _ = time.Parse(timeFormat, updated)
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
+
+// EnqueueReplication queues an object write or delete for replication.
+func (s *SQLiteStore) EnqueueReplication(ctx context.Context, task ReplicationTask) error {
+	enqueuedAt := task.EnqueuedAt
+	if enqueuedAt.IsZero() {
+		enqueuedAt = s.clock.Now()
+	}
+	nextAttempt := task.NextAttemptAt
+	if nextAttempt.IsZero() {
+		nextAttempt = enqueuedAt
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO replication_queue
+			(bucket, key, is_delete, etag, enqueued_at, attempts, next_attempt_at, last_error)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		task.Bucket, task.Key, boolToInt(task.Delete), task.ETag,
+		enqueuedAt.UTC().Format(timeFormat), task.Attempts,
+		nextAttempt.UTC().Format(timeFormat), task.LastError,
+	)
+	if err != nil {
+		return fmt.Errorf("enqueueing replication for %q/%q: %w", task.Bucket, task.Key, err)
+	}
+	return nil
+}
+
+// ListReplication returns up to limit tasks due at or before due.
+func (s *SQLiteStore) ListReplication(ctx context.Context, due time.Time, limit int) ([]ReplicationTask, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT bucket, key, is_delete, etag, enqueued_at, attempts, next_attempt_at, last_error
+		 FROM replication_queue WHERE next_attempt_at <= ?
+		 ORDER BY enqueued_at, bucket, key LIMIT ?`,
+		due.UTC().Format(timeFormat), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing replication queue: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []ReplicationTask
+	for rows.Next() {
+		var t ReplicationTask
+		var isDelete int
+		var enqueuedAtStr, nextAttemptStr string
+		if err := rows.Scan(&t.Bucket, &t.Key, &isDelete, &t.ETag, &enqueuedAtStr,
+			&t.Attempts, &nextAttemptStr, &t.LastError); err != nil {
+			return nil, fmt.Errorf("scanning replication task: %w", err)
+		}
+		t.Delete = isDelete != 0
+		t.EnqueuedAt, _ = time.Parse(timeFormat, enqueuedAtStr)
+		t.NextAttemptAt, _ = time.Parse(timeFormat, nextAttemptStr)
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// UpdateReplication records a failed attempt of a queued task.
+func (s *SQLiteStore) UpdateReplication(ctx context.Context, task ReplicationTask) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE replication_queue SET attempts = ?, next_attempt_at = ?, last_error = ?
+		 WHERE bucket = ? AND key = ? AND is_delete = ? AND etag = ?`,
+		task.Attempts, task.NextAttemptAt.UTC().Format(timeFormat), task.LastError,
+		task.Bucket, task.Key, boolToInt(task.Delete), task.ETag,
+	)
+	if err != nil {
+		return fmt.Errorf("updating replication task %q/%q: %w", task.Bucket, task.Key, err)
+	}
+	return nil
+}
+
+// RemoveReplication removes a queued task if it is still the same entry.
+func (s *SQLiteStore) RemoveReplication(ctx context.Context, task ReplicationTask) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM replication_queue WHERE bucket = ? AND key = ? AND is_delete = ? AND etag = ?`,
+		task.Bucket, task.Key, boolToInt(task.Delete), task.ETag,
+	)
+	if err != nil {
+		return fmt.Errorf("removing replication task %q/%q: %w", task.Bucket, task.Key, err)
+	}
+	return nil
+}
+
+// SetReplicationStatus updates an object's replication status if its ETag
+// still matches.
+func (s *SQLiteStore) SetReplicationStatus(ctx context.Context, bucket, key, etag, status string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE objects SET replication_status = ? WHERE bucket = ? AND key = ? AND etag = ?`,
+		nullString(status), bucket, key, etag,
+	)
+	if err != nil {
+		return fmt.Errorf("setting replication status of %q/%q: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// ---- Lease operations ----
+
+// AcquireLease claims the named lease for holder if it is unheld, expired
+// or already held by holder, and returns the lease as it now stands.
+func (s *SQLiteStore) AcquireLease(ctx context.Context, name, holder string, now, expires time.Time) (*Lease, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		 WHERE leases.holder = excluded.holder OR leases.expires_at < ?`,
+		name, holder, expires.UTC().Format(timeFormat), now.UTC().Format(timeFormat),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("acquiring lease %q: %w", name, err)
+	}
+	lease := &Lease{Name: name}
+	var expiresStr string
+	if err := tx.QueryRowContext(ctx,
+		`SELECT holder, expires_at FROM leases WHERE name = ?`, name,
+	).Scan(&lease.Holder, &expiresStr); err != nil {
+		return nil, fmt.Errorf("reading lease %q: %w", name, err)
+	}
+	lease.Expires, _ = time.Parse(timeFormat, expiresStr)
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing lease %q: %w", name, err)
+	}
+	return lease, nil
+}
+
+// ReleaseLease drops the named lease if holder holds it.
+func (s *SQLiteStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM leases WHERE name = ? AND holder = ?`, name, holder)
+	if err != nil {
+		return fmt.Errorf("releasing lease %q: %w", name, err)
+	}
+	return nil
+}
+
+// ---- Helper functions ----
+
+// nullString converts a Go string to sql.NullString. Empty strings become NULL.
+func nullString(s string) sql.NullString {
+	if s == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: s, Valid: true}
+}
+
+// boolToInt converts a Go bool to the 0/1 stored in INTEGER flag columns.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// escapeLikePattern escapes special LIKE characters (%, _) in a pattern
+// using backslash as the escape character. The caller must append
+// ESCAPE '\' to the LIKE clause.
+func escapeLikePattern(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	s = strings.ReplaceAll(s, "_", `\_`)
+	return s
+}
+
+// inlineBlob returns the inline_data column value for data: NULL when the
+// object lives in the storage backend, and a non-NULL blob (even if empty)
+// when it is inline.
+func inlineBlob(data []byte) any {
+	if data == nil {
+		return nil
+	}
+	return append([]byte{}, data...)
+}
+
+// scanObjectRow scans an object row, followed by its inline_data column,
+// from a *sql.Row.
+func scanObjectRow(row *sql.Row) (*ObjectRecord, error) {
+	var obj ObjectRecord
+	var contentEncoding, contentLanguage, contentDisposition, cacheControl, expires, partSizes, compression, replication, redirect sql.NullString
+	var aclStr, userMetaStr, lastModifiedStr string
+	var deleteMarker int
+	var inline sql.Null[[]byte]
+
+	err := row.Scan(
+		&obj.Bucket, &obj.Key, &obj.Size, &obj.ETag, &obj.ContentType,
+		&contentEncoding, &contentLanguage, &contentDisposition,
+		&cacheControl, &expires,
+		&obj.StorageClass, &aclStr, &userMetaStr, &lastModifiedStr, &deleteMarker,
+		&partSizes, &compression, &replication, &redirect, &inline,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if inline.Valid {
+		obj.InlineData = inline.V
+		if obj.InlineData == nil {
+			obj.InlineData = []byte{}
+		}
 	}
 
 	obj.ContentEncoding = contentEncoding.String
@@ -1249,6 +2477,10 @@ func scanObjectRow(row *sql.Row) (*ObjectRecord, error) {
 	obj.ACL = json.RawMessage(aclStr)
 	obj.LastModified, _ = time.Parse(timeFormat, lastModifiedStr)
 	obj.DeleteMarker = deleteMarker != 0
+	obj.PartSizes = decodePartSizes(partSizes.String)
+	obj.Compression = compression.String
+	obj.ReplicationStatus = replication.String
+	obj.WebsiteRedirectLocation = redirect.String
 
 	if userMetaStr != "" && userMetaStr != "{}" {
 		obj.UserMetadata = make(map[string]string)
@@ -1261,7 +2493,7 @@ func scanObjectRow(row *sql.Row) (*ObjectRecord, error) {
 // scanObjectRows scans an object row from *sql.Rows.
 func scanObjectRows(rows *sql.Rows) (*ObjectRecord, error) {
 	var obj ObjectRecord
-	var contentEncoding, contentLanguage, contentDisposition, cacheControl, expires sql.NullString
+	var contentEncoding, contentLanguage, contentDisposition, cacheControl, expires, partSizes, compression, replication, redirect sql.NullString
 	var aclStr, userMetaStr, lastModifiedStr string
 	var deleteMarker int
 
@@ -1270,6 +2502,7 @@ func scanObjectRows(rows *sql.Rows) (*ObjectRecord, error) {
 		&contentEncoding, &contentLanguage, &contentDisposition,
 		&cacheControl, &expires,
 		&obj.StorageClass, &aclStr, &userMetaStr, &lastModifiedStr, &deleteMarker,
+		&partSizes, &compression, &replication, &redirect,
 	)
 	if err != nil {
 		return nil, err
@@ -1283,6 +2516,10 @@ func scanObjectRows(rows *sql.Rows) (*ObjectRecord, error) {
 	obj.ACL = json.RawMessage(aclStr)
 	obj.LastModified, _ = time.Parse(timeFormat, lastModifiedStr)
 	obj.DeleteMarker = deleteMarker != 0
+	obj.PartSizes = decodePartSizes(partSizes.String)
+	obj.Compression = compression.String
+	obj.ReplicationStatus = replication.String
+	obj.WebsiteRedirectLocation = redirect.String
 
 	if userMetaStr != "" && userMetaStr != "{}" {
 		obj.UserMetadata = make(map[string]string)
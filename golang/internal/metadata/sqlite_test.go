@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -458,6 +461,37 @@ func TestDeleteObjectsMeta(t *testing.T) {
 	}
 }
 
+func TestDeleteObjectsMetaManyKeys(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	seedBucket(t, store, "many")
+
+	// More keys than fit in one statement, so the batch spans chunks.
+	const n = 2*(sqliteMaxVariables-1) + 5
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%05d", i)
+		if err := store.PutObject(ctx, &ObjectRecord{Bucket: "many", Key: keys[i], ETag: `"e"`}); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+	if err := store.PutObject(ctx, &ObjectRecord{Bucket: "many", Key: "keep", ETag: `"e"`}); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	deleted, errs := store.DeleteObjectsMeta(ctx, "many", keys)
+	if len(errs) != 0 || len(deleted) != n {
+		t.Fatalf("DeleteObjectsMeta = %d deleted, errs %v", len(deleted), errs)
+	}
+	result, err := store.ListObjects(ctx, "many", ListObjectsOptions{})
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if len(result.Objects) != 1 || result.Objects[0].Key != "keep" {
+		t.Errorf("remaining objects = %+v", result.Objects)
+	}
+}
+
 func TestUpdateObjectAcl(t *testing.T) {
 	store := newTestStore(t)
 	ctx := context.Background()
@@ -626,6 +660,96 @@ func TestListObjectsWithDelimiter(t *testing.T) {
 	}
 }
 
+func TestListObjectsDelimiterManyKeysPerPrefix(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	seedBucket(t, store, "rollup")
+
+	// Thousands of keys collapse into three prefixes around two leaves.
+	var keys []string
+	for _, dir := range []string{"a/", "b/", "é/"} {
+		for i := 0; i < 1500; i++ {
+			keys = append(keys, fmt.Sprintf("logs/%s%04d", dir, i))
+		}
+	}
+	keys = append(keys, "logs/0-first", "logs/c-middle")
+	for _, k := range keys {
+		if err := store.PutObject(ctx, &ObjectRecord{Bucket: "rollup", Key: k, ETag: `"e"`}); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+
+	var entries []string
+	opts := ListObjectsOptions{Prefix: "logs/", Delimiter: "/", MaxKeys: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		result, err := store.ListObjects(ctx, "rollup", opts)
+		if err != nil {
+			t.Fatalf("ListObjects: %v", err)
+		}
+		if n := len(result.Objects) + len(result.CommonPrefixes); n > 2 || (result.IsTruncated && n != 2) {
+			t.Fatalf("page has %d entries, truncated %v", n, result.IsTruncated)
+		}
+		for _, obj := range result.Objects {
+			entries = append(entries, obj.Key)
+		}
+		entries = append(entries, result.CommonPrefixes...)
+		if !result.IsTruncated {
+			break
+		}
+		opts.ContinuationToken = result.NextContinuationToken
+	}
+	sort.Strings(entries)
+	want := []string{"logs/0-first", "logs/a/", "logs/b/", "logs/c-middle", "logs/é/"}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %v, want %v", entries, want)
+	}
+
+	// A marker that is a common prefix, or a key under one, resumes past
+	// the whole prefix.
+	for _, marker := range []string{"logs/a/", "logs/a/0005"} {
+		result, err := store.ListObjects(ctx, "rollup", ListObjectsOptions{Prefix: "logs/", Delimiter: "/", Marker: marker, MaxKeys: 2})
+		if err != nil {
+			t.Fatalf("ListObjects(marker %q): %v", marker, err)
+		}
+		if len(result.Objects) != 1 || result.Objects[0].Key != "logs/c-middle" || !reflect.DeepEqual(result.CommonPrefixes, []string{"logs/b/"}) ||
+			!result.IsTruncated || result.NextMarker != "logs/c-middle" {
+			t.Errorf("after %q: objects %v, prefixes %v, truncated %v, next %q", marker, result.Objects, result.CommonPrefixes, result.IsTruncated, result.NextMarker)
+		}
+	}
+}
+
+func TestListObjectsPrefixIsCaseSensitive(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	seedBucket(t, store, "case")
+	for _, k := range []string{"Photos/1", "photos/1", "photos/2", "photosX", "pi_1", "pix"} {
+		if err := store.PutObject(ctx, &ObjectRecord{Bucket: "case", Key: k, ETag: `"e"`}); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+
+	for prefix, want := range map[string][]string{
+		"photos/": {"photos/1", "photos/2"},
+		"Photos":  {"Photos/1"},
+		"pi_":     {"pi_1"},
+	} {
+		result, err := store.ListObjects(ctx, "case", ListObjectsOptions{Prefix: prefix})
+		if err != nil {
+			t.Fatalf("ListObjects(%q): %v", prefix, err)
+		}
+		var got []string
+		for _, obj := range result.Objects {
+			got = append(got, obj.Key)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ListObjects(%q) = %v, want %v", prefix, got, want)
+		}
+	}
+}
+
 func TestListObjectsPagination(t *testing.T) {
 	store := newTestStore(t)
 	ctx := context.Background()
@@ -1124,6 +1248,340 @@ func TestCredentialCRUD(t *testing.T) {
 	}
 }
 
+// ---- Usage tests ----
+
+func TestUsageAccumulates(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	hour := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	batch := []UsageRecord{
+		{AccessKey: "ak1", Bucket: "b1", Period: hour, Requests: 2, BytesIn: 100, BytesOut: 10},
+		{AccessKey: "ak2", Bucket: "b1", Period: hour, Requests: 1, BytesOut: 50},
+	}
+	if err := store.AddUsage(ctx, batch); err != nil {
+		t.Fatalf("AddUsage: %v", err)
+	}
+	// A second flush for the same period must add to the existing row.
+	if err := store.AddUsage(ctx, batch[:1]); err != nil {
+		t.Fatalf("AddUsage (second): %v", err)
+	}
+	next := []UsageRecord{{AccessKey: "ak1", Bucket: "b1", Period: hour.Add(time.Hour), Requests: 1}}
+	if err := store.AddUsage(ctx, next); err != nil {
+		t.Fatalf("AddUsage (next hour): %v", err)
+	}
+
+	all, err := store.ListUsage(ctx, UsageFilter{})
+	if err != nil {
+		t.Fatalf("ListUsage: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("ListUsage returned %d records, want 3", len(all))
+	}
+	first := all[0]
+	if first.AccessKey != "ak1" || first.Requests != 4 || first.BytesIn != 200 || first.BytesOut != 20 {
+		t.Errorf("accumulated record = %+v", first)
+	}
+	if !first.Period.Equal(hour) {
+		t.Errorf("Period = %v, want %v", first.Period, hour)
+	}
+
+	filtered, err := store.ListUsage(ctx, UsageFilter{AccessKey: "ak1", Since: hour.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("ListUsage (filtered): %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].Requests != 1 {
+		t.Errorf("filtered usage = %+v, want one record with 1 request", filtered)
+	}
+}
+
+// ---- Defrag queue tests ----
+
+func TestDefragQueueReplaceAndGuardedRemove(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	first := DefragTask{Bucket: "b", Key: "k", ETag: `"old-2"`, EnqueuedAt: time.Now().Add(-time.Minute)}
+	if err := store.EnqueueDefrag(ctx, first); err != nil {
+		t.Fatalf("EnqueueDefrag: %v", err)
+	}
+	// Re-queueing the same key (after an overwrite) replaces the entry.
+	second := DefragTask{Bucket: "b", Key: "k", ETag: `"new-3"`}
+	if err := store.EnqueueDefrag(ctx, second); err != nil {
+		t.Fatalf("EnqueueDefrag (second): %v", err)
+	}
+
+	// Removing the stale task must not drop the newer entry.
+	if err := store.RemoveDefrag(ctx, first); err != nil {
+		t.Fatalf("RemoveDefrag: %v", err)
+	}
+	tasks, err := store.ListDefrag(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListDefrag: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ETag != `"new-3"` {
+		t.Fatalf("queue = %+v, want single entry with new ETag", tasks)
+	}
+
+	if err := store.RemoveDefrag(ctx, second); err != nil {
+		t.Fatalf("RemoveDefrag (second): %v", err)
+	}
+	tasks, _ = store.ListDefrag(ctx, 10)
+	if len(tasks) != 0 {
+		t.Errorf("queue not empty after removal: %+v", tasks)
+	}
+}
+
+// ---- Replication tests ----
+
+func TestReplicationQueue(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	write := ReplicationTask{Bucket: "b", Key: "k", ETag: `"v1"`, EnqueuedAt: now.Add(-time.Minute)}
+	if err := store.EnqueueReplication(ctx, write); err != nil {
+		t.Fatalf("EnqueueReplication: %v", err)
+	}
+	other := ReplicationTask{Bucket: "b", Key: "gone", Delete: true, EnqueuedAt: now}
+	if err := store.EnqueueReplication(ctx, other); err != nil {
+		t.Fatalf("EnqueueReplication (delete): %v", err)
+	}
+	tasks, err := store.ListReplication(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("ListReplication: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Key != "k" || !tasks[1].Delete {
+		t.Fatalf("queue = %+v, want the write then the delete", tasks)
+	}
+
+	// A failed attempt pushes the task past the due time.
+	write.Attempts, write.NextAttemptAt, write.LastError = 1, now.Add(time.Minute), "unreachable"
+	if err := store.UpdateReplication(ctx, write); err != nil {
+		t.Fatalf("UpdateReplication: %v", err)
+	}
+	if tasks, _ = store.ListReplication(ctx, now, 10); len(tasks) != 1 || tasks[0].Key != "gone" {
+		t.Fatalf("due tasks = %+v, want only the delete", tasks)
+	}
+	if tasks, _ = store.ListReplication(ctx, now.Add(2*time.Minute), 10); len(tasks) != 2 ||
+		tasks[0].Attempts != 1 || tasks[0].LastError != "unreachable" {
+		t.Fatalf("tasks after retry time = %+v", tasks)
+	}
+
+	// Removing a task replaced by a newer write must not drop the new entry.
+	newer := ReplicationTask{Bucket: "b", Key: "k", ETag: `"v2"`, EnqueuedAt: now}
+	store.EnqueueReplication(ctx, newer)
+	if err := store.RemoveReplication(ctx, write); err != nil {
+		t.Fatalf("RemoveReplication: %v", err)
+	}
+	store.RemoveReplication(ctx, other)
+	if tasks, _ = store.ListReplication(ctx, now, 10); len(tasks) != 1 || tasks[0].ETag != `"v2"` || tasks[0].Attempts != 0 {
+		t.Fatalf("queue = %+v, want single fresh entry with new ETag", tasks)
+	}
+}
+
+func TestBucketReplicationConfig(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	store.CreateBucket(ctx, &BucketRecord{Name: "b", OwnerID: "o", CreatedAt: time.Now()})
+
+	if cfg, err := store.GetBucketReplication(ctx, "b"); err != nil || cfg != nil {
+		t.Fatalf("GetBucketReplication before put = %q, %v", cfg, err)
+	}
+	store.PutBucketReplication(ctx, "b", []byte("<ReplicationConfiguration/>"))
+	if all, err := store.ListBucketReplications(ctx); err != nil || string(all["b"]) != "<ReplicationConfiguration/>" {
+		t.Fatalf("ListBucketReplications = %q, %v", all, err)
+	}
+
+	store.PutObject(ctx, &ObjectRecord{Bucket: "b", Key: "k", ETag: `"v1"`, ReplicationStatus: ReplicationPending, LastModified: time.Now()})
+	store.SetReplicationStatus(ctx, "b", "k", `"old"`, ReplicationFailed)
+	store.SetReplicationStatus(ctx, "b", "k", `"v1"`, ReplicationCompleted)
+	if obj, _ := store.GetObject(ctx, "b", "k"); obj.ReplicationStatus != ReplicationCompleted {
+		t.Errorf("ReplicationStatus = %q, want %q", obj.ReplicationStatus, ReplicationCompleted)
+	}
+	store.DeleteObject(ctx, "b", "k")
+
+	// Deleting the bucket drops its configuration.
+	if err := store.DeleteBucket(ctx, "b"); err != nil {
+		t.Fatalf("DeleteBucket: %v", err)
+	}
+	if cfg, _ := store.GetBucketReplication(ctx, "b"); cfg != nil {
+		t.Errorf("configuration survived DeleteBucket: %q", cfg)
+	}
+}
+
+func TestBucketInventoryConfig(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	store.CreateBucket(ctx, &BucketRecord{Name: "b", OwnerID: "o", CreatedAt: time.Now()})
+
+	store.PutBucketInventory(ctx, "b", "daily", []byte("<v1/>"))
+	store.PutBucketInventory(ctx, "b", "weekly", []byte("<w/>"))
+	ran := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := store.SetInventoryLastRun(ctx, "b", "daily", ran); err != nil {
+		t.Fatalf("SetInventoryLastRun: %v", err)
+	}
+
+	// Replacing a configuration keeps its last run.
+	store.PutBucketInventory(ctx, "b", "daily", []byte("<v2/>"))
+	all, err := store.ListBucketInventories(ctx)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("ListBucketInventories = %+v, %v", all, err)
+	}
+	if all[0].ID != "daily" || string(all[0].Config) != "<v2/>" || !all[0].LastRun.Equal(ran) {
+		t.Errorf("daily = %+v", all[0])
+	}
+	if all[1].ID != "weekly" || !all[1].LastRun.IsZero() {
+		t.Errorf("weekly = %+v", all[1])
+	}
+
+	store.DeleteBucketInventory(ctx, "b", "weekly")
+	if all, _ = store.ListBucketInventories(ctx); len(all) != 1 {
+		t.Errorf("after delete: %+v", all)
+	}
+
+	// Deleting the bucket drops its configurations.
+	if err := store.DeleteBucket(ctx, "b"); err != nil {
+		t.Fatalf("DeleteBucket: %v", err)
+	}
+	if all, _ = store.ListBucketInventories(ctx); len(all) != 0 {
+		t.Errorf("configurations survived DeleteBucket: %+v", all)
+	}
+}
+
+func TestObjectNames(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	store.CreateBucket(ctx, &BucketRecord{Name: "b", OwnerID: "o", CreatedAt: time.Now()})
+
+	if key, err := store.ObjectNameKey(ctx, "b", "ab/cd/abcd"); err != nil || key != "" {
+		t.Fatalf("ObjectNameKey before record = %q, %v", key, err)
+	}
+	store.RecordObjectName(ctx, "b", "ab/cd/abcd", "customer@example.com/invoice.pdf")
+	store.RecordObjectName(ctx, "b", "ab/cd/abcd", "customer@example.com/invoice.pdf")
+	if key, _ := store.ObjectNameKey(ctx, "b", "ab/cd/abcd"); key != "customer@example.com/invoice.pdf" {
+		t.Errorf("ObjectNameKey = %q", key)
+	}
+
+	// Deleting the bucket drops its names.
+	if err := store.DeleteBucket(ctx, "b"); err != nil {
+		t.Fatalf("DeleteBucket: %v", err)
+	}
+	if key, _ := store.ObjectNameKey(ctx, "b", "ab/cd/abcd"); key != "" {
+		t.Errorf("name survived DeleteBucket: %q", key)
+	}
+}
+
+func TestErasureRequests(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if req, err := store.GetErasureRequest(ctx, "missing"); err != nil || req != nil {
+		t.Fatalf("GetErasureRequest(missing) = %+v, %v", req, err)
+	}
+	created := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	store.PutErasureRequest(ctx, &ErasureRequest{ID: "b", CreatedAt: created.Add(time.Hour), State: "pending", Spec: []byte(`{}`)})
+	store.PutErasureRequest(ctx, &ErasureRequest{ID: "a", CreatedAt: created, State: "pending", Spec: []byte(`{"bucket":"x"}`)})
+	store.PutErasureRequest(ctx, &ErasureRequest{ID: "a", CreatedAt: created, State: "completed",
+		Spec: []byte(`{"bucket":"x"}`), Report: []byte(`{"verified":true}`)})
+
+	req, err := store.GetErasureRequest(ctx, "a")
+	if err != nil || req.State != "completed" || string(req.Report) != `{"verified":true}` || !req.CreatedAt.Equal(created) {
+		t.Fatalf("GetErasureRequest = %+v, %v", req, err)
+	}
+	all, err := store.ListErasureRequests(ctx)
+	if err != nil || len(all) != 2 || all[0].ID != "a" || all[1].ID != "b" || all[0].Report != nil {
+		t.Fatalf("ListErasureRequests = %+v, %v", all, err)
+	}
+}
+
+func TestBucketFreezes(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	for _, name := range []string{"a", "b"} {
+		if err := store.CreateBucket(ctx, &BucketRecord{Name: name, Region: "us-east-1", OwnerID: "o", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateBucket(%s): %v", name, err)
+		}
+	}
+
+	if f, err := store.GetBucketFreeze(ctx, "a"); err != nil || f != nil {
+		t.Fatalf("GetBucketFreeze before freezing = %+v, %v", f, err)
+	}
+	frozen := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	store.FreezeBucket(ctx, &BucketFreeze{Bucket: "b", FrozenAt: frozen, Reason: "migration"})
+	store.FreezeBucket(ctx, &BucketFreeze{Bucket: "a", FrozenAt: frozen, Reason: "incident"})
+	f, err := store.GetBucketFreeze(ctx, "a")
+	if err != nil || f == nil || f.Reason != "incident" || !f.FrozenAt.Equal(frozen) {
+		t.Fatalf("GetBucketFreeze = %+v, %v", f, err)
+	}
+	if all, err := store.ListBucketFreezes(ctx); err != nil || len(all) != 2 || all[0].Bucket != "a" {
+		t.Fatalf("ListBucketFreezes = %+v, %v", all, err)
+	}
+
+	store.UnfreezeBucket(ctx, "a")
+	if f, _ := store.GetBucketFreeze(ctx, "a"); f != nil {
+		t.Errorf("freeze after UnfreezeBucket = %+v", f)
+	}
+	if err := store.DeleteBucket(ctx, "b"); err != nil {
+		t.Fatalf("DeleteBucket: %v", err)
+	}
+	if all, _ := store.ListBucketFreezes(ctx); len(all) != 0 {
+		t.Errorf("freezes after deleting the bucket = %+v", all)
+	}
+}
+
+func TestBucketWebsiteConfig(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	store.CreateBucket(ctx, &BucketRecord{Name: "b", OwnerID: "o", CreatedAt: time.Now()})
+
+	if cfg, err := store.GetBucketWebsite(ctx, "b"); err != nil || cfg != nil {
+		t.Fatalf("GetBucketWebsite before put = %q, %v", cfg, err)
+	}
+	store.PutBucketWebsite(ctx, "b", []byte("<WebsiteConfiguration/>"))
+	if cfg, err := store.GetBucketWebsite(ctx, "b"); err != nil || string(cfg) != "<WebsiteConfiguration/>" {
+		t.Fatalf("GetBucketWebsite = %q, %v", cfg, err)
+	}
+	store.DeleteBucketWebsite(ctx, "b")
+	if cfg, _ := store.GetBucketWebsite(ctx, "b"); cfg != nil {
+		t.Errorf("configuration after DeleteBucketWebsite: %q", cfg)
+	}
+
+	// Deleting the bucket drops its configuration.
+	store.PutBucketWebsite(ctx, "b", []byte("<WebsiteConfiguration/>"))
+	if err := store.DeleteBucket(ctx, "b"); err != nil {
+		t.Fatalf("DeleteBucket: %v", err)
+	}
+	if cfg, _ := store.GetBucketWebsite(ctx, "b"); cfg != nil {
+		t.Errorf("configuration survived DeleteBucket: %q", cfg)
+	}
+}
+
+func TestRateLimitState(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	if states, err := store.LoadRateLimitState(ctx); err != nil || len(states) != 0 {
+		t.Fatalf("LoadRateLimitState before saving = %+v, %v", states, err)
+	}
+
+	at := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	store.SaveRateLimitState(ctx, []RateLimitState{
+		{Scope: "per_ip", ID: "10.0.0.1", Tokens: 0.5, Updated: at},
+		{Scope: "global", Tokens: 3, Updated: at},
+	})
+	states, err := store.LoadRateLimitState(ctx)
+	if err != nil || len(states) != 2 || states[0].Scope != "global" || states[1].ID != "10.0.0.1" ||
+		states[1].Tokens != 0.5 || !states[1].Updated.Equal(at) {
+		t.Fatalf("LoadRateLimitState = %+v, %v", states, err)
+	}
+
+	// Saving replaces the earlier balances.
+	store.SaveRateLimitState(ctx, []RateLimitState{{Scope: "per_access_key", ID: "k", Tokens: 1, Updated: at}})
+	if states, _ := store.LoadRateLimitState(ctx); len(states) != 1 || states[0].ID != "k" {
+		t.Errorf("LoadRateLimitState after replacing = %+v", states)
+	}
+}
+
 // ---- Schema idempotency test ----
 
 func TestIdempotentSchema(t *testing.T) {
@@ -1187,3 +1645,99 @@ func TestObjectDefaultFields(t *testing.T) {
 		t.Error("DeleteMarker should be false by default")
 	}
 }
+
+// TestMaintenance verifies that a checkpoint truncates the WAL and that
+// incremental vacuum returns the pages freed by deletes.
+func TestMaintenance(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	seedBucket(t, store, "maint")
+
+	pad := strings.Repeat("x", 2048)
+	for i := 0; i < 500; i++ {
+		obj := &ObjectRecord{Bucket: "maint", Key: fmt.Sprintf("k%04d", i), ETag: `"e"`, ContentType: pad}
+		if err := store.PutObject(ctx, obj); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+	for i := 0; i < 500; i++ {
+		if err := store.DeleteObject(ctx, "maint", fmt.Sprintf("k%04d", i)); err != nil {
+			t.Fatalf("DeleteObject: %v", err)
+		}
+	}
+
+	if size, err := store.WALSize(); err != nil || size == 0 {
+		t.Fatalf("WALSize before checkpoint = %d, %v; want > 0", size, err)
+	}
+	if err := store.Checkpoint(ctx); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if size, err := store.WALSize(); err != nil || size != 0 {
+		t.Errorf("WALSize after checkpoint = %d, %v; want 0", size, err)
+	}
+
+	freelist := func() int {
+		var n int
+		if err := store.db.QueryRow("PRAGMA freelist_count").Scan(&n); err != nil {
+			t.Fatalf("freelist_count: %v", err)
+		}
+		return n
+	}
+	before := freelist()
+	if before == 0 {
+		t.Fatal("freelist is empty after deleting every object")
+	}
+	if err := store.Vacuum(ctx, 10); err != nil {
+		t.Fatalf("Vacuum(10): %v", err)
+	}
+	if got := freelist(); got != before-10 {
+		t.Errorf("freelist after Vacuum(10) = %d, want %d", got, before-10)
+	}
+	if err := store.Vacuum(ctx, 0); err != nil {
+		t.Fatalf("Vacuum(0): %v", err)
+	}
+	if got := freelist(); got != 0 {
+		t.Errorf("freelist after Vacuum(0) = %d, want 0", got)
+	}
+
+	if err := store.Analyze(ctx); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+}
+
+func TestLeases(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	ttl := 10 * time.Second
+
+	lease, err := store.AcquireLease(ctx, "leader", "a", now, now.Add(ttl))
+	if err != nil || lease.Holder != "a" {
+		t.Fatalf("AcquireLease(a) = %+v, %v", lease, err)
+	}
+	// Another instance cannot take a live lease, but learns who holds it.
+	if lease, _ = store.AcquireLease(ctx, "leader", "b", now.Add(time.Second), now.Add(time.Second+ttl)); lease.Holder != "a" {
+		t.Errorf("AcquireLease(b) on a live lease = %+v, want holder a", lease)
+	}
+	// The holder renews it.
+	if lease, _ = store.AcquireLease(ctx, "leader", "a", now.Add(5*time.Second), now.Add(5*time.Second+ttl)); lease.Holder != "a" ||
+		!lease.Expires.After(now.Add(ttl)) {
+		t.Errorf("renewal = %+v", lease)
+	}
+
+	// Once it expires, another instance takes over.
+	later := now.Add(time.Minute)
+	if lease, _ = store.AcquireLease(ctx, "leader", "b", later, later.Add(ttl)); lease.Holder != "b" {
+		t.Errorf("AcquireLease(b) on an expired lease = %+v, want holder b", lease)
+	}
+	if err := store.ReleaseLease(ctx, "leader", "a"); err != nil {
+		t.Fatalf("ReleaseLease(a): %v", err)
+	}
+	if lease, _ = store.AcquireLease(ctx, "leader", "a", later, later.Add(ttl)); lease.Holder != "b" {
+		t.Errorf("release by a non-holder dropped the lease: %+v", lease)
+	}
+	store.ReleaseLease(ctx, "leader", "b")
+	if lease, _ = store.AcquireLease(ctx, "leader", "a", later, later.Add(ttl)); lease.Holder != "a" {
+		t.Errorf("AcquireLease(a) after release = %+v, want holder a", lease)
+	}
+}
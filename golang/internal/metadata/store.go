@@ -5,7 +5,9 @@ package metadata
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"strings"
 	"time"
 )
 
@@ -36,6 +38,55 @@ type ObjectRecord struct {
 	UserMetadata       map[string]string
 	LastModified       time.Time
 	DeleteMarker       bool
+	// InlineData is the payload of a small object stored in the metadata
+	// row instead of the storage backend, or nil. Only stores implementing
+	// InlineDataStore persist it, and listings need not return it.
+	InlineData []byte
+	// PartSizes holds the size of each part, in order, for an object
+	// completed by a multipart upload, and is nil otherwise. Objects
+	// completed before part sizes were recorded also have nil.
+	PartSizes []int64
+	// Compression is the codec the stored data is compressed with ("zstd"
+	// or "gzip"), or "" if it is stored as sent. Size and ETag always
+	// describe the uncompressed object.
+	Compression string
+	// ReplicationStatus is the x-amz-replication-status of an object
+	// written to a bucket with replication rules: ReplicationPending,
+	// ReplicationCompleted or ReplicationFailed, or "" if no rule applies.
+	ReplicationStatus string
+	// WebsiteRedirectLocation is the x-amz-website-redirect-location the
+	// object was written with: a path in the same bucket or an absolute
+	// URL the website endpoint redirects requests for the object to, or "".
+	WebsiteRedirectLocation string
+}
+
+// Replication status values for ObjectRecord.ReplicationStatus.
+const (
+	ReplicationPending   = "PENDING"
+	ReplicationCompleted = "COMPLETED"
+	ReplicationFailed    = "FAILED"
+)
+
+// encodePartSizes returns the JSON text of sizes, or "" for nil, for engines
+// that store ObjectRecord.PartSizes in a string attribute.
+func encodePartSizes(sizes []int64) string {
+	if sizes == nil {
+		return ""
+	}
+	b, _ := json.Marshal(sizes)
+	return string(b)
+}
+
+// decodePartSizes parses a string written by encodePartSizes.
+func decodePartSizes(s string) []int64 {
+	if s == "" {
+		return nil
+	}
+	var sizes []int64
+	if json.Unmarshal([]byte(s), &sizes) != nil {
+		return nil
+	}
+	return sizes
 }
 
 // MultipartUploadRecord represents the metadata for an in-progress multipart upload.
@@ -55,6 +106,8 @@ type MultipartUploadRecord struct {
 	OwnerID            string
 	OwnerDisplay       string
 	InitiatedAt        time.Time
+	// WebsiteRedirectLocation is passed on to the completed object.
+	WebsiteRedirectLocation string
 }
 
 // PartRecord represents the metadata for a single uploaded part.
@@ -231,3 +284,353 @@ type ExpiredUpload struct {
 type UploadReaper interface {
 	ReapExpiredUploads(ttlSeconds int) ([]ExpiredUpload, error)
 }
+
+// InlineDataStore is an optional interface for metadata stores that persist
+// ObjectRecord.InlineData, so small objects can skip the storage backend.
+type InlineDataStore interface {
+	// SupportsInlineData reports whether PutObject stores InlineData and
+	// GetObject returns it.
+	SupportsInlineData() bool
+}
+
+// ErrPreconditionFailed is returned by PutObjectIf when the object does not
+// meet the write condition.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// WriteCondition is the precondition of a conditional object write.
+type WriteCondition struct {
+	// IfNoneMatch requires that the object does not exist.
+	IfNoneMatch bool
+	// IfMatch, if set, requires that the object exists with this ETag,
+	// compared without quotes; "*" matches any ETag.
+	IfMatch string
+}
+
+// Check returns ErrPreconditionFailed unless current, the object's record
+// or nil, meets the condition.
+func (c WriteCondition) Check(current *ObjectRecord) error {
+	exists := current != nil && !current.DeleteMarker
+	if c.IfNoneMatch && exists {
+		return ErrPreconditionFailed
+	}
+	if c.IfMatch != "" {
+		if !exists || c.IfMatch != "*" && strings.Trim(current.ETag, `"`) != strings.Trim(c.IfMatch, `"`) {
+			return ErrPreconditionFailed
+		}
+	}
+	return nil
+}
+
+// ConditionalPutStore is an optional interface for metadata stores that can
+// check a write condition and write an object record atomically, so racing
+// conditional writers cannot both succeed. Other stores check the condition
+// and write in two steps.
+type ConditionalPutStore interface {
+	// PutObjectIf writes obj like PutObject if the object's current record
+	// meets cond, and returns ErrPreconditionFailed otherwise.
+	PutObjectIf(ctx context.Context, obj *ObjectRecord, cond WriteCondition) error
+}
+
+// Consistency describes which preceding writes a metadata store's reads are
+// guaranteed to observe.
+type Consistency struct {
+	// ReadAfterWrite is true if GetObject and GetBucket see a completed
+	// PutObject, DeleteObject or CreateBucket immediately.
+	ReadAfterWrite bool
+	// ListAfterWrite is true if ListObjects sees a completed PutObject or
+	// DeleteObject immediately.
+	ListAfterWrite bool
+}
+
+// ConsistencyReporter is an optional interface for metadata stores whose
+// reads may lag their writes. Stores that do not implement it are strongly
+// consistent: every read observes every completed write.
+type ConsistencyReporter interface {
+	Consistency() Consistency
+}
+
+// Enumerator is an optional interface for metadata stores that can list
+// every bucket and credential regardless of owner. Used to migrate a whole
+// store to another engine.
+type Enumerator interface {
+	// ListAllBuckets returns every bucket, ordered by name.
+	ListAllBuckets(ctx context.Context) ([]BucketRecord, error)
+
+	// ListCredentials returns every credential, including inactive ones.
+	ListCredentials(ctx context.Context) ([]CredentialRecord, error)
+}
+
+// Maintainer is an optional interface for metadata stores with on-disk
+// housekeeping that should run periodically rather than only on restart.
+type Maintainer interface {
+	// Checkpoint copies the write-ahead log into the database and truncates it.
+	Checkpoint(ctx context.Context) error
+
+	// Vacuum returns up to pages free pages to the filesystem (0 = all).
+	Vacuum(ctx context.Context, pages int) error
+
+	// Analyze refreshes the query planner's statistics.
+	Analyze(ctx context.Context) error
+
+	// WALSize returns the size of the write-ahead log in bytes.
+	WALSize() (int64, error)
+}
+
+// UsageRecord holds aggregated request and transfer counters for one access
+// key and bucket over a single accounting period.
+type UsageRecord struct {
+	AccessKey string
+	Bucket    string
+	// Period is the start of the accounting period (truncated to the hour, UTC).
+	Period   time.Time
+	Requests int64
+	BytesIn  int64
+	BytesOut int64
+}
+
+// UsageFilter restricts which usage records ListUsage returns. Zero-valued
+// fields are ignored.
+type UsageFilter struct {
+	AccessKey string
+	Bucket    string
+	// Since and Until bound the period start (inclusive and exclusive).
+	Since time.Time
+	Until time.Time
+}
+
+// UsageStore is an optional interface for metadata stores that can persist
+// per-access-key usage counters for metering and chargeback.
+type UsageStore interface {
+	// AddUsage adds the given counters to the stored totals, creating rows
+	// for new (access key, bucket, period) combinations.
+	AddUsage(ctx context.Context, records []UsageRecord) error
+
+	// ListUsage returns usage records matching the filter, ordered by
+	// period, access key and bucket.
+	ListUsage(ctx context.Context, filter UsageFilter) ([]UsageRecord, error)
+}
+
+// DefragTask identifies an object queued for background defragmentation.
+type DefragTask struct {
+	Bucket string
+	Key    string
+	// ETag is the object's ETag when it was queued; the task is stale if the
+	// object has since been overwritten.
+	ETag       string
+	EnqueuedAt time.Time
+}
+
+// DefragQueue is an optional interface for metadata stores that can persist
+// a queue of objects awaiting defragmentation, so queued work survives crashes.
+type DefragQueue interface {
+	// EnqueueDefrag queues an object, replacing any existing entry for the key.
+	EnqueueDefrag(ctx context.Context, task DefragTask) error
+
+	// ListDefrag returns up to limit queued tasks, oldest first.
+	ListDefrag(ctx context.Context, limit int) ([]DefragTask, error)
+
+	// RemoveDefrag removes a task, but only if its ETag still matches, so a
+	// newer entry for the same key is not lost.
+	RemoveDefrag(ctx context.Context, task DefragTask) error
+}
+
+// ReplicationTask is a queued write or delete of an object, to be copied to
+// the destination of the bucket's replication rule.
+type ReplicationTask struct {
+	Bucket string
+	Key    string
+	// Delete is set for a deletion, which is replicated by deleting the
+	// destination copy.
+	Delete bool
+	// ETag is the object's ETag when a write was queued; the task is stale
+	// if the object has since been overwritten. It is empty for deletions.
+	ETag          string
+	EnqueuedAt    time.Time
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+}
+
+// ReplicationStore is an optional interface for metadata stores that can
+// persist bucket replication configurations and a durable queue of objects
+// awaiting replication, so queued work survives crashes.
+type ReplicationStore interface {
+	// GetBucketReplication returns the replication configuration document
+	// of a bucket, or nil if it has none.
+	GetBucketReplication(ctx context.Context, bucket string) ([]byte, error)
+
+	// PutBucketReplication stores the replication configuration of a bucket.
+	PutBucketReplication(ctx context.Context, bucket string, config []byte) error
+
+	// DeleteBucketReplication removes the replication configuration of a
+	// bucket. Removing a missing configuration is not an error.
+	DeleteBucketReplication(ctx context.Context, bucket string) error
+
+	// ListBucketReplications returns the configuration of every bucket that
+	// has one, keyed by bucket name.
+	ListBucketReplications(ctx context.Context) (map[string][]byte, error)
+
+	// EnqueueReplication queues a task, replacing any existing entry for the
+	// key.
+	EnqueueReplication(ctx context.Context, task ReplicationTask) error
+
+	// ListReplication returns up to limit tasks whose next attempt is due at
+	// or before due, in the order they were queued.
+	ListReplication(ctx context.Context, due time.Time, limit int) ([]ReplicationTask, error)
+
+	// UpdateReplication records a failed attempt of a task (Attempts,
+	// NextAttemptAt and LastError), but only if the queued entry is still
+	// the same write or delete.
+	UpdateReplication(ctx context.Context, task ReplicationTask) error
+
+	// RemoveReplication removes a task, but only if the queued entry is
+	// still the same write or delete, so a newer entry is not lost.
+	RemoveReplication(ctx context.Context, task ReplicationTask) error
+
+	// SetReplicationStatus sets the ReplicationStatus of an object if its
+	// ETag still matches.
+	SetReplicationStatus(ctx context.Context, bucket, key, etag, status string) error
+}
+
+// InventoryConfig is one stored inventory configuration of a bucket.
+type InventoryConfig struct {
+	Bucket string
+	ID     string
+	Config []byte
+	// LastRun is when a report was last produced, or zero if never.
+	LastRun time.Time
+}
+
+// InventoryStore is an optional interface for metadata stores that can
+// persist bucket inventory configurations and when each last produced a
+// report, so schedules survive restarts.
+type InventoryStore interface {
+	// PutBucketInventory stores an inventory configuration document,
+	// replacing the one with the same ID but keeping its LastRun.
+	PutBucketInventory(ctx context.Context, bucket, id string, config []byte) error
+
+	// DeleteBucketInventory removes an inventory configuration. Removing a
+	// missing configuration is not an error.
+	DeleteBucketInventory(ctx context.Context, bucket, id string) error
+
+	// ListBucketInventories returns every stored inventory configuration,
+	// ordered by bucket and ID.
+	ListBucketInventories(ctx context.Context) ([]InventoryConfig, error)
+
+	// SetInventoryLastRun records when a configuration last produced a
+	// report.
+	SetInventoryLastRun(ctx context.Context, bucket, id string, at time.Time) error
+}
+
+// ErasureRequest is a registered request to erase the objects matching a
+// specification, and the signed report of its execution.
+type ErasureRequest struct {
+	ID        string
+	CreatedAt time.Time
+	// State is "pending" until executed, then "completed" or, if some
+	// object could not be verified gone, "incomplete".
+	State string
+	// Spec is the JSON document naming the objects to erase.
+	Spec []byte
+	// Report is the JSON report of the last execution, or nil.
+	Report []byte
+}
+
+// ErasureRequestStore is an optional interface for metadata stores that
+// keep erasure requests and their reports as compliance records.
+type ErasureRequestStore interface {
+	// PutErasureRequest creates or replaces a request.
+	PutErasureRequest(ctx context.Context, req *ErasureRequest) error
+
+	// GetErasureRequest returns a request, or nil if there is none with id.
+	GetErasureRequest(ctx context.Context, id string) (*ErasureRequest, error)
+
+	// ListErasureRequests returns every request, oldest first, without
+	// their reports.
+	ListErasureRequests(ctx context.Context) ([]ErasureRequest, error)
+}
+
+// BucketFreeze records that a bucket is frozen: its objects can be read but
+// not written or deleted.
+type BucketFreeze struct {
+	Bucket   string
+	FrozenAt time.Time
+	// Reason is the operator's note on why the bucket is frozen.
+	Reason string
+}
+
+// BucketFreezeStore is an optional interface for metadata stores that keep
+// the buckets frozen read-only. A bucket's freeze is removed with it.
+type BucketFreezeStore interface {
+	// FreezeBucket records a freeze, replacing any earlier one.
+	FreezeBucket(ctx context.Context, f *BucketFreeze) error
+
+	// UnfreezeBucket removes a bucket's freeze, if it has one.
+	UnfreezeBucket(ctx context.Context, bucket string) error
+
+	// GetBucketFreeze returns a bucket's freeze, or nil if it is not frozen.
+	GetBucketFreeze(ctx context.Context, bucket string) (*BucketFreeze, error)
+
+	// ListBucketFreezes returns every freeze, by bucket name.
+	ListBucketFreezes(ctx context.Context) ([]BucketFreeze, error)
+}
+
+// WebsiteStore is an optional interface for metadata stores that keep the
+// website configurations of buckets. A bucket's configuration is removed
+// with it.
+type WebsiteStore interface {
+	// GetBucketWebsite returns the website configuration document of a
+	// bucket, or nil if it has none.
+	GetBucketWebsite(ctx context.Context, bucket string) ([]byte, error)
+
+	// PutBucketWebsite stores the website configuration of a bucket.
+	PutBucketWebsite(ctx context.Context, bucket string, config []byte) error
+
+	// DeleteBucketWebsite removes the website configuration of a bucket.
+	// Removing a missing configuration is not an error.
+	DeleteBucketWebsite(ctx context.Context, bucket string) error
+}
+
+// RateLimitState is the saved balance of one rate limiter token bucket.
+type RateLimitState struct {
+	// Scope is the limit the bucket belongs to: "global", "per_ip" or
+	// "per_access_key".
+	Scope string
+	// ID is the client IP or access key, or "" for the global bucket.
+	ID string
+	// Tokens is the balance at Updated; it refills from then on.
+	Tokens  float64
+	Updated time.Time
+}
+
+// RateLimitStateStore is an optional interface for metadata stores that can
+// keep rate limiter balances across restarts.
+type RateLimitStateStore interface {
+	// SaveRateLimitState replaces the saved balances with states.
+	SaveRateLimitState(ctx context.Context, states []RateLimitState) error
+
+	// LoadRateLimitState returns the saved balances.
+	LoadRateLimitState(ctx context.Context) ([]RateLimitState, error)
+}
+
+// Lease is a named claim held by one server instance until it expires.
+type Lease struct {
+	Name    string
+	Holder  string
+	Expires time.Time
+}
+
+// LeaseStore is an optional interface for metadata stores shared by several
+// server instances that can arbitrate a lease between them, for leader
+// election. Expiry is judged by the callers' clocks, which must be roughly
+// in sync.
+type LeaseStore interface {
+	// AcquireLease claims the named lease for holder until expires if it is
+	// unheld, expired as of now, or already held by holder, and returns the
+	// lease as it stands afterwards: held by holder on success, otherwise by
+	// the instance holding it.
+	AcquireLease(ctx context.Context, name, holder string, now, expires time.Time) (*Lease, error)
+
+	// ReleaseLease drops the named lease if holder holds it.
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
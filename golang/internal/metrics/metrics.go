@@ -67,6 +67,27 @@ var (
 		[]string{"operation", "status"},
 	)
 
+	// S3RequestSize observes S3 request body sizes by bucket and operation,
+	// giving the object-size distribution of writes.
+	S3RequestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bleepstore_s3_request_size_bytes",
+			Help:    "S3 request body size in bytes by bucket and operation",
+			Buckets: sizeBuckets,
+		},
+		[]string{"bucket", "operation"},
+	)
+
+	// S3ResponseSize observes S3 response body sizes by bucket and operation.
+	S3ResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bleepstore_s3_response_size_bytes",
+			Help:    "S3 response body size in bytes by bucket and operation",
+			Buckets: sizeBuckets,
+		},
+		[]string{"bucket", "operation"},
+	)
+
 	// ObjectsTotal is a gauge tracking total objects across all buckets.
 	ObjectsTotal = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -100,6 +121,227 @@ var (
 	)
 )
 
+// DeprecationWarningsTotal counts requests that used a deprecated behavior,
+// by warning code.
+var DeprecationWarningsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bleepstore_deprecation_warnings_total",
+		Help: "Requests using deprecated client behavior by warning code",
+	},
+	[]string{"warning"},
+)
+
+// PanicsTotal counts handler panics recovered into 500 InternalError
+// responses.
+var PanicsTotal = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bleepstore_panics_total",
+		Help: "Handler panics recovered into InternalError responses",
+	},
+)
+
+// ReplicationConnected is 1 while a memory-backend replica is following its
+// primary and 0 otherwise.
+var ReplicationConnected = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bleepstore_replication_connected",
+		Help: "Whether this replica is connected to and in sync with its primary",
+	},
+)
+
+// Storage scrubber metrics.
+var (
+	// ScrubObjectsTotal counts objects checked by the scrubber by result:
+	// ok, corrupt, missing, repaired or skipped.
+	ScrubObjectsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_scrub_objects_total",
+			Help: "Objects checked by the storage scrubber by result",
+		},
+		[]string{"result"},
+	)
+
+	// ScrubBytesTotal counts object bytes read by the scrubber.
+	ScrubBytesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "bleepstore_scrub_bytes_total",
+			Help: "Object bytes read by the storage scrubber",
+		},
+	)
+
+	// ScrubCorruptObjects is the number of corrupt or missing objects the
+	// last complete scrub pass left unrepaired.
+	ScrubCorruptObjects = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bleepstore_scrub_corrupt_objects",
+			Help: "Corrupt or missing objects left unrepaired by the last complete scrub pass",
+		},
+	)
+
+	// ScrubLastPassTimestamp is the Unix time the last complete scrub pass
+	// finished.
+	ScrubLastPassTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bleepstore_scrub_last_pass_timestamp_seconds",
+			Help: "Unix time the last complete scrub pass finished",
+		},
+	)
+
+	// OrphanFilesTotal counts data files without metadata found by the
+	// orphan collector, by action: found, removed or quarantined.
+	OrphanFilesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_orphan_files_total",
+			Help: "Data files without metadata found or cleaned up by the orphan collector",
+		},
+		[]string{"action"},
+	)
+
+	// OrphanBytesTotal counts the bytes of those files, by action.
+	OrphanBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_orphan_bytes_total",
+			Help: "Bytes of data files without metadata found or cleaned up by the orphan collector",
+		},
+		[]string{"action"},
+	)
+
+	// BucketReplicationTotal counts bucket replication attempts, by op
+	// (put or delete) and result: success, retry, failed or stale.
+	BucketReplicationTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_bucket_replication_total",
+			Help: "Bucket replication attempts by operation and result",
+		},
+		[]string{"op", "result"},
+	)
+
+	// BucketReplicationBytesTotal counts the object bytes copied to
+	// replication destinations.
+	BucketReplicationBytesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "bleepstore_bucket_replication_bytes_total",
+			Help: "Object bytes copied to bucket replication destinations",
+		},
+	)
+
+	// ReplicationVerifyObjectsTotal counts the objects checked by the
+	// replication verification job, by result: match, diverged or
+	// unverifiable.
+	ReplicationVerifyObjectsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_replication_verify_objects_total",
+			Help: "Replicated objects checked against their replicas, by result",
+		},
+		[]string{"result"},
+	)
+
+	// InventoryReportsTotal counts bucket inventory reports, by result:
+	// success or error.
+	InventoryReportsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_inventory_reports_total",
+			Help: "Bucket inventory reports written or failed",
+		},
+		[]string{"result"},
+	)
+
+	// InventoryObjectsTotal counts the objects listed in inventory reports.
+	InventoryObjectsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "bleepstore_inventory_objects_total",
+			Help: "Objects listed in bucket inventory reports",
+		},
+	)
+
+	// ErasureObjectsTotal counts objects handled by erasure requests, by
+	// result: erased (verified gone) or failed.
+	ErasureObjectsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_erasure_objects_total",
+			Help: "Objects erased, or failed to erase, by erasure requests",
+		},
+		[]string{"result"},
+	)
+
+	// HALeader is 1 while this instance holds the HA leader lease, 0
+	// otherwise.
+	HALeader = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bleepstore_ha_leader",
+			Help: "Whether this instance is the HA leader",
+		},
+	)
+
+	// CoalescedGetsTotal counts storage GETs with read coalescing on, by
+	// result: fetched (started a backend fetch) or joined (read one already
+	// in flight).
+	CoalescedGetsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_storage_coalesced_gets_total",
+			Help: "Storage GETs that fetched from the backend or joined a fetch in flight",
+		},
+		[]string{"result"},
+	)
+
+	// StorageConcurrencyLimit is the adaptive concurrency limit on storage
+	// operations.
+	StorageConcurrencyLimit = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bleepstore_storage_concurrency_limit",
+			Help: "Adaptive limit on concurrent storage backend operations",
+		},
+	)
+
+	// StorageOperationsInFlight is the number of storage operations holding
+	// an adaptive concurrency slot.
+	StorageOperationsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bleepstore_storage_operations_in_flight",
+			Help: "Storage backend operations in flight under the adaptive concurrency limit",
+		},
+	)
+
+	// WritesQuiesced is 1 while a backup hook holds writes, 0 otherwise.
+	WritesQuiesced = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bleepstore_writes_quiesced",
+			Help: "Whether writes are quiesced for a backup",
+		},
+	)
+)
+
+// Metadata store maintenance metrics.
+var (
+	// MetadataWALBytes is a gauge tracking the size of the metadata store's
+	// write-ahead log.
+	MetadataWALBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bleepstore_metadata_wal_bytes",
+			Help: "Size of the metadata write-ahead log in bytes",
+		},
+	)
+
+	// MaintenanceRunsTotal counts maintenance task runs by task and status.
+	MaintenanceRunsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bleepstore_metadata_maintenance_runs_total",
+			Help: "Metadata maintenance runs by task and status",
+		},
+		[]string{"task", "status"},
+	)
+
+	// MaintenanceDuration observes maintenance task duration in seconds.
+	MaintenanceDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bleepstore_metadata_maintenance_duration_seconds",
+			Help:    "Metadata maintenance task duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"task"},
+	)
+)
+
 // Register registers all Prometheus collectors with the default registry.
 // This must be called explicitly (typically from main) so that metrics
 // registration can be made conditional on configuration. It is safe to call
@@ -112,10 +354,35 @@ func Register() {
 			HTTPRequestSize,
 			HTTPResponseSize,
 			S3OperationsTotal,
+			S3RequestSize,
+			S3ResponseSize,
 			ObjectsTotal,
 			BucketsTotal,
 			BytesReceivedTotal,
 			BytesSentTotal,
+			MetadataWALBytes,
+			MaintenanceRunsTotal,
+			MaintenanceDuration,
+			DeprecationWarningsTotal,
+			PanicsTotal,
+			ReplicationConnected,
+			ScrubObjectsTotal,
+			ScrubBytesTotal,
+			ScrubCorruptObjects,
+			ScrubLastPassTimestamp,
+			OrphanFilesTotal,
+			OrphanBytesTotal,
+			BucketReplicationTotal,
+			BucketReplicationBytesTotal,
+			ReplicationVerifyObjectsTotal,
+			InventoryReportsTotal,
+			InventoryObjectsTotal,
+			ErasureObjectsTotal,
+			CoalescedGetsTotal,
+			StorageConcurrencyLimit,
+			StorageOperationsInFlight,
+			WritesQuiesced,
+			HALeader,
 		)
 		// Initialize S3OperationsTotal so it appears in /metrics output
 		// even before any S3 operations have been performed.
@@ -0,0 +1,278 @@
+// Package preflight checks a deployment's configuration, metadata schema
+// and storage layout against this binary before an upgrade. It changes
+// nothing on disk; it reports what the binary cannot run with and the
+// migrations it would apply when started.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// Severity classifies a finding.
+type Severity string
+
+const (
+	// Info needs no action.
+	Info Severity = "info"
+	// Step is a migration the binary applies on start, or an action to take
+	// during the upgrade.
+	Step Severity = "step"
+	// Warning is ignored by the binary but probably not what was intended.
+	Warning Severity = "warning"
+	// Blocker must be resolved before the binary is started.
+	Blocker Severity = "blocker"
+)
+
+// Finding is one result of a check.
+type Finding struct {
+	// Check is the area checked: "config", "metadata" or "storage".
+	Check    string
+	Severity Severity
+	Message  string
+}
+
+// Report is the result of Run.
+type Report struct {
+	Findings []Finding
+}
+
+// Blockers returns the number of findings that must be resolved first.
+func (r *Report) Blockers() int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Severity == Blocker {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) add(check string, sev Severity, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Check: check, Severity: sev, Message: fmt.Sprintf(format, args...)})
+}
+
+// Metadata engines and storage backends this binary can open. Anything else
+// in the config falls back to sqlite or local storage.
+var (
+	metadataEngines = []string{"sqlite", "memory", "local", "bolt", "dynamodb", "firestore", "cosmos", "etcd"}
+	storageBackends = []string{"local", "memory", "sqlite", "mirror", "erasure", "dedup", "aws", "gcp", "azure"}
+	// leaseEngines can arbitrate the HA leader lease.
+	leaseEngines = []string{"sqlite", "dynamodb", "etcd"}
+)
+
+// Run checks the config file at path and the metadata and storage it points
+// at. The error is non-nil only if the checks themselves could not run.
+func Run(ctx context.Context, path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{}
+	if len(root.Content) > 0 {
+		for _, key := range unknownKeys(root.Content[0], reflect.TypeOf(config.Config{}), "") {
+			r.add("config", Warning, "unknown key %s is ignored; it may have been renamed or removed", key)
+		}
+	}
+	checkConfig(r, cfg)
+	if err := checkMetadata(ctx, r, cfg); err != nil {
+		return nil, err
+	}
+	if err := checkStorage(r, cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// unknownKeys returns the dotted paths of mapping keys under node that no
+// field of t takes.
+func unknownKeys(node *yaml.Node, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var unknown []string
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fields[name] = f.Type
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			ft, ok := fields[key]
+			if !ok {
+				unknown = append(unknown, path+key)
+				continue
+			}
+			unknown = append(unknown, unknownKeys(node.Content[i+1], ft, path+key+".")...)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			unknown = append(unknown, unknownKeys(item, t.Elem(), fmt.Sprintf("%s%d.", path, i))...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			unknown = append(unknown, unknownKeys(node.Content[i+1], t.Elem(), path+node.Content[i].Value+".")...)
+		}
+	}
+	return unknown
+}
+
+// checkConfig reports settings this binary refuses to start with.
+func checkConfig(r *Report, cfg *config.Config) {
+	engine := cfg.Metadata.Engine
+	if !slices.Contains(metadataEngines, engine) {
+		r.add("config", Blocker, "metadata.engine %q is not supported by this binary and would fall back to sqlite", engine)
+	}
+	backend := cfg.Storage.Backend
+	if !slices.Contains(storageBackends, backend) {
+		r.add("config", Blocker, "storage.backend %q is not supported by this binary and would fall back to local", backend)
+	}
+	if backend == "local" && len(cfg.Storage.Local.RootDirs) > 0 && cfg.Storage.Local.Pack.Enabled {
+		r.add("config", Blocker, "storage.local.pack is not supported with storage.local.root_dirs")
+	}
+	if cfg.BucketReplication.Enabled && engine != "sqlite" {
+		r.add("config", Blocker, "bucket_replication needs the sqlite metadata engine, not %q", engine)
+	}
+	if naming := cfg.Storage.Local.Naming; backend == "local" && naming.Scheme == "hashed" {
+		switch {
+		case engine != "sqlite":
+			r.add("config", Blocker, "storage.local.naming hashed needs the sqlite metadata engine, not %q", engine)
+		case len(cfg.Storage.Local.RootDirs) > 0 || cfg.Storage.Local.Pack.Enabled:
+			r.add("config", Blocker, "storage.local.naming hashed is not supported with storage.local.root_dirs or storage.local.pack")
+		case naming.Secret == "":
+			r.add("config", Blocker, "storage.local.naming hashed needs a secret")
+		}
+	}
+	if cfg.Inventory.Enabled && engine != "sqlite" {
+		r.add("config", Blocker, "inventory needs the sqlite metadata engine, not %q", engine)
+	}
+	if ecfg := cfg.ErasureRequests; ecfg.Enabled {
+		if engine != "sqlite" {
+			r.add("config", Blocker, "erasure_requests needs the sqlite metadata engine, not %q", engine)
+		}
+		if ecfg.SigningKey == "" {
+			r.add("config", Blocker, "erasure_requests needs a signing_key")
+		}
+	}
+	if cfg.HA.Enabled {
+		if !slices.Contains(leaseEngines, engine) {
+			r.add("config", Blocker, "ha needs a metadata engine that supports leases (%s), not %q", strings.Join(leaseEngines, ", "), engine)
+		}
+		if cfg.HA.RenewIntervalMillis >= cfg.HA.LeaseTTLMillis {
+			r.add("config", Blocker, "ha.renew_interval_ms (%d) must be below ha.lease_ttl_ms (%d)", cfg.HA.RenewIntervalMillis, cfg.HA.LeaseTTLMillis)
+		}
+	}
+}
+
+// checkMetadata reports the schema migrations opening the metadata store
+// will apply.
+func checkMetadata(ctx context.Context, r *Report, cfg *config.Config) error {
+	var (
+		status *metadata.SchemaStatus
+		err    error
+		where  string
+	)
+	switch cfg.Metadata.Engine {
+	case "sqlite":
+		where = cfg.Metadata.SQLite.Path
+		status, err = metadata.InspectSQLiteSchema(ctx, where)
+	case "bolt":
+		where = cfg.Metadata.Bolt.Path
+		status, err = metadata.InspectBoltSchema(where)
+	default:
+		r.add("metadata", Info, "engine %q has no versioned schema; nothing to migrate", cfg.Metadata.Engine)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("inspecting metadata schema: %w", err)
+	}
+
+	switch {
+	case !status.Exists:
+		r.add("metadata", Info, "%s does not exist yet; it is created at schema version %d", where, status.Latest)
+	case status.TooNew():
+		r.add("metadata", Blocker, "%s is at schema version %d, newer than this binary's %d; roll it back with the newer binary's 'bleepstore-meta schema -to %d' first",
+			where, status.Current, status.Latest, status.Latest)
+	case len(status.Pending) == 0:
+		r.add("metadata", Info, "%s is at schema version %d, the latest", where, status.Current)
+	default:
+		r.add("metadata", Step, "%s is at schema version %d of %d; take a backup, then starting this binary applies:", where, status.Current, status.Latest)
+		for _, m := range status.Pending {
+			r.add("metadata", Step, "  migration %d: %s", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// checkStorage reports data roots this binary cannot open and layout
+// changes it will make.
+func checkStorage(r *Report, cfg *config.Config) error {
+	var roots []string
+	switch cfg.Storage.Backend {
+	case "local":
+		roots = cfg.Storage.Local.RootDirs
+		if len(roots) == 0 {
+			roots = []string{cfg.Storage.Local.RootDir}
+		}
+	case "mirror":
+		for _, t := range cfg.Storage.Mirror.Targets {
+			roots = append(roots, t.RootDir)
+		}
+	case "erasure":
+		roots = cfg.Storage.Erasure.Disks
+	default:
+		r.add("storage", Info, "backend %q has no versioned layout; nothing to migrate", cfg.Storage.Backend)
+		return nil
+	}
+
+	for _, root := range roots {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			r.add("storage", Info, "%s does not exist yet; it is created with layout version %d", root, storage.LayoutVersion)
+			continue
+		}
+		version, err := storage.ReadLayout(root)
+		if err != nil {
+			return err
+		}
+		switch {
+		case version > storage.LayoutVersion:
+			r.add("storage", Blocker, "%s is at layout version %d, newer than this binary's %d", root, version, storage.LayoutVersion)
+		case version == 0:
+			r.add("storage", Step, "%s has no layout version; starting this binary records version %d without moving data", root, storage.LayoutVersion)
+		default:
+			r.add("storage", Info, "%s is at layout version %d, the latest", root, version)
+		}
+		if cfg.Storage.Backend == "local" && !cfg.Storage.Local.Pack.Enabled {
+			if _, err := os.Stat(filepath.Join(root, storage.PackDirName)); err == nil {
+				r.add("storage", Blocker, "%s holds packed objects but storage.local.pack.enabled is false; they would be unreadable", root)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// writeConfig writes a config for dir with extra appended and returns its
+// path.
+func writeConfig(t *testing.T, dir, extra string) string {
+	t.Helper()
+	path := filepath.Join(dir, "bleepstore.yaml")
+	data := fmt.Sprintf(`metadata:
+  engine: sqlite
+  sqlite:
+    path: %s
+storage:
+  backend: local
+  local:
+    root_dir: %s
+%s`, filepath.Join(dir, "metadata.db"), filepath.Join(dir, "objects"), extra)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// findings returns the findings of sev in r, one "check: message" each.
+func findings(r *Report, sev Severity) []string {
+	var out []string
+	for _, f := range r.Findings {
+		if f.Severity == sev {
+			out = append(out, f.Check+": "+f.Message)
+		}
+	}
+	return out
+}
+
+func TestRunNewDeployment(t *testing.T) {
+	dir := t.TempDir()
+	report, err := Run(context.Background(), writeConfig(t, dir, ""))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Blockers() != 0 || len(findings(report, Warning)) != 0 {
+		t.Errorf("findings = %+v", report.Findings)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "metadata.db")); !os.IsNotExist(err) {
+		t.Error("preflight created the metadata database")
+	}
+}
+
+func TestRunUpgrade(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, latest, _ := meta.SchemaVersion(ctx)
+	if _, err := meta.MigrateSchema(ctx, latest-2); err != nil {
+		t.Fatal(err)
+	}
+	meta.Close()
+	// A data root from before the layout was versioned, holding packed
+	// objects.
+	os.MkdirAll(filepath.Join(dir, "objects", "bucket"), 0o755)
+	os.MkdirAll(filepath.Join(dir, "objects", storage.PackDirName), 0o755)
+
+	path := writeConfig(t, dir, "  retired_option: true\nha:\n  enabled: true\n  lease_ttl_ms: 1000\n  renew_interval_ms: 1000\n")
+	report, err := Run(ctx, path)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	warnings := findings(report, Warning)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "storage.retired_option") {
+		t.Errorf("warnings = %q", warnings)
+	}
+	steps := strings.Join(findings(report, Step), "\n")
+	if !strings.Contains(steps, fmt.Sprintf("version %d of %d", latest-2, latest)) ||
+		!strings.Contains(steps, fmt.Sprintf("migration %d", latest)) || !strings.Contains(steps, "no layout version") {
+		t.Errorf("steps = %s", steps)
+	}
+	blockers := strings.Join(findings(report, Blocker), "\n")
+	if report.Blockers() != 2 || !strings.Contains(blockers, "renew_interval_ms") || !strings.Contains(blockers, "packed objects") {
+		t.Errorf("blockers = %s", blockers)
+	}
+
+	// Nothing was migrated.
+	status, _ := metadata.InspectSQLiteSchema(ctx, filepath.Join(dir, "metadata.db"))
+	if status.Current != latest-2 {
+		t.Errorf("schema version after preflight = %d", status.Current)
+	}
+	if v, _ := storage.ReadLayout(filepath.Join(dir, "objects")); v != 0 {
+		t.Errorf("layout version after preflight = %d", v)
+	}
+}
+
+func TestRunDowngrade(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "objects"), 0o755)
+	os.WriteFile(filepath.Join(dir, "objects", storage.LayoutFileName), []byte("99\n"), 0o644)
+	report, err := Run(context.Background(), writeConfig(t, dir, ""))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if blockers := findings(report, Blocker); len(blockers) != 1 || !strings.Contains(blockers[0], "layout version 99") {
+		t.Errorf("blockers = %q", blockers)
+	}
+}
@@ -0,0 +1,24 @@
+// Package progress carries a progress callback in a context, so that
+// long-running operations deep in the storage layer can report how far
+// they have got to the admin job that started them.
+package progress
+
+import "context"
+
+// Func receives progress: done units of work out of total, which is 0
+// while not known.
+type Func func(done, total int64)
+
+type key struct{}
+
+// With returns a context whose operations report progress to fn.
+func With(ctx context.Context, fn Func) context.Context {
+	return context.WithValue(ctx, key{}, fn)
+}
+
+// Report passes done and total to the Func in ctx, if there is one.
+func Report(ctx context.Context, done, total int64) {
+	if fn, ok := ctx.Value(key{}).(Func); ok {
+		fn(done, total)
+	}
+}
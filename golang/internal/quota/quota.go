@@ -0,0 +1,253 @@
+// Package quota enforces byte and object-count limits on key prefixes within
+// a bucket, so many tenants can share one bucket under separate budgets.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+// ErrExceeded is returned by Reserve when a write would exceed a quota.
+var ErrExceeded = errors.New("quota exceeded")
+
+// scanPageSize is the listing page size used to load a prefix's usage.
+const scanPageSize = 1000
+
+// rule is a configured quota.
+type rule struct {
+	bucket     string
+	pattern    string
+	maxBytes   int64
+	maxObjects int64
+}
+
+// usage holds the running totals for one concrete prefix. Totals are loaded
+// from the metadata store on first use and then updated incrementally by
+// every write and delete under the prefix.
+type usage struct {
+	mu         sync.Mutex
+	loaded     bool
+	bytes      int64
+	objects    int64
+	maxBytes   int64
+	maxObjects int64
+}
+
+// Tracker enforces prefix quotas. A nil *Tracker enforces nothing.
+//
+// Usage is held in memory, so replicas sharing a metadata store each
+// enforce their own view; totals are exact only with a single writer.
+type Tracker struct {
+	meta  metadata.MetadataStore
+	rules []rule
+
+	mu     sync.Mutex
+	usages map[string]*usage // keyed by bucket + "/" + concrete prefix
+}
+
+// New creates a Tracker for the configured quotas. It returns nil if none
+// are configured.
+func New(meta metadata.MetadataStore, quotas []config.PrefixQuotaConfig) (*Tracker, error) {
+	if len(quotas) == 0 {
+		return nil, nil
+	}
+	t := &Tracker{meta: meta, usages: make(map[string]*usage)}
+	for i, q := range quotas {
+		if q.Bucket == "" {
+			return nil, fmt.Errorf("prefix quota %d: bucket is required", i)
+		}
+		if q.MaxBytes < 0 || q.MaxObjects < 0 {
+			return nil, fmt.Errorf("prefix quota %d: limits must not be negative", i)
+		}
+		if q.MaxBytes == 0 && q.MaxObjects == 0 {
+			return nil, fmt.Errorf("prefix quota %d: max_bytes or max_objects is required", i)
+		}
+		t.rules = append(t.rules, rule{bucket: q.Bucket, pattern: q.Prefix, maxBytes: q.MaxBytes, maxObjects: q.MaxObjects})
+	}
+	return t, nil
+}
+
+// matchPrefix reports whether key falls under pattern and returns the
+// concrete prefix it matched, with each "*" replaced by the key's segment.
+func matchPrefix(pattern, key string) (string, bool) {
+	n := 0
+	for {
+		lit, rest, wild := strings.Cut(pattern, "*")
+		if !strings.HasPrefix(key[n:], lit) {
+			return "", false
+		}
+		n += len(lit)
+		if !wild {
+			return key[:n], true
+		}
+		seg := strings.IndexByte(key[n:], '/')
+		if seg < 0 {
+			seg = len(key) - n
+		}
+		if seg == 0 {
+			return "", false
+		}
+		n += seg
+		pattern = rest
+	}
+}
+
+// Applies reports whether any quota covers the key. Callers use it to skip
+// the lookup of the existing object when no quota is involved.
+func (t *Tracker) Applies(bucket, key string) bool {
+	if t == nil {
+		return false
+	}
+	for _, r := range t.rules {
+		if r.bucket != bucket {
+			continue
+		}
+		if _, ok := matchPrefix(r.pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Reservation is usage added by Reserve on behalf of an in-flight write.
+type Reservation struct {
+	usages  []*usage
+	bytes   int64
+	objects int64
+}
+
+// Cancel returns the reserved usage after the write failed. It is safe to
+// call on a nil Reservation.
+func (res *Reservation) Cancel() {
+	if res == nil {
+		return
+	}
+	for _, u := range res.usages {
+		u.mu.Lock()
+		u.bytes -= res.bytes
+		u.objects -= res.objects
+		u.mu.Unlock()
+	}
+}
+
+// Reserve adds a change of bytes and objects under key to every quota
+// covering it, or returns ErrExceeded if an increase would go over a limit.
+// Decreases always succeed. The change is applied immediately so concurrent
+// writes cannot overshoot together; call Cancel if the write then fails.
+func (t *Tracker) Reserve(ctx context.Context, bucket, key string, bytes, objects int64) (*Reservation, error) {
+	if t == nil {
+		return nil, nil
+	}
+	usages, prefixes := t.usagesFor(bucket, key)
+	if len(usages) == 0 {
+		return nil, nil
+	}
+
+	// Lock in a consistent order so overlapping quotas cannot deadlock.
+	for _, u := range usages {
+		u.mu.Lock()
+	}
+	defer func() {
+		for _, u := range usages {
+			u.mu.Unlock()
+		}
+	}()
+
+	for i, u := range usages {
+		if !u.loaded {
+			if err := t.load(ctx, u, bucket, prefixes[i]); err != nil {
+				return nil, err
+			}
+		}
+		if bytes > 0 && u.maxBytes > 0 && u.bytes+bytes > u.maxBytes {
+			return nil, ErrExceeded
+		}
+		if objects > 0 && u.maxObjects > 0 && u.objects+objects > u.maxObjects {
+			return nil, ErrExceeded
+		}
+	}
+	for _, u := range usages {
+		u.bytes += bytes
+		u.objects += objects
+	}
+	return &Reservation{usages: usages, bytes: bytes, objects: objects}, nil
+}
+
+// usagesFor returns the usage entries for every quota covering key, sorted
+// by prefix, along with their concrete prefixes. Quotas resolving to the
+// same prefix share one entry holding the tighter of their limits.
+func (t *Tracker) usagesFor(bucket, key string) ([]*usage, []string) {
+	limits := make(map[string]rule)
+	for _, r := range t.rules {
+		if r.bucket != bucket {
+			continue
+		}
+		prefix, ok := matchPrefix(r.pattern, key)
+		if !ok {
+			continue
+		}
+		if cur, seen := limits[prefix]; seen {
+			r.maxBytes = tighter(cur.maxBytes, r.maxBytes)
+			r.maxObjects = tighter(cur.maxObjects, r.maxObjects)
+		}
+		limits[prefix] = r
+	}
+
+	prefixes := make([]string, 0, len(limits))
+	for prefix := range limits {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usages := make([]*usage, len(prefixes))
+	for i, prefix := range prefixes {
+		id := bucket + "/" + prefix
+		u, ok := t.usages[id]
+		if !ok {
+			u = &usage{maxBytes: limits[prefix].maxBytes, maxObjects: limits[prefix].maxObjects}
+			t.usages[id] = u
+		}
+		usages[i] = u
+	}
+	return usages, prefixes
+}
+
+// tighter returns the smaller non-zero limit.
+func tighter(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// load initializes u from the objects currently stored under prefix. The
+// caller holds u.mu.
+func (t *Tracker) load(ctx context.Context, u *usage, bucket, prefix string) error {
+	var bytes, objects int64
+	opts := metadata.ListObjectsOptions{Prefix: prefix, MaxKeys: scanPageSize}
+	for {
+		page, err := t.meta.ListObjects(ctx, bucket, opts)
+		if err != nil {
+			return fmt.Errorf("loading usage for %s/%s: %w", bucket, prefix, err)
+		}
+		for _, obj := range page.Objects {
+			bytes += obj.Size
+			objects++
+		}
+		if !page.IsTruncated || len(page.Objects) == 0 {
+			break
+		}
+		opts.StartAfter = page.Objects[len(page.Objects)-1].Key
+	}
+	u.bytes, u.objects, u.loaded = bytes, objects, true
+	return nil
+}
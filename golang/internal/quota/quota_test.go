@@ -0,0 +1,79 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+func TestMatchPrefix(t *testing.T) {
+	tests := []struct {
+		pattern, key, want string
+		ok                 bool
+	}{
+		{"logs/", "logs/a", "logs/", true},
+		{"logs/", "other/a", "", false},
+		{"", "anything", "", true},
+		{"projects/*/", "projects/42/data/x", "projects/42/", true},
+		{"projects/*/", "projects/42", "", false},
+		{"projects/*/", "projects//x", "", false},
+		{"projects/*", "projects/42/x", "projects/42", true},
+		{"t/*/p/*/", "t/a/p/b/c", "t/a/p/b/", true},
+	}
+	for _, tt := range tests {
+		got, ok := matchPrefix(tt.pattern, tt.key)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("matchPrefix(%q, %q) = %q, %v; want %q, %v", tt.pattern, tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ctx := context.Background()
+	meta := metadata.NewMemoryStore()
+	meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "b", CreatedAt: time.Now()})
+	meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "b", Key: "projects/1/existing", Size: 60})
+
+	tr, err := New(meta, []config.PrefixQuotaConfig{
+		{Bucket: "b", Prefix: "projects/*/", MaxBytes: 100},
+		{Bucket: "b", Prefix: "projects/", MaxObjects: 3},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Existing usage is loaded on first use.
+	if _, err := tr.Reserve(ctx, "b", "projects/1/big", 41, 1); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Reserve over byte limit = %v, want ErrExceeded", err)
+	}
+	res, err := tr.Reserve(ctx, "b", "projects/1/ok", 40, 1)
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	// Each project has its own byte quota but they share the object quota.
+	if _, err := tr.Reserve(ctx, "b", "projects/2/a", 100, 1); err != nil {
+		t.Errorf("Reserve in other project: %v", err)
+	}
+	if _, err := tr.Reserve(ctx, "b", "projects/3/a", 1, 1); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Reserve over object limit = %v, want ErrExceeded", err)
+	}
+	res.Cancel()
+	if _, err := tr.Reserve(ctx, "b", "projects/3/a", 1, 1); err != nil {
+		t.Errorf("Reserve after cancel: %v", err)
+	}
+	// Deletes always succeed.
+	if _, err := tr.Reserve(ctx, "b", "projects/1/existing", -60, -1); err != nil {
+		t.Errorf("Reserve for delete: %v", err)
+	}
+
+	if tr.Applies("b", "other/x") || tr.Applies("c", "projects/1/x") {
+		t.Error("Applies matched a key outside every quota")
+	}
+	if _, err := New(meta, []config.PrefixQuotaConfig{{Bucket: "b", Prefix: "x/"}}); err == nil {
+		t.Error("expected error for quota without limits")
+	}
+}
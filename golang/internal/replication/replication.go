@@ -0,0 +1,224 @@
+// Package replication holds bucket replication rules and queues the object
+// writes and deletes they select for asynchronous copying to a remote
+// S3-compatible endpoint.
+package replication
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// ErrInvalidConfig is wrapped by the errors Put returns for a replication
+// configuration it does not accept.
+var ErrInvalidConfig = errors.New("invalid replication configuration")
+
+// maxRules is the most rules a configuration may hold, as in S3.
+const maxRules = 1000
+
+// arnPrefix begins a destination bucket ARN.
+const arnPrefix = "arn:aws:s3:::"
+
+// Rules holds the replication configuration of every bucket and queues
+// writes and deletes that a rule selects. A nil *Rules replicates nothing.
+//
+// Configurations are cached in memory, so replicas sharing a metadata store
+// see a configuration changed through another replica only after a
+// restart.
+type Rules struct {
+	store metadata.ReplicationStore
+
+	mu      sync.RWMutex
+	configs map[string]*xmlutil.ReplicationConfiguration
+}
+
+// New loads the stored replication configurations.
+func New(ctx context.Context, store metadata.ReplicationStore) (*Rules, error) {
+	stored, err := store.ListBucketReplications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &Rules{store: store, configs: make(map[string]*xmlutil.ReplicationConfiguration, len(stored))}
+	for bucket, doc := range stored {
+		cfg := &xmlutil.ReplicationConfiguration{}
+		if err := xml.Unmarshal(doc, cfg); err != nil {
+			return nil, fmt.Errorf("decoding replication configuration of %s: %w", bucket, err)
+		}
+		r.configs[bucket] = cfg
+	}
+	return r, nil
+}
+
+// Get returns a bucket's configuration, or nil if it has none.
+func (r *Rules) Get(bucket string) *xmlutil.ReplicationConfiguration {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.configs[bucket]
+}
+
+// Buckets returns the names of the buckets with a configuration, sorted.
+func (r *Rules) Buckets() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	buckets := make([]string, 0, len(r.configs))
+	for bucket := range r.configs {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+// Put validates and stores a bucket's configuration, replacing any
+// existing one. Objects already written are not replicated.
+func (r *Rules) Put(ctx context.Context, bucket string, cfg *xmlutil.ReplicationConfiguration) error {
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	doc, err := xml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := r.store.PutBucketReplication(ctx, bucket, doc); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.configs[bucket] = cfg
+	r.mu.Unlock()
+	return nil
+}
+
+// Delete removes a bucket's configuration. Queued tasks for the bucket are
+// left to fail.
+func (r *Rules) Delete(ctx context.Context, bucket string) error {
+	if err := r.store.DeleteBucketReplication(ctx, bucket); err != nil {
+		return err
+	}
+	r.Forget(bucket)
+	return nil
+}
+
+// Forget drops a bucket's cached configuration after the bucket itself was
+// deleted, which removes the stored configuration.
+func (r *Rules) Forget(bucket string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	delete(r.configs, bucket)
+	r.mu.Unlock()
+}
+
+// Validate checks a configuration. Rules filtering on tags are rejected:
+// objects here have no tags to match.
+func Validate(cfg *xmlutil.ReplicationConfiguration) error {
+	if len(cfg.Rules) == 0 {
+		return fmt.Errorf("%w: at least one rule is required", ErrInvalidConfig)
+	}
+	if len(cfg.Rules) > maxRules {
+		return fmt.Errorf("%w: more than %d rules", ErrInvalidConfig, maxRules)
+	}
+	ids := map[string]bool{}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return fmt.Errorf("%w: duplicate rule ID %q", ErrInvalidConfig, rule.ID)
+			}
+			ids[rule.ID] = true
+		}
+		if rule.Status != "Enabled" && rule.Status != "Disabled" {
+			return fmt.Errorf("%w: rule %d: status must be Enabled or Disabled", ErrInvalidConfig, i+1)
+		}
+		if rule.Prefix != nil && rule.Filter != nil {
+			return fmt.Errorf("%w: rule %d: Prefix and Filter are mutually exclusive", ErrInvalidConfig, i+1)
+		}
+		if rule.Filter != nil && (rule.Filter.Tag != nil || rule.Filter.And != nil) {
+			return fmt.Errorf("%w: rule %d: tag filters are not supported", ErrInvalidConfig, i+1)
+		}
+		if m := rule.DeleteMarkerReplication; m != nil && m.Status != "Enabled" && m.Status != "Disabled" {
+			return fmt.Errorf("%w: rule %d: DeleteMarkerReplication status must be Enabled or Disabled", ErrInvalidConfig, i+1)
+		}
+		if DestinationBucket(rule) == "" {
+			return fmt.Errorf("%w: rule %d: destination bucket is required", ErrInvalidConfig, i+1)
+		}
+	}
+	return nil
+}
+
+// DestinationBucket returns the name of a rule's destination bucket, given
+// as an ARN or a plain name, or "" if it is missing.
+func DestinationBucket(rule *xmlutil.ReplicationRule) string {
+	return strings.TrimPrefix(rule.Destination.Bucket, arnPrefix)
+}
+
+// prefix returns the key prefix a rule selects.
+func prefix(rule *xmlutil.ReplicationRule) string {
+	switch {
+	case rule.Prefix != nil:
+		return *rule.Prefix
+	case rule.Filter != nil:
+		return rule.Filter.Prefix
+	}
+	return ""
+}
+
+// Match returns the enabled rule that applies to a key, or nil. When
+// several match, the one with the highest priority wins, then the first.
+func (r *Rules) Match(bucket, key string) *xmlutil.ReplicationRule {
+	cfg := r.Get(bucket)
+	if cfg == nil {
+		return nil
+	}
+	var best *xmlutil.ReplicationRule
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Status != "Enabled" || !strings.HasPrefix(key, prefix(rule)) {
+			continue
+		}
+		if best == nil || rule.Priority > best.Priority {
+			best = rule
+		}
+	}
+	return best
+}
+
+// Status returns the replication status a new object starts with:
+// metadata.ReplicationPending if a rule applies to it, otherwise "".
+func (r *Rules) Status(bucket, key string) string {
+	if r.Match(bucket, key) == nil {
+		return ""
+	}
+	return metadata.ReplicationPending
+}
+
+// EnqueueWrite queues a committed object for replication if it is pending.
+func (r *Rules) EnqueueWrite(ctx context.Context, obj *metadata.ObjectRecord) error {
+	if r == nil || obj.ReplicationStatus != metadata.ReplicationPending {
+		return nil
+	}
+	return r.store.EnqueueReplication(ctx, metadata.ReplicationTask{Bucket: obj.Bucket, Key: obj.Key, ETag: obj.ETag})
+}
+
+// EnqueueDelete queues the deletion of a key for replication if a rule
+// applies to it and replicates deletes. The task replaces a queued write of
+// the key, which no longer needs copying.
+func (r *Rules) EnqueueDelete(ctx context.Context, bucket, key string) error {
+	rule := r.Match(bucket, key)
+	if rule == nil || rule.DeleteMarkerReplication == nil || rule.DeleteMarkerReplication.Status != "Enabled" {
+		return nil
+	}
+	return r.store.EnqueueReplication(ctx, metadata.ReplicationTask{Bucket: bucket, Key: key, Delete: true})
+}
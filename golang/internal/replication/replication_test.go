@@ -0,0 +1,107 @@
+package replication
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+func parse(t *testing.T, doc string) *xmlutil.ReplicationConfiguration {
+	t.Helper()
+	cfg := &xmlutil.ReplicationConfiguration{}
+	if err := xml.Unmarshal([]byte(doc), cfg); err != nil {
+		t.Fatalf("decoding %s: %v", doc, err)
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	dest := `<Destination><Bucket>arn:aws:s3:::dst</Bucket></Destination>`
+	for name, doc := range map[string]string{
+		"no rules":       `<ReplicationConfiguration/>`,
+		"bad status":     `<ReplicationConfiguration><Rule><Status>On</Status>` + dest + `</Rule></ReplicationConfiguration>`,
+		"no destination": `<ReplicationConfiguration><Rule><Status>Enabled</Status></Rule></ReplicationConfiguration>`,
+		"tag filter": `<ReplicationConfiguration><Rule><Status>Enabled</Status>
+			<Filter><Tag><Key>k</Key><Value>v</Value></Tag></Filter>` + dest + `</Rule></ReplicationConfiguration>`,
+		"prefix and filter": `<ReplicationConfiguration><Rule><Status>Enabled</Status><Prefix>a</Prefix>
+			<Filter><Prefix>b</Prefix></Filter>` + dest + `</Rule></ReplicationConfiguration>`,
+		"duplicate id": `<ReplicationConfiguration>
+			<Rule><ID>r</ID><Status>Enabled</Status>` + dest + `</Rule>
+			<Rule><ID>r</ID><Status>Enabled</Status>` + dest + `</Rule></ReplicationConfiguration>`,
+	} {
+		if err := Validate(parse(t, doc)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: Validate = %v, want ErrInvalidConfig", name, err)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	ctx := context.Background()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+
+	r, err := New(ctx, meta)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	cfg := parse(t, `<ReplicationConfiguration>
+		<Rule><ID>all</ID><Status>Enabled</Status><Priority>1</Priority><Filter><Prefix></Prefix></Filter>
+			<Destination><Bucket>arn:aws:s3:::everything</Bucket></Destination></Rule>
+		<Rule><ID>logs</ID><Status>Enabled</Status><Priority>2</Priority><Filter><Prefix>logs/</Prefix></Filter>
+			<Destination><Bucket>log-archive</Bucket></Destination>
+			<DeleteMarkerReplication><Status>Enabled</Status></DeleteMarkerReplication></Rule>
+		<Rule><ID>off</ID><Status>Disabled</Status><Priority>3</Priority><Prefix>logs/</Prefix>
+			<Destination><Bucket>unused</Bucket></Destination></Rule>
+	</ReplicationConfiguration>`)
+	if err := r.Put(ctx, "src", cfg); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// The configuration survives a reload.
+	if r, err = New(ctx, meta); err != nil {
+		t.Fatalf("New (reload): %v", err)
+	}
+	if rule := r.Match("src", "logs/today"); rule == nil || DestinationBucket(rule) != "log-archive" {
+		t.Errorf("Match(logs/today) = %+v, want the logs rule", rule)
+	}
+	if rule := r.Match("src", "data"); rule == nil || DestinationBucket(rule) != "everything" {
+		t.Errorf("Match(data) = %+v, want the catch-all rule", rule)
+	}
+	if r.Status("other", "data") != "" || r.Status("src", "data") != metadata.ReplicationPending {
+		t.Error("Status does not follow the rules")
+	}
+
+	// Only the logs rule replicates deletes.
+	now := time.Now()
+	r.EnqueueDelete(ctx, "src", "data")
+	r.EnqueueDelete(ctx, "src", "logs/old")
+	r.EnqueueWrite(ctx, &metadata.ObjectRecord{Bucket: "src", Key: "data", ETag: `"e"`, ReplicationStatus: metadata.ReplicationPending})
+	tasks, _ := meta.ListReplication(ctx, now.Add(time.Second), 10)
+	queued := map[string]bool{}
+	for _, task := range tasks {
+		queued[task.Key] = task.Delete
+	}
+	if len(tasks) != 2 || !queued["logs/old"] || queued["data"] {
+		t.Errorf("queue = %+v, want the logs delete and the write", tasks)
+	}
+
+	if err := r.Delete(ctx, "src"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if r.Match("src", "data") != nil {
+		t.Error("rule still matches after Delete")
+	}
+	var none *Rules
+	if none.Status("src", "data") != "" || none.EnqueueDelete(ctx, "src", "logs/x") != nil {
+		t.Error("nil Rules replicated")
+	}
+}
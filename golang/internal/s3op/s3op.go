@@ -0,0 +1,245 @@
+// Package s3op names the S3 API operations BleepStore serves and maps each
+// request to one through a declarative route table. The server dispatches on
+// the operation name, and metrics, logging, policy checks and per-operation
+// feature flags all use the same name, so they never disagree about what a
+// request is.
+package s3op
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Operation is the name of an S3 API operation, e.g. "PutObject".
+type Operation string
+
+// The S3 operations BleepStore routes.
+const (
+	ListBuckets             Operation = "ListBuckets"
+	CreateBucket            Operation = "CreateBucket"
+	DeleteBucket            Operation = "DeleteBucket"
+	HeadBucket              Operation = "HeadBucket"
+	GetBucketLocation       Operation = "GetBucketLocation"
+	GetBucketAcl            Operation = "GetBucketAcl"
+	PutBucketAcl            Operation = "PutBucketAcl"
+	ListObjects             Operation = "ListObjects"
+	ListObjectsV2           Operation = "ListObjectsV2"
+	DeleteObjects           Operation = "DeleteObjects"
+	PutObject               Operation = "PutObject"
+	CopyObject              Operation = "CopyObject"
+	GetObject               Operation = "GetObject"
+	HeadObject              Operation = "HeadObject"
+	DeleteObject            Operation = "DeleteObject"
+	GetObjectAcl            Operation = "GetObjectAcl"
+	PutObjectAcl            Operation = "PutObjectAcl"
+	CreateMultipartUpload   Operation = "CreateMultipartUpload"
+	UploadPart              Operation = "UploadPart"
+	CompleteMultipartUpload Operation = "CompleteMultipartUpload"
+	AbortMultipartUpload    Operation = "AbortMultipartUpload"
+	ListParts               Operation = "ListParts"
+	ListMultipartUploads    Operation = "ListMultipartUploads"
+	PutBucketReplication    Operation = "PutBucketReplication"
+	GetBucketReplication    Operation = "GetBucketReplication"
+	DeleteBucketReplication Operation = "DeleteBucketReplication"
+
+	PutBucketInventoryConfiguration    Operation = "PutBucketInventoryConfiguration"
+	GetBucketInventoryConfiguration    Operation = "GetBucketInventoryConfiguration"
+	ListBucketInventoryConfigurations  Operation = "ListBucketInventoryConfigurations"
+	DeleteBucketInventoryConfiguration Operation = "DeleteBucketInventoryConfiguration"
+
+	PutBucketWebsite    Operation = "PutBucketWebsite"
+	GetBucketWebsite    Operation = "GetBucketWebsite"
+	DeleteBucketWebsite Operation = "DeleteBucketWebsite"
+
+	// GetCapabilities is the BleepStore extension GET /?bleepstore-capabilities.
+	GetCapabilities Operation = "GetCapabilities"
+	// HeadObjects is the BleepStore extension POST /bucket?bleepstore-head-batch.
+	HeadObjects Operation = "HeadObjects"
+	// BulkGetObjects is the BleepStore extension POST /bucket?bleepstore-bulk-get.
+	BulkGetObjects Operation = "BulkGetObjects"
+
+	// Unknown is returned for requests that match no route.
+	Unknown Operation = "Unknown"
+)
+
+// Scope is the level of the resource a request addresses.
+type Scope int
+
+const (
+	// ScopeService is a request for "/" (no bucket).
+	ScopeService Scope = iota
+	// ScopeBucket is a request for "/bucket".
+	ScopeBucket
+	// ScopeObject is a request for "/bucket/key".
+	ScopeObject
+)
+
+// ScopeOf returns the scope of a request for bucket and key.
+func ScopeOf(bucket, key string) Scope {
+	switch {
+	case bucket == "":
+		return ScopeService
+	case key == "":
+		return ScopeBucket
+	default:
+		return ScopeObject
+	}
+}
+
+// Route maps a request shape to an operation.
+type Route struct {
+	Method string
+	Scope  Scope
+	// Query lists query parameters that must all be present.
+	Query []string
+	// Header, if set, names a header that must be non-empty.
+	Header    string
+	Operation Operation
+}
+
+// Routes is the dispatch table. Routes are tried in order and the first
+// match wins, so more specific routes come before the catch-all for each
+// method and scope.
+var Routes = []Route{
+	{Method: http.MethodGet, Scope: ScopeService, Query: []string{"bleepstore-capabilities"}, Operation: GetCapabilities},
+	{Method: http.MethodGet, Scope: ScopeService, Operation: ListBuckets},
+
+	{Method: http.MethodPut, Scope: ScopeBucket, Query: []string{"acl"}, Operation: PutBucketAcl},
+	{Method: http.MethodPut, Scope: ScopeBucket, Query: []string{"replication"}, Operation: PutBucketReplication},
+	{Method: http.MethodPut, Scope: ScopeBucket, Query: []string{"inventory"}, Operation: PutBucketInventoryConfiguration},
+	{Method: http.MethodPut, Scope: ScopeBucket, Query: []string{"website"}, Operation: PutBucketWebsite},
+	{Method: http.MethodPut, Scope: ScopeBucket, Operation: CreateBucket},
+	{Method: http.MethodGet, Scope: ScopeBucket, Query: []string{"location"}, Operation: GetBucketLocation},
+	{Method: http.MethodGet, Scope: ScopeBucket, Query: []string{"acl"}, Operation: GetBucketAcl},
+	{Method: http.MethodGet, Scope: ScopeBucket, Query: []string{"replication"}, Operation: GetBucketReplication},
+	{Method: http.MethodGet, Scope: ScopeBucket, Query: []string{"inventory", "id"}, Operation: GetBucketInventoryConfiguration},
+	{Method: http.MethodGet, Scope: ScopeBucket, Query: []string{"inventory"}, Operation: ListBucketInventoryConfigurations},
+	{Method: http.MethodGet, Scope: ScopeBucket, Query: []string{"website"}, Operation: GetBucketWebsite},
+	{Method: http.MethodGet, Scope: ScopeBucket, Query: []string{"uploads"}, Operation: ListMultipartUploads},
+	{Method: http.MethodGet, Scope: ScopeBucket, Query: []string{"list-type"}, Operation: ListObjectsV2},
+	{Method: http.MethodGet, Scope: ScopeBucket, Operation: ListObjects},
+	{Method: http.MethodHead, Scope: ScopeBucket, Operation: HeadBucket},
+	{Method: http.MethodDelete, Scope: ScopeBucket, Query: []string{"replication"}, Operation: DeleteBucketReplication},
+	{Method: http.MethodDelete, Scope: ScopeBucket, Query: []string{"inventory"}, Operation: DeleteBucketInventoryConfiguration},
+	{Method: http.MethodDelete, Scope: ScopeBucket, Query: []string{"website"}, Operation: DeleteBucketWebsite},
+	{Method: http.MethodDelete, Scope: ScopeBucket, Operation: DeleteBucket},
+	{Method: http.MethodPost, Scope: ScopeBucket, Query: []string{"delete"}, Operation: DeleteObjects},
+	{Method: http.MethodPost, Scope: ScopeBucket, Query: []string{"bleepstore-head-batch"}, Operation: HeadObjects},
+	{Method: http.MethodPost, Scope: ScopeBucket, Query: []string{"bleepstore-bulk-get"}, Operation: BulkGetObjects},
+
+	{Method: http.MethodPut, Scope: ScopeObject, Query: []string{"partNumber", "uploadId"}, Operation: UploadPart},
+	{Method: http.MethodPut, Scope: ScopeObject, Header: "X-Amz-Copy-Source", Operation: CopyObject},
+	{Method: http.MethodPut, Scope: ScopeObject, Query: []string{"acl"}, Operation: PutObjectAcl},
+	{Method: http.MethodPut, Scope: ScopeObject, Operation: PutObject},
+	{Method: http.MethodGet, Scope: ScopeObject, Query: []string{"acl"}, Operation: GetObjectAcl},
+	{Method: http.MethodGet, Scope: ScopeObject, Query: []string{"uploadId"}, Operation: ListParts},
+	{Method: http.MethodGet, Scope: ScopeObject, Operation: GetObject},
+	{Method: http.MethodHead, Scope: ScopeObject, Operation: HeadObject},
+	{Method: http.MethodDelete, Scope: ScopeObject, Query: []string{"uploadId"}, Operation: AbortMultipartUpload},
+	{Method: http.MethodDelete, Scope: ScopeObject, Operation: DeleteObject},
+	{Method: http.MethodPost, Scope: ScopeObject, Query: []string{"uploadId"}, Operation: CompleteMultipartUpload},
+	{Method: http.MethodPost, Scope: ScopeObject, Query: []string{"uploads"}, Operation: CreateMultipartUpload},
+}
+
+// matches reports whether the route applies to a request.
+func (rt *Route) matches(method string, scope Scope, q url.Values, h http.Header) bool {
+	if rt.Method != method || rt.Scope != scope {
+		return false
+	}
+	for _, name := range rt.Query {
+		if !q.Has(name) {
+			return false
+		}
+	}
+	return rt.Header == "" || h.Get(rt.Header) != ""
+}
+
+// Classify returns the operation for a request with the given method,
+// path-style bucket and key, query and headers, or Unknown.
+func Classify(method, bucket, key string, q url.Values, h http.Header) Operation {
+	scope := ScopeOf(bucket, key)
+	for i := range Routes {
+		if Routes[i].matches(method, scope, q, h) {
+			return Routes[i].Operation
+		}
+	}
+	return Unknown
+}
+
+// FromRequest classifies r, reading the bucket and key from its path.
+func FromRequest(r *http.Request) Operation {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	return Classify(r.Method, bucket, key, r.URL.Query(), r.Header)
+}
+
+// info describes an operation for policy checks.
+type info struct {
+	action string // IAM action, e.g. "s3:GetObject"
+	write  bool   // modifies buckets, objects or uploads
+}
+
+var operations = map[Operation]info{
+	ListBuckets:             {"s3:ListAllMyBuckets", false},
+	CreateBucket:            {"s3:CreateBucket", true},
+	DeleteBucket:            {"s3:DeleteBucket", true},
+	HeadBucket:              {"s3:ListBucket", false},
+	GetBucketLocation:       {"s3:GetBucketLocation", false},
+	GetBucketAcl:            {"s3:GetBucketAcl", false},
+	PutBucketAcl:            {"s3:PutBucketAcl", true},
+	ListObjects:             {"s3:ListBucket", false},
+	ListObjectsV2:           {"s3:ListBucket", false},
+	DeleteObjects:           {"s3:DeleteObject", true},
+	PutObject:               {"s3:PutObject", true},
+	CopyObject:              {"s3:PutObject", true},
+	GetObject:               {"s3:GetObject", false},
+	HeadObject:              {"s3:GetObject", false},
+	DeleteObject:            {"s3:DeleteObject", true},
+	GetObjectAcl:            {"s3:GetObjectAcl", false},
+	PutObjectAcl:            {"s3:PutObjectAcl", true},
+	CreateMultipartUpload:   {"s3:PutObject", true},
+	UploadPart:              {"s3:PutObject", true},
+	CompleteMultipartUpload: {"s3:PutObject", true},
+	AbortMultipartUpload:    {"s3:AbortMultipartUpload", true},
+	ListParts:               {"s3:ListMultipartUploadParts", false},
+	ListMultipartUploads:    {"s3:ListBucketMultipartUploads", false},
+	PutBucketReplication:    {"s3:PutReplicationConfiguration", true},
+	GetBucketReplication:    {"s3:GetReplicationConfiguration", false},
+	DeleteBucketReplication: {"s3:PutReplicationConfiguration", true},
+	GetCapabilities:         {"bleepstore:GetCapabilities", false},
+	HeadObjects:             {"s3:GetObject", false},
+	BulkGetObjects:          {"s3:GetObject", false},
+
+	PutBucketInventoryConfiguration:    {"s3:PutInventoryConfiguration", true},
+	GetBucketInventoryConfiguration:    {"s3:GetInventoryConfiguration", false},
+	ListBucketInventoryConfigurations:  {"s3:GetInventoryConfiguration", false},
+	DeleteBucketInventoryConfiguration: {"s3:PutInventoryConfiguration", true},
+
+	PutBucketWebsite:    {"s3:PutBucketWebsite", true},
+	GetBucketWebsite:    {"s3:GetBucketWebsite", false},
+	DeleteBucketWebsite: {"s3:DeleteBucketWebsite", true},
+}
+
+// Known reports whether op is a routed operation.
+func (op Operation) Known() bool {
+	_, ok := operations[op]
+	return ok
+}
+
+// Action returns the IAM policy action that authorizes op, or "" for
+// Unknown.
+func (op Operation) Action() string {
+	return operations[op].action
+}
+
+// IsWrite reports whether op modifies state.
+func (op Operation) IsWrite() bool {
+	return operations[op].write
+}
+
+// IsRead reports whether op is a known read-only operation. Unknown is
+// neither a read nor a write.
+func (op Operation) IsRead() bool {
+	i, ok := operations[op]
+	return ok && !i.write
+}
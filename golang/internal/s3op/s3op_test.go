@@ -0,0 +1,82 @@
+package s3op
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		method, target string
+		header         string
+		want           Operation
+	}{
+		{"GET", "/", "", ListBuckets},
+		{"GET", "/?bleepstore-capabilities", "", GetCapabilities},
+		{"POST", "/", "", Unknown},
+		{"PUT", "/b", "", CreateBucket},
+		{"PUT", "/b?acl", "", PutBucketAcl},
+		{"GET", "/b", "", ListObjects},
+		{"GET", "/b?list-type=2", "", ListObjectsV2},
+		{"GET", "/b?location", "", GetBucketLocation},
+		{"GET", "/b?uploads", "", ListMultipartUploads},
+		{"PUT", "/b?replication", "", PutBucketReplication},
+		{"GET", "/b?replication", "", GetBucketReplication},
+		{"DELETE", "/b?replication", "", DeleteBucketReplication},
+		{"PUT", "/b?inventory&id=i", "", PutBucketInventoryConfiguration},
+		{"GET", "/b?inventory&id=i", "", GetBucketInventoryConfiguration},
+		{"GET", "/b?inventory", "", ListBucketInventoryConfigurations},
+		{"DELETE", "/b?inventory&id=i", "", DeleteBucketInventoryConfiguration},
+		{"PUT", "/b?website", "", PutBucketWebsite},
+		{"GET", "/b?website", "", GetBucketWebsite},
+		{"DELETE", "/b?website", "", DeleteBucketWebsite},
+		{"DELETE", "/b", "", DeleteBucket},
+		{"HEAD", "/b/", "", HeadBucket},
+		{"POST", "/b?delete", "", DeleteObjects},
+		{"POST", "/b?bleepstore-head-batch", "", HeadObjects},
+		{"POST", "/b?bleepstore-bulk-get", "", BulkGetObjects},
+		{"POST", "/b", "", Unknown},
+		{"PUT", "/b/k", "", PutObject},
+		{"PUT", "/b/k", "/src/obj", CopyObject},
+		{"PUT", "/b/k?partNumber=1&uploadId=u", "", UploadPart},
+		{"PUT", "/b/k?partNumber=1&uploadId=u", "/src/obj", UploadPart},
+		{"PUT", "/b/k?acl", "", PutObjectAcl},
+		{"GET", "/b/a/b/c", "", GetObject},
+		{"GET", "/b/k?partNumber=2", "", GetObject},
+		{"HEAD", "/b/k?partNumber=2", "", HeadObject},
+		{"GET", "/b/k?uploadId=u", "", ListParts},
+		{"HEAD", "/b/k", "", HeadObject},
+		{"DELETE", "/b/k?uploadId=u", "", AbortMultipartUpload},
+		{"POST", "/b/k?uploads", "", CreateMultipartUpload},
+		{"POST", "/b/k?uploadId=u", "", CompleteMultipartUpload},
+		{"PATCH", "/b/k", "", Unknown},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.header != "" {
+			r.Header.Set("X-Amz-Copy-Source", tt.header)
+		}
+		if got := FromRequest(r); got != tt.want {
+			t.Errorf("%s %s (copy source %q) = %s, want %s", tt.method, tt.target, tt.header, got, tt.want)
+		}
+	}
+}
+
+// TestRoutesAreDescribed verifies that every routed operation has policy
+// metadata, so a new route cannot silently be neither read nor write.
+func TestRoutesAreDescribed(t *testing.T) {
+	for _, rt := range Routes {
+		if !rt.Operation.Known() || rt.Operation.Action() == "" {
+			t.Errorf("route %s %v -> %s has no operation info", rt.Method, rt.Query, rt.Operation)
+		}
+		if rt.Operation.IsRead() == rt.Operation.IsWrite() {
+			t.Errorf("%s is both or neither read and write", rt.Operation)
+		}
+	}
+	if Unknown.IsRead() || Unknown.IsWrite() || Unknown.Known() {
+		t.Error("Unknown should be neither read nor write")
+	}
+	if got := HeadObject.Action(); got != "s3:GetObject" {
+		t.Errorf("HeadObject.Action() = %q", got)
+	}
+}
@@ -0,0 +1,162 @@
+package serialization
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// NDJSON exports hold one JSON value per line so that exports and imports
+// stream in constant memory regardless of database size. The first line is
+// the envelope, with "format": "ndjson" and the exported tables in
+// "tables"; every following line is one row:
+//
+//	{"bleepstore_export":{"exported_at":"...","format":"ndjson","schema_version":1,"source":"go/0.1.0","tables":["buckets","objects"],"version":1}}
+//	{"row":{"acl":{},"created_at":"...","name":"b",...},"table":"buckets"}
+//
+// Rows use the same column conventions as the JSON format, and tables are
+// written in dependency order so an import can insert them as it reads.
+
+// FormatNDJSON is the envelope "format" of an NDJSON export.
+const FormatNDJSON = "ndjson"
+
+// ndjsonRow is one row line of an NDJSON export.
+type ndjsonRow struct {
+	Table string         `json:"table"`
+	Row   map[string]any `json:"row"`
+}
+
+// ExportMetadataNDJSON streams metadata from SQLite to w as NDJSON.
+func ExportMetadataNDJSON(dbPath string, w io.Writer, opts *ExportOptions) error {
+	if opts == nil {
+		opts = &ExportOptions{Tables: AllTables}
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+	defer db.Close()
+
+	tables := make([]string, 0, len(opts.Tables))
+	for _, table := range insertOrder {
+		if slices.Contains(opts.Tables, table) && bucketScoped(table, opts.Buckets) {
+			tables = append(tables, table)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	envelope := exportEnvelope(db)
+	envelope["format"] = FormatNDJSON
+	envelope["tables"] = tables
+	if err := writeLine(bw, sortedMap{"bleepstore_export": envelope}); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		err := exportTable(db, table, opts, func(row map[string]any) error {
+			return writeLine(bw, sortedMap{"table": table, "row": row})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing export: %w", err)
+	}
+	return nil
+}
+
+// writeLine writes v as compact JSON with sorted keys, followed by a newline.
+func writeLine(w *bufio.Writer, v sortedMap) error {
+	b, err := v.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("writing export: %w", err)
+	}
+	return nil
+}
+
+// ImportMetadataNDJSON imports an NDJSON export read from r into SQLite,
+// inserting rows as they are read.
+func ImportMetadataNDJSON(dbPath string, r io.Reader, opts *ImportOptions) (*ImportResult, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var header struct {
+		Envelope map[string]any `json:"bleepstore_export"`
+	}
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("parsing envelope: %w", err)
+	}
+	if err := checkEnvelope(header.Envelope); err != nil {
+		return nil, err
+	}
+	if format, _ := header.Envelope["format"].(string); format != FormatNDJSON {
+		return nil, fmt.Errorf("unsupported export format: %q", format)
+	}
+	listed, _ := header.Envelope["tables"].([]any)
+	present := make(map[string]bool, len(listed))
+	for _, t := range listed {
+		name, _ := t.(string)
+		if _, ok := tableColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown table in envelope: %v", t)
+		}
+		present[name] = bucketScoped(name, opts.Buckets)
+	}
+
+	db, tx, err := beginImport(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var replaced []string
+	for _, table := range deleteOrder {
+		if present[table] {
+			replaced = append(replaced, table)
+		}
+	}
+	imp := newImporter(tx, opts)
+	if err := imp.replaceTables(replaced); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, table := range insertOrder {
+		if present[table] {
+			imp.startTable(table)
+		}
+	}
+
+	for line := 2; ; line++ {
+		var row ndjsonRow
+		if err := dec.Decode(&row); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("parsing line %d: %w", line, err)
+		}
+		if _, ok := present[row.Table]; !ok {
+			tx.Rollback()
+			return nil, fmt.Errorf("line %d: table %q is not listed in the envelope", line, row.Table)
+		}
+		if present[row.Table] {
+			imp.insert(row.Table, row.Row)
+		}
+	}
+
+	if err := finishImport(tx, opts); err != nil {
+		return nil, err
+	}
+
+	return imp.result, nil
+}
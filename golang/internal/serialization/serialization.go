@@ -41,6 +41,15 @@ var tableOrderBy = map[string]string{
 	"credentials":       "access_key_id",
 }
 
+// tableKeys lists the primary key columns of each table.
+var tableKeys = map[string][]string{
+	"buckets":           {"name"},
+	"objects":           {"bucket", "key"},
+	"multipart_uploads": {"upload_id"},
+	"multipart_parts":   {"upload_id", "part_number"},
+	"credentials":       {"access_key_id"},
+}
+
 var deleteOrder = []string{"multipart_parts", "multipart_uploads", "objects", "buckets", "credentials"}
 var insertOrder = []string{"buckets", "objects", "multipart_uploads", "multipart_parts", "credentials"}
 
@@ -48,11 +57,22 @@ var insertOrder = []string{"buckets", "objects", "multipart_uploads", "multipart
 type ExportOptions struct {
 	Tables             []string
 	IncludeCredentials bool
+	// Buckets, if set, limits the export to these buckets and their objects,
+	// uploads and parts. Credentials are not exported.
+	Buckets []string
 }
 
 // ImportOptions configures how to import.
 type ImportOptions struct {
 	Replace bool
+	// Buckets, if set, limits the import to these buckets and their objects,
+	// uploads and parts; other rows and credentials are ignored. In replace
+	// mode only the selected buckets' rows are deleted first.
+	Buckets []string
+	// DryRun parses, validates and inserts the input as usual but rolls the
+	// transaction back instead of committing it, recording primary-key
+	// conflicts in ImportResult.Conflicts.
+	DryRun bool
 }
 
 // ImportResult holds the result of an import operation.
@@ -60,6 +80,18 @@ type ImportResult struct {
 	Counts   map[string]int
 	Skipped  map[string]int
 	Warnings []string
+	// Conflicts lists the rows whose primary key was already taken, by the
+	// database or by an earlier row of the input. It is only filled in a
+	// dry run.
+	Conflicts []ImportConflict
+}
+
+// ImportConflict is a row of an import that collided with an existing
+// primary key.
+type ImportConflict struct {
+	Table string
+	// Key holds the row's primary key as column=value pairs.
+	Key string
 }
 
 // ExportMetadata exports metadata from SQLite to a JSON string.
@@ -74,62 +106,76 @@ func ExportMetadata(dbPath string, opts *ExportOptions) (string, error) {
 	}
 	defer db.Close()
 
-	schemaVersion := getSchemaVersion(db)
-	now := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
-
-	result := map[string]any{
-		"bleepstore_export": map[string]any{
-			"version":        ExportVersion,
-			"exported_at":    now,
-			"schema_version": schemaVersion,
-			"source":         "go/" + Version,
-		},
-	}
+	result := map[string]any{"bleepstore_export": exportEnvelope(db)}
 
 	for _, table := range opts.Tables {
-		columns, ok := tableColumns[table]
-		if !ok {
+		if _, ok := tableColumns[table]; !ok || !bucketScoped(table, opts.Buckets) {
 			continue
 		}
-		orderBy := tableOrderBy[table]
-		query := fmt.Sprintf("SELECT * FROM %s ORDER BY %s", table, orderBy)
-		rows, err := db.Query(query)
+		tableRows := make([]map[string]any, 0)
+		err := exportTable(db, table, opts, func(row map[string]any) error {
+			tableRows = append(tableRows, row)
+			return nil
+		})
 		if err != nil {
-			return "", fmt.Errorf("querying %s: %w", table, err)
+			return "", err
 		}
+		result[table] = tableRows
+	}
 
-		tableRows := make([]map[string]any, 0)
-		for rows.Next() {
-			values := make([]any, len(columns))
-			ptrs := make([]any, len(columns))
-			for i := range values {
-				ptrs[i] = &values[i]
-			}
-			if err := rows.Scan(ptrs...); err != nil {
-				rows.Close()
-				return "", fmt.Errorf("scanning %s row: %w", table, err)
-			}
+	return marshalSorted(result)
+}
 
-			row := make(map[string]any, len(columns))
-			for i, col := range columns {
-				row[col] = convertValue(col, values[i])
-			}
+// exportEnvelope returns the bleepstore_export header for an export of db.
+func exportEnvelope(db *sql.DB) map[string]any {
+	return map[string]any{
+		"version":        ExportVersion,
+		"exported_at":    time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		"schema_version": getSchemaVersion(db),
+		"source":         "go/" + Version,
+	}
+}
 
-			if table == "credentials" && !opts.IncludeCredentials {
-				row["secret_key"] = "REDACTED"
-			}
+// exportTable calls emit with each row of table in export order, with JSON
+// and boolean columns converted and secrets redacted per opts.
+func exportTable(db *sql.DB, table string, opts *ExportOptions, emit func(row map[string]any) error) error {
+	columns := tableColumns[table]
+	where, args := bucketWhere(table, opts.Buckets)
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s",
+		strings.Join(columns, ", "), table, where, tableOrderBy[table])
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("querying %s: %w", table, err)
+	}
+	defer rows.Close()
 
-			tableRows = append(tableRows, row)
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("scanning %s row: %w", table, err)
 		}
-		rows.Close()
-		if err := rows.Err(); err != nil {
-			return "", fmt.Errorf("iterating %s: %w", table, err)
+
+		row := make(map[string]any, len(columns))
+		for i, col := range columns {
+			row[col] = convertValue(col, values[i])
 		}
 
-		result[table] = tableRows
-	}
+		if table == "credentials" && !opts.IncludeCredentials {
+			row["secret_key"] = "REDACTED"
+		}
 
-	return marshalSorted(result)
+		if err := emit(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating %s: %w", table, err)
+	}
+	return nil
 }
 
 // ImportMetadata imports metadata from a JSON string into SQLite.
@@ -143,40 +189,27 @@ func ImportMetadata(dbPath string, jsonStr string, opts *ImportOptions) (*Import
 		return nil, fmt.Errorf("parsing JSON: %w", err)
 	}
 
-	envelope, _ := data["bleepstore_export"].(map[string]any)
-	version, _ := envelope["version"].(float64)
-	if version < 1 || version > ExportVersion {
-		return nil, fmt.Errorf("unsupported export version: %v", version)
+	if err := checkEnvelope(data["bleepstore_export"]); err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	db, tx, err := beginImport(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("opening database: %w", err)
+		return nil, err
 	}
 	defer db.Close()
 
-	db.Exec("PRAGMA foreign_keys = ON")
-
-	result := &ImportResult{
-		Counts:  make(map[string]int),
-		Skipped: make(map[string]int),
-	}
-
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("beginning transaction: %w", err)
-	}
-
-	if opts.Replace {
-		for _, table := range deleteOrder {
-			if _, ok := data[table]; ok {
-				if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table)); err != nil {
-					tx.Rollback()
-					return nil, fmt.Errorf("deleting %s: %w", table, err)
-				}
-			}
+	var present []string
+	for _, table := range deleteOrder {
+		if _, ok := data[table]; ok && bucketScoped(table, opts.Buckets) {
+			present = append(present, table)
 		}
 	}
+	imp := newImporter(tx, opts)
+	if err := imp.replaceTables(present); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
 	for _, table := range insertOrder {
 		rowsData, ok := data[table]
@@ -187,71 +220,275 @@ func ImportMetadata(dbPath string, jsonStr string, opts *ImportOptions) (*Import
 		if !ok {
 			continue
 		}
-		columns, ok := tableColumns[table]
-		if !ok {
+		if _, ok := tableColumns[table]; !ok || !bucketScoped(table, opts.Buckets) {
 			continue
 		}
 
-		inserted := 0
-		skipped := 0
-
+		imp.startTable(table)
 		for _, rawRow := range rowList {
-			rowMap, ok := rawRow.(map[string]any)
-			if !ok {
-				skipped++
-				continue
-			}
+			rowMap, _ := rawRow.(map[string]any)
+			imp.insert(table, rowMap)
+		}
+	}
 
-			if table == "credentials" {
-				if sk, _ := rowMap["secret_key"].(string); sk == "REDACTED" {
-					skipped++
-					result.Warnings = append(result.Warnings,
-						fmt.Sprintf("Skipped credential '%v': REDACTED secret_key", rowMap["access_key_id"]))
-					continue
-				}
-			}
+	if err := finishImport(tx, opts); err != nil {
+		return nil, err
+	}
 
-			collapsed := collapseRow(rowMap)
-			placeholders := make([]string, len(columns))
-			values := make([]any, len(columns))
-			for i, col := range columns {
-				placeholders[i] = "?"
-				values[i] = collapsed[col]
-			}
+	return imp.result, nil
+}
 
-			colNames := strings.Join(columns, ", ")
-			ph := strings.Join(placeholders, ", ")
-			var query string
-			if opts.Replace {
-				query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, colNames, ph)
-			} else {
-				query = fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)", table, colNames, ph)
-			}
+// finishImport commits the import transaction, or rolls it back in a dry
+// run.
+func finishImport(tx *sql.Tx, opts *ImportOptions) error {
+	if opts.DryRun {
+		if err := tx.Rollback(); err != nil {
+			return fmt.Errorf("rolling back dry run: %w", err)
+		}
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
 
-			res, err := tx.Exec(query, values...)
-			if err != nil {
-				skipped++
-				result.Warnings = append(result.Warnings,
-					fmt.Sprintf("Skipped %s row: %v", table, err))
-				continue
-			}
-			affected, _ := res.RowsAffected()
-			if affected > 0 {
-				inserted++
-			} else {
-				skipped++
-			}
+// checkEnvelope validates the bleepstore_export header of an import.
+func checkEnvelope(raw any) error {
+	envelope, _ := raw.(map[string]any)
+	version, _ := envelope["version"].(float64)
+	if version < 1 || version > ExportVersion {
+		return fmt.Errorf("unsupported export version: %v", version)
+	}
+	return nil
+}
+
+// beginImport opens the database at dbPath and starts the import
+// transaction.
+func beginImport(dbPath string) (*sql.DB, *sql.Tx, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening database: %w", err)
+	}
+
+	db.Exec("PRAGMA foreign_keys = ON")
+
+	tx, err := db.Begin()
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	return db, tx, nil
+}
+
+// bucketScoped reports whether table takes part in an export or import
+// limited to buckets. Credentials belong to no bucket and are left out.
+func bucketScoped(table string, buckets []string) bool {
+	return len(buckets) == 0 || table != "credentials"
+}
+
+// bucketWhere returns a WHERE clause, with its leading space, and arguments
+// that limit table to rows of buckets, or "" if buckets is empty.
+func bucketWhere(table string, buckets []string) (string, []any) {
+	if len(buckets) == 0 {
+		return "", nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(buckets)), ", ")
+	args := make([]any, len(buckets))
+	for i, b := range buckets {
+		args[i] = b
+	}
+	switch table {
+	case "buckets":
+		return fmt.Sprintf(" WHERE name IN (%s)", placeholders), args
+	case "multipart_parts":
+		return fmt.Sprintf(" WHERE upload_id IN (SELECT upload_id FROM multipart_uploads WHERE bucket IN (%s))", placeholders), args
+	default:
+		return fmt.Sprintf(" WHERE bucket IN (%s)", placeholders), args
+	}
+}
+
+// importer inserts rows in an import transaction and tallies the result.
+type importer struct {
+	tx      *sql.Tx
+	replace bool
+	dryRun  bool
+	result  *ImportResult
+	queries map[string]string
+
+	// buckets is the bucket filter, or nil to import everything. uploads
+	// holds the upload IDs of the selected buckets seen so far, which
+	// decides whether a part is imported.
+	buckets  []string
+	selected map[string]bool
+	uploads  map[string]bool
+}
+
+func newImporter(tx *sql.Tx, opts *ImportOptions) *importer {
+	imp := &importer{
+		tx:      tx,
+		replace: opts.Replace,
+		dryRun:  opts.DryRun,
+		result: &ImportResult{
+			Counts:  make(map[string]int),
+			Skipped: make(map[string]int),
+		},
+		queries: make(map[string]string),
+	}
+	if len(opts.Buckets) > 0 {
+		imp.buckets = opts.Buckets
+		imp.selected = make(map[string]bool, len(opts.Buckets))
+		for _, b := range opts.Buckets {
+			imp.selected[b] = true
+		}
+		imp.uploads = make(map[string]bool)
+	}
+	return imp
+}
+
+// replaceTables deletes the existing rows of tables in replace mode, only
+// those of the selected buckets if the import is filtered. tables must be
+// in deleteOrder.
+func (imp *importer) replaceTables(tables []string) error {
+	if !imp.replace {
+		return nil
+	}
+	for _, table := range tables {
+		where, args := bucketWhere(table, imp.buckets)
+		if _, err := imp.tx.Exec(fmt.Sprintf("DELETE FROM %s%s", table, where), args...); err != nil {
+			return fmt.Errorf("deleting %s: %w", table, err)
 		}
+	}
+	return nil
+}
 
-		result.Counts[table] = inserted
-		result.Skipped[table] = skipped
+// wants reports whether a row of table passes the bucket filter.
+func (imp *importer) wants(table string, rowMap map[string]any) bool {
+	if imp.selected == nil {
+		return true
+	}
+	switch table {
+	case "buckets":
+		name, _ := rowMap["name"].(string)
+		return imp.selected[name]
+	case "objects":
+		bucket, _ := rowMap["bucket"].(string)
+		return imp.selected[bucket]
+	case "multipart_uploads":
+		bucket, _ := rowMap["bucket"].(string)
+		if !imp.selected[bucket] {
+			return false
+		}
+		uploadID, _ := rowMap["upload_id"].(string)
+		imp.uploads[uploadID] = true
+		return true
+	case "multipart_parts":
+		uploadID, _ := rowMap["upload_id"].(string)
+		return imp.uploads[uploadID]
+	default:
+		return false
 	}
+}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("committing transaction: %w", err)
+// startTable records table as present in the import, so it is reported even
+// if it has no rows.
+func (imp *importer) startTable(table string) {
+	imp.result.Counts[table] += 0
+	imp.result.Skipped[table] += 0
+}
+
+// insert imports one row of table. A nil rowMap is a malformed row and is
+// counted as skipped; rows outside the bucket filter are not counted.
+func (imp *importer) insert(table string, rowMap map[string]any) {
+	result := imp.result
+	if rowMap == nil {
+		result.Skipped[table]++
+		return
+	}
+	if !imp.wants(table, rowMap) {
+		return
+	}
+
+	if table == "credentials" {
+		if sk, _ := rowMap["secret_key"].(string); sk == "REDACTED" {
+			result.Skipped[table]++
+			result.Warnings = append(result.Warnings,
+				fmt.Sprintf("Skipped credential '%v': REDACTED secret_key", rowMap["access_key_id"]))
+			return
+		}
 	}
 
-	return result, nil
+	columns := tableColumns[table]
+	collapsed := collapseRow(rowMap)
+	values := make([]any, len(columns))
+	for i, col := range columns {
+		values[i] = collapsed[col]
+	}
+
+	res, err := imp.tx.Exec(imp.query(table), values...)
+	if err != nil {
+		result.Skipped[table]++
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("Skipped %s row: %v", table, err))
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			imp.conflict(table, collapsed)
+		}
+		return
+	}
+	affected, _ := res.RowsAffected()
+	if affected > 0 {
+		result.Counts[table]++
+	} else {
+		result.Skipped[table]++
+		imp.conflict(table, collapsed)
+	}
+}
+
+// conflict records a primary-key conflict for a row of table in a dry run.
+// A row ignored by INSERT OR IGNORE is only a conflict if its key exists;
+// it may also have been dropped for a NOT NULL violation.
+func (imp *importer) conflict(table string, row map[string]any) {
+	if !imp.dryRun {
+		return
+	}
+	keys := tableKeys[table]
+	conds := make([]string, len(keys))
+	args := make([]any, len(keys))
+	pairs := make([]string, len(keys))
+	for i, col := range keys {
+		conds[i] = col + " = ?"
+		args[i] = row[col]
+		pairs[i] = fmt.Sprintf("%s=%v", col, row[col])
+	}
+	var one int
+	q := fmt.Sprintf("SELECT 1 FROM %s WHERE %s", table, strings.Join(conds, " AND "))
+	if err := imp.tx.QueryRow(q, args...).Scan(&one); err != nil {
+		return
+	}
+	imp.result.Conflicts = append(imp.result.Conflicts,
+		ImportConflict{Table: table, Key: strings.Join(pairs, " ")})
+}
+
+// query returns the INSERT statement for table.
+func (imp *importer) query(table string) string {
+	if q, ok := imp.queries[table]; ok {
+		return q
+	}
+	columns := tableColumns[table]
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	colNames := strings.Join(columns, ", ")
+	ph := strings.Join(placeholders, ", ")
+	var q string
+	if imp.replace {
+		q = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, colNames, ph)
+	} else {
+		q = fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)", table, colNames, ph)
+	}
+	imp.queries[table] = q
+	return q
 }
 
 func getSchemaVersion(db *sql.DB) int {
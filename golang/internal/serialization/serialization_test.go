@@ -1,12 +1,18 @@
 package serialization
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/bleepstore/bleepstore/internal/storage"
+
 	_ "modernc.org/sqlite"
 )
 
@@ -377,6 +383,61 @@ func TestImportSkipsRedactedCredentials(t *testing.T) {
 	}
 }
 
+func TestImportDryRun(t *testing.T) {
+	db1 := createTestDB(t, t.TempDir(), true)
+	db2 := createTestDB(t, t.TempDir(), true)
+	addOtherBucket(t, db1)
+
+	exported, err := ExportMetadata(db1, &ExportOptions{Tables: AllTables, IncludeCredentials: true})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	result, err := ImportMetadata(db2, exported, &ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Counts["buckets"] != 1 || result.Counts["objects"] != 1 {
+		t.Errorf("expected 1 new bucket and object, got %v", result.Counts)
+	}
+	if n := countRows(t, db2, "SELECT COUNT(*) FROM buckets"); n != 1 {
+		t.Errorf("dry run wrote rows: %d buckets", n)
+	}
+
+	want := map[ImportConflict]bool{
+		{Table: "buckets", Key: "name=test-bucket"}:                              true,
+		{Table: "objects", Key: "bucket=test-bucket key=photos/cat.jpg"}:         true,
+		{Table: "multipart_uploads", Key: "upload_id=upload-abc123"}:             true,
+		{Table: "multipart_parts", Key: "upload_id=upload-abc123 part_number=1"}: true,
+		{Table: "credentials", Key: "access_key_id=bleepstore"}:                  true,
+	}
+	if len(result.Conflicts) != len(want) {
+		t.Fatalf("expected %d conflicts, got %v", len(want), result.Conflicts)
+	}
+	for _, c := range result.Conflicts {
+		if !want[c] {
+			t.Errorf("unexpected conflict %v", c)
+		}
+	}
+}
+
+func TestNDJSONImportDryRunReplace(t *testing.T) {
+	dbPath := createTestDB(t, t.TempDir(), true)
+
+	row := "{\"table\":\"buckets\",\"row\":{\"name\":\"dup\",\"region\":\"us-east-1\",\"owner_id\":\"o\",\"owner_display\":\"o\",\"acl\":{},\"created_at\":\"2026-02-25T12:00:00.000Z\"}}\n"
+	input := "{\"bleepstore_export\":{\"version\":1,\"format\":\"ndjson\",\"tables\":[\"buckets\"]}}\n" + row + row
+	result, err := ImportMetadataNDJSON(dbPath, strings.NewReader(input), &ImportOptions{Replace: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Counts["buckets"] != 1 || len(result.Conflicts) != 1 || result.Conflicts[0].Key != "name=dup" {
+		t.Errorf("expected 1 bucket and a conflict on dup, got %v %v", result.Counts, result.Conflicts)
+	}
+	if n := countRows(t, dbPath, "SELECT COUNT(*) FROM buckets WHERE name = 'test-bucket'"); n != 1 {
+		t.Error("dry run replace deleted existing rows")
+	}
+}
+
 func TestImportInvalidVersion(t *testing.T) {
 	dir := t.TempDir()
 	dbPath := createTestDB(t, dir, false)
@@ -430,3 +491,417 @@ func TestReferenceFixture(t *testing.T) {
 		}
 	}
 }
+
+func TestNDJSONRoundTrip(t *testing.T) {
+	db1 := createTestDB(t, t.TempDir(), true)
+	db2 := createTestDB(t, t.TempDir(), false)
+
+	opts := &ExportOptions{Tables: []string{"objects", "buckets", "credentials"}, IncludeCredentials: true}
+	var buf bytes.Buffer
+	if err := ExportMetadataNDJSON(db1, &buf, opts); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected envelope + 3 rows, got %d lines:\n%s", len(lines), buf.String())
+	}
+	var header map[string]map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("envelope: %v", err)
+	}
+	if header["bleepstore_export"]["format"] != "ndjson" {
+		t.Errorf("envelope = %v", header)
+	}
+	// Tables are written in dependency order regardless of the requested order.
+	if !strings.HasPrefix(lines[1], `{"row":`) || !strings.HasSuffix(lines[1], `"table":"buckets"}`) {
+		t.Errorf("first row = %s, want a buckets row", lines[1])
+	}
+
+	result, err := ImportMetadataNDJSON(db2, strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	for _, table := range []string{"buckets", "objects", "credentials"} {
+		if result.Counts[table] != 1 {
+			t.Errorf("%s imported = %d, want 1", table, result.Counts[table])
+		}
+	}
+	if _, ok := result.Counts["multipart_uploads"]; ok {
+		t.Error("multipart_uploads reported but not exported")
+	}
+
+	// The JSON exports of both databases agree.
+	jsonOpts := &ExportOptions{Tables: opts.Tables, IncludeCredentials: true}
+	exported1, _ := ExportMetadata(db1, jsonOpts)
+	exported2, _ := ExportMetadata(db2, jsonOpts)
+	var data1, data2 map[string]any
+	json.Unmarshal([]byte(exported1), &data1)
+	json.Unmarshal([]byte(exported2), &data2)
+	delete(data1, "bleepstore_export")
+	delete(data2, "bleepstore_export")
+	b1, _ := json.Marshal(data1)
+	b2, _ := json.Marshal(data2)
+	if string(b1) != string(b2) {
+		t.Errorf("round-trip data mismatch:\n%s\n%s", b1, b2)
+	}
+}
+
+func TestNDJSONImportReplace(t *testing.T) {
+	db1 := createTestDB(t, t.TempDir(), true)
+	db2 := createTestDB(t, t.TempDir(), true)
+
+	var buf bytes.Buffer
+	if err := ExportMetadataNDJSON(db1, &buf, &ExportOptions{Tables: []string{"buckets"}}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	result, err := ImportMetadataNDJSON(db2, &buf, &ImportOptions{Replace: true})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Counts["buckets"] != 1 {
+		t.Errorf("expected 1 bucket, got %d", result.Counts["buckets"])
+	}
+}
+
+func TestNDJSONImportRejectsInvalid(t *testing.T) {
+	dbPath := createTestDB(t, t.TempDir(), false)
+
+	for name, input := range map[string]string{
+		"json format":    `{"bleepstore_export":{"version":1}}`,
+		"bad version":    `{"bleepstore_export":{"version":99,"format":"ndjson","tables":[]}}`,
+		"unknown table":  `{"bleepstore_export":{"version":1,"format":"ndjson","tables":["nope"]}}`,
+		"unlisted table": "{\"bleepstore_export\":{\"version\":1,\"format\":\"ndjson\",\"tables\":[\"buckets\"]}}\n{\"table\":\"objects\",\"row\":{}}\n",
+		"truncated row":  "{\"bleepstore_export\":{\"version\":1,\"format\":\"ndjson\",\"tables\":[\"buckets\"]}}\n{\"table\":\"buckets\",\"row\":{\n",
+	} {
+		if _, err := ImportMetadataNDJSON(dbPath, strings.NewReader(input), nil); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// addOtherBucket seeds a second bucket with an object and an upload.
+func addOtherBucket(t *testing.T, dbPath string) {
+	t.Helper()
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`INSERT INTO buckets VALUES ('other', 'us-east-1', 'bleepstore', 'bleepstore', '{}', '2026-02-25T12:00:00.000Z')`,
+		`INSERT INTO objects VALUES ('other', 'o.txt', 1, '"x"', 'text/plain', NULL, NULL, NULL, NULL, NULL, 'STANDARD', '{}', '{}', '2026-02-25T14:30:45.000Z', 0)`,
+		`INSERT INTO multipart_uploads VALUES ('upload-other', 'other', 'big', 'application/octet-stream', NULL, NULL, NULL, NULL, NULL, 'STANDARD', '{}', '{}', 'bleepstore', 'bleepstore', '2026-02-25T13:00:00.000Z')`,
+		`INSERT INTO multipart_parts VALUES ('upload-other', 1, 5, '"y"', '2026-02-25T13:05:00.000Z')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+}
+
+func countRows(t *testing.T, dbPath, query string) int {
+	t.Helper()
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestExportBucketFilter(t *testing.T) {
+	dbPath := createTestDB(t, t.TempDir(), true)
+	addOtherBucket(t, dbPath)
+
+	result, err := ExportMetadata(dbPath, &ExportOptions{Tables: AllTables, Buckets: []string{"other"}})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var data map[string]any
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := data["credentials"]; ok {
+		t.Error("credentials exported with a bucket filter")
+	}
+	for table, want := range map[string]int{"buckets": 1, "objects": 1, "multipart_uploads": 1, "multipart_parts": 1} {
+		rows := data[table].([]any)
+		if len(rows) != want {
+			t.Errorf("%s: %d rows, want %d", table, len(rows), want)
+			continue
+		}
+		row := rows[0].(map[string]any)
+		if row["bucket"] != nil && row["bucket"] != "other" || row["name"] != nil && row["name"] != "other" ||
+			table == "multipart_parts" && row["upload_id"] != "upload-other" {
+			t.Errorf("%s: exported %v", table, row)
+		}
+	}
+}
+
+func TestImportBucketFilter(t *testing.T) {
+	src := createTestDB(t, t.TempDir(), true)
+	addOtherBucket(t, src)
+	exported, err := ExportMetadata(src, &ExportOptions{Tables: AllTables, IncludeCredentials: true})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// The destination already has test-bucket with an extra object and its
+	// own credential; replacing "other" must leave both alone.
+	dst := createTestDB(t, t.TempDir(), false)
+	db, _ := sql.Open("sqlite", dst)
+	db.Exec(`INSERT INTO buckets VALUES ('test-bucket', 'us-east-1', 'o', 'o', '{}', '2026-01-01T00:00:00.000Z')`)
+	db.Exec(`INSERT INTO objects VALUES ('test-bucket', 'local-only', 1, '"z"', 'text/plain', NULL, NULL, NULL, NULL, NULL, 'STANDARD', '{}', '{}', '2026-01-01T00:00:00.000Z', 0)`)
+	db.Exec(`INSERT INTO credentials VALUES ('dst-key', 'dst-secret', 'o', 'o', 1, '2026-01-01T00:00:00.000Z')`)
+	db.Close()
+
+	for _, format := range []string{"json", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			opts := &ImportOptions{Replace: true, Buckets: []string{"other"}}
+			var result *ImportResult
+			var err error
+			if format == "json" {
+				result, err = ImportMetadata(dst, exported, opts)
+			} else {
+				var buf bytes.Buffer
+				if err := ExportMetadataNDJSON(src, &buf, &ExportOptions{Tables: AllTables, IncludeCredentials: true}); err != nil {
+					t.Fatalf("export: %v", err)
+				}
+				result, err = ImportMetadataNDJSON(dst, &buf, opts)
+			}
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			for table, want := range map[string]int{"buckets": 1, "objects": 1, "multipart_uploads": 1, "multipart_parts": 1} {
+				if result.Counts[table] != want || result.Skipped[table] != 0 {
+					t.Errorf("%s: %d imported, %d skipped; want %d, 0", table, result.Counts[table], result.Skipped[table], want)
+				}
+			}
+			if _, ok := result.Counts["credentials"]; ok {
+				t.Error("credentials reported in a bucket-filtered import")
+			}
+
+			for query, want := range map[string]int{
+				"SELECT COUNT(*) FROM objects WHERE bucket = 'test-bucket'":              1,
+				"SELECT COUNT(*) FROM objects WHERE bucket = 'other'":                    1,
+				"SELECT COUNT(*) FROM multipart_parts WHERE upload_id = 'upload-abc123'": 0,
+				"SELECT COUNT(*) FROM credentials":                                       1,
+			} {
+				if got := countRows(t, dst, query); got != want {
+					t.Errorf("%s = %d, want %d", query, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyStorage(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := createTestDB(t, dir, true)
+	root := filepath.Join(dir, "objects")
+	addOtherBucket(t, dbPath)
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const helloETag = `'"5d41402abc4b2a76b9719d911017c592"'`
+	for _, stmt := range []string{
+		`ALTER TABLE objects ADD COLUMN inline_data BLOB`,
+		`INSERT INTO objects (bucket, key, size, etag, last_modified) VALUES ('test-bucket', 'ok.txt', 5, ` + helloETag + `, '2026-02-25T14:30:45.000Z')`,
+		`INSERT INTO objects (bucket, key, size, etag, last_modified) VALUES ('test-bucket', 'bad.txt', 5, ` + helloETag + `, '2026-02-25T14:30:45.000Z')`,
+		`INSERT INTO objects (bucket, key, size, etag, last_modified) VALUES ('test-bucket', 'short.txt', 10, ` + helloETag + `, '2026-02-25T14:30:45.000Z')`,
+		`INSERT INTO objects (bucket, key, size, etag, last_modified) VALUES ('test-bucket', 'dir/mp.bin', 5, '"abc-2"', '2026-02-25T14:30:45.000Z')`,
+		`INSERT INTO objects (bucket, key, size, etag, last_modified, inline_data) VALUES ('test-bucket', 'inline', 5, ` + helloETag + `, '2026-02-25T14:30:45.000Z', CAST('hello' AS BLOB))`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	files := map[string]string{
+		"test-bucket/ok.txt":     "hello",
+		"test-bucket/bad.txt":    "jello",
+		"test-bucket/short.txt":  "hello",
+		"test-bucket/dir/mp.bin": "parts",
+		"test-bucket/inline":     "stale",
+		"test-bucket/orphan.bin": "?",
+		".tmp/tmp-123":           "ignored",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(opts VerifyOptions) (*VerifyReport, map[string]string) {
+		t.Helper()
+		found := make(map[string]string)
+		opts.Roots = []string{root}
+		opts.OnFinding = func(f VerifyFinding) { found[f.Bucket+"/"+f.Key] = f.Kind }
+		report, err := VerifyStorage(dbPath, &opts)
+		if err != nil {
+			t.Fatalf("VerifyStorage: %v", err)
+		}
+		return report, found
+	}
+
+	report, found := run(VerifyOptions{Buckets: []string{"test-bucket"}})
+	want := map[string]string{
+		"test-bucket/photos/cat.jpg": FindingMissing,
+		"test-bucket/short.txt":      FindingSize,
+		"test-bucket/inline":         FindingOrphan,
+		"test-bucket/orphan.bin":     FindingOrphan,
+	}
+	if len(found) != len(want) {
+		t.Errorf("findings = %v, want %v", found, want)
+	}
+	for key, kind := range want {
+		if found[key] != kind {
+			t.Errorf("%s: finding %q, want %q", key, found[key], kind)
+		}
+	}
+	if report.Objects != 6 || report.Files != 6 || report.Problems() != 4 {
+		t.Errorf("report = %+v", report)
+	}
+
+	report, found = run(VerifyOptions{Buckets: []string{"test-bucket"}, Rehash: true})
+	if found["test-bucket/bad.txt"] != FindingETag || report.ETagMismatches != 1 {
+		t.Errorf("rehash findings = %v, report = %+v", found, report)
+	}
+	if report.Rehashed != 3 || report.Unhashable != 1 {
+		t.Errorf("rehashed %d, unhashable %d; want 3 (ok, bad, inline) and 1", report.Rehashed, report.Unhashable)
+	}
+
+	// Without a bucket filter the other bucket's object is missing too.
+	if report, _ := run(VerifyOptions{}); report.Missing != 2 {
+		t.Errorf("unfiltered missing = %d, want 2", report.Missing)
+	}
+}
+
+func TestVerifyCompressedStorage(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := createTestDB(t, dir, true)
+	root := filepath.Join(dir, "objects")
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`ALTER TABLE objects ADD COLUMN compression TEXT`,
+		`INSERT INTO objects (bucket, key, size, etag, last_modified, compression) VALUES ('test-bucket', 'ok.txt', 5, '"5d41402abc4b2a76b9719d911017c592"', '2026-02-25T14:30:45.000Z', 'zstd')`,
+		`INSERT INTO objects (bucket, key, size, etag, last_modified, compression) VALUES ('test-bucket', 'bad.txt', 5, '"5d41402abc4b2a76b9719d911017c592"', '2026-02-25T14:30:45.000Z', 'gzip')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	write := func(key, codec, data string) {
+		t.Helper()
+		rc, err := storage.CompressReader(codec, strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		compressed, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.MkdirAll(filepath.Join(root, "test-bucket"), 0o755)
+		if err := os.WriteFile(filepath.Join(root, "test-bucket", key), compressed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("ok.txt", storage.CodecZstd, "hello")
+	write("bad.txt", storage.CodecGzip, "jello")
+
+	found := make(map[string]string)
+	opts := &VerifyOptions{
+		Roots:     []string{root},
+		OnFinding: func(f VerifyFinding) { found[f.Key] = f.Kind },
+	}
+	// Compressed files differ in size from their objects; that alone is
+	// not a finding.
+	report, err := VerifyStorage(dbPath, opts)
+	if err != nil {
+		t.Fatalf("VerifyStorage: %v", err)
+	}
+	if report.SizeMismatches != 0 || found["ok.txt"] != "" || found["bad.txt"] != "" {
+		t.Errorf("findings = %v, report = %+v", found, report)
+	}
+
+	opts.Rehash = true
+	if report, err = VerifyStorage(dbPath, opts); err != nil {
+		t.Fatalf("VerifyStorage: %v", err)
+	}
+	if found["bad.txt"] != FindingETag || found["ok.txt"] != "" || report.Rehashed != 2 {
+		t.Errorf("rehash findings = %v, report = %+v", found, report)
+	}
+}
+
+func TestVerifyPackedStorage(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := createTestDB(t, dir, true)
+	root := filepath.Join(dir, "objects")
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO objects (bucket, key, size, etag, last_modified) VALUES ('test-bucket', 'packed', 5, '"5d41402abc4b2a76b9719d911017c592"', '2026-02-25T14:30:45.000Z')`,
+		`INSERT INTO objects (bucket, key, size, etag, last_modified) VALUES ('test-bucket', 'wrong', 5, '"5d41402abc4b2a76b9719d911017c592"', '2026-02-25T14:30:45.000Z')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	local, err := storage.NewLocalBackend(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := storage.NewPackedBackend(local, filepath.Join(root, storage.PackDirName),
+		storage.PackOptions{ThresholdBytes: 64, SegmentBytes: 1024, CompactRatio: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	packed.PutObject(ctx, "test-bucket", "packed", strings.NewReader("hello"), 5)
+	packed.PutObject(ctx, "test-bucket", "wrong", strings.NewReader("jello"), 5)
+	packed.Close()
+	// A stale unpacked copy left behind.
+	os.MkdirAll(filepath.Join(root, "test-bucket"), 0o755)
+	os.WriteFile(filepath.Join(root, "test-bucket", "packed"), []byte("stale"), 0o644)
+
+	found := make(map[string]string)
+	report, err := VerifyStorage(dbPath, &VerifyOptions{
+		Roots:     []string{root},
+		Rehash:    true,
+		OnFinding: func(f VerifyFinding) { found[f.Key] = f.Kind + " " + f.Detail },
+	})
+	if err != nil {
+		t.Fatalf("VerifyStorage: %v", err)
+	}
+	if !strings.HasPrefix(found["wrong"], FindingETag) {
+		t.Errorf("wrong: finding %q, want %s", found["wrong"], FindingETag)
+	}
+	if found["packed"] != FindingOrphan+" object is packed" {
+		t.Errorf("packed: finding %q, want stale copy reported", found["packed"])
+	}
+	if report.Rehashed != 2 {
+		t.Errorf("rehashed = %d, want 2", report.Rehashed)
+	}
+}
@@ -0,0 +1,407 @@
+package serialization
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// Verify finding kinds.
+const (
+	// FindingMissing is an object row whose data is in no storage root.
+	FindingMissing = "missing"
+	// FindingOrphan is a file in a storage root that no object row refers
+	// to, including a stale backend copy of an inline or packed object.
+	FindingOrphan = "orphan"
+	// FindingSize is a file whose size differs from its object row.
+	FindingSize = "size-mismatch"
+	// FindingETag is an object whose data no longer hashes to its ETag.
+	FindingETag = "etag-mismatch"
+)
+
+// VerifyOptions configures VerifyStorage.
+type VerifyOptions struct {
+	// Roots are the local backend's data roots (one, or several for JBOD).
+	Roots []string
+	// Buckets, if set, limits verification to these buckets.
+	Buckets []string
+	// Rehash recomputes the MD5 of every single-part object and compares
+	// it to the ETag. Multipart ETags cannot be recomputed and are skipped.
+	Rehash bool
+	// OnFinding, if set, is called with each problem as it is found.
+	OnFinding func(VerifyFinding)
+}
+
+// VerifyFinding is one inconsistency between metadata and storage.
+type VerifyFinding struct {
+	Kind   string `json:"kind"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Path is the file involved, if any.
+	Path   string `json:"path,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// VerifyReport summarizes a VerifyStorage run.
+type VerifyReport struct {
+	Objects int64 `json:"objects"`
+	Files   int64 `json:"files"`
+	// Rehashed counts objects whose ETag was recomputed; Unhashable counts
+	// multipart objects skipped by Rehash.
+	Rehashed       int64 `json:"rehashed"`
+	Unhashable     int64 `json:"unhashable"`
+	Missing        int64 `json:"missing"`
+	Orphans        int64 `json:"orphans"`
+	SizeMismatches int64 `json:"size_mismatches"`
+	ETagMismatches int64 `json:"etag_mismatches"`
+}
+
+// Problems returns the number of findings.
+func (r *VerifyReport) Problems() int64 {
+	return r.Missing + r.Orphans + r.SizeMismatches + r.ETagMismatches
+}
+
+// VerifyStorage cross-checks object metadata in SQLite against the files of
+// a local storage backend. It first walks the object rows, checking that
+// each object's file exists with the recorded size, then walks the roots
+// looking up each file's row. Memory use does not grow with the number of
+// objects. Objects packed into segment files are checked against the pack
+// index, which cannot be opened while the server holds it.
+func VerifyStorage(dbPath string, opts *VerifyOptions) (*VerifyReport, error) {
+	if len(opts.Roots) == 0 {
+		return nil, fmt.Errorf("no storage roots to verify")
+	}
+	db, err := sql.Open("sqlite", dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	defer db.Close()
+
+	// Databases from before inline objects have no inline_data column.
+	var hasInline bool
+	err = db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('objects') WHERE name = 'inline_data'`).Scan(&hasInline)
+	if err != nil {
+		return nil, fmt.Errorf("reading objects schema: %w", err)
+	}
+
+	// Nor do those from before compression at rest a compression column.
+	var hasCompression bool
+	err = db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('objects') WHERE name = 'compression'`).Scan(&hasCompression)
+	if err != nil {
+		return nil, fmt.Errorf("reading objects schema: %w", err)
+	}
+
+	v := &verifier{db: db, opts: opts, report: &VerifyReport{}, hasInline: hasInline, hasCompression: hasCompression}
+	for _, root := range opts.Roots {
+		pi, err := storage.OpenPackIndex(root)
+		if err != nil {
+			return nil, err
+		}
+		if pi != nil {
+			defer pi.Close()
+			v.packs = append(v.packs, pi)
+		}
+	}
+	if err := v.checkObjects(); err != nil {
+		return nil, err
+	}
+	if err := v.checkFiles(); err != nil {
+		return nil, err
+	}
+	return v.report, nil
+}
+
+type verifier struct {
+	db        *sql.DB
+	opts      *VerifyOptions
+	report    *VerifyReport
+	hasInline bool
+	// hasCompression is set when object rows record a compression codec.
+	hasCompression bool
+	packs          []*storage.PackIndex
+}
+
+func (v *verifier) find(f VerifyFinding) {
+	switch f.Kind {
+	case FindingMissing:
+		v.report.Missing++
+	case FindingOrphan:
+		v.report.Orphans++
+	case FindingSize:
+		v.report.SizeMismatches++
+	case FindingETag:
+		v.report.ETagMismatches++
+	}
+	if v.opts.OnFinding != nil {
+		v.opts.OnFinding(f)
+	}
+}
+
+// checkObjects confirms that every object row's data exists.
+func (v *verifier) checkObjects() error {
+	inline, compression := "NULL", "NULL"
+	if v.hasInline {
+		inline = "inline_data"
+	}
+	if v.hasCompression {
+		compression = "compression"
+	}
+	where, args := bucketWhere("objects", v.opts.Buckets)
+	rows, err := v.db.Query(fmt.Sprintf(
+		"SELECT bucket, key, size, etag, delete_marker, %s, %s FROM objects%s ORDER BY bucket, key",
+		inline, compression, where), args...)
+	if err != nil {
+		return fmt.Errorf("querying objects: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			bucket, key, etag string
+			size              int64
+			deleteMarker      bool
+			data              sql.Null[[]byte]
+			codec             sql.NullString
+		)
+		if err := rows.Scan(&bucket, &key, &size, &etag, &deleteMarker, &data, &codec); err != nil {
+			return fmt.Errorf("scanning object row: %w", err)
+		}
+		v.report.Objects++
+		if deleteMarker {
+			continue
+		}
+		if data.Valid {
+			if v.opts.Rehash {
+				v.report.Rehashed++
+				if sum := md5.Sum(data.V); !etagMatches(etag, sum[:]) {
+					v.find(VerifyFinding{Kind: FindingETag, Bucket: bucket, Key: key,
+						Detail: fmt.Sprintf("inline data hashes to %x, ETag is %s", sum, etag)})
+				}
+			}
+			continue
+		}
+		if err := v.checkObjectFile(bucket, key, size, etag, codec.String); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating objects: %w", err)
+	}
+	return nil
+}
+
+// checkObjectFile checks the file of one backend-stored object. The size of
+// data compressed at rest (codec != "") can only be checked by rehashing.
+func (v *verifier) checkObjectFile(bucket, key string, size int64, etag, codec string) error {
+	pi, packedSize, err := v.lookupPacked(bucket, key)
+	if err != nil {
+		return err
+	}
+	if pi != nil {
+		return v.checkPacked(pi, bucket, key, size, packedSize, etag, codec)
+	}
+	path, info := v.locate(bucket, key)
+	if path == "" {
+		v.find(VerifyFinding{Kind: FindingMissing, Bucket: bucket, Key: key})
+		return nil
+	}
+	if codec == "" && info.Size() != size {
+		v.find(VerifyFinding{Kind: FindingSize, Bucket: bucket, Key: key, Path: path,
+			Detail: fmt.Sprintf("file is %d bytes, metadata says %d", info.Size(), size)})
+		return nil
+	}
+	if !v.opts.Rehash {
+		return nil
+	}
+	if strings.Contains(etag, "-") {
+		v.report.Unhashable++
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("hashing %s: %w", path, err)
+	}
+	sum, n, err := hashData(f, codec)
+	if err != nil {
+		return fmt.Errorf("hashing %s: %w", path, err)
+	}
+	v.report.Rehashed++
+	if codec != "" && n != size {
+		v.find(VerifyFinding{Kind: FindingSize, Bucket: bucket, Key: key, Path: path,
+			Detail: fmt.Sprintf("data decompresses to %d bytes, metadata says %d", n, size)})
+		return nil
+	}
+	if !etagMatches(etag, sum) {
+		v.find(VerifyFinding{Kind: FindingETag, Bucket: bucket, Key: key, Path: path,
+			Detail: fmt.Sprintf("file hashes to %x, ETag is %s", sum, etag)})
+	}
+	return nil
+}
+
+// lookupPacked returns the pack index holding bucket/key and the packed
+// size, or nil if the object is not packed.
+func (v *verifier) lookupPacked(bucket, key string) (*storage.PackIndex, int64, error) {
+	for _, pi := range v.packs {
+		size, ok, err := pi.Lookup(bucket, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			return pi, size, nil
+		}
+	}
+	return nil, 0, nil
+}
+
+// checkPacked checks one object stored in a segment file.
+func (v *verifier) checkPacked(pi *storage.PackIndex, bucket, key string, size, packedSize int64, etag, codec string) error {
+	if codec == "" && packedSize != size {
+		v.find(VerifyFinding{Kind: FindingSize, Bucket: bucket, Key: key,
+			Detail: fmt.Sprintf("packed record is %d bytes, metadata says %d", packedSize, size)})
+		return nil
+	}
+	if !v.opts.Rehash {
+		return nil
+	}
+	if strings.Contains(etag, "-") {
+		v.report.Unhashable++
+		return nil
+	}
+	rc, err := pi.Open(bucket, key)
+	if err != nil {
+		return err
+	}
+	sum, n, err := hashData(rc, codec)
+	if err != nil {
+		return fmt.Errorf("hashing packed %s/%s: %w", bucket, key, err)
+	}
+	v.report.Rehashed++
+	if codec != "" && n != size {
+		v.find(VerifyFinding{Kind: FindingSize, Bucket: bucket, Key: key,
+			Detail: fmt.Sprintf("packed data decompresses to %d bytes, metadata says %d", n, size)})
+		return nil
+	}
+	if !etagMatches(etag, sum) {
+		v.find(VerifyFinding{Kind: FindingETag, Bucket: bucket, Key: key,
+			Detail: fmt.Sprintf("packed data hashes to %x, ETag is %s", sum, etag)})
+	}
+	return nil
+}
+
+// locate returns the first root's file for bucket/key, or "" if no root
+// has a regular file there.
+func (v *verifier) locate(bucket, key string) (string, os.FileInfo) {
+	for _, root := range v.opts.Roots {
+		path := filepath.Join(root, bucket, filepath.FromSlash(key))
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, info
+		}
+	}
+	return "", nil
+}
+
+// checkFiles reports files in the roots that have no object row. Top-level
+// directories starting with "." (temp files, multipart parts) are skipped.
+func (v *verifier) checkFiles() error {
+	query := "SELECT delete_marker, 0 FROM objects WHERE bucket = ? AND key = ?"
+	if v.hasInline {
+		query = "SELECT delete_marker, inline_data IS NOT NULL FROM objects WHERE bucket = ? AND key = ?"
+	}
+	lookup, err := v.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("preparing lookup: %w", err)
+	}
+	defer lookup.Close()
+
+	for _, root := range v.opts.Roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return fmt.Errorf("reading storage root: %w", err)
+		}
+		for _, entry := range entries {
+			bucket := entry.Name()
+			if !entry.IsDir() || strings.HasPrefix(bucket, ".") {
+				continue
+			}
+			if len(v.opts.Buckets) > 0 && !slices.Contains(v.opts.Buckets, bucket) {
+				continue
+			}
+			bucketDir := filepath.Join(root, bucket)
+			err := filepath.WalkDir(bucketDir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				v.report.Files++
+				rel, err := filepath.Rel(bucketDir, path)
+				if err != nil {
+					return err
+				}
+				key := filepath.ToSlash(rel)
+
+				var deleteMarker, inline bool
+				err = lookup.QueryRow(bucket, key).Scan(&deleteMarker, &inline)
+				var packed *storage.PackIndex
+				if err == nil && !inline && !deleteMarker {
+					if packed, _, err = v.lookupPacked(bucket, key); err != nil {
+						return err
+					}
+				}
+				switch {
+				case err == sql.ErrNoRows:
+					v.find(VerifyFinding{Kind: FindingOrphan, Bucket: bucket, Key: key, Path: path})
+				case err != nil:
+					return fmt.Errorf("looking up %s/%s: %w", bucket, key, err)
+				case inline:
+					v.find(VerifyFinding{Kind: FindingOrphan, Bucket: bucket, Key: key, Path: path,
+						Detail: "object is stored inline"})
+				case deleteMarker:
+					v.find(VerifyFinding{Kind: FindingOrphan, Bucket: bucket, Key: key, Path: path,
+						Detail: "object is a delete marker"})
+				case packed != nil:
+					v.find(VerifyFinding{Kind: FindingOrphan, Bucket: bucket, Key: key, Path: path,
+						Detail: "object is packed"})
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("walking %s: %w", bucketDir, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hashData returns the MD5 and length of the data read from rc, after
+// decompressing it with codec if that is set, and closes rc.
+func hashData(rc io.ReadCloser, codec string) ([]byte, int64, error) {
+	if codec != "" {
+		var err error
+		if rc, err = storage.NewDecompressReader(codec, rc); err != nil {
+			return nil, 0, err
+		}
+	}
+	defer rc.Close()
+	h := md5.New()
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		return nil, 0, err
+	}
+	return h.Sum(nil), n, nil
+}
+
+// etagMatches reports whether a quoted single-part ETag is the hex of sum.
+func etagMatches(etag string, sum []byte) bool {
+	return strings.EqualFold(strings.Trim(etag, `"`), hex.EncodeToString(sum))
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/handlers"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/s3op"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// ACL group grantee URIs matched by the authorizer.
+const (
+	aclAllUsers           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	aclAuthenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// aclRule is the ACL permission an operation needs, on the object it names
+// or on its bucket.
+type aclRule struct {
+	object     bool
+	permission string
+}
+
+// aclRules maps the operations ACLs can grant to the permission each
+// needs, as in S3. Operations not listed are the bucket owner's alone.
+// Object reads of a missing key fall back to bucket READ, so callers that
+// may list the bucket see 404 rather than 403.
+var aclRules = map[s3op.Operation]aclRule{
+	s3op.HeadBucket:              {false, "READ"},
+	s3op.ListObjects:             {false, "READ"},
+	s3op.ListObjectsV2:           {false, "READ"},
+	s3op.ListMultipartUploads:    {false, "READ"},
+	s3op.ListParts:               {false, "READ"},
+	s3op.HeadObjects:             {false, "READ"},
+	s3op.BulkGetObjects:          {false, "READ"},
+	s3op.PutObject:               {false, "WRITE"},
+	s3op.CopyObject:              {false, "WRITE"},
+	s3op.DeleteObject:            {false, "WRITE"},
+	s3op.DeleteObjects:           {false, "WRITE"},
+	s3op.CreateMultipartUpload:   {false, "WRITE"},
+	s3op.UploadPart:              {false, "WRITE"},
+	s3op.CompleteMultipartUpload: {false, "WRITE"},
+	s3op.AbortMultipartUpload:    {false, "WRITE"},
+	s3op.GetBucketAcl:            {false, "READ_ACP"},
+	s3op.PutBucketAcl:            {false, "WRITE_ACP"},
+	s3op.GetObject:               {true, "READ"},
+	s3op.HeadObject:              {true, "READ"},
+	s3op.GetObjectAcl:            {true, "READ_ACP"},
+	s3op.PutObjectAcl:            {true, "WRITE_ACP"},
+}
+
+// aclPrincipal is the caller an ACL is checked against.
+type aclPrincipal struct {
+	ownerID   string
+	anonymous bool
+}
+
+// granted reports whether the policy grants the principal the permission,
+// directly or through FULL_CONTROL. The policy owner is always granted.
+func (p aclPrincipal) granted(acp *xmlutil.AccessControlPolicy, permission string) bool {
+	if !p.anonymous && acp.Owner.ID == p.ownerID {
+		return true
+	}
+	for _, g := range acp.AccessControlList.Grants {
+		if g.Permission != permission && g.Permission != "FULL_CONTROL" {
+			continue
+		}
+		switch g.Grantee.Type {
+		case "CanonicalUser":
+			if !p.anonymous && g.Grantee.ID == p.ownerID {
+				return true
+			}
+		case "Group":
+			if g.Grantee.URI == aclAllUsers || (g.Grantee.URI == aclAuthenticatedUsers && !p.anonymous) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorize reports whether the caller may perform the request's operation
+// under the bucket and object ACLs. The root access key and requests
+// without an identity, which are internal, are always allowed. A missing
+// bucket is allowed through so that the handler answers 404.
+func (s *Server) authorize(r *http.Request, rc *handlers.RequestContext) (bool, error) {
+	ctx := r.Context()
+	p := aclPrincipal{anonymous: auth.IsAnonymous(ctx)}
+	p.ownerID, _ = auth.OwnerFromContext(ctx)
+	key := auth.AccessKeyFromContext(ctx)
+	if !p.anonymous && ((key == "" && p.ownerID == "") || key == s.cfg.Auth.AccessKey) {
+		return true, nil
+	}
+
+	switch rc.Operation {
+	case s3op.GetCapabilities:
+		return !p.anonymous, nil
+	case s3op.ListBuckets, s3op.CreateBucket:
+		// Every bucket belongs to the server owner.
+		return false, nil
+	}
+	if rc.Bucket == "" {
+		return false, nil
+	}
+
+	if src := r.Header.Get("X-Amz-Copy-Source"); src != "" &&
+		(rc.Operation == s3op.CopyObject || rc.Operation == s3op.UploadPart) {
+		srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+		srcKey, _, _ = strings.Cut(srcKey, "?")
+		if decoded, err := url.PathUnescape(srcKey); err == nil {
+			srcKey = decoded
+		}
+		ok, err := s.aclAllows(r, p, srcBucket, srcKey, aclRule{true, "READ"})
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	// Batch reads need bucket READ, and READ on each object they return.
+	if rc.Operation == s3op.HeadObjects || rc.Operation == s3op.BulkGetObjects {
+		rc.CanRead = func(obj *metadata.ObjectRecord) bool {
+			acp, err := parseStoredACL(obj.ACL)
+			if err != nil {
+				slog.Error("Object ACL error", "bucket", obj.Bucket, "key", obj.Key, "error", err)
+				return false
+			}
+			return p.granted(acp, "READ")
+		}
+	}
+
+	rule, ok := aclRules[rc.Operation]
+	if !ok {
+		return s.aclAllows(r, p, rc.Bucket, "", aclRule{false, "FULL_CONTROL"})
+	}
+	return s.aclAllows(r, p, rc.Bucket, rc.Key, rule)
+}
+
+// aclAllows checks one rule against the ACL of the bucket, or of the key
+// for object rules. FULL_CONTROL on the bucket stands for owner-only
+// operations, which only the bucket owner passes.
+func (s *Server) aclAllows(r *http.Request, p aclPrincipal, bucket, key string, rule aclRule) (bool, error) {
+	ctx := r.Context()
+	if rule.object && key != "" {
+		obj, err := s.meta.GetObject(ctx, bucket, key)
+		if err != nil {
+			return false, fmt.Errorf("reading object ACL: %w", err)
+		}
+		if obj != nil {
+			acp, err := parseStoredACL(obj.ACL)
+			if err != nil {
+				return false, fmt.Errorf("object %s/%s: %w", bucket, key, err)
+			}
+			return p.granted(acp, rule.permission), nil
+		}
+	}
+
+	b, err := s.meta.GetBucket(ctx, bucket)
+	if err != nil {
+		return false, fmt.Errorf("reading bucket ACL: %w", err)
+	}
+	if b == nil {
+		return true, nil
+	}
+	if rule.permission == "FULL_CONTROL" {
+		return !p.anonymous && p.ownerID == b.OwnerID, nil
+	}
+	acp, err := parseStoredACL(b.ACL)
+	if err != nil {
+		return false, fmt.Errorf("bucket %s: %w", bucket, err)
+	}
+	acp.Owner.ID = b.OwnerID
+	return p.granted(acp, rule.permission), nil
+}
+
+// parseStoredACL decodes an ACL as stored in metadata. An empty ACL grants
+// nothing.
+func parseStoredACL(data json.RawMessage) (*xmlutil.AccessControlPolicy, error) {
+	acp := &xmlutil.AccessControlPolicy{}
+	if len(data) == 0 {
+		return acp, nil
+	}
+	if err := json.Unmarshal(data, acp); err != nil {
+		return nil, fmt.Errorf("decoding ACL: %w", err)
+	}
+	return acp, nil
+}
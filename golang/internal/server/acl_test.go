@@ -0,0 +1,273 @@
+package server
+
+import (
+	"archive/tar"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+func TestACLEnforcement(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.cfg.Auth.EnforceACLs = true
+	srv.verifier.AllowAnonymous = true
+	secret := []byte("s3cret")
+	srv.verifier.DelegationSecret = secret
+
+	// Set up as the owner; the router carries no identity.
+	setup := func(method, path string, header map[string]string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader("data"))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s = %d: %s", method, path, rec.Code, rec.Body.String())
+		}
+	}
+	setup("PUT", "/private", nil)
+	setup("PUT", "/public", map[string]string{"x-amz-acl": "public-read"})
+	setup("PUT", "/dropbox", map[string]string{"x-amz-grant-write": `id="alice"`})
+	setup("PUT", "/private/doc", nil)
+	setup("PUT", "/private/shared", map[string]string{"x-amz-grant-read": `id="alice"`})
+	setup("PUT", "/private/members", map[string]string{"x-amz-acl": "authenticated-read"})
+	setup("PUT", "/public/doc", map[string]string{"x-amz-acl": "public-read"})
+	setup("PUT", "/public/secret", nil)
+	setup("PUT", "/private/handover", map[string]string{"x-amz-grant-write-acp": `id="alice"`})
+
+	// alice is another access key, authenticated here with a delegation
+	// token for the whole bucket; anonymous requests are unsigned.
+	handler := srv.buildHandler()
+	send := func(as, method, path, body string, header map[string]string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		if as != "" {
+			bucket, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+			bucket, _, _ = strings.Cut(bucket, "?")
+			token, err := auth.SignDelegationToken(secret, &auth.DelegationClaims{
+				Bucket: bucket, Write: true, ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				AccessKeyID: as, OwnerID: as, DisplayName: as,
+			})
+			if err != nil {
+				t.Fatalf("SignDelegationToken: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	do := func(as, method, path string) int {
+		t.Helper()
+		return send(as, method, path, "data", nil)
+	}
+
+	tests := []struct {
+		as, method, path string
+		want             int
+	}{
+		{"alice", "GET", "/private/doc", http.StatusForbidden},
+		{"alice", "GET", "/private/shared", http.StatusOK},
+		{"alice", "GET", "/private/shared?acl", http.StatusForbidden},
+		{"alice", "GET", "/private/members", http.StatusOK},
+		{"", "GET", "/private/members", http.StatusForbidden},
+		{"alice", "GET", "/private/missing", http.StatusForbidden},
+		{"alice", "GET", "/private?list-type=2&prefix=", http.StatusForbidden},
+		{"", "GET", "/public/doc", http.StatusOK},
+		{"", "GET", "/public/secret", http.StatusForbidden},
+		{"", "GET", "/public/missing", http.StatusNotFound},
+		{"", "GET", "/public?list-type=2", http.StatusOK},
+		{"", "PUT", "/public/new", http.StatusForbidden},
+		{"alice", "PUT", "/dropbox/upload", http.StatusOK},
+		{"alice", "GET", "/dropbox?list-type=2&prefix=", http.StatusForbidden},
+		{"", "GET", "/", http.StatusForbidden},
+		{"", "POST", "/admin/delegation-tokens?bucket=public", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		who := tt.as
+		if who == "" {
+			who = "anonymous"
+		}
+		if got := do(tt.as, tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s as %s = %d, want %d", tt.method, tt.path, who, got, tt.want)
+		}
+	}
+
+	// An object belongs to whoever wrote it, whatever the bucket grants.
+	if got := send("alice", "PUT", "/dropbox/mine", "data", map[string]string{"x-amz-acl": "bucket-owner-read"}); got != http.StatusOK {
+		t.Fatalf("PUT /dropbox/mine as alice = %d", got)
+	}
+	for _, path := range []string{"/dropbox/mine", "/dropbox/mine?acl"} {
+		if got := do("alice", "GET", path); got != http.StatusOK {
+			t.Errorf("GET %s as its writer = %d, want 200", path, got)
+		}
+	}
+	if got := do("", "GET", "/dropbox/mine"); got != http.StatusForbidden {
+		t.Errorf("GET /dropbox/mine as anonymous = %d, want 403", got)
+	}
+
+	// WRITE_ACP lets alice replace the grants but not take ownership.
+	body := `<AccessControlPolicy xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Owner><ID>alice</ID></Owner><AccessControlList><Grant>` +
+		`<Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>alice</ID></Grantee>` +
+		`<Permission>WRITE_ACP</Permission></Grant></AccessControlList></AccessControlPolicy>`
+	if got := send("alice", "PUT", "/private/handover?acl", body, nil); got != http.StatusOK {
+		t.Fatalf("PUT /private/handover?acl as alice = %d", got)
+	}
+	if got := do("alice", "GET", "/private/handover"); got != http.StatusForbidden {
+		t.Errorf("GET /private/handover after rewriting its ACL = %d, want 403", got)
+	}
+
+	// Batch reads are authorized on the bucket, but each object still
+	// needs READ: the private object in the public bucket is withheld.
+	batch := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/public?"+query, strings.NewReader(`{"keys":["doc","secret"]}`))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /public?%s as anonymous = %d: %s", query, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	var heads struct {
+		Objects []struct {
+			Key   string `json:"key"`
+			Found bool   `json:"found"`
+			Size  int64  `json:"size"`
+			ETag  string `json:"etag"`
+			Error string `json:"error"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(batch("bleepstore-head-batch").Body.Bytes(), &heads); err != nil {
+		t.Fatalf("decoding head batch: %v", err)
+	}
+	if len(heads.Objects) != 2 || !heads.Objects[0].Found {
+		t.Fatalf("head batch = %+v", heads.Objects)
+	}
+	if o := heads.Objects[1]; o.Found || o.Size != 0 || o.ETag != "" || o.Error != "AccessDenied" {
+		t.Errorf("head batch entry for secret = %+v", o)
+	}
+	tr := tar.NewReader(batch("bleepstore-bulk-get").Body)
+	for _, want := range []struct{ name, data, err string }{
+		{"doc", "data", ""},
+		{"secret", "", "AccessDenied"},
+	} {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("bulk get entry %s: %v", want.name, err)
+		}
+		data, _ := io.ReadAll(tr)
+		if hdr.Name != want.name || string(data) != want.data || hdr.PAXRecords["BLEEPSTORE.error"] != want.err {
+			t.Errorf("bulk get entry = %q %q %q, want %q %q %q",
+				hdr.Name, data, hdr.PAXRecords["BLEEPSTORE.error"], want.name, want.data, want.err)
+		}
+	}
+
+	// Without enforcement, any authenticated caller is allowed and
+	// unsigned requests are refused outright.
+	srv.cfg.Auth.EnforceACLs = false
+	srv.verifier.AllowAnonymous = false
+	if got := do("alice", "GET", "/private/doc"); got != http.StatusOK {
+		t.Errorf("GET without enforcement = %d, want 200", got)
+	}
+	if got := do("", "GET", "/public/doc"); got != http.StatusForbidden {
+		t.Errorf("unsigned GET without enforcement = %d, want 403", got)
+	}
+}
+
+// TestACLOIDCPrincipals verifies that a bearer JWT is never taken for the
+// root key or a static credential's owner, whatever its owner claim says.
+func TestACLOIDCPrincipals(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.cfg.Auth.EnforceACLs = true
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "k", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())},
+	}})
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jwks)
+	}))
+	defer issuer.Close()
+	srv.verifier.OIDC = auth.NewOIDCVerifier(issuer.URL)
+	srv.verifier.OIDC.JWKSURL = issuer.URL
+	mint := func(sub string) string {
+		t.Helper()
+		header := b64([]byte(`{"alg":"RS256","kid":"k"}`))
+		payload, _ := json.Marshal(map[string]any{
+			"iss": issuer.URL, "sub": sub, "exp": time.Now().Add(time.Hour).Unix(), "scope": "s3:read s3:write",
+		})
+		input := header + "." + b64(payload)
+		digest := sha256.Sum256([]byte(input))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("signing JWT: %v", err)
+		}
+		return input + "." + b64(sig)
+	}
+
+	// carol is a static credential granted READ on one object.
+	ctx := context.Background()
+	if err := srv.meta.PutCredential(ctx, &metadata.CredentialRecord{
+		AccessKeyID: "carol", SecretKey: "carol-secret", OwnerID: "carol", DisplayName: "carol", Active: true,
+	}); err != nil {
+		t.Fatalf("PutCredential: %v", err)
+	}
+	for _, tc := range []struct {
+		path   string
+		header map[string]string
+	}{
+		{"/private", nil},
+		{"/private/doc", nil},
+		{"/private/carols", map[string]string{"x-amz-grant-read": `id="carol"`}},
+	} {
+		req := httptest.NewRequest("PUT", tc.path, strings.NewReader("data"))
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s = %d: %s", tc.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	handler := srv.buildHandler()
+	for _, tc := range []struct{ sub, method, path string }{
+		{"bleepstore", "GET", "/private/doc"},
+		{"bleepstore", "PUT", "/private/doc"},
+		{"bleepstore", "GET", "/private?list-type=2"},
+		{"carol", "GET", "/private/carols"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader("overwritten"))
+		req.Header.Set("Authorization", "Bearer "+mint(tc.sub))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s with a JWT for %s = %d, want 403", tc.method, tc.path, tc.sub, rec.Code)
+		}
+	}
+}
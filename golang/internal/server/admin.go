@@ -0,0 +1,379 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// rootOnly is middleware for the admin API: it refuses requests made with
+// any access key but the root key, auth.access_key. When authentication is
+// enabled that includes requests that carry no access key, such as
+// anonymous ones.
+func (s *Server) rootOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.authn != nil && auth.AccessKeyFromContext(r.Context()) != s.cfg.Auth.AccessKey {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// defaultRebalanceThreshold is the utilization spread (as a fraction) below
+// which roots are considered balanced.
+const defaultRebalanceThreshold = 0.05
+
+// handleRebalance migrates objects between the storage backend's data roots
+// while the server keeps serving requests. The optional "threshold" query
+// parameter sets the acceptable utilization spread (default 0.05). The call
+// blocks until the run completes and returns a JSON summary, or with
+// "async=true" runs it as a background job.
+func (s *Server) handleRebalance(w http.ResponseWriter, r *http.Request) {
+	rb, ok := s.store.(storage.Rebalancer)
+	if !ok {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	threshold := defaultRebalanceThreshold
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || t > 1 {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		threshold = t
+	}
+
+	s.runJob(w, r, "rebalance", func(ctx context.Context) (any, error) {
+		return rb.Rebalance(ctx, threshold)
+	})
+}
+
+// handleRebuild restores the storage backend's lost redundancy, e.g. after
+// a failed disk is replaced, while the server keeps serving requests. With
+// "dry-run=true" it only reports the damage. The call blocks until the run
+// completes and returns a JSON summary, or with "async=true" runs it as a
+// background job.
+func (s *Server) handleRebuild(w http.ResponseWriter, r *http.Request) {
+	rb, ok := s.store.(storage.Rebuilder)
+	if !ok {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	var dryRun bool
+	if v := r.URL.Query().Get("dry-run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		dryRun = b
+	}
+
+	s.runJob(w, r, "rebuild", func(ctx context.Context) (any, error) {
+		return rb.Rebuild(ctx, dryRun)
+	})
+}
+
+// maxPlacementViolations caps the objects listed in a bucket placement report.
+const maxPlacementViolations = 1000
+
+// placementReport is the JSON body returned by GET /admin/placement?bucket=.
+type placementReport struct {
+	Bucket          string                     `json:"bucket"`
+	Prefix          string                     `json:"prefix"`
+	Objects         int64                      `json:"objects"`
+	Satisfied       int64                      `json:"satisfied"`
+	UnderReplicated int64                      `json:"under_replicated"`
+	Divergent       int64                      `json:"divergent"`
+	Inline          int64                      `json:"inline"`
+	Violations      []*storage.ObjectPlacement `json:"violations"`
+	Truncated       bool                       `json:"truncated"`
+}
+
+// handlePlacement reports where a replicated storage backend keeps copies.
+// Without parameters it returns the placement policy and target health;
+// with "bucket" and "key" the copies of one object; with "bucket" (and an
+// optional "prefix") a scan of every object that counts under-replicated
+// and divergent copies and lists the first of them.
+func (s *Server) handlePlacement(w http.ResponseWriter, r *http.Request) {
+	pr, ok := s.store.(storage.PlacementReporter)
+	if !ok {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	var result any
+	switch {
+	case q.Get("bucket") == "":
+		result = pr.PlacementPolicy(ctx)
+	case q.Get("key") != "":
+		p, err := pr.ObjectPlacement(ctx, q.Get("bucket"), q.Get("key"))
+		if err != nil {
+			slog.Error("Placement error", "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		result = p
+	default:
+		if s.meta == nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+			return
+		}
+		report, err := s.scanPlacement(ctx, pr, q.Get("bucket"), q.Get("prefix"))
+		if err != nil {
+			slog.Error("Placement scan error", "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		if report == nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+			return
+		}
+		result = report
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// scanPlacement checks the copies of every object under prefix. It returns
+// nil if the bucket does not exist.
+func (s *Server) scanPlacement(ctx context.Context, pr storage.PlacementReporter, bucketName, prefix string) (*placementReport, error) {
+	bucket, err := s.meta.GetBucket(ctx, bucketName)
+	if err != nil || bucket == nil {
+		return nil, err
+	}
+
+	report := &placementReport{Bucket: bucketName, Prefix: prefix, Violations: []*storage.ObjectPlacement{}}
+	opts := metadata.ListObjectsOptions{Prefix: prefix, MaxKeys: preloadPageSize}
+	for {
+		page, err := s.meta.ListObjects(ctx, bucketName, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Objects {
+			p, err := pr.ObjectPlacement(ctx, bucketName, obj.Key)
+			if err != nil {
+				return nil, err
+			}
+			report.Objects++
+			switch {
+			case p.Satisfied:
+				report.Satisfied++
+				continue
+			case len(p.Copies) == 0 && obj.Size <= s.cfg.Storage.InlineThresholdBytes:
+				// Small enough to live in the metadata row instead.
+				report.Inline++
+				continue
+			case p.Divergent:
+				report.Divergent++
+			default:
+				report.UnderReplicated++
+			}
+			if len(report.Violations) < maxPlacementViolations {
+				report.Violations = append(report.Violations, p)
+			} else {
+				report.Truncated = true
+			}
+		}
+		if !page.IsTruncated || len(page.Objects) == 0 {
+			break
+		}
+		opts.StartAfter = page.Objects[len(page.Objects)-1].Key
+	}
+	return report, nil
+}
+
+// preloadPageSize is the number of keys listed per metadata page while
+// preloading.
+const preloadPageSize = 1000
+
+// preloadResult is the JSON summary returned by POST /admin/preload.
+type preloadResult struct {
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	Objects   int64  `json:"objects"`
+	Bytes     int64  `json:"bytes"`
+	Failed    int64  `json:"failed"`
+	Truncated bool   `json:"truncated"`
+}
+
+// handlePreload reads every object under a prefix through the storage
+// backend so a following batch job hits a warm cache. Query parameters:
+// "bucket" (required), "prefix", and "max-bytes" to stop once that many
+// bytes have been read. The call blocks until done or the client goes away,
+// or with "async=true" runs as a background job.
+func (s *Server) handlePreload(w http.ResponseWriter, r *http.Request) {
+	pl, ok := s.store.(storage.Preloader)
+	if !ok || s.meta == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	q := r.URL.Query()
+	result := preloadResult{Bucket: q.Get("bucket"), Prefix: q.Get("prefix")}
+	if result.Bucket == "" {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+		return
+	}
+	var maxBytes int64
+	if v := q.Get("max-bytes"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		maxBytes = n
+	}
+
+	bucket, err := s.meta.GetBucket(r.Context(), result.Bucket)
+	if err != nil {
+		slog.Error("Preload GetBucket error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	if bucket == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return
+	}
+
+	s.runJob(w, r, "preload", func(ctx context.Context) (any, error) {
+		return s.preload(ctx, pl, result, maxBytes)
+	})
+}
+
+// preload reads the objects selected by result's bucket and prefix until
+// maxBytes (0 = unlimited) have been read, filling in result.
+func (s *Server) preload(ctx context.Context, pl storage.Preloader, result preloadResult, maxBytes int64) (*preloadResult, error) {
+	opts := metadata.ListObjectsOptions{Prefix: result.Prefix, MaxKeys: preloadPageSize}
+	for {
+		page, err := s.meta.ListObjects(ctx, result.Bucket, opts)
+		if err != nil {
+			return nil, fmt.Errorf("listing objects: %w", err)
+		}
+		for _, obj := range page.Objects {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if maxBytes > 0 && result.Bytes >= maxBytes {
+				result.Truncated = true
+				break
+			}
+			n, err := pl.PreloadObject(ctx, result.Bucket, obj.Key)
+			if err != nil {
+				// Keep going: one missing or unreadable object should not
+				// abort warming the rest of the dataset.
+				slog.Warn("Preload object error", "bucket", result.Bucket, "key", obj.Key, "error", err)
+				result.Failed++
+				continue
+			}
+			result.Objects++
+			result.Bytes += n
+			progress.Report(ctx, result.Objects+result.Failed, 0)
+		}
+		if result.Truncated || !page.IsTruncated || len(page.Objects) == 0 {
+			return &result, nil
+		}
+		opts.StartAfter = page.Objects[len(page.Objects)-1].Key
+	}
+}
+
+// defaultDelegationTTL is the lifetime of a delegation token minted without
+// an explicit "expires-in".
+const defaultDelegationTTL = 3600
+
+// delegationTokenResponse is the JSON body returned by
+// POST /admin/delegation-tokens.
+type delegationTokenResponse struct {
+	Token     string    `json:"token"`
+	Bucket    string    `json:"bucket"`
+	Prefix    string    `json:"prefix"`
+	Access    string    `json:"access"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleDelegationToken mints a signed token granting access to one bucket
+// prefix, acting as the calling access key. Query parameters: "bucket"
+// (required), "prefix", "access" ("read" or "write", default "read") and
+// "expires-in" seconds (default 3600, capped at auth.delegation.max_ttl_seconds).
+// The token is presented as "Authorization: Bearer <token>" or in the
+// X-Bleepstore-Token query parameter.
+func (s *Server) handleDelegationToken(w http.ResponseWriter, r *http.Request) {
+	delegation := s.cfg.Auth.Delegation
+	if delegation.Secret == "" || s.meta == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	q := r.URL.Query()
+	resp := delegationTokenResponse{Bucket: q.Get("bucket"), Prefix: q.Get("prefix"), Access: q.Get("access")}
+	if resp.Access == "" {
+		resp.Access = "read"
+	}
+	if resp.Bucket == "" || (resp.Access != "read" && resp.Access != "write") {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+		return
+	}
+	maxTTL := delegation.MaxTTLSeconds
+	if maxTTL <= 0 {
+		maxTTL = 86400
+	}
+	ttl := defaultDelegationTTL
+	if v := q.Get("expires-in"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxTTL {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		ttl = n
+	}
+	ttl = min(ttl, maxTTL)
+
+	bucket, err := s.meta.GetBucket(r.Context(), resp.Bucket)
+	if err != nil {
+		slog.Error("Delegation GetBucket error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	if bucket == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return
+	}
+
+	resp.ExpiresAt = s.clock.Now().Add(time.Duration(ttl) * time.Second).UTC().Truncate(time.Second)
+	ownerID, displayName := auth.OwnerFromContext(r.Context())
+	resp.Token, err = auth.SignDelegationToken([]byte(delegation.Secret), &auth.DelegationClaims{
+		Bucket:      resp.Bucket,
+		Prefix:      resp.Prefix,
+		Write:       resp.Access == "write",
+		ExpiresAt:   resp.ExpiresAt.Unix(),
+		AccessKeyID: auth.AccessKeyFromContext(r.Context()),
+		OwnerID:     ownerID,
+		DisplayName: displayName,
+	})
+	if err != nil {
+		slog.Error("Delegation token error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
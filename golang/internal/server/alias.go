@@ -0,0 +1,341 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/config"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/handlers"
+	"github.com/bleepstore/bleepstore/internal/s3op"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// bucketResolver maps the addressed bucket name of a request to the bucket
+// it operates on. It resolves virtual-hosted-style hosts and access point
+// ARNs into path-style paths and applies bucket aliases with their prefix
+// and policy.
+type bucketResolver struct {
+	domain  string
+	aliases map[string]config.AliasConfig
+	// hosts maps the custom domains served as S3 endpoints to their
+	// bucket.
+	hosts map[string]string
+}
+
+// reservedBucketNames are the first path segments of the admin API and the
+// infrastructure endpoints. Virtual-hosted addressing would rewrite a
+// hostname using one of them into those routes, so none addresses a bucket.
+var reservedBucketNames = map[string]bool{
+	"admin":        true,
+	"health":       true,
+	"healthz":      true,
+	"readyz":       true,
+	"metrics":      true,
+	"docs":         true,
+	"openapi.json": true,
+}
+
+// newBucketResolver validates the alias configuration.
+func newBucketResolver(cfg config.ServerConfig) (*bucketResolver, error) {
+	for name, alias := range cfg.Aliases {
+		if alias.Bucket == "" {
+			return nil, fmt.Errorf("alias %q: bucket is required", name)
+		}
+		if _, ok := cfg.Aliases[alias.Bucket]; ok {
+			return nil, fmt.Errorf("alias %q: target %q is itself an alias", name, alias.Bucket)
+		}
+	}
+	hosts := map[string]string{}
+	for host, d := range cfg.CustomDomains {
+		if d.Bucket == "" {
+			return nil, fmt.Errorf("custom domain %q: bucket is required", host)
+		}
+		if reservedBucketNames[d.Bucket] {
+			return nil, fmt.Errorf("custom domain %q: bucket name %q is reserved", host, d.Bucket)
+		}
+		if !d.Website {
+			hosts[strings.ToLower(host)] = d.Bucket
+		}
+	}
+	return &bucketResolver{
+		domain:  strings.ToLower(strings.TrimPrefix(cfg.VirtualHostDomain, ".")),
+		aliases: cfg.Aliases,
+		hosts:   hosts,
+	}, nil
+}
+
+// virtualHostBucket returns the bucket name addressed by the Host header, a
+// custom domain or a virtual-hosted-style hostname, or "" for path-style
+// requests.
+func (b *bucketResolver) virtualHostBucket(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if bucket, ok := b.hosts[host]; ok {
+		return bucket
+	}
+	if b.domain == "" {
+		return ""
+	}
+	name, ok := strings.CutSuffix(host, "."+b.domain)
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+// resolve rewrites the request to path-style addressing of the underlying
+// bucket. It returns an S3 error if the request is not allowed through the
+// alias it names.
+func (b *bucketResolver) resolve(r *http.Request) *s3err.S3Error {
+	path := r.URL.Path
+	if vhost := b.virtualHostBucket(r.Host); vhost != "" {
+		// Infrastructure endpoints keep working on bucket hostnames; their
+		// paths were not authenticated as object keys.
+		if isInfraPath(path) {
+			return nil
+		}
+		if reservedBucketNames[vhost] {
+			return s3err.ErrAccessDenied
+		}
+		path = "/" + vhost + path
+	}
+	if name, rest, ok := parseAccessPointARN(path); ok {
+		path = "/" + name + rest
+	}
+
+	name, key := handlers.SplitPath(path)
+	alias, ok := b.aliases[name]
+	if !ok {
+		if path != r.URL.Path && adminPath(path) {
+			return s3err.ErrAccessDenied
+		}
+		setRequestPath(r, path)
+		if key != "" {
+			// The copy source may still name an alias or access point.
+			return b.resolveCopySource(r)
+		}
+		return nil
+	}
+
+	if len(alias.AccessKeys) > 0 && !slices.Contains(alias.AccessKeys, auth.AccessKeyFromContext(r.Context())) {
+		return s3err.ErrAccessDenied
+	}
+	if alias.ReadOnly && !s3op.Classify(r.Method, name, key, r.URL.Query(), r.Header).IsRead() {
+		return s3err.ErrAccessDenied
+	}
+
+	q := r.URL.Query()
+	if key != "" {
+		if !strings.HasPrefix(key, alias.Prefix) {
+			return s3err.ErrAccessDenied
+		}
+		if err := b.resolveCopySource(r); err != nil {
+			return err
+		}
+	} else {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			if r.Method == http.MethodGet && alias.Prefix != "" && !q.Has("location") && !q.Has("acl") {
+				// Object and upload listings are narrowed to the alias prefix.
+				prefix := q.Get("prefix")
+				switch {
+				case strings.HasPrefix(prefix, alias.Prefix):
+				case strings.HasPrefix(alias.Prefix, prefix):
+					q.Set("prefix", alias.Prefix)
+					r.URL.RawQuery = q.Encode()
+				default:
+					return s3err.ErrAccessDenied
+				}
+			}
+		case http.MethodPost:
+			// Multi-object delete keys are in the body; only unprefixed
+			// aliases may use it.
+			if !q.Has("delete") || alias.Prefix != "" {
+				return s3err.ErrAccessDenied
+			}
+		default:
+			return s3err.ErrAccessDenied
+		}
+	}
+
+	resolved := "/" + alias.Bucket
+	if key != "" {
+		resolved += "/" + key
+	}
+	if adminPath(resolved) {
+		return s3err.ErrAccessDenied
+	}
+	setRequestPath(r, resolved)
+	return nil
+}
+
+// resolveCopySource applies alias resolution to the X-Amz-Copy-Source header.
+func (b *bucketResolver) resolveCopySource(r *http.Request) *s3err.S3Error {
+	src := r.Header.Get("X-Amz-Copy-Source")
+	if src == "" {
+		return nil
+	}
+	if name, rest, ok := parseCopySourceARN(src); ok {
+		src = "/" + name + "/" + rest
+		r.Header.Set("X-Amz-Copy-Source", src)
+	}
+	name, rest, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+	alias, ok := b.aliases[name]
+	if !ok {
+		return nil
+	}
+	if len(alias.AccessKeys) > 0 && !slices.Contains(alias.AccessKeys, auth.AccessKeyFromContext(r.Context())) {
+		return s3err.ErrAccessDenied
+	}
+	srcKey, _, _ := strings.Cut(rest, "?")
+	if decoded, err := url.PathUnescape(srcKey); err == nil {
+		srcKey = decoded
+	}
+	if !strings.HasPrefix(srcKey, alias.Prefix) {
+		return s3err.ErrAccessDenied
+	}
+	r.Header.Set("X-Amz-Copy-Source", "/"+alias.Bucket+"/"+rest)
+	return nil
+}
+
+// parseAccessPointARN recognizes an access point or Outposts ARN in the
+// bucket position of a path-style request, as sent by SDKs given an ARN in
+// place of a bucket name:
+//
+//	arn:aws:s3:us-east-1:123456789012:accesspoint/my-ap
+//	arn:aws:s3-outposts:us-east-1:123456789012:outpost/op-01234567/accesspoint/my-ap
+//	arn:aws:s3-outposts:us-east-1:123456789012:outpost/op-01234567/bucket/my-bucket
+//
+// It returns the access point or bucket name, which resolves like any other
+// bucket name (so an alias of that name applies), and the rest of the path.
+// Partition, region and account are not checked: a single BleepStore
+// instance plays every account and region.
+func parseAccessPointARN(path string) (name, rest string, ok bool) {
+	arn, ok := strings.CutPrefix(strings.TrimPrefix(path, "/"), "arn:")
+	if !ok {
+		return "", "", false
+	}
+	// partition:service:region:account:resource
+	fields := strings.SplitN(arn, ":", 5)
+	if len(fields) != 5 || fields[0] == "" || fields[3] == "" {
+		return "", "", false
+	}
+	resource := fields[4]
+	switch fields[1] {
+	case "s3":
+		if resource, ok = cutARNToken(resource, "accesspoint"); !ok {
+			return "", "", false
+		}
+	case "s3-outposts":
+		if resource, ok = cutARNToken(resource, "outpost"); !ok {
+			return "", "", false
+		}
+		// Skip the outpost ID.
+		if _, resource, ok = nextARNToken(resource); !ok {
+			return "", "", false
+		}
+		var kind string
+		if kind, resource, ok = nextARNToken(resource); !ok || (kind != "accesspoint" && kind != "bucket") {
+			return "", "", false
+		}
+	default:
+		return "", "", false
+	}
+	name, rest, found := strings.Cut(resource, "/")
+	if name == "" || strings.Contains(name, ":") {
+		return "", "", false
+	}
+	if found {
+		rest = "/" + rest
+	}
+	return name, rest, true
+}
+
+// parseCopySourceARN recognizes an access point ARN in X-Amz-Copy-Source,
+// where the key follows an "/object/" separator:
+// arn:aws:s3:us-east-1:123456789012:accesspoint/my-ap/object/reports/a.csv.
+// It returns the access point name and the still-escaped key.
+func parseCopySourceARN(src string) (name, key string, ok bool) {
+	src = strings.TrimPrefix(src, "/")
+	if len(src) > 6 && strings.EqualFold(src[:6], "arn%3A") {
+		// The ARN itself may be percent-encoded; the key must stay as sent.
+		arn, key, found := strings.Cut(src, "/object/")
+		if !found {
+			arn, key, found = strings.Cut(src, "%2Fobject%2F")
+		}
+		decoded, err := url.PathUnescape(arn)
+		if !found || err != nil {
+			return "", "", false
+		}
+		src = decoded + "/object/" + key
+	}
+	name, rest, ok := parseAccessPointARN(src)
+	if !ok {
+		return "", "", false
+	}
+	key, ok = strings.CutPrefix(rest, "/object/")
+	return name, key, ok
+}
+
+// nextARNToken splits the next "/"- or ":"-separated token off an ARN
+// resource.
+func nextARNToken(resource string) (tok, rest string, ok bool) {
+	i := strings.IndexAny(resource, "/:")
+	if i <= 0 {
+		return "", "", false
+	}
+	return resource[:i], resource[i+1:], true
+}
+
+// cutARNToken removes the leading token of an ARN resource if it is want.
+func cutARNToken(resource, want string) (string, bool) {
+	tok, rest, ok := nextARNToken(resource)
+	return rest, ok && tok == want
+}
+
+// adminPath reports whether path is in the admin API's namespace. A bucket
+// name or ARN must not resolve into it: the auth middleware has already
+// decided how to treat the request from the path the client sent.
+func adminPath(path string) bool {
+	return path == "/admin" || strings.HasPrefix(path, "/admin/")
+}
+
+// setRequestPath replaces the request path, dropping the raw form so that
+// the path is re-escaped from the decoded value.
+func setRequestPath(r *http.Request, path string) {
+	if r.URL.Path == path {
+		return
+	}
+	r.URL.Path = path
+	r.URL.RawPath = ""
+}
+
+// bucketResolverMiddleware applies virtual-host and alias resolution. It must
+// run inside the auth middleware because signatures cover the request as the
+// client addressed it. The request is rewritten in place so that metrics
+// recorded by the outer middleware are attributed to the resolved bucket.
+func bucketResolverMiddleware(b *bucketResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := b.resolve(r); err != nil {
+				xmlutil.WriteErrorResponse(w, r, err)
+				return
+			}
+			// A token's scope was checked against the path as the client
+			// addressed it; check it again against the bucket it resolved to.
+			if scope := auth.ScopeFromContext(r.Context()); scope != nil && !scope.Allows(r) {
+				xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
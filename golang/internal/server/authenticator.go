@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+)
+
+// Identity is the principal a request authenticated as. The zero Identity
+// is anonymous, and is admitted only when auth.enforce_acls is on. The
+// identity whose AccessKeyID is auth.access_key is the server owner, with
+// access to everything including the admin API.
+type Identity = auth.Identity
+
+// Authenticator authenticates requests, letting embedders plug in their
+// own scheme (JWT, OIDC, an internal token service) in place of SigV4.
+// VerifyRequest rejects a request by returning an error: an
+// *s3err.S3Error is sent as it is, and any other error as InternalError.
+// Health, metrics and docs endpoints are never authenticated.
+type Authenticator interface {
+	VerifyRequest(ctx context.Context, r *http.Request) (Identity, error)
+}
+
+// WithAuthenticator replaces the built-in SigV4 authentication with a. The
+// rest of the pipeline, from per-key rate limits to ACL checks, works from
+// the Identity a returns.
+func WithAuthenticator(a Authenticator) ServerOption {
+	return func(s *Server) {
+		s.authn = a
+	}
+}
+
+// sigv4Authenticator is the default Authenticator: SigV4 headers and
+// presigned URLs, delegation tokens and TLS client certificates.
+type sigv4Authenticator struct {
+	verifier *auth.SigV4Verifier
+}
+
+func (a sigv4Authenticator) VerifyRequest(_ context.Context, r *http.Request) (Identity, error) {
+	return a.verifier.Authenticate(r)
+}
+
+// authMiddleware authenticates requests with the server's Authenticator.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return auth.MiddlewareFunc(func(r *http.Request) (Identity, error) {
+		return s.authn.VerifyRequest(r.Context(), r)
+	})(next)
+}
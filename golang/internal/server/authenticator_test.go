@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+)
+
+// tokenAuthenticator maps an X-Test-Token header to an identity.
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) VerifyRequest(_ context.Context, r *http.Request) (Identity, error) {
+	switch token := r.Header.Get("X-Test-Token"); token {
+	case "":
+		return Identity{}, s3err.ErrAccessDenied
+	case "anonymous":
+		return Identity{}, nil
+	case "broken":
+		return Identity{}, errors.New("token service unavailable")
+	case "ownerless":
+		return Identity{OwnerID: "ownerless"}, nil
+	default:
+		return Identity{AccessKeyID: token, OwnerID: token, DisplayName: token}, nil
+	}
+}
+
+func TestWithAuthenticator(t *testing.T) {
+	srv := newTestServerWithBackends(t, WithAuthenticator(tokenAuthenticator{}))
+	handler := srv.buildHandler()
+	do := func(token, method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("X-Test-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// SigV4 is replaced, so signatures are not even looked at.
+	if rec := do("bleepstore", "PUT", "/bkt"); rec.Code != http.StatusOK {
+		t.Fatalf("PUT /bkt as the server owner = %d: %s", rec.Code, rec.Body.String())
+	}
+	tests := []struct {
+		token, method, path string
+		want                int
+	}{
+		{"", "GET", "/bkt", http.StatusForbidden},
+		{"alice", "GET", "/bkt", http.StatusOK},
+		{"broken", "GET", "/bkt", http.StatusInternalServerError},
+		{"ownerless", "GET", "/bkt", http.StatusForbidden},
+		{"anonymous", "GET", "/bkt", http.StatusForbidden},
+		{"anonymous", "GET", "/admin/bucket-health/bkt", http.StatusForbidden},
+		{"alice", "GET", "/admin/bucket-health/bkt", http.StatusForbidden},
+		{"bleepstore", "GET", "/admin/bucket-health/bkt", http.StatusOK},
+		{"", "GET", "/health", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := do(tt.token, tt.method, tt.path).Code; got != tt.want {
+			t.Errorf("%s %s with token %q = %d, want %d", tt.method, tt.path, tt.token, got, tt.want)
+		}
+	}
+
+	// Writes are owned by the identity the authenticator returned.
+	if rec := do("alice", "PUT", "/bkt/doc"); rec.Code != http.StatusOK {
+		t.Fatalf("PUT /bkt/doc as alice = %d", rec.Code)
+	}
+	rec := do("alice", "GET", "/bkt/doc?acl")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /bkt/doc?acl = %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "<ID>alice</ID>") {
+		t.Errorf("object ACL = %s, want owner alice", body)
+	}
+
+	// SigV4-only features are not advertised.
+	rec = do("alice", "GET", "/?bleepstore-capabilities")
+	var caps capabilities
+	if err := json.Unmarshal(rec.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("decoding capabilities: %v (%s)", err, rec.Body.String())
+	}
+	if caps.Features["presigned_urls"] {
+		t.Error("presigned_urls advertised with a custom authenticator")
+	}
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// writeGate admits S3 writes and background passes that change metadata or
+// stored data, until a backup closes it. Closing waits for the writes
+// already admitted. A nil gate admits everything.
+type writeGate struct {
+	// standby, if set, reports whether this instance is an HA standby,
+	// which leaves shared state to the leader.
+	standby func() bool
+
+	mu       sync.Mutex
+	closed   bool
+	inFlight int
+	drained  chan struct{} // closed when the last admitted write leaves a closed gate
+}
+
+// enter admits a write, or returns false while the gate is closed or this
+// instance is an HA standby. Each admitted write must call leave when it
+// is done.
+func (g *writeGate) enter() bool {
+	if g != nil && g.standby != nil && g.standby() {
+		return false
+	}
+	return g.enterAny()
+}
+
+// enterAny is enter for writes a standby makes too, such as flushing its
+// own usage counters: it only refuses while the gate is closed.
+func (g *writeGate) enterAny() bool {
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return false
+	}
+	g.inFlight++
+	return true
+}
+
+// leave ends a write admitted by enter.
+func (g *writeGate) leave() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight--
+	if g.inFlight == 0 && g.drained != nil {
+		close(g.drained)
+		g.drained = nil
+	}
+}
+
+// close stops admitting writes and waits for those in progress. If ctx ends
+// first, the gate is reopened and ctx's error returned.
+func (g *writeGate) close(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	if g.inFlight == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	drained := make(chan struct{})
+	g.drained = drained
+	g.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		g.open()
+		return ctx.Err()
+	}
+}
+
+// open admits writes again.
+func (g *writeGate) open() {
+	g.mu.Lock()
+	g.closed = false
+	g.drained = nil
+	g.mu.Unlock()
+}
+
+var (
+	// errBackupInProgress is returned by the pre hook while writes are
+	// already quiesced.
+	errBackupInProgress = &s3err.S3Error{
+		Code:       "OperationAborted",
+		Message:    "A backup is already in progress",
+		HTTPStatus: http.StatusConflict,
+	}
+
+	// errNoBackup is returned by the post hook when the backup it names is
+	// not the one in progress, e.g. because writes already resumed after
+	// max_quiesce_ms.
+	errNoBackup = &s3err.S3Error{
+		Code:       "OperationAborted",
+		Message:    "No such backup is in progress; writes may have resumed before it finished",
+		HTTPStatus: http.StatusConflict,
+	}
+)
+
+// backupMarker describes one quiesced window. The pre hook writes it to the
+// marker file, whose copy in a backup identifies the window the backup was
+// taken in, and returns it.
+type backupMarker struct {
+	ID           string    `json:"backup_id"`
+	QuiescedAt   time.Time `json:"quiesced_at"`
+	ResumeBy     time.Time `json:"resume_by"`
+	Checkpointed bool      `json:"wal_checkpointed"`
+	Engine       string    `json:"metadata_engine"`
+	Backend      string    `json:"storage_backend"`
+	MarkerPath   string    `json:"marker_path"`
+}
+
+// backupResumed is the JSON body returned by the post hook.
+type backupResumed struct {
+	ID         string `json:"backup_id"`
+	QuiescedMs int64  `json:"quiesced_ms"`
+}
+
+// backupHooks quiesces writes around a filesystem-level backup of the data
+// directory and metadata database: the pre hook closes the write gate,
+// checkpoints the write-ahead log and writes a marker file, and the post
+// hook, or max_quiesce_ms passing, reopens the gate.
+type backupHooks struct {
+	gate         *writeGate
+	meta         metadata.MetadataStore
+	clock        clock.Clock
+	ids          clock.IDGenerator
+	drainTimeout time.Duration
+	maxQuiesce   time.Duration
+	markerPath   string
+	engine       string
+	backend      string
+
+	mu     sync.Mutex
+	active *backupMarker
+	timer  *time.Timer
+}
+
+// begin quiesces writes and writes the marker file.
+func (b *backupHooks) begin(ctx context.Context) (*backupMarker, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.active != nil {
+		return nil, errBackupInProgress
+	}
+
+	drainCtx, cancel := context.WithTimeout(ctx, b.drainTimeout)
+	defer cancel()
+	if err := b.gate.close(drainCtx); err != nil {
+		return nil, fmt.Errorf("waiting for writes in progress: %w", err)
+	}
+
+	now := b.clock.Now().UTC()
+	marker := &backupMarker{
+		ID:         b.ids.NewID(),
+		QuiescedAt: now,
+		ResumeBy:   now.Add(b.maxQuiesce),
+		Engine:     b.engine,
+		Backend:    b.backend,
+		MarkerPath: b.markerPath,
+	}
+	if m, ok := b.meta.(metadata.Maintainer); ok {
+		if err := m.Checkpoint(ctx); err != nil {
+			b.gate.open()
+			return nil, fmt.Errorf("checkpointing metadata: %w", err)
+		}
+		marker.Checkpointed = true
+	}
+	if err := writeMarker(b.markerPath, marker); err != nil {
+		b.gate.open()
+		return nil, err
+	}
+
+	b.active = marker
+	id := marker.ID
+	b.timer = time.AfterFunc(b.maxQuiesce, func() {
+		if b.end(id) != nil {
+			slog.Warn("Backup did not finish in time; writes resumed", "backup_id", id)
+		}
+	})
+	metrics.WritesQuiesced.Set(1)
+	slog.Info("Writes quiesced for backup", "backup_id", id, "marker", b.markerPath)
+	return marker, nil
+}
+
+// end resumes writes after the backup id. It returns nil if id is not the
+// backup in progress.
+func (b *backupHooks) end(id string) *backupResumed {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.active == nil || b.active.ID != id {
+		return nil
+	}
+	b.timer.Stop()
+	b.gate.open()
+	resumed := &backupResumed{ID: id, QuiescedMs: b.clock.Now().Sub(b.active.QuiescedAt).Milliseconds()}
+	b.active = nil
+	metrics.WritesQuiesced.Set(0)
+	slog.Info("Writes resumed after backup", "backup_id", id, "quiesced_ms", resumed.QuiescedMs)
+	return resumed
+}
+
+// writeMarker durably replaces the marker file with marker.
+func writeMarker(path string, marker *backupMarker) error {
+	data, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("writing backup marker: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".backup-marker-*")
+	if err != nil {
+		return fmt.Errorf("writing backup marker: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing backup marker: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing backup marker: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing backup marker: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing backup marker: %w", err)
+	}
+	return nil
+}
+
+// handleBackupPre quiesces writes for a backup: S3 writes get 503
+// ServiceUnavailable and background workers pause until the post hook.
+// It returns the marker as JSON once writes in progress have finished, the
+// write-ahead log is checkpointed and the marker file is written.
+func (s *Server) handleBackupPre(w http.ResponseWriter, r *http.Request) {
+
+	marker, err := s.backup.begin(r.Context())
+	if err != nil {
+		if s3e, ok := err.(*s3err.S3Error); ok {
+			xmlutil.WriteErrorResponse(w, r, s3e)
+			return
+		}
+		slog.Error("Backup pre hook error", "error", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// Writes in progress did not finish within drain_timeout_ms.
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrServiceUnavailable)
+			return
+		}
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(marker)
+}
+
+// handleBackupPost resumes writes after the backup named by the "id" query
+// parameter. A 409 means the backup is not in progress, e.g. because
+// writes resumed after max_quiesce_ms, and its copy may be inconsistent.
+func (s *Server) handleBackupPost(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+		return
+	}
+
+	resumed := s.backup.end(id)
+	if resumed == nil {
+		xmlutil.WriteErrorResponse(w, r, errNoBackup)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resumed)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteGate(t *testing.T) {
+	g := &writeGate{}
+	if !g.enter() {
+		t.Fatal("open gate refused a write")
+	}
+
+	// Closing waits for the admitted write.
+	closed := make(chan error, 1)
+	go func() { closed <- g.close(context.Background()) }()
+	select {
+	case <-closed:
+		t.Fatal("close returned with a write in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+	g.leave()
+	if err := <-closed; err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if g.enter() {
+		t.Fatal("closed gate admitted a write")
+	}
+	g.open()
+
+	// A write that does not finish in time reopens the gate.
+	g.enter()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("close with a stuck write = %v, want DeadlineExceeded", err)
+	}
+	if !g.enter() {
+		t.Fatal("gate still closed after a failed close")
+	}
+
+	var none *writeGate
+	if !none.enter() {
+		t.Error("nil gate refused a write")
+	}
+}
+
+func TestBackupHooks(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.backup.markerPath = filepath.Join(t.TempDir(), "marker", "backup-marker.json")
+	ctx := context.Background()
+	srv.probeRequest(ctx, "PUT", "/bkt", nil)
+
+	hook := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("POST", target, nil))
+		return rec
+	}
+
+	rec := hook(srv.handleBackupPre, "/admin/backup/pre")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("pre hook: %d %s", rec.Code, rec.Body.String())
+	}
+	var marker backupMarker
+	json.Unmarshal(rec.Body.Bytes(), &marker)
+	if marker.ID == "" || !marker.Checkpointed {
+		t.Errorf("marker = %+v", marker)
+	}
+	raw, err := os.ReadFile(srv.backup.markerPath)
+	if err != nil {
+		t.Fatalf("reading marker file: %v", err)
+	}
+	var written backupMarker
+	if json.Unmarshal(raw, &written); written.ID != marker.ID {
+		t.Errorf("marker file = %s, want backup %s", raw, marker.ID)
+	}
+
+	// Writes are refused and reads served while quiesced.
+	if res := srv.probeRequest(ctx, "PUT", "/bkt/k", []byte("data")); res.code != http.StatusServiceUnavailable {
+		t.Errorf("PUT while quiesced: status %d, want 503", res.code)
+	}
+	if res := srv.probeRequest(ctx, "GET", "/bkt?list-type=2", nil); res.code != http.StatusOK {
+		t.Errorf("list while quiesced: status %d, want 200", res.code)
+	}
+	if rec := hook(srv.handleBackupPre, "/admin/backup/pre"); rec.Code != http.StatusConflict {
+		t.Errorf("second pre hook: status %d, want 409", rec.Code)
+	}
+	if rec := hook(srv.handleBackupPost, "/admin/backup/post?id=other"); rec.Code != http.StatusConflict {
+		t.Errorf("post hook for another backup: status %d, want 409", rec.Code)
+	}
+
+	if rec := hook(srv.handleBackupPost, "/admin/backup/post?id="+marker.ID); rec.Code != http.StatusOK {
+		t.Fatalf("post hook: %d %s", rec.Code, rec.Body.String())
+	}
+	if res := srv.probeRequest(ctx, "PUT", "/bkt/k", []byte("data")); res.code != http.StatusOK {
+		t.Errorf("PUT after resume: status %d, want 200", res.code)
+	}
+
+	// Writes resume on their own when the post hook never comes.
+	srv.backup.maxQuiesce = 10 * time.Millisecond
+	rec = hook(srv.handleBackupPre, "/admin/backup/pre")
+	json.Unmarshal(rec.Body.Bytes(), &marker)
+	time.Sleep(50 * time.Millisecond)
+	if res := srv.probeRequest(ctx, "PUT", "/bkt/k", []byte("data")); res.code != http.StatusOK {
+		t.Errorf("PUT after max quiesce: status %d, want 200", res.code)
+	}
+	if rec := hook(srv.handleBackupPost, "/admin/backup/post?id="+marker.ID); rec.Code != http.StatusConflict {
+		t.Errorf("post hook after max quiesce: status %d, want 409", rec.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// bucketHealthProbePrefix is the key prefix of the data written by a bucket
+// health check. It goes to the storage backend only, never to metadata.
+const bucketHealthProbePrefix = ".bleepstore-health/"
+
+// bucketHealthResponse is the JSON body returned by /admin/bucket-health.
+type bucketHealthResponse struct {
+	Bucket string `json:"bucket"`
+	Status string `json:"status"`
+	// Frozen is set when the bucket is frozen read-only, which S3 writes
+	// will be refused for however healthy its storage is.
+	Frozen bool                      `json:"frozen,omitempty"`
+	Checks map[string]componentCheck `json:"checks"`
+}
+
+// handleBucketHealth serves GET /admin/bucket-health/{bucket}, a deep
+// HeadBucket for monitoring: it reads the bucket's metadata row and one
+// object row, then writes, reads back and deletes a probe object directly
+// in the storage backend, timing each step. It answers 200 if every check
+// passed and 503 otherwise. The storage checks are skipped, not failed,
+// where this instance may not write: on a replica, an HA standby, or while
+// a backup holds writes.
+func (s *Server) handleBucketHealth(w http.ResponseWriter, r *http.Request) {
+	if s.meta == nil || s.store == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+	ctx := r.Context()
+	bucket := chi.URLParam(r, "bucket")
+	resp := bucketHealthResponse{Bucket: bucket, Status: "ok", Checks: map[string]componentCheck{}}
+	check := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		c := componentCheck{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			c.Status, c.Error = "error", err.Error()
+			resp.Status = "degraded"
+		}
+		resp.Checks[name] = c
+		return err == nil
+	}
+
+	var found bool
+	if !check("metadata_bucket", func() error {
+		b, err := s.meta.GetBucket(ctx, bucket)
+		found = b != nil
+		return err
+	}) {
+		s.writeBucketHealth(w, resp)
+		return
+	}
+	if !found {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return
+	}
+	check("metadata_objects", func() error {
+		_, err := s.meta.ListObjects(ctx, bucket, metadata.ListObjectsOptions{MaxKeys: 1})
+		return err
+	})
+	if s.freezes != nil {
+		check("metadata_freeze", func() error {
+			f, err := s.freezes.GetBucketFreeze(ctx, bucket)
+			resp.Frozen = f != nil
+			return err
+		})
+	}
+
+	skip := func(names ...string) {
+		for _, name := range names {
+			resp.Checks[name] = componentCheck{Status: "skipped"}
+		}
+	}
+	if s.readOnly || !s.writes.enter() {
+		skip("storage_write", "storage_read", "storage_delete")
+		s.writeBucketHealth(w, resp)
+		return
+	}
+	defer s.writes.leave()
+	if !s.probeBucketStorage(ctx, bucket, check) {
+		skip("storage_read", "storage_delete")
+	}
+	s.writeBucketHealth(w, resp)
+}
+
+// probeBucketStorage writes, reads back and deletes a probe object in
+// bucket's storage, recording each step with check. It returns false if
+// the write failed, after trying to delete whatever it left behind.
+func (s *Server) probeBucketStorage(ctx context.Context, bucket string, check func(string, func() error) bool) bool {
+	key := bucketHealthProbePrefix + s.ids.NewID()
+	body := []byte(key)
+	if !check("storage_write", func() error {
+		_, _, err := s.store.PutObject(ctx, bucket, key, bytes.NewReader(body), int64(len(body)))
+		return err
+	}) {
+		if err := s.store.DeleteObject(context.WithoutCancel(ctx), bucket, key); err != nil {
+			slog.Debug("Bucket health probe cleanup failed", "bucket", bucket, "key", key, "error", err)
+		}
+		return false
+	}
+	check("storage_read", func() error {
+		rc, _, _, err := s.store.GetObject(ctx, bucket, key)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		got, err := io.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, body) {
+			return errors.New("read back different data than was written")
+		}
+		return nil
+	})
+	check("storage_delete", func() error {
+		return s.store.DeleteObject(context.WithoutCancel(ctx), bucket, key)
+	})
+	return true
+}
+
+// writeBucketHealth sends resp, with a 503 status unless every check passed.
+func (s *Server) writeBucketHealth(w http.ResponseWriter, resp bucketHealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
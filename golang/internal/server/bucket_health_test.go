@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// readOnlyStorage fails every PutObject of the wrapped backend.
+type readOnlyStorage struct {
+	storage.StorageBackend
+}
+
+func (readOnlyStorage) PutObject(context.Context, string, string, io.Reader, int64) (int64, string, error) {
+	return 0, "", errors.New("read-only file system")
+}
+
+func getBucketHealth(t *testing.T, srv *Server, bucket string) (int, bucketHealthResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	asRoot(srv).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/bucket-health/"+bucket, nil))
+	var resp bucketHealthResponse
+	if rec.Code != http.StatusNotFound {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestBucketHealth(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServerWithBackends(t)
+	srv.probeRequest(ctx, "PUT", "/data", nil)
+
+	code, resp := getBucketHealth(t, srv, "data")
+	if code != http.StatusOK || resp.Status != "ok" || resp.Bucket != "data" {
+		t.Fatalf("bucket health = %d %+v", code, resp)
+	}
+	for _, name := range []string{"metadata_bucket", "metadata_objects", "metadata_freeze", "storage_write", "storage_read", "storage_delete"} {
+		if resp.Checks[name].Status != "ok" {
+			t.Errorf("check %s = %+v", name, resp.Checks[name])
+		}
+	}
+	if code, _ := getBucketHealth(t, srv, "missing"); code != http.StatusNotFound {
+		t.Errorf("health of a missing bucket = %d, want 404", code)
+	}
+
+	// While a backup holds writes, storage is not probed.
+	srv.writes.close(ctx)
+	code, resp = getBucketHealth(t, srv, "data")
+	srv.writes.open()
+	if code != http.StatusOK || resp.Checks["storage_write"].Status != "skipped" {
+		t.Errorf("bucket health with writes held = %d %+v", code, resp.Checks)
+	}
+}
+
+func TestBucketHealthStorageFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "objects")
+	os.MkdirAll(dir, 0o755)
+	local, err := storage.NewLocalBackend(dir)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	srv := newTestServerWithBackends(t, WithStorageBackend(readOnlyStorage{local}))
+	srv.probeRequest(ctx, "PUT", "/data", nil)
+
+	code, resp := getBucketHealth(t, srv, "data")
+	if code != http.StatusServiceUnavailable || resp.Status != "degraded" {
+		t.Fatalf("bucket health = %d %+v", code, resp)
+	}
+	if c := resp.Checks["storage_write"]; c.Status != "error" || c.Error != "read-only file system" {
+		t.Errorf("storage_write = %+v", c)
+	}
+	if resp.Checks["metadata_bucket"].Status != "ok" || resp.Checks["storage_read"].Status != "skipped" {
+		t.Errorf("checks = %+v", resp.Checks)
+	}
+}
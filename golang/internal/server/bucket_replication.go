@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/replication"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+const (
+	// bucketReplicationBatchSize is the number of due tasks fetched at once.
+	bucketReplicationBatchSize = 64
+
+	// bucketReplicationBaseBackoff and bucketReplicationMaxBackoff bound the
+	// delay before retrying a failed task, which doubles with each attempt.
+	bucketReplicationBaseBackoff = time.Second
+	bucketReplicationMaxBackoff  = 10 * time.Minute
+)
+
+// bucketReplicator drains the replication queue, copying queued writes to,
+// and queued deletions from, the destination bucket of each object's
+// replication rule on the remote endpoint. Failed tasks are retried with
+// exponential backoff; a write that fails maxAttempts times leaves its
+// object FAILED.
+type bucketReplicator struct {
+	meta        metadata.MetadataStore
+	queue       metadata.ReplicationStore
+	store       storage.StorageBackend
+	rules       *replication.Rules
+	target      *storage.S3Target
+	interval    time.Duration
+	maxAttempts int
+	clock       clock.Clock                // schedules retries and selects due tasks
+	gate        *writeGate                 // closed while writes are quiesced for a backup
+	freezes     metadata.BucketFreezeStore // nil if the engine records no freezes
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop.
+func (b *bucketReplicator) start() {
+	b.wg.Add(1)
+	go b.loop()
+}
+
+// stop terminates the background loop, cancelling the current copy.
+func (b *bucketReplicator) stop() {
+	close(b.stopCh)
+	b.wg.Wait()
+}
+
+// loop drains due tasks every interval.
+func (b *bucketReplicator) loop() {
+	defer b.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-b.stopCh
+		cancel()
+	}()
+
+	tickC, stopTick := tick(b.interval)
+	defer stopTick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickC:
+			if err := b.drain(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("Bucket replication error", "error", err)
+			}
+		}
+	}
+}
+
+// drain processes due tasks until none are left.
+func (b *bucketReplicator) drain(ctx context.Context) error {
+	for {
+		tasks, err := b.queue.ListReplication(ctx, b.clock.Now(), bucketReplicationBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			// Stop for now if writes are quiesced for a backup.
+			if !b.gate.enter() {
+				return nil
+			}
+			err := b.process(ctx, task)
+			b.gate.leave()
+			if err != nil {
+				return err
+			}
+		}
+		if len(tasks) < bucketReplicationBatchSize {
+			return nil
+		}
+	}
+}
+
+// process attempts one task. It returns an error only if the queue could
+// not be updated; failures to replicate are recorded on the task.
+func (b *bucketReplicator) process(ctx context.Context, task metadata.ReplicationTask) error {
+	op := "put"
+	if task.Delete {
+		op = "delete"
+	}
+	rule := b.rules.Match(task.Bucket, task.Key)
+
+	if task.Delete {
+		if rule == nil {
+			// The rule was removed or disabled since the delete was queued.
+			metrics.BucketReplicationTotal.WithLabelValues(op, "stale").Inc()
+			return b.queue.RemoveReplication(ctx, task)
+		}
+		// A frozen bucket's replica keeps the object too; the delete waits,
+		// without using up attempts, until the bucket is unfrozen.
+		if frozen, err := bucketFrozen(ctx, b.freezes, task.Bucket); err != nil {
+			return b.retry(ctx, task, op, err)
+		} else if frozen {
+			task.NextAttemptAt = b.clock.Now().Add(bucketReplicationMaxBackoff)
+			task.LastError = "bucket is frozen"
+			return b.queue.UpdateReplication(ctx, task)
+		}
+		if err := b.target.DeleteObject(ctx, replication.DestinationBucket(rule), task.Key); err != nil {
+			return b.retry(ctx, task, op, err)
+		}
+		metrics.BucketReplicationTotal.WithLabelValues(op, "success").Inc()
+		return b.queue.RemoveReplication(ctx, task)
+	}
+
+	obj, err := b.meta.GetObject(ctx, task.Bucket, task.Key)
+	if err != nil {
+		return b.retry(ctx, task, op, err)
+	}
+	if obj == nil || obj.ETag != task.ETag {
+		// Overwritten or deleted since: a newer task, if any, replaced this one.
+		metrics.BucketReplicationTotal.WithLabelValues(op, "stale").Inc()
+		return b.queue.RemoveReplication(ctx, task)
+	}
+	if rule == nil {
+		return b.fail(ctx, task, op, fmt.Errorf("no enabled replication rule applies"))
+	}
+	if err := b.copy(ctx, obj, replication.DestinationBucket(rule), rule.Destination.StorageClass); err != nil {
+		return b.retry(ctx, task, op, err)
+	}
+
+	metrics.BucketReplicationTotal.WithLabelValues(op, "success").Inc()
+	metrics.BucketReplicationBytesTotal.Add(float64(obj.Size))
+	if err := b.queue.SetReplicationStatus(ctx, obj.Bucket, obj.Key, obj.ETag, metadata.ReplicationCompleted); err != nil {
+		return err
+	}
+	return b.queue.RemoveReplication(ctx, task)
+}
+
+// copy writes obj's data and attributes to bucket on the target. Data read
+// from the storage backend is staged in a temp file first, since the
+// upload must be seekable.
+func (b *bucketReplicator) copy(ctx context.Context, obj *metadata.ObjectRecord, bucket, storageClass string) error {
+	var body io.ReadSeeker
+	if obj.InlineData != nil {
+		body = bytes.NewReader(obj.InlineData)
+	} else {
+		rc, _, _, err := b.store.GetObject(ctx, obj.Bucket, obj.Key)
+		if err != nil {
+			return fmt.Errorf("reading object: %w", err)
+		}
+		if obj.Compression != "" {
+			if rc, err = storage.NewDecompressReader(obj.Compression, rc); err != nil {
+				return fmt.Errorf("reading object: %w", err)
+			}
+		}
+		tmp, err := os.CreateTemp("", "bleepstore-replication-*")
+		if err != nil {
+			rc.Close()
+			return err
+		}
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+		n, err := io.Copy(tmp, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("staging object: %w", err)
+		}
+		if n != obj.Size {
+			return fmt.Errorf("object data is %d bytes, metadata says %d", n, obj.Size)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		body = tmp
+	}
+
+	if storageClass == "" {
+		storageClass = obj.StorageClass
+	}
+	return b.target.PutObject(ctx, bucket, obj.Key, body, obj.Size, storage.ReplicaAttrs{
+		ContentType:        obj.ContentType,
+		ContentEncoding:    obj.ContentEncoding,
+		ContentLanguage:    obj.ContentLanguage,
+		ContentDisposition: obj.ContentDisposition,
+		CacheControl:       obj.CacheControl,
+		Expires:            obj.Expires,
+		StorageClass:       storageClass,
+		Metadata:           obj.UserMetadata,
+	})
+}
+
+// retry records a failed attempt and schedules the next one, or gives up
+// after maxAttempts.
+func (b *bucketReplicator) retry(ctx context.Context, task metadata.ReplicationTask, op string, cause error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	task.Attempts++
+	if task.Attempts >= b.maxAttempts {
+		return b.fail(ctx, task, op, cause)
+	}
+	backoff := bucketReplicationBaseBackoff << (task.Attempts - 1)
+	if backoff > bucketReplicationMaxBackoff || backoff <= 0 {
+		backoff = bucketReplicationMaxBackoff
+	}
+	task.NextAttemptAt = b.clock.Now().Add(backoff)
+	task.LastError = cause.Error()
+	slog.Warn("Bucket replication attempt failed", "bucket", task.Bucket, "key", task.Key, "op", op,
+		"attempts", task.Attempts, "retry_in", backoff, "error", cause)
+	metrics.BucketReplicationTotal.WithLabelValues(op, "retry").Inc()
+	return b.queue.UpdateReplication(ctx, task)
+}
+
+// fail gives up on a task, marking a written object FAILED.
+func (b *bucketReplicator) fail(ctx context.Context, task metadata.ReplicationTask, op string, cause error) error {
+	slog.Error("Bucket replication failed", "bucket", task.Bucket, "key", task.Key, "op", op,
+		"attempts", task.Attempts, "error", cause)
+	metrics.BucketReplicationTotal.WithLabelValues(op, "failed").Inc()
+	if !task.Delete {
+		if err := b.queue.SetReplicationStatus(ctx, task.Bucket, task.Key, task.ETag, metadata.ReplicationFailed); err != nil {
+			return err
+		}
+	}
+	return b.queue.RemoveReplication(ctx, task)
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// newBucketReplicationServer returns a server replicating buckets to the
+// S3 endpoint at url, with verify as its verification settings.
+func newBucketReplicationServer(t *testing.T, url string, verify config.ReplicationVerifyConfig) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("creating metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	store, err := storage.NewLocalBackend(filepath.Join(dir, "objects"))
+	if err != nil {
+		t.Fatalf("creating storage backend: %v", err)
+	}
+	cfg := &config.Config{
+		Server: config.ServerConfig{Region: "us-east-1"},
+		Auth:   config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+		BucketReplication: config.BucketReplicationConfig{
+			Enabled: true, EndpointURL: url, Region: "us-east-1", UsePathStyle: true,
+			AccessKeyID: "bleepstore", SecretAccessKey: "bleepstore-secret", MaxAttempts: 2,
+			Verify: verify,
+		},
+	}
+	cfg.Metadata.Engine = "sqlite"
+	srv, err := New(cfg, meta, WithStorageBackend(store))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return srv
+}
+
+func TestBucketReplication(t *testing.T) {
+	ctx := context.Background()
+	dst := newTestServerWithBackends(t)
+	dst.meta.PutCredential(ctx, &metadata.CredentialRecord{
+		AccessKeyID: "bleepstore", SecretKey: "bleepstore-secret", Active: true, CreatedAt: time.Now(),
+	})
+	if res := dst.probeRequest(ctx, "PUT", "/dst", nil); res.code != 200 {
+		t.Fatalf("creating destination bucket: %d %s", res.code, res.body.String())
+	}
+	ts := httptest.NewServer(dst.buildHandler())
+	defer ts.Close()
+
+	src := newBucketReplicationServer(t, ts.URL, config.ReplicationVerifyConfig{})
+	src.probeRequest(ctx, "PUT", "/src", nil)
+	if res := src.probeRequest(ctx, "GET", "/src?replication", nil); res.code != 404 ||
+		!strings.Contains(res.body.String(), "ReplicationConfigurationNotFoundError") {
+		t.Fatalf("GetBucketReplication before put = %d %s", res.code, res.body.String())
+	}
+	rules := `<ReplicationConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+		<Role>arn:aws:iam::1:role/r</Role>
+		<Rule><ID>all</ID><Status>Enabled</Status><Filter><Prefix></Prefix></Filter>
+			<Destination><Bucket>arn:aws:s3:::dst</Bucket></Destination>
+			<DeleteMarkerReplication><Status>Enabled</Status></DeleteMarkerReplication></Rule>
+	</ReplicationConfiguration>`
+	if res := src.probeRequest(ctx, "PUT", "/src?replication", []byte(rules)); res.code != 200 {
+		t.Fatalf("PutBucketReplication = %d %s", res.code, res.body.String())
+	}
+	if res := src.probeRequest(ctx, "GET", "/src?replication", nil); !strings.Contains(res.body.String(), "arn:aws:s3:::dst") {
+		t.Fatalf("GetBucketReplication = %d %s", res.code, res.body.String())
+	}
+
+	header := http.Header{"Content-Type": {"text/plain"}, "X-Amz-Meta-Color": {"blue"}}
+	src.provisionRequest(ctx, "PUT", "/src/a", header, []byte("hello"))
+	status := func(key string) string {
+		return src.probeRequest(ctx, "HEAD", "/src/"+key, nil).header.Get("x-amz-replication-status")
+	}
+	if got := status("a"); got != "PENDING" {
+		t.Errorf("status before replication = %q, want PENDING", got)
+	}
+
+	if err := src.bucketRepl.drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if got := status("a"); got != "COMPLETED" {
+		t.Errorf("status after replication = %q, want COMPLETED", got)
+	}
+	res := dst.probeRequest(ctx, "GET", "/dst/a", nil)
+	if res.body.String() != "hello" || res.header.Get("Content-Type") != "text/plain" ||
+		res.header.Get("x-amz-meta-color") != "blue" {
+		t.Errorf("replica = %d %q %v", res.code, res.body.String(), res.header)
+	}
+
+	// Deletes are replicated too.
+	src.probeRequest(ctx, "DELETE", "/src/a", nil)
+	src.bucketRepl.drain(ctx)
+	if res := dst.probeRequest(ctx, "GET", "/dst/a", nil); res.code != 404 {
+		t.Errorf("replica after delete: status %d, want 404", res.code)
+	}
+
+	// A write that keeps failing is retried with backoff, by the
+	// replicator's clock, then marked FAILED.
+	broken := strings.Replace(rules, "arn:aws:s3:::dst", "arn:aws:s3:::missing", 1)
+	src.probeRequest(ctx, "PUT", "/src?replication", []byte(broken))
+	src.probeRequest(ctx, "PUT", "/src/b", []byte("data"))
+	fake := clock.NewFake(time.Now())
+	src.bucketRepl.clock = fake
+	src.bucketRepl.drain(ctx)
+	queue := src.meta.(metadata.ReplicationStore)
+	tasks, _ := queue.ListReplication(ctx, fake.Now().Add(time.Hour), 10)
+	if len(tasks) != 1 || tasks[0].Attempts != 1 || !tasks[0].NextAttemptAt.Equal(fake.Now().Add(bucketReplicationBaseBackoff).Truncate(time.Millisecond)) || tasks[0].LastError == "" {
+		t.Fatalf("queue after failed attempt = %+v", tasks)
+	}
+	src.bucketRepl.drain(ctx)
+	if got := status("b"); got != "PENDING" {
+		t.Errorf("status before the retry is due = %q, want PENDING", got)
+	}
+	fake.Advance(bucketReplicationBaseBackoff)
+	if err := src.bucketRepl.drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if got := status("b"); got != "FAILED" {
+		t.Errorf("status after max attempts = %q, want FAILED", got)
+	}
+	if tasks, _ = queue.ListReplication(ctx, time.Now().Add(time.Hour), 10); len(tasks) != 0 {
+		t.Errorf("queue not empty: %+v", tasks)
+	}
+}
+
+func TestBucketReplicationDisabled(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	ctx := context.Background()
+	srv.probeRequest(ctx, "PUT", "/b", nil)
+	srv.probeRequest(ctx, "PUT", "/b/k", []byte("data"))
+	if res := srv.probeRequest(ctx, "GET", "/b?replication", nil); res.code != http.StatusNotImplemented {
+		t.Errorf("GetBucketReplication with replication disabled: status %d, want 501", res.code)
+	}
+	if res := srv.probeRequest(ctx, "HEAD", "/b/k", nil); res.header.Get("x-amz-replication-status") != "" {
+		t.Error("replication status header set with replication disabled")
+	}
+	rec := httptest.NewRecorder()
+	srv.handleReplicationVerify(rec, httptest.NewRequest("POST", "/admin/bucket-replication/verify", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("verification with replication disabled: status %d, want 501", rec.Code)
+	}
+}
+
+func TestReplicationVerify(t *testing.T) {
+	ctx := context.Background()
+	dst := newTestServerWithBackends(t)
+	dst.meta.PutCredential(ctx, &metadata.CredentialRecord{
+		AccessKeyID: "bleepstore", SecretKey: "bleepstore-secret", Active: true, CreatedAt: time.Now(),
+	})
+	dst.probeRequest(ctx, "PUT", "/dst", nil)
+	ts := httptest.NewServer(dst.buildHandler())
+	defer ts.Close()
+
+	src := newBucketReplicationServer(t, ts.URL, config.ReplicationVerifyConfig{
+		ReportBucket: "reports", ReportPrefix: "verify/", SampleRate: 1,
+	})
+	src.probeRequest(ctx, "PUT", "/src", nil)
+	src.probeRequest(ctx, "PUT", "/reports", nil)
+	rules := `<ReplicationConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+		<Rule><ID>all</ID><Status>Enabled</Status><Filter><Prefix></Prefix></Filter>
+			<Destination><Bucket>arn:aws:s3:::dst</Bucket></Destination></Rule>
+	</ReplicationConfiguration>`
+	if res := src.probeRequest(ctx, "PUT", "/src?replication", []byte(rules)); res.code != 200 {
+		t.Fatalf("PutBucketReplication = %d %s", res.code, res.body.String())
+	}
+	for _, key := range []string{"ok", "tampered", "resized", "lost"} {
+		src.probeRequest(ctx, "PUT", "/src/"+key, []byte("hello"))
+	}
+	// A multipart object, whose ETag is not an MD5, is hashed.
+	res := src.probeRequest(ctx, "POST", "/src/multi?uploads", nil)
+	uploadID := strings.SplitN(strings.SplitN(res.body.String(), "<UploadId>", 2)[1], "</UploadId>", 2)[0]
+	res = src.probeRequest(ctx, "PUT", "/src/multi?partNumber=1&uploadId="+uploadID, []byte("in parts"))
+	complete := `<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>` + res.header.Get("ETag") +
+		`</ETag></Part></CompleteMultipartUpload>`
+	if res := src.probeRequest(ctx, "POST", "/src/multi?uploadId="+uploadID, []byte(complete)); res.code != 200 {
+		t.Fatalf("CompleteMultipartUpload = %d %s", res.code, res.body.String())
+	}
+	if err := src.bucketRepl.drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	src.probeRequest(ctx, "PUT", "/src/queued", []byte("not yet"))
+
+	dst.probeRequest(ctx, "PUT", "/dst/tampered", []byte("jello"))
+	dst.probeRequest(ctx, "PUT", "/dst/resized", []byte("hello!"))
+	dst.probeRequest(ctx, "DELETE", "/dst/lost", nil)
+
+	run, err := src.replVerify.run(ctx, src.replVerify.rules.Buckets(), 1)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(run.Reports) != 1 {
+		t.Fatalf("reports = %+v", run.Reports)
+	}
+	report := run.Reports[0]
+	if report.Error != "" || report.Objects != 6 || report.Checked != 5 || report.Matched != 2 ||
+		report.Diverged != 3 || report.Pending != 1 || !strings.HasPrefix(report.Report, "verify/src/") {
+		t.Errorf("report = %+v", report)
+	}
+	problems := map[string]string{}
+	for _, d := range report.Divergences {
+		problems[d.Key] = d.Problem
+	}
+	want := map[string]string{"tampered": divergenceChecksum, "resized": divergenceSize, "lost": divergenceMissing}
+	if len(problems) != len(want) {
+		t.Errorf("divergences = %+v", report.Divergences)
+	}
+	for key, problem := range want {
+		if problems[key] != problem {
+			t.Errorf("divergence of %s = %q, want %q", key, problems[key], problem)
+		}
+	}
+
+	// The report is written to the report bucket.
+	res = src.probeRequest(ctx, "GET", "/reports/"+report.Report, nil)
+	var written replicationVerifyReport
+	if res.code != 200 || json.Unmarshal(res.body.Bytes(), &written) != nil || written.Diverged != 3 || len(written.Divergences) != 3 {
+		t.Errorf("report object = %d %s", res.code, res.body.String())
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bleepstore/bleepstore/internal/s3op"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// capabilitiesVersion is bumped when the capabilities document changes
+// incompatibly.
+const capabilitiesVersion = 1
+
+// capabilities is the JSON document returned by GET /?bleepstore-capabilities.
+type capabilities struct {
+	Version       int    `json:"version"`
+	Region        string `json:"region"`
+	MaxObjectSize int64  `json:"max_object_size"`
+	// Features maps feature names to whether this instance supports them.
+	// Clients should treat a missing feature as unsupported.
+	Features map[string]bool `json:"features"`
+	// Operations lists the enabled operation names in route-table order.
+	Operations []s3op.Operation `json:"operations"`
+}
+
+// enabled reports whether op is routed and not disabled by configuration.
+func (s *Server) enabled(op s3op.Operation) bool {
+	_, ok := s.operations[op]
+	return ok && !s.disabledOps[op]
+}
+
+// capabilities reports the features enabled by the running configuration
+// and backends.
+func (s *Server) capabilities() capabilities {
+	_, rebalance := s.store.(storage.Rebalancer)
+	_, placement := s.store.(storage.PlacementReporter)
+	_, rebuild := s.store.(storage.Rebuilder)
+	_, dedup := s.store.(storage.GarbageCollector)
+	atRest := s.cfg.Storage.Backend == "local" && s.cfg.Storage.Local.Compression.Codec != ""
+	// Presigned URLs and delegation tokens are SigV4 authenticator features.
+	_, sigv4 := s.authn.(sigv4Authenticator)
+	c := capabilities{
+		Version:       capabilitiesVersion,
+		Region:        s.cfg.Server.Region,
+		MaxObjectSize: s.cfg.Server.MaxObjectSize,
+		Features: map[string]bool{
+			// Not implemented by BleepStore.
+			"versioning":    false,
+			"sse":           false,
+			"object_lock":   false,
+			"notifications": false,
+
+			"multipart":           s.enabled(s3op.CreateMultipartUpload) && s.enabled(s3op.CompleteMultipartUpload),
+			"acl":                 s.enabled(s3op.GetObjectAcl) || s.enabled(s3op.GetBucketAcl),
+			"acl_enforcement":     s.cfg.Auth.EnforceACLs && s.authn != nil,
+			"list_objects_v2":     s.enabled(s3op.ListObjectsV2),
+			"multi_delete":        s.enabled(s3op.DeleteObjects),
+			"head_batch":          s.enabled(s3op.HeadObjects),
+			"bulk_get":            s.enabled(s3op.BulkGetObjects),
+			"presigned_urls":      sigv4,
+			"virtual_hosts":       s.cfg.Server.VirtualHostDomain != "",
+			"website":             websiteEnabled(s.cfg.Server),
+			"custom_domains":      len(s.cfg.Server.CustomDomains) > 0,
+			"bucket_aliases":      len(s.cfg.Server.Aliases) > 0,
+			"prefix_quotas":       len(s.cfg.Server.PrefixQuotas) > 0,
+			"delegation_tokens":   sigv4 && s.cfg.Auth.Delegation.Secret != "",
+			"oidc":                sigv4 && s.cfg.Auth.OIDC.Issuer != "",
+			"usage_accounting":    s.usage != nil,
+			"compression":         s.cfg.Server.Compression.Enabled,
+			"defragmentation":     s.defrag != nil,
+			"prefetch_hints":      s.prefetch != nil,
+			"rebalance":           rebalance,
+			"zone_placement":      placement,
+			"rebuild":             rebuild,
+			"deduplication":       dedup,
+			"compression_at_rest": atRest,
+			"scrub":               s.scrub != nil,
+			"orphan_gc":           s.orphans != nil,
+			"bucket_replication":  s.bucketRepl != nil,
+			"inventory":           s.inventory != nil,
+			"erasure_requests":    s.erasure != nil,
+			"bucket_freeze":       s.freezes != nil,
+			"ha":                  s.ha != nil,
+		},
+	}
+	for _, rt := range s3op.Routes {
+		if s.enabled(rt.Operation) {
+			c.Operations = append(c.Operations, rt.Operation)
+		}
+	}
+	return c
+}
+
+// handleCapabilities serves GET /?bleepstore-capabilities so smart clients
+// and test harnesses can skip features this instance does not support.
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.capabilities())
+}
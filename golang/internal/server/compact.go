@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// compactor periodically reclaims dead space in the storage backend's
+// segment files.
+type compactor struct {
+	store    storage.Compactor
+	interval time.Duration
+	gate     *writeGate // closed while writes are quiesced for a backup
+	jobs     *jobRegistry
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop.
+func (c *compactor) start() {
+	c.wg.Add(1)
+	go c.loop()
+}
+
+// stop terminates the background loop, cancelling a running pass.
+func (c *compactor) stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+}
+
+// loop runs a compaction pass every interval.
+func (c *compactor) loop() {
+	defer c.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stopCh
+		cancel()
+	}()
+
+	tickC, stopTick := tick(c.interval)
+	defer stopTick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickC:
+			if !c.gate.enter() {
+				continue
+			}
+			start := time.Now()
+			jctx, j := c.jobs.begin(ctx, "compaction")
+			res, err := c.store.Compact(jctx)
+			j.finish(res, err)
+			c.gate.leave()
+			if err != nil {
+				if ctx.Err() == nil && !j.wasCancelled() {
+					slog.Error("Segment compaction error", "error", err)
+				}
+				continue
+			}
+			if res.Segments > 0 {
+				slog.Info("Segment compaction complete", "segments", res.Segments,
+					"objects_moved", res.ObjectsMoved, "bytes_reclaimed", res.BytesReclaimed,
+					"duration", time.Since(start))
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+)
+
+// compressibleTypes lists the response media types eligible for gzip.
+// Object bodies are excluded separately because they carry Content-Length.
+var compressibleTypes = map[string]bool{
+	"application/xml":  true,
+	"text/xml":         true,
+	"application/json": true,
+	"text/plain":       true,
+	"text/html":        true,
+}
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(io.Discard) },
+}
+
+// acceptsGzip reports whether the client's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		params = strings.TrimSpace(params)
+		if q, ok := strings.CutPrefix(params, "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressibleResponse reports whether a response with the given headers
+// and status may be compressed. Responses that declare their own length
+// (object data, ranges) or encoding are always passed through untouched.
+func compressibleResponse(h http.Header, status int) bool {
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Length") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return compressibleTypes[mediaType]
+}
+
+// gzipResponseWriter buffers an eligible response so it can decide, once
+// the handler finishes, whether the body is large enough to be worth
+// compressing. Bodies that outgrow the buffer are streamed uncompressed.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	maxSize int
+
+	status      int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+// WriteHeader decides whether the response is a compression candidate.
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	g.status = code
+	if !compressibleResponse(g.Header(), code) {
+		g.passthrough = true
+		g.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// Write buffers candidate bodies up to maxSize, then falls back to
+// streaming the response as-is.
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.passthrough {
+		return g.ResponseWriter.Write(b)
+	}
+	g.buf.Write(b)
+	if g.buf.Len() > g.maxSize {
+		if err := g.flushUncompressed(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// flushUncompressed writes the buffered body as-is and switches to
+// passthrough mode.
+func (g *gzipResponseWriter) flushUncompressed() error {
+	g.passthrough = true
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buf.Bytes())
+	g.buf.Reset()
+	return err
+}
+
+// Flush implements http.Flusher. A flush gives up on compression since the
+// client expects to see the bytes written so far.
+func (g *gzipResponseWriter) Flush() {
+	if g.wroteHeader && !g.passthrough {
+		g.flushUncompressed()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish writes out a buffered response, compressed if it is at least
+// minSize bytes.
+func (g *gzipResponseWriter) finish() {
+	if !g.wroteHeader || g.passthrough {
+		return
+	}
+	g.Header().Add("Vary", "Accept-Encoding")
+	if g.buf.Len() < g.minSize {
+		g.flushUncompressed()
+		return
+	}
+
+	g.Header().Set("Content-Encoding", "gzip")
+	g.ResponseWriter.WriteHeader(g.status)
+	gz := gzipWriterPool.Get().(*gzip.Writer)
+	gz.Reset(g.ResponseWriter)
+	gz.Write(g.buf.Bytes())
+	gz.Close()
+	gzipWriterPool.Put(gz)
+}
+
+// compressionMiddleware gzips small, compressible API responses (listings,
+// errors, ACLs) for clients that accept gzip.
+func compressionMiddleware(cfg config.CompressionConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipResponseWriter{
+				ResponseWriter: w,
+				minSize:        cfg.MinSizeBytes,
+				maxSize:        cfg.MaxSizeBytes,
+			}
+			defer gw.finish()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
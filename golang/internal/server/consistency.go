@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// Consistency levels reported by /admin/consistency, strongest first.
+const (
+	// consistencyStrong: reads and listings observe every completed write.
+	consistencyStrong = "strong"
+	// consistencyReadAfterWrite: reads observe completed writes, listings
+	// may lag.
+	consistencyReadAfterWrite = "read-after-write"
+	// consistencyEventual: reads and listings may both lag.
+	consistencyEventual = "eventual"
+)
+
+// consistencyProbePrefix is the key prefix of the objects written by a probe.
+const consistencyProbePrefix = ".bleepstore-consistency/"
+
+// consistencyReport is the JSON body returned by /admin/consistency. It
+// states the guarantees of the configured metadata engine and storage
+// backend; a POST adds what a probe observed.
+type consistencyReport struct {
+	Level          string `json:"level"`
+	ReadAfterWrite bool   `json:"read_after_write"`
+	ListAfterWrite bool   `json:"list_after_write"`
+	Metadata       string `json:"metadata"`
+	Storage        string `json:"storage"`
+	// Replica is true on a read-only replica, whose reads lag writes made
+	// on its primary however strong its local stores are.
+	Replica bool                    `json:"replica"`
+	Probe   *consistencyProbeResult `json:"probe,omitempty"`
+}
+
+// consistencyProbeResult records what each step of a probe observed.
+type consistencyProbeResult struct {
+	Bucket          string `json:"bucket"`
+	Key             string `json:"key"`
+	Level           string `json:"level"`
+	ReadAfterWrite  bool   `json:"read_after_write"`
+	ListAfterWrite  bool   `json:"list_after_write"`
+	ReadAfterDelete bool   `json:"read_after_delete"`
+	ListAfterDelete bool   `json:"list_after_delete"`
+}
+
+// consistencyLevel names the level for a pair of guarantees.
+func consistencyLevel(readAfterWrite, listAfterWrite bool) string {
+	switch {
+	case readAfterWrite && listAfterWrite:
+		return consistencyStrong
+	case readAfterWrite:
+		return consistencyReadAfterWrite
+	default:
+		return consistencyEventual
+	}
+}
+
+// consistency reports the guarantees of the running configuration. Storage
+// backends, including the gateways, read their own writes; the upstream
+// S3, GCS and Azure services are strongly consistent. Listings come from
+// the metadata store alone.
+func (s *Server) consistency() consistencyReport {
+	c := metadata.Consistency{ReadAfterWrite: true, ListAfterWrite: true}
+	if cr, ok := s.meta.(metadata.ConsistencyReporter); ok {
+		c = cr.Consistency()
+	}
+	report := consistencyReport{
+		ReadAfterWrite: c.ReadAfterWrite && !s.readOnly,
+		ListAfterWrite: c.ListAfterWrite && !s.readOnly,
+		Metadata:       s.cfg.Metadata.Engine,
+		Storage:        s.cfg.Storage.Backend,
+		Replica:        s.readOnly,
+	}
+	report.Level = consistencyLevel(report.ReadAfterWrite, report.ListAfterWrite)
+	return report
+}
+
+// handleConsistency serves GET /admin/consistency with the declared
+// guarantees, and POST /admin/consistency?bucket= with the result of a probe
+// that writes, reads, lists and deletes an object in the bucket. Test
+// harnesses compare the two to check that a deployment keeps its promises.
+func (s *Server) handleConsistency(w http.ResponseWriter, r *http.Request) {
+	report := s.consistency()
+	if r.Method == http.MethodPost {
+		bucket := r.URL.Query().Get("bucket")
+		if bucket == "" {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		if s.readOnly || s.meta == nil || s.store == nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+			return
+		}
+		probe, err := s.probeConsistency(r.Context(), bucket)
+		if err != nil {
+			slog.Error("Consistency probe error", "bucket", bucket, "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		if probe == nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+			return
+		}
+		report.Probe = probe
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// probeConsistency runs a probe against bucket through the S3 operation
+// handlers, as the requesting principal. It returns nil if the bucket does
+// not exist.
+func (s *Server) probeConsistency(ctx context.Context, bucket string) (*consistencyProbeResult, error) {
+	if b, err := s.meta.GetBucket(ctx, bucket); err != nil {
+		return nil, err
+	} else if b == nil {
+		return nil, nil
+	}
+
+	p := &consistencyProbeResult{Bucket: bucket, Key: consistencyProbePrefix + s.ids.NewID()}
+	body := []byte(p.Key)
+	objectPath := "/" + bucket + "/" + p.Key
+
+	put := s.probeRequest(ctx, http.MethodPut, objectPath, body)
+	if put.code != http.StatusOK {
+		return nil, fmt.Errorf("put %s: status %d: %s", p.Key, put.code, put.body.String())
+	}
+	get := s.probeRequest(ctx, http.MethodGet, objectPath, nil)
+	p.ReadAfterWrite = get.code == http.StatusOK && bytes.Equal(get.body.Bytes(), body)
+	listed, err := s.probeListed(ctx, bucket, p.Key)
+	if err != nil {
+		return nil, err
+	}
+	p.ListAfterWrite = listed
+
+	if del := s.probeRequest(ctx, http.MethodDelete, objectPath, nil); del.code != http.StatusNoContent {
+		return nil, fmt.Errorf("delete %s: status %d: %s", p.Key, del.code, del.body.String())
+	}
+	get = s.probeRequest(ctx, http.MethodGet, objectPath, nil)
+	p.ReadAfterDelete = get.code == http.StatusNotFound
+	if listed, err = s.probeListed(ctx, bucket, p.Key); err != nil {
+		return nil, err
+	}
+	p.ListAfterDelete = !listed
+
+	p.Level = consistencyLevel(p.ReadAfterWrite && p.ReadAfterDelete, p.ListAfterWrite && p.ListAfterDelete)
+	return p, nil
+}
+
+// probeListed reports whether ListObjectsV2 returns key.
+func (s *Server) probeListed(ctx context.Context, bucket, key string) (bool, error) {
+	res := s.probeRequest(ctx, http.MethodGet, "/"+bucket+"?list-type=2&prefix="+url.QueryEscape(key), nil)
+	if res.code != http.StatusOK {
+		return false, fmt.Errorf("list %s: status %d: %s", key, res.code, res.body.String())
+	}
+	var list xmlutil.ListBucketV2Result
+	if err := xml.Unmarshal(res.body.Bytes(), &list); err != nil {
+		return false, fmt.Errorf("parsing listing: %w", err)
+	}
+	for _, obj := range list.Contents {
+		if obj.Key == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// probeResponse buffers the response to an internal probe request.
+type probeResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (p *probeResponse) Header() http.Header { return p.header }
+
+func (p *probeResponse) WriteHeader(code int) {
+	if p.code == 0 {
+		p.code = code
+	}
+}
+
+func (p *probeResponse) Write(b []byte) (int, error) {
+	if p.code == 0 {
+		p.code = http.StatusOK
+	}
+	return p.body.Write(b)
+}
+
+// probeRequest dispatches a request to the S3 operation handlers. ctx
+// carries the authenticated principal of the admin request.
+func (s *Server) probeRequest(ctx context.Context, method, target string, body []byte) *probeResponse {
+	req, _ := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	res := &probeResponse{header: make(http.Header)}
+	s.dispatch(res, req)
+	if res.code == 0 {
+		res.code = http.StatusOK
+	}
+	return res
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// consistencyMetadata builds each metadata engine that runs without an
+// external service.
+var consistencyMetadata = map[string]func(t *testing.T, dir string) metadata.MetadataStore{
+	"sqlite": func(t *testing.T, dir string) metadata.MetadataStore {
+		m, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+		if err != nil {
+			t.Fatalf("NewSQLiteStore: %v", err)
+		}
+		return m
+	},
+	"bolt": func(t *testing.T, dir string) metadata.MetadataStore {
+		m, err := metadata.NewBoltStore(&config.BoltConfig{Path: filepath.Join(dir, "metadata.bolt")})
+		if err != nil {
+			t.Fatalf("NewBoltStore: %v", err)
+		}
+		return m
+	},
+	"memory": func(t *testing.T, dir string) metadata.MetadataStore {
+		return metadata.NewMemoryStore()
+	},
+	"local": func(t *testing.T, dir string) metadata.MetadataStore {
+		m, err := metadata.NewLocalStore(&config.LocalMetaConfig{RootDir: filepath.Join(dir, "meta")})
+		if err != nil {
+			t.Fatalf("NewLocalStore: %v", err)
+		}
+		return m
+	},
+}
+
+// consistencyStorage builds each storage backend. The AWS gateway forwards
+// to a second BleepStore instance standing in for S3.
+var consistencyStorage = map[string]func(t *testing.T, dir string) storage.StorageBackend{
+	"local": func(t *testing.T, dir string) storage.StorageBackend {
+		b, err := storage.NewLocalBackend(filepath.Join(dir, "objects"))
+		if err != nil {
+			t.Fatalf("NewLocalBackend: %v", err)
+		}
+		return b
+	},
+	"memory": func(t *testing.T, dir string) storage.StorageBackend {
+		b, err := storage.NewMemoryBackend(0, "none", "", 0, "")
+		if err != nil {
+			t.Fatalf("NewMemoryBackend: %v", err)
+		}
+		return b
+	},
+	"sqlite": func(t *testing.T, dir string) storage.StorageBackend {
+		b, err := storage.NewSQLiteBackend(filepath.Join(dir, "objects.db"))
+		if err != nil {
+			t.Fatalf("NewSQLiteBackend: %v", err)
+		}
+		return b
+	},
+	"jbod": func(t *testing.T, dir string) storage.StorageBackend {
+		b, err := storage.NewJBODBackend([]string{filepath.Join(dir, "d1"), filepath.Join(dir, "d2")}, storage.JBODOptions{})
+		if err != nil {
+			t.Fatalf("NewJBODBackend: %v", err)
+		}
+		return b
+	},
+	"aws": func(t *testing.T, dir string) storage.StorageBackend {
+		upstream := newIntegrationServer(t)
+		resp := upstream.doSigned(t, "PUT", "/upstream", nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("creating upstream bucket: status %d", resp.StatusCode)
+		}
+		b, err := storage.NewAWSGatewayBackend(context.Background(), "upstream", "us-east-1", "gw/",
+			upstream.endpoint, true, "bleepstore", "bleepstore-secret")
+		if err != nil {
+			t.Fatalf("NewAWSGatewayBackend: %v", err)
+		}
+		return b
+	},
+}
+
+// consistencyRequest sends a request with an optional body through the
+// router, as testRequest does.
+func consistencyRequest(srv *Server, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	commonHeaders(srv.clock, srv.ids)(asRoot(srv)).ServeHTTP(rec, req)
+	return rec
+}
+
+// TestConsistencyMatrix checks read-after-write and list-after-write for
+// every local metadata engine and storage backend pairing, and that the
+// probe confirms the guarantees /admin/consistency declares.
+func TestConsistencyMatrix(t *testing.T) {
+	for metaName, newMeta := range consistencyMetadata {
+		for storeName, newStore := range consistencyStorage {
+			t.Run(metaName+"/"+storeName, func(t *testing.T) {
+				dir := t.TempDir()
+				meta := newMeta(t, dir)
+				t.Cleanup(func() { meta.Close() })
+				cfg := &config.Config{
+					Server:   config.ServerConfig{Region: "us-east-1"},
+					Auth:     config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+					Metadata: config.MetadataConfig{Engine: metaName},
+					Storage:  config.StorageConfig{Backend: storeName},
+				}
+				srv, err := New(cfg, WithMetadataStore(meta), WithStorageBackend(newStore(t, dir)))
+				if err != nil {
+					t.Fatalf("New() failed: %v", err)
+				}
+				checkConsistency(t, srv)
+			})
+		}
+	}
+}
+
+func checkConsistency(t *testing.T, srv *Server) {
+	t.Helper()
+	if rec := consistencyRequest(srv, "PUT", "/consistent", ""); rec.Code != http.StatusOK {
+		t.Fatalf("create bucket: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	listed := func(key string) bool {
+		rec := consistencyRequest(srv, "GET", "/consistent?list-type=2&prefix="+key, "")
+		return strings.Contains(rec.Body.String(), "<Key>"+key+"</Key>")
+	}
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("k%d", i)
+		for _, body := range []string{"first " + key, "second " + key} {
+			if rec := consistencyRequest(srv, "PUT", "/consistent/"+key, body); rec.Code != http.StatusOK {
+				t.Fatalf("put %s: status %d", key, rec.Code)
+			}
+			if rec := consistencyRequest(srv, "GET", "/consistent/"+key, ""); rec.Body.String() != body {
+				t.Errorf("read after write of %s = %q, want %q", key, rec.Body.String(), body)
+			}
+			if !listed(key) {
+				t.Errorf("list after write: %s not listed", key)
+			}
+		}
+		consistencyRequest(srv, "DELETE", "/consistent/"+key, "")
+		if rec := consistencyRequest(srv, "GET", "/consistent/"+key, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("read after delete of %s: status %d, want 404", key, rec.Code)
+		}
+		if listed(key) {
+			t.Errorf("list after delete: %s still listed", key)
+		}
+	}
+
+	var declared consistencyReport
+	rec := consistencyRequest(srv, "GET", "/admin/consistency", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &declared); err != nil {
+		t.Fatalf("decoding declared consistency: %v", err)
+	}
+	if declared.Level != consistencyStrong {
+		t.Errorf("declared level = %q, want strong", declared.Level)
+	}
+
+	var probed consistencyReport
+	rec = consistencyRequest(srv, "POST", "/admin/consistency?bucket=consistent", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &probed); err != nil || probed.Probe == nil {
+		t.Fatalf("probe: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if probed.Probe.Level != declared.Level {
+		t.Errorf("probe observed %+v, declared %q", probed.Probe, declared.Level)
+	}
+	if listed(consistencyProbePrefix) {
+		t.Error("probe object left behind")
+	}
+}
+
+// laggingStore is a metadata store that declares lagging listings.
+type laggingStore struct {
+	*metadata.MemoryStore
+}
+
+func (laggingStore) Consistency() metadata.Consistency {
+	return metadata.Consistency{ReadAfterWrite: true}
+}
+
+func TestConsistencyDeclared(t *testing.T) {
+	cfg := &config.Config{
+		Auth:     config.AuthConfig{AccessKey: "bleepstore"},
+		Metadata: config.MetadataConfig{Engine: "memory"},
+	}
+	srv, err := New(cfg, WithMetadataStore(laggingStore{metadata.NewMemoryStore()}))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if got := srv.consistency(); got.Level != consistencyReadAfterWrite || !got.ReadAfterWrite || got.ListAfterWrite {
+		t.Errorf("lagging listings: %+v, want read-after-write", got)
+	}
+
+	srv.readOnly = true
+	if got := srv.consistency(); got.Level != consistencyEventual || !got.Replica {
+		t.Errorf("replica: %+v, want eventual", got)
+	}
+
+	if rec := consistencyRequest(srv, "POST", "/admin/consistency", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("probe without bucket: status %d, want 400", rec.Code)
+	}
+	if c := (&metadata.DynamoDBStore{}).Consistency(); c.ReadAfterWrite || c.ListAfterWrite {
+		t.Errorf("DynamoDB declares %+v, want eventual reads and listings", c)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// defragBatchSize is the number of queued objects examined per idle window.
+const defragBatchSize = 16
+
+// activityTracker records in-flight requests and the time of the last
+// request so background work can run only while the server is idle.
+type activityTracker struct {
+	inFlight atomic.Int64
+	lastSeen atomic.Int64 // UnixNano of the most recent request start or end
+}
+
+// middleware counts requests passing through next.
+func (a *activityTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.inFlight.Add(1)
+		a.lastSeen.Store(time.Now().UnixNano())
+		defer func() {
+			a.lastSeen.Store(time.Now().UnixNano())
+			a.inFlight.Add(-1)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// idleFor reports whether no request has been in flight for at least d.
+func (a *activityTracker) idleFor(d time.Duration) bool {
+	if a.inFlight.Load() > 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, a.lastSeen.Load())) >= d
+}
+
+// defragmenter drains the metadata defrag queue during idle periods,
+// rewriting part-chained objects into contiguous blobs.
+type defragmenter struct {
+	queue    metadata.DefragQueue
+	meta     metadata.MetadataStore
+	store    storage.Defragmenter
+	activity *activityTracker
+	idle     time.Duration
+	interval time.Duration
+	gate     *writeGate // closed while writes are quiesced for a backup
+	jobs     *jobRegistry
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop.
+func (d *defragmenter) start() {
+	d.wg.Add(1)
+	go d.loop()
+}
+
+// stop terminates the background loop, waiting for the current object.
+func (d *defragmenter) stop() {
+	close(d.stopCh)
+	d.wg.Wait()
+}
+
+// loop periodically runs a batch while the server is idle.
+func (d *defragmenter) loop() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			if d.activity.idleFor(d.idle) && d.gate.enter() {
+				d.runBatch(context.Background())
+				d.gate.leave()
+			}
+		}
+	}
+}
+
+// defragResult is the result of a defragmentation batch job.
+type defragResult struct {
+	Rewritten int `json:"rewritten"`
+}
+
+// runBatch processes up to defragBatchSize queued objects, stopping early as
+// soon as the server becomes busy again. Returns the number rewritten.
+func (d *defragmenter) runBatch(ctx context.Context) (rewritten int) {
+	tasks, err := d.queue.ListDefrag(ctx, defragBatchSize)
+	if err != nil {
+		slog.Error("Defrag queue error", "error", err)
+		return 0
+	}
+	if len(tasks) == 0 {
+		return 0
+	}
+	ctx, j := d.jobs.begin(ctx, "defrag")
+	defer func() { j.finish(&defragResult{Rewritten: rewritten}, ctx.Err()) }()
+
+	for i, task := range tasks {
+		select {
+		case <-d.stopCh:
+			return rewritten
+		case <-ctx.Done():
+			return rewritten
+		default:
+		}
+		if !d.activity.idleFor(d.idle) {
+			return rewritten
+		}
+		progress.Report(ctx, int64(i), int64(len(tasks)))
+
+		// Skip objects that were deleted or overwritten since they were queued.
+		obj, err := d.meta.GetObject(ctx, task.Bucket, task.Key)
+		if err != nil {
+			slog.Error("Defrag GetObject error", "bucket", task.Bucket, "key", task.Key, "error", err)
+			continue
+		}
+		if obj != nil && obj.ETag == task.ETag {
+			done, err := d.store.DefragmentObject(ctx, task.Bucket, task.Key)
+			if err != nil {
+				// Leave the task queued; it is retried in a later idle window.
+				slog.Error("Defrag error", "bucket", task.Bucket, "key", task.Key, "error", err)
+				continue
+			}
+			if done {
+				rewritten++
+				slog.Debug("Defragmented object", "bucket", task.Bucket, "key", task.Key)
+			}
+		}
+
+		if err := d.queue.RemoveDefrag(ctx, task); err != nil {
+			slog.Error("Defrag dequeue error", "error", err)
+		}
+	}
+	return rewritten
+}
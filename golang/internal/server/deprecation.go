@@ -0,0 +1,116 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bleepstore/bleepstore/internal/metrics"
+)
+
+// warningHeader carries deprecation and compatibility warnings. Each warning
+// is a separate header value of the form "<code>: <message>".
+const warningHeader = "x-bleepstore-warning"
+
+// deprecation is a client behavior slated to change.
+type deprecation struct {
+	code    string
+	message string
+}
+
+var (
+	warnSigV2 = deprecation{"sigv2",
+		"AWS Signature Version 2 is not supported; sign requests with Signature Version 4"}
+	warnUnsignedPayload = deprecation{"unsigned-payload",
+		"UNSIGNED-PAYLOAD over plain HTTP is deprecated; send the payload SHA-256 or use HTTPS"}
+	warnMissingContentSHA256 = deprecation{"missing-content-sha256",
+		"requests without x-amz-content-sha256 are buffered in memory to be hashed; send the header"}
+)
+
+// deprecationsFor returns the deprecated behaviors r relies on. It reads the
+// request as the client sent it, so it must run before authentication
+// (which fills in a missing x-amz-content-sha256).
+func deprecationsFor(r *http.Request) []deprecation {
+	authz := r.Header.Get("Authorization")
+	q := r.URL.Query()
+	if strings.HasPrefix(authz, "AWS ") || (q.Has("AWSAccessKeyId") && q.Has("Signature")) {
+		return []deprecation{warnSigV2}
+	}
+	if !strings.HasPrefix(authz, "AWS4-HMAC-SHA256") {
+		return nil
+	}
+	switch r.Header.Get("X-Amz-Content-Sha256") {
+	case "":
+		return []deprecation{warnMissingContentSHA256}
+	case "UNSIGNED-PAYLOAD":
+		if r.TLS == nil {
+			return []deprecation{warnUnsignedPayload}
+		}
+	}
+	return nil
+}
+
+// maxWarnedClients bounds the set of (warning, access key) pairs that have
+// been logged, so unauthenticated requests with random keys cannot grow it
+// without limit.
+const maxWarnedClients = 10000
+
+// warnedClients records which clients have been logged for each warning, so
+// every affected client is logged once rather than on every request.
+type warnedClients struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// first reports whether this is the first time key has been seen.
+func (w *warnedClients) first(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seen[key] || len(w.seen) >= maxWarnedClients {
+		return false
+	}
+	if w.seen == nil {
+		w.seen = make(map[string]bool)
+	}
+	w.seen[key] = true
+	return true
+}
+
+// deprecationMiddleware adds an x-bleepstore-warning header and counts
+// bleepstore_deprecation_warnings_total for each deprecated behavior a
+// request uses, and logs each affected access key once.
+func deprecationMiddleware(next http.Handler) http.Handler {
+	warned := &warnedClients{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, d := range deprecationsFor(r) {
+			w.Header().Add(warningHeader, d.code+": "+d.message)
+			metrics.DeprecationWarningsTotal.WithLabelValues(d.code).Inc()
+			accessKey := requestAccessKey(r)
+			if warned.first(d.code + "\x00" + accessKey) {
+				slog.Warn("Client uses deprecated behavior", "warning", d.code, "access_key", accessKey,
+					"user_agent", r.UserAgent(), "remote_addr", r.RemoteAddr)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestAccessKey extracts the access key a request claims, from a SigV4
+// credential scope or a SigV2 "AWS key:signature" header, without verifying
+// it.
+func requestAccessKey(r *http.Request) string {
+	authz := r.Header.Get("Authorization")
+	if rest, ok := strings.CutPrefix(authz, "AWS "); ok {
+		key, _, _ := strings.Cut(rest, ":")
+		return key
+	}
+	if _, cred, ok := strings.Cut(authz, "Credential="); ok {
+		key, _, _ := strings.Cut(cred, "/")
+		return key
+	}
+	if key := r.URL.Query().Get("AWSAccessKeyId"); key != "" {
+		return key
+	}
+	return ""
+}
@@ -0,0 +1,587 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/replication"
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+const (
+	// maxErasureSpecSize caps the body of POST /admin/erasure-requests.
+	maxErasureSpecSize = 4 << 20
+
+	// maxErasureKeys caps the keys one erasure request may name.
+	maxErasureKeys = 10000
+
+	// erasurePageSize is the number of keys or uploads listed per metadata
+	// page while resolving a predicate.
+	erasurePageSize = 1000
+
+	// erasureSignatureAlgorithm names how erasure reports are signed.
+	erasureSignatureAlgorithm = "HMAC-SHA256"
+)
+
+// Erasure request states.
+const (
+	erasurePending    = "pending"
+	erasureCompleted  = "completed"
+	erasureIncomplete = "incomplete"
+)
+
+// errNoSuchErasureRequest is returned for an unknown erasure request ID.
+var errNoSuchErasureRequest = &s3err.S3Error{
+	Code:       "NoSuchErasureRequest",
+	Message:    "The specified erasure request does not exist",
+	HTTPStatus: http.StatusNotFound,
+}
+
+// erasureSpec names the objects of one bucket an erasure request erases:
+// the listed keys, or every object under Prefix whose user metadata has
+// all the Metadata values.
+type erasureSpec struct {
+	// Reference is the requester's own identifier for the request, such as
+	// a ticket number, carried into the report.
+	Reference string            `json:"reference,omitempty"`
+	Bucket    string            `json:"bucket"`
+	Keys      []string          `json:"keys,omitempty"`
+	Prefix    string            `json:"prefix,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// validate checks the spec and normalizes metadata names to the lower-case
+// form without x-amz-meta- they are stored in.
+func (sp *erasureSpec) validate() error {
+	if sp.Bucket == "" {
+		return errors.New("bucket is required")
+	}
+	predicate := sp.Prefix != "" || len(sp.Metadata) > 0
+	switch {
+	case len(sp.Keys) > 0 && predicate:
+		return errors.New("keys cannot be combined with prefix or metadata")
+	case len(sp.Keys) == 0 && !predicate:
+		return errors.New("keys, prefix or metadata is required")
+	case len(sp.Keys) > maxErasureKeys:
+		return fmt.Errorf("at most %d keys may be listed", maxErasureKeys)
+	}
+	for _, k := range sp.Keys {
+		if k == "" {
+			return errors.New("keys must not be empty")
+		}
+	}
+	meta := make(map[string]string, len(sp.Metadata))
+	for name, v := range sp.Metadata {
+		name = strings.TrimPrefix(strings.ToLower(name), "x-amz-meta-")
+		if name == "" {
+			return errors.New("metadata names must not be empty")
+		}
+		meta[name] = v
+	}
+	if len(meta) > 0 {
+		sp.Metadata = meta
+	}
+	return nil
+}
+
+// matches reports whether user metadata has every value the spec asks for.
+func (sp *erasureSpec) matches(userMeta map[string]string) bool {
+	for name, v := range sp.Metadata {
+		if got, ok := userMeta[name]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// erasedObject is the outcome for one object of an erasure request.
+type erasedObject struct {
+	Key          string `json:"key"`
+	ETag         string `json:"etag,omitempty"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified,omitempty"`
+	// Found is whether the object had metadata when the request ran; data
+	// stored for a key without metadata is deleted too.
+	Found bool `json:"found"`
+	// ReplicaBucket is the bucket replication destination the remote copy
+	// was deleted from, if a replication rule applies to the key.
+	ReplicaBucket string `json:"replica_bucket,omitempty"`
+	// Verified is whether the object's metadata, stored data and remote
+	// copy were all confirmed gone afterwards.
+	Verified bool   `json:"verified"`
+	Error    string `json:"error,omitempty"`
+}
+
+// erasedUpload is the outcome for one in-progress multipart upload of a
+// matching key.
+type erasedUpload struct {
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id"`
+	Aborted  bool   `json:"aborted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// erasureReport records the execution of an erasure request.
+type erasureReport struct {
+	RequestID  string         `json:"request_id"`
+	Reference  string         `json:"reference,omitempty"`
+	Bucket     string         `json:"bucket"`
+	StartedAt  string         `json:"started_at"`
+	FinishedAt string         `json:"finished_at"`
+	Objects    []erasedObject `json:"objects"`
+	Uploads    []erasedUpload `json:"uploads"`
+	// Verified is whether every object was confirmed gone and every upload
+	// aborted.
+	Verified bool `json:"verified"`
+}
+
+// signedErasureReport is a report with its signature: the HMAC of the
+// exact bytes of the Report value under the configured signing key.
+type signedErasureReport struct {
+	Report             json.RawMessage `json:"report"`
+	SignatureAlgorithm string          `json:"signature_algorithm"`
+	Signature          string          `json:"signature"`
+}
+
+// erasureRequestView is the JSON form of an erasure request.
+type erasureRequestView struct {
+	ID        string          `json:"id"`
+	State     string          `json:"state"`
+	CreatedAt string          `json:"created_at"`
+	Spec      json.RawMessage `json:"spec"`
+	Report    json.RawMessage `json:"report,omitempty"`
+}
+
+func viewErasureRequest(req *metadata.ErasureRequest) erasureRequestView {
+	v := erasureRequestView{ID: req.ID, State: req.State, CreatedAt: xmlutil.FormatTimeS3(req.CreatedAt), Spec: req.Spec}
+	if req.Report != nil {
+		v.Report = req.Report
+	}
+	return v
+}
+
+// eraser executes erasure requests: it deletes the matching objects
+// through the S3 operation handlers, deletes their bucket replication
+// copies, aborts their multipart uploads, has the storage backend purge
+// data it keeps after deletes, verifies that nothing is left, and stores
+// a signed report.
+type eraser struct {
+	meta     metadata.MetadataStore
+	requests metadata.ErasureRequestStore
+	store    storage.StorageBackend
+	repl     *bucketReplicator          // nil without bucket replication
+	freezes  metadata.BucketFreezeStore // nil if the engine records no freezes
+	dispatch func(ctx context.Context, method, target string, body []byte) *probeResponse
+	clock    clock.Clock
+	ids      clock.IDGenerator
+	key      []byte
+
+	mu sync.Mutex // one execution at a time
+}
+
+// sign returns report signed with the eraser's key.
+func (e *eraser) sign(report *erasureReport) (*signedErasureReport, error) {
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, e.key)
+	mac.Write(raw)
+	return &signedErasureReport{
+		Report:             raw,
+		SignatureAlgorithm: erasureSignatureAlgorithm,
+		Signature:          hex.EncodeToString(mac.Sum(nil)),
+	}, nil
+}
+
+// resolve returns the objects and in-progress uploads req's spec selects.
+func (e *eraser) resolve(ctx context.Context, sp *erasureSpec) ([]erasedObject, []erasedUpload, error) {
+	var objects []erasedObject
+	found := func(obj *metadata.ObjectRecord) erasedObject {
+		return erasedObject{Key: obj.Key, ETag: strings.Trim(obj.ETag, `"`), Size: obj.Size,
+			LastModified: xmlutil.FormatTimeS3(obj.LastModified), Found: true}
+	}
+	if len(sp.Keys) > 0 {
+		seen := map[string]bool{}
+		for _, key := range sp.Keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			obj, err := e.meta.GetObject(ctx, sp.Bucket, key)
+			if err != nil {
+				return nil, nil, fmt.Errorf("getting %s/%s: %w", sp.Bucket, key, err)
+			}
+			if obj == nil || obj.DeleteMarker {
+				objects = append(objects, erasedObject{Key: key})
+				continue
+			}
+			objects = append(objects, found(obj))
+		}
+	} else {
+		opts := metadata.ListObjectsOptions{Prefix: sp.Prefix, MaxKeys: erasurePageSize}
+		for {
+			page, err := e.meta.ListObjects(ctx, sp.Bucket, opts)
+			if err != nil {
+				return nil, nil, fmt.Errorf("listing %s: %w", sp.Bucket, err)
+			}
+			for i := range page.Objects {
+				obj := &page.Objects[i]
+				if !obj.DeleteMarker && sp.matches(obj.UserMetadata) {
+					objects = append(objects, found(obj))
+				}
+			}
+			if !page.IsTruncated || len(page.Objects) == 0 {
+				break
+			}
+			opts.StartAfter = page.Objects[len(page.Objects)-1].Key
+		}
+	}
+
+	keys := map[string]bool{}
+	for _, k := range sp.Keys {
+		keys[k] = true
+	}
+	var uploads []erasedUpload
+	opts := metadata.ListUploadsOptions{Prefix: sp.Prefix, MaxUploads: erasurePageSize}
+	for {
+		page, err := e.meta.ListMultipartUploads(ctx, sp.Bucket, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("listing uploads of %s: %w", sp.Bucket, err)
+		}
+		for _, u := range page.Uploads {
+			if len(sp.Keys) > 0 && keys[u.Key] || len(sp.Keys) == 0 && sp.matches(u.UserMetadata) {
+				uploads = append(uploads, erasedUpload{Key: u.Key, UploadID: u.UploadID})
+			}
+		}
+		if !page.IsTruncated {
+			break
+		}
+		opts.KeyMarker, opts.UploadIDMarker = page.NextKeyMarker, page.NextUploadIDMarker
+	}
+	return objects, uploads, nil
+}
+
+// execute erases the objects req selects and returns the signed report,
+// after storing it with req's new state.
+func (e *eraser) execute(ctx context.Context, req *metadata.ErasureRequest) (*signedErasureReport, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var sp erasureSpec
+	if err := json.Unmarshal(req.Spec, &sp); err != nil {
+		return nil, fmt.Errorf("decoding erasure request %s: %w", req.ID, err)
+	}
+	// A frozen bucket keeps its objects until it is unfrozen.
+	if frozen, err := bucketFrozen(ctx, e.freezes, sp.Bucket); err != nil {
+		return nil, fmt.Errorf("checking freeze of %s: %w", sp.Bucket, err)
+	} else if frozen {
+		return nil, fmt.Errorf("bucket %s is frozen", sp.Bucket)
+	}
+	report := &erasureReport{RequestID: req.ID, Reference: sp.Reference, Bucket: sp.Bucket,
+		StartedAt: xmlutil.FormatTimeS3(e.clock.Now())}
+	objects, uploads, err := e.resolve(ctx, &sp)
+	if err != nil {
+		return nil, err
+	}
+	report.Objects, report.Uploads = objects, uploads
+	if report.Objects == nil {
+		report.Objects = []erasedObject{}
+	}
+	if report.Uploads == nil {
+		report.Uploads = []erasedUpload{}
+	}
+
+	for i := range report.Uploads {
+		u := &report.Uploads[i]
+		target := (&url.URL{Path: "/" + sp.Bucket + "/" + u.Key, RawQuery: "uploadId=" + url.QueryEscape(u.UploadID)}).String()
+		res := e.dispatch(ctx, http.MethodDelete, target, nil)
+		if res.code == http.StatusNoContent || res.code == http.StatusNotFound {
+			u.Aborted = true
+		} else {
+			u.Error = fmt.Sprintf("aborting upload: status %d", res.code)
+		}
+	}
+
+	// Delete everything first, then purge and verify, so backends that
+	// reclaim deleted data in bulk do so once.
+	for i := range report.Objects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress.Report(ctx, int64(i), int64(len(report.Objects)))
+		obj := &report.Objects[i]
+		if err := e.erase(ctx, sp.Bucket, obj); err != nil {
+			obj.Error = err.Error()
+		}
+	}
+	purger, _ := e.store.(storage.Purger)
+	report.Verified = true
+	for i := range report.Objects {
+		obj := &report.Objects[i]
+		if obj.Error == "" && purger != nil {
+			if err := purger.PurgeObject(ctx, sp.Bucket, obj.Key); err != nil {
+				obj.Error = fmt.Sprintf("purging data: %v", err)
+			}
+		}
+		if obj.Error == "" {
+			if err := e.check(ctx, sp.Bucket, obj); err != nil {
+				obj.Error = err.Error()
+			} else {
+				obj.Verified = true
+			}
+		}
+		if obj.Verified {
+			metrics.ErasureObjectsTotal.WithLabelValues("erased").Inc()
+		} else {
+			metrics.ErasureObjectsTotal.WithLabelValues("failed").Inc()
+			slog.Error("Erasure failed", "request_id", req.ID, "bucket", sp.Bucket, "key", obj.Key, "error", obj.Error)
+			report.Verified = false
+		}
+	}
+	for _, u := range report.Uploads {
+		if !u.Aborted {
+			report.Verified = false
+		}
+	}
+	report.FinishedAt = xmlutil.FormatTimeS3(e.clock.Now())
+
+	signed, err := e.sign(report)
+	if err != nil {
+		return nil, err
+	}
+	req.Report, err = json.Marshal(signed)
+	if err != nil {
+		return nil, err
+	}
+	req.State = erasureCompleted
+	if !report.Verified {
+		req.State = erasureIncomplete
+	}
+	if err := e.requests.PutErasureRequest(context.WithoutCancel(ctx), req); err != nil {
+		return nil, err
+	}
+	slog.Info("Erasure request executed", "request_id", req.ID, "state", req.State, "objects", len(report.Objects))
+	return signed, nil
+}
+
+// erase deletes one object and its remote copy.
+func (e *eraser) erase(ctx context.Context, bucket string, obj *erasedObject) error {
+	if obj.Found {
+		target := (&url.URL{Path: "/" + bucket + "/" + obj.Key}).String()
+		if res := e.dispatch(ctx, http.MethodDelete, target, nil); res.code != http.StatusNoContent {
+			return fmt.Errorf("deleting object: status %d: %s", res.code, res.body.String())
+		}
+	}
+	// Data may outlive its metadata after a failed write.
+	if err := e.store.DeleteObject(ctx, bucket, obj.Key); err != nil {
+		return fmt.Errorf("deleting stored data: %w", err)
+	}
+	if e.repl == nil {
+		return nil
+	}
+	// The copy is deleted whether or not the rule replicates deletes.
+	if rule := e.repl.rules.Match(bucket, obj.Key); rule != nil {
+		obj.ReplicaBucket = replication.DestinationBucket(rule)
+		if err := e.repl.target.DeleteObject(ctx, obj.ReplicaBucket, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check verifies that nothing of an erased object is left.
+func (e *eraser) check(ctx context.Context, bucket string, obj *erasedObject) error {
+	rec, err := e.meta.GetObject(ctx, bucket, obj.Key)
+	if err != nil {
+		return fmt.Errorf("verifying metadata: %w", err)
+	}
+	if rec != nil {
+		return errors.New("object metadata still present; it may have been written again")
+	}
+	if exists, err := e.store.ObjectExists(ctx, bucket, obj.Key); err != nil {
+		return fmt.Errorf("verifying stored data: %w", err)
+	} else if exists {
+		return errors.New("stored data still present")
+	}
+	if obj.ReplicaBucket != "" {
+		if exists, err := e.repl.target.ObjectExists(ctx, obj.ReplicaBucket, obj.Key); err != nil {
+			return fmt.Errorf("verifying replica: %w", err)
+		} else if exists {
+			return errors.New("replica still present")
+		}
+	}
+	return nil
+}
+
+// erasureAdmin checks that an erasure request endpoint is enabled, writing
+// the error response if not.
+func (s *Server) erasureAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.erasure == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return false
+	}
+	return true
+}
+
+// handleCreateErasureRequest registers an erasure request from the JSON
+// spec in the body. Nothing is erased until it is executed.
+func (s *Server) handleCreateErasureRequest(w http.ResponseWriter, r *http.Request) {
+	if !s.erasureAdmin(w, r) {
+		return
+	}
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxErasureSpecSize+1))
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrIncompleteBody)
+		return
+	}
+	if len(raw) > maxErasureSpecSize {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrEntityTooLarge)
+		return
+	}
+	var sp erasureSpec
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&sp); err == nil {
+		err = sp.validate()
+	}
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "InvalidArgument",
+			Message:    "Invalid erasure request: " + err.Error(),
+			HTTPStatus: http.StatusBadRequest,
+		})
+		return
+	}
+	bucket, err := s.meta.GetBucket(r.Context(), sp.Bucket)
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	if bucket == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return
+	}
+
+	spec, _ := json.Marshal(&sp)
+	req := &metadata.ErasureRequest{ID: s.ids.NewID(), CreatedAt: s.clock.Now().UTC(), State: erasurePending, Spec: spec}
+	if err := s.erasure.requests.PutErasureRequest(r.Context(), req); err != nil {
+		slog.Error("Erasure request error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	slog.Info("Erasure request registered", "request_id", req.ID, "bucket", sp.Bucket, "reference", sp.Reference)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(viewErasureRequest(req))
+}
+
+// handleListErasureRequests lists the registered erasure requests, oldest
+// first, without their reports.
+func (s *Server) handleListErasureRequests(w http.ResponseWriter, r *http.Request) {
+	if !s.erasureAdmin(w, r) {
+		return
+	}
+	reqs, err := s.erasure.requests.ListErasureRequests(r.Context())
+	if err != nil {
+		slog.Error("Erasure request error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	views := []erasureRequestView{}
+	for i := range reqs {
+		views = append(views, viewErasureRequest(&reqs[i]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"requests": views})
+}
+
+// erasureRequest loads the request named in the URL, writing the error
+// response if there is none.
+func (s *Server) erasureRequest(w http.ResponseWriter, r *http.Request) *metadata.ErasureRequest {
+	req, err := s.erasure.requests.GetErasureRequest(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		slog.Error("Erasure request error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return nil
+	}
+	if req == nil {
+		xmlutil.WriteErrorResponse(w, r, errNoSuchErasureRequest)
+	}
+	return req
+}
+
+// handleGetErasureRequest returns an erasure request with the signed report
+// of its last execution.
+func (s *Server) handleGetErasureRequest(w http.ResponseWriter, r *http.Request) {
+	if !s.erasureAdmin(w, r) {
+		return
+	}
+	req := s.erasureRequest(w, r)
+	if req == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(viewErasureRequest(req))
+}
+
+// handleExecuteErasureRequest erases the objects an erasure request selects
+// and returns the signed report. A request whose execution was incomplete
+// may be executed again; the objects selected are resolved anew each time.
+func (s *Server) handleExecuteErasureRequest(w http.ResponseWriter, r *http.Request) {
+	if !s.erasureAdmin(w, r) {
+		return
+	}
+	if s.readOnly {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+		return
+	}
+	req := s.erasureRequest(w, r)
+	if req == nil {
+		return
+	}
+	if req.State == erasureCompleted {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "OperationAborted",
+			Message:    "The erasure request has already been completed",
+			HTTPStatus: http.StatusConflict,
+		})
+		return
+	}
+	var sp erasureSpec
+	if err := json.Unmarshal(req.Spec, &sp); err == nil {
+		frozen, err := bucketFrozen(r.Context(), s.freezes, sp.Bucket)
+		if err != nil {
+			slog.Error("Bucket freeze lookup error", "bucket", sp.Bucket, "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		if frozen {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrBucketFrozen)
+			return
+		}
+	}
+	s.runJob(w, r, "erasure", func(ctx context.Context) (any, error) {
+		return s.erasure.execute(ctx, req)
+	})
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// newErasureServer returns a server with erasure requests enabled.
+func newErasureServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("creating metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	store, err := storage.NewLocalBackend(filepath.Join(dir, "objects"))
+	if err != nil {
+		t.Fatalf("creating storage backend: %v", err)
+	}
+	cfg := &config.Config{
+		Server:          config.ServerConfig{Region: "us-east-1"},
+		Auth:            config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+		ErasureRequests: config.ErasureRequestsConfig{Enabled: true, SigningKey: "report-key"},
+	}
+	cfg.Metadata.Engine = "sqlite"
+	srv, err := New(cfg, meta, WithStorageBackend(store))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return srv
+}
+
+// serveErasure sends an admin request to srv without authentication.
+func serveErasure(srv *Server, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	asRoot(srv).ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestErasureRequest(t *testing.T) {
+	ctx := context.Background()
+	srv := newErasureServer(t)
+	srv.probeRequest(ctx, "PUT", "/users", nil)
+	for _, key := range []string{"u1/a", "u1/b", "u2/a"} {
+		if res := srv.probeRequest(ctx, "PUT", "/users/"+key, []byte("personal data")); res.code != 200 {
+			t.Fatalf("putting %s: %d %s", key, res.code, res.body.String())
+		}
+	}
+	if res := srv.probeRequest(ctx, "POST", "/users/u1/c?uploads", nil); res.code != 200 {
+		t.Fatalf("CreateMultipartUpload = %d %s", res.code, res.body.String())
+	}
+
+	for _, body := range []string{`{}`, `{"bucket":"users"}`, `{"bucket":"users","keys":["a"],"prefix":"u1/"}`, `{"bucket":"users","color":"red"}`} {
+		if w := serveErasure(srv, "POST", "/admin/erasure-requests", body); w.Code != http.StatusBadRequest {
+			t.Errorf("registering %s = %d, want 400", body, w.Code)
+		}
+	}
+	if w := serveErasure(srv, "POST", "/admin/erasure-requests", `{"bucket":"missing","prefix":"u1/"}`); w.Code != http.StatusNotFound {
+		t.Errorf("registering for a missing bucket = %d, want 404", w.Code)
+	}
+
+	w := serveErasure(srv, "POST", "/admin/erasure-requests", `{"reference":"DSR-1","bucket":"users","prefix":"u1/"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("registering = %d %s", w.Code, w.Body.String())
+	}
+	var req erasureRequestView
+	json.Unmarshal(w.Body.Bytes(), &req)
+	if req.State != erasurePending {
+		t.Fatalf("registered request = %+v", req)
+	}
+	if res := srv.probeRequest(ctx, "GET", "/users/u1/a", nil); res.code != 200 {
+		t.Fatalf("object erased before execution: %d", res.code)
+	}
+
+	w = serveErasure(srv, "POST", "/admin/erasure-requests/"+req.ID+"/execute", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("executing = %d %s", w.Code, w.Body.String())
+	}
+	var signed signedErasureReport
+	if err := json.Unmarshal(w.Body.Bytes(), &signed); err != nil {
+		t.Fatalf("decoding signed report: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte("report-key"))
+	mac.Write(signed.Report)
+	if signed.SignatureAlgorithm != "HMAC-SHA256" || signed.Signature != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("report signature %s %s does not verify", signed.SignatureAlgorithm, signed.Signature)
+	}
+	var report erasureReport
+	json.Unmarshal(signed.Report, &report)
+	if !report.Verified || report.Reference != "DSR-1" || len(report.Objects) != 2 || len(report.Uploads) != 1 || !report.Uploads[0].Aborted {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, obj := range report.Objects {
+		if !obj.Found || !obj.Verified || obj.ETag == "" {
+			t.Errorf("object = %+v", obj)
+		}
+	}
+
+	for _, key := range []string{"u1/a", "u1/b"} {
+		if res := srv.probeRequest(ctx, "GET", "/users/"+key, nil); res.code != 404 {
+			t.Errorf("GET %s after erasure = %d, want 404", key, res.code)
+		}
+	}
+	if res := srv.probeRequest(ctx, "GET", "/users/u2/a", nil); res.code != 200 {
+		t.Errorf("unmatched object erased: %d", res.code)
+	}
+
+	w = serveErasure(srv, "GET", "/admin/erasure-requests/"+req.ID, "")
+	json.Unmarshal(w.Body.Bytes(), &req)
+	if req.State != erasureCompleted || len(req.Report) == 0 {
+		t.Errorf("request after execution = %+v", req)
+	}
+	if w := serveErasure(srv, "POST", "/admin/erasure-requests/"+req.ID+"/execute", ""); w.Code != http.StatusConflict {
+		t.Errorf("executing a completed request = %d, want 409", w.Code)
+	}
+	if w := serveErasure(srv, "GET", "/admin/erasure-requests/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown request = %d, want 404", w.Code)
+	}
+}
+
+func TestErasureRequestByMetadata(t *testing.T) {
+	ctx := context.Background()
+	srv := newErasureServer(t)
+	srv.probeRequest(ctx, "PUT", "/users", nil)
+	for key, subject := range map[string]string{"a": "alice", "b": "bob", "c": "alice"} {
+		r := httptest.NewRequest("PUT", "/users/"+key, strings.NewReader("x"))
+		r.Header.Set("x-amz-meta-subject", subject)
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, r)
+		if w.Code != 200 {
+			t.Fatalf("putting %s: %d %s", key, w.Code, w.Body.String())
+		}
+	}
+	w := serveErasure(srv, "POST", "/admin/erasure-requests", `{"bucket":"users","metadata":{"X-Amz-Meta-Subject":"alice"}}`)
+	var req erasureRequestView
+	json.Unmarshal(w.Body.Bytes(), &req)
+	w = serveErasure(srv, "POST", "/admin/erasure-requests/"+req.ID+"/execute", "")
+	var signed signedErasureReport
+	json.Unmarshal(w.Body.Bytes(), &signed)
+	var report erasureReport
+	json.Unmarshal(signed.Report, &report)
+	if !report.Verified || len(report.Objects) != 2 || report.Objects[0].Key != "a" || report.Objects[1].Key != "c" {
+		t.Fatalf("report = %+v", report)
+	}
+	if res := srv.probeRequest(ctx, "GET", "/users/b", nil); res.code != 200 {
+		t.Errorf("unmatched object erased: %d", res.code)
+	}
+}
+
+func TestErasureRequestFrozenBucket(t *testing.T) {
+	ctx := context.Background()
+	srv := newErasureServer(t)
+	srv.probeRequest(ctx, "PUT", "/users", nil)
+	srv.probeRequest(ctx, "PUT", "/users/u1/a", []byte("personal data"))
+	w := serveErasure(srv, "POST", "/admin/erasure-requests", `{"bucket":"users","prefix":"u1/"}`)
+	var req erasureRequestView
+	json.Unmarshal(w.Body.Bytes(), &req)
+	if w := serveErasure(srv, "PUT", "/admin/frozen-buckets/users", `{"reason":"legal hold"}`); w.Code != http.StatusOK {
+		t.Fatalf("freezing = %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serveErasure(srv, "POST", "/admin/erasure-requests/"+req.ID+"/execute", ""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "BucketFrozen") {
+		t.Errorf("executing in a frozen bucket = %d %s, want 403 BucketFrozen", w.Code, w.Body.String())
+	}
+	stored, _ := srv.erasure.requests.GetErasureRequest(ctx, req.ID)
+	if _, err := srv.erasure.execute(ctx, stored); err == nil {
+		t.Error("execute in a frozen bucket succeeded")
+	}
+	if res := srv.probeRequest(ctx, "GET", "/users/u1/a", nil); res.code != 200 {
+		t.Errorf("object in a frozen bucket erased: %d", res.code)
+	}
+
+	serveErasure(srv, "DELETE", "/admin/frozen-buckets/users", "")
+	if w := serveErasure(srv, "POST", "/admin/erasure-requests/"+req.ID+"/execute", ""); w.Code != http.StatusOK {
+		t.Fatalf("executing after unfreezing = %d %s", w.Code, w.Body.String())
+	}
+	if res := srv.probeRequest(ctx, "GET", "/users/u1/a", nil); res.code != 404 {
+		t.Errorf("GET after erasure = %d, want 404", res.code)
+	}
+}
+
+func TestErasureRequestsDisabled(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	if w := serveErasure(srv, "GET", "/admin/erasure-requests", ""); w.Code != http.StatusNotImplemented {
+		t.Errorf("listing with erasure requests disabled = %d, want 501", w.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// maxFreezeBodySize caps the body of PUT /admin/frozen-buckets/{bucket}.
+const maxFreezeBodySize = 64 << 10
+
+// bucketFreezeView is the JSON form of a bucket freeze.
+type bucketFreezeView struct {
+	Bucket   string `json:"bucket"`
+	FrozenAt string `json:"frozen_at"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func viewBucketFreeze(f *metadata.BucketFreeze) bucketFreezeView {
+	return bucketFreezeView{Bucket: f.Bucket, FrozenAt: xmlutil.FormatTimeS3(f.FrozenAt), Reason: f.Reason}
+}
+
+// freezeAdmin checks that bucket freezes are supported, writing the error
+// response if not. Changes are also refused on a read-only replica.
+func (s *Server) freezeAdmin(w http.ResponseWriter, r *http.Request, change bool) bool {
+	if s.freezes == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return false
+	}
+	if change && s.readOnly {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+		return false
+	}
+	return true
+}
+
+// bucketFrozen reports whether bucket is frozen. With no freeze store, as
+// on metadata engines that cannot record freezes, no bucket is.
+func bucketFrozen(ctx context.Context, freezes metadata.BucketFreezeStore, bucket string) (bool, error) {
+	if freezes == nil {
+		return false, nil
+	}
+	f, err := freezes.GetBucketFreeze(ctx, bucket)
+	if err != nil {
+		return false, err
+	}
+	return f != nil, nil
+}
+
+// handleListFrozenBuckets lists the frozen buckets.
+func (s *Server) handleListFrozenBuckets(w http.ResponseWriter, r *http.Request) {
+	if !s.freezeAdmin(w, r, false) {
+		return
+	}
+	freezes, err := s.freezes.ListBucketFreezes(r.Context())
+	if err != nil {
+		slog.Error("Bucket freeze error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	views := []bucketFreezeView{}
+	for i := range freezes {
+		views = append(views, viewBucketFreeze(&freezes[i]))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"buckets": views})
+}
+
+// handleFreezeBucket freezes a bucket: from then on its writes and deletes,
+// including multipart uploads in progress, are rejected with BucketFrozen.
+// An optional JSON body {"reason": "..."} records why.
+func (s *Server) handleFreezeBucket(w http.ResponseWriter, r *http.Request) {
+	if !s.freezeAdmin(w, r, true) {
+		return
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxFreezeBodySize))
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrIncompleteBody)
+		return
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &body); err != nil {
+			xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+				Code:       "InvalidArgument",
+				Message:    "Invalid freeze request: " + err.Error(),
+				HTTPStatus: http.StatusBadRequest,
+			})
+			return
+		}
+	}
+	name := chi.URLParam(r, "bucket")
+	bucket, err := s.meta.GetBucket(r.Context(), name)
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	if bucket == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+		return
+	}
+
+	f := &metadata.BucketFreeze{Bucket: name, FrozenAt: s.clock.Now().UTC(), Reason: body.Reason}
+	if err := s.freezes.FreezeBucket(r.Context(), f); err != nil {
+		slog.Error("Bucket freeze error", "bucket", name, "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	slog.Warn("Bucket frozen", "bucket", name, "reason", f.Reason,
+		"access_key", auth.AccessKeyFromContext(r.Context()))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(viewBucketFreeze(f))
+}
+
+// handleUnfreezeBucket lifts a bucket's freeze. Unfreezing a bucket that is
+// not frozen succeeds.
+func (s *Server) handleUnfreezeBucket(w http.ResponseWriter, r *http.Request) {
+	if !s.freezeAdmin(w, r, true) {
+		return
+	}
+	name := chi.URLParam(r, "bucket")
+	if err := s.freezes.UnfreezeBucket(r.Context(), name); err != nil {
+		slog.Error("Bucket freeze error", "bucket", name, "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	slog.Warn("Bucket unfrozen", "bucket", name, "access_key", auth.AccessKeyFromContext(r.Context()))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// blobCollector periodically removes blobs of the deduplicating storage
+// backend that no object references any more.
+type blobCollector struct {
+	store    storage.GarbageCollector
+	interval time.Duration
+	gate     *writeGate // closed while writes are quiesced for a backup
+	jobs     *jobRegistry
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop.
+func (c *blobCollector) start() {
+	c.wg.Add(1)
+	go c.loop()
+}
+
+// stop terminates the background loop, cancelling a running pass.
+func (c *blobCollector) stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+}
+
+// loop runs a collection pass every interval.
+func (c *blobCollector) loop() {
+	defer c.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stopCh
+		cancel()
+	}()
+
+	tickC, stopTick := tick(c.interval)
+	defer stopTick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickC:
+			if !c.gate.enter() {
+				continue
+			}
+			start := time.Now()
+			jctx, j := c.jobs.begin(ctx, "gc")
+			res, err := c.store.CollectGarbage(jctx)
+			j.finish(res, err)
+			c.gate.leave()
+			if err != nil {
+				if ctx.Err() == nil && !j.wasCancelled() {
+					slog.Error("Blob garbage collection error", "error", err)
+				}
+				continue
+			}
+			if res.BlobsRemoved > 0 {
+				slog.Info("Blob garbage collection complete", "blobs_removed", res.BlobsRemoved,
+					"bytes_reclaimed", res.BytesReclaimed, "duration", time.Since(start))
+			}
+		}
+	}
+}
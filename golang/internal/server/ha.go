@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// haLeaseName names the lease HA instances compete for.
+const haLeaseName = "leader"
+
+// leaderHeader names the leader on writes a standby refuses.
+const leaderHeader = "x-bleepstore-leader"
+
+// leaderElector competes for the leader lease in the shared metadata store
+// and renews it while it holds it. Leadership lapses one renew interval
+// before the lease would expire, so a leader that cannot renew stops
+// writing before a standby may take over.
+type leaderElector struct {
+	store metadata.LeaseStore
+	clock clock.Clock
+	node  string
+	ttl   time.Duration
+	renew time.Duration
+
+	mu     sync.Mutex
+	until  time.Time // leader until then
+	holder string    // holder of the lease when last seen
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// haStatus is the JSON body returned by GET /admin/ha.
+type haStatus struct {
+	Node     string `json:"node"`
+	Leader   string `json:"leader"`
+	IsLeader bool   `json:"is_leader"`
+}
+
+// start campaigns once, so this instance knows its role before serving,
+// then launches the background loop.
+func (e *leaderElector) start() {
+	if err := e.campaign(context.Background()); err != nil {
+		slog.Error("HA lease error", "error", err)
+	}
+	e.wg.Add(1)
+	go e.loop()
+}
+
+// stop terminates the background loop and releases the lease if this
+// instance holds it, so a standby takes over without waiting for expiry.
+func (e *leaderElector) stop() {
+	close(e.stopCh)
+	e.wg.Wait()
+	if !e.isLeader() {
+		return
+	}
+	e.mu.Lock()
+	e.until = time.Time{}
+	e.mu.Unlock()
+	metrics.HALeader.Set(0)
+	if err := e.store.ReleaseLease(context.Background(), haLeaseName, e.node); err != nil {
+		slog.Error("HA lease release error", "error", err)
+	}
+}
+
+// loop renews or claims the lease every renew interval.
+func (e *leaderElector) loop() {
+	defer e.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-e.stopCh
+		cancel()
+	}()
+
+	tickC, stopTick := tick(e.renew)
+	defer stopTick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickC:
+			if err := e.campaign(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("HA lease error", "error", err)
+			}
+		}
+	}
+}
+
+// campaign claims or renews the lease once. On error the current role is
+// kept until it lapses.
+func (e *leaderElector) campaign(ctx context.Context) error {
+	start := e.clock.Now()
+	lease, err := e.store.AcquireLease(ctx, haLeaseName, e.node, start, start.Add(e.ttl))
+	if err != nil {
+		return err
+	}
+	was := e.isLeader()
+	e.mu.Lock()
+	e.holder = lease.Holder
+	if lease.Holder == e.node {
+		// Measured from before the request, so it ends before the stored
+		// expiry.
+		e.until = start.Add(e.ttl - e.renew)
+	} else {
+		e.until = time.Time{}
+	}
+	e.mu.Unlock()
+
+	switch now := e.isLeader(); {
+	case now && !was:
+		metrics.HALeader.Set(1)
+		slog.Info("Became HA leader", "node", e.node)
+	case !now && was:
+		metrics.HALeader.Set(0)
+		slog.Warn("Lost HA leadership", "node", e.node, "leader", lease.Holder)
+	}
+	return nil
+}
+
+// isLeader reports whether this instance holds the lease.
+func (e *leaderElector) isLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.clock.Now().Before(e.until)
+}
+
+// leader returns the lease holder as last seen.
+func (e *leaderElector) leader() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.holder
+}
+
+// handleHA reports this instance's HA role and the current leader.
+func (s *Server) handleHA(w http.ResponseWriter, r *http.Request) {
+	if s.ha == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(haStatus{Node: s.ha.node, Leader: s.ha.leader(), IsLeader: s.ha.isLeader()})
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// newHAServer returns an HA instance named node over the metadata database
+// and object directory in dir.
+func newHAServer(t *testing.T, dir, node string, clk clock.Clock) *Server {
+	t.Helper()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("creating metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	store, err := storage.NewLocalBackend(filepath.Join(dir, "objects"))
+	if err != nil {
+		t.Fatalf("creating storage backend: %v", err)
+	}
+	cfg := &config.Config{
+		Server: config.ServerConfig{Region: "us-east-1"},
+		Auth:   config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+		HA:     config.HAConfig{Enabled: true, NodeID: node, LeaseTTLMillis: 15000, RenewIntervalMillis: 5000},
+	}
+	cfg.Metadata.Engine = "sqlite"
+	srv, err := New(cfg, meta, WithStorageBackend(store), WithClock(clk))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return srv
+}
+
+func TestHAFailover(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	clk := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	a := newHAServer(t, dir, "a", clk)
+	b := newHAServer(t, dir, "b", clk)
+
+	a.ha.campaign(ctx)
+	b.ha.campaign(ctx)
+	if !a.ha.isLeader() || b.ha.isLeader() {
+		t.Fatalf("leaders: a=%v b=%v, want only a", a.ha.isLeader(), b.ha.isLeader())
+	}
+	if res := a.probeRequest(ctx, "PUT", "/ha-bucket", nil); res.code != http.StatusOK {
+		t.Fatalf("CreateBucket on leader: %d %s", res.code, res.body.String())
+	}
+	a.probeRequest(ctx, "PUT", "/ha-bucket/k", []byte("v1"))
+
+	// The standby serves reads but sends writes to the leader.
+	if res := b.probeRequest(ctx, "GET", "/ha-bucket/k", nil); res.code != http.StatusOK || res.body.String() != "v1" {
+		t.Errorf("GET on standby = %d %q", res.code, res.body.String())
+	}
+	res := b.probeRequest(ctx, "PUT", "/ha-bucket/k", []byte("v2"))
+	if res.code != http.StatusServiceUnavailable || res.header.Get(leaderHeader) != "a" {
+		t.Errorf("PUT on standby = %d, leader %q; want 503 naming a", res.code, res.header.Get(leaderHeader))
+	}
+
+	// A leader that cannot renew stops writing before its lease expires,
+	// and the standby takes over once it has.
+	clk.Advance(11 * time.Second)
+	if a.ha.isLeader() {
+		t.Error("a still leader after missing renewals")
+	}
+	if b.ha.campaign(ctx); b.ha.isLeader() {
+		t.Error("b took over an unexpired lease")
+	}
+	clk.Advance(5 * time.Second)
+	b.ha.campaign(ctx)
+	a.ha.campaign(ctx)
+	if a.ha.isLeader() || !b.ha.isLeader() {
+		t.Fatalf("after expiry: a=%v b=%v, want only b", a.ha.isLeader(), b.ha.isLeader())
+	}
+	if res := b.probeRequest(ctx, "PUT", "/ha-bucket/k", []byte("v2")); res.code != http.StatusOK {
+		t.Errorf("PUT on new leader: status %d", res.code)
+	}
+
+	rec := httptest.NewRecorder()
+	a.handleHA(rec, httptest.NewRequest("GET", "/admin/ha", nil))
+	var status haStatus
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	if status != (haStatus{Node: "a", Leader: "b"}) {
+		t.Errorf("/admin/ha on a = %+v", status)
+	}
+
+	// Stopping the leader releases the lease for the standby.
+	b.ha.stop()
+	if a.ha.campaign(ctx); !a.ha.isLeader() {
+		t.Error("a did not take over after b released the lease")
+	}
+
+	// Background workers pause on a standby, except for its own usage.
+	if b.writes.enter() {
+		t.Error("standby write gate admits shared writes")
+	}
+	if !b.writes.enterAny() {
+		t.Error("standby write gate refuses its own writes")
+	}
+	b.writes.leave()
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// Middleware wraps an http.Handler. Embedders register middleware at a
+// Stage of the request pipeline with WithMiddleware.
+type Middleware func(http.Handler) http.Handler
+
+// Stage identifies where in the request pipeline registered middleware runs.
+type Stage int
+
+const (
+	// StagePreAuth runs after rate limiting and before SigV4 verification.
+	// Requests are not yet authenticated; rejecting here is cheap.
+	StagePreAuth Stage = iota
+	// StagePostAuth runs after a request has been authenticated, so
+	// auth.AccessKeyFromContext and auth.OwnerFromContext are populated.
+	// Use it for custom authorization.
+	StagePostAuth
+	// StagePreHandler runs immediately before the S3 handler, after
+	// virtual-host and alias resolution has rewritten the path.
+	StagePreHandler
+)
+
+// ResponseInfo describes a completed request, passed to response hooks.
+type ResponseInfo struct {
+	Status   int
+	Bytes    int64
+	Duration time.Duration
+}
+
+// ResponseHook is called after the response to a request has been written.
+type ResponseHook func(r *http.Request, info ResponseInfo)
+
+// hooks holds the middleware and response hooks registered by embedders.
+type hooks struct {
+	stages   map[Stage][]Middleware
+	response []ResponseHook
+}
+
+// WithMiddleware registers middleware to run at stage. Middleware runs in
+// registration order: the first registered sees the request first.
+func WithMiddleware(stage Stage, mw ...Middleware) ServerOption {
+	return func(s *Server) {
+		if s.hooks.stages == nil {
+			s.hooks.stages = make(map[Stage][]Middleware)
+		}
+		s.hooks.stages[stage] = append(s.hooks.stages[stage], mw...)
+	}
+}
+
+// WithResponseHook registers a hook called after every response, in
+// registration order. Hooks run on the request goroutine, so slow work
+// should be handed off.
+func WithResponseHook(hook ResponseHook) ServerOption {
+	return func(s *Server) {
+		s.hooks.response = append(s.hooks.response, hook)
+	}
+}
+
+// wrap applies the middleware registered at stage to next.
+func (h *hooks) wrap(stage Stage, next http.Handler) http.Handler {
+	mws := h.stages[stage]
+	for i := len(mws) - 1; i >= 0; i-- {
+		next = mws[i](next)
+	}
+	return next
+}
+
+// responseHookMiddleware calls the registered response hooks once next has
+// finished writing the response.
+func (h *hooks) responseHookMiddleware(next http.Handler) http.Handler {
+	if len(h.response) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		info := ResponseInfo{
+			Status:   rec.statusCode,
+			Bytes:    int64(rec.bytesWritten),
+			Duration: time.Since(start),
+		}
+		for _, hook := range h.response {
+			hook(r, info)
+		}
+	})
+}
@@ -148,7 +148,9 @@ func intCanonicalQueryString(values url.Values) string {
 	var pairs []string
 	for key, vals := range values {
 		for _, val := range vals {
-			pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(val))
+			// SigV4 encodes a space as %20, where QueryEscape writes +.
+			pairs = append(pairs, strings.ReplaceAll(url.QueryEscape(key), "+", "%20")+"="+
+				strings.ReplaceAll(url.QueryEscape(val), "+", "%20"))
 		}
 	}
 	sort.Strings(pairs)
@@ -1628,33 +1630,90 @@ func TestIntegrationPresignedGetURL(t *testing.T) {
 		"Content-Type": "text/plain",
 	}).Body.Close()
 
-	// Build a presigned GET URL manually
+	presignedURL := ts.presignGet(t, "/"+bucket+"/presigned-get.txt", nil)
+
+	// Fetch via plain HTTP GET (no authorization header)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(presignedURL)
+	if err != nil {
+		t.Fatalf("Presigned GET failed: %v", err)
+	}
+	got := intReadBodyBytes(resp)
+	if resp.StatusCode != 200 {
+		t.Errorf("Presigned GET status = %d, want 200: %s", resp.StatusCode, string(got))
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("Presigned GET body = %q, want %q", got, body)
+	}
+
+	ts.doSigned(t, "DELETE", "/"+bucket+"/presigned-get.txt", nil).Body.Close()
+	ts.doSigned(t, "DELETE", "/"+bucket, nil).Body.Close()
+}
+
+// presignGet returns a presigned GET URL for path, signing extra query
+// parameters along with the X-Amz-* ones.
+func (ts *integrationServer) presignGet(t *testing.T, path string, extra url.Values) string {
+	t.Helper()
+	return ts.presign(t, "GET", path, extra, nil)
+}
+
+// presign returns a presigned URL for method and path, signing extra query
+// parameters and the given headers, which the request must then carry. The
+// path may have its own query string. An X-Amz-Expires or
+// X-Amz-Content-Sha256 in extra replaces the default of 300 seconds and
+// UNSIGNED-PAYLOAD.
+func (ts *integrationServer) presign(t *testing.T, method, path string, extra url.Values, headers map[string]string) string {
+	t.Helper()
 	now := time.Now().UTC()
 	amzDate := now.Format("20060102T150405Z")
 	dateStr := now.Format("20060102")
 	credential := fmt.Sprintf("bleepstore/%s/us-east-1/s3/aws4_request", dateStr)
 
-	params := url.Values{}
+	path, rawQuery, _ := strings.Cut(path, "?")
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatalf("parsing query %q: %v", rawQuery, err)
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	signed := map[string]string{"host": ts.addr}
+	for k, v := range headers {
+		signed[strings.ToLower(k)] = v
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	params.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
 	params.Set("X-Amz-Credential", credential)
 	params.Set("X-Amz-Date", amzDate)
-	params.Set("X-Amz-Expires", "300")
-	params.Set("X-Amz-SignedHeaders", "host")
+	if params.Get("X-Amz-Expires") == "" {
+		params.Set("X-Amz-Expires", "300")
+	}
+	params.Set("X-Amz-SignedHeaders", strings.Join(names, ";"))
+	payloadHash := params.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = "UNSIGNED-PAYLOAD"
+	}
 
 	// Build canonical request for presigned URL
-	path := "/" + bucket + "/presigned-get.txt"
 	canonQueryStr := intCanonicalQueryString(params)
 
 	var canonReq strings.Builder
-	canonReq.WriteString("GET\n")
+	canonReq.WriteString(method + "\n")
 	canonReq.WriteString(intURIEncode(path))
 	canonReq.WriteByte('\n')
 	canonReq.WriteString(canonQueryStr)
 	canonReq.WriteByte('\n')
-	canonReq.WriteString("host:" + ts.addr + "\n")
+	for _, name := range names {
+		canonReq.WriteString(name + ":" + strings.TrimSpace(signed[name]) + "\n")
+	}
 	canonReq.WriteByte('\n')
-	canonReq.WriteString("host\n")
-	canonReq.WriteString("UNSIGNED-PAYLOAD")
+	canonReq.WriteString(strings.Join(names, ";") + "\n")
+	canonReq.WriteString(payloadHash)
 
 	scope := fmt.Sprintf("%s/us-east-1/s3/aws4_request", dateStr)
 	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + intSha256Hex([]byte(canonReq.String()))
@@ -1667,24 +1726,217 @@ func TestIntegrationPresignedGetURL(t *testing.T) {
 	signature := hex.EncodeToString(intHmacSHA256(signingKey, stringToSign))
 	params.Set("X-Amz-Signature", signature)
 
-	presignedURL := ts.endpoint + path + "?" + params.Encode()
+	return ts.endpoint + path + "?" + params.Encode()
+}
 
-	// Fetch via plain HTTP GET (no authorization header)
+func TestIntegrationPresignedGetResponseOverrides(t *testing.T) {
+	ts := newIntegrationServer(t)
+	bucket := "test-presigned-overrides"
+	ts.doSigned(t, "PUT", "/"+bucket, nil).Body.Close()
+	ts.doSignedWithHeaders(t, "PUT", "/"+bucket+"/report.bin", []byte("report body"), map[string]string{
+		"Content-Type":  "application/octet-stream",
+		"Cache-Control": "no-cache",
+	}).Body.Close()
+
+	overrides := []struct{ param, header, value string }{
+		{"response-content-type", "Content-Type", "text/csv"},
+		{"response-content-disposition", "Content-Disposition", `attachment; filename="Q3 report.csv"`},
+		{"response-cache-control", "Cache-Control", "max-age=60"},
+		{"response-content-language", "Content-Language", "de"},
+		{"response-content-encoding", "Content-Encoding", "identity"},
+		{"response-expires", "Expires", "Wed, 21 Oct 2026 07:28:00 GMT"},
+	}
+	extra := url.Values{}
+	for _, o := range overrides {
+		extra.Set(o.param, o.value)
+	}
 	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(presignedURL)
+	for _, rangeHeader := range []string{"", "bytes=0-5"} {
+		req, _ := http.NewRequest("GET", ts.presignGet(t, "/"+bucket+"/report.bin", extra), nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Presigned GET failed: %v", err)
+		}
+		body := intReadBody(resp)
+		if resp.StatusCode != 200 && resp.StatusCode != 206 {
+			t.Fatalf("Presigned GET (Range %q) status = %d: %s", rangeHeader, resp.StatusCode, body)
+		}
+		for _, o := range overrides {
+			if got := resp.Header.Get(o.header); got != o.value {
+				t.Errorf("Presigned GET (Range %q) %s = %q, want %q", rangeHeader, o.header, got, o.value)
+			}
+		}
+	}
+
+	// The overrides are signed: changing one invalidates the URL.
+	tampered := strings.Replace(ts.presignGet(t, "/"+bucket+"/report.bin", extra), "text%2Fcsv", "text%2Fhtml", 1)
+	resp, err := client.Get(tampered)
 	if err != nil {
-		t.Fatalf("Presigned GET failed: %v", err)
+		t.Fatalf("Tampered presigned GET failed: %v", err)
 	}
-	got := intReadBodyBytes(resp)
+	intReadBody(resp)
+	if resp.StatusCode != 403 {
+		t.Errorf("Tampered presigned GET status = %d, want 403", resp.StatusCode)
+	}
+}
+
+// doPresigned sends a request to a presigned URL with the given body and
+// headers.
+func doPresigned(t *testing.T, method, presignedURL string, body []byte, headers map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, presignedURL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		t.Fatalf("presigned %s failed: %v", method, err)
+	}
+	return resp
+}
+
+func TestIntegrationPresignedPutAndDelete(t *testing.T) {
+	ts := newIntegrationServer(t)
+	bucket := "test-presigned-put"
+	ts.doSigned(t, "PUT", "/"+bucket, nil).Body.Close()
+	path := "/" + bucket + "/upload.csv"
+	body := []byte("a,b\n1,2\n")
+
+	// Signed headers must be sent as signed.
+	headers := map[string]string{"Content-Type": "text/csv", "X-Amz-Meta-Source": "browser"}
+	putURL := ts.presign(t, "PUT", path, nil, headers)
+	resp := doPresigned(t, "PUT", putURL, body, map[string]string{"Content-Type": "text/plain", "X-Amz-Meta-Source": "browser"})
+	if resp.StatusCode != 403 {
+		t.Errorf("presigned PUT with a changed signed header = %d, want 403: %s", resp.StatusCode, intReadBody(resp))
+	}
+	resp.Body.Close()
+	resp = doPresigned(t, "PUT", putURL, body, headers)
 	if resp.StatusCode != 200 {
-		t.Errorf("Presigned GET status = %d, want 200: %s", resp.StatusCode, string(got))
+		t.Fatalf("presigned PUT = %d: %s", resp.StatusCode, intReadBody(resp))
 	}
-	if !bytes.Equal(got, body) {
-		t.Errorf("Presigned GET body = %q, want %q", got, body)
+	resp.Body.Close()
+
+	resp = ts.doSigned(t, "GET", path, nil)
+	if got := intReadBody(resp); got != string(body) || resp.Header.Get("Content-Type") != "text/csv" ||
+		resp.Header.Get("X-Amz-Meta-Source") != "browser" {
+		t.Errorf("object = %q (Content-Type %q, source %q)", got, resp.Header.Get("Content-Type"), resp.Header.Get("X-Amz-Meta-Source"))
 	}
 
-	ts.doSigned(t, "DELETE", "/"+bucket+"/presigned-get.txt", nil).Body.Close()
-	ts.doSigned(t, "DELETE", "/"+bucket, nil).Body.Close()
+	// A URL presigned for PUT does not allow another method.
+	resp = doPresigned(t, "DELETE", putURL, nil, nil)
+	if resp.StatusCode != 403 {
+		t.Errorf("DELETE with a PUT URL = %d, want 403", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	// A signed payload hash is part of the signature.
+	sum := sha256.Sum256(body)
+	hashed := ts.presign(t, "PUT", "/"+bucket+"/hashed.csv", url.Values{"X-Amz-Content-Sha256": {hex.EncodeToString(sum[:])}}, nil)
+	resp = doPresigned(t, "PUT", hashed, body, nil)
+	if resp.StatusCode != 200 {
+		t.Errorf("presigned PUT with a payload hash = %d: %s", resp.StatusCode, intReadBody(resp))
+	}
+	resp.Body.Close()
+
+	resp = doPresigned(t, "DELETE", ts.presign(t, "DELETE", path, nil, nil), nil, nil)
+	if resp.StatusCode != 204 {
+		t.Fatalf("presigned DELETE = %d: %s", resp.StatusCode, intReadBody(resp))
+	}
+	resp.Body.Close()
+	resp = ts.doSigned(t, "HEAD", path, nil)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("HEAD after presigned DELETE = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestIntegrationPresignedMultipart(t *testing.T) {
+	ts := newIntegrationServer(t)
+	bucket := "test-presigned-multipart"
+	key := "big.bin"
+	ts.doSigned(t, "PUT", "/"+bucket, nil).Body.Close()
+
+	resp := doPresigned(t, "POST", ts.presign(t, "POST", "/"+bucket+"/"+key+"?uploads", nil, nil), nil, nil)
+	initBody := intReadBody(resp)
+	if resp.StatusCode != 200 {
+		t.Fatalf("presigned CreateMultipartUpload = %d: %s", resp.StatusCode, initBody)
+	}
+	var initResult struct {
+		UploadID string `xml:"UploadId"`
+	}
+	xml.Unmarshal([]byte(initBody), &initResult)
+	if initResult.UploadID == "" {
+		t.Fatalf("empty upload ID: %s", initBody)
+	}
+
+	// Each part URL is signed for its part number and upload ID.
+	parts := [][]byte{bytes.Repeat([]byte("A"), 5*1024*1024), []byte("tail")}
+	var complete strings.Builder
+	complete.WriteString("<CompleteMultipartUpload>")
+	for i, data := range parts {
+		partURL := ts.presign(t, "PUT", fmt.Sprintf("/%s/%s?partNumber=%d&uploadId=%s", bucket, key, i+1, initResult.UploadID), nil, nil)
+		resp = doPresigned(t, "PUT", partURL, data, nil)
+		if resp.StatusCode != 200 {
+			t.Fatalf("presigned UploadPart %d = %d: %s", i+1, resp.StatusCode, intReadBody(resp))
+		}
+		resp.Body.Close()
+		fmt.Fprintf(&complete, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, resp.Header.Get("ETag"))
+	}
+	complete.WriteString("</CompleteMultipartUpload>")
+
+	// Reusing a part URL for another part number breaks the signature.
+	tampered := strings.Replace(ts.presign(t, "PUT", fmt.Sprintf("/%s/%s?partNumber=3&uploadId=%s", bucket, key, initResult.UploadID), nil, nil),
+		"partNumber=3", "partNumber=4", 1)
+	resp = doPresigned(t, "PUT", tampered, []byte("x"), nil)
+	if resp.StatusCode != 403 {
+		t.Errorf("presigned UploadPart with a changed part number = %d, want 403", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	completeURL := ts.presign(t, "POST", fmt.Sprintf("/%s/%s?uploadId=%s", bucket, key, initResult.UploadID), nil, nil)
+	resp = doPresigned(t, "POST", completeURL, []byte(complete.String()), nil)
+	if resp.StatusCode != 200 {
+		t.Fatalf("presigned CompleteMultipartUpload = %d: %s", resp.StatusCode, intReadBody(resp))
+	}
+	resp.Body.Close()
+
+	resp = ts.doSigned(t, "GET", "/"+bucket+"/"+key, nil)
+	if got := intReadBodyBytes(resp); !bytes.Equal(got, append(parts[0], parts[1]...)) {
+		t.Errorf("assembled object is %d bytes, want %d", len(got), len(parts[0])+len(parts[1]))
+	}
+}
+
+func TestIntegrationPresignedMaxExpiry(t *testing.T) {
+	ts := newIntegrationServer(t)
+	bucket := "test-presigned-expiry"
+	ts.doSigned(t, "PUT", "/"+bucket, nil).Body.Close()
+	ts.doSigned(t, "PUT", "/"+bucket+"/a", []byte("a")).Body.Close()
+
+	get := func(expires string) int {
+		t.Helper()
+		resp := doPresigned(t, "GET", ts.presign(t, "GET", "/"+bucket+"/a", url.Values{"X-Amz-Expires": {expires}}, nil), nil, nil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := get("604800"); got != 200 {
+		t.Errorf("7-day URL = %d, want 200", got)
+	}
+	if got := get("604801"); got != 400 {
+		t.Errorf("URL past 7 days = %d, want 400", got)
+	}
+	ts.srv.verifier.MaxPresignedExpiry = 3600
+	if got := get("3600"); got != 200 {
+		t.Errorf("URL at the configured maximum = %d, want 200", got)
+	}
+	if got := get("3601"); got != 403 {
+		t.Errorf("URL past the configured maximum = %d, want 403", got)
+	}
 }
 
 func TestIntegrationListObjectsContentFields(t *testing.T) {
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/inventory"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+const (
+	// inventoryPageSize is the number of keys listed per metadata page
+	// while writing a report.
+	inventoryPageSize = 1000
+
+	// inventoryRowsPerFile caps the objects in one report data file, so a
+	// file is buffered in memory only up to a bounded size.
+	inventoryRowsPerFile = 100000
+
+	// inventoryManifestVersion is the manifest format version of S3
+	// Inventory.
+	inventoryManifestVersion = "2016-11-30"
+)
+
+// inventoryManifestFile describes one data file of a report.
+type inventoryManifestFile struct {
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	MD5Checksum string `json:"MD5checksum"`
+}
+
+// inventoryManifest is the manifest.json of a report, in the S3 Inventory
+// format, which names the data files and their schema.
+type inventoryManifest struct {
+	SourceBucket      string                  `json:"sourceBucket"`
+	DestinationBucket string                  `json:"destinationBucket"`
+	Version           string                  `json:"version"`
+	CreationTimestamp string                  `json:"creationTimestamp"`
+	FileFormat        string                  `json:"fileFormat"`
+	FileSchema        string                  `json:"fileSchema"`
+	Files             []inventoryManifestFile `json:"files"`
+}
+
+// inventoryReport summarizes one report written, or attempted, by a run.
+type inventoryReport struct {
+	Bucket      string `json:"bucket"`
+	ID          string `json:"id"`
+	Destination string `json:"destination"`
+	Manifest    string `json:"manifest,omitempty"`
+	Objects     int64  `json:"objects"`
+	Files       int    `json:"files"`
+	Error       string `json:"error,omitempty"`
+}
+
+// inventoryRun is the JSON body returned by POST /admin/inventory, and the
+// result of each background run.
+type inventoryRun struct {
+	Reports []inventoryReport `json:"reports"`
+}
+
+// inventoryWriter writes the reports that bucket inventory configurations
+// schedule: every interval it lists the objects of each bucket whose next
+// report is due and writes the listing, and a manifest, to the
+// configuration's destination bucket through the S3 operation handlers.
+type inventoryWriter struct {
+	meta     metadata.MetadataStore
+	configs  *inventory.Configs
+	dispatch func(ctx context.Context, method, target string, body []byte) *probeResponse
+	clock    clock.Clock
+	ids      clock.IDGenerator
+	interval time.Duration
+	gate     *writeGate // closed while writes are quiesced for a backup
+	jobs     *jobRegistry
+
+	mu sync.Mutex // one run at a time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop.
+func (w *inventoryWriter) start() {
+	w.wg.Add(1)
+	go w.loop()
+}
+
+// stop terminates the background loop, cancelling a running report.
+func (w *inventoryWriter) stop() {
+	close(w.stopCh)
+	w.wg.Wait()
+}
+
+// loop writes the due reports every interval.
+func (w *inventoryWriter) loop() {
+	defer w.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-w.stopCh
+		cancel()
+	}()
+
+	tickC, stopTick := tick(w.interval)
+	defer stopTick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickC:
+			due := w.configs.Due(w.clock.Now())
+			if len(due) == 0 {
+				continue
+			}
+			jctx, j := w.jobs.begin(ctx, "inventory")
+			run, err := w.run(jctx, due)
+			j.finish(run, err)
+			if err != nil && ctx.Err() == nil && !j.wasCancelled() {
+				slog.Error("Inventory error", "error", err)
+			}
+		}
+	}
+}
+
+// run writes a report for each configuration. A report that fails, or is
+// skipped while writes are quiesced, is recorded in the result and retried
+// when next due; the run stops early only when ctx ends.
+func (w *inventoryWriter) run(ctx context.Context, configs []inventory.Scheduled) (*inventoryRun, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	run := &inventoryRun{Reports: []inventoryReport{}}
+	var objects int64
+	for _, s := range configs {
+		// Skip for now if writes are quiesced for a backup.
+		if !w.gate.enter() {
+			run.Reports = append(run.Reports, inventoryReport{Bucket: s.Bucket, ID: s.Config.ID,
+				Destination: inventory.DestinationBucket(s.Config), Error: "writes are quiesced"})
+			continue
+		}
+		started := w.clock.Now()
+		report, err := w.report(ctx, s, &objects)
+		w.gate.leave()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			err = w.configs.MarkRun(ctx, s.Bucket, s.Config.ID, started)
+		}
+		if err != nil {
+			slog.Error("Inventory report failed", "bucket", s.Bucket, "id", s.Config.ID, "error", err)
+			metrics.InventoryReportsTotal.WithLabelValues("error").Inc()
+			report.Error = err.Error()
+		} else {
+			slog.Info("Inventory report written", "bucket", s.Bucket, "id", s.Config.ID,
+				"manifest", report.Manifest, "objects", report.Objects)
+			metrics.InventoryReportsTotal.WithLabelValues("success").Inc()
+		}
+		run.Reports = append(run.Reports, *report)
+	}
+	return run, nil
+}
+
+// report lists the objects a configuration selects into data files of its
+// format, then writes the manifest naming them. objects counts the objects
+// listed by the run, for its progress.
+func (w *inventoryWriter) report(ctx context.Context, s inventory.Scheduled, objects *int64) (*inventoryReport, error) {
+	cfg := s.Config
+	dest := &cfg.Destination.S3BucketDestination
+	destBucket := inventory.DestinationBucket(cfg)
+	report := &inventoryReport{Bucket: s.Bucket, ID: cfg.ID, Destination: destBucket}
+
+	now := w.clock.Now().UTC()
+	base := path.Join(dest.Prefix, s.Bucket, cfg.ID)
+	cols := inventory.ColumnsOf(cfg)
+	manifest := inventoryManifest{
+		SourceBucket:      s.Bucket,
+		DestinationBucket: "arn:aws:s3:::" + destBucket,
+		Version:           inventoryManifestVersion,
+		CreationTimestamp: strconv.FormatInt(now.UnixMilli(), 10),
+		FileFormat:        dest.Format,
+		FileSchema:        cols.Schema(dest.Format),
+		Files:             []inventoryManifestFile{},
+	}
+
+	var buf bytes.Buffer
+	var file inventory.Writer
+	rows := 0
+	flush := func() error {
+		if file == nil {
+			return nil
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		key := base + "/data/" + w.ids.NewID() + inventory.Extension(dest.Format)
+		if err := w.put(ctx, destBucket, key, buf.Bytes()); err != nil {
+			return err
+		}
+		sum := md5.Sum(buf.Bytes())
+		manifest.Files = append(manifest.Files, inventoryManifestFile{
+			Key: key, Size: int64(buf.Len()), MD5Checksum: hex.EncodeToString(sum[:]),
+		})
+		buf.Reset()
+		file, rows = nil, 0
+		return nil
+	}
+
+	opts := metadata.ListObjectsOptions{Prefix: inventory.Prefix(cfg), MaxKeys: inventoryPageSize}
+	for {
+		page, err := w.meta.ListObjects(ctx, s.Bucket, opts)
+		if err != nil {
+			return report, fmt.Errorf("listing %s: %w", s.Bucket, err)
+		}
+		for i := range page.Objects {
+			obj := &page.Objects[i]
+			if obj.DeleteMarker {
+				continue
+			}
+			if file == nil {
+				file = inventory.NewWriter(dest.Format, &buf, cols)
+			}
+			if err := file.Write(inventoryRow(obj)); err != nil {
+				return report, err
+			}
+			report.Objects++
+			*objects++
+			if rows++; rows == inventoryRowsPerFile {
+				if err := flush(); err != nil {
+					return report, err
+				}
+			}
+		}
+		progress.Report(ctx, *objects, 0)
+		if !page.IsTruncated || len(page.Objects) == 0 {
+			break
+		}
+		opts.StartAfter = page.Objects[len(page.Objects)-1].Key
+	}
+	if err := flush(); err != nil {
+		return report, err
+	}
+	report.Files = len(manifest.Files)
+
+	doc, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return report, err
+	}
+	dir := base + "/" + now.Format("2006-01-02T15-04Z")
+	if err := w.put(ctx, destBucket, dir+"/manifest.json", doc); err != nil {
+		return report, err
+	}
+	sum := md5.Sum(doc)
+	if err := w.put(ctx, destBucket, dir+"/manifest.checksum", []byte(hex.EncodeToString(sum[:]))); err != nil {
+		return report, err
+	}
+	report.Manifest = dir + "/manifest.json"
+	metrics.InventoryObjectsTotal.Add(float64(report.Objects))
+	return report, nil
+}
+
+// inventoryRow returns the report row of an object.
+func inventoryRow(obj *metadata.ObjectRecord) *inventory.Row {
+	etag := strings.Trim(obj.ETag, `"`)
+	storageClass := obj.StorageClass
+	if storageClass == "" {
+		storageClass = "STANDARD"
+	}
+	return &inventory.Row{
+		Bucket:            obj.Bucket,
+		Key:               obj.Key,
+		Size:              obj.Size,
+		LastModified:      obj.LastModified,
+		ETag:              etag,
+		StorageClass:      storageClass,
+		Multipart:         strings.Contains(etag, "-"),
+		ReplicationStatus: obj.ReplicationStatus,
+	}
+}
+
+// put writes an object of a report through the S3 operation handlers, so
+// the write is accounted for like any other.
+func (w *inventoryWriter) put(ctx context.Context, bucket, key string, body []byte) error {
+	target := (&url.URL{Path: "/" + bucket + "/" + key}).String()
+	res := w.dispatch(ctx, http.MethodPut, target, body)
+	if res.code != http.StatusOK {
+		return fmt.Errorf("writing %s/%s: status %d: %s", bucket, key, res.code, res.body.String())
+	}
+	return nil
+}
+
+// handleInventory writes inventory reports now, whether or not they are
+// due: every enabled configuration, those of the "bucket" query parameter,
+// or the one named by "bucket" and "id", even if disabled.
+func (s *Server) handleInventory(w http.ResponseWriter, r *http.Request) {
+	if s.inventory == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	bucket, id := r.URL.Query().Get("bucket"), r.URL.Query().Get("id")
+	var configs []inventory.Scheduled
+	switch {
+	case id != "":
+		if bucket == "" {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		cfg := s.inventory.configs.Get(bucket, id)
+		if cfg == nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchConfiguration)
+			return
+		}
+		configs = []inventory.Scheduled{{Bucket: bucket, Config: cfg}}
+	default:
+		for _, c := range s.inventory.configs.Enabled() {
+			if bucket == "" || c.Bucket == bucket {
+				configs = append(configs, c)
+			}
+		}
+	}
+
+	s.runJob(w, r, "inventory", func(ctx context.Context) (any, error) {
+		return s.inventory.run(ctx, configs)
+	})
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// newInventoryServer returns a server with bucket inventory enabled.
+func newInventoryServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("creating metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	store, err := storage.NewLocalBackend(filepath.Join(dir, "objects"))
+	if err != nil {
+		t.Fatalf("creating storage backend: %v", err)
+	}
+	cfg := &config.Config{
+		Server:    config.ServerConfig{Region: "us-east-1"},
+		Auth:      config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+		Inventory: config.InventoryConfig{Enabled: true, CheckIntervalSeconds: 3600},
+	}
+	cfg.Metadata.Engine = "sqlite"
+	srv, err := New(cfg, meta, WithStorageBackend(store))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return srv
+}
+
+const testInventoryConfig = `<InventoryConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+	<Id>daily</Id><IsEnabled>true</IsEnabled>
+	<Destination><S3BucketDestination><Bucket>arn:aws:s3:::reports</Bucket>
+		<Format>CSV</Format><Prefix>inv</Prefix></S3BucketDestination></Destination>
+	<Filter><Prefix>data/</Prefix></Filter>
+	<IncludedObjectVersions>Current</IncludedObjectVersions>
+	<OptionalFields><Field>Size</Field><Field>ETag</Field></OptionalFields>
+	<Schedule><Frequency>Daily</Frequency></Schedule>
+</InventoryConfiguration>`
+
+func TestBucketInventory(t *testing.T) {
+	ctx := context.Background()
+	srv := newInventoryServer(t)
+	srv.probeRequest(ctx, "PUT", "/src", nil)
+	srv.probeRequest(ctx, "PUT", "/reports", nil)
+	for key, body := range map[string]string{"data/a": "abc", "data/b b": "", "other": "x"} {
+		if res := srv.probeRequest(ctx, "PUT", "/src/"+strings.ReplaceAll(key, " ", "%20"), []byte(body)); res.code != 200 {
+			t.Fatalf("putting %s: %d %s", key, res.code, res.body.String())
+		}
+	}
+
+	if res := srv.probeRequest(ctx, "GET", "/src?inventory&id=daily", nil); res.code != 404 ||
+		!strings.Contains(res.body.String(), "NoSuchConfiguration") {
+		t.Fatalf("GetBucketInventoryConfiguration before put = %d %s", res.code, res.body.String())
+	}
+	if res := srv.probeRequest(ctx, "PUT", "/src?inventory&id=other", []byte(testInventoryConfig)); res.code != 400 {
+		t.Fatalf("PutBucketInventoryConfiguration with mismatched id = %d %s", res.code, res.body.String())
+	}
+	if res := srv.probeRequest(ctx, "PUT", "/src?inventory&id=daily", []byte(testInventoryConfig)); res.code != 200 {
+		t.Fatalf("PutBucketInventoryConfiguration = %d %s", res.code, res.body.String())
+	}
+	if res := srv.probeRequest(ctx, "GET", "/src?inventory", nil); !strings.Contains(res.body.String(), "<Id>daily</Id>") {
+		t.Fatalf("ListBucketInventoryConfigurations = %d %s", res.code, res.body.String())
+	}
+
+	run, err := srv.inventory.run(ctx, srv.inventory.configs.Due(srv.inventory.clock.Now()))
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(run.Reports) != 1 || run.Reports[0].Error != "" || run.Reports[0].Objects != 2 || run.Reports[0].Files != 1 {
+		t.Fatalf("run = %+v", run)
+	}
+	if due := srv.inventory.configs.Due(srv.inventory.clock.Now()); len(due) != 0 {
+		t.Errorf("report still due after run: %+v", due)
+	}
+
+	res := srv.probeRequest(ctx, "GET", "/reports/"+run.Reports[0].Manifest, nil)
+	if res.code != 200 {
+		t.Fatalf("reading manifest: %d %s", res.code, res.body.String())
+	}
+	var manifest inventoryManifest
+	if err := json.Unmarshal(res.body.Bytes(), &manifest); err != nil {
+		t.Fatalf("decoding manifest: %v", err)
+	}
+	if manifest.SourceBucket != "src" || manifest.FileFormat != "CSV" ||
+		manifest.FileSchema != "Bucket, Key, Size, ETag" || len(manifest.Files) != 1 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+	if !strings.HasPrefix(manifest.Files[0].Key, "inv/src/daily/data/") {
+		t.Errorf("data file key = %s", manifest.Files[0].Key)
+	}
+	checksum := strings.TrimSuffix(run.Reports[0].Manifest, "manifest.json") + "manifest.checksum"
+	if res := srv.probeRequest(ctx, "GET", "/reports/"+checksum, nil); res.code != 200 {
+		t.Errorf("reading manifest.checksum: %d", res.code)
+	}
+
+	res = srv.probeRequest(ctx, "GET", "/reports/"+manifest.Files[0].Key, nil)
+	if res.code != 200 || int64(res.body.Len()) != manifest.Files[0].Size {
+		t.Fatalf("reading data file: %d, %d bytes", res.code, res.body.Len())
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(res.body.Bytes()))
+	if err != nil {
+		t.Fatalf("data file is not gzip: %v", err)
+	}
+	rows, _ := io.ReadAll(zr)
+	want := `"src","data%2Fa","3","900150983cd24fb0d6963f7d28e17f72"
+"src","data%2Fb+b","0","d41d8cd98f00b204e9800998ecf8427e"
+`
+	if string(rows) != want {
+		t.Errorf("rows =\n%s\nwant\n%s", rows, want)
+	}
+
+	if res := srv.probeRequest(ctx, "DELETE", "/src?inventory&id=daily", nil); res.code != 204 {
+		t.Fatalf("DeleteBucketInventoryConfiguration = %d %s", res.code, res.body.String())
+	}
+	if srv.inventory.configs.Get("src", "daily") != nil {
+		t.Error("deleted configuration still scheduled")
+	}
+}
+
+func TestBucketInventoryDisabled(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.probeRequest(context.Background(), "PUT", "/src", nil)
+	res := srv.probeRequest(context.Background(), "PUT", "/src?inventory&id=daily", []byte(testInventoryConfig))
+	if res.code != 501 {
+		t.Errorf("PutBucketInventoryConfiguration with inventory disabled = %d, want 501", res.code)
+	}
+}
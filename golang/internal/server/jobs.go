@@ -0,0 +1,368 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// Job states.
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// maxFinishedJobs is the number of finished jobs kept for GET /admin/jobs.
+const maxFinishedJobs = 100
+
+// jobIDHeader names the job that produced a synchronous admin response.
+const jobIDHeader = "x-bleepstore-job-id"
+
+// jobUnits names what each kind of job counts in its progress.
+var jobUnits = map[string]string{
+	"rebalance":  "objects",
+	"rebuild":    "objects",
+	"preload":    "objects",
+	"orphans":    "files",
+	"scrub":      "objects",
+	"gc":         "blobs",
+	"compaction": "segments",
+	"defrag":     "objects",
+	"inventory":  "objects",
+	"erasure":    "objects",
+}
+
+var (
+	// errNoSuchJob is returned for a job ID that is unknown or has been
+	// dropped from the history.
+	errNoSuchJob = &s3err.S3Error{
+		Code:       "NoSuchJob",
+		Message:    "The specified job does not exist",
+		HTTPStatus: http.StatusNotFound,
+	}
+
+	// errJobFinished is returned when cancelling a job that is not running.
+	errJobFinished = &s3err.S3Error{
+		Code:       "OperationAborted",
+		Message:    "The job has already finished",
+		HTTPStatus: http.StatusConflict,
+	}
+
+	// errJobCancelled answers a synchronous admin call whose job was
+	// cancelled through the jobs API.
+	errJobCancelled = &s3err.S3Error{
+		Code:       "OperationAborted",
+		Message:    "The job was cancelled",
+		HTTPStatus: http.StatusConflict,
+	}
+)
+
+// job is one run of a long-running admin operation or background pass.
+type job struct {
+	reg     *jobRegistry
+	id      string
+	kind    string
+	started time.Time
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	state     string
+	done      int64
+	total     int64
+	finished  time.Time
+	cancelled bool // through the jobs API
+	err       string
+	result    any
+}
+
+// jobStatus is the JSON description of a job.
+type jobStatus struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	State      string     `json:"state"`
+	Done       int64      `json:"done"`
+	Total      int64      `json:"total,omitempty"`
+	Unit       string     `json:"unit"`
+	Percent    *float64   `json:"percent,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Result     any        `json:"result,omitempty"`
+}
+
+// jobList is the JSON body returned by GET /admin/jobs.
+type jobList struct {
+	Jobs []jobStatus `json:"jobs"`
+}
+
+// jobRegistry tracks running jobs and the most recent finished ones, in
+// memory. A nil registry tracks nothing.
+type jobRegistry struct {
+	clock clock.Clock
+	ids   clock.IDGenerator
+
+	mu       sync.Mutex
+	jobs     map[string]*job
+	finished []string // IDs of finished jobs, oldest first
+	wg       sync.WaitGroup
+}
+
+// newJobRegistry returns an empty registry.
+func newJobRegistry(clk clock.Clock, ids clock.IDGenerator) *jobRegistry {
+	return &jobRegistry{clock: clk, ids: ids, jobs: make(map[string]*job)}
+}
+
+// begin registers a running job of kind. The returned context is cancelled
+// when the job is, and carries the job's progress reporter.
+func (r *jobRegistry) begin(ctx context.Context, kind string) (context.Context, *job) {
+	if r == nil {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	j := &job{reg: r, id: r.ids.NewID(), kind: kind, started: r.clock.Now().UTC(), cancel: cancel, state: jobRunning}
+	r.mu.Lock()
+	r.jobs[j.id] = j
+	r.mu.Unlock()
+	return progress.With(ctx, j.report), j
+}
+
+// report records progress.
+func (j *job) report(done, total int64) {
+	j.mu.Lock()
+	j.done, j.total = done, total
+	j.mu.Unlock()
+}
+
+// finish records the outcome of the job: result on success, or err.
+func (j *job) finish(result any, err error) {
+	if j == nil {
+		return
+	}
+	j.cancel()
+	j.mu.Lock()
+	j.finished = j.reg.clock.Now().UTC()
+	switch {
+	case err == nil:
+		j.state = jobSucceeded
+		j.result = result
+		if j.total > 0 {
+			j.done = j.total
+		}
+	case j.cancelled || errors.Is(err, context.Canceled):
+		j.state = jobCancelled
+	default:
+		j.state = jobFailed
+		j.err = err.Error()
+	}
+	j.mu.Unlock()
+
+	r := j.reg
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished = append(r.finished, j.id)
+	for len(r.finished) > maxFinishedJobs {
+		delete(r.jobs, r.finished[0])
+		r.finished = r.finished[1:]
+	}
+}
+
+// wasCancelled reports whether the job was cancelled through the jobs API.
+func (j *job) wasCancelled() bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.cancelled
+}
+
+// status describes the job.
+func (j *job) status() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := jobStatus{
+		ID:        j.id,
+		Kind:      j.kind,
+		State:     j.state,
+		Done:      j.done,
+		Total:     j.total,
+		Unit:      jobUnits[j.kind],
+		StartedAt: j.started,
+		Error:     j.err,
+		Result:    j.result,
+	}
+	if j.total > 0 {
+		pct := math.Round(1000*float64(j.done)/float64(j.total)) / 10
+		st.Percent = &pct
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		st.FinishedAt = &finished
+	}
+	return st
+}
+
+// get returns the job with id, or nil.
+func (r *jobRegistry) get(id string) *job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.jobs[id]
+}
+
+// list describes the jobs in state ("" = all), newest first.
+func (r *jobRegistry) list(state string) []jobStatus {
+	r.mu.Lock()
+	jobs := make([]*job, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		jobs = append(jobs, j)
+	}
+	r.mu.Unlock()
+
+	out := []jobStatus{}
+	for _, j := range jobs {
+		if st := j.status(); state == "" || st.State == state {
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if !out[a].StartedAt.Equal(out[b].StartedAt) {
+			return out[a].StartedAt.After(out[b].StartedAt)
+		}
+		return out[a].ID > out[b].ID
+	})
+	return out
+}
+
+// cancelJob cancels the running job with id.
+func (r *jobRegistry) cancelJob(id string) (jobStatus, error) {
+	j := r.get(id)
+	if j == nil {
+		return jobStatus{}, errNoSuchJob
+	}
+	j.mu.Lock()
+	if j.state != jobRunning {
+		j.mu.Unlock()
+		return jobStatus{}, errJobFinished
+	}
+	j.cancelled = true
+	j.mu.Unlock()
+	j.cancel()
+	slog.Info("Job cancelled", "job_id", j.id, "kind", j.kind)
+	return j.status(), nil
+}
+
+// stop cancels the running jobs and waits for asynchronous ones to return.
+func (r *jobRegistry) stop() {
+	r.mu.Lock()
+	for _, j := range r.jobs {
+		j.cancel()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// runJob runs fn as a job of kind and answers with its result as JSON.
+// With "async=true" it answers 202 Accepted with the job's status at once
+// and runs fn in the background, past the end of the request; the result
+// is then read from GET /admin/jobs/{id}.
+func (s *Server) runJob(w http.ResponseWriter, r *http.Request, kind string, fn func(ctx context.Context) (any, error)) {
+	var async bool
+	if v := r.URL.Query().Get("async"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		async = b
+	}
+
+	if async {
+		ctx, j := s.jobs.begin(context.WithoutCancel(r.Context()), kind)
+		s.jobs.wg.Add(1)
+		go func() {
+			defer s.jobs.wg.Done()
+			result, err := fn(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				slog.Error("Job error", "job_id", j.id, "kind", kind, "error", err)
+			}
+			j.finish(result, err)
+		}()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(j.status())
+		return
+	}
+
+	ctx, j := s.jobs.begin(r.Context(), kind)
+	result, err := fn(ctx)
+	j.finish(result, err)
+	if err != nil {
+		switch {
+		case j.wasCancelled():
+			xmlutil.WriteErrorResponse(w, r, errJobCancelled)
+		case r.Context().Err() != nil:
+			// The client went away.
+		default:
+			slog.Error("Job error", "job_id", j.id, "kind", kind, "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(jobIDHeader, j.id)
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleListJobs lists running and recently finished jobs, newest first.
+// The optional "state" query parameter selects one state.
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", jobRunning, jobSucceeded, jobFailed, jobCancelled:
+	default:
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobList{Jobs: s.jobs.list(state)})
+}
+
+// handleGetJob reports one job's progress and, once finished, its outcome.
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j := s.jobs.get(chi.URLParam(r, "id"))
+	if j == nil {
+		xmlutil.WriteErrorResponse(w, r, errNoSuchJob)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(j.status())
+}
+
+// handleCancelJob cancels a running job. It returns at once; the job
+// reaches the cancelled state when its work next checks for cancellation.
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	st, err := s.jobs.cancelJob(chi.URLParam(r, "id"))
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, err.(*s3err.S3Error))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
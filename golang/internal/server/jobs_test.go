@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/progress"
+)
+
+func TestJobs(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	call := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		asRoot(srv).ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+	status := func(rec *httptest.ResponseRecorder) jobStatus {
+		var st jobStatus
+		json.Unmarshal(rec.Body.Bytes(), &st)
+		return st
+	}
+
+	// An asynchronous job reports progress until it is cancelled.
+	started := make(chan struct{})
+	rec := httptest.NewRecorder()
+	srv.runJob(rec, httptest.NewRequest("POST", "/admin/rebuild?async=true", nil), "rebuild",
+		func(ctx context.Context) (any, error) {
+			progress.Report(ctx, 1, 4)
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("async job: status %d, want 202", rec.Code)
+	}
+	id := status(rec).ID
+	<-started
+	st := status(call("GET", "/admin/jobs/"+id))
+	if st.State != jobRunning || st.Kind != "rebuild" || st.Unit != "objects" || st.Percent == nil || *st.Percent != 25 {
+		t.Errorf("running job = %+v", st)
+	}
+	var list jobList
+	json.Unmarshal(call("GET", "/admin/jobs?state=running").Body.Bytes(), &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != id {
+		t.Errorf("running jobs = %+v", list.Jobs)
+	}
+
+	// Another access key may not cancel it.
+	asAlice := auth.MiddlewareFunc(func(*http.Request) (Identity, error) {
+		return Identity{AccessKeyID: "alice", OwnerID: "alice", DisplayName: "alice"}, nil
+	})(srv.router)
+	rec = httptest.NewRecorder()
+	asAlice.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/jobs/"+id+"/cancel", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("cancel as alice: status %d, want 403", rec.Code)
+	}
+	if st := status(call("GET", "/admin/jobs/"+id)); st.State != jobRunning {
+		t.Errorf("job after cancel as alice = %+v", st)
+	}
+
+	if rec := call("POST", "/admin/jobs/"+id+"/cancel"); rec.Code != http.StatusOK {
+		t.Fatalf("cancel: %d %s", rec.Code, rec.Body.String())
+	}
+	srv.jobs.wg.Wait()
+	if st := status(call("GET", "/admin/jobs/"+id)); st.State != jobCancelled || st.FinishedAt == nil {
+		t.Errorf("cancelled job = %+v", st)
+	}
+	if rec := call("POST", "/admin/jobs/"+id+"/cancel"); rec.Code != http.StatusConflict {
+		t.Errorf("cancel finished job: status %d, want 409", rec.Code)
+	}
+
+	// A synchronous admin call names its job, which keeps the result.
+	rec = call("POST", "/admin/orphans?dry-run=true")
+	if rec.Code != http.StatusOK || rec.Header().Get(jobIDHeader) == "" {
+		t.Fatalf("orphans: %d %s", rec.Code, rec.Body.String())
+	}
+	st = status(call("GET", "/admin/jobs/"+rec.Header().Get(jobIDHeader)))
+	if st.State != jobSucceeded || st.Kind != "orphans" || st.Result == nil {
+		t.Errorf("finished job = %+v", st)
+	}
+
+	if rec := call("GET", "/admin/jobs/missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", rec.Code)
+	}
+	if rec := call("POST", "/admin/orphans?async=maybe"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid async: status %d, want 400", rec.Code)
+	}
+}
+
+func TestJobHistory(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	_, first := srv.jobs.begin(context.Background(), "gc")
+	first.finish(nil, nil)
+	for i := 0; i < maxFinishedJobs; i++ {
+		_, j := srv.jobs.begin(context.Background(), "gc")
+		j.finish(nil, nil)
+	}
+	if srv.jobs.get(first.id) != nil {
+		t.Error("oldest finished job kept past the history limit")
+	}
+	if n := len(srv.jobs.list("")); n != maxFinishedJobs {
+		t.Errorf("jobs listed = %d, want %d", n, maxFinishedJobs)
+	}
+
+	var none *jobRegistry
+	ctx, j := none.begin(context.Background(), "gc")
+	progress.Report(ctx, 1, 2)
+	j.finish(nil, nil)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+)
+
+// walSampleInterval is how often the WAL size gauge is refreshed between
+// checkpoints.
+const walSampleInterval = 15 * time.Second
+
+// maintainer periodically checkpoints, vacuums and analyzes the metadata
+// database. A task whose interval is zero or negative never runs.
+type maintainer struct {
+	store       metadata.Maintainer
+	checkpoint  time.Duration
+	vacuum      time.Duration
+	vacuumPages int
+	analyze     time.Duration
+	gate        *writeGate // closed while writes are quiesced for a backup
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop.
+func (m *maintainer) start() {
+	m.wg.Add(1)
+	go m.loop()
+}
+
+// stop terminates the background loop, waiting for a running task.
+func (m *maintainer) stop() {
+	close(m.stopCh)
+	m.wg.Wait()
+}
+
+// tick returns a ticker channel for d, or nil (never ready) when d <= 0.
+func tick(d time.Duration) (<-chan time.Time, func()) {
+	if d <= 0 {
+		return nil, func() {}
+	}
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// loop runs each task on its own interval and samples the WAL size.
+func (m *maintainer) loop() {
+	defer m.wg.Done()
+
+	checkpointC, stopCheckpoint := tick(m.checkpoint)
+	defer stopCheckpoint()
+	vacuumC, stopVacuum := tick(m.vacuum)
+	defer stopVacuum()
+	analyzeC, stopAnalyze := tick(m.analyze)
+	defer stopAnalyze()
+	sampleC, stopSample := tick(walSampleInterval)
+	defer stopSample()
+
+	ctx := context.Background()
+	m.sampleWAL()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-sampleC:
+			m.sampleWAL()
+		case <-checkpointC:
+			m.run(ctx, "checkpoint", m.store.Checkpoint)
+			m.sampleWAL()
+		case <-vacuumC:
+			m.run(ctx, "vacuum", func(ctx context.Context) error {
+				return m.store.Vacuum(ctx, m.vacuumPages)
+			})
+		case <-analyzeC:
+			m.run(ctx, "analyze", m.store.Analyze)
+		}
+	}
+}
+
+// run executes one maintenance task and records its outcome.
+func (m *maintainer) run(ctx context.Context, task string, fn func(context.Context) error) {
+	if !m.gate.enterAny() {
+		return
+	}
+	start := time.Now()
+	err := fn(ctx)
+	m.gate.leave()
+	elapsed := time.Since(start)
+	metrics.MaintenanceDuration.WithLabelValues(task).Observe(elapsed.Seconds())
+	if err != nil {
+		metrics.MaintenanceRunsTotal.WithLabelValues(task, "error").Inc()
+		slog.Error("Metadata maintenance error", "task", task, "error", err)
+		return
+	}
+	metrics.MaintenanceRunsTotal.WithLabelValues(task, "success").Inc()
+	slog.Debug("Metadata maintenance complete", "task", task, "duration", elapsed)
+}
+
+// sampleWAL updates the WAL size gauge.
+func (m *maintainer) sampleWAL() {
+	size, err := m.store.WALSize()
+	if err != nil {
+		slog.Error("WAL size error", "error", err)
+		return
+	}
+	metrics.MetadataWALBytes.Set(float64(size))
+}
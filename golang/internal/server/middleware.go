@@ -1,41 +1,78 @@
 package server
 
 import (
-	"crypto/rand"
-	"encoding/hex"
-	"fmt"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/bleepstore/bleepstore/internal/clock"
 	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/handlers"
 	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/s3op"
 	"github.com/bleepstore/bleepstore/internal/xmlutil"
 )
 
-// generateRequestID generates a 16-character uppercase hexadecimal request ID
-// using crypto/rand for randomness.
-func generateRequestID() string {
-	b := make([]byte, 8)
-	if _, err := rand.Read(b); err != nil {
-		// Fallback: should never happen with crypto/rand, but if it does,
-		// use a timestamp-based value rather than panicking.
-		return fmt.Sprintf("%016X", time.Now().UnixNano())
+// commonHeaders is HTTP middleware that injects common S3 response headers
+// on every response: x-amz-request-id, x-amz-id-2, Date, and Server. The
+// request ID is the last 16 characters of an ID from ids.
+func commonHeaders(c clock.Clock, ids clock.IDGenerator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := ids.NewID()
+			requestID := id[len(id)-16:]
+			w.Header().Set("x-amz-request-id", requestID)
+			w.Header().Set("x-amz-id-2", requestID)
+			w.Header().Set("Date", xmlutil.FormatTimeHTTP(c.Now()))
+			w.Header().Set("Server", "BleepStore")
+			next.ServeHTTP(w, r)
+		})
 	}
-	return hex.EncodeToString(b)
 }
 
-// commonHeaders is HTTP middleware that injects common S3 response headers
-// on every response: x-amz-request-id, x-amz-id-2, Date, and Server.
-func commonHeaders(next http.Handler) http.Handler {
+// commonHeaderNames are the headers commonHeaders sets, which a recovered
+// panic's error response keeps.
+var commonHeaderNames = []string{"X-Amz-Request-Id", "X-Amz-Id-2", "Date", "Server"}
+
+// recoveryMiddleware turns a handler panic into a 500 InternalError
+// response whose RequestId is the request ID, logs the panic and its
+// stack once under that ID, and counts it in bleepstore_panics_total. It
+// must sit inside commonHeaders and any compression. A panic after the response has started
+// can only abort the connection, which is what it then does;
+// http.ErrAbortHandler is passed through untouched.
+func recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := generateRequestID()
-		w.Header().Set("x-amz-request-id", requestID)
-		w.Header().Set("x-amz-id-2", requestID)
-		w.Header().Set("Date", xmlutil.FormatTimeHTTP(time.Now()))
-		w.Header().Set("Server", "BleepStore")
-		next.ServeHTTP(w, r)
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			requestID := w.Header().Get("x-amz-request-id")
+			metrics.PanicsTotal.Inc()
+			slog.Error("Handler panic", "request_id", requestID, "method", r.Method, "path", r.URL.Path,
+				"panic", v, "stack", string(debug.Stack()))
+			if rec.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			// Drop whatever the handler set for its own response, such as
+			// Content-Length.
+			h := w.Header()
+			for name := range h {
+				if !slices.Contains(commonHeaderNames, name) {
+					h.Del(name)
+				}
+			}
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		}()
+		next.ServeHTTP(rec, r)
 	})
 }
 
@@ -120,10 +157,31 @@ func metricsMiddleware(next http.Handler) http.Handler {
 				s3Status = "error"
 			}
 			metrics.S3OperationsTotal.WithLabelValues(op, s3Status).Inc()
+
+			// Per-bucket size histograms. Only successful requests are
+			// recorded so that requests naming nonexistent buckets cannot
+			// inflate label cardinality.
+			if bucket, _ := handlers.SplitPath(r.URL.Path); bucket != "" && rec.statusCode < 400 {
+				if size := requestBodySize(r); size >= 0 && (r.Method == http.MethodPut || r.Method == http.MethodPost) {
+					metrics.S3RequestSize.WithLabelValues(bucket, op).Observe(float64(size))
+				}
+				metrics.S3ResponseSize.WithLabelValues(bucket, op).Observe(float64(rec.bytesWritten))
+			}
 		}
 	})
 }
 
+// requestBodySize returns the payload size of a request, using the decoded
+// length for aws-chunked uploads. Returns -1 when the size is unknown.
+func requestBodySize(r *http.Request) int64 {
+	if v := r.Header.Get("X-Amz-Decoded-Content-Length"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	}
+	return r.ContentLength
+}
+
 // transferEncodingCheck rejects requests with non-chunked Transfer-Encoding
 // (e.g., "identity") which S3 does not support. This must run early in the
 // pipeline, before auth or handler processing.
@@ -150,6 +208,27 @@ func transferEncodingCheck(next http.Handler) http.Handler {
 	})
 }
 
+// bodySizeLimit rejects request bodies larger than the maximum object size
+// with EntityTooLarge before auth or a handler reads them. Bodies of
+// unknown length (chunked) are cut off once they pass the limit, which
+// handlers report as EntityTooLarge. A limit of 0 disables the check.
+func bodySizeLimit(maxSize int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxSize > 0 && r.Body != nil && r.Body != http.NoBody {
+				if requestBodySize(r) > maxSize {
+					xmlutil.WriteErrorResponse(w, r, s3err.ErrEntityTooLarge)
+					return
+				}
+				if r.ContentLength < 0 {
+					r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // metaHeaderPrefix is the canonical form of "x-amz-meta-" as produced by
 // Go's textproto.CanonicalMIMEHeaderKey.
 const metaHeaderPrefix = "X-Amz-Meta-"
@@ -211,7 +290,8 @@ func metadataHeaderMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// infraPaths is the set of non-S3 infrastructure endpoints.
+// infraPaths is the set of non-S3 infrastructure endpoints outside the
+// admin API.
 var infraPaths = map[string]bool{
 	"/health":       true,
 	"/healthz":      true,
@@ -222,104 +302,17 @@ var infraPaths = map[string]bool{
 	"/openapi.json": true,
 }
 
+// isInfraPath reports whether path is a non-S3 endpoint: an infrastructure
+// endpoint, the API docs, or any route of the admin API.
+func isInfraPath(path string) bool {
+	return infraPaths[path] || strings.HasPrefix(path, "/docs") || adminPath(path)
+}
+
 // classifyS3Operation returns the S3 operation name for a request, or "" for
 // non-S3 infrastructure endpoints. Used for the s3_operations_total metric.
 func classifyS3Operation(r *http.Request) string {
-	path := r.URL.Path
-	if infraPaths[path] || strings.HasPrefix(path, "/docs") {
+	if isInfraPath(r.URL.Path) {
 		return ""
 	}
-
-	// Parse bucket and key from path.
-	trimmed := path
-	if len(trimmed) > 0 && trimmed[0] == '/' {
-		trimmed = trimmed[1:]
-	}
-
-	idx := strings.IndexByte(trimmed, '/')
-	bucket := trimmed
-	key := ""
-	if idx >= 0 {
-		bucket = trimmed[:idx]
-		key = trimmed[idx+1:]
-	}
-
-	q := r.URL.Query()
-
-	// Service-level (no bucket).
-	if bucket == "" {
-		if r.Method == http.MethodGet {
-			return "ListBuckets"
-		}
-		return "Unknown"
-	}
-
-	// Object-level (bucket + key).
-	if key != "" {
-		switch r.Method {
-		case http.MethodPut:
-			if q.Has("partNumber") && q.Has("uploadId") {
-				return "UploadPart"
-			}
-			if r.Header.Get("X-Amz-Copy-Source") != "" {
-				return "CopyObject"
-			}
-			if q.Has("acl") {
-				return "PutObjectAcl"
-			}
-			return "PutObject"
-		case http.MethodGet:
-			if q.Has("acl") {
-				return "GetObjectAcl"
-			}
-			if q.Has("uploadId") {
-				return "ListParts"
-			}
-			return "GetObject"
-		case http.MethodHead:
-			return "HeadObject"
-		case http.MethodDelete:
-			if q.Has("uploadId") {
-				return "AbortMultipartUpload"
-			}
-			return "DeleteObject"
-		case http.MethodPost:
-			if q.Has("uploadId") {
-				return "CompleteMultipartUpload"
-			}
-			if q.Has("uploads") {
-				return "CreateMultipartUpload"
-			}
-		}
-		return "Unknown"
-	}
-
-	// Bucket-level (bucket, no key).
-	switch r.Method {
-	case http.MethodPut:
-		if q.Has("acl") {
-			return "PutBucketAcl"
-		}
-		return "CreateBucket"
-	case http.MethodGet:
-		if q.Has("location") {
-			return "GetBucketLocation"
-		}
-		if q.Has("acl") {
-			return "GetBucketAcl"
-		}
-		if q.Has("uploads") {
-			return "ListMultipartUploads"
-		}
-		return "ListObjects"
-	case http.MethodHead:
-		return "HeadBucket"
-	case http.MethodDelete:
-		return "DeleteBucket"
-	case http.MethodPost:
-		if q.Has("delete") {
-			return "DeleteObjects"
-		}
-	}
-	return "Unknown"
+	return string(s3op.FromRequest(r))
 }
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// maxOrphansListed caps the files listed in an orphan collection report.
+const maxOrphansListed = 1000
+
+// orphanReport is the JSON body returned by POST /admin/orphans, and the
+// summary logged after each background pass.
+type orphanReport struct {
+	DryRun      bool                 `json:"dry_run"`
+	Quarantine  bool                 `json:"quarantine"`
+	Files       int64                `json:"files"`
+	Young       int64                `json:"young"`
+	Orphans     int64                `json:"orphans"`
+	OrphanBytes int64                `json:"orphan_bytes"`
+	Removed     int64                `json:"removed"`
+	Found       []storage.StoredFile `json:"found"`
+	Truncated   bool                 `json:"truncated"`
+}
+
+// orphanCollector finds object and part files that no metadata record
+// refers to, left behind when a write fails between storing its data and
+// committing its metadata, and deletes or quarantines them. Files younger
+// than minAge are left alone: their metadata may not be committed yet.
+type orphanCollector struct {
+	meta       metadata.MetadataStore
+	store      storage.OrphanSweeper
+	minAge     time.Duration
+	quarantine bool
+	dryRun     bool // default for passes, including background ones
+	interval   time.Duration
+	periodic   bool
+	gate       *writeGate // closed while writes are quiesced for a backup
+	jobs       *jobRegistry
+
+	mu sync.Mutex // one pass at a time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop if periodic passes are enabled.
+func (c *orphanCollector) start() {
+	if !c.periodic {
+		return
+	}
+	c.wg.Add(1)
+	go c.loop()
+}
+
+// stop terminates the background loop, cancelling a running pass.
+func (c *orphanCollector) stop() {
+	if !c.periodic {
+		return
+	}
+	close(c.stopCh)
+	c.wg.Wait()
+}
+
+// loop runs a pass every interval.
+func (c *orphanCollector) loop() {
+	defer c.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stopCh
+		cancel()
+	}()
+
+	tickC, stopTick := tick(c.interval)
+	defer stopTick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickC:
+			if !c.gate.enter() {
+				continue
+			}
+			start := time.Now()
+			jctx, j := c.jobs.begin(ctx, "orphans")
+			report, err := c.run(jctx, c.dryRun)
+			j.finish(report, err)
+			c.gate.leave()
+			if err != nil {
+				if ctx.Err() == nil && !j.wasCancelled() {
+					slog.Error("Orphan collection error", "error", err)
+				}
+				continue
+			}
+			if report.Orphans > 0 {
+				slog.Info("Orphan collection complete", "files", report.Files, "orphans", report.Orphans,
+					"orphan_bytes", report.OrphanBytes, "removed", report.Removed, "dry_run", report.DryRun,
+					"duration", time.Since(start))
+			}
+		}
+	}
+}
+
+// run walks every stored file and removes, or with dryRun only reports,
+// the orphans.
+func (c *orphanCollector) run(ctx context.Context, dryRun bool) (*orphanReport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	uploads, err := c.liveUploads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parts := map[string]map[int]bool{} // per live upload, loaded on first use
+	report := &orphanReport{DryRun: dryRun, Quarantine: c.quarantine, Found: []storage.StoredFile{}}
+	cutoff := time.Now().Add(-c.minAge)
+
+	err = c.store.WalkFiles(ctx, func(f storage.StoredFile) error {
+		report.Files++
+		progress.Report(ctx, report.Files, 0)
+		if f.ModTime.After(cutoff) {
+			report.Young++
+			return nil
+		}
+		orphan, err := c.isOrphan(ctx, f, uploads, parts)
+		if err != nil || !orphan {
+			return err
+		}
+
+		report.Orphans++
+		report.OrphanBytes += f.Size
+		metrics.OrphanFilesTotal.WithLabelValues("found").Inc()
+		metrics.OrphanBytesTotal.WithLabelValues("found").Add(float64(f.Size))
+		if len(report.Found) < maxOrphansListed {
+			report.Found = append(report.Found, f)
+		} else {
+			report.Truncated = true
+		}
+		if dryRun {
+			return nil
+		}
+
+		if err := c.store.RemoveFile(ctx, f, c.quarantine); err != nil {
+			if errors.Is(err, storage.ErrFileChanged) {
+				return nil
+			}
+			slog.Error("Orphan removal error", "bucket", f.Bucket, "key", f.Key, "name", f.Name,
+				"upload_id", f.UploadID, "error", err)
+			return nil
+		}
+		action := "removed"
+		if c.quarantine {
+			action = "quarantined"
+		}
+		report.Removed++
+		metrics.OrphanFilesTotal.WithLabelValues(action).Inc()
+		metrics.OrphanBytesTotal.WithLabelValues(action).Add(float64(f.Size))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// isOrphan reports whether no metadata record refers to f.
+func (c *orphanCollector) isOrphan(ctx context.Context, f storage.StoredFile, uploads map[string]bool, parts map[string]map[int]bool) (bool, error) {
+	if f.UploadID == "" {
+		if f.Key == "" {
+			return true, nil // a hashed file name whose key was never recorded
+		}
+		exists, err := c.meta.ObjectExists(ctx, f.Bucket, f.Key)
+		if err != nil {
+			return false, fmt.Errorf("checking %s/%s: %w", f.Bucket, f.Key, err)
+		}
+		return !exists, nil
+	}
+	if !uploads[f.UploadID] {
+		return true, nil
+	}
+	numbers, ok := parts[f.UploadID]
+	if !ok {
+		numbers = map[int]bool{}
+		opts := metadata.ListPartsOptions{MaxParts: 1000}
+		for {
+			page, err := c.meta.ListParts(ctx, f.UploadID, opts)
+			if err != nil {
+				return false, fmt.Errorf("listing parts of upload %s: %w", f.UploadID, err)
+			}
+			for _, p := range page.Parts {
+				numbers[p.PartNumber] = true
+			}
+			if !page.IsTruncated {
+				break
+			}
+			opts.PartNumberMarker = page.NextPartNumberMarker
+		}
+		parts[f.UploadID] = numbers
+	}
+	return !numbers[f.PartNumber], nil
+}
+
+// liveUploads returns the IDs of every multipart upload in progress.
+func (c *orphanCollector) liveUploads(ctx context.Context) (map[string]bool, error) {
+	en, ok := c.meta.(metadata.Enumerator)
+	if !ok {
+		return nil, errors.New("metadata store cannot list all buckets")
+	}
+	buckets, err := en.ListAllBuckets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing buckets: %w", err)
+	}
+	ids := map[string]bool{}
+	for _, b := range buckets {
+		opts := metadata.ListUploadsOptions{MaxUploads: 1000}
+		for {
+			page, err := c.meta.ListMultipartUploads(ctx, b.Name, opts)
+			if err != nil {
+				return nil, fmt.Errorf("listing uploads of %s: %w", b.Name, err)
+			}
+			for _, u := range page.Uploads {
+				ids[u.UploadID] = true
+			}
+			if !page.IsTruncated {
+				break
+			}
+			opts.KeyMarker, opts.UploadIDMarker = page.NextKeyMarker, page.NextUploadIDMarker
+		}
+	}
+	return ids, nil
+}
+
+// handleOrphans serves POST /admin/orphans, which runs an orphan
+// collection pass and returns a report. "dry-run" overrides the configured
+// dry_run setting. It blocks until done and waits for a running background
+// pass, or with "async=true" runs as a background job.
+func (s *Server) handleOrphans(w http.ResponseWriter, r *http.Request) {
+	if s.orphans == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	dryRun := s.orphans.dryRun
+	if v := r.URL.Query().Get("dry-run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		dryRun = b
+	}
+
+	s.runJob(w, r, "orphans", func(ctx context.Context) (any, error) {
+		return s.orphans.run(ctx, dryRun)
+	})
+}
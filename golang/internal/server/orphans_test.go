@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOrphanCollector(t *testing.T) {
+	dir := t.TempDir()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	root := filepath.Join(dir, "objects")
+	store, err := storage.NewLocalBackend(root)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	ctx := context.Background()
+	meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "b", OwnerID: "o"})
+	store.CreateBucket(ctx, "b")
+
+	put := func(key string) {
+		if _, _, err := store.PutObject(ctx, "b", key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+	put("kept")
+	meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "b", Key: "kept", Size: 4, LastModified: time.Now()})
+	put("lost/orphan")
+	uploadID, err := meta.CreateMultipartUpload(ctx, &metadata.MultipartUploadRecord{Bucket: "b", Key: "mp", InitiatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	store.PutPart(ctx, "b", "mp", uploadID, 1, strings.NewReader("one"), 3)
+	meta.PutPart(ctx, &metadata.PartRecord{UploadID: uploadID, PartNumber: 1, Size: 3, LastModified: time.Now()})
+	store.PutPart(ctx, "b", "mp", uploadID, 2, strings.NewReader("two"), 3)
+	store.PutPart(ctx, "b", "gone", "finished-upload", 1, strings.NewReader("old"), 3)
+
+	// Age every file past the grace period, then write one more orphan.
+	old := time.Now().Add(-2 * time.Hour)
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			os.Chtimes(path, old, old)
+		}
+		return nil
+	})
+	put("fresh")
+
+	c := &orphanCollector{meta: meta, store: store, minAge: time.Hour, stopCh: make(chan struct{})}
+	report, err := c.run(ctx, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	found := map[string]bool{}
+	for _, f := range report.Found {
+		if f.UploadID != "" {
+			found[f.UploadID+"#"+strconv.Itoa(f.PartNumber)] = true
+		} else {
+			found[f.Bucket+"/"+f.Key] = true
+		}
+	}
+	want := []string{"b/lost/orphan", uploadID + "#2", "finished-upload#1"}
+	if report.Files != 6 || report.Young != 1 || report.Orphans != 3 || report.Removed != 0 || len(found) != 3 {
+		t.Fatalf("dry run report = %+v", report)
+	}
+	for _, w := range want {
+		if !found[w] {
+			t.Errorf("dry run did not find %s", w)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "b", "lost", "orphan")); err != nil {
+		t.Errorf("dry run removed a file: %v", err)
+	}
+
+	removedBefore := testutil.ToFloat64(metrics.OrphanFilesTotal.WithLabelValues("removed"))
+	if report, err = c.run(ctx, false); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Removed != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	if got := testutil.ToFloat64(metrics.OrphanFilesTotal.WithLabelValues("removed")); got != removedBefore+3 {
+		t.Errorf("removed counter rose by %v, want 3", got-removedBefore)
+	}
+	for _, p := range []string{"b/kept", "b/fresh", ".multipart/" + uploadID + "/1"} {
+		if _, err := os.Stat(filepath.Join(root, p)); err != nil {
+			t.Errorf("%s was removed: %v", p, err)
+		}
+	}
+	for _, p := range []string{"b/lost", ".multipart/" + uploadID + "/2", ".multipart/finished-upload"} {
+		if _, err := os.Stat(filepath.Join(root, p)); !os.IsNotExist(err) {
+			t.Errorf("%s still exists: %v", p, err)
+		}
+	}
+}
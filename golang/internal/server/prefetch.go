@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// prefetchJob is one object named in an x-bleepstore-prefetch hint.
+type prefetchJob struct {
+	bucket, key string
+}
+
+// prefetcher warms objects that clients expect to read next, using a fixed
+// pool of workers fed by a bounded queue. Hints are best effort: when the
+// queue is full they are dropped rather than delaying the GET that carried
+// them.
+type prefetcher struct {
+	store   storage.Preloader
+	workers int
+	jobs    chan prefetchJob
+
+	mu     sync.Mutex
+	queued map[prefetchJob]bool // queued or being read, to skip duplicate hints
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newPrefetcher(store storage.Preloader, workers, queueSize int) *prefetcher {
+	return &prefetcher{
+		store:   store,
+		workers: workers,
+		jobs:    make(chan prefetchJob, queueSize),
+		queued:  make(map[prefetchJob]bool),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// start launches the workers.
+func (p *prefetcher) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-p.stopCh
+		cancel()
+	}()
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+}
+
+// stop terminates the workers, cancelling reads in progress. Queued hints
+// are discarded.
+func (p *prefetcher) stop() {
+	close(p.stopCh)
+	p.wg.Wait()
+}
+
+// enqueue queues keys in bucket for warming without blocking. It returns
+// the number of keys accepted.
+func (p *prefetcher) enqueue(bucket string, keys []string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	accepted := 0
+	for _, key := range keys {
+		job := prefetchJob{bucket, key}
+		if p.queued[job] {
+			continue
+		}
+		select {
+		case p.jobs <- job:
+			p.queued[job] = true
+			accepted++
+		default:
+			return accepted
+		}
+	}
+	return accepted
+}
+
+// work reads queued objects through the storage backend until ctx is done.
+func (p *prefetcher) work(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-p.jobs:
+			if _, err := p.store.PreloadObject(ctx, job.bucket, job.key); err != nil && ctx.Err() == nil {
+				// Hints may name keys that do not exist yet; this is
+				// not worth more than a debug line.
+				slog.Debug("Prefetch error", "bucket", job.bucket, "key", job.key, "error", err)
+			}
+			p.mu.Lock()
+			delete(p.queued, job)
+			p.mu.Unlock()
+		}
+	}
+}
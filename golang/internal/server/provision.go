@@ -0,0 +1,482 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/handlers"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// maxManifestSize caps the body of POST /admin/provision.
+const maxManifestSize = 16 << 20
+
+// Idempotency keys of applied manifests are remembered for
+// idempotencyKeyTTL, up to maxIdempotencyKeys at a time.
+const (
+	idempotencyKeyTTL  = 24 * time.Hour
+	maxIdempotencyKeys = 1000
+)
+
+// Provisioning actions reported per manifest entry.
+const (
+	provisionCreate    = "create"
+	provisionUpdate    = "update"
+	provisionUnchanged = "unchanged"
+)
+
+// provisionManifest declares buckets, seed objects and credentials. It is
+// the body of POST /admin/provision; the provision config section is
+// converted to one at startup.
+type provisionManifest struct {
+	Buckets     []manifestBucket     `json:"buckets"`
+	Credentials []manifestCredential `json:"credentials"`
+}
+
+// manifestBucket is created with its ACL if missing. Its objects are
+// written if missing.
+type manifestBucket struct {
+	Name    string           `json:"name"`
+	ACL     string           `json:"acl"`
+	Objects []manifestObject `json:"objects"`
+}
+
+type manifestObject struct {
+	Key         string            `json:"key"`
+	Content     string            `json:"content"`
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata"`
+	ACL         string            `json:"acl"`
+
+	file string // body file; only settable from the config file
+}
+
+// manifestCredential is created if missing and updated to match otherwise.
+// OwnerID and DisplayName default to the access key ID, Active to true.
+type manifestCredential struct {
+	AccessKeyID string `json:"access_key_id"`
+	SecretKey   string `json:"secret_key"`
+	OwnerID     string `json:"owner_id"`
+	DisplayName string `json:"display_name"`
+	Active      *bool  `json:"active"`
+}
+
+// provisionChange is the action taken, or planned, for one manifest entry.
+// Secrets never appear in it; an updated secret is listed in Fields only.
+type provisionChange struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// provisionResult is the JSON body returned by POST /admin/provision.
+type provisionResult struct {
+	Mode    string            `json:"mode"`
+	Changes []provisionChange `json:"changes"`
+}
+
+// provisionRequestError is a manifest entry rejected by an S3 operation
+// handler.
+type provisionRequestError struct {
+	what string
+	res  *probeResponse
+}
+
+func (e *provisionRequestError) Error() string {
+	return fmt.Sprintf("%s: status %d: %s", e.what, e.res.code, e.res.body.String())
+}
+
+// manifestFromConfig converts the provision config section.
+func manifestFromConfig(cfg config.ProvisionConfig) *provisionManifest {
+	m := &provisionManifest{}
+	for _, b := range cfg.Buckets {
+		mb := manifestBucket{Name: b.Name, ACL: b.ACL}
+		for _, o := range b.Objects {
+			mb.Objects = append(mb.Objects, manifestObject{Key: o.Key, Content: o.Content, ContentType: o.ContentType,
+				Metadata: o.Metadata, ACL: o.ACL, file: o.File})
+		}
+		m.Buckets = append(m.Buckets, mb)
+	}
+	return m
+}
+
+// provision creates the buckets and objects declared in the provision
+// config that do not exist yet. Existing buckets and objects are left
+// alone, so changes made through the API survive restarts.
+func (s *Server) provision(ctx context.Context) error {
+	if len(s.cfg.Provision.Buckets) == 0 {
+		return nil
+	}
+	if s.readOnly {
+		slog.Info("Skipping provisioning on read-only replica")
+		return nil
+	}
+	if s.ha != nil && !s.ha.isLeader() {
+		slog.Info("Skipping provisioning on HA standby")
+		return nil
+	}
+	m := manifestFromConfig(s.cfg.Provision)
+	if err := m.validate(); err != nil {
+		return err
+	}
+	changes, err := s.runProvision(ctx, m, true)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if c.Action != provisionUnchanged {
+			slog.Info("Provisioned "+c.Kind, "name", c.Name)
+		}
+	}
+	return nil
+}
+
+// runProvision compares m with the server's state and, if apply is set,
+// makes the changes. Buckets and objects go through the S3 operation
+// handlers, bypassing disabled operations, as the configured owner.
+func (s *Server) runProvision(ctx context.Context, m *provisionManifest, apply bool) ([]provisionChange, error) {
+	s.provisionMu.Lock()
+	defer s.provisionMu.Unlock()
+
+	changes := []provisionChange{}
+	for _, c := range m.Credentials {
+		change, err := s.provisionCredential(ctx, c, apply)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	for _, b := range m.Buckets {
+		existing, err := s.meta.GetBucket(ctx, b.Name)
+		if err != nil {
+			return nil, fmt.Errorf("checking bucket %s: %w", b.Name, err)
+		}
+		change := provisionChange{Kind: "bucket", Name: b.Name, Action: provisionUnchanged}
+		if existing == nil {
+			change.Action = provisionCreate
+		}
+		if apply && existing == nil {
+			header := make(http.Header)
+			if b.ACL != "" {
+				header.Set("x-amz-acl", b.ACL)
+			}
+			res := s.provisionRequest(ctx, http.MethodPut, "/"+b.Name, header, nil)
+			if res.code != http.StatusOK {
+				return nil, &provisionRequestError{what: "creating bucket " + b.Name, res: res}
+			}
+		}
+		changes = append(changes, change)
+
+		for _, o := range b.Objects {
+			change, err := s.provisionObject(ctx, b.Name, o, apply)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// provisionObject writes o into bucket unless an object with its key
+// exists.
+func (s *Server) provisionObject(ctx context.Context, bucket string, o manifestObject, apply bool) (provisionChange, error) {
+	change := provisionChange{Kind: "object", Name: bucket + "/" + o.Key, Action: provisionUnchanged}
+	exists, err := s.meta.ObjectExists(ctx, bucket, o.Key)
+	if err != nil {
+		return change, fmt.Errorf("checking object %s: %w", change.Name, err)
+	}
+	if exists {
+		return change, nil
+	}
+	change.Action = provisionCreate
+	if !apply {
+		return change, nil
+	}
+
+	body := []byte(o.Content)
+	if o.file != "" {
+		if body, err = os.ReadFile(o.file); err != nil {
+			return change, fmt.Errorf("reading object %s: %w", change.Name, err)
+		}
+	}
+	header := make(http.Header)
+	if o.ContentType != "" {
+		header.Set("Content-Type", o.ContentType)
+	}
+	if o.ACL != "" {
+		header.Set("x-amz-acl", o.ACL)
+	}
+	for k, v := range o.Metadata {
+		header.Set("x-amz-meta-"+k, v)
+	}
+	res := s.provisionRequest(ctx, http.MethodPut, "/"+bucket+"/"+(&url.URL{Path: o.Key}).EscapedPath(), header, body)
+	if res.code != http.StatusOK {
+		return change, &provisionRequestError{what: "writing object " + change.Name, res: res}
+	}
+	return change, nil
+}
+
+// provisionCredential creates c, or updates the stored credential to match
+// it. Signature checks pick up an update once the verifier's credential
+// cache entry expires.
+func (s *Server) provisionCredential(ctx context.Context, c manifestCredential, apply bool) (provisionChange, error) {
+	change := provisionChange{Kind: "credential", Name: c.AccessKeyID, Action: provisionUnchanged}
+	want := metadata.CredentialRecord{AccessKeyID: c.AccessKeyID, SecretKey: c.SecretKey,
+		OwnerID: c.OwnerID, DisplayName: c.DisplayName, Active: c.Active == nil || *c.Active}
+	if want.OwnerID == "" {
+		want.OwnerID = c.AccessKeyID
+	}
+	if want.DisplayName == "" {
+		want.DisplayName = c.AccessKeyID
+	}
+
+	cur, err := s.meta.GetCredential(ctx, c.AccessKeyID)
+	if err != nil {
+		return change, fmt.Errorf("checking credential %s: %w", c.AccessKeyID, err)
+	}
+	if cur == nil {
+		change.Action = provisionCreate
+		want.CreatedAt = s.clock.Now().UTC()
+	} else {
+		curSecret, err := s.secrets.Open(c.AccessKeyID, cur.SecretKey)
+		if err != nil {
+			return change, err
+		}
+		// Plaintext rows are rewritten sealed once there is a master key.
+		if curSecret != want.SecretKey || (s.secrets != nil && !metadata.IsSealedSecret(cur.SecretKey)) {
+			change.Fields = append(change.Fields, "secret_key")
+		}
+		if cur.OwnerID != want.OwnerID {
+			change.Fields = append(change.Fields, "owner_id")
+		}
+		if cur.DisplayName != want.DisplayName {
+			change.Fields = append(change.Fields, "display_name")
+		}
+		if cur.Active != want.Active {
+			change.Fields = append(change.Fields, "active")
+		}
+		if len(change.Fields) == 0 {
+			return change, nil
+		}
+		change.Action = provisionUpdate
+		want.CreatedAt = cur.CreatedAt
+	}
+	if apply {
+		if want.SecretKey, err = s.secrets.Seal(c.AccessKeyID, want.SecretKey); err != nil {
+			return change, err
+		}
+		if err := s.meta.PutCredential(ctx, &want); err != nil {
+			return change, fmt.Errorf("writing credential %s: %w", c.AccessKeyID, err)
+		}
+	}
+	return change, nil
+}
+
+// validate checks the fields the S3 handlers do not.
+func (m *provisionManifest) validate() error {
+	for _, c := range m.Credentials {
+		if c.AccessKeyID == "" || c.SecretKey == "" {
+			return errors.New("credentials need access_key_id and secret_key")
+		}
+	}
+	for _, b := range m.Buckets {
+		for _, o := range b.Objects {
+			if o.Key == "" {
+				return fmt.Errorf("object in bucket %q has no key", b.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// provisionRequest calls the S3 operation handler for a request, like
+// probeRequest but with headers and without the operation checks of
+// dispatch.
+func (s *Server) provisionRequest(ctx context.Context, method, target string, header http.Header, body []byte) *probeResponse {
+	req, _ := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body == nil {
+		req.Body = http.NoBody
+	} else {
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	res := &probeResponse{header: make(http.Header)}
+	rc := handlers.ParseRequest(res, req)
+	handler, ok := s.operations[rc.Operation]
+	if !ok {
+		res.code = http.StatusNotImplemented
+		fmt.Fprintf(&res.body, "no handler for %s", rc.Operation)
+		return res
+	}
+	handler(res, handlers.WithRequestContext(req, rc))
+	if res.code == 0 {
+		res.code = http.StatusOK
+	}
+	return res
+}
+
+// idempotencyKeys remembers the responses to applied manifests by the
+// client's Idempotency-Key, so a retried apply returns the first result
+// instead of a plan of no changes.
+type idempotencyKeys struct {
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	digest    [sha256.Size]byte // manifest the key was first used with
+	body      []byte
+	expiresAt time.Time
+}
+
+// get returns the stored response for key. ok is false if key is unknown;
+// mismatch is true if key was used with a different manifest.
+func (k *idempotencyKeys) get(key string, digest [sha256.Size]byte, now time.Time) (body []byte, ok, mismatch bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	e, found := k.entries[key]
+	if !found || !now.Before(e.expiresAt) {
+		return nil, false, false
+	}
+	if e.digest != digest {
+		return nil, false, true
+	}
+	return e.body, true, false
+}
+
+// put stores the response for key.
+func (k *idempotencyKeys) put(key string, digest [sha256.Size]byte, body []byte, now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.entries == nil {
+		k.entries = make(map[string]idempotencyEntry)
+	}
+	if len(k.entries) >= maxIdempotencyKeys {
+		maps.DeleteFunc(k.entries, func(_ string, e idempotencyEntry) bool { return !now.Before(e.expiresAt) })
+	}
+	if len(k.entries) >= maxIdempotencyKeys {
+		k.entries = make(map[string]idempotencyEntry)
+	}
+	k.entries[key] = idempotencyEntry{digest: digest, body: body, expiresAt: now.Add(idempotencyKeyTTL)}
+}
+
+// handleProvision serves POST /admin/provision, which takes a JSON
+// manifest of buckets, seed objects and credentials. With "mode=diff" (the
+// default) it returns the changes applying the manifest would make; with
+// "mode=apply" it makes them. An apply carrying an Idempotency-Key header
+// already used in the last 24 hours returns the first response again.
+func (s *Server) handleProvision(w http.ResponseWriter, r *http.Request) {
+	if s.meta == nil || s.store == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "diff"
+	}
+	if mode != "diff" && mode != "apply" {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+		return
+	}
+	apply := mode == "apply"
+	if apply && s.readOnly {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrIncompleteBody)
+		return
+	}
+	if len(raw) > maxManifestSize {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrEntityTooLarge)
+		return
+	}
+	var m provisionManifest
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&m); err == nil {
+		err = m.validate()
+	}
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, invalidManifest(err))
+		return
+	}
+
+	idemKey := r.Header.Get("Idempotency-Key")
+	digest := sha256.Sum256(raw)
+	if apply && idemKey != "" {
+		body, ok, mismatch := s.idempotency.get(idemKey, digest, s.clock.Now())
+		if mismatch {
+			xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+				Code:       "IdempotencyKeyMismatch",
+				Message:    "The Idempotency-Key was already used with a different manifest.",
+				HTTPStatus: http.StatusConflict,
+			})
+			return
+		}
+		if ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.Write(body)
+			return
+		}
+	}
+
+	if apply {
+		if !s.writes.enter() {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrServiceUnavailable)
+			return
+		}
+		defer s.writes.leave()
+	}
+	changes, err := s.runProvision(r.Context(), &m, apply)
+	if err != nil {
+		var reqErr *provisionRequestError
+		if errors.As(err, &reqErr) && reqErr.res.code < 500 {
+			xmlutil.WriteErrorResponse(w, r, invalidManifest(err))
+			return
+		}
+		slog.Error("Provision error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+	body, _ := json.Marshal(provisionResult{Mode: mode, Changes: changes})
+	body = append(body, '\n')
+	if apply && idemKey != "" {
+		s.idempotency.put(idemKey, digest, body, s.clock.Now())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// invalidManifest returns the error response for a rejected manifest.
+func invalidManifest(err error) *s3err.S3Error {
+	return &s3err.S3Error{
+		Code:       "InvalidArgument",
+		Message:    "Invalid provisioning manifest: " + err.Error(),
+		HTTPStatus: http.StatusBadRequest,
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+func TestProvision(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	file := filepath.Join(t.TempDir(), "seed.json")
+	os.WriteFile(file, []byte(`{"seeded":true}`), 0o644)
+	srv.cfg.Provision = config.ProvisionConfig{Buckets: []config.ProvisionBucketConfig{
+		{Name: "fixtures", ACL: "public-read", Objects: []config.ProvisionObjectConfig{
+			{Key: "hello.txt", Content: "hello", ContentType: "text/plain", Metadata: map[string]string{"origin": "config"}},
+			{Key: "dir/seed file.json", File: file},
+		}},
+		{Name: "empty"},
+	}}
+
+	ctx := context.Background()
+	if err := srv.provision(ctx); err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+	for _, name := range []string{"fixtures", "empty"} {
+		if b, err := srv.meta.GetBucket(ctx, name); err != nil || b == nil {
+			t.Fatalf("GetBucket(%s) = %v, %v", name, b, err)
+		}
+	}
+	obj, err := srv.meta.GetObject(ctx, "fixtures", "hello.txt")
+	if err != nil || obj == nil {
+		t.Fatalf("GetObject = %v, %v", obj, err)
+	}
+	if obj.ContentType != "text/plain" || obj.UserMetadata["origin"] != "config" {
+		t.Errorf("object = %+v", obj)
+	}
+	rc, _, _, err := srv.store.GetObject(ctx, "fixtures", "dir/seed file.json")
+	if err != nil {
+		t.Fatalf("GetObject data: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != `{"seeded":true}` {
+		t.Errorf("seeded file data = %q", data)
+	}
+
+	// A second run leaves objects changed since the first alone.
+	res := srv.probeRequest(ctx, "PUT", "/fixtures/hello.txt", []byte("changed"))
+	if res.code != 200 {
+		t.Fatalf("overwrite status %d: %s", res.code, res.body.String())
+	}
+	if err := srv.provision(ctx); err != nil {
+		t.Fatalf("second provision: %v", err)
+	}
+	if res := srv.probeRequest(ctx, "GET", "/fixtures/hello.txt", nil); res.body.String() != "changed" {
+		t.Errorf("after second run object = %q, want it left alone", res.body.String())
+	}
+}
+
+func TestProvisionInvalidBucket(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.cfg.Provision.Buckets = []config.ProvisionBucketConfig{{Name: "Bad_Name"}}
+	if err := srv.provision(context.Background()); err == nil {
+		t.Fatal("provision accepted an invalid bucket name")
+	}
+}
+
+// provisionAPIRequest posts a manifest to /admin/provision.
+func provisionAPIRequest(srv *Server, mode, idemKey, manifest string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/admin/provision?mode="+mode, strings.NewReader(manifest))
+	if idemKey != "" {
+		req.Header.Set("Idempotency-Key", idemKey)
+	}
+	rec := httptest.NewRecorder()
+	commonHeaders(srv.clock, srv.ids)(asRoot(srv)).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProvisionAPI(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	ctx := context.Background()
+	manifest := `{"buckets":[{"name":"team-a","objects":[{"key":"README","content":"hi"}]}],
+		"credentials":[{"access_key_id":"team-a-key","secret_key":"s3cret"}]}`
+
+	changes := func(rec *httptest.ResponseRecorder) map[string]string {
+		t.Helper()
+		if rec.Code != 200 {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		var res provisionResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+		}
+		got := map[string]string{}
+		for _, c := range res.Changes {
+			got[c.Kind+":"+c.Name] = c.Action + strings.Join(c.Fields, ",")
+		}
+		return got
+	}
+
+	// A diff changes nothing.
+	want := map[string]string{"bucket:team-a": "create", "object:team-a/README": "create", "credential:team-a-key": "create"}
+	if got := changes(provisionAPIRequest(srv, "diff", "", manifest)); !maps.Equal(got, want) {
+		t.Errorf("diff = %v, want %v", got, want)
+	}
+	if b, _ := srv.meta.GetBucket(ctx, "team-a"); b != nil {
+		t.Fatal("diff created the bucket")
+	}
+
+	first := provisionAPIRequest(srv, "apply", "k1", manifest)
+	if got := changes(first); !maps.Equal(got, want) {
+		t.Errorf("apply = %v, want %v", got, want)
+	}
+	cred, err := srv.meta.GetCredential(ctx, "team-a-key")
+	if err != nil || cred == nil || cred.SecretKey != "s3cret" || !cred.Active {
+		t.Fatalf("credential = %+v, %v", cred, err)
+	}
+	if strings.Contains(first.Body.String(), "s3cret") {
+		t.Error("response contains the secret key")
+	}
+
+	// Retrying with the same key replays the first response.
+	replay := provisionAPIRequest(srv, "apply", "k1", manifest)
+	if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay = %q, %s", replay.Header().Get("Idempotent-Replayed"), replay.Body.String())
+	}
+	if rec := provisionAPIRequest(srv, "apply", "k1", `{"buckets":[{"name":"other"}]}`); rec.Code != 409 {
+		t.Errorf("reused key with another manifest: status %d, want 409", rec.Code)
+	}
+
+	// A new apply converges the credential and leaves the rest alone.
+	updated := strings.Replace(manifest, `"secret_key":"s3cret"`, `"secret_key":"rotated","active":false`, 1)
+	want = map[string]string{"bucket:team-a": "unchanged", "object:team-a/README": "unchanged",
+		"credential:team-a-key": "updatesecret_key,active"}
+	if got := changes(provisionAPIRequest(srv, "apply", "k2", updated)); !maps.Equal(got, want) {
+		t.Errorf("second apply = %v, want %v", got, want)
+	}
+	if cred, _ := srv.meta.GetCredential(ctx, "team-a-key"); cred.SecretKey != "rotated" || cred.Active {
+		t.Errorf("credential after update = %+v", cred)
+	}
+
+	// With a master key, the plaintext secret is rewritten sealed once and
+	// then left alone.
+	srv.secrets, _ = metadata.NewSecretSealer("master")
+	want = map[string]string{"bucket:team-a": "unchanged", "object:team-a/README": "unchanged",
+		"credential:team-a-key": "updatesecret_key"}
+	if got := changes(provisionAPIRequest(srv, "apply", "k3", updated)); !maps.Equal(got, want) {
+		t.Errorf("apply with master key = %v, want %v", got, want)
+	}
+	cred, _ = srv.meta.GetCredential(ctx, "team-a-key")
+	if secret, err := srv.secrets.Open("team-a-key", cred.SecretKey); !metadata.IsSealedSecret(cred.SecretKey) || err != nil || secret != "rotated" {
+		t.Errorf("sealed credential = %q, opens to %q, %v", cred.SecretKey, secret, err)
+	}
+	want["credential:team-a-key"] = "unchanged"
+	if got := changes(provisionAPIRequest(srv, "apply", "k4", updated)); !maps.Equal(got, want) {
+		t.Errorf("reapply with master key = %v, want %v", got, want)
+	}
+}
+
+func TestProvisionAPIRejectsBadManifests(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	for name, manifest := range map[string]string{
+		"policies":     `{"policies":[{"bucket":"b"}]}`,
+		"file":         `{"buckets":[{"name":"b","objects":[{"key":"k","file":"/etc/passwd"}]}]}`,
+		"no secret":    `{"credentials":[{"access_key_id":"k"}]}`,
+		"bucket name":  `{"buckets":[{"name":"Bad_Name"}]}`,
+		"invalid json": `{`,
+	} {
+		if rec := provisionAPIRequest(srv, "apply", "", manifest); rec.Code != 400 {
+			t.Errorf("%s: status %d, want 400: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := provisionAPIRequest(srv, "sync", "", `{}`); rec.Code != 400 {
+		t.Errorf("unknown mode: status %d, want 400", rec.Code)
+	}
+}
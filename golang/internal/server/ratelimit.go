@@ -0,0 +1,210 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/config"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// maxLimiterEntries bounds the number of per-IP or per-key buckets kept in
+// memory. When exceeded, buckets that have refilled completely are dropped.
+const maxLimiterEntries = 10000
+
+// tokenBucket is a classic token bucket. It is not safe for concurrent use;
+// callers hold the owning rateLimiter's mutex.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket for the elapsed time and tries to consume one
+// token. When no token is available it returns the wait until one is.
+func (b *tokenBucket) take(now time.Time, rule config.RateLimitRule) (bool, time.Duration) {
+	burst := ruleBurst(rule)
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rule.RequestsPerSecond)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / rule.RequestsPerSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// full reports whether the bucket would be at capacity at time now.
+func (b *tokenBucket) full(now time.Time, rule config.RateLimitRule) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rule.RequestsPerSecond >= ruleBurst(rule)
+}
+
+// ruleBurst returns the bucket capacity for a rule, defaulting to one
+// second's worth of requests (at least one).
+func ruleBurst(rule config.RateLimitRule) float64 {
+	if rule.Burst > 0 {
+		return float64(rule.Burst)
+	}
+	return math.Max(1, rule.RequestsPerSecond)
+}
+
+// limiterScope holds the buckets for one scope (global, per-IP, per-key).
+type limiterScope struct {
+	name    string // as in metadata.RateLimitState.Scope
+	rule    config.RateLimitRule
+	buckets map[string]*tokenBucket
+}
+
+// allow consumes a token for id, creating a full bucket on first use.
+func (sc *limiterScope) allow(now time.Time, id string) (bool, time.Duration) {
+	if sc.rule.RequestsPerSecond <= 0 {
+		return true, 0
+	}
+	b, ok := sc.buckets[id]
+	if !ok {
+		if len(sc.buckets) >= maxLimiterEntries {
+			sc.prune(now)
+		}
+		b = &tokenBucket{tokens: ruleBurst(sc.rule), last: now}
+		sc.buckets[id] = b
+	}
+	return b.take(now, sc.rule)
+}
+
+// prune drops buckets that have fully refilled; they carry no state.
+func (sc *limiterScope) prune(now time.Time) {
+	for id, b := range sc.buckets {
+		if b.full(now, sc.rule) {
+			delete(sc.buckets, id)
+		}
+	}
+}
+
+// rateLimiter enforces global, per-IP and per-access-key token buckets.
+// Limits can be replaced at runtime with update.
+type rateLimiter struct {
+	mu      sync.Mutex
+	enabled bool
+	global  limiterScope
+	perIP   limiterScope
+	perKey  limiterScope
+	now     func() time.Time
+}
+
+// newRateLimiter creates a rate limiter from the given configuration.
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	rl := &rateLimiter{now: time.Now}
+	rl.global.name, rl.perIP.name, rl.perKey.name = "global", "per_ip", "per_access_key"
+	rl.update(cfg)
+	return rl
+}
+
+// scopes returns the limiter's scopes, global first.
+func (rl *rateLimiter) scopes() []*limiterScope {
+	return []*limiterScope{&rl.global, &rl.perIP, &rl.perKey}
+}
+
+// update replaces the configured limits. Existing bucket state is kept so
+// a reload does not hand every client a fresh burst.
+func (rl *rateLimiter) update(cfg config.RateLimitConfig) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.enabled = cfg.Enabled
+	rl.global.rule = cfg.Global
+	rl.perIP.rule = cfg.PerIP
+	rl.perKey.rule = cfg.PerAccessKey
+	for _, sc := range rl.scopes() {
+		if sc.buckets == nil {
+			sc.buckets = make(map[string]*tokenBucket)
+		}
+	}
+}
+
+// allowClient checks the global and per-IP limits.
+func (rl *rateLimiter) allowClient(ip string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if !rl.enabled {
+		return true, 0
+	}
+	now := rl.now()
+	if ok, wait := rl.global.allow(now, ""); !ok {
+		return false, wait
+	}
+	return rl.perIP.allow(now, ip)
+}
+
+// allowAccessKey checks the per-access-key limit.
+func (rl *rateLimiter) allowAccessKey(accessKey string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if !rl.enabled || accessKey == "" {
+		return true, 0
+	}
+	return rl.perKey.allow(rl.now(), accessKey)
+}
+
+// writeSlowDown writes a 503 SlowDown error with a Retry-After header.
+func writeSlowDown(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	xmlutil.WriteErrorResponse(w, r, s3err.ErrSlowDown)
+}
+
+// isRateLimitExempt reports whether a path bypasses rate limiting. Health
+// probes must keep answering under load.
+func isRateLimitExempt(path string) bool {
+	return path == "/health" || path == "/healthz" || path == "/readyz" || path == "/metrics" ||
+		strings.HasPrefix(path, "/docs")
+}
+
+// clientIP returns the host portion of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientRateLimitMiddleware enforces the global and per-IP limits. It runs
+// before authentication so floods are rejected before signature checks.
+func clientRateLimitMiddleware(rl *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isRateLimitExempt(r.URL.Path) {
+				if ok, wait := rl.allowClient(clientIP(r)); !ok {
+					writeSlowDown(w, r, wait)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// accessKeyRateLimitMiddleware enforces the per-access-key limit. It must
+// run inside the auth middleware so the access key is on the context.
+func accessKeyRateLimitMiddleware(rl *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := rl.allowAccessKey(auth.AccessKeyFromContext(r.Context())); !ok {
+				writeSlowDown(w, r, wait)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+// snapshot returns the balance of every bucket that is not full, in the
+// scopes that are limited. Full buckets carry no state.
+func (rl *rateLimiter) snapshot() []metadata.RateLimitState {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	var states []metadata.RateLimitState
+	for _, sc := range rl.scopes() {
+		if sc.rule.RequestsPerSecond <= 0 {
+			continue
+		}
+		for id, b := range sc.buckets {
+			if !b.full(now, sc.rule) {
+				states = append(states, metadata.RateLimitState{Scope: sc.name, ID: id, Tokens: b.tokens, Updated: b.last})
+			}
+		}
+	}
+	return states
+}
+
+// restore installs saved balances, replacing the buckets they name. Balances
+// for scopes that are no longer limited are dropped, and balances above the
+// current burst are capped to it.
+func (rl *rateLimiter) restore(states []metadata.RateLimitState) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for _, st := range states {
+		i := slices.IndexFunc(rl.scopes(), func(sc *limiterScope) bool { return sc.name == st.Scope })
+		if i < 0 {
+			continue
+		}
+		sc := rl.scopes()[i]
+		if sc.rule.RequestsPerSecond <= 0 || len(sc.buckets) >= maxLimiterEntries {
+			continue
+		}
+		sc.buckets[st.ID] = &tokenBucket{tokens: math.Min(st.Tokens, ruleBurst(sc.rule)), last: st.Updated}
+	}
+}
+
+// rateLimitPersister periodically saves the rate limiter's balances to a
+// metadata.RateLimitStateStore, and once more on shutdown.
+type rateLimitPersister struct {
+	limiter  *rateLimiter
+	store    metadata.RateLimitStateStore
+	interval time.Duration
+	gate     *writeGate // closed while writes are quiesced for a backup
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newRateLimitPersister creates a persister saving limiter to store every
+// interval, after restoring the balances saved last.
+func newRateLimitPersister(limiter *rateLimiter, store metadata.RateLimitStateStore, interval time.Duration) (*rateLimitPersister, error) {
+	states, err := store.LoadRateLimitState(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	limiter.restore(states)
+	return &rateLimitPersister{
+		limiter:  limiter,
+		store:    store,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+// save writes the current balances to the store.
+func (p *rateLimitPersister) save(ctx context.Context) error {
+	return p.store.SaveRateLimitState(ctx, p.limiter.snapshot())
+}
+
+// start launches the background save loop.
+func (p *rateLimitPersister) start() {
+	p.wg.Add(1)
+	go p.saveLoop()
+}
+
+// stop terminates the save loop and saves the final balances.
+func (p *rateLimitPersister) stop(ctx context.Context) error {
+	close(p.stopCh)
+	p.wg.Wait()
+	return p.save(ctx)
+}
+
+// saveLoop periodically saves balances until stop is called.
+func (p *rateLimitPersister) saveLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ticker.C:
+			if !p.gate.enterAny() {
+				continue
+			}
+			if err := p.save(context.Background()); err != nil {
+				slog.Error("Rate limit state save error", "error", err)
+			}
+			p.gate.leave()
+		}
+	}
+}
+
+// rateLimitClient is the JSON form of one client's token bucket.
+type rateLimitClient struct {
+	ID     string  `json:"id"`
+	Tokens float64 `json:"tokens"`
+	// RetryAfterSeconds is how long until the client's next request is
+	// allowed, or 0 if it is allowed now.
+	RetryAfterSeconds float64 `json:"retry_after_seconds"`
+}
+
+// rateLimitScopeView is the JSON form of one rate limit scope.
+type rateLimitScopeView struct {
+	Scope             string            `json:"scope"`
+	RequestsPerSecond float64           `json:"requests_per_second"`
+	Burst             float64           `json:"burst"`
+	Clients           []rateLimitClient `json:"clients"`
+}
+
+// view returns each limited scope with the clients whose buckets are not
+// full, by ID, their balances refilled to now.
+func (rl *rateLimiter) view() []rateLimitScopeView {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	views := []rateLimitScopeView{}
+	for _, sc := range rl.scopes() {
+		if sc.rule.RequestsPerSecond <= 0 {
+			continue
+		}
+		burst := ruleBurst(sc.rule)
+		v := rateLimitScopeView{Scope: sc.name, RequestsPerSecond: sc.rule.RequestsPerSecond, Burst: burst, Clients: []rateLimitClient{}}
+		for id, b := range sc.buckets {
+			if b.full(now, sc.rule) {
+				continue
+			}
+			tokens := b.tokens
+			if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+				tokens = math.Min(burst, tokens+elapsed*sc.rule.RequestsPerSecond)
+			}
+			c := rateLimitClient{ID: id, Tokens: tokens}
+			if tokens < 1 {
+				c.RetryAfterSeconds = (1 - tokens) / sc.rule.RequestsPerSecond
+			}
+			v.Clients = append(v.Clients, c)
+		}
+		slices.SortFunc(v.Clients, func(a, b rateLimitClient) int { return strings.Compare(a.ID, b.ID) })
+		views = append(views, v)
+	}
+	return views
+}
+
+// handleRateLimits reports the rate limits in force and the clients that
+// have spent part of their burst.
+func (s *Server) handleRateLimits(w http.ResponseWriter, r *http.Request) {
+	s.limiter.mu.Lock()
+	enabled := s.limiter.enabled
+	s.limiter.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"enabled":   enabled,
+		"persisted": s.limitState != nil,
+		"scopes":    s.limiter.view(),
+	})
+}
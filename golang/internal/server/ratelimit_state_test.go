@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+)
+
+func TestRateLimitStatePersisted(t *testing.T) {
+	meta, err := metadata.NewSQLiteStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatalf("creating metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	cfg := config.RateLimitConfig{
+		Enabled: true,
+		PerIP:   config.RateLimitRule{RequestsPerSecond: 1, Burst: 2},
+	}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rl := newRateLimiter(cfg)
+	rl.now = func() time.Time { return now }
+	p, err := newRateLimitPersister(rl, meta, time.Minute)
+	if err != nil {
+		t.Fatalf("newRateLimitPersister: %v", err)
+	}
+	for range 2 {
+		rl.allowClient("10.0.0.1")
+	}
+	if ok, _ := rl.allowClient("10.0.0.1"); ok {
+		t.Fatal("request beyond the burst allowed")
+	}
+	rl.allowClient("10.0.0.2")
+	if err := p.save(t.Context()); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// A restarted limiter keeps the spent balances.
+	restarted := newRateLimiter(cfg)
+	restarted.now = func() time.Time { return now }
+	if _, err := newRateLimitPersister(restarted, meta, time.Minute); err != nil {
+		t.Fatalf("restoring: %v", err)
+	}
+	if ok, _ := restarted.allowClient("10.0.0.1"); ok {
+		t.Error("exhausted client allowed after a restart")
+	}
+	if ok, _ := restarted.allowClient("10.0.0.3"); !ok {
+		t.Error("new client denied after a restart")
+	}
+
+	views := restarted.view()
+	if len(views) != 1 || views[0].Scope != "per_ip" || views[0].Burst != 2 {
+		t.Fatalf("view = %+v", views)
+	}
+	clients := views[0].Clients
+	if len(clients) != 3 || clients[0].ID != "10.0.0.1" || clients[0].Tokens != 0 || clients[0].RetryAfterSeconds != 1 ||
+		clients[1].ID != "10.0.0.2" || clients[1].Tokens != 1 || clients[1].RetryAfterSeconds != 0 {
+		t.Errorf("clients = %+v", clients)
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := restarted.allowClient("10.0.0.1"); !ok {
+		t.Error("restored balance did not refill")
+	}
+
+	// Balances saved under a looser limit are capped to the current burst,
+	// and those of scopes no longer limited are dropped.
+	tighter := newRateLimiter(config.RateLimitConfig{Enabled: true, PerAccessKey: config.RateLimitRule{RequestsPerSecond: 1}})
+	tighter.restore([]metadata.RateLimitState{
+		{Scope: "per_ip", ID: "10.0.0.1", Updated: now},
+		{Scope: "per_access_key", ID: "k", Tokens: 5, Updated: now},
+	})
+	if len(tighter.perIP.buckets) != 0 || tighter.perKey.buckets["k"].tokens != 1 {
+		t.Errorf("restored per_ip %v, per_access_key k %+v", tighter.perIP.buckets, tighter.perKey.buckets["k"])
+	}
+}
+
+func TestRateLimitsEndpoint(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.ReloadRateLimits(config.RateLimitConfig{Enabled: true, PerIP: config.RateLimitRule{RequestsPerSecond: 100, Burst: 1}})
+	srv.limiter.allowClient("192.0.2.1")
+
+	rec := httptest.NewRecorder()
+	asRoot(srv).ServeHTTP(rec, httptest.NewRequest("GET", "/admin/rate-limits", nil))
+	var body struct {
+		Enabled   bool                 `json:"enabled"`
+		Persisted bool                 `json:"persisted"`
+		Scopes    []rateLimitScopeView `json:"scopes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+	}
+	if !body.Enabled || body.Persisted || len(body.Scopes) != 1 || len(body.Scopes[0].Clients) != 1 ||
+		body.Scopes[0].Clients[0].ID != "192.0.2.1" {
+		t.Errorf("rate limits = %+v", body)
+	}
+}
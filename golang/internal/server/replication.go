@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const (
+	// replicationPath serves a memory backend's replication stream.
+	replicationPath = "/admin/replication"
+
+	// replicationIdleTimeout ends a pull that has received nothing for
+	// three missed heartbeats.
+	replicationIdleTimeout = 3 * storage.ReplicationHeartbeat
+
+	// replicationBootstrapTimeout bounds the primary's startup copy from
+	// its replica.
+	replicationBootstrapTimeout = 5 * time.Minute
+
+	// emptyPayloadSHA256 is the SHA-256 of an empty request body.
+	emptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// handleReplicationStream streams the storage backend's contents followed
+// by every change until the client disconnects (authenticated; 501 when the
+// backend cannot replicate).
+func (s *Server) handleReplicationStream(w http.ResponseWriter, r *http.Request) {
+	rp, ok := s.store.(storage.Replicator)
+	if !ok {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives any server write timeout.
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+
+	slog.Info("Replication stream opened", "remote", r.RemoteAddr)
+	err := rp.StreamReplication(r.Context(), w, rc.Flush)
+	slog.Info("Replication stream closed", "remote", r.RemoteAddr, "error", err)
+}
+
+// replicator pulls a peer's replication stream into the local storage
+// backend: continuously on a replica, once at startup on a primary.
+type replicator struct {
+	store  storage.Replicator
+	peer   string
+	creds  aws.Credentials
+	region string
+	client *http.Client
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newReplicator validates cfg and returns a replicator for store, or nil
+// when replication is disabled.
+func newReplicator(cfg *config.Config, store storage.StorageBackend) (*replicator, error) {
+	rcfg := cfg.Storage.Memory.Replication
+	switch rcfg.Role {
+	case "":
+		return nil, nil
+	case "primary", "replica":
+	default:
+		return nil, fmt.Errorf("unknown role %q (want primary or replica)", rcfg.Role)
+	}
+	if rcfg.Peer == "" {
+		return nil, fmt.Errorf("peer is required")
+	}
+	rp, ok := store.(storage.Replicator)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %q does not support replication", cfg.Storage.Backend)
+	}
+	if cfg.Metadata.Engine == "memory" {
+		slog.Warn("Memory backend replication copies objects only; metadata on the memory engine is lost on restart",
+			"role", rcfg.Role)
+	}
+	return &replicator{
+		store:  rp,
+		peer:   strings.TrimSuffix(rcfg.Peer, "/"),
+		creds:  aws.Credentials{AccessKeyID: cfg.Auth.AccessKey, SecretAccessKey: cfg.Auth.SecretKey},
+		region: cfg.Server.Region,
+		client: &http.Client{},
+		stopCh: make(chan struct{}),
+	}, nil
+}
+
+// start launches the loop that follows the peer.
+func (rp *replicator) start() {
+	rp.wg.Add(1)
+	go rp.loop()
+}
+
+// stop terminates the follow loop and its connection.
+func (rp *replicator) stop() {
+	close(rp.stopCh)
+	rp.wg.Wait()
+}
+
+// loop follows the peer, reconnecting with exponential backoff.
+func (rp *replicator) loop() {
+	defer rp.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-rp.stopCh
+		cancel()
+	}()
+
+	const minBackoff, maxBackoff = time.Second, 30 * time.Second
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		synced := false
+		err := rp.pull(ctx, true, func() {
+			synced = true
+			metrics.ReplicationConnected.Set(1)
+			slog.Info("Replica in sync with primary", "peer", rp.peer)
+		})
+		metrics.ReplicationConnected.Set(0)
+		if ctx.Err() != nil {
+			return
+		}
+		if synced {
+			backoff = minBackoff
+		}
+		slog.Warn("Replication stream ended", "peer", rp.peer, "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// bootstrap replaces the local contents with the peer's, for a primary that
+// restarted empty while its replica kept the data.
+func (rp *replicator) bootstrap() error {
+	ctx, cancel := context.WithTimeout(context.Background(), replicationBootstrapTimeout)
+	defer cancel()
+	return rp.pull(ctx, false, nil)
+}
+
+// pull opens the peer's replication stream and applies it. With follow set
+// it applies changes until the stream fails or ctx is done. A stream that
+// sends nothing, not even a heartbeat, for replicationIdleTimeout is
+// treated as dead.
+func (rp *replicator) pull(ctx context.Context, follow bool, synced func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rp.peer+replicationPath, nil)
+	if err != nil {
+		return err
+	}
+	if rp.creds.AccessKeyID != "" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadSHA256)
+		err := v4.NewSigner().SignHTTP(ctx, rp.creds, req, emptyPayloadSHA256, "s3", rp.region, time.Now())
+		if err != nil {
+			return fmt.Errorf("signing request: %w", err)
+		}
+	}
+
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer returned %s", resp.Status)
+	}
+
+	idle := time.AfterFunc(replicationIdleTimeout, cancel)
+	defer idle.Stop()
+	body := &idleReader{r: resp.Body, timer: idle}
+	return rp.store.ApplyReplication(ctx, body, follow, synced)
+}
+
+// idleReader resets timer on every successful read.
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 {
+		ir.timer.Reset(replicationIdleTimeout)
+	}
+	return n, err
+}
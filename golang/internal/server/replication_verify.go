@@ -0,0 +1,362 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/replication"
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// replicationVerifyPageSize is the number of keys listed per metadata page
+// while verifying a bucket.
+const replicationVerifyPageSize = 1000
+
+// maxReplicationDivergences caps the divergences listed in a report.
+const maxReplicationDivergences = 1000
+
+// Verification results, used as the "result" label of
+// bleepstore_replication_verify_objects_total.
+const (
+	replicationVerifyMatch        = "match"
+	replicationVerifyDiverged     = "diverged"
+	replicationVerifyUnverifiable = "unverifiable"
+)
+
+// Problems recorded in a divergence.
+const (
+	divergenceMissing  = "missing"
+	divergenceSize     = "size_mismatch"
+	divergenceChecksum = "checksum_mismatch"
+	divergenceError    = "error"
+)
+
+// replicationDivergence is one replicated object whose replica does not
+// match it.
+type replicationDivergence struct {
+	Key         string `json:"key"`
+	Destination string `json:"destination"`
+	Problem     string `json:"problem"`
+	Detail      string `json:"detail"`
+}
+
+// replicationVerifyReport is the result of verifying one bucket, written
+// as its report object.
+type replicationVerifyReport struct {
+	Bucket       string                  `json:"bucket"`
+	StartedAt    time.Time               `json:"started_at"`
+	SampleRate   float64                 `json:"sample_rate"`
+	Objects      int64                   `json:"objects"`
+	Checked      int64                   `json:"checked"`
+	Matched      int64                   `json:"matched"`
+	Diverged     int64                   `json:"diverged"`
+	Unverifiable int64                   `json:"unverifiable"`
+	Pending      int64                   `json:"pending"`
+	Failed       int64                   `json:"failed"`
+	Divergences  []replicationDivergence `json:"divergences"`
+	Truncated    bool                    `json:"truncated"`
+	Report       string                  `json:"report,omitempty"`
+	Error        string                  `json:"error,omitempty"`
+}
+
+// replicationVerifyRun is the JSON body returned by POST
+// /admin/bucket-replication/verify, and the result of each background run.
+type replicationVerifyRun struct {
+	Reports []replicationVerifyReport `json:"reports"`
+}
+
+// replicationVerifier checks that replicated objects still match their
+// replicas: for each COMPLETED object of a bucket with a replication
+// configuration, or a random sample of them, it compares the size and MD5
+// of the object with the replica's on the remote endpoint, and writes a
+// report of the divergences to a local bucket through the S3 operation
+// handlers.
+type replicationVerifier struct {
+	meta         metadata.MetadataStore
+	store        storage.StorageBackend
+	rules        *replication.Rules
+	target       *storage.S3Target
+	dispatch     func(ctx context.Context, method, target string, body []byte) *probeResponse
+	clock        clock.Clock
+	sampleRate   float64
+	reportBucket string
+	reportPrefix string
+	interval     time.Duration
+	gate         *writeGate // closed while writes are quiesced for a backup
+	jobs         *jobRegistry
+
+	mu sync.Mutex // one run at a time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop.
+func (v *replicationVerifier) start() {
+	v.wg.Add(1)
+	go v.loop()
+}
+
+// stop terminates the background loop, cancelling a running verification.
+func (v *replicationVerifier) stop() {
+	close(v.stopCh)
+	v.wg.Wait()
+}
+
+// loop verifies every bucket each interval.
+func (v *replicationVerifier) loop() {
+	defer v.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-v.stopCh
+		cancel()
+	}()
+
+	tickC, stopTick := tick(v.interval)
+	defer stopTick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickC:
+			jctx, j := v.jobs.begin(ctx, "replication-verify")
+			run, err := v.run(jctx, v.rules.Buckets(), v.sampleRate)
+			j.finish(run, err)
+			if err != nil && ctx.Err() == nil && !j.wasCancelled() {
+				slog.Error("Replication verification error", "error", err)
+			}
+		}
+	}
+}
+
+// run verifies each bucket and writes its report. A bucket that fails is
+// recorded in the result; the run stops early only when ctx ends.
+func (v *replicationVerifier) run(ctx context.Context, buckets []string, sampleRate float64) (*replicationVerifyRun, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	run := &replicationVerifyRun{Reports: []replicationVerifyReport{}}
+	var objects int64
+	for _, bucket := range buckets {
+		report := &replicationVerifyReport{Bucket: bucket, StartedAt: v.clock.Now().UTC(),
+			SampleRate: sampleRate, Divergences: []replicationDivergence{}}
+		err := v.verify(ctx, report, &objects)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			err = v.writeReport(ctx, report)
+		}
+		if err != nil {
+			slog.Error("Replication verification failed", "bucket", bucket, "error", err)
+			report.Error = err.Error()
+		} else {
+			slog.Info("Replication verification complete", "bucket", bucket, "report", report.Report,
+				"checked", report.Checked, "diverged", report.Diverged)
+		}
+		run.Reports = append(run.Reports, *report)
+	}
+	return run, nil
+}
+
+// verify checks the replicated objects of report's bucket, sampling
+// sampleRate of them. objects counts the objects listed by the run, for
+// its progress.
+func (v *replicationVerifier) verify(ctx context.Context, report *replicationVerifyReport, objects *int64) error {
+	opts := metadata.ListObjectsOptions{MaxKeys: replicationVerifyPageSize}
+	for {
+		page, err := v.meta.ListObjects(ctx, report.Bucket, opts)
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", report.Bucket, err)
+		}
+		for i := range page.Objects {
+			obj := &page.Objects[i]
+			if obj.DeleteMarker {
+				continue
+			}
+			report.Objects++
+			*objects++
+			switch obj.ReplicationStatus {
+			case metadata.ReplicationPending:
+				report.Pending++
+				continue
+			case metadata.ReplicationFailed:
+				report.Failed++
+				continue
+			case metadata.ReplicationCompleted:
+			default:
+				continue
+			}
+			rule := v.rules.Match(obj.Bucket, obj.Key)
+			if rule == nil || (report.SampleRate < 1 && rand.Float64() >= report.SampleRate) {
+				continue
+			}
+			if err := v.check(ctx, obj, replication.DestinationBucket(rule), report); err != nil {
+				return err
+			}
+		}
+		progress.Report(ctx, *objects, 0)
+		if !page.IsTruncated || len(page.Objects) == 0 {
+			return nil
+		}
+		opts.StartAfter = page.Objects[len(page.Objects)-1].Key
+	}
+}
+
+// check compares obj with its replica in dest and records the result. It
+// returns an error only when ctx ends.
+func (v *replicationVerifier) check(ctx context.Context, obj *metadata.ObjectRecord, dest string, report *replicationVerifyReport) error {
+	report.Checked++
+	diverge := func(problem, detail string) {
+		report.Diverged++
+		metrics.ReplicationVerifyObjectsTotal.WithLabelValues(replicationVerifyDiverged).Inc()
+		if len(report.Divergences) == maxReplicationDivergences {
+			report.Truncated = true
+			return
+		}
+		report.Divergences = append(report.Divergences, replicationDivergence{
+			Key: obj.Key, Destination: dest, Problem: problem, Detail: detail,
+		})
+	}
+
+	replica, err := v.target.StatObject(ctx, dest, obj.Key)
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil:
+		diverge(divergenceError, err.Error())
+		return nil
+	case replica == nil:
+		diverge(divergenceMissing, "no replica in "+dest)
+		return nil
+	case replica.Size != obj.Size:
+		diverge(divergenceSize, fmt.Sprintf("replica is %d bytes, object is %d", replica.Size, obj.Size))
+		return nil
+	case strings.Contains(replica.ETag, "-"):
+		// A replica the target stored in parts has no whole-object MD5.
+		report.Unverifiable++
+		metrics.ReplicationVerifyObjectsTotal.WithLabelValues(replicationVerifyUnverifiable).Inc()
+		return nil
+	}
+
+	// The ETag of an object not uploaded in parts is the MD5 of its data;
+	// other objects are read back and hashed.
+	sum := strings.Trim(obj.ETag, `"`)
+	if strings.Contains(sum, "-") {
+		if sum, err = v.hash(ctx, obj); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			diverge(divergenceError, fmt.Sprintf("reading object: %v", err))
+			return nil
+		}
+	}
+	if !strings.EqualFold(sum, replica.ETag) {
+		diverge(divergenceChecksum, fmt.Sprintf("replica MD5 is %s, object MD5 is %s", replica.ETag, sum))
+		return nil
+	}
+	report.Matched++
+	metrics.ReplicationVerifyObjectsTotal.WithLabelValues(replicationVerifyMatch).Inc()
+	return nil
+}
+
+// hash returns the hex MD5 of obj's data.
+func (v *replicationVerifier) hash(ctx context.Context, obj *metadata.ObjectRecord) (string, error) {
+	h := md5.New()
+	if obj.InlineData != nil {
+		h.Write(obj.InlineData)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	rc, _, _, err := v.store.GetObject(ctx, obj.Bucket, obj.Key)
+	if err != nil {
+		return "", err
+	}
+	if obj.Compression != "" {
+		if rc, err = storage.NewDecompressReader(obj.Compression, rc); err != nil {
+			return "", err
+		}
+	}
+	defer rc.Close()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeReport writes report as a JSON object to the report bucket through
+// the S3 operation handlers, so the write is accounted for like any other.
+func (v *replicationVerifier) writeReport(ctx context.Context, report *replicationVerifyReport) error {
+	if !v.gate.enter() {
+		return fmt.Errorf("writes are quiesced")
+	}
+	defer v.gate.leave()
+
+	key := v.reportPrefix + report.Bucket + "/" + report.StartedAt.Format("2006-01-02T15-04-05Z") + ".json"
+	report.Report = key
+	doc, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		report.Report = ""
+		return err
+	}
+	target := (&url.URL{Path: "/" + v.reportBucket + "/" + key}).String()
+	res := v.dispatch(ctx, http.MethodPut, target, doc)
+	if res.code != http.StatusOK {
+		report.Report = ""
+		return fmt.Errorf("writing %s/%s: status %d: %s", v.reportBucket, key, res.code, res.body.String())
+	}
+	return nil
+}
+
+// handleReplicationVerify serves POST /admin/bucket-replication/verify,
+// which verifies the replicas of the "bucket" query parameter's objects,
+// or of every bucket with a replication configuration without one, and
+// returns the reports written. "sample_rate" overrides the configured
+// fraction of objects checked.
+func (s *Server) handleReplicationVerify(w http.ResponseWriter, r *http.Request) {
+	if s.replVerify == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	sampleRate := s.replVerify.sampleRate
+	if v := r.URL.Query().Get("sample_rate"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		sampleRate = f
+	}
+	buckets := s.replVerify.rules.Buckets()
+	if bucket := r.URL.Query().Get("bucket"); bucket != "" {
+		if s.replVerify.rules.Get(bucket) == nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrReplicationConfigurationNotFound)
+			return
+		}
+		buckets = []string{bucket}
+	}
+
+	s.runJob(w, r, "replication-verify", func(ctx context.Context) (any, error) {
+		return s.replVerify.run(ctx, buckets, sampleRate)
+	})
+}
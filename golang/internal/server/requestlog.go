@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/handlers"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+const (
+	// defaultRequestLogOverride is how long a request logging override
+	// lasts when the request does not say.
+	defaultRequestLogOverride = time.Hour
+	// maxRequestLogOverride caps how long an override lasts, so a
+	// forgotten one cannot flood the logs indefinitely.
+	maxRequestLogOverride = 24 * time.Hour
+	// maxRequestLogBodySize caps the body of PUT /admin/request-logging/{bucket}.
+	maxRequestLogBodySize = 64 << 10
+)
+
+// redactedQueryParams are the query parameters left out of verbose request
+// logs because they carry credentials.
+var redactedQueryParams = []string{"X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token", "Signature", "AWSAccessKeyId"}
+
+// redactedHeaders are the request headers left out of verbose request logs.
+var redactedHeaders = []string{"Authorization", "X-Amz-Security-Token", "Cookie"}
+
+// requestLogOverride sets the request log sample rate of one bucket until
+// it expires.
+type requestLogOverride struct {
+	sampleRate float64
+	expires    time.Time
+}
+
+// requestLogger decides which S3 requests are logged when they complete.
+// A global fraction is sampled; an override replaces it for one bucket
+// until it expires and logs each request verbosely, with its query and
+// headers. Overrides live in memory on the instance that set them.
+type requestLogger struct {
+	rate  float64
+	clock clock.Clock
+
+	mu        sync.Mutex
+	overrides map[string]requestLogOverride
+}
+
+func newRequestLogger(rate float64, c clock.Clock) *requestLogger {
+	return &requestLogger{rate: rate, clock: c, overrides: make(map[string]requestLogOverride)}
+}
+
+// sample reports whether to log a request to bucket, and whether verbosely.
+func (l *requestLogger) sample(bucket string) (logged, verbose bool) {
+	rate := l.rate
+	if bucket != "" {
+		if o, ok := l.override(bucket); ok {
+			rate, verbose = o.sampleRate, true
+		}
+	}
+	if rate <= 0 || (rate < 1 && rand.Float64() >= rate) {
+		return false, false
+	}
+	return true, verbose
+}
+
+// override returns bucket's unexpired override, dropping an expired one.
+func (l *requestLogger) override(bucket string) (requestLogOverride, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	o, ok := l.overrides[bucket]
+	if ok && !l.clock.Now().Before(o.expires) {
+		delete(l.overrides, bucket)
+		return requestLogOverride{}, false
+	}
+	return o, ok
+}
+
+// set installs or replaces bucket's override.
+func (l *requestLogger) set(bucket string, o requestLogOverride) {
+	l.mu.Lock()
+	l.overrides[bucket] = o
+	l.mu.Unlock()
+}
+
+// remove drops bucket's override, reporting whether it had an unexpired one.
+func (l *requestLogger) remove(bucket string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	o, ok := l.overrides[bucket]
+	delete(l.overrides, bucket)
+	return ok && l.clock.Now().Before(o.expires)
+}
+
+// list returns the unexpired overrides by bucket name, dropping expired ones.
+func (l *requestLogger) list() []requestLogOverrideView {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	views := []requestLogOverrideView{}
+	for bucket, o := range l.overrides {
+		if !now.Before(o.expires) {
+			delete(l.overrides, bucket)
+			continue
+		}
+		views = append(views, viewRequestLogOverride(bucket, o))
+	}
+	slices.SortFunc(views, func(a, b requestLogOverrideView) int { return strings.Compare(a.Bucket, b.Bucket) })
+	return views
+}
+
+// log writes the completed request's log line. rec has recorded the
+// response; start is when the request was dispatched.
+func (l *requestLogger) log(r *http.Request, rc *handlers.RequestContext, rec *responseRecorder, start time.Time, verbose bool) {
+	attrs := []any{
+		"operation", rc.Operation, "bucket", rc.Bucket, "key", rc.Key, "request_id", rc.RequestID,
+		"status", rec.statusCode, "bytes", rec.bytesWritten,
+		"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+		"access_key", auth.AccessKeyFromContext(r.Context()),
+	}
+	if verbose {
+		query := r.URL.Query()
+		for _, name := range redactedQueryParams {
+			if query.Has(name) {
+				query.Set(name, "REDACTED")
+			}
+		}
+		var headers []any
+		for name, values := range r.Header {
+			if !slices.Contains(redactedHeaders, name) {
+				headers = append(headers, slog.String(name, strings.Join(values, ", ")))
+			}
+		}
+		attrs = append(attrs, "method", r.Method, "path", r.URL.Path, "query", query.Encode(),
+			"remote_addr", r.RemoteAddr, "content_length", r.ContentLength, slog.Group("headers", headers...))
+	}
+	slog.Info("S3 request completed", attrs...)
+}
+
+// requestLogOverrideView is the JSON form of a request logging override.
+type requestLogOverrideView struct {
+	Bucket     string  `json:"bucket"`
+	SampleRate float64 `json:"sample_rate"`
+	Expires    string  `json:"expires"`
+}
+
+func viewRequestLogOverride(bucket string, o requestLogOverride) requestLogOverrideView {
+	return requestLogOverrideView{Bucket: bucket, SampleRate: o.sampleRate, Expires: xmlutil.FormatTimeS3(o.expires)}
+}
+
+// handleListRequestLogging reports the global request log sample rate and
+// the unexpired per-bucket overrides.
+func (s *Server) handleListRequestLogging(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"sample_rate": s.requestLog.rate,
+		"overrides":   s.requestLog.list(),
+	})
+}
+
+// handleSetRequestLogging logs requests to a bucket at a raised sample rate
+// for a while. An optional JSON body {"sample_rate": 0.5,
+// "duration_seconds": 600} sets the rate (default 1, every request) and
+// how long the override lasts (default an hour, at most a day).
+func (s *Server) handleSetRequestLogging(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		SampleRate      *float64 `json:"sample_rate"`
+		DurationSeconds int      `json:"duration_seconds"`
+	}{}
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxRequestLogBodySize))
+	if err != nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrIncompleteBody)
+		return
+	}
+	invalid := func(msg string) {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "InvalidArgument",
+			Message:    "Invalid request logging override: " + msg,
+			HTTPStatus: http.StatusBadRequest,
+		})
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &body); err != nil {
+			invalid(err.Error())
+			return
+		}
+	}
+	o := requestLogOverride{sampleRate: 1}
+	if body.SampleRate != nil {
+		if *body.SampleRate <= 0 || *body.SampleRate > 1 {
+			invalid("sample_rate must be above 0 and at most 1")
+			return
+		}
+		o.sampleRate = *body.SampleRate
+	}
+	duration := defaultRequestLogOverride
+	if body.DurationSeconds != 0 {
+		duration = time.Duration(body.DurationSeconds) * time.Second
+		if duration < 0 || duration > maxRequestLogOverride {
+			invalid("duration_seconds must be between 1 and 86400")
+			return
+		}
+	}
+	o.expires = s.clock.Now().UTC().Add(duration)
+
+	bucket := chi.URLParam(r, "bucket")
+	s.requestLog.set(bucket, o)
+	slog.Warn("Request logging override set", "bucket", bucket, "sample_rate", o.sampleRate,
+		"expires", o.expires, "access_key", auth.AccessKeyFromContext(r.Context()))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(viewRequestLogOverride(bucket, o))
+}
+
+// handleDeleteRequestLogging returns a bucket to the global sample rate.
+// Deleting an override that does not exist succeeds.
+func (s *Server) handleDeleteRequestLogging(w http.ResponseWriter, r *http.Request) {
+	bucket := chi.URLParam(r, "bucket")
+	if s.requestLog.remove(bucket) {
+		slog.Warn("Request logging override removed", "bucket", bucket, "access_key", auth.AccessKeyFromContext(r.Context()))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
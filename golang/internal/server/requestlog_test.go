@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/clock"
+)
+
+// captureRequestLogs sends the default logger's output to a buffer for the
+// rest of the test and returns a function decoding the request log lines.
+func captureRequestLogs(t *testing.T) func() []map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return func() []map[string]any {
+		var lines []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var m map[string]any
+			if json.Unmarshal([]byte(line), &m) == nil && m["msg"] == "S3 request completed" {
+				lines = append(lines, m)
+			}
+		}
+		buf.Reset()
+		return lines
+	}
+}
+
+func TestRequestLoggingOverride(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	srv := newTestServerWithBackends(t, WithClock(fake))
+	call := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		asRoot(srv).ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+	srv.probeRequest(ctx, "PUT", "/data", nil)
+	srv.probeRequest(ctx, "PUT", "/other", nil)
+	logs := captureRequestLogs(t)
+
+	srv.probeRequest(ctx, "PUT", "/data/a", []byte("abc"))
+	if got := logs(); len(got) != 0 {
+		t.Fatalf("logged %d requests at sample rate 0", len(got))
+	}
+
+	for _, body := range []string{`{"sample_rate":0}`, `{"sample_rate":1.5}`, `{"duration_seconds":90000}`, `{"duration_seconds":-1}`, `[`} {
+		if rec := call("PUT", "/admin/request-logging/data", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("override %s = %d, want 400", body, rec.Code)
+		}
+	}
+	rec := call("PUT", "/admin/request-logging/data", `{"duration_seconds":600}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("setting override = %d %s", rec.Code, rec.Body.String())
+	}
+	var list struct {
+		SampleRate float64                  `json:"sample_rate"`
+		Overrides  []requestLogOverrideView `json:"overrides"`
+	}
+	json.Unmarshal(call("GET", "/admin/request-logging", "").Body.Bytes(), &list)
+	if len(list.Overrides) != 1 || list.Overrides[0].Bucket != "data" || list.Overrides[0].SampleRate != 1 ||
+		list.Overrides[0].Expires != "2026-03-01T12:10:00.000Z" {
+		t.Fatalf("overrides = %+v", list)
+	}
+
+	req := httptest.NewRequest("GET", "/data/a?response-content-type=text/plain", nil)
+	req.Header.Set("Authorization", "secret-credentials")
+	req.Header.Set("X-Debug-Tag", "ticket-42")
+	srv.router.ServeHTTP(httptest.NewRecorder(), req)
+	srv.probeRequest(ctx, "GET", "/data/missing", nil)
+	srv.probeRequest(ctx, "GET", "/other/a", nil)
+	got := logs()
+	if len(got) != 2 {
+		t.Fatalf("logged %d requests with an override, want 2: %v", len(got), got)
+	}
+	first := got[0]
+	if first["bucket"] != "data" || first["key"] != "a" || first["status"] != float64(200) || first["bytes"] != float64(3) ||
+		first["method"] != "GET" || first["query"] != "response-content-type=text%2Fplain" {
+		t.Errorf("verbose log line = %v", first)
+	}
+	headers, _ := first["headers"].(map[string]any)
+	if headers["X-Debug-Tag"] != "ticket-42" || headers["Authorization"] != nil {
+		t.Errorf("logged headers = %v", headers)
+	}
+	if got[1]["key"] != "missing" || got[1]["status"] != float64(404) {
+		t.Errorf("log line for a missing key = %v", got[1])
+	}
+
+	// The override lapses on its own.
+	fake.Advance(10 * time.Minute)
+	srv.probeRequest(ctx, "GET", "/data/a", nil)
+	if got := logs(); len(got) != 0 {
+		t.Errorf("logged %d requests after the override expired", len(got))
+	}
+	json.Unmarshal(call("GET", "/admin/request-logging", "").Body.Bytes(), &list)
+	if len(list.Overrides) != 0 {
+		t.Errorf("overrides after expiry = %+v", list.Overrides)
+	}
+
+	call("PUT", "/admin/request-logging/data", "")
+	if rec := call("DELETE", "/admin/request-logging/data", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("removing override = %d", rec.Code)
+	}
+	srv.probeRequest(ctx, "GET", "/data/a", nil)
+	if got := logs(); len(got) != 0 {
+		t.Errorf("logged %d requests after the override was removed", len(got))
+	}
+}
+
+func TestRequestLogSampling(t *testing.T) {
+	l := newRequestLogger(0.5, clock.NewFake(time.Unix(0, 0)))
+	logged := 0
+	for range 1000 {
+		if ok, verbose := l.sample("b"); ok {
+			logged++
+			if verbose {
+				t.Fatal("sampled request logged verbosely without an override")
+			}
+		}
+	}
+	if logged < 350 || logged > 650 {
+		t.Errorf("logged %d of 1000 requests at rate 0.5", logged)
+	}
+	if ok, _ := newRequestLogger(1, clock.System{}).sample(""); !ok {
+		t.Error("rate 1 did not log a request")
+	}
+}
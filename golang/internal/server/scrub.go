@@ -0,0 +1,471 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// scrubPageSize is the number of keys listed per metadata page while
+// scrubbing.
+const scrubPageSize = 1000
+
+// maxScrubFindings caps the damaged objects listed in a scrub report.
+const maxScrubFindings = 1000
+
+// Scrub results, used as the "result" label of bleepstore_scrub_objects_total.
+const (
+	scrubOK       = "ok"
+	scrubCorrupt  = "corrupt"
+	scrubMissing  = "missing"
+	scrubRepaired = "repaired"
+	scrubSkipped  = "skipped"
+)
+
+// repairSource supplies good copies of damaged objects.
+type repairSource interface {
+	OpenObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// scrubFinding is one corrupt or missing object found by a pass.
+type scrubFinding struct {
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	Problem     string `json:"problem"`
+	Detail      string `json:"detail"`
+	Repaired    bool   `json:"repaired"`
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// scrubReport is the JSON body returned by POST /admin/scrub, and the
+// summary logged after each background pass.
+type scrubReport struct {
+	Bucket    string         `json:"bucket,omitempty"`
+	Objects   int64          `json:"objects"`
+	Bytes     int64          `json:"bytes"`
+	Corrupt   int64          `json:"corrupt"`
+	Missing   int64          `json:"missing"`
+	Repaired  int64          `json:"repaired"`
+	Skipped   int64          `json:"skipped"`
+	Findings  []scrubFinding `json:"findings"`
+	Truncated bool           `json:"truncated"`
+}
+
+// scrubber reads stored objects back at a throttled rate and compares
+// their hash with the ETag in metadata, to find data damaged at rest
+// before a client does. Damaged objects are rewritten from source when one
+// is configured.
+type scrubber struct {
+	meta     metadata.MetadataStore
+	store    storage.StorageBackend
+	source   repairSource // nil = report only
+	rate     int64        // bytes per second (0 = unthrottled)
+	interval time.Duration
+	gate     *writeGate // closed while writes are quiesced for a backup
+	jobs     *jobRegistry
+
+	mu sync.Mutex // one pass at a time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// start launches the background loop.
+func (s *scrubber) start() {
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// stop terminates the background loop, cancelling a running pass.
+func (s *scrubber) stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// loop runs a pass over every bucket each interval.
+func (s *scrubber) loop() {
+	defer s.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stopCh
+		cancel()
+	}()
+
+	tickC, stopTick := tick(s.interval)
+	defer stopTick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickC:
+			start := time.Now()
+			jctx, j := s.jobs.begin(ctx, "scrub")
+			report, err := s.run(jctx, "")
+			j.finish(report, err)
+			if err != nil {
+				if ctx.Err() == nil && !j.wasCancelled() {
+					slog.Error("Scrub error", "error", err)
+				}
+				continue
+			}
+			slog.Info("Scrub pass complete", "objects", report.Objects, "bytes", report.Bytes,
+				"corrupt", report.Corrupt, "missing", report.Missing, "repaired", report.Repaired,
+				"skipped", report.Skipped, "duration", time.Since(start))
+		}
+	}
+}
+
+// run scrubs every object in bucket, or in all buckets if bucket is "".
+// Only a pass over all buckets updates the corrupt-objects gauge.
+func (s *scrubber) run(ctx context.Context, bucket string) (*scrubReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets := []string{bucket}
+	if bucket == "" {
+		en, ok := s.meta.(metadata.Enumerator)
+		if !ok {
+			return nil, errors.New("metadata store cannot list all buckets")
+		}
+		all, err := en.ListAllBuckets(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing buckets: %w", err)
+		}
+		buckets = buckets[:0]
+		for _, b := range all {
+			buckets = append(buckets, b.Name)
+		}
+	}
+
+	report := &scrubReport{Bucket: bucket, Findings: []scrubFinding{}}
+	p := &pacer{rate: s.rate, start: time.Now()}
+	for _, name := range buckets {
+		if err := s.scrubBucket(ctx, name, p, report); err != nil {
+			return nil, err
+		}
+	}
+	if bucket == "" {
+		metrics.ScrubCorruptObjects.Set(float64(report.Corrupt + report.Missing - report.Repaired))
+		metrics.ScrubLastPassTimestamp.SetToCurrentTime()
+	}
+	return report, nil
+}
+
+// scrubBucket scrubs every object in bucket.
+func (s *scrubber) scrubBucket(ctx context.Context, bucket string, p *pacer, report *scrubReport) error {
+	opts := metadata.ListObjectsOptions{MaxKeys: scrubPageSize}
+	for {
+		page, err := s.meta.ListObjects(ctx, bucket, opts)
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", bucket, err)
+		}
+		for _, entry := range page.Objects {
+			// Listings may leave out payload fields; read the full record.
+			obj, err := s.meta.GetObject(ctx, bucket, entry.Key)
+			if err != nil {
+				return fmt.Errorf("reading %s/%s: %w", bucket, entry.Key, err)
+			}
+			if obj == nil {
+				continue // deleted since it was listed
+			}
+			if err := s.scrubObject(ctx, obj, p, report); err != nil {
+				return err
+			}
+			progress.Report(ctx, report.Objects, 0)
+		}
+		if !page.IsTruncated || len(page.Objects) == 0 {
+			return nil
+		}
+		opts.StartAfter = page.Objects[len(page.Objects)-1].Key
+	}
+}
+
+// scrubObject checks one object and repairs it if it is damaged. It only
+// returns an error when ctx is done.
+func (s *scrubber) scrubObject(ctx context.Context, obj *metadata.ObjectRecord, p *pacer, report *scrubReport) error {
+	report.Objects++
+	h := newETagHasher(obj)
+	if obj.DeleteMarker || obj.InlineData != nil || h == nil {
+		// Inline data lives in the metadata store, and multipart objects
+		// completed before part sizes were recorded have an ETag that
+		// cannot be recomputed.
+		report.Skipped++
+		metrics.ScrubObjectsTotal.WithLabelValues(scrubSkipped).Inc()
+		return nil
+	}
+
+	problem, detail, err := s.check(ctx, obj, h, p, report)
+	if err != nil {
+		return err
+	}
+	if problem == "" {
+		metrics.ScrubObjectsTotal.WithLabelValues(scrubOK).Inc()
+		return nil
+	}
+
+	metrics.ScrubObjectsTotal.WithLabelValues(problem).Inc()
+	if problem == scrubMissing {
+		report.Missing++
+	} else {
+		report.Corrupt++
+	}
+	slog.Warn("Scrub found damaged object", "bucket", obj.Bucket, "key", obj.Key, "problem", problem, "detail", detail)
+	f := scrubFinding{Bucket: obj.Bucket, Key: obj.Key, Problem: problem, Detail: detail}
+	if s.source != nil {
+		if err := s.repair(ctx, obj); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			f.RepairError = err.Error()
+			slog.Error("Scrub repair error", "bucket", obj.Bucket, "key", obj.Key, "error", err)
+		} else {
+			f.Repaired = true
+			report.Repaired++
+			metrics.ScrubObjectsTotal.WithLabelValues(scrubRepaired).Inc()
+			slog.Info("Scrub repaired object", "bucket", obj.Bucket, "key", obj.Key)
+		}
+	}
+	if len(report.Findings) < maxScrubFindings {
+		report.Findings = append(report.Findings, f)
+	} else {
+		report.Truncated = true
+	}
+	return nil
+}
+
+// check reads obj's data through h and returns "" if it matches the
+// metadata, or the problem and a description of it. Read errors other
+// than cancellation count as corruption.
+func (s *scrubber) check(ctx context.Context, obj *metadata.ObjectRecord, h *etagHasher, p *pacer, report *scrubReport) (string, string, error) {
+	rc, _, _, err := s.store.GetObject(ctx, obj.Bucket, obj.Key)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		return scrubMissing, err.Error(), nil
+	}
+	if obj.Compression != "" {
+		if rc, err = storage.NewDecompressReader(obj.Compression, rc); err != nil {
+			return scrubCorrupt, err.Error(), nil
+		}
+	}
+	defer rc.Close()
+
+	n, err := io.Copy(h, p.reader(ctx, rc))
+	report.Bytes += n
+	metrics.ScrubBytesTotal.Add(float64(n))
+	switch {
+	case ctx.Err() != nil:
+		return "", "", ctx.Err()
+	case err != nil:
+		return scrubCorrupt, fmt.Sprintf("reading data: %v", err), nil
+	case n != obj.Size:
+		return scrubCorrupt, fmt.Sprintf("data is %d bytes, metadata says %d", n, obj.Size), nil
+	case !strings.EqualFold(h.ETag(), obj.ETag):
+		return scrubCorrupt, fmt.Sprintf("data hashes to %s, ETag is %s", h.ETag(), obj.ETag), nil
+	}
+	return "", "", nil
+}
+
+// repair replaces obj's data with the source's copy. The copy is staged in
+// a temp file and must match obj's size and ETag before anything is
+// written; objects overwritten or deleted in the meantime are left alone.
+func (s *scrubber) repair(ctx context.Context, obj *metadata.ObjectRecord) error {
+	rc, err := s.source.OpenObject(ctx, obj.Bucket, obj.Key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "bleepstore-scrub-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := newETagHasher(obj)
+	n, err := io.Copy(io.MultiWriter(tmp, h), rc)
+	if err != nil {
+		return fmt.Errorf("fetching source copy: %w", err)
+	}
+	if n != obj.Size || !strings.EqualFold(h.ETag(), obj.ETag) {
+		return fmt.Errorf("source copy is %d bytes hashing to %s, want %d bytes with ETag %s", n, h.ETag(), obj.Size, obj.ETag)
+	}
+
+	cur, err := s.meta.GetObject(ctx, obj.Bucket, obj.Key)
+	if err != nil {
+		return err
+	}
+	if cur == nil || cur.ETag != obj.ETag || !cur.LastModified.Equal(obj.LastModified) {
+		return errors.New("object changed during repair")
+	}
+
+	if !s.gate.enter() {
+		return errors.New("writes are quiesced for a backup")
+	}
+	defer s.gate.leave()
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var body io.Reader = tmp
+	size := obj.Size
+	if obj.Compression != "" {
+		compressed, err := storage.CompressReader(obj.Compression, tmp)
+		if err != nil {
+			return err
+		}
+		defer compressed.Close()
+		body, size = compressed, -1
+	}
+	if _, _, err := s.store.PutObject(ctx, obj.Bucket, obj.Key, body, size); err != nil {
+		return fmt.Errorf("writing repaired data: %w", err)
+	}
+	return nil
+}
+
+// etagHasher computes an object's ETag from its data: the MD5 of the data,
+// or for a multipart object the MD5 of its parts' MD5s, split at the
+// recorded part sizes.
+type etagHasher struct {
+	parts []int64 // nil for a single-part ETag
+	h     hash.Hash
+	// Multipart state: index of the current part, its bytes still
+	// expected, and the digests of the parts before it.
+	i    int
+	left int64
+	sums []byte
+}
+
+// newETagHasher returns a hasher for obj's ETag, or nil if obj's ETag
+// cannot be recomputed from its data.
+func newETagHasher(obj *metadata.ObjectRecord) *etagHasher {
+	_, count, multipart := strings.Cut(strings.Trim(obj.ETag, `"`), "-")
+	if !multipart {
+		return &etagHasher{h: md5.New()}
+	}
+	if n, err := strconv.Atoi(count); err != nil || n != len(obj.PartSizes) || n == 0 {
+		return nil
+	}
+	return &etagHasher{parts: obj.PartSizes, h: md5.New(), left: obj.PartSizes[0]}
+}
+
+func (e *etagHasher) Write(p []byte) (int, error) {
+	if e.parts == nil {
+		return e.h.Write(p)
+	}
+	written := len(p)
+	for len(p) > 0 {
+		last := e.i == len(e.parts)-1
+		if e.left == 0 && !last {
+			e.sums = e.h.Sum(e.sums)
+			e.h.Reset()
+			e.i++
+			e.left = e.parts[e.i]
+			continue
+		}
+		n := len(p)
+		if !last && int64(n) > e.left {
+			n = int(e.left)
+		}
+		e.h.Write(p[:n])
+		e.left -= int64(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// ETag returns the quoted ETag of the data written so far.
+func (e *etagHasher) ETag() string {
+	if e.parts == nil {
+		return fmt.Sprintf(`"%x"`, e.h.Sum(nil))
+	}
+	return fmt.Sprintf(`"%x-%d"`, md5.Sum(e.h.Sum(e.sums)), len(e.parts))
+}
+
+// pacer spreads the reads of a pass so they average at most rate bytes
+// per second.
+type pacer struct {
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+// reader returns r paced by p.
+func (p *pacer) reader(ctx context.Context, r io.Reader) io.Reader {
+	if p.rate <= 0 {
+		return r
+	}
+	return &pacedReader{ctx: ctx, r: r, p: p}
+}
+
+type pacedReader struct {
+	ctx context.Context
+	r   io.Reader
+	p   *pacer
+}
+
+func (r *pacedReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.read += int64(n)
+	due := r.p.start.Add(time.Duration(float64(r.p.read) / float64(r.p.rate) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		case <-t.C:
+		}
+	}
+	return n, err
+}
+
+// handleScrub serves POST /admin/scrub, which scrubs the objects of the
+// "bucket" query parameter, or of every bucket without one, and returns a
+// report. It blocks until done and waits for a running background pass, or
+// with "async=true" runs as a background job.
+func (s *Server) handleScrub(w http.ResponseWriter, r *http.Request) {
+	if s.scrub == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	ctx := r.Context()
+	bucket := r.URL.Query().Get("bucket")
+	if bucket != "" {
+		b, err := s.meta.GetBucket(ctx, bucket)
+		if err != nil {
+			slog.Error("Scrub GetBucket error", "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		if b == nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrNoSuchBucket)
+			return
+		}
+	}
+
+	s.runJob(w, r, "scrub", func(ctx context.Context) (any, error) {
+		return s.scrub.run(ctx, bucket)
+	})
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// mapSource is a repair source serving copies from memory.
+type mapSource map[string]string
+
+func (m mapSource) OpenObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	data, ok := m[bucket+"/"+key]
+	if !ok {
+		return nil, fmt.Errorf("no copy of %s/%s", bucket, key)
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+// newTestScrubber returns a scrubber over sqlite metadata and local
+// storage holding bucket "b", and the storage root.
+func newTestScrubber(t *testing.T) (*scrubber, string) {
+	t.Helper()
+	dir := t.TempDir()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	root := filepath.Join(dir, "objects")
+	store, err := storage.NewLocalBackend(root)
+	if err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	ctx := context.Background()
+	if err := meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "b", OwnerID: "o"}); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	if err := store.CreateBucket(ctx, "b"); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	return &scrubber{meta: meta, store: store, stopCh: make(chan struct{})}, root
+}
+
+// putScrubObject stores data under key with the given ETag and part sizes.
+func putScrubObject(t *testing.T, s *scrubber, key, data, etag string, partSizes []int64) {
+	t.Helper()
+	ctx := context.Background()
+	if _, _, err := s.store.PutObject(ctx, "b", key, strings.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if etag == "" {
+		etag = fmt.Sprintf(`"%x"`, md5.Sum([]byte(data)))
+	}
+	err := s.meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "b", Key: key, Size: int64(len(data)),
+		ETag: etag, PartSizes: partSizes, LastModified: time.Now().UTC()})
+	if err != nil {
+		t.Fatalf("PutObject metadata: %v", err)
+	}
+}
+
+// multipartETag returns the composite ETag of parts.
+func multipartETag(parts ...string) string {
+	var sums []byte
+	for _, p := range parts {
+		sum := md5.Sum([]byte(p))
+		sums = append(sums, sum[:]...)
+	}
+	return fmt.Sprintf(`"%x-%d"`, md5.Sum(sums), len(parts))
+}
+
+func TestScrubDetectsAndRepairs(t *testing.T) {
+	s, root := newTestScrubber(t)
+	putScrubObject(t, s, "good", "intact data", "", nil)
+	putScrubObject(t, s, "bad", "hello world", "", nil)
+	putScrubObject(t, s, "gone", "soon missing", "", nil)
+	putScrubObject(t, s, "mp", "part one|part two", multipartETag("part one|", "part two"), []int64{9, 8})
+	putScrubObject(t, s, "legacy-mp", "ab", multipartETag("a", "b"), nil)
+
+	os.WriteFile(filepath.Join(root, "b", "bad"), []byte("hello w0rld"), 0o644)
+	os.Remove(filepath.Join(root, "b", "gone"))
+
+	// Without a source the damage is only reported.
+	report, err := s.run(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Objects != 5 || report.Corrupt != 1 || report.Missing != 1 || report.Skipped != 1 || report.Repaired != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	problems := map[string]string{}
+	for _, f := range report.Findings {
+		problems[f.Key] = f.Problem
+	}
+	if problems["bad"] != scrubCorrupt || problems["gone"] != scrubMissing || len(problems) != 2 {
+		t.Errorf("findings = %v", problems)
+	}
+
+	repairedBefore := testutil.ToFloat64(metrics.ScrubObjectsTotal.WithLabelValues(scrubRepaired))
+	s.source = mapSource{"b/bad": "hello world", "b/gone": "soon missing"}
+	if report, err = s.run(context.Background(), "b"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Repaired != 2 {
+		t.Fatalf("report = %+v, want both objects repaired", report)
+	}
+	if got := testutil.ToFloat64(metrics.ScrubObjectsTotal.WithLabelValues(scrubRepaired)); got != repairedBefore+2 {
+		t.Errorf("repaired counter rose by %v, want 2", got-repairedBefore)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "b", "bad")); string(data) != "hello world" {
+		t.Errorf("repaired data = %q", data)
+	}
+
+	if report, err = s.run(context.Background(), "b"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Corrupt != 0 || report.Missing != 0 {
+		t.Errorf("after repair report = %+v", report)
+	}
+}
+
+func TestScrubRejectsBadSourceCopy(t *testing.T) {
+	s, root := newTestScrubber(t)
+	putScrubObject(t, s, "k", "hello world", "", nil)
+	os.WriteFile(filepath.Join(root, "b", "k"), []byte("hello w0rld"), 0o644)
+	s.source = mapSource{"b/k": "hellO world"}
+
+	report, err := s.run(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Repaired != 0 || len(report.Findings) != 1 || report.Findings[0].RepairError == "" {
+		t.Fatalf("report = %+v, want the repair refused", report)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "b", "k")); string(data) != "hello w0rld" {
+		t.Errorf("data after refused repair = %q", data)
+	}
+}
+
+func TestScrubCompressedObject(t *testing.T) {
+	s, _ := newTestScrubber(t)
+	ctx := context.Background()
+	data := strings.Repeat("compressed ", 100)
+	rc, err := storage.CompressReader(storage.CodecZstd, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.store.PutObject(ctx, "b", "z", rc, -1)
+	rc.Close()
+	s.meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "b", Key: "z", Size: int64(len(data)),
+		ETag: fmt.Sprintf(`"%x"`, md5.Sum([]byte(data))), Compression: storage.CodecZstd, LastModified: time.Now().UTC()})
+
+	report, err := s.run(ctx, "b")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Objects != 1 || report.Corrupt != 0 || report.Bytes != int64(len(data)) {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestScrubPacesReads(t *testing.T) {
+	p := &pacer{rate: 10000, start: time.Now()}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, p.reader(context.Background(), bytes.NewReader(make([]byte, 2000))))
+	if err != nil || n != 2000 {
+		t.Fatalf("Copy = %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("read 2000 bytes at 10000 B/s in %v", elapsed)
+	}
+}
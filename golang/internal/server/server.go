@@ -3,17 +3,30 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/clock"
 	"github.com/bleepstore/bleepstore/internal/config"
 	s3err "github.com/bleepstore/bleepstore/internal/errors"
 	"github.com/bleepstore/bleepstore/internal/handlers"
+	"github.com/bleepstore/bleepstore/internal/inventory"
 	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/quota"
+	"github.com/bleepstore/bleepstore/internal/replication"
+	"github.com/bleepstore/bleepstore/internal/s3op"
 	"github.com/bleepstore/bleepstore/internal/storage"
 	"github.com/bleepstore/bleepstore/internal/xmlutil"
 
@@ -52,11 +65,48 @@ type Server struct {
 	meta        metadata.MetadataStore
 	store       storage.StorageBackend
 	verifier    *auth.SigV4Verifier
+	authn       Authenticator
+	secrets     *metadata.SecretSealer // nil stores secret keys in plaintext
 	bucket      *handlers.BucketHandler
 	object      *handlers.ObjectHandler
 	multi       *handlers.MultipartHandler
 	httpServer  *http.Server
+	redirectSrv *http.Server
 	patchedSpec []byte
+	surfaceJSON []byte // generated description served at /admin/v1/openapi.json
+	usage       *usageAggregator
+	limiter     *rateLimiter
+	limitState  *rateLimitPersister
+	activity    *activityTracker
+	defrag      *defragmenter
+	maintainer  *maintainer
+	compactor   *compactor
+	collector   *blobCollector
+	orphans     *orphanCollector
+	scrub       *scrubber
+	prefetch    *prefetcher
+	replicator  *replicator
+	bucketRepl  *bucketReplicator
+	replVerify  *replicationVerifier
+	websites    metadata.WebsiteStore // nil = buckets have no website configurations
+	inventory   *inventoryWriter
+	erasure     *eraser
+	freezes     metadata.BucketFreezeStore
+	requestLog  *requestLogger
+	watches     *watchHub
+	writes      *writeGate // closed while a backup hook quiesces writes
+	backup      *backupHooks
+	jobs        *jobRegistry
+	ha          *leaderElector
+	readOnly    bool       // replica: S3 writes are rejected
+	provisionMu sync.Mutex // one manifest diff or apply at a time
+	idempotency idempotencyKeys
+	operations  map[s3op.Operation]http.HandlerFunc
+	disabledOps map[s3op.Operation]bool
+	resolver    *bucketResolver
+	clock       clock.Clock
+	ids         clock.IDGenerator
+	hooks       hooks
 }
 
 // HealthBody is the JSON body returned by the health check endpoint.
@@ -73,6 +123,7 @@ type HealthOutput struct {
 type componentCheck struct {
 	Status    string `json:"status"`
 	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
 }
 
 // healthDetailResponse is the enhanced health response with component checks.
@@ -98,6 +149,22 @@ func WithStorageBackend(store storage.StorageBackend) ServerOption {
 	}
 }
 
+// WithClock sets the clock used for timestamps, request signing checks and
+// upload expiry. Tests use it with a clock.Fake.
+func WithClock(c clock.Clock) ServerOption {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
+
+// WithIDGenerator sets the source of upload IDs and request IDs. Tests use
+// it with a clock.Sequence.
+func WithIDGenerator(ids clock.IDGenerator) ServerOption {
+	return func(s *Server) {
+		s.ids = ids
+	}
+}
+
 // New creates a new Server with the given configuration and wires up all
 // S3-compatible routes on the Chi router with Huma API.
 // Use ServerOption functions to provide metadata store and storage backend.
@@ -139,6 +206,9 @@ func New(cfg *config.Config, args ...interface{}) (*Server, error) {
 		router:      router,
 		api:         api,
 		patchedSpec: patchedBytes,
+		clock:       clock.System{},
+		ids:         clock.Random{},
+		writes:      &writeGate{},
 	}
 
 	// Process arguments: support both old-style (MetadataStore) and new-style (ServerOption).
@@ -151,21 +221,498 @@ func New(cfg *config.Config, args ...interface{}) (*Server, error) {
 		}
 	}
 
+	s.jobs = newJobRegistry(s.clock, s.ids)
+
 	// Determine owner info from config.
 	ownerID := cfg.Auth.AccessKey
 	ownerDisplay := cfg.Auth.AccessKey
 	region := cfg.Server.Region
 
+	if n := cfg.Auth.PresignedMaxExpirySeconds; n < 0 || n > 604800 {
+		return nil, fmt.Errorf("auth.presigned_max_expiry_seconds: %d must be 0 (default) or between 1 and 604800", n)
+	}
+	if cfg.Auth.ClockSkewSeconds < 0 {
+		return nil, fmt.Errorf("auth.clock_skew_seconds: %d is negative", cfg.Auth.ClockSkewSeconds)
+	}
+	if cfg.Auth.MaxRequestAgeSeconds < 0 {
+		return nil, fmt.Errorf("auth.max_request_age_seconds: %d is negative", cfg.Auth.MaxRequestAgeSeconds)
+	}
+
 	// Create SigV4 verifier if metadata store is available.
 	if s.meta != nil {
 		s.verifier = auth.NewSigV4Verifier(s.meta, region)
+		s.verifier.AcceptedRegions = cfg.Server.AcceptedRegions
+		s.verifier.MaxPresignedExpiry = cfg.Auth.PresignedMaxExpirySeconds
+		s.verifier.ClockSkew = time.Duration(cfg.Auth.ClockSkewSeconds) * time.Second
+		s.verifier.MaxRequestAge = time.Duration(cfg.Auth.MaxRequestAgeSeconds) * time.Second
+		if cfg.Server.TLS.Enabled && cfg.Server.TLS.ClientAuth.Mode != "none" {
+			s.verifier.CertSubjects = cfg.Server.TLS.ClientAuth.Subjects
+		}
+		if cfg.Auth.Delegation.Secret != "" {
+			s.verifier.DelegationSecret = []byte(cfg.Auth.Delegation.Secret)
+		}
+		if oc := cfg.Auth.OIDC; oc.Issuer != "" {
+			s.verifier.OIDC = auth.NewOIDCVerifier(oc.Issuer)
+			s.verifier.OIDC.Audience = oc.Audience
+			s.verifier.OIDC.JWKSURL = oc.JWKSURL
+			if oc.OwnerClaim != "" {
+				s.verifier.OIDC.OwnerClaim = oc.OwnerClaim
+			}
+			if oc.PermissionsClaim != "" {
+				s.verifier.OIDC.PermissionsClaim = oc.PermissionsClaim
+			}
+			s.verifier.OIDC.Clock = s.clock
+		}
+		s.verifier.AllowAnonymous = cfg.Auth.EnforceACLs
+		if cfg.Auth.MasterKey != "" {
+			sealer, err := metadata.NewSecretSealer(cfg.Auth.MasterKey)
+			if err != nil {
+				return nil, fmt.Errorf("auth.master_key: %w", err)
+			}
+			s.secrets = sealer
+			s.verifier.Secrets = sealer
+		}
+		s.verifier.Clock = s.clock
+		if s.authn == nil {
+			s.authn = sigv4Authenticator{s.verifier}
+		}
+	}
+
+	// Metadata stores that stamp times themselves share the server clock.
+	if cs, ok := s.meta.(interface{ SetClock(clock.Clock) }); ok {
+		cs.SetClock(s.clock)
+	}
+
+	// With Server-Timing enabled, handlers see stores that attribute their
+	// call durations to the request. Optional-interface checks below keep
+	// using the unwrapped stores.
+	handlerMeta, handlerStore := s.meta, s.store
+	if cfg.Observability.ServerTiming {
+		if s.meta != nil {
+			handlerMeta = timedMetadataStore{s.meta}
+		}
+		if s.store != nil {
+			handlerStore = timedStorageBackend{s.store}
+		}
 	}
 
 	// Create handlers with injected dependencies.
 	maxObjectSize := cfg.Server.MaxObjectSize
-	s.bucket = handlers.NewBucketHandler(s.meta, s.store, ownerID, ownerDisplay, region)
-	s.object = handlers.NewObjectHandler(s.meta, s.store, ownerID, ownerDisplay, maxObjectSize)
-	s.multi = handlers.NewMultipartHandler(s.meta, s.store, ownerID, ownerDisplay, maxObjectSize)
+	s.bucket = handlers.NewBucketHandler(handlerMeta, handlerStore, ownerID, ownerDisplay, region)
+	s.bucket.SetBucketRegions(cfg.Server.BucketRegions)
+	s.object = handlers.NewObjectHandler(handlerMeta, handlerStore, ownerID, ownerDisplay, maxObjectSize)
+	s.multi = handlers.NewMultipartHandler(handlerMeta, handlerStore, ownerID, ownerDisplay, maxObjectSize)
+	s.bucket.SetClock(s.clock)
+	s.object.SetClock(s.clock)
+	s.multi.SetClock(s.clock)
+	s.multi.SetIDGenerator(s.ids)
+	s.operations = s.operationHandlers()
+	for _, name := range cfg.Server.DisabledOperations {
+		op := s3op.Operation(name)
+		if !op.Known() {
+			return nil, fmt.Errorf("server.disabled_operations: unknown operation %q", name)
+		}
+		if s.disabledOps == nil {
+			s.disabledOps = make(map[s3op.Operation]bool)
+		}
+		s.disabledOps[op] = true
+	}
+
+	switch mode := cfg.Server.MultiRange; mode {
+	case "", handlers.MultiRangeMultipart, handlers.MultiRangeIgnore, handlers.MultiRangeReject:
+		s.object.SetMultiRange(mode)
+	default:
+		return nil, fmt.Errorf("server.multi_range: unknown mode %q", mode)
+	}
+
+	if rate := cfg.Logging.RequestSampleRate; rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("logging.request_sample_rate: %v is not between 0 and 1", rate)
+	}
+	s.requestLog = newRequestLogger(cfg.Logging.RequestSampleRate, s.clock)
+	s.watches = newWatchHub()
+
+	// Buckets frozen read-only, when the metadata store records them.
+	if fs, ok := s.meta.(metadata.BucketFreezeStore); ok {
+		s.freezes = fs
+	}
+
+	// Commit conditional writes atomically when the metadata store can.
+	if cs, ok := s.meta.(metadata.ConditionalPutStore); ok {
+		s.object.SetConditionalPuts(cs)
+	}
+
+	// Store small objects in their metadata row when the metadata store can
+	// hold the payload.
+	if n := cfg.Storage.InlineThresholdBytes; n > 0 {
+		if is, ok := s.meta.(metadata.InlineDataStore); ok && is.SupportsInlineData() {
+			s.object.SetInlineThreshold(n)
+		} else {
+			slog.Info("Inline small objects enabled but not supported by the metadata engine",
+				"metadata", cfg.Metadata.Engine)
+		}
+	}
+
+	// Compress new object data at rest on the local backend.
+	if codec := cfg.Storage.Local.Compression.Codec; codec != "" {
+		if !storage.ValidCodec(codec) {
+			return nil, fmt.Errorf("storage.local.compression: unknown codec %q", codec)
+		}
+		if cfg.Storage.Backend == "local" {
+			s.object.SetCompression(codec, cfg.Storage.Local.Compression.Buckets)
+		} else {
+			slog.Info("Compression at rest enabled but not supported by the storage backend",
+				"storage", cfg.Storage.Backend)
+		}
+	}
+
+	// Enable background defragmentation when both the metadata store (for
+	// the durable work queue) and the storage backend support it.
+	if cfg.Storage.Defrag.Enabled {
+		queue, qok := s.meta.(metadata.DefragQueue)
+		df, dok := s.store.(storage.Defragmenter)
+		if qok && dok {
+			s.activity = &activityTracker{}
+			s.defrag = &defragmenter{
+				queue:    queue,
+				meta:     s.meta,
+				store:    df,
+				activity: s.activity,
+				idle:     time.Duration(cfg.Storage.Defrag.IdleSeconds) * time.Second,
+				interval: time.Duration(cfg.Storage.Defrag.IntervalSeconds) * time.Second,
+				gate:     s.writes,
+				jobs:     s.jobs,
+				stopCh:   make(chan struct{}),
+			}
+			s.multi.SetDefragQueue(queue)
+		} else {
+			slog.Info("Defragmentation enabled but not supported by the configured backends",
+				"metadata", cfg.Metadata.Engine, "storage", cfg.Storage.Backend)
+		}
+	}
+
+	// Bucket replication rules, and the worker copying the writes and
+	// deletes they select to the remote endpoint.
+	if rcfg := cfg.BucketReplication; rcfg.Enabled {
+		queue, ok := s.meta.(metadata.ReplicationStore)
+		if !ok {
+			return nil, fmt.Errorf("bucket_replication: not supported by metadata engine %q", cfg.Metadata.Engine)
+		}
+		rules, err := replication.New(context.Background(), queue)
+		if err != nil {
+			return nil, fmt.Errorf("loading bucket replication rules: %w", err)
+		}
+		target, err := storage.NewS3Target(context.Background(), rcfg.Region, rcfg.EndpointURL,
+			rcfg.UsePathStyle, rcfg.AccessKeyID, rcfg.SecretAccessKey)
+		if err != nil {
+			return nil, fmt.Errorf("bucket_replication: %w", err)
+		}
+		s.bucket.SetReplication(rules)
+		s.object.SetReplication(rules)
+		s.multi.SetReplication(rules)
+		s.bucketRepl = &bucketReplicator{
+			meta:        s.meta,
+			queue:       queue,
+			store:       s.store,
+			rules:       rules,
+			target:      target,
+			interval:    time.Duration(rcfg.PollIntervalMillis) * time.Millisecond,
+			maxAttempts: rcfg.MaxAttempts,
+			clock:       s.clock,
+			gate:        s.writes,
+			freezes:     s.freezes,
+			stopCh:      make(chan struct{}),
+		}
+		if vcfg := rcfg.Verify; vcfg.ReportBucket != "" {
+			if vcfg.SampleRate <= 0 || vcfg.SampleRate > 1 {
+				return nil, fmt.Errorf("bucket_replication.verify.sample_rate must be in (0, 1], got %v", vcfg.SampleRate)
+			}
+			s.replVerify = &replicationVerifier{
+				meta:         s.meta,
+				store:        s.store,
+				rules:        rules,
+				target:       target,
+				dispatch:     s.probeRequest,
+				clock:        s.clock,
+				sampleRate:   vcfg.SampleRate,
+				reportBucket: vcfg.ReportBucket,
+				reportPrefix: vcfg.ReportPrefix,
+				interval:     time.Duration(vcfg.IntervalSeconds) * time.Second,
+				gate:         s.writes,
+				jobs:         s.jobs,
+				stopCh:       make(chan struct{}),
+			}
+		}
+	} else {
+		delete(s.operations, s3op.PutBucketReplication)
+		delete(s.operations, s3op.GetBucketReplication)
+		delete(s.operations, s3op.DeleteBucketReplication)
+	}
+
+	// Bucket inventory configurations, and the worker writing the reports
+	// they schedule.
+	if icfg := cfg.Inventory; icfg.Enabled {
+		store, ok := s.meta.(metadata.InventoryStore)
+		if !ok {
+			return nil, fmt.Errorf("inventory: not supported by metadata engine %q", cfg.Metadata.Engine)
+		}
+		configs, err := inventory.New(context.Background(), store)
+		if err != nil {
+			return nil, fmt.Errorf("loading inventory configurations: %w", err)
+		}
+		s.bucket.SetInventory(configs)
+		s.inventory = &inventoryWriter{
+			meta:     s.meta,
+			configs:  configs,
+			dispatch: s.probeRequest,
+			clock:    s.clock,
+			ids:      s.ids,
+			interval: time.Duration(icfg.CheckIntervalSeconds) * time.Second,
+			gate:     s.writes,
+			jobs:     s.jobs,
+			stopCh:   make(chan struct{}),
+		}
+	} else {
+		delete(s.operations, s3op.PutBucketInventoryConfiguration)
+		delete(s.operations, s3op.GetBucketInventoryConfiguration)
+		delete(s.operations, s3op.ListBucketInventoryConfigurations)
+		delete(s.operations, s3op.DeleteBucketInventoryConfiguration)
+	}
+
+	// Erasure requests, executed on demand with signed reports.
+	if ecfg := cfg.ErasureRequests; ecfg.Enabled {
+		requests, ok := s.meta.(metadata.ErasureRequestStore)
+		if !ok {
+			return nil, fmt.Errorf("erasure_requests: not supported by metadata engine %q", cfg.Metadata.Engine)
+		}
+		if ecfg.SigningKey == "" {
+			return nil, fmt.Errorf("erasure_requests: signing_key is required")
+		}
+		s.erasure = &eraser{
+			meta:     s.meta,
+			requests: requests,
+			store:    s.store,
+			repl:     s.bucketRepl,
+			freezes:  s.freezes,
+			dispatch: s.probeRequest,
+			clock:    s.clock,
+			ids:      s.ids,
+			key:      []byte(ecfg.SigningKey),
+		}
+	}
+
+	// Warm objects named in x-bleepstore-prefetch hints when the storage
+	// backend has a cache worth warming.
+	if pcfg := cfg.Storage.Prefetch; pcfg.Enabled {
+		if pl, ok := s.store.(storage.Preloader); ok {
+			s.prefetch = newPrefetcher(pl, pcfg.Workers, pcfg.QueueSize)
+			s.object.SetPrefetch(func(bucket string, keys []string) {
+				s.prefetch.enqueue(bucket, keys)
+			})
+		} else {
+			slog.Info("Prefetch hints enabled but not supported by the storage backend",
+				"storage", cfg.Storage.Backend)
+		}
+	}
+
+	// Periodic WAL checkpoints, vacuuming and ANALYZE for the SQLite
+	// metadata database.
+	if mcfg := cfg.Metadata.SQLite.Maintenance; mcfg.Enabled {
+		if store, ok := s.meta.(metadata.Maintainer); ok {
+			s.maintainer = &maintainer{
+				store:       store,
+				checkpoint:  time.Duration(mcfg.CheckpointIntervalSeconds) * time.Second,
+				vacuum:      time.Duration(mcfg.VacuumIntervalSeconds) * time.Second,
+				vacuumPages: mcfg.VacuumPages,
+				analyze:     time.Duration(mcfg.AnalyzeIntervalSeconds) * time.Second,
+				gate:        s.writes,
+				stopCh:      make(chan struct{}),
+			}
+		} else {
+			slog.Info("Metadata maintenance enabled but not supported by the metadata engine",
+				"metadata", cfg.Metadata.Engine)
+		}
+	}
+
+	// Periodic compaction of packed small-object segments.
+	if c, ok := s.store.(storage.Compactor); ok {
+		s.compactor = &compactor{
+			store:    c,
+			interval: time.Duration(cfg.Storage.Local.Pack.CompactIntervalSeconds) * time.Second,
+			gate:     s.writes,
+			jobs:     s.jobs,
+			stopCh:   make(chan struct{}),
+		}
+	}
+
+	// Periodic removal of unreferenced deduplicated blobs.
+	if g, ok := s.store.(storage.GarbageCollector); ok {
+		s.collector = &blobCollector{
+			store:    g,
+			interval: time.Duration(cfg.Storage.Dedup.GCIntervalSeconds) * time.Second,
+			gate:     s.writes,
+			jobs:     s.jobs,
+			stopCh:   make(chan struct{}),
+		}
+	}
+
+	// Removal of data files without metadata, on demand and optionally
+	// periodically.
+	if o, ok := s.store.(storage.OrphanSweeper); ok && s.meta != nil {
+		oc := cfg.Storage.Local.OrphanGC
+		s.orphans = &orphanCollector{
+			meta:       s.meta,
+			store:      o,
+			minAge:     time.Duration(oc.MinAgeSeconds) * time.Second,
+			quarantine: oc.Quarantine,
+			dryRun:     oc.DryRun,
+			interval:   time.Duration(oc.IntervalSeconds) * time.Second,
+			periodic:   oc.Enabled,
+			gate:       s.writes,
+			jobs:       s.jobs,
+			stopCh:     make(chan struct{}),
+		}
+	}
+
+	// Periodic re-hashing of stored objects, repairing damage from a copy.
+	if sc := cfg.Storage.Scrub; sc.Enabled {
+		s.scrub = &scrubber{
+			meta:     s.meta,
+			store:    s.store,
+			rate:     sc.BytesPerSecond,
+			interval: time.Duration(sc.IntervalSeconds) * time.Second,
+			gate:     s.writes,
+			jobs:     s.jobs,
+			stopCh:   make(chan struct{}),
+		}
+		if sc.Repair {
+			src := sc.RepairSource
+			source, err := storage.NewS3Source(context.Background(), src.Bucket, src.Prefix, src.Region,
+				src.EndpointURL, src.UsePathStyle, src.AccessKeyID, src.SecretAccessKey)
+			if err != nil {
+				return nil, fmt.Errorf("storage.scrub.repair_source: %w", err)
+			}
+			s.scrub.source = source
+		}
+	}
+
+	// Memory backend replication between a primary and a replica.
+	s.replicator, err = newReplicator(cfg, s.store)
+	if err != nil {
+		return nil, fmt.Errorf("storage.memory.replication: %w", err)
+	}
+	s.readOnly = s.replicator != nil && cfg.Storage.Memory.Replication.Role == "replica"
+
+	// Virtual-hosted-style addressing, access point ARNs and bucket aliases.
+	s.resolver, err = newBucketResolver(cfg.Server)
+	if err != nil {
+		return nil, fmt.Errorf("configuring bucket aliases: %w", err)
+	}
+	if d := strings.TrimPrefix(cfg.Server.Website.Domain, "."); d != "" &&
+		strings.EqualFold(d, strings.TrimPrefix(cfg.Server.VirtualHostDomain, ".")) {
+		return nil, fmt.Errorf("server.website.domain: %q is also the virtual host domain", d)
+	}
+
+	// Bucket website configurations, which the website endpoint serves
+	// buckets by.
+	if store, ok := s.meta.(metadata.WebsiteStore); ok && websiteEnabled(cfg.Server) {
+		s.websites = store
+		s.bucket.SetWebsite(store)
+	} else {
+		delete(s.operations, s3op.PutBucketWebsite)
+		delete(s.operations, s3op.GetBucketWebsite)
+		delete(s.operations, s3op.DeleteBucketWebsite)
+	}
+
+	// Prefix quotas are enforced by the object and multipart handlers.
+	quotas, err := quota.New(s.meta, cfg.Server.PrefixQuotas)
+	if err != nil {
+		return nil, fmt.Errorf("configuring prefix quotas: %w", err)
+	}
+	s.object.SetQuotas(quotas)
+	s.multi.SetQuotas(quotas)
+
+	// The rate limiter always exists so that a config reload can enable it.
+	s.limiter = newRateLimiter(cfg.RateLimit)
+	if secs := cfg.RateLimit.PersistIntervalSeconds; secs > 0 {
+		if ls, ok := s.meta.(metadata.RateLimitStateStore); ok {
+			p, err := newRateLimitPersister(s.limiter, ls, time.Duration(secs)*time.Second)
+			if err != nil {
+				return nil, fmt.Errorf("restoring rate limit state: %w", err)
+			}
+			s.limitState = p
+			s.limitState.gate = s.writes
+		} else {
+			slog.Warn("Rate limit persistence enabled but metadata engine does not support it", "engine", cfg.Metadata.Engine)
+		}
+	}
+
+	// Enable usage accounting if configured and supported by the metadata store.
+	if cfg.Observability.Usage.Enabled {
+		if us, ok := s.meta.(metadata.UsageStore); ok {
+			interval := time.Duration(cfg.Observability.Usage.FlushIntervalSeconds) * time.Second
+			if interval <= 0 {
+				interval = 60 * time.Second
+			}
+			s.usage = newUsageAggregator(us, interval, s.clock)
+			s.usage.gate = s.writes
+		} else {
+			slog.Warn("Usage accounting enabled but metadata engine does not support it", "engine", cfg.Metadata.Engine)
+		}
+	}
+
+	// Pre/post backup hooks quiescing writes around a filesystem-level backup.
+	bcfg := cfg.BackupHooks
+	s.backup = &backupHooks{
+		gate:         s.writes,
+		meta:         s.meta,
+		clock:        s.clock,
+		ids:          s.ids,
+		drainTimeout: time.Duration(bcfg.DrainTimeoutMillis) * time.Millisecond,
+		maxQuiesce:   time.Duration(bcfg.MaxQuiesceMillis) * time.Millisecond,
+		markerPath:   bcfg.MarkerPath,
+		engine:       cfg.Metadata.Engine,
+		backend:      cfg.Storage.Backend,
+	}
+	if s.backup.drainTimeout <= 0 {
+		s.backup.drainTimeout = 30 * time.Second
+	}
+	if s.backup.maxQuiesce <= 0 {
+		s.backup.maxQuiesce = 10 * time.Minute
+	}
+	if s.backup.markerPath == "" {
+		s.backup.markerPath = filepath.Join(filepath.Dir(cfg.Metadata.SQLite.Path), "backup-marker.json")
+	}
+
+	// Leader election between the instances of an active-passive pair.
+	if hcfg := cfg.HA; hcfg.Enabled {
+		leases, ok := s.meta.(metadata.LeaseStore)
+		if !ok {
+			return nil, fmt.Errorf("ha: not supported by metadata engine %q", cfg.Metadata.Engine)
+		}
+		ttl := time.Duration(hcfg.LeaseTTLMillis) * time.Millisecond
+		renew := time.Duration(hcfg.RenewIntervalMillis) * time.Millisecond
+		if renew <= 0 || renew >= ttl {
+			return nil, fmt.Errorf("ha: renew_interval_ms must be positive and below lease_ttl_ms")
+		}
+		node := hcfg.NodeID
+		if node == "" {
+			host, _ := os.Hostname()
+			node = net.JoinHostPort(host, strconv.Itoa(cfg.Server.Port))
+		}
+		s.ha = &leaderElector{
+			store:  leases,
+			clock:  s.clock,
+			node:   node,
+			ttl:    ttl,
+			renew:  renew,
+			stopCh: make(chan struct{}),
+		}
+		s.writes.standby = func() bool { return !s.ha.isLeader() }
+	}
+
+	if s.surfaceJSON, err = s.surfaceSpec(); err != nil {
+		return nil, fmt.Errorf("building surface description: %w", err)
+	}
 
 	s.registerRoutes()
 	return s, nil
@@ -173,24 +720,171 @@ func New(cfg *config.Config, args ...interface{}) (*Server, error) {
 
 // ListenAndServe starts the HTTP server on the given address.
 // The returned http.Server is stored so it can be shut down gracefully.
-// Middleware chain: metricsMiddleware -> commonHeaders -> authMiddleware -> router.
+// When server.tls is enabled the address serves HTTPS, and an optional
+// plain listener on server.tls.http_port redirects to it.
+// Middleware chain: metricsMiddleware -> commonHeaders -> clientRateLimit ->
+// pre-auth hooks -> authMiddleware -> post-auth hooks -> pre-handler hooks -> router.
 func (s *Server) ListenAndServe(addr string) error {
+	tlsCfg := s.cfg.Server.TLS
+	var (
+		tlsConfig *tls.Config
+		challenge func(http.Handler) http.Handler
+	)
+	if tlsCfg.Enabled {
+		var err error
+		tlsConfig, challenge, err = newTLSConfig(tlsCfg, s.cfg.Server.CustomDomains)
+		if err != nil {
+			return fmt.Errorf("configuring TLS: %w", err)
+		}
+	}
+
+	handler := s.buildHandler()
+	if s.ha != nil {
+		s.ha.start()
+	}
+	if s.usage != nil {
+		s.usage.start()
+	}
+	if s.limitState != nil {
+		s.limitState.start()
+	}
+	if s.defrag != nil {
+		s.defrag.start()
+	}
+	if s.maintainer != nil {
+		s.maintainer.start()
+	}
+	if s.compactor != nil {
+		s.compactor.start()
+	}
+	if s.collector != nil {
+		s.collector.start()
+	}
+	if s.orphans != nil {
+		s.orphans.start()
+	}
+	if s.scrub != nil {
+		s.scrub.start()
+	}
+	if s.bucketRepl != nil {
+		s.bucketRepl.start()
+	}
+	if s.replVerify != nil {
+		s.replVerify.start()
+	}
+	if s.inventory != nil {
+		s.inventory.start()
+	}
+	if s.prefetch != nil {
+		s.prefetch.start()
+	}
+	if s.replicator != nil {
+		if s.readOnly {
+			s.replicator.start()
+		} else if s.replicator.store.Empty() {
+			// Copy the replica's objects before listening, so the replica
+			// cannot resync from this instance while it is still empty.
+			slog.Info("Primary storage is empty; copying objects from replica", "peer", s.replicator.peer)
+			if err := s.replicator.bootstrap(); err != nil {
+				slog.Warn("Could not copy objects from replica; starting empty", "peer", s.replicator.peer, "error", err)
+			}
+		}
+	}
+
+	if err := s.provision(context.Background()); err != nil {
+		return fmt.Errorf("provisioning: %w", err)
+	}
+
+	s.httpServer = &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	if tlsConfig == nil {
+		return s.httpServer.ListenAndServe()
+	}
+
+	if tlsCfg.HTTPPort > 0 {
+		s.redirectSrv = &http.Server{
+			Addr:              net.JoinHostPort(s.cfg.Server.Host, strconv.Itoa(tlsCfg.HTTPPort)),
+			Handler:           challenge(httpsRedirectHandler(s.cfg.Server.Port)),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Info("HTTP redirect listening", "addr", s.redirectSrv.Addr)
+			if err := s.redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("HTTP redirect listener error", "error", err)
+			}
+		}()
+	}
+	return s.httpServer.ListenAndServeTLS("", "")
+}
+
+// buildHandler assembles the middleware chain around the router, including
+// any middleware and response hooks registered with WithMiddleware and
+// WithResponseHook.
+func (s *Server) buildHandler() http.Handler {
 	var handler http.Handler = s.router
 	// Rewrite x-amz-meta-* headers to lowercase (must be innermost wrapper).
 	handler = metadataHeaderMiddleware(handler)
-	// Wrap with auth middleware if verifier is available.
-	if s.verifier != nil {
-		handler = auth.Middleware(s.verifier)(handler)
+	// Embedder middleware sees the resolved path just before routing.
+	handler = s.hooks.wrap(StagePreHandler, handler)
+	// Resolve virtual hosts, access point ARNs and aliases (must sit inside
+	// auth, which verifies the path as the client signed it).
+	handler = bucketResolverMiddleware(s.resolver)(handler)
+	// Record per-access-key usage (must sit inside auth to see the access key).
+	if s.usage != nil {
+		handler = usageMiddleware(s.usage)(handler)
+	}
+	// Per-access-key rate limit (must sit inside auth to see the access key).
+	handler = accessKeyRateLimitMiddleware(s.limiter)(handler)
+	// Embedder middleware for authenticated requests (custom authz).
+	handler = s.hooks.wrap(StagePostAuth, handler)
+	// Wrap with auth middleware if an authenticator is available.
+	if s.cfg.Observability.ServerTiming {
+		handler = authTimingMiddleware(handler)
+	}
+	if s.authn != nil {
+		handler = s.authMiddleware(handler)
 	}
+	// Flag deprecated client behavior as the client sent it, before auth
+	// normalizes the request.
+	handler = deprecationMiddleware(handler)
+	if s.cfg.Observability.ServerTiming {
+		handler = serverTimingMiddleware(handler)
+	}
+	// Embedder middleware for every request that passed rate limiting.
+	handler = s.hooks.wrap(StagePreAuth, handler)
+	// The website endpoint is anonymous, so it answers before auth.
+	if websiteEnabled(s.cfg.Server) {
+		handler = s.websiteMiddleware(handler)
+	}
+	// Global and per-IP rate limits run before auth to shed load cheaply.
+	handler = clientRateLimitMiddleware(s.limiter)(handler)
+	// Oversized bodies are refused before auth buffers or hashes them.
+	handler = bodySizeLimit(s.cfg.Server.MaxObjectSize)(handler)
 	handler = transferEncodingCheck(handler)
-	handler = commonHeaders(handler)
+	// Panics become InternalError responses carrying the request ID (must
+	// sit inside compression, so a partial response is never flushed).
+	handler = recoveryMiddleware(handler)
+	if s.cfg.Server.Compression.Enabled {
+		handler = compressionMiddleware(s.cfg.Server.Compression)(handler)
+	}
+	handler = commonHeaders(s.clock, s.ids)(handler)
+	// Response hooks see the final status, including the common headers.
+	handler = s.hooks.responseHookMiddleware(handler)
 	handler = metricsMiddleware(handler)
-
-	s.httpServer = &http.Server{
-		Addr:    addr,
-		Handler: handler,
+	// Track request activity so background defragmentation runs only when idle.
+	if s.defrag != nil {
+		handler = s.activity.middleware(handler)
 	}
-	return s.httpServer.ListenAndServe()
+	return handler
+}
+
+// ReloadRateLimits replaces the active rate limits without restarting the
+// server. Used by the SIGHUP config reload.
+func (s *Server) ReloadRateLimits(cfg config.RateLimitConfig) {
+	s.limiter.update(cfg)
 }
 
 // Shutdown gracefully shuts down the HTTP server, waiting for in-flight
@@ -199,7 +893,58 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	if s.httpServer == nil {
 		return nil
 	}
-	return s.httpServer.Shutdown(ctx)
+	err := s.httpServer.Shutdown(ctx)
+	if s.redirectSrv != nil {
+		s.redirectSrv.Shutdown(ctx)
+	}
+	s.jobs.stop()
+	if s.defrag != nil {
+		s.defrag.stop()
+	}
+	if s.maintainer != nil {
+		s.maintainer.stop()
+	}
+	if s.compactor != nil {
+		s.compactor.stop()
+	}
+	if s.collector != nil {
+		s.collector.stop()
+	}
+	if s.orphans != nil {
+		s.orphans.stop()
+	}
+	if s.scrub != nil {
+		s.scrub.stop()
+	}
+	if s.bucketRepl != nil {
+		s.bucketRepl.stop()
+	}
+	if s.replVerify != nil {
+		s.replVerify.stop()
+	}
+	if s.inventory != nil {
+		s.inventory.stop()
+	}
+	if s.prefetch != nil {
+		s.prefetch.stop()
+	}
+	if s.readOnly {
+		s.replicator.stop()
+	}
+	if s.ha != nil {
+		s.ha.stop()
+	}
+	if s.usage != nil {
+		if flushErr := s.usage.stop(ctx); flushErr != nil {
+			slog.Error("Usage flush error", "error", flushErr)
+		}
+	}
+	if s.limitState != nil {
+		if saveErr := s.limitState.stop(ctx); saveErr != nil {
+			slog.Error("Rate limit state save error", "error", saveErr)
+		}
+	}
+	return err
 }
 
 // registerRoutes configures all routes on the Chi router.
@@ -240,6 +985,101 @@ func (s *Server) registerRoutes() {
 	// observability test compatibility).
 	s.router.Handle("/metrics", promhttp.Handler())
 
+	// The admin API answers the root access key only.
+	s.router.Group(func(r chi.Router) {
+		r.Use(s.rootOnly)
+
+		// Per-access-key usage report (501 when accounting is disabled).
+		r.Get("/admin/usage", s.handleUsage)
+
+		// Running and recent long-running operations, and cancelling them.
+		r.Get("/admin/jobs", s.handleListJobs)
+		r.Get("/admin/jobs/{id}", s.handleGetJob)
+		r.Post("/admin/jobs/{id}/cancel", s.handleCancelJob)
+
+		// Online rebalance of multi-root local storage.
+		r.Post("/admin/rebalance", s.handleRebalance)
+
+		// Restore lost parity or copies after a disk failure (501 when the
+		// backend keeps no redundancy).
+		r.Post("/admin/rebuild", s.handleRebuild)
+
+		// Copy placement of replicated storage (501 when the backend keeps
+		// a single copy).
+		r.Get("/admin/placement", s.handlePlacement)
+
+		// Warm the storage cache for a bucket prefix ahead of load.
+		r.Post("/admin/preload", s.handlePreload)
+
+		// Remove data files without metadata now (501 unless the backend
+		// stores each object in its own file).
+		r.Post("/admin/orphans", s.handleOrphans)
+
+		// Re-hash stored objects now (501 when scrubbing is disabled).
+		r.Post("/admin/scrub", s.handleScrub)
+
+		// Write bucket inventory reports now (501 when inventory is
+		// disabled).
+		r.Post("/admin/inventory", s.handleInventory)
+
+		// Compare replicated objects with their replicas now (501 unless
+		// bucket_replication.verify.report_bucket is set).
+		r.Post("/admin/bucket-replication/verify", s.handleReplicationVerify)
+
+		// Register, inspect and execute erasure requests (501 when erasure
+		// requests are disabled).
+		r.Post("/admin/erasure-requests", s.handleCreateErasureRequest)
+		r.Get("/admin/erasure-requests", s.handleListErasureRequests)
+		r.Get("/admin/erasure-requests/{id}", s.handleGetErasureRequest)
+		r.Post("/admin/erasure-requests/{id}/execute", s.handleExecuteErasureRequest)
+
+		// Rate limits in force and clients' token balances.
+		r.Get("/admin/rate-limits", s.handleRateLimits)
+
+		// Stream the requests to a bucket or key as they complete.
+		r.Get("/admin/watch", s.handleWatch)
+
+		// Per-bucket request logging overrides.
+		r.Get("/admin/request-logging", s.handleListRequestLogging)
+		r.Put("/admin/request-logging/{bucket}", s.handleSetRequestLogging)
+		r.Delete("/admin/request-logging/{bucket}", s.handleDeleteRequestLogging)
+
+		// List, freeze and unfreeze read-only buckets (501 unless the
+		// metadata engine records freezes).
+		r.Get("/admin/frozen-buckets", s.handleListFrozenBuckets)
+		r.Put("/admin/frozen-buckets/{bucket}", s.handleFreezeBucket)
+		r.Delete("/admin/frozen-buckets/{bucket}", s.handleUnfreezeBucket)
+
+		// Generated description of the operations and endpoints this
+		// instance serves.
+		r.Get("/admin/v1/openapi.json", s.handleSurfaceSpec)
+
+		// Deep per-bucket health check of its metadata and storage.
+		r.Get("/admin/bucket-health/{bucket}", s.handleBucketHealth)
+
+		// Declared consistency guarantees, and a write/read/list probe.
+		r.Get("/admin/consistency", s.handleConsistency)
+		r.Post("/admin/consistency", s.handleConsistency)
+
+		// Diff or apply a provisioning manifest.
+		r.Post("/admin/provision", s.handleProvision)
+
+		// Mint prefix-scoped delegation tokens (501 when disabled).
+		r.Post("/admin/delegation-tokens", s.handleDelegationToken)
+
+		// Quiesce writes around a filesystem-level backup, and resume them.
+		r.Post("/admin/backup/pre", s.handleBackupPre)
+		r.Post("/admin/backup/post", s.handleBackupPost)
+
+		// HA role of this instance and the current leader (501 when HA is
+		// disabled).
+		r.Get("/admin/ha", s.handleHA)
+
+		// Memory backend replication stream (501 when the backend cannot
+		// replicate).
+		r.Get(replicationPath, s.handleReplicationStream)
+	})
+
 	// S3 catch-all: all remaining requests go through the dispatch function.
 	// Chi matches more specific routes (health, docs, metrics, openapi) first,
 	// then falls through to the catch-all.
@@ -325,126 +1165,129 @@ func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// parsePath extracts bucket and object key from the request path.
-// Returns ("", "") for root "/", ("bucket", "") for "/{bucket}",
-// and ("bucket", "key/path") for "/{bucket}/{key...}".
-func parsePath(path string) (bucket, key string) {
-	// Trim leading slash
-	if len(path) > 0 && path[0] == '/' {
-		path = path[1:]
+// dispatch is the main request dispatcher. It parses the request once into
+// a handlers.RequestContext, attaches it for the handlers, then calls the
+// handler registered for the request's operation.
+func (s *Server) dispatch(w http.ResponseWriter, r *http.Request) {
+	rc := handlers.ParseRequest(w, r)
+	r = handlers.WithRequestContext(r, rc)
+	// Sampled requests, and those to a bucket with a logging override, are
+	// logged once they complete, rejections included.
+	if logged, verbose := s.requestLog.sample(rc.Bucket); logged {
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		defer s.requestLog.log(r, rc, rec, time.Now(), verbose)
+		w = rec
+	}
+	// Requests to a watched bucket or key are streamed to its watchers.
+	if s.watches.watched(rc.Bucket, rc.Key) {
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		defer s.watches.publish(r, rc, rec, time.Now())
+		w = rec
+	}
+
+	handler, ok := s.operations[rc.Operation]
+	if !ok || s.disabledOps[rc.Operation] {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
 	}
-	if path == "" {
-		return "", ""
+	// Only ACLs can admit anonymous callers.
+	if !s.cfg.Auth.EnforceACLs && auth.IsAnonymous(r.Context()) {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+		return
 	}
-	// Find first slash after bucket name
-	idx := -1
-	for i := 0; i < len(path); i++ {
-		if path[i] == '/' {
-			idx = i
-			break
+	if s.cfg.Auth.EnforceACLs {
+		allowed, err := s.authorize(r, rc)
+		if err != nil {
+			slog.Error("ACL check error", "bucket", rc.Bucket, "key", rc.Key, "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		if !allowed {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+			return
 		}
 	}
-	if idx < 0 {
-		return path, ""
+	// A replica only changes by following its primary.
+	if s.readOnly && rc.Operation.IsWrite() {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+		return
 	}
-	return path[:idx], path[idx+1:]
-}
-
-// dispatch is the main request dispatcher. It parses the path to extract
-// bucket and object key, then routes by HTTP method and query parameters.
-func (s *Server) dispatch(w http.ResponseWriter, r *http.Request) {
-	bucket, key := parsePath(r.URL.Path)
-	q := r.URL.Query()
-
-	// Service-level operations (no bucket in path).
-	if bucket == "" {
-		switch r.Method {
-		case http.MethodGet:
-			s.bucket.ListBuckets(w, r)
-		default:
-			xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+	// Only the HA leader writes; SDKs retry the 503, and clients or a load
+	// balancer can follow the header to the leader.
+	if s.ha != nil && rc.Operation.IsWrite() && !s.ha.isLeader() {
+		if leader := s.ha.leader(); leader != "" {
+			w.Header().Set(leaderHeader, leader)
 		}
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrServiceUnavailable)
 		return
 	}
-
-	// Object-level operations (bucket + key in path).
-	if key != "" {
-		switch r.Method {
-		case http.MethodPut:
-			switch {
-			case q.Has("partNumber") && q.Has("uploadId"):
-				s.multi.UploadPart(w, r)
-			case r.Header.Get("X-Amz-Copy-Source") != "":
-				s.object.CopyObject(w, r)
-			case q.Has("acl"):
-				s.object.PutObjectAcl(w, r)
-			default:
-				s.object.PutObject(w, r)
-			}
-		case http.MethodGet:
-			switch {
-			case q.Has("acl"):
-				s.object.GetObjectAcl(w, r)
-			case q.Has("uploadId"):
-				s.multi.ListParts(w, r)
-			default:
-				s.object.GetObject(w, r)
-			}
-		case http.MethodHead:
-			s.object.HeadObject(w, r)
-		case http.MethodDelete:
-			if q.Has("uploadId") {
-				s.multi.AbortMultipartUpload(w, r)
-			} else {
-				s.object.DeleteObject(w, r)
-			}
-		case http.MethodPost:
-			switch {
-			case q.Has("uploadId"):
-				s.multi.CompleteMultipartUpload(w, r)
-			case q.Has("uploads"):
-				s.multi.CreateMultipartUpload(w, r)
-			default:
-				xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
-			}
-		default:
-			xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+	// A frozen bucket serves reads only.
+	if s.freezes != nil && rc.Operation.IsWrite() && rc.Bucket != "" {
+		f, err := s.freezes.GetBucketFreeze(r.Context(), rc.Bucket)
+		if err != nil {
+			slog.Error("Bucket freeze lookup error", "bucket", rc.Bucket, "error", err)
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+			return
+		}
+		if f != nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrBucketFrozen)
+			return
 		}
-		return
 	}
-
-	// Bucket-level operations (bucket in path, no key).
-	switch r.Method {
-	case http.MethodPut:
-		if q.Has("acl") {
-			s.bucket.PutBucketAcl(w, r)
-		} else {
-			s.bucket.CreateBucket(w, r)
-		}
-	case http.MethodGet:
-		switch {
-		case q.Has("location"):
-			s.bucket.GetBucketLocation(w, r)
-		case q.Has("acl"):
-			s.bucket.GetBucketAcl(w, r)
-		case q.Has("uploads"):
-			s.multi.ListMultipartUploads(w, r)
-		case q.Has("list-type"):
-			s.object.ListObjectsV2(w, r)
-		default:
-			s.object.ListObjects(w, r)
-		}
-	case http.MethodHead:
-		s.bucket.HeadBucket(w, r)
-	case http.MethodDelete:
-		s.bucket.DeleteBucket(w, r)
-	case http.MethodPost:
-		if q.Has("delete") {
-			s.object.DeleteObjects(w, r)
-		} else {
-			xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+	// Writes are refused while a backup hook quiesces them; SDKs retry the 503.
+	if rc.Operation.IsWrite() {
+		if !s.writes.enter() {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrServiceUnavailable)
+			return
 		}
-	default:
-		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		defer s.writes.leave()
+	}
+	slog.Debug("S3 request", "operation", rc.Operation, "bucket", rc.Bucket, "key", rc.Key,
+		"request_id", rc.RequestID)
+	handler(w, r)
+}
+
+// operationHandlers maps every operation in the s3op route table to its
+// handler.
+func (s *Server) operationHandlers() map[s3op.Operation]http.HandlerFunc {
+	return map[s3op.Operation]http.HandlerFunc{
+		s3op.ListBuckets:             s.bucket.ListBuckets,
+		s3op.CreateBucket:            s.bucket.CreateBucket,
+		s3op.DeleteBucket:            s.bucket.DeleteBucket,
+		s3op.HeadBucket:              s.bucket.HeadBucket,
+		s3op.GetBucketLocation:       s.bucket.GetBucketLocation,
+		s3op.GetBucketAcl:            s.bucket.GetBucketAcl,
+		s3op.PutBucketAcl:            s.bucket.PutBucketAcl,
+		s3op.PutBucketReplication:    s.bucket.PutBucketReplication,
+		s3op.GetBucketReplication:    s.bucket.GetBucketReplication,
+		s3op.DeleteBucketReplication: s.bucket.DeleteBucketReplication,
+		s3op.ListObjects:             s.object.ListObjects,
+		s3op.ListObjectsV2:           s.object.ListObjectsV2,
+		s3op.DeleteObjects:           s.object.DeleteObjects,
+		s3op.PutObject:               s.object.PutObject,
+		s3op.CopyObject:              s.object.CopyObject,
+		s3op.GetObject:               s.object.GetObject,
+		s3op.HeadObject:              s.object.HeadObject,
+		s3op.DeleteObject:            s.object.DeleteObject,
+		s3op.GetObjectAcl:            s.object.GetObjectAcl,
+		s3op.PutObjectAcl:            s.object.PutObjectAcl,
+		s3op.CreateMultipartUpload:   s.multi.CreateMultipartUpload,
+		s3op.UploadPart:              s.multi.UploadPart,
+		s3op.CompleteMultipartUpload: s.multi.CompleteMultipartUpload,
+		s3op.AbortMultipartUpload:    s.multi.AbortMultipartUpload,
+		s3op.ListParts:               s.multi.ListParts,
+		s3op.ListMultipartUploads:    s.multi.ListMultipartUploads,
+		s3op.GetCapabilities:         s.handleCapabilities,
+		s3op.HeadObjects:             s.object.HeadObjects,
+		s3op.BulkGetObjects:          s.object.BulkGetObjects,
+
+		s3op.PutBucketInventoryConfiguration:    s.bucket.PutBucketInventoryConfiguration,
+		s3op.GetBucketInventoryConfiguration:    s.bucket.GetBucketInventoryConfiguration,
+		s3op.ListBucketInventoryConfigurations:  s.bucket.ListBucketInventoryConfigurations,
+		s3op.DeleteBucketInventoryConfiguration: s.bucket.DeleteBucketInventoryConfiguration,
+
+		s3op.PutBucketWebsite:    s.bucket.PutBucketWebsite,
+		s3op.GetBucketWebsite:    s.bucket.GetBucketWebsite,
+		s3op.DeleteBucketWebsite: s.bucket.DeleteBucketWebsite,
 	}
 }
@@ -1,19 +1,43 @@
 package server
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/clock"
 	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/handlers"
 	"github.com/bleepstore/bleepstore/internal/metadata"
 	"github.com/bleepstore/bleepstore/internal/metrics"
+	"github.com/bleepstore/bleepstore/internal/quota"
+	"github.com/bleepstore/bleepstore/internal/s3op"
 	"github.com/bleepstore/bleepstore/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func init() {
@@ -58,8 +82,9 @@ func newTestServerWithConfig(t *testing.T, cfg *config.Config) *Server {
 	return srv
 }
 
-// newTestServerWithBackends creates a Server with real metadata and storage backends.
-func newTestServerWithBackends(t *testing.T) *Server {
+// newTestServerWithBackends creates a Server with real metadata and storage
+// backends, applying any extra options.
+func newTestServerWithBackends(t *testing.T, opts ...ServerOption) *Server {
 	t.Helper()
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "metadata.db")
@@ -93,20 +118,34 @@ func newTestServerWithBackends(t *testing.T) *Server {
 		t.Fatalf("creating storage backend: %v", err)
 	}
 
-	srv, err := New(cfg, metaStore, WithStorageBackend(storageBackend))
+	args := []interface{}{metaStore, WithStorageBackend(storageBackend)}
+	for _, opt := range opts {
+		args = append(args, opt)
+	}
+	srv, err := New(cfg, args...)
 	if err != nil {
 		t.Fatalf("New() failed: %v", err)
 	}
 	return srv
 }
 
-// testRequest performs an HTTP request against the test server's handler
-// (with the full middleware chain: metricsMiddleware -> commonHeaders -> router).
+// asRoot returns the test server's router with every request authenticated
+// as the root access key, which the admin API requires.
+func asRoot(srv *Server) http.Handler {
+	key := srv.cfg.Auth.AccessKey
+	return auth.MiddlewareFunc(func(*http.Request) (Identity, error) {
+		return Identity{AccessKeyID: key, OwnerID: key, DisplayName: key}, nil
+	})(srv.router)
+}
+
+// testRequest performs an HTTP request as the root access key against the
+// test server's handler (with the full middleware chain: metricsMiddleware
+// -> commonHeaders -> router).
 func testRequest(t *testing.T, srv *Server, method, path string) *httptest.ResponseRecorder {
 	t.Helper()
 	req := httptest.NewRequest(method, path, nil)
 	rec := httptest.NewRecorder()
-	var handler http.Handler = commonHeaders(srv.router)
+	var handler http.Handler = commonHeaders(srv.clock, srv.ids)(asRoot(srv))
 	handler = metricsMiddleware(handler)
 	handler.ServeHTTP(rec, req)
 	return rec
@@ -402,6 +441,57 @@ func TestCommonHeaders(t *testing.T) {
 	}
 }
 
+func TestRecoveryMiddleware(t *testing.T) {
+	srv := newTestServer(t)
+	wrap := func(h http.HandlerFunc) http.Handler {
+		return commonHeaders(srv.clock, srv.ids)(recoveryMiddleware(h))
+	}
+
+	before := testutil.ToFloat64(metrics.PanicsTotal)
+	handler := wrap(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Header().Set("ETag", `"abc"`)
+		panic("boom")
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/bucket/key", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	reqID := rec.Header().Get("x-amz-request-id")
+	body := rec.Body.String()
+	if !strings.Contains(body, "<Code>InternalError</Code>") || !strings.Contains(body, "<RequestId>"+reqID+"</RequestId>") {
+		t.Errorf("body = %s, want InternalError with request ID %q", body, reqID)
+	}
+	if rec.Header().Get("ETag") != "" || rec.Header().Get("Content-Length") == "100" {
+		t.Errorf("handler headers kept: %v", rec.Header())
+	}
+	if got := testutil.ToFloat64(metrics.PanicsTotal) - before; got != 1 {
+		t.Errorf("bleepstore_panics_total grew by %v, want 1", got)
+	}
+
+	// Once the response has started, the connection is aborted.
+	for name, h := range map[string]http.HandlerFunc{
+		"started": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("late boom")
+		},
+		"abort": func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		},
+	} {
+		func() {
+			defer func() {
+				if v := recover(); v != http.ErrAbortHandler {
+					t.Errorf("%s: panic = %v, want http.ErrAbortHandler", name, v)
+				}
+			}()
+			wrap(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/bucket/key", nil))
+		}()
+	}
+}
+
 // TestS3StubRoutes verifies that all S3 API routes return appropriate error codes.
 // When no metadata store is configured, implemented handlers return 500 InternalError.
 // CompleteMultipartUpload is still 501 NotImplemented (Stage 8).
@@ -487,13 +577,1599 @@ func TestParsePath(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.path, func(t *testing.T) {
-			bucket, key := parsePath(tt.path)
+			bucket, key := handlers.SplitPath(tt.path)
 			if bucket != tt.wantBucket {
-				t.Errorf("parsePath(%q) bucket = %q, want %q", tt.path, bucket, tt.wantBucket)
+				t.Errorf("SplitPath(%q) bucket = %q, want %q", tt.path, bucket, tt.wantBucket)
 			}
 			if key != tt.wantKey {
-				t.Errorf("parsePath(%q) key = %q, want %q", tt.path, key, tt.wantKey)
+				t.Errorf("SplitPath(%q) key = %q, want %q", tt.path, key, tt.wantKey)
 			}
 		})
 	}
 }
+
+// TestUsageEndpoint verifies that recorded usage is flushed and reported by
+// /admin/usage, and that the endpoint is 501 when accounting is disabled.
+func TestUsageEndpoint(t *testing.T) {
+	disabled := newTestServer(t)
+	if rec := testRequest(t, disabled, "GET", "/admin/usage"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("disabled /admin/usage status = %d, want 501", rec.Code)
+	}
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 9011, Region: "us-east-1"},
+		Auth:   config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+		Observability: config.ObservabilityConfig{
+			Usage: config.UsageConfig{Enabled: true, FlushIntervalSeconds: 60},
+		},
+	}
+	srv, err := New(cfg, metadata.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	srv.usage.record("ak1", "bucket-a", 100, 5)
+	srv.usage.record("ak1", "bucket-a", 0, 7)
+	srv.usage.record("ak2", "bucket-b", 1, 1)
+
+	rec := testRequest(t, srv, "GET", "/admin/usage?access_key=ak1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/admin/usage status = %d, want 200", rec.Code)
+	}
+	var body struct {
+		Usage []usageEntry `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding usage response: %v", err)
+	}
+	if len(body.Usage) != 1 {
+		t.Fatalf("got %d usage entries, want 1: %+v", len(body.Usage), body.Usage)
+	}
+	got := body.Usage[0]
+	if got.Bucket != "bucket-a" || got.Requests != 2 || got.BytesIn != 100 || got.BytesOut != 12 {
+		t.Errorf("usage entry = %+v", got)
+	}
+}
+
+// TestAdminRoutesNotMetered verifies that no admin route is classified as
+// an S3 operation or billed to the calling access key.
+func TestAdminRoutesNotMetered(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	u := newUsageAggregator(metadata.NewMemoryStore(), time.Minute, srv.clock)
+	handler := auth.MiddlewareFunc(func(*http.Request) (Identity, error) {
+		return Identity{AccessKeyID: "ak1", OwnerID: "ak1"}, nil
+	})(usageMiddleware(u)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+	var routes int
+	err := chi.Walk(srv.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, "/admin/") {
+			return nil
+		}
+		routes++
+		path := strings.NewReplacer("{id}", "x", "{bucket}", "shared").Replace(route)
+		req := httptest.NewRequest(method, path, nil)
+		if op := classifyS3Operation(req); op != "" {
+			t.Errorf("%s %s classified as %s", method, route, op)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking routes: %v", err)
+	}
+	if routes == 0 {
+		t.Fatal("no admin routes walked")
+	}
+	if len(u.counters) != 0 {
+		t.Errorf("admin requests recorded as usage: %d counters", len(u.counters))
+	}
+}
+
+// TestRateLimitSlowDown verifies that exceeding the per-IP limit yields a
+// 503 SlowDown with Retry-After, and that a reload can lift the limit.
+func TestRateLimitSlowDown(t *testing.T) {
+	rl := newRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		PerIP:   config.RateLimitRule{RequestsPerSecond: 1, Burst: 2},
+	})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+
+	handler := clientRateLimitMiddleware(rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/bucket", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := do("10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i, rec.Code)
+		}
+	}
+	rec := do("10.0.0.1:1234")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "<Code>SlowDown</Code>") {
+		t.Errorf("expected SlowDown error, got: %s", rec.Body.String())
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+
+	// A different client has its own bucket.
+	if rec := do("10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("other IP status = %d, want 200", rec.Code)
+	}
+
+	// Tokens refill over time.
+	now = now.Add(time.Second)
+	if rec := do("10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("after refill status = %d, want 200", rec.Code)
+	}
+
+	// Reloading with rate limiting disabled lets everything through.
+	rl.update(config.RateLimitConfig{Enabled: false})
+	for i := 0; i < 5; i++ {
+		if rec := do("10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("disabled request %d status = %d, want 200", i, rec.Code)
+		}
+	}
+}
+
+// TestDisabledOperations verifies that operations listed in
+// server.disabled_operations are rejected and that unknown names fail
+// configuration.
+func TestDisabledOperations(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{Region: "us-east-1", DisabledOperations: []string{"DeleteBucket", "PutBucketAcl"}},
+		Auth:   config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+	}
+	srv := newTestServerWithConfig(t, cfg)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodDelete, "/bucket"},
+		{http.MethodPut, "/bucket?acl"},
+	} {
+		rec := testRequest(t, srv, req.method, req.path)
+		if rec.Code != http.StatusNotImplemented {
+			t.Errorf("%s %s status = %d, want 501", req.method, req.path, rec.Code)
+		}
+	}
+
+	cfg.Server.DisabledOperations = []string{"DeleteEverything"}
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "DeleteEverything") {
+		t.Errorf("New() with unknown operation: err = %v", err)
+	}
+}
+
+// fakeDefragmenter records which objects were defragmented.
+type fakeDefragmenter struct {
+	calls []string
+}
+
+func (f *fakeDefragmenter) DefragmentObject(ctx context.Context, bucket, key string) (bool, error) {
+	f.calls = append(f.calls, bucket+"/"+key)
+	return true, nil
+}
+
+// TestDefragRunBatch verifies that queued objects are defragmented when idle,
+// that stale entries are dropped without touching storage, and that the
+// queue is drained.
+func TestDefragRunBatch(t *testing.T) {
+	ctx := context.Background()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatalf("creating metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+
+	meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "bkt", OwnerID: "o", CreatedAt: time.Now()})
+	meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "bkt", Key: "current", ETag: `"a-2"`, LastModified: time.Now()})
+	meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "bkt", Key: "overwritten", ETag: `"new"`, LastModified: time.Now()})
+	meta.EnqueueDefrag(ctx, metadata.DefragTask{Bucket: "bkt", Key: "current", ETag: `"a-2"`})
+	meta.EnqueueDefrag(ctx, metadata.DefragTask{Bucket: "bkt", Key: "overwritten", ETag: `"old-2"`})
+	meta.EnqueueDefrag(ctx, metadata.DefragTask{Bucket: "bkt", Key: "deleted", ETag: `"x-2"`})
+
+	fake := &fakeDefragmenter{}
+	activity := &activityTracker{}
+	d := &defragmenter{queue: meta, meta: meta, store: fake, activity: activity, stopCh: make(chan struct{})}
+
+	// Busy server: nothing happens.
+	activity.inFlight.Add(1)
+	if n := d.runBatch(ctx); n != 0 || len(fake.calls) != 0 {
+		t.Fatalf("runBatch while busy rewrote %d objects (calls %v)", n, fake.calls)
+	}
+	activity.inFlight.Add(-1)
+
+	if n := d.runBatch(ctx); n != 1 {
+		t.Errorf("runBatch rewrote %d objects, want 1", n)
+	}
+	if len(fake.calls) != 1 || fake.calls[0] != "bkt/current" {
+		t.Errorf("DefragmentObject calls = %v, want [bkt/current]", fake.calls)
+	}
+	remaining, err := meta.ListDefrag(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListDefrag: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("queue still has %d entries: %+v", len(remaining), remaining)
+	}
+}
+
+// fakeMaintainer counts maintenance task runs.
+type fakeMaintainer struct {
+	checkpoints, vacuums, analyzes atomic.Int64
+}
+
+func (f *fakeMaintainer) Checkpoint(ctx context.Context) error {
+	f.checkpoints.Add(1)
+	return nil
+}
+
+func (f *fakeMaintainer) Vacuum(ctx context.Context, pages int) error {
+	f.vacuums.Add(1)
+	return nil
+}
+
+func (f *fakeMaintainer) Analyze(ctx context.Context) error {
+	f.analyzes.Add(1)
+	return nil
+}
+
+func (f *fakeMaintainer) WALSize() (int64, error) { return 4096, nil }
+
+// TestMaintainerSchedule verifies that each task runs on its own interval
+// and that a non-positive interval disables a task.
+func TestMaintainerSchedule(t *testing.T) {
+	fake := &fakeMaintainer{}
+	m := &maintainer{
+		store:      fake,
+		checkpoint: 5 * time.Millisecond,
+		vacuum:     5 * time.Millisecond,
+		analyze:    -1,
+		stopCh:     make(chan struct{}),
+	}
+	m.start()
+	deadline := time.Now().Add(5 * time.Second)
+	for fake.checkpoints.Load() < 2 || fake.vacuums.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("checkpoints = %d, vacuums = %d after 5s", fake.checkpoints.Load(), fake.vacuums.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	m.stop()
+
+	if n := fake.analyzes.Load(); n != 0 {
+		t.Errorf("analyze ran %d times with a disabled interval", n)
+	}
+}
+
+// writeTestKeyPair writes a self-signed certificate for commonName to dir.
+func writeTestKeyPair(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestCertReloaderPicksUpRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKeyPair(t, dir, "first")
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	commonName := func() string {
+		cert, _ := r.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("ParseCertificate: %v", err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if got := commonName(); got != "first" {
+		t.Fatalf("CommonName = %q, want first", got)
+	}
+
+	writeTestKeyPair(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if got := commonName(); got != "second" {
+		t.Errorf("CommonName after rotation = %q, want second", got)
+	}
+
+	// A broken file keeps the previous certificate in service.
+	os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	evenLater := later.Add(time.Minute)
+	os.Chtimes(keyFile, evenLater, evenLater)
+	if got := commonName(); got != "second" {
+		t.Errorf("CommonName after bad rotation = %q, want second", got)
+	}
+}
+
+func TestNewTLSConfigValidation(t *testing.T) {
+	if _, _, err := newTLSConfig(config.TLSConfig{Enabled: true}, nil); err == nil {
+		t.Error("expected error without cert_file/key_file")
+	}
+	if _, _, err := newTLSConfig(config.TLSConfig{Enabled: true, ACME: config.ACMEConfig{Enabled: true}}, nil); err == nil {
+		t.Error("expected error for ACME without hostnames")
+	}
+	certFile, keyFile := writeTestKeyPair(t, t.TempDir(), "server")
+	for _, ca := range []config.ClientAuthConfig{{Mode: "sometimes"}, {Mode: "require"}} {
+		if _, _, err := newTLSConfig(config.TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile, ClientAuth: ca}, nil); err == nil {
+			t.Errorf("expected error for client_auth %+v", ca)
+		}
+	}
+	mtls, _, err := newTLSConfig(config.TLSConfig{
+		Enabled: true, CertFile: certFile, KeyFile: keyFile,
+		ClientAuth: config.ClientAuthConfig{Mode: "require", CAFile: certFile},
+	}, nil)
+	if err != nil {
+		t.Fatalf("newTLSConfig (mTLS): %v", err)
+	}
+	if mtls.ClientAuth != tls.RequireAndVerifyClientCert || mtls.ClientCAs == nil {
+		t.Errorf("mTLS config ClientAuth = %v, ClientCAs = %v", mtls.ClientAuth, mtls.ClientCAs)
+	}
+
+	tlsCfg, _, err := newTLSConfig(config.TLSConfig{
+		Enabled: true,
+		ACME:    config.ACMEConfig{Enabled: true, Hostnames: []string{"s3.example.com"}, CacheDir: t.TempDir()},
+	}, nil)
+	if err != nil {
+		t.Fatalf("newTLSConfig (ACME): %v", err)
+	}
+	if tlsCfg.GetCertificate == nil {
+		t.Error("ACME TLS config has no GetCertificate")
+	}
+}
+
+func TestCustomDomainCertificates(t *testing.T) {
+	certFile, keyFile := writeTestKeyPair(t, t.TempDir(), "server")
+	domainCert, domainKey := writeTestKeyPair(t, t.TempDir(), "assets.example.com")
+	tlsCfg, _, err := newTLSConfig(config.TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile},
+		map[string]config.CustomDomainConfig{
+			"assets.example.com": {Bucket: "assets", CertFile: domainCert, KeyFile: domainKey},
+			"www.example.com":    {Bucket: "site", Website: true},
+		})
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+	for serverName, want := range map[string]string{
+		"Assets.example.com": "assets.example.com",
+		"www.example.com":    "server",
+		"":                   "server",
+	} {
+		cert, err := tlsCfg.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil {
+			t.Fatalf("GetCertificate(%q): %v", serverName, err)
+		}
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		if leaf.Subject.CommonName != want {
+			t.Errorf("GetCertificate(%q) = %q, want %q", serverName, leaf.Subject.CommonName, want)
+		}
+	}
+
+	if _, _, err := newTLSConfig(config.TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile},
+		map[string]config.CustomDomainConfig{"cdn.example.com": {Bucket: "cdn", CertFile: domainCert}}); err == nil {
+		t.Error("expected an error for a custom domain cert_file without key_file")
+	}
+	// With ACME, custom domains without a key pair count as hostnames.
+	if _, _, err := newTLSConfig(config.TLSConfig{
+		Enabled: true,
+		ACME:    config.ACMEConfig{Enabled: true, CacheDir: t.TempDir()},
+	}, map[string]config.CustomDomainConfig{"cdn.example.com": {Bucket: "cdn"}}); err != nil {
+		t.Errorf("newTLSConfig (ACME with a custom domain): %v", err)
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		host      string
+		httpsPort int
+		want      string
+	}{
+		{"s3.example.com", 443, "https://s3.example.com/bucket/key?uploads="},
+		{"s3.example.com:80", 9443, "https://s3.example.com:9443/bucket/key?uploads="},
+		{"[::1]:8080", 443, "https://[::1]/bucket/key?uploads="},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("PUT", "/bucket/key?uploads=", nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		httpsRedirectHandler(tt.httpsPort).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("%s: status = %d, want 308", tt.host, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s: Location = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+// TestPreloadEndpoint verifies that /admin/preload reads objects under the
+// prefix, honours max-bytes, and reports missing buckets.
+func TestPreloadEndpoint(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	ctx := context.Background()
+	srv.meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "data", CreatedAt: time.Now()})
+	srv.store.CreateBucket(ctx, "data")
+	for _, key := range []string{"set/a", "set/b", "set/c", "other/d"} {
+		srv.store.PutObject(ctx, "data", key, strings.NewReader("12345"), 5)
+		srv.meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "data", Key: key, Size: 5, LastModified: time.Now()})
+	}
+
+	decode := func(rec *httptest.ResponseRecorder) preloadResult {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		var res preloadResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("decoding preload response: %v", err)
+		}
+		return res
+	}
+
+	res := decode(testRequest(t, srv, "POST", "/admin/preload?bucket=data&prefix=set/"))
+	if res.Objects != 3 || res.Bytes != 15 || res.Truncated {
+		t.Errorf("preload = %+v, want 3 objects / 15 bytes", res)
+	}
+
+	res = decode(testRequest(t, srv, "POST", "/admin/preload?bucket=data&max-bytes=6"))
+	if res.Objects != 2 || !res.Truncated {
+		t.Errorf("preload with max-bytes = %+v, want 2 objects truncated", res)
+	}
+
+	if rec := testRequest(t, srv, "POST", "/admin/preload?bucket=missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing bucket status = %d, want 404", rec.Code)
+	}
+}
+
+func TestPlacementEndpoint(t *testing.T) {
+	if rec := testRequest(t, newTestServerWithBackends(t), "GET", "/admin/placement"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("single-copy backend status = %d, want 501", rec.Code)
+	}
+
+	base := t.TempDir()
+	targets := make(map[string]*storage.LocalBackend)
+	var mirrorTargets []storage.MirrorTarget
+	for _, name := range []string{"a", "b"} {
+		targets[name], _ = storage.NewLocalBackend(filepath.Join(base, name))
+		mirrorTargets = append(mirrorTargets, storage.MirrorTarget{Name: name, Zone: "zone-" + name, Backend: targets[name]})
+	}
+	mirror, err := storage.NewMirrorBackend(mirrorTargets, 0, 0)
+	if err != nil {
+		t.Fatalf("NewMirrorBackend: %v", err)
+	}
+	srv := newTestServerWithBackends(t, WithStorageBackend(mirror))
+	ctx := context.Background()
+	srv.meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "data", CreatedAt: time.Now()})
+	srv.store.CreateBucket(ctx, "data")
+	for _, key := range []string{"x", "y", "z"} {
+		srv.store.PutObject(ctx, "data", key, strings.NewReader("12345"), 5)
+		srv.meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "data", Key: key, Size: 5, LastModified: time.Now()})
+	}
+	targets["b"].DeleteObject(ctx, "data", "y")
+
+	get := func(path string, v any) {
+		t.Helper()
+		rec := testRequest(t, srv, "GET", path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d, body = %s", path, rec.Code, rec.Body.String())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("decoding %s: %v", path, err)
+		}
+	}
+
+	var policy storage.PlacementPolicy
+	get("/admin/placement", &policy)
+	if policy.Copies != 2 || policy.MinZones != 2 || len(policy.Targets) != 2 || !policy.Targets[0].Healthy {
+		t.Errorf("policy = %+v", policy)
+	}
+
+	var object storage.ObjectPlacement
+	get("/admin/placement?bucket=data&key=y", &object)
+	if object.Satisfied || len(object.Copies) != 1 || object.Copies[0].Target != "a" {
+		t.Errorf("placement of y = %+v, want one copy on a", object)
+	}
+
+	var report placementReport
+	get("/admin/placement?bucket=data", &report)
+	if report.Objects != 3 || report.Satisfied != 2 || report.UnderReplicated != 1 ||
+		len(report.Violations) != 1 || report.Violations[0].Key != "y" {
+		t.Errorf("report = %+v, want y under-replicated", report)
+	}
+
+	if rec := testRequest(t, srv, "GET", "/admin/placement?bucket=missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing bucket status = %d, want 404", rec.Code)
+	}
+}
+
+func TestRebuildEndpoint(t *testing.T) {
+	if rec := testRequest(t, newTestServerWithBackends(t), "POST", "/admin/rebuild"); rec.Code != http.StatusNotImplemented {
+		t.Errorf("local backend status = %d, want 501", rec.Code)
+	}
+
+	base := t.TempDir()
+	disks := []string{filepath.Join(base, "d0"), filepath.Join(base, "d1"), filepath.Join(base, "d2")}
+	ec, err := storage.NewErasureBackend(disks, 1, 0)
+	if err != nil {
+		t.Fatalf("NewErasureBackend: %v", err)
+	}
+	srv := newTestServerWithBackends(t, WithStorageBackend(ec))
+	ctx := context.Background()
+	ec.CreateBucket(ctx, "data")
+	ec.PutObject(ctx, "data", "k", strings.NewReader("hello"), 5)
+	os.Remove(filepath.Join(disks[1], "data", "k"))
+
+	for _, tc := range []struct {
+		query  string
+		shards int
+	}{{"?dry-run=true", 1}, {"", 1}, {"", 0}} {
+		rec := testRequest(t, srv, "POST", "/admin/rebuild"+tc.query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /admin/rebuild%s status = %d, body = %s", tc.query, rec.Code, rec.Body.String())
+		}
+		var result storage.RebuildResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("decoding result: %v", err)
+		}
+		if result.Objects != 1 || result.Shards != tc.shards {
+			t.Errorf("POST /admin/rebuild%s = %+v, want %d shards", tc.query, result, tc.shards)
+		}
+	}
+
+	if rec := testRequest(t, srv, "POST", "/admin/rebuild?dry-run=maybe"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad dry-run status = %d, want 400", rec.Code)
+	}
+}
+
+// TestCompressionMiddleware verifies that only sufficiently large API
+// responses are gzipped, and that object bodies pass through untouched.
+func TestCompressionMiddleware(t *testing.T) {
+	listing := strings.Repeat("<Key>object</Key>", 200)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, listing)
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, "<Error/>")
+	})
+	mux.HandleFunc("/object", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(listing)))
+		io.WriteString(w, listing)
+	})
+	handler := compressionMiddleware(config.CompressionConfig{Enabled: true, MinSizeBytes: 1024, MaxSizeBytes: 1 << 20})(mux)
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/list", "gzip, deflate")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("listing not compressed: headers %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != listing {
+		t.Error("decompressed listing does not match")
+	}
+
+	for _, tc := range []struct{ path, accept string }{
+		{"/list", ""},
+		{"/list", "gzip;q=0"},
+		{"/small", "gzip"},
+		{"/object", "gzip"},
+	} {
+		rec := get(tc.path, tc.accept)
+		if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+			t.Errorf("%s (Accept-Encoding %q): Content-Encoding = %q, want none", tc.path, tc.accept, enc)
+		}
+		if rec.Body.Len() == 0 {
+			t.Errorf("%s: empty body", tc.path)
+		}
+	}
+}
+
+func TestBodySizeLimit(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	handler := bodySizeLimit(16)(srv.router)
+	put := func(path, body string, length int64, header map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("PUT", path, strings.NewReader(body))
+		req.ContentLength = length
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := put("/limits", "", 0, nil); rec.Code != http.StatusOK {
+		t.Fatalf("CreateBucket = %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		body   string
+		length int64
+		header map[string]string
+	}{
+		{"declared length", strings.Repeat("x", 17), 17, nil},
+		{"chunked", strings.Repeat("x", 17), -1, nil},
+		{"decoded length", "x", 1, map[string]string{"X-Amz-Decoded-Content-Length": "17"}},
+	} {
+		rec := put("/limits/big", tc.body, tc.length, tc.header)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "EntityTooLarge") {
+			t.Errorf("%s: PutObject = %d %s, want 400 EntityTooLarge", tc.name, rec.Code, rec.Body)
+		}
+	}
+	if obj, _ := srv.meta.GetObject(context.Background(), "limits", "big"); obj != nil {
+		t.Error("oversized object was stored")
+	}
+
+	if rec := put("/limits/fits", strings.Repeat("x", 16), -1, nil); rec.Code != http.StatusOK {
+		t.Errorf("chunked PutObject at the limit = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// TestBucketSizeMetrics verifies that S3 request and response body sizes
+// are recorded per bucket and operation, and that failed requests are not.
+func TestBucketSizeMetrics(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	handler := metricsMiddleware(commonHeaders(srv.clock, srv.ids)(srv.router))
+	do := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do("PUT", "/size-metrics", ""); code != http.StatusOK {
+		t.Fatalf("CreateBucket status = %d", code)
+	}
+	if code := do("PUT", "/size-metrics/obj", "0123456789"); code != http.StatusOK {
+		t.Fatalf("PutObject status = %d", code)
+	}
+	do("GET", "/size-metrics/obj", "")
+	do("GET", "/no-such-bucket-for-metrics/obj", "")
+
+	body := testRequest(t, srv, "GET", "/metrics").Body.String()
+	for _, want := range []string{
+		`bleepstore_s3_request_size_bytes_sum{bucket="size-metrics",operation="PutObject"} 10`,
+		`bleepstore_s3_response_size_bytes_sum{bucket="size-metrics",operation="GetObject"} 10`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics missing %q", want)
+		}
+	}
+	if strings.Contains(body, "no-such-bucket-for-metrics") {
+		t.Error("failed request created a bucket label")
+	}
+}
+
+// TestServerTimingHeader verifies that the Server-Timing header reports
+// all phases when enabled.
+func TestServerTimingHeader(t *testing.T) {
+	storageBackend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating storage backend: %v", err)
+	}
+	cfg := &config.Config{
+		Server:        config.ServerConfig{Port: 9011, Region: "us-east-1"},
+		Auth:          config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+		Observability: config.ObservabilityConfig{ServerTiming: true},
+	}
+	srv, err := New(cfg, metadata.NewMemoryStore(), WithStorageBackend(storageBackend))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	handler := serverTimingMiddleware(authTimingMiddleware(srv.router))
+
+	req := httptest.NewRequest("PUT", "/timed-bucket", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CreateBucket status = %d", rec.Code)
+	}
+
+	header := rec.Header().Get("Server-Timing")
+	for _, phase := range []string{"auth;dur=", "metadata;dur=", "storage;dur=", "total;dur="} {
+		if !strings.Contains(header, phase) {
+			t.Errorf("Server-Timing %q missing %q", header, phase)
+		}
+	}
+}
+
+// TestBucketAliases verifies alias prefix and policy enforcement through
+// both path-style and virtual-hosted-style addressing.
+func TestBucketAliases(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	ctx := context.Background()
+	srv.meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "shared", CreatedAt: time.Now()})
+	srv.store.CreateBucket(ctx, "shared")
+	for _, key := range []string{"team-a/x", "team-b/y"} {
+		srv.store.PutObject(ctx, "shared", key, strings.NewReader("12345"), 5)
+		srv.meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "shared", Key: key, Size: 5, LastModified: time.Now()})
+	}
+
+	resolver, err := newBucketResolver(config.ServerConfig{
+		VirtualHostDomain: "s3.local",
+		Aliases: map[string]config.AliasConfig{
+			"team-a":   {Bucket: "shared", Prefix: "team-a/"},
+			"readers":  {Bucket: "shared", ReadOnly: true},
+			"restrict": {Bucket: "shared", AccessKeys: []string{"someone-else"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newBucketResolver: %v", err)
+	}
+	handler := bucketResolverMiddleware(resolver)(srv.router)
+	do := func(method, host, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if host != "" {
+			req.Host = host
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("GET", "", "/team-a?list-type=2", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "team-a/x") || strings.Contains(rec.Body.String(), "team-b/y") {
+		t.Errorf("alias listing = %d %s, want only team-a/ keys", rec.Code, rec.Body.String())
+	}
+	if rec := do("GET", "", "/team-a?prefix=team-b/", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("listing outside alias prefix = %d, want 403", rec.Code)
+	}
+	if rec := do("GET", "", "/team-a/team-b/y", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("GET outside alias prefix = %d, want 403", rec.Code)
+	}
+	if rec := do("PUT", "", "/team-a/team-a/new", "abc"); rec.Code != http.StatusOK {
+		t.Errorf("PUT through alias = %d, want 200", rec.Code)
+	}
+	if obj, _ := srv.meta.GetObject(ctx, "shared", "team-a/new"); obj == nil {
+		t.Error("object written through alias not found in underlying bucket")
+	}
+	if rec := do("DELETE", "", "/team-a", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("DELETE bucket through alias = %d, want 403", rec.Code)
+	}
+	if rec := do("PUT", "", "/readers/team-b/z", "abc"); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT through read-only alias = %d, want 403", rec.Code)
+	}
+	if rec := do("GET", "", "/restrict/team-a/x", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("GET with disallowed access key = %d, want 403", rec.Code)
+	}
+
+	// Virtual-hosted-style addressing of the alias and the bucket itself.
+	if rec := do("GET", "team-a.s3.local:9000", "/team-a/x", ""); rec.Code != http.StatusOK || rec.Body.String() != "12345" {
+		t.Errorf("virtual-host alias GET = %d %q", rec.Code, rec.Body.String())
+	}
+	rec = do("GET", "shared.s3.local", "/", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "team-b/y") {
+		t.Errorf("virtual-host bucket listing = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("GET", "shared.s3.local", "/healthz", ""); rec.Code != http.StatusOK {
+		t.Errorf("virtual-host infra path = %d, want 200", rec.Code)
+	}
+
+	// Reserved names are not bucket hostnames.
+	for _, host := range []string{"admin.s3.local", "metrics.s3.local"} {
+		if rec := do("GET", host, "/usage", ""); rec.Code != http.StatusForbidden {
+			t.Errorf("virtual-host %s = %d, want 403", host, rec.Code)
+		}
+	}
+	req := httptest.NewRequest("GET", "/frozen-buckets", nil)
+	req.Host = "admin.s3.local"
+	if err := resolver.resolve(req); err == nil || req.URL.Path != "/frozen-buckets" {
+		t.Errorf("resolving admin.s3.local = %v, path %q; want an error and no rewrite", err, req.URL.Path)
+	}
+
+	if _, err := newBucketResolver(config.ServerConfig{Aliases: map[string]config.AliasConfig{"a": {}}}); err == nil {
+		t.Error("expected error for alias without bucket")
+	}
+	if _, err := newBucketResolver(config.ServerConfig{CustomDomains: map[string]config.CustomDomainConfig{"ops.example.com": {Bucket: "admin"}}}); err == nil {
+		t.Error("expected error for custom domain of a reserved bucket name")
+	}
+}
+
+// TestAccessPointARNs verifies that access point and Outposts ARNs in the
+// bucket position resolve to the bucket or alias they name.
+func TestAccessPointARNs(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	ctx := context.Background()
+	srv.meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "shared", CreatedAt: time.Now()})
+	srv.store.CreateBucket(ctx, "shared")
+	srv.store.PutObject(ctx, "shared", "team-a/x", strings.NewReader("12345"), 5)
+	srv.meta.PutObject(ctx, &metadata.ObjectRecord{Bucket: "shared", Key: "team-a/x", Size: 5, ETag: `"e"`, LastModified: time.Now()})
+
+	resolver, err := newBucketResolver(config.ServerConfig{
+		Aliases: map[string]config.AliasConfig{"team-a": {Bucket: "shared", Prefix: "team-a/"}},
+	})
+	if err != nil {
+		t.Fatalf("newBucketResolver: %v", err)
+	}
+	handler := bucketResolverMiddleware(resolver)(srv.router)
+	do := func(method, target string, header map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, target := range []string{
+		"/arn:aws:s3:us-east-1:123456789012:accesspoint/team-a/team-a/x",
+		"/arn%3Aaws%3As3%3Aus-east-1%3A123456789012%3Aaccesspoint%2Fteam-a/team-a/x",
+		"/arn:aws:s3:us-east-1:123456789012:accesspoint:team-a/team-a/x",
+		"/arn:aws:s3-outposts:us-east-1:123456789012:outpost/op-01234567/accesspoint/team-a/team-a/x",
+		"/arn:aws:s3-outposts:us-east-1:123456789012:outpost/op-01234567/bucket/shared/team-a/x",
+	} {
+		if rec := do("GET", target, nil); rec.Code != http.StatusOK || rec.Body.String() != "12345" {
+			t.Errorf("GET %s = %d %q", target, rec.Code, rec.Body.String())
+		}
+	}
+	// The alias policy still applies through its ARN.
+	if rec := do("GET", "/arn:aws:s3:us-east-1:123456789012:accesspoint/team-a?prefix=team-b/", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("listing outside alias prefix via ARN = %d, want 403", rec.Code)
+	}
+	rec := do("GET", "/arn:aws:s3:us-east-1:123456789012:accesspoint/team-a?list-type=2", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "team-a/x") {
+		t.Errorf("listing via ARN = %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, src := range []string{
+		"arn:aws:s3:us-east-1:123456789012:accesspoint/team-a/object/team-a/x",
+		"arn%3Aaws%3As3%3Aus-east-1%3A123456789012%3Aaccesspoint%2Fteam-a%2Fobject%2Fteam-a/x",
+	} {
+		rec := do("PUT", "/shared/team-a/copy", map[string]string{"X-Amz-Copy-Source": src})
+		if rec.Code != http.StatusOK {
+			t.Errorf("copy from %s = %d %s", src, rec.Code, rec.Body.String())
+		}
+	}
+
+	// An ARN never resolves into the admin API, whoever sends it.
+	for _, target := range []string{
+		"/arn:aws:s3:us-east-1:123456789012:accesspoint/admin/v1/openapi.json",
+		"/arn:aws:s3:us-east-1:123456789012:accesspoint/admin",
+		"/arn:aws:s3-outposts:us-east-1:123456789012:outpost/op-01234567/bucket/admin/usage",
+	} {
+		req := httptest.NewRequest("GET", target, nil)
+		if err := resolver.resolve(req); err == nil || err.HTTPStatus != http.StatusForbidden {
+			t.Errorf("resolving %s = %v (path %q), want AccessDenied", target, err, req.URL.Path)
+		}
+	}
+
+	for _, path := range []string{
+		"/arn:aws:s3:us-east-1:123456789012:bucket/shared",
+		"/arn:aws:s3:us-east-1::accesspoint/shared",
+		"/arn:aws:s3-outposts:us-east-1:123456789012:outpost/op-1/thing/shared",
+		"/arn:aws:s3:us-east-1:123456789012:accesspoint/",
+		"/shared/arn:aws:s3:us-east-1:123456789012:accesspoint/a",
+	} {
+		if name, _, ok := parseAccessPointARN(path); ok {
+			t.Errorf("parseAccessPointARN(%q) accepted as %q", path, name)
+		}
+	}
+}
+
+// TestDelegationTokenEndpoint verifies token minting and its validation.
+func TestDelegationTokenEndpoint(t *testing.T) {
+	// Tokens are minted and checked by the server's clock, not the wall clock.
+	fake := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	srv := newTestServerWithBackends(t, WithClock(fake))
+	srv.meta.CreateBucket(context.Background(), &metadata.BucketRecord{Name: "shared", CreatedAt: time.Now()})
+
+	if rec := testRequest(t, srv, "POST", "/admin/delegation-tokens?bucket=shared"); rec.Code != http.StatusNotImplemented {
+		t.Fatalf("status without secret = %d, want 501", rec.Code)
+	}
+
+	srv.cfg.Auth.Delegation = config.DelegationConfig{Secret: "s3cret", MaxTTLSeconds: 7200}
+	rec := testRequest(t, srv, "POST", "/admin/delegation-tokens?bucket=shared&prefix=partner/&access=write&expires-in=600")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var resp delegationTokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	claims, err := auth.ParseDelegationToken([]byte("s3cret"), resp.Token, fake.Now())
+	if err != nil {
+		t.Fatalf("ParseDelegationToken: %v", err)
+	}
+	if claims.Bucket != "shared" || claims.Prefix != "partner/" || !claims.Write {
+		t.Errorf("claims = %+v", claims)
+	}
+	if want := fake.Now().Add(600 * time.Second); !resp.ExpiresAt.Equal(want) {
+		t.Errorf("expires_at = %v, want %v", resp.ExpiresAt, want)
+	}
+	fake.Advance(601 * time.Second)
+	if _, err := auth.ParseDelegationToken([]byte("s3cret"), resp.Token, fake.Now()); err == nil {
+		t.Error("token accepted after it expired by the server's clock")
+	}
+
+	for _, query := range []string{"bucket=missing", "bucket=shared&access=admin", "bucket=shared&expires-in=9999", ""} {
+		if rec := testRequest(t, srv, "POST", "/admin/delegation-tokens?"+query); rec.Code < 400 {
+			t.Errorf("%q: status = %d, want error", query, rec.Code)
+		}
+	}
+}
+
+// TestDelegationTokenResolvedScope verifies that a delegation token's scope
+// is checked against the bucket a virtual-hosted or custom-domain request
+// resolves to, not the path the client sent.
+func TestDelegationTokenResolvedScope(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	secret := []byte("s3cret")
+	srv.verifier.DelegationSecret = secret
+	resolver, err := newBucketResolver(config.ServerConfig{
+		VirtualHostDomain: "s3.local",
+		CustomDomains:     map[string]config.CustomDomainConfig{"files.example.com": {Bucket: "victim"}},
+	})
+	if err != nil {
+		t.Fatalf("newBucketResolver: %v", err)
+	}
+	srv.resolver = resolver
+
+	for _, path := range []string{"/shared", "/victim", "/shared/p/x", "/victim/shared/p/x"} {
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, httptest.NewRequest("PUT", path, strings.NewReader("original")))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s = %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	token, err := auth.SignDelegationToken(secret, &auth.DelegationClaims{
+		Bucket: "shared", Prefix: "p/", Write: true, ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		AccessKeyID: "partner", OwnerID: "partner", DisplayName: "partner",
+	})
+	if err != nil {
+		t.Fatalf("SignDelegationToken: %v", err)
+	}
+	handler := srv.buildHandler()
+	do := func(method, host, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Host = host
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("GET", "localhost", "/shared/p/x", ""); rec.Code != http.StatusOK {
+		t.Errorf("path-style GET in scope = %d, want 200", rec.Code)
+	}
+	for _, host := range []string{"victim.s3.local", "files.example.com"} {
+		if rec := do("GET", host, "/shared/p/x", ""); rec.Code != http.StatusForbidden {
+			t.Errorf("GET on %s = %d %s, want 403", host, rec.Code, rec.Body.String())
+		}
+		if rec := do("PUT", host, "/shared/p/x", "overwritten"); rec.Code != http.StatusForbidden {
+			t.Errorf("PUT on %s = %d, want 403", host, rec.Code)
+		}
+	}
+	obj, err := srv.meta.GetObject(context.Background(), "victim", "shared/p/x")
+	if err != nil || obj == nil || obj.Size != int64(len("original")) {
+		t.Errorf("victim/shared/p/x = %+v, %v; want it unchanged", obj, err)
+	}
+}
+
+func TestAdminRoutesRootOnly(t *testing.T) {
+	secret := []byte("s3cret")
+	token, err := auth.SignDelegationToken(secret, &auth.DelegationClaims{
+		Bucket: "shared", Write: true, ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		AccessKeyID: "partner", OwnerID: "partner", DisplayName: "partner",
+	})
+	if err != nil {
+		t.Fatalf("SignDelegationToken: %v", err)
+	}
+	sigv4 := newTestServerWithBackends(t)
+	sigv4.verifier.DelegationSecret = secret
+	custom := newTestServerWithBackends(t, WithAuthenticator(tokenAuthenticator{}))
+
+	// A delegation token, and an access key other than the root key, are
+	// refused on every admin route.
+	callers := []struct {
+		name    string
+		srv     *Server
+		handler http.Handler
+		header  [2]string
+	}{
+		{"delegation token", sigv4, sigv4.buildHandler(), [2]string{"Authorization", "Bearer " + token}},
+		{"access key alice", custom, custom.buildHandler(), [2]string{"X-Test-Token", "alice"}},
+	}
+	for _, c := range callers {
+		var routes int
+		err := chi.Walk(c.srv.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			if !strings.HasPrefix(route, "/admin/") {
+				return nil
+			}
+			routes++
+			path := strings.NewReplacer("{id}", "x", "{bucket}", "shared").Replace(route)
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set(c.header[0], c.header[1])
+			rec := httptest.NewRecorder()
+			c.handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("%s %s as %s = %d, want 403", method, route, c.name, rec.Code)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("walking routes: %v", err)
+		}
+		if routes < 30 {
+			t.Errorf("walked %d admin routes", routes)
+		}
+	}
+}
+
+// TestAdminRoutesRefuseAnonymous verifies that unsigned requests cannot
+// reach the admin API through an access point ARN or a virtual-hosted name
+// that resolves into it.
+func TestAdminRoutesRefuseAnonymous(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.cfg.Auth.EnforceACLs = true
+	srv.verifier.AllowAnonymous = true
+	resolver, err := newBucketResolver(config.ServerConfig{VirtualHostDomain: "s3.local"})
+	if err != nil {
+		t.Fatalf("newBucketResolver: %v", err)
+	}
+	srv.resolver = resolver
+	handler := srv.buildHandler()
+
+	for _, tc := range []struct{ host, path string }{
+		{"localhost", "/arn:aws:s3:us-east-1:123456789012:accesspoint/admin/v1/openapi.json"},
+		{"localhost", "/arn:aws:s3-outposts:us-east-1:123456789012:outpost/op-01234567/accesspoint/admin/frozen-buckets"},
+		{"admin.s3.local", "/frozen-buckets"},
+		{"admin.s3.local", "/usage"},
+		{"admin.s3.local", "/v1/openapi.json"},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("anonymous GET %s on %s = %d, want 403", tc.path, tc.host, rec.Code)
+		}
+	}
+}
+
+func TestPrefixQuotas(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	ctx := context.Background()
+	srv.meta.CreateBucket(ctx, &metadata.BucketRecord{Name: "shared", CreatedAt: time.Now()})
+	srv.store.CreateBucket(ctx, "shared")
+
+	quotas, err := quota.New(srv.meta, []config.PrefixQuotaConfig{{Bucket: "shared", Prefix: "projects/*/", MaxBytes: 10}})
+	if err != nil {
+		t.Fatalf("quota.New: %v", err)
+	}
+	srv.object.SetQuotas(quotas)
+	srv.multi.SetQuotas(quotas)
+
+	do := func(method, path, body string, header map[string]string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do("PUT", "/shared/projects/a/1", "123456", nil); code != http.StatusOK {
+		t.Fatalf("first put = %d", code)
+	}
+	if code := do("PUT", "/shared/projects/a/2", "12345", nil); code != http.StatusForbidden {
+		t.Errorf("put over quota = %d, want 403", code)
+	}
+	// Another project and unquoted keys are unaffected.
+	if code := do("PUT", "/shared/projects/b/1", "1234567890", nil); code != http.StatusOK {
+		t.Errorf("put in other project = %d", code)
+	}
+	if code := do("PUT", "/shared/free/1", "123456789012", nil); code != http.StatusOK {
+		t.Errorf("put outside quota = %d", code)
+	}
+	// Overwrites count only the size difference.
+	if code := do("PUT", "/shared/projects/a/1", "1234567890", nil); code != http.StatusOK {
+		t.Errorf("overwrite within quota = %d", code)
+	}
+	if code := do("PUT", "/shared/projects/a/2", "x", map[string]string{"X-Amz-Copy-Source": "/shared/free/1"}); code != http.StatusForbidden {
+		t.Errorf("copy over quota = %d, want 403", code)
+	}
+	// Deleting frees space.
+	if code := do("DELETE", "/shared/projects/a/1", "", nil); code != http.StatusNoContent {
+		t.Fatalf("delete = %d", code)
+	}
+	if code := do("PUT", "/shared/projects/a/2", "1234567890", nil); code != http.StatusOK {
+		t.Errorf("put after delete = %d", code)
+	}
+}
+
+// TestDeterministicClockAndIDs verifies that an injected clock and ID
+// generator make headers, XML bodies and upload expiry reproducible.
+func TestDeterministicClockAndIDs(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	srv := newTestServerWithBackends(t, WithClock(fake), WithIDGenerator(&clock.Sequence{}))
+
+	rec := testRequest(t, srv, "PUT", "/clocked")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CreateBucket = %d", rec.Code)
+	}
+	if got := rec.Header().Get("x-amz-request-id"); got != "0000000000000001" {
+		t.Errorf("x-amz-request-id = %q", got)
+	}
+	if got := rec.Header().Get("Date"); got != "Fri, 01 Mar 2024 12:00:00 GMT" {
+		t.Errorf("Date = %q", got)
+	}
+
+	rec = testRequest(t, srv, "POST", "/clocked/big?uploads")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("CreateMultipartUpload = %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "<UploadId>00000000000000000000000000000003</UploadId>") {
+		t.Errorf("InitiateMultipartUploadResult = %s", rec.Body.String())
+	}
+
+	fake.Advance(time.Minute)
+	rec = testRequest(t, srv, "GET", "/clocked?uploads")
+	if !strings.Contains(rec.Body.String(), "<Initiated>2024-03-01T12:00:00.000Z</Initiated>") {
+		t.Errorf("ListMultipartUploadsResult = %s", rec.Body.String())
+	}
+	if got := rec.Header().Get("Date"); got != "Fri, 01 Mar 2024 12:01:00 GMT" {
+		t.Errorf("Date after advance = %q", got)
+	}
+
+	// Expiry follows the fake clock rather than the wall clock.
+	reaper := srv.meta.(metadata.UploadReaper)
+	expired, err := reaper.ReapExpiredUploads(3600)
+	if err != nil || len(expired) != 0 {
+		t.Fatalf("reap before TTL = %v, %v", expired, err)
+	}
+	fake.Advance(2 * time.Hour)
+	expired, err = reaper.ReapExpiredUploads(3600)
+	if err != nil || len(expired) != 1 || expired[0].UploadID != "00000000000000000000000000000003" {
+		t.Fatalf("reap after TTL = %v, %v", expired, err)
+	}
+
+	// Usage rolls over to a new hourly period with the fake clock.
+	usage := metadata.NewMemoryStore()
+	u := newUsageAggregator(usage, time.Minute, srv.clock)
+	u.record("ak1", "clocked", 1, 0)
+	fake.Advance(time.Hour)
+	u.record("ak1", "clocked", 2, 0)
+	if err := u.flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	records, err := usage.ListUsage(context.Background(), metadata.UsageFilter{})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("usage = %+v, %v; want two periods", records, err)
+	}
+	if want := start.Add(2 * time.Hour).Truncate(time.Hour); !records[0].Period.Equal(want) || !records[1].Period.Equal(want.Add(time.Hour)) {
+		t.Errorf("usage periods = %v, %v; want %v and the hour after", records[0].Period, records[1].Period, want)
+	}
+}
+
+// TestMiddlewareHooks verifies that embedder middleware runs at its stage in
+// registration order and that response hooks see the final status.
+func TestMiddlewareHooks(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	var responses []ResponseInfo
+	srv := newTestServerWithBackends(t,
+		WithMiddleware(StagePreHandler, record("pre-handler")),
+		WithMiddleware(StagePostAuth, record("post-auth")),
+		WithMiddleware(StagePreAuth, record("pre-auth-1"), record("pre-auth-2")),
+		WithMiddleware(StagePreAuth, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Embedder", "yes")
+				next.ServeHTTP(w, r)
+			})
+		}),
+		WithResponseHook(func(r *http.Request, info ResponseInfo) {
+			responses = append(responses, info)
+		}),
+	)
+	handler := srv.buildHandler()
+
+	// /health skips authentication, so every stage runs.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	if want := []string{"pre-auth-1", "pre-auth-2", "post-auth", "pre-handler"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if rec.Header().Get("X-Embedder") != "yes" {
+		t.Error("pre-auth middleware header missing")
+	}
+	if len(responses) != 1 || responses[0].Status != http.StatusOK || responses[0].Bytes == 0 {
+		t.Errorf("responses = %+v", responses)
+	}
+
+	// An unsigned S3 request is rejected by auth: only pre-auth runs.
+	calls, responses = nil, nil
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/some-bucket", nil))
+	if want := []string{"pre-auth-1", "pre-auth-2"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls for rejected request = %v, want %v", calls, want)
+	}
+	if len(responses) != 1 || responses[0].Status != http.StatusForbidden {
+		t.Errorf("responses for rejected request = %+v", responses)
+	}
+}
+
+// TestSurfaceSpec verifies that /admin/v1/openapi.json describes every
+// routed operation except disabled ones, with error codes per operation.
+func TestSurfaceSpec(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{Region: "us-east-1", DisabledOperations: []string{"DeleteBucket"}},
+		Auth:   config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+	}
+	srv := newTestServerWithConfig(t, cfg)
+
+	rec := testRequest(t, srv, http.MethodGet, "/admin/v1/openapi.json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Action      string `json:"x-bleepstore-action"`
+			Parameters  []struct {
+				Name     string `json:"name"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+			Responses map[string]struct {
+				Codes []string `json:"x-s3-error-codes"`
+			} `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decoding spec: %v", err)
+	}
+	if spec.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q", spec.OpenAPI)
+	}
+
+	ops := make(map[string]bool)
+	for _, item := range spec.Paths {
+		for _, op := range item {
+			if op.OperationID != "" {
+				ops[op.OperationID] = true
+			}
+		}
+	}
+	for _, rt := range s3op.Routes {
+		if _, ok := surfaceOps[rt.Operation]; !ok {
+			t.Errorf("operation %s has no surface documentation", rt.Operation)
+		}
+		if want := rt.Operation != s3op.DeleteBucket; ops[string(rt.Operation)] != want {
+			t.Errorf("operation %s listed = %v, want %v", rt.Operation, !want, want)
+		}
+	}
+
+	acl := spec.Paths["/{Bucket}/{Key+}?acl"]["put"]
+	if acl.OperationID != "PutObjectAcl" || acl.Action != "s3:PutObjectAcl" {
+		t.Errorf("PUT ?acl = %+v", acl)
+	}
+	get := spec.Paths["/{Bucket}/{Key+}"]["get"]
+	if codes := get.Responses["404"].Codes; !reflect.DeepEqual(codes, []string{"NoSuchBucket", "NoSuchKey"}) {
+		t.Errorf("GetObject 404 codes = %v", codes)
+	}
+	part := spec.Paths["/{Bucket}/{Key+}?partNumber&uploadId"]["put"]
+	required := 0
+	for _, p := range part.Parameters {
+		if p.Required {
+			required++
+		}
+	}
+	if part.OperationID != "UploadPart" || required != 4 {
+		t.Errorf("UploadPart = %s with %d required params, want 4 (Bucket, Key+, partNumber, uploadId)", part.OperationID, required)
+	}
+	if _, ok := spec.Paths["/admin/delegation-tokens"]; ok {
+		t.Error("delegation endpoint listed although delegation is disabled")
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			Region:             "eu-west-1",
+			VirtualHostDomain:  "s3.example.com",
+			DisabledOperations: []string{"DeleteObjects"},
+		},
+		Auth: config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+	}
+	srv := newTestServerWithConfig(t, cfg)
+
+	rec := testRequest(t, srv, http.MethodGet, "/?bleepstore-capabilities")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var caps struct {
+		Version    int             `json:"version"`
+		Region     string          `json:"region"`
+		Features   map[string]bool `json:"features"`
+		Operations []string        `json:"operations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if caps.Version != 1 || caps.Region != "eu-west-1" {
+		t.Errorf("version/region = %d/%q", caps.Version, caps.Region)
+	}
+	for feature, want := range map[string]bool{
+		"versioning":    false,
+		"object_lock":   false,
+		"multipart":     true,
+		"multi_delete":  false,
+		"virtual_hosts": true,
+	} {
+		if got, ok := caps.Features[feature]; !ok || got != want {
+			t.Errorf("features[%q] = %v (present %v), want %v", feature, got, ok, want)
+		}
+	}
+	if slices.Contains(caps.Operations, "DeleteObjects") || !slices.Contains(caps.Operations, "PutObject") {
+		t.Errorf("operations = %v", caps.Operations)
+	}
+}
+
+func TestDeprecationWarnings(t *testing.T) {
+	handler := deprecationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	sigv4 := "AWS4-HMAC-SHA256 Credential=AKID/20260101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc"
+
+	tests := []struct {
+		name    string
+		authz   string
+		sha256  string
+		query   string
+		warning string
+	}{
+		{"sigv2 header", "AWS AKID:c2ln", "", "", "sigv2"},
+		{"sigv2 query", "", "", "?AWSAccessKeyId=AKID&Signature=c2ln&Expires=1", "sigv2"},
+		{"unsigned payload", sigv4, "UNSIGNED-PAYLOAD", "", "unsigned-payload"},
+		{"missing content sha256", sigv4, "", "", "missing-content-sha256"},
+		{"signed payload", sigv4, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "", ""},
+		{"anonymous", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/bucket/key"+tt.query, nil)
+			if tt.authz != "" {
+				req.Header.Set("Authorization", tt.authz)
+			}
+			if tt.sha256 != "" {
+				req.Header.Set("X-Amz-Content-Sha256", tt.sha256)
+			}
+			var before float64
+			if tt.warning != "" {
+				before = testutil.ToFloat64(metrics.DeprecationWarningsTotal.WithLabelValues(tt.warning))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Values("x-bleepstore-warning")
+			if tt.warning == "" {
+				if len(got) != 0 {
+					t.Errorf("warnings = %q, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.HasPrefix(got[0], tt.warning+": ") {
+				t.Errorf("warnings = %q, want one %q", got, tt.warning)
+			}
+			if after := testutil.ToFloat64(metrics.DeprecationWarningsTotal.WithLabelValues(tt.warning)); after != before+1 {
+				t.Errorf("counter = %v, want %v", after, before+1)
+			}
+		})
+	}
+}
+
+// newReplicationServer creates a Server on a fresh memory backend with the
+// given replication role, sharing meta with its peer.
+func newReplicationServer(t *testing.T, meta metadata.MetadataStore, role, peer string) (*Server, *storage.MemoryBackend) {
+	t.Helper()
+	store, err := storage.NewMemoryBackend(0, "none", "", 0, "")
+	if err != nil {
+		t.Fatalf("NewMemoryBackend: %v", err)
+	}
+	cfg := &config.Config{
+		Server: config.ServerConfig{Region: "us-east-1"},
+		Auth:   config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+	}
+	cfg.Metadata.Engine = "sqlite"
+	cfg.Storage.Backend = "memory"
+	cfg.Storage.Memory.Replication = config.MemoryReplicationConfig{Role: role, Peer: peer}
+	srv, err := New(cfg, meta, WithStorageBackend(store))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return srv, store
+}
+
+func TestMemoryReplication(t *testing.T) {
+	ctx := context.Background()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatalf("creating metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	meta.PutCredential(ctx, &metadata.CredentialRecord{
+		AccessKeyID: "bleepstore", SecretKey: "bleepstore-secret", Active: true, CreatedAt: time.Now(),
+	})
+
+	primary, primaryStore := newReplicationServer(t, meta, "primary", "http://replica.invalid")
+	ts := httptest.NewServer(primary.buildHandler())
+	defer ts.Close()
+	primaryStore.PutObject(ctx, "bkt", "a", strings.NewReader("one"), 3)
+
+	replica, replicaStore := newReplicationServer(t, meta, "replica", ts.URL)
+	replica.replicator.start()
+	defer replica.replicator.stop()
+
+	waitObject := func(key, want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			rc, _, _, err := replicaStore.GetObject(ctx, "bkt", key)
+			if err == nil {
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				if string(data) == want {
+					return
+				}
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("replica never got %s = %q (last error %v)", key, want, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitObject("a", "one")
+	primaryStore.PutObject(ctx, "bkt", "b", strings.NewReader("two"), 3)
+	waitObject("b", "two")
+	if got := testutil.ToFloat64(metrics.ReplicationConnected); got != 1 {
+		t.Errorf("replication_connected = %v, want 1", got)
+	}
+
+	// The replica rejects S3 writes.
+	if rec := testRequest(t, replica, "PUT", "/bkt/c"); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT on replica status = %d, want 403", rec.Code)
+	}
+
+	// A primary restarted empty copies the replica's objects back.
+	restarted, restartedStore := newReplicationServer(t, meta, "primary", "http://unused.invalid")
+	rts := httptest.NewServer(replica.buildHandler())
+	defer rts.Close()
+	restarted.replicator.peer = rts.URL
+	if err := restarted.replicator.bootstrap(); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	if restartedStore.Empty() {
+		t.Error("bootstrap copied nothing")
+	}
+
+	// Unsigned stream requests are rejected.
+	resp, err := http.Get(ts.URL + replicationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unsigned stream status = %d, want 403", resp.StatusCode)
+	}
+
+	for _, rcfg := range []config.MemoryReplicationConfig{{Role: "leader", Peer: ts.URL}, {Role: "replica"}} {
+		cfg := &config.Config{}
+		cfg.Storage.Memory.Replication = rcfg
+		if _, err := New(cfg, meta, WithStorageBackend(replicaStore)); err == nil {
+			t.Errorf("New accepted replication config %+v", rcfg)
+		}
+	}
+}
+
+// countingPreloader records the objects it is asked to preload.
+type countingPreloader struct {
+	mu    sync.Mutex
+	keys  []string
+	block chan struct{}
+}
+
+func (p *countingPreloader) PreloadObject(ctx context.Context, bucket, key string) (int64, error) {
+	if p.block != nil {
+		select {
+		case <-p.block:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	p.mu.Lock()
+	p.keys = append(p.keys, bucket+"/"+key)
+	p.mu.Unlock()
+	return 1, nil
+}
+
+func TestPrefetcher(t *testing.T) {
+	store := &countingPreloader{block: make(chan struct{})}
+	p := newPrefetcher(store, 1, 2)
+
+	// Duplicates are skipped and hints beyond the queue are dropped.
+	if n := p.enqueue("b", []string{"x", "x", "y", "z"}); n != 2 {
+		t.Fatalf("enqueue accepted %d keys, want 2", n)
+	}
+	p.start()
+	close(store.block)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		store.mu.Lock()
+		done := len(store.keys) == 2
+		store.mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queued keys were not preloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	p.stop()
+	if strings.Join(store.keys, ",") != "b/x,b/y" {
+		t.Errorf("preloaded %v, want b/x and b/y", store.keys)
+	}
+}
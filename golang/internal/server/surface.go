@@ -0,0 +1,471 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/s3op"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// The surface description served at /admin/v1/openapi.json is generated
+// from the s3op route table, so it always lists exactly the operations this
+// server dispatches (minus server.disabled_operations), plus the extension
+// endpoints enabled by the running configuration. Unlike /openapi.json,
+// which is the canonical spec shared by every BleepStore implementation,
+// each S3 operation gets its own path item. Subresources are keyed the way
+// AWS-derived OpenAPI documents do it: "/{Bucket}?acl" for a required query
+// parameter and "/{Bucket}/{Key+}#x-amz-copy-source" for a required header.
+
+// surfaceParam documents a request parameter.
+type surfaceParam struct {
+	name     string
+	in       string // "query" or "header"
+	typ      string // JSON schema type; "" means string
+	required bool
+	desc     string
+}
+
+// query, intQuery and header build optional parameters.
+func query(name, desc string) surfaceParam {
+	return surfaceParam{name: name, in: "query", desc: desc}
+}
+
+func intQuery(name, desc string) surfaceParam {
+	return surfaceParam{name: name, in: "query", typ: "integer", desc: desc}
+}
+
+func header(name, desc string) surfaceParam {
+	return surfaceParam{name: name, in: "header", desc: desc}
+}
+
+// surfaceOp documents an S3 operation.
+type surfaceOp struct {
+	summary string
+	status  int // success status
+	params  []surfaceParam
+	errors  []*s3err.S3Error
+}
+
+// commonErrors can be returned by any authenticated S3 request.
+var commonErrors = []*s3err.S3Error{
+	s3err.ErrAccessDenied, s3err.ErrInvalidAccessKeyId, s3err.ErrSignatureDoesNotMatch,
+	s3err.ErrRequestTimeTooSkewed, s3err.ErrAuthorizationHeaderMalformed,
+	s3err.ErrSlowDown, s3err.ErrInternalError, s3err.ErrServiceUnavailable,
+}
+
+var (
+	aclHeader  = header("x-amz-acl", "Canned ACL to apply.")
+	objHeaders = []surfaceParam{
+		header("Content-Type", "Stored and returned as the object's Content-Type."),
+		header("Content-Encoding", ""), header("Content-Language", ""),
+		header("Content-Disposition", ""), header("Cache-Control", ""), header("Expires", ""),
+		header("x-amz-meta-*", "User metadata, returned on GET and HEAD."),
+		aclHeader,
+	}
+	conditionalHeaders = []surfaceParam{
+		header("If-Match", ""), header("If-None-Match", ""),
+		header("If-Modified-Since", ""), header("If-Unmodified-Since", ""),
+	}
+	responseOverrides = []surfaceParam{
+		query("response-content-type", ""), query("response-content-language", ""),
+		query("response-expires", ""), query("response-cache-control", ""),
+		query("response-content-disposition", ""), query("response-content-encoding", ""),
+	}
+	copySourceHeaders = []surfaceParam{
+		{name: "x-amz-copy-source", in: "header", required: true, desc: "Source object as /bucket/key."},
+		header("x-amz-copy-source-if-match", ""), header("x-amz-copy-source-if-none-match", ""),
+		header("x-amz-copy-source-if-modified-since", ""), header("x-amz-copy-source-if-unmodified-since", ""),
+	}
+	uploadIDParam   = surfaceParam{name: "uploadId", in: "query", required: true, desc: "Multipart upload ID."}
+	partNumberParam = intQuery("partNumber", "Read one part (1-n) of a multipart object; the response carries x-amz-mp-parts-count.")
+	asyncParam      = surfaceParam{name: "async", in: "query", typ: "boolean", desc: "Run as a job in the background and return its status (202)."}
+	jobIDParam      = surfaceParam{name: "id", in: "path", required: true}
+)
+
+// concat joins parameter lists.
+func concat(lists ...[]surfaceParam) []surfaceParam {
+	var out []surfaceParam
+	for _, l := range lists {
+		out = append(out, l...)
+	}
+	return out
+}
+
+// surfaceOps documents every operation in s3op.Routes.
+var surfaceOps = map[s3op.Operation]surfaceOp{
+	s3op.ListBuckets:     {summary: "List the buckets owned by the caller"},
+	s3op.GetCapabilities: {summary: "BleepStore extension: report enabled features and operations as JSON"},
+	s3op.CreateBucket: {summary: "Create a bucket", params: []surfaceParam{aclHeader},
+		errors: []*s3err.S3Error{s3err.ErrInvalidBucketName, s3err.ErrBucketAlreadyExists, s3err.ErrBucketAlreadyOwnedByYou,
+			s3err.ErrInvalidLocationConstraint, s3err.ErrTooManyBuckets, s3err.ErrMalformedXML}},
+	s3op.DeleteBucket: {summary: "Delete an empty bucket", status: http.StatusNoContent,
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrBucketNotEmpty}},
+	s3op.HeadBucket: {summary: "Check that a bucket exists",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket}},
+	s3op.GetBucketLocation: {summary: "Return the bucket's region",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket}},
+	s3op.GetBucketAcl: {summary: "Return the bucket ACL",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket}},
+	s3op.PutBucketAcl: {summary: "Replace the bucket ACL", params: []surfaceParam{aclHeader},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrMalformedACLError}},
+	s3op.PutBucketReplication: {summary: "Set the rules that queue new writes and deletes for replication to the remote endpoint",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrMalformedXML, s3err.ErrInvalidRequest, s3err.ErrNotImplemented}},
+	s3op.GetBucketReplication: {summary: "Return the bucket's replication rules",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrReplicationConfigurationNotFound, s3err.ErrNotImplemented}},
+	s3op.DeleteBucketReplication: {summary: "Remove the bucket's replication rules", status: http.StatusNoContent,
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNotImplemented}},
+	s3op.PutBucketInventoryConfiguration: {summary: "Set an inventory configuration that schedules CSV or Parquet reports of the bucket's objects",
+		params: []surfaceParam{{name: "id", in: "query", required: true}},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrMalformedXML, s3err.ErrInvalidArgument, s3err.ErrNotImplemented}},
+	s3op.GetBucketInventoryConfiguration: {summary: "Return an inventory configuration",
+		params: []surfaceParam{{name: "id", in: "query", required: true}},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNoSuchConfiguration, s3err.ErrNotImplemented}},
+	s3op.ListBucketInventoryConfigurations: {summary: "List the bucket's inventory configurations, 100 per page",
+		params: []surfaceParam{query("continuation-token", "")},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNotImplemented}},
+	s3op.DeleteBucketInventoryConfiguration: {summary: "Remove an inventory configuration", status: http.StatusNoContent,
+		params: []surfaceParam{{name: "id", in: "query", required: true}},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNoSuchConfiguration, s3err.ErrNotImplemented}},
+	s3op.PutBucketWebsite: {summary: "Set the index and error documents and routing rules the website endpoint serves the bucket with",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrMalformedXML, s3err.ErrInvalidArgument, s3err.ErrNotImplemented}},
+	s3op.GetBucketWebsite: {summary: "Return the bucket's website configuration",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNoSuchWebsiteConfiguration, s3err.ErrNotImplemented}},
+	s3op.DeleteBucketWebsite: {summary: "Remove the bucket's website configuration", status: http.StatusNoContent,
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNotImplemented}},
+	s3op.ListObjects: {summary: "List objects (version 1)",
+		params: []surfaceParam{query("prefix", ""), query("delimiter", ""), query("marker", ""),
+			intQuery("max-keys", "1-1000 (default 1000)."), query("encoding-type", "\"url\" to URL-encode keys.")},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrInvalidArgument}},
+	s3op.ListObjectsV2: {summary: "List objects (version 2)",
+		params: []surfaceParam{{name: "list-type", in: "query", required: true, desc: "Must be 2."},
+			query("prefix", ""), query("delimiter", ""), query("continuation-token", ""), query("start-after", ""),
+			intQuery("max-keys", "1-1000 (default 1000)."), query("encoding-type", "\"url\" to URL-encode keys."),
+			{name: "fetch-owner", in: "query", typ: "boolean", desc: "Include each object's Owner."}},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrInvalidArgument}},
+	s3op.DeleteObjects: {summary: "Delete up to 1000 objects",
+		params: []surfaceParam{{name: "Content-MD5", in: "header", required: true, desc: "Base64 MD5 of the request body."}},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrMalformedXML, s3err.ErrInvalidDigest, s3err.ErrBadDigest}},
+	s3op.HeadObjects: {summary: "BleepStore extension: return the metadata of up to 1000 objects as JSON; the body is {\"keys\": [...]}",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrInvalidRequest}},
+	s3op.BulkGetObjects: {summary: "BleepStore extension: stream objects named by {\"keys\": [...]} or under {\"prefix\": ...} as a tar archive",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrInvalidRequest}},
+	s3op.PutObject: {summary: "Store an object",
+		params: concat(objHeaders, []surfaceParam{header("Content-MD5", ""), header("If-None-Match", "\"*\" to write only if the key does not exist.")}),
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrEntityTooLarge, s3err.ErrMissingContentLength,
+			s3err.ErrBadDigest, s3err.ErrInvalidDigest, s3err.ErrIncompleteBody, s3err.ErrKeyTooLongError,
+			s3err.ErrPreconditionFailed, s3err.ErrQuotaExceeded}},
+	s3op.CopyObject: {summary: "Copy an object",
+		params: concat(copySourceHeaders, []surfaceParam{header("x-amz-metadata-directive", "COPY (default) or REPLACE.")}, objHeaders),
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNoSuchKey, s3err.ErrInvalidArgument,
+			s3err.ErrInvalidRequest, s3err.ErrPreconditionFailed, s3err.ErrQuotaExceeded}},
+	s3op.GetObject: {summary: "Read an object",
+		params: concat([]surfaceParam{header("Range", "Single byte range, e.g. bytes=0-499."), partNumberParam}, conditionalHeaders, responseOverrides),
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNoSuchKey, s3err.ErrInvalidRange, s3err.ErrPreconditionFailed,
+			s3err.ErrInvalidArgument, s3err.ErrInvalidRequest, s3err.ErrInvalidPartNumber}},
+	s3op.HeadObject: {summary: "Read an object's metadata",
+		params: concat([]surfaceParam{header("Range", ""), partNumberParam}, conditionalHeaders),
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNoSuchKey, s3err.ErrPreconditionFailed, s3err.ErrInvalidPartNumber}},
+	s3op.DeleteObject: {summary: "Delete an object", status: http.StatusNoContent,
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket}},
+	s3op.GetObjectAcl: {summary: "Return an object's ACL",
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNoSuchKey}},
+	s3op.PutObjectAcl: {summary: "Replace an object's ACL", params: []surfaceParam{aclHeader},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrNoSuchKey, s3err.ErrMalformedACLError}},
+	s3op.CreateMultipartUpload: {summary: "Start a multipart upload", params: objHeaders,
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrKeyTooLongError}},
+	s3op.UploadPart: {summary: "Upload a part, or copy one with x-amz-copy-source",
+		params: []surfaceParam{{name: "partNumber", in: "query", typ: "integer", required: true, desc: "1-10000."}, uploadIDParam,
+			header("Content-MD5", ""), header("x-amz-copy-source", "Copy the part from /bucket/key (UploadPartCopy)."),
+			header("x-amz-copy-source-range", "bytes=first-last of the source.")},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchUpload, s3err.ErrInvalidArgument, s3err.ErrEntityTooLarge,
+			s3err.ErrBadDigest, s3err.ErrInvalidDigest, s3err.ErrNoSuchKey, s3err.ErrInvalidRange}},
+	s3op.CompleteMultipartUpload: {summary: "Assemble uploaded parts into an object", params: []surfaceParam{uploadIDParam},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchUpload, s3err.ErrInvalidPart, s3err.ErrInvalidPartOrder,
+			s3err.ErrEntityTooSmall, s3err.ErrMalformedXML, s3err.ErrQuotaExceeded}},
+	s3op.AbortMultipartUpload: {summary: "Abort a multipart upload", status: http.StatusNoContent, params: []surfaceParam{uploadIDParam},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchUpload}},
+	s3op.ListParts: {summary: "List the parts of a multipart upload",
+		params: []surfaceParam{uploadIDParam, intQuery("max-parts", ""), intQuery("part-number-marker", "")},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchUpload, s3err.ErrInvalidArgument}},
+	s3op.ListMultipartUploads: {summary: "List in-progress multipart uploads",
+		params: []surfaceParam{query("prefix", ""), query("delimiter", ""), query("key-marker", ""),
+			query("upload-id-marker", ""), intQuery("max-uploads", ""), query("encoding-type", "")},
+		errors: []*s3err.S3Error{s3err.ErrNoSuchBucket, s3err.ErrInvalidArgument}},
+}
+
+// surfaceEndpoint documents a BleepStore extension endpoint.
+type surfaceEndpoint struct {
+	method, path, summary string
+	params                []surfaceParam
+}
+
+// extensionEndpoints returns the non-S3 endpoints enabled on this server.
+func (s *Server) extensionEndpoints() []surfaceEndpoint {
+	eps := []surfaceEndpoint{
+		{method: http.MethodGet, path: "/health", summary: "Health check with component status"},
+		{method: http.MethodGet, path: "/healthz", summary: "Liveness probe"},
+		{method: http.MethodGet, path: "/readyz", summary: "Readiness probe"},
+		{method: http.MethodGet, path: "/metrics", summary: "Prometheus metrics"},
+		{method: http.MethodGet, path: "/openapi.json", summary: "Canonical BleepStore S3 API specification"},
+		{method: http.MethodGet, path: "/admin/v1/openapi.json", summary: "This document"},
+		{method: http.MethodPost, path: "/admin/preload", summary: "Read objects under a prefix into the cache",
+			params: []surfaceParam{{name: "bucket", in: "query", required: true}, query("prefix", ""), intQuery("max-bytes", ""), asyncParam}},
+		{method: http.MethodGet, path: "/admin/jobs", summary: "Running and recently finished long-running operations",
+			params: []surfaceParam{query("state", "running, succeeded, failed or cancelled.")}},
+		{method: http.MethodGet, path: "/admin/jobs/{id}", summary: "A job's progress and outcome", params: []surfaceParam{jobIDParam}},
+		{method: http.MethodPost, path: "/admin/jobs/{id}/cancel", summary: "Cancel a running job", params: []surfaceParam{jobIDParam}},
+		{method: http.MethodGet, path: "/admin/consistency", summary: "Declared read-after-write and list-after-write guarantees"},
+		{method: http.MethodPost, path: "/admin/consistency", summary: "Probe read-after-write and list-after-write consistency",
+			params: []surfaceParam{{name: "bucket", in: "query", required: true}}},
+		{method: http.MethodGet, path: "/admin/bucket-health/{bucket}", summary: "Check a bucket's metadata and write, read and delete a probe in its storage",
+			params: []surfaceParam{{name: "bucket", in: "path", required: true}}},
+		{method: http.MethodPost, path: "/admin/provision", summary: "Diff or apply a manifest of buckets, seed objects and credentials",
+			params: []surfaceParam{query("mode", "diff (default) or apply."),
+				header("Idempotency-Key", "Replays the first response to an apply with this key.")}},
+		{method: http.MethodGet, path: "/admin/rate-limits", summary: "Rate limits in force and clients' token balances"},
+		{method: http.MethodGet, path: "/admin/request-logging", summary: "Request log sample rate and per-bucket overrides"},
+		{method: http.MethodPut, path: "/admin/request-logging/{bucket}", summary: "Log a bucket's requests verbosely for a while",
+			params: []surfaceParam{{name: "bucket", in: "path", required: true}}},
+		{method: http.MethodDelete, path: "/admin/request-logging/{bucket}", summary: "Remove a bucket's request logging override",
+			params: []surfaceParam{{name: "bucket", in: "path", required: true}}},
+		{method: http.MethodGet, path: "/admin/watch", summary: "Stream the requests to a bucket or key as Server-Sent Events",
+			params: []surfaceParam{{name: "bucket", in: "query", required: true}, query("key", "Watch only this key.")}},
+		{method: http.MethodPost, path: "/admin/backup/pre", summary: "Quiesce writes, checkpoint the metadata WAL and write a backup marker"},
+		{method: http.MethodPost, path: "/admin/backup/post", summary: "Resume writes after a backup",
+			params: []surfaceParam{{name: "id", in: "query", required: true, desc: "The backup_id returned by the pre hook."}}},
+	}
+	if s.usage != nil {
+		eps = append(eps, surfaceEndpoint{method: http.MethodGet, path: "/admin/usage", summary: "Per-access-key usage",
+			params: []surfaceParam{query("access_key", ""), query("bucket", ""),
+				query("since", "RFC 3339."), query("until", "RFC 3339.")}})
+	}
+	if _, ok := s.store.(storage.Rebalancer); ok {
+		eps = append(eps, surfaceEndpoint{method: http.MethodPost, path: "/admin/rebalance", summary: "Rebalance objects across data roots",
+			params: []surfaceParam{{name: "threshold", in: "query", typ: "number", desc: "Acceptable utilization spread (default 0.05)."}, asyncParam}})
+	}
+	if _, ok := s.store.(storage.Rebuilder); ok {
+		eps = append(eps, surfaceEndpoint{method: http.MethodPost, path: "/admin/rebuild", summary: "Rewrite missing or damaged shards",
+			params: []surfaceParam{{name: "dry-run", in: "query", typ: "boolean", desc: "Only report the damage."}, asyncParam}})
+	}
+	if s.orphans != nil {
+		eps = append(eps, surfaceEndpoint{method: http.MethodPost, path: "/admin/orphans", summary: "Remove data files no metadata record refers to",
+			params: []surfaceParam{{name: "dry-run", in: "query", typ: "boolean", desc: "Only report the orphans."}, asyncParam}})
+	}
+	if s.scrub != nil {
+		eps = append(eps, surfaceEndpoint{method: http.MethodPost, path: "/admin/scrub", summary: "Re-hash stored objects and repair damaged ones",
+			params: []surfaceParam{query("bucket", "Scrub only this bucket."), asyncParam}})
+	}
+	if s.inventory != nil {
+		eps = append(eps, surfaceEndpoint{method: http.MethodPost, path: "/admin/inventory", summary: "Write inventory reports now, whether or not they are due",
+			params: []surfaceParam{query("bucket", "Report only this bucket's configurations."),
+				query("id", "Report only this configuration of bucket, even if disabled."), asyncParam}})
+	}
+	if s.replVerify != nil {
+		eps = append(eps, surfaceEndpoint{method: http.MethodPost, path: "/admin/bucket-replication/verify", summary: "Compare replicated objects with their replicas and write divergence reports",
+			params: []surfaceParam{query("bucket", "Verify only this bucket."),
+				{name: "sample_rate", in: "query", typ: "number", desc: "Fraction of objects checked, overriding the configured rate."}, asyncParam}})
+	}
+	if s.freezes != nil {
+		bucketParam := surfaceParam{name: "bucket", in: "path", required: true}
+		eps = append(eps,
+			surfaceEndpoint{method: http.MethodGet, path: "/admin/frozen-buckets", summary: "Buckets frozen read-only"},
+			surfaceEndpoint{method: http.MethodPut, path: "/admin/frozen-buckets/{bucket}", summary: "Freeze a bucket: reject its writes and deletes",
+				params: []surfaceParam{bucketParam}},
+			surfaceEndpoint{method: http.MethodDelete, path: "/admin/frozen-buckets/{bucket}", summary: "Unfreeze a bucket",
+				params: []surfaceParam{bucketParam}})
+	}
+	if s.erasure != nil {
+		eps = append(eps,
+			surfaceEndpoint{method: http.MethodPost, path: "/admin/erasure-requests", summary: "Register a request to erase objects by key, prefix or user metadata"},
+			surfaceEndpoint{method: http.MethodGet, path: "/admin/erasure-requests", summary: "Registered erasure requests"},
+			surfaceEndpoint{method: http.MethodGet, path: "/admin/erasure-requests/{id}", summary: "An erasure request and its signed report",
+				params: []surfaceParam{jobIDParam}},
+			surfaceEndpoint{method: http.MethodPost, path: "/admin/erasure-requests/{id}/execute", summary: "Erase, purge and verify, returning a signed report",
+				params: []surfaceParam{jobIDParam, asyncParam}})
+	}
+	if _, ok := s.store.(storage.PlacementReporter); ok {
+		eps = append(eps, surfaceEndpoint{method: http.MethodGet, path: "/admin/placement", summary: "Placement policy, or where the copies of objects are",
+			params: []surfaceParam{query("bucket", "Scan the bucket for under-replicated objects."), query("key", "Report one object."), query("prefix", "")}})
+	}
+	if s.cfg.Auth.Delegation.Secret != "" {
+		eps = append(eps, surfaceEndpoint{method: http.MethodPost, path: "/admin/delegation-tokens", summary: "Mint a prefix-scoped delegation token",
+			params: []surfaceParam{{name: "bucket", in: "query", required: true}, query("prefix", ""),
+				query("access", "read or write."), intQuery("expires-in", "Seconds.")}})
+	}
+	if s.ha != nil {
+		eps = append(eps, surfaceEndpoint{method: http.MethodGet, path: "/admin/ha", summary: "This instance's HA role and the current leader"})
+	}
+	if _, ok := s.store.(storage.Replicator); ok {
+		eps = append(eps, surfaceEndpoint{method: http.MethodGet, path: replicationPath, summary: "Stream the memory backend's objects and changes to a replica"})
+	}
+	return eps
+}
+
+// surfacePath returns the path-item key for a route.
+func surfacePath(rt s3op.Route) string {
+	var path string
+	switch rt.Scope {
+	case s3op.ScopeService:
+		path = "/"
+	case s3op.ScopeBucket:
+		path = "/{Bucket}"
+	default:
+		path = "/{Bucket}/{Key+}"
+	}
+	if len(rt.Query) > 0 {
+		path += "?" + strings.Join(rt.Query, "&")
+	}
+	if rt.Header != "" {
+		path += "#" + strings.ToLower(rt.Header)
+	}
+	return path
+}
+
+// openAPIParams converts parameters to OpenAPI parameter objects.
+func openAPIParams(params []surfaceParam) []map[string]any {
+	out := make([]map[string]any, 0, len(params))
+	for _, p := range params {
+		typ := p.typ
+		if typ == "" {
+			typ = "string"
+		}
+		obj := map[string]any{"name": p.name, "in": p.in, "schema": map[string]any{"type": typ}}
+		if p.required {
+			obj["required"] = true
+		}
+		if p.desc != "" {
+			obj["description"] = p.desc
+		}
+		out = append(out, obj)
+	}
+	return out
+}
+
+// openAPIResponses groups error codes by HTTP status.
+func openAPIResponses(success int, errs []*s3err.S3Error) map[string]any {
+	codes := make(map[int][]string)
+	for _, e := range errs {
+		if !slices.Contains(codes[e.HTTPStatus], e.Code) {
+			codes[e.HTTPStatus] = append(codes[e.HTTPStatus], e.Code)
+		}
+	}
+	responses := map[string]any{strconv.Itoa(success): map[string]any{"description": http.StatusText(success)}}
+	for status, list := range codes {
+		sort.Strings(list)
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description":      strings.Join(list, ", "),
+			"x-s3-error-codes": list,
+			"content":          map[string]any{"application/xml": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}},
+		}
+	}
+	return responses
+}
+
+// surfaceSpec builds the OpenAPI document for the operations and extension
+// endpoints this server serves.
+func (s *Server) surfaceSpec() ([]byte, error) {
+	bucketParam := map[string]any{"name": "Bucket", "in": "path", "required": true,
+		"schema": map[string]any{"type": "string"}}
+	keyParam := map[string]any{"name": "Key+", "in": "path", "required": true,
+		"schema": map[string]any{"type": "string"}, "description": "Object key; may contain slashes."}
+
+	paths := make(map[string]map[string]any)
+	for _, rt := range s3op.Routes {
+		if s.disabledOps[rt.Operation] {
+			continue
+		}
+		doc := surfaceOps[rt.Operation]
+		var params []map[string]any
+		switch rt.Scope {
+		case s3op.ScopeBucket:
+			params = append(params, bucketParam)
+		case s3op.ScopeObject:
+			params = append(params, bucketParam, keyParam)
+		}
+		for _, name := range rt.Query {
+			if !hasParam(doc.params, name) {
+				params = append(params, map[string]any{"name": name, "in": "query", "required": true,
+					"allowEmptyValue": true, "schema": map[string]any{"type": "string"}})
+			}
+		}
+		params = append(params, openAPIParams(doc.params)...)
+		success := doc.status
+		if success == 0 {
+			success = http.StatusOK
+		}
+
+		path := surfacePath(rt)
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(rt.Method)] = map[string]any{
+			"operationId":         string(rt.Operation),
+			"summary":             doc.summary,
+			"tags":                []string{"S3"},
+			"parameters":          params,
+			"responses":           openAPIResponses(success, append(doc.errors, commonErrors...)),
+			"x-bleepstore-action": rt.Operation.Action(),
+		}
+	}
+	for _, ep := range s.extensionEndpoints() {
+		if paths[ep.path] == nil {
+			paths[ep.path] = make(map[string]any)
+		}
+		paths[ep.path][strings.ToLower(ep.method)] = map[string]any{
+			"summary":    ep.summary,
+			"tags":       []string{"Extensions"},
+			"parameters": openAPIParams(ep.params),
+			"responses":  map[string]any{"200": map[string]any{"description": "OK"}},
+		}
+	}
+
+	return json.Marshal(map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "BleepStore supported surface",
+			"version":     "1.0.0",
+			"description": "S3 operations and extension endpoints served by this instance, generated from its route table and configuration.",
+		},
+		"tags": []map[string]string{
+			{"name": "S3", "description": "S3-compatible operations"},
+			{"name": "Extensions", "description": "BleepStore-specific endpoints"},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"Error": map[string]any{
+					"type": "object",
+					"xml":  map[string]any{"name": "Error"},
+					"properties": map[string]any{
+						"Code":      map[string]any{"type": "string"},
+						"Message":   map[string]any{"type": "string"},
+						"Resource":  map[string]any{"type": "string"},
+						"RequestId": map[string]any{"type": "string"},
+					},
+				},
+			},
+		},
+	})
+}
+
+// hasParam reports whether params documents name.
+func hasParam(params []surfaceParam, name string) bool {
+	for _, p := range params {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSurfaceSpec serves the generated surface description.
+func (s *Server) handleSurfaceSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.surfaceJSON)
+}
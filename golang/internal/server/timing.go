@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// timingPhase identifies a request phase reported in Server-Timing.
+type timingPhase int
+
+const (
+	phaseAuth timingPhase = iota
+	phaseMetadata
+	phaseStorage
+	numTimingPhases
+)
+
+// timingPhaseNames are the Server-Timing metric names, indexed by phase.
+var timingPhaseNames = [numTimingPhases]string{"auth", "metadata", "storage"}
+
+// requestTiming accumulates per-phase durations for one request.
+type requestTiming struct {
+	start  time.Time
+	phases [numTimingPhases]atomic.Int64 // nanoseconds
+}
+
+type timingKey struct{}
+
+// timingFromContext returns the request's timing accumulator, or nil when
+// Server-Timing is disabled.
+func timingFromContext(ctx context.Context) *requestTiming {
+	t, _ := ctx.Value(timingKey{}).(*requestTiming)
+	return t
+}
+
+// observePhase adds the time elapsed since start to a phase. Intended for
+// use as `defer observePhase(ctx, phaseX, time.Now())`.
+func observePhase(ctx context.Context, phase timingPhase, start time.Time) {
+	if t := timingFromContext(ctx); t != nil {
+		t.phases[phase].Add(int64(time.Since(start)))
+	}
+}
+
+// header formats the Server-Timing header value.
+func (t *requestTiming) header() string {
+	var v string
+	for i, name := range timingPhaseNames {
+		v += fmt.Sprintf("%s;dur=%.3f, ", name, float64(t.phases[i].Load())/1e6)
+	}
+	return v + fmt.Sprintf("total;dur=%.3f", float64(time.Since(t.start))/1e6)
+}
+
+// timingResponseWriter sets the Server-Timing header just before the
+// response header is sent.
+type timingResponseWriter struct {
+	http.ResponseWriter
+	timing      *requestTiming
+	wroteHeader bool
+}
+
+func (tw *timingResponseWriter) WriteHeader(code int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.Header().Set("Server-Timing", tw.timing.header())
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timingResponseWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timingResponseWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// serverTimingMiddleware attaches a timing accumulator to the request and
+// emits the Server-Timing header. It must wrap the auth middleware; the
+// auth phase is closed by authTimingMiddleware on the inside.
+func serverTimingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := &requestTiming{start: time.Now()}
+		r = r.WithContext(context.WithValue(r.Context(), timingKey{}, t))
+		next.ServeHTTP(&timingResponseWriter{ResponseWriter: w, timing: t}, r)
+	})
+}
+
+// authTimingMiddleware records the time spent before the request got past
+// authentication. It must sit directly inside the auth middleware.
+func authTimingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t := timingFromContext(r.Context()); t != nil {
+			t.phases[phaseAuth].Store(int64(time.Since(t.start)))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timedMetadataStore records the time spent in each metadata call against
+// the request's metadata phase.
+type timedMetadataStore struct {
+	metadata.MetadataStore
+}
+
+func (m timedMetadataStore) Ping(ctx context.Context) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.Ping(ctx)
+}
+
+func (m timedMetadataStore) CreateBucket(ctx context.Context, bucket *metadata.BucketRecord) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.CreateBucket(ctx, bucket)
+}
+
+func (m timedMetadataStore) GetBucket(ctx context.Context, name string) (*metadata.BucketRecord, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.GetBucket(ctx, name)
+}
+
+func (m timedMetadataStore) DeleteBucket(ctx context.Context, name string) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.DeleteBucket(ctx, name)
+}
+
+func (m timedMetadataStore) ListBuckets(ctx context.Context, owner string) ([]metadata.BucketRecord, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.ListBuckets(ctx, owner)
+}
+
+func (m timedMetadataStore) BucketExists(ctx context.Context, name string) (bool, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.BucketExists(ctx, name)
+}
+
+func (m timedMetadataStore) UpdateBucketAcl(ctx context.Context, name string, acl json.RawMessage) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.UpdateBucketAcl(ctx, name, acl)
+}
+
+func (m timedMetadataStore) PutObject(ctx context.Context, obj *metadata.ObjectRecord) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.PutObject(ctx, obj)
+}
+
+func (m timedMetadataStore) GetObject(ctx context.Context, bucket, key string) (*metadata.ObjectRecord, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.GetObject(ctx, bucket, key)
+}
+
+func (m timedMetadataStore) DeleteObject(ctx context.Context, bucket, key string) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.DeleteObject(ctx, bucket, key)
+}
+
+func (m timedMetadataStore) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.ObjectExists(ctx, bucket, key)
+}
+
+func (m timedMetadataStore) DeleteObjectsMeta(ctx context.Context, bucket string, keys []string) ([]string, []error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.DeleteObjectsMeta(ctx, bucket, keys)
+}
+
+func (m timedMetadataStore) UpdateObjectAcl(ctx context.Context, bucket, key string, acl json.RawMessage) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.UpdateObjectAcl(ctx, bucket, key, acl)
+}
+
+func (m timedMetadataStore) ListObjects(ctx context.Context, bucket string, opts metadata.ListObjectsOptions) (*metadata.ListObjectsResult, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.ListObjects(ctx, bucket, opts)
+}
+
+func (m timedMetadataStore) CreateMultipartUpload(ctx context.Context, upload *metadata.MultipartUploadRecord) (string, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.CreateMultipartUpload(ctx, upload)
+}
+
+func (m timedMetadataStore) GetMultipartUpload(ctx context.Context, bucket, key, uploadID string) (*metadata.MultipartUploadRecord, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.GetMultipartUpload(ctx, bucket, key, uploadID)
+}
+
+func (m timedMetadataStore) PutPart(ctx context.Context, part *metadata.PartRecord) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.PutPart(ctx, part)
+}
+
+func (m timedMetadataStore) ListParts(ctx context.Context, uploadID string, opts metadata.ListPartsOptions) (*metadata.ListPartsResult, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.ListParts(ctx, uploadID, opts)
+}
+
+func (m timedMetadataStore) GetPartsForCompletion(ctx context.Context, uploadID string, partNumbers []int) ([]metadata.PartRecord, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.GetPartsForCompletion(ctx, uploadID, partNumbers)
+}
+
+func (m timedMetadataStore) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, obj *metadata.ObjectRecord) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.CompleteMultipartUpload(ctx, bucket, key, uploadID, obj)
+}
+
+func (m timedMetadataStore) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.AbortMultipartUpload(ctx, bucket, key, uploadID)
+}
+
+func (m timedMetadataStore) ListMultipartUploads(ctx context.Context, bucket string, opts metadata.ListUploadsOptions) (*metadata.ListUploadsResult, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.ListMultipartUploads(ctx, bucket, opts)
+}
+
+func (m timedMetadataStore) GetCredential(ctx context.Context, accessKeyID string) (*metadata.CredentialRecord, error) {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.GetCredential(ctx, accessKeyID)
+}
+
+func (m timedMetadataStore) PutCredential(ctx context.Context, cred *metadata.CredentialRecord) error {
+	defer observePhase(ctx, phaseMetadata, time.Now())
+	return m.MetadataStore.PutCredential(ctx, cred)
+}
+
+// timedStorageBackend records the time spent in each storage call against
+// the request's storage phase. For GetObject only opening the object is
+// timed; the body is streamed after the header has been sent.
+type timedStorageBackend struct {
+	storage.StorageBackend
+}
+
+func (b timedStorageBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.PutObject(ctx, bucket, key, reader, size)
+}
+
+func (b timedStorageBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.GetObject(ctx, bucket, key)
+}
+
+func (b timedStorageBackend) DeleteObject(ctx context.Context, bucket, key string) error {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.DeleteObject(ctx, bucket, key)
+}
+
+func (b timedStorageBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (string, error) {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+func (b timedStorageBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.PutPart(ctx, bucket, key, uploadID, partNumber, reader, size)
+}
+
+func (b timedStorageBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.AssembleParts(ctx, bucket, key, uploadID, partNumbers)
+}
+
+func (b timedStorageBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.DeleteParts(ctx, bucket, key, uploadID)
+}
+
+func (b timedStorageBackend) CreateBucket(ctx context.Context, bucket string) error {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.CreateBucket(ctx, bucket)
+}
+
+func (b timedStorageBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.DeleteBucket(ctx, bucket)
+}
+
+func (b timedStorageBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.ObjectExists(ctx, bucket, key)
+}
+
+func (b timedStorageBackend) HealthCheck(ctx context.Context) error {
+	defer observePhase(ctx, phaseStorage, time.Now())
+	return b.StorageBackend.HealthCheck(ctx)
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certReloader serves a certificate loaded from disk and reloads it when
+// either file changes, so rotated certificates are picked up without a
+// restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the initial key pair, failing if it is unreadable.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// latestModTime returns the newer of the certificate and key mtimes.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload re-reads the key pair if the files changed since the last load.
+// Callers other than newCertReloader must hold r.mu.
+func (r *certReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return fmt.Errorf("stat TLS certificate: %w", err)
+	}
+	if r.cert != nil && modTime.Equal(r.modTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS key pair: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. A failed reload
+// (e.g. a half-written file during rotation) keeps serving the old pair.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.reload(); err != nil {
+		slog.Warn("TLS certificate reload failed, keeping previous", "error", err)
+	}
+	return r.cert, nil
+}
+
+// newTLSConfig builds the HTTPS listener configuration. It also returns a
+// wrapper for the plain HTTP listener's handler, which answers ACME HTTP-01
+// challenges when ACME is enabled. Custom domains with their own key pair
+// are served it when a client asks for them by SNI; with ACME, those
+// without one are added to the hostnames certificates are obtained for.
+func newTLSConfig(cfg config.TLSConfig, domains map[string]config.CustomDomainConfig) (*tls.Config, func(http.Handler) http.Handler, error) {
+	sni := map[string]*certReloader{}
+	var acmeHosts []string
+	for host, d := range domains {
+		if d.CertFile == "" && d.KeyFile == "" {
+			acmeHosts = append(acmeHosts, host)
+			continue
+		}
+		if d.CertFile == "" || d.KeyFile == "" {
+			return nil, nil, fmt.Errorf("custom domain %q: cert_file and key_file must be set together", host)
+		}
+		reloader, err := newCertReloader(d.CertFile, d.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("custom domain %q: %w", host, err)
+		}
+		sni[strings.ToLower(host)] = reloader
+	}
+
+	var (
+		tlsCfg  *tls.Config
+		wrapper func(http.Handler) http.Handler
+	)
+	if cfg.ACME.Enabled {
+		hostnames := append(slices.Clone(cfg.ACME.Hostnames), acmeHosts...)
+		if len(hostnames) == 0 {
+			return nil, nil, fmt.Errorf("tls.acme.hostnames must list at least one hostname")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(hostnames...),
+			Cache:      autocert.DirCache(cfg.ACME.CacheDir),
+			Email:      cfg.ACME.Email,
+		}
+		if cfg.ACME.DirectoryURL != "" {
+			m.Client = &acme.Client{DirectoryURL: cfg.ACME.DirectoryURL}
+		}
+		tlsCfg = m.TLSConfig()
+		wrapper = m.HTTPHandler
+	} else {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, nil, fmt.Errorf("tls.cert_file and tls.key_file are required unless tls.acme is enabled")
+		}
+		reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsCfg = &tls.Config{GetCertificate: reloader.GetCertificate}
+		wrapper = func(h http.Handler) http.Handler { return h }
+	}
+	tlsCfg.MinVersion = tls.VersionTLS12
+	if len(sni) > 0 {
+		fallback := tlsCfg.GetCertificate
+		tlsCfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if r, ok := sni[strings.ToLower(hello.ServerName)]; ok {
+				return r.GetCertificate(hello)
+			}
+			return fallback(hello)
+		}
+	}
+	if err := applyClientAuth(tlsCfg, cfg.ClientAuth); err != nil {
+		return nil, nil, err
+	}
+	return tlsCfg, wrapper, nil
+}
+
+// applyClientAuth configures client certificate verification for mutual TLS.
+func applyClientAuth(tlsCfg *tls.Config, cfg config.ClientAuthConfig) error {
+	var mode tls.ClientAuthType
+	switch cfg.Mode {
+	case "", "none":
+		return nil
+	case "optional":
+		mode = tls.VerifyClientCertIfGiven
+	case "require":
+		mode = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("unknown tls.client_auth.mode %q (want none, optional or require)", cfg.Mode)
+	}
+	if cfg.CAFile == "" {
+		return fmt.Errorf("tls.client_auth.ca_file is required when client_auth.mode is %q", cfg.Mode)
+	}
+	pemData, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return fmt.Errorf("reading client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return fmt.Errorf("no certificates found in client CA file %s", cfg.CAFile)
+	}
+	tlsCfg.ClientAuth = mode
+	tlsCfg.ClientCAs = pool
+	return nil
+}
+
+// httpsRedirectHandler redirects every plain HTTP request to the same host
+// and path on the HTTPS port. 308 preserves the method and body so S3
+// clients retry writes correctly.
+func httpsRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	"github.com/bleepstore/bleepstore/internal/clock"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/handlers"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// usageCounterKey identifies one in-memory usage counter.
+type usageCounterKey struct {
+	accessKey string
+	bucket    string
+	period    time.Time
+}
+
+// usageCounter holds the counters accumulated since the last flush.
+type usageCounter struct {
+	requests int64
+	bytesIn  int64
+	bytesOut int64
+}
+
+// usageAggregator accumulates per-access-key usage in memory and periodically
+// flushes it to a metadata.UsageStore. Counters that have not been flushed
+// when the process dies are lost; usage accounting is best-effort.
+type usageAggregator struct {
+	store    metadata.UsageStore
+	interval time.Duration
+	clock    clock.Clock // dates counters into hourly periods
+	gate     *writeGate  // closed while writes are quiesced for a backup
+
+	mu       sync.Mutex
+	counters map[usageCounterKey]*usageCounter
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newUsageAggregator creates an aggregator that flushes to store every
+// interval and dates usage by clk.
+func newUsageAggregator(store metadata.UsageStore, interval time.Duration, clk clock.Clock) *usageAggregator {
+	return &usageAggregator{
+		store:    store,
+		interval: interval,
+		clock:    clk,
+		counters: make(map[usageCounterKey]*usageCounter),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// record adds one request and its transfer sizes to the current hour's counter.
+func (u *usageAggregator) record(accessKey, bucket string, bytesIn, bytesOut int64) {
+	k := usageCounterKey{
+		accessKey: accessKey,
+		bucket:    bucket,
+		period:    u.clock.Now().UTC().Truncate(time.Hour),
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	c, ok := u.counters[k]
+	if !ok {
+		c = &usageCounter{}
+		u.counters[k] = c
+	}
+	c.requests++
+	c.bytesIn += bytesIn
+	c.bytesOut += bytesOut
+}
+
+// flush writes all accumulated counters to the store. On failure the
+// counters are merged back so the next flush retries them.
+func (u *usageAggregator) flush(ctx context.Context) error {
+	u.mu.Lock()
+	pending := u.counters
+	u.counters = make(map[usageCounterKey]*usageCounter)
+	u.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	records := make([]metadata.UsageRecord, 0, len(pending))
+	for k, c := range pending {
+		records = append(records, metadata.UsageRecord{
+			AccessKey: k.accessKey,
+			Bucket:    k.bucket,
+			Period:    k.period,
+			Requests:  c.requests,
+			BytesIn:   c.bytesIn,
+			BytesOut:  c.bytesOut,
+		})
+	}
+
+	if err := u.store.AddUsage(ctx, records); err != nil {
+		u.mu.Lock()
+		for k, c := range pending {
+			if cur, ok := u.counters[k]; ok {
+				cur.requests += c.requests
+				cur.bytesIn += c.bytesIn
+				cur.bytesOut += c.bytesOut
+			} else {
+				u.counters[k] = c
+			}
+		}
+		u.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// start launches the background flush loop.
+func (u *usageAggregator) start() {
+	u.wg.Add(1)
+	go u.flushLoop()
+}
+
+// stop terminates the flush loop and performs a final flush.
+func (u *usageAggregator) stop(ctx context.Context) error {
+	close(u.stopCh)
+	u.wg.Wait()
+	return u.flush(ctx)
+}
+
+// flushLoop periodically flushes counters until stop is called.
+func (u *usageAggregator) flushLoop() {
+	defer u.wg.Done()
+
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.stopCh:
+			return
+		case <-ticker.C:
+			// Counters keep accumulating while writes are quiesced.
+			if !u.gate.enterAny() {
+				continue
+			}
+			if err := u.flush(context.Background()); err != nil {
+				slog.Error("Usage flush error", "error", err)
+			}
+			u.gate.leave()
+		}
+	}
+}
+
+// usageMiddleware records request counts and bytes transferred per
+// authenticated access key and bucket. It must run inside the auth
+// middleware so the access key is available on the request context.
+func usageMiddleware(u *usageAggregator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isInfraPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &responseRecorder{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+			next.ServeHTTP(rec, r)
+
+			accessKey := auth.AccessKeyFromContext(r.Context())
+			if accessKey == "" {
+				return
+			}
+			// Read the path after the handler so aliases are attributed to
+			// the bucket they resolved to.
+			bucket, _ := handlers.SplitPath(r.URL.Path)
+			var bytesIn int64
+			if r.ContentLength > 0 {
+				bytesIn = r.ContentLength
+			}
+			u.record(accessKey, bucket, bytesIn, int64(rec.bytesWritten))
+		})
+	}
+}
+
+// usageEntry is the JSON representation of one usage record.
+type usageEntry struct {
+	Period    string `json:"period"`
+	AccessKey string `json:"access_key"`
+	Bucket    string `json:"bucket"`
+	Requests  int64  `json:"requests"`
+	BytesIn   int64  `json:"bytes_in"`
+	BytesOut  int64  `json:"bytes_out"`
+}
+
+// handleUsage returns persisted usage records as JSON. Query parameters
+// access_key, bucket, since and until (RFC 3339) filter the result.
+// Counters still buffered in memory are flushed first so the response is current.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.meta.(metadata.UsageStore)
+	if !ok || s.usage == nil {
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrNotImplemented)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := metadata.UsageFilter{
+		AccessKey: q.Get("access_key"),
+		Bucket:    q.Get("bucket"),
+	}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			xmlutil.WriteErrorResponse(w, r, s3err.ErrInvalidArgument)
+			return
+		}
+		*dst = t
+	}
+
+	if err := s.usage.flush(r.Context()); err != nil {
+		slog.Error("Usage flush error", "error", err)
+	}
+
+	records, err := store.ListUsage(r.Context(), filter)
+	if err != nil {
+		slog.Error("ListUsage error", "error", err)
+		xmlutil.WriteErrorResponse(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	entries := make([]usageEntry, 0, len(records))
+	for _, rec := range records {
+		entries = append(entries, usageEntry{
+			Period:    rec.Period.UTC().Format(time.RFC3339),
+			AccessKey: rec.AccessKey,
+			Bucket:    rec.Bucket,
+			Requests:  rec.Requests,
+			BytesIn:   rec.BytesIn,
+			BytesOut:  rec.BytesOut,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"usage": entries})
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/auth"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/handlers"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+const (
+	// watchBuffer is how many events a watcher may fall behind by before
+	// further events are dropped for it.
+	watchBuffer = 256
+	// watchKeepalive is how often an idle watch stream sends a comment,
+	// so proxies do not close it.
+	watchKeepalive = 15 * time.Second
+)
+
+// watchEvent is one completed S3 request, as sent to watchers.
+type watchEvent struct {
+	Time       string  `json:"time"`
+	RequestID  string  `json:"request_id"`
+	Operation  string  `json:"operation"`
+	Method     string  `json:"method"`
+	Bucket     string  `json:"bucket"`
+	Key        string  `json:"key,omitempty"`
+	VersionID  string  `json:"version_id,omitempty"`
+	Status     int     `json:"status"`
+	Bytes      int     `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	// AccessKey is the principal, or "" for anonymous requests.
+	AccessKey  string `json:"access_key"`
+	RemoteAddr string `json:"remote_addr"`
+	UserAgent  string `json:"user_agent,omitempty"`
+}
+
+// watcher receives the events of requests to one bucket, or to one key in
+// it.
+type watcher struct {
+	bucket string
+	key    string
+	events chan watchEvent
+	// dropped counts the events not delivered because the watcher fell
+	// behind.
+	dropped atomic.Int64
+}
+
+// matches reports whether a request to bucket and key concerns w. A
+// bucket watcher sees every request to the bucket, its object requests
+// included.
+func (w *watcher) matches(bucket, key string) bool {
+	return w.bucket == bucket && (w.key == "" || w.key == key)
+}
+
+// watchHub fans completed S3 requests out to the watchers of their bucket
+// or key. Watches live in memory on the instance serving them, so behind
+// a load balancer they see only that instance's requests.
+type watchHub struct {
+	// count is the number of watchers, read without the lock so requests
+	// pay nothing while nobody watches.
+	count atomic.Int32
+
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{watchers: make(map[*watcher]struct{})}
+}
+
+// add registers a watcher of bucket, or of key in it when key is set.
+func (h *watchHub) add(bucket, key string) *watcher {
+	w := &watcher{bucket: bucket, key: key, events: make(chan watchEvent, watchBuffer)}
+	h.mu.Lock()
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+	h.count.Add(1)
+	return w
+}
+
+// remove unregisters w.
+func (h *watchHub) remove(w *watcher) {
+	h.mu.Lock()
+	delete(h.watchers, w)
+	h.mu.Unlock()
+	h.count.Add(-1)
+}
+
+// watched reports whether any watcher concerns a request to bucket and key.
+func (h *watchHub) watched(bucket, key string) bool {
+	if h.count.Load() == 0 || bucket == "" {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		if w.matches(bucket, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// publish sends the completed request's event to its watchers. rec has
+// recorded the response; start is when the request was dispatched. A
+// watcher that has fallen behind misses the event rather than slowing the
+// request down.
+func (h *watchHub) publish(r *http.Request, rc *handlers.RequestContext, rec *responseRecorder, start time.Time) {
+	ev := watchEvent{
+		Time:       xmlutil.FormatTimeS3(start),
+		RequestID:  rc.RequestID,
+		Operation:  string(rc.Operation),
+		Method:     r.Method,
+		Bucket:     rc.Bucket,
+		Key:        rc.Key,
+		VersionID:  rc.Query.Get("versionId"),
+		Status:     rec.statusCode,
+		Bytes:      rec.bytesWritten,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		AccessKey:  auth.AccessKeyFromContext(r.Context()),
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		if !w.matches(ev.Bucket, ev.Key) {
+			continue
+		}
+		select {
+		case w.events <- ev:
+		default:
+			w.dropped.Add(1)
+		}
+	}
+}
+
+// handleWatch serves GET /admin/watch?bucket=...[&key=...], a
+// Server-Sent Events stream of the S3 requests to a bucket, or to one key
+// in it, as they complete: operation, status, bytes, latency and the
+// access key that made them. Each request is a "request" event with a JSON
+// watchEvent; a "dropped" event reports how many were skipped because the
+// client read too slowly. The stream lasts until the client disconnects.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		xmlutil.WriteErrorResponse(w, r, &s3err.S3Error{
+			Code:       "InvalidArgument",
+			Message:    "The bucket query parameter is required",
+			HTTPStatus: http.StatusBadRequest,
+		})
+		return
+	}
+	key := r.URL.Query().Get("key")
+
+	watch := s.watches.add(bucket, key)
+	defer s.watches.remove(watch)
+
+	rc := http.NewResponseController(w)
+	// The stream outlives any server write timeout.
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	// Tell the client the watch is in place before any event arrives.
+	fmt.Fprintf(w, ": watching %s/%s\n\n", bucket, key)
+	rc.Flush()
+
+	slog.Info("Watch opened", "bucket", bucket, "key", key, "remote", r.RemoteAddr)
+	defer slog.Info("Watch closed", "bucket", bucket, "key", key, "remote", r.RemoteAddr)
+	keepalive := time.NewTicker(watchKeepalive)
+	defer keepalive.Stop()
+	var reported int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-watch.events:
+			if dropped := watch.dropped.Load(); dropped != reported {
+				fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped-reported)
+				reported = dropped
+			}
+			data, _ := json.Marshal(ev)
+			if _, err := fmt.Fprintf(w, "event: request\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bleepstore/bleepstore/internal/handlers"
+	"github.com/bleepstore/bleepstore/internal/s3op"
+)
+
+func TestWatch(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	ctx := context.Background()
+	srv.probeRequest(ctx, "PUT", "/data", nil)
+	ts := httptest.NewServer(asRoot(srv))
+	defer ts.Close()
+
+	if resp, err := http.Get(ts.URL + "/admin/watch"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("watch without a bucket = %v %v, want 400", resp, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/admin/watch?bucket=data&key=config.json", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("opening watch: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("watch = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), ": watching data/config.json") {
+		t.Fatalf("first line = %q", lines.Text())
+	}
+
+	if !srv.watches.watched("data", "config.json") || srv.watches.watched("data", "other") || srv.watches.watched("logs", "config.json") {
+		t.Error("watched does not match only the watched key")
+	}
+	srv.probeRequest(ctx, "PUT", "/data/other", []byte("x"))
+	srv.probeRequest(ctx, "PUT", "/data/config.json", []byte("{}"))
+	srv.probeRequest(ctx, "GET", "/data/config.json", nil)
+
+	var events []watchEvent
+	for len(events) < 2 && lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev watchEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("decoding %s: %v", data, err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	for i, op := range []string{"PutObject", "GetObject"} {
+		ev := events[i]
+		if ev.Operation != op || ev.Bucket != "data" || ev.Key != "config.json" || ev.Status != http.StatusOK {
+			t.Errorf("event %d = %+v, want a successful %s of config.json", i, ev, op)
+		}
+	}
+
+	cancel()
+	resp.Body.Close()
+}
+
+func TestWatchHubDropsForSlowWatchers(t *testing.T) {
+	h := newWatchHub()
+	w := h.add("data", "")
+	rc := &handlers.RequestContext{Bucket: "data", Key: "k", Operation: s3op.GetObject}
+	for range watchBuffer + 3 {
+		h.publish(httptest.NewRequest("GET", "/data/k", nil), rc, &responseRecorder{statusCode: http.StatusOK}, time.Now())
+	}
+	if len(w.events) != watchBuffer || w.dropped.Load() != 3 {
+		t.Errorf("buffered %d, dropped %d; want %d and 3", len(w.events), w.dropped.Load(), watchBuffer)
+	}
+	h.remove(w)
+	if h.watched("data", "k") {
+		t.Error("removed watcher still watches")
+	}
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	s3err "github.com/bleepstore/bleepstore/internal/errors"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/website"
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// allUsersGroup is the grantee URI of an ACL grant to everyone.
+const allUsersGroup = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+// websiteEnabled reports whether cfg serves any website endpoint: the
+// website domain or a custom domain served as a website.
+func websiteEnabled(cfg config.ServerConfig) bool {
+	if cfg.Website.Domain != "" {
+		return true
+	}
+	for _, d := range cfg.CustomDomains {
+		if d.Website {
+			return true
+		}
+	}
+	return false
+}
+
+// websiteMiddleware serves requests for "{bucket}.{domain}", the website
+// endpoint, and for the custom domains served as a website, and passes
+// every other request to next. It runs outside auth: website requests are
+// anonymous.
+func (s *Server) websiteMiddleware(next http.Handler) http.Handler {
+	suffix := ""
+	if d := strings.TrimPrefix(s.cfg.Server.Website.Domain, "."); d != "" {
+		suffix = "." + strings.ToLower(d)
+	}
+	hosts := map[string]string{}
+	for host, d := range s.cfg.Server.CustomDomains {
+		if d.Website {
+			hosts[strings.ToLower(host)] = d.Bucket
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+		bucket, ok := hosts[host]
+		if !ok && suffix != "" {
+			bucket, ok = strings.CutSuffix(host, suffix)
+		}
+		if !ok || bucket == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.serveWebsite(w, r, bucket)
+	})
+}
+
+// serveWebsite answers a website endpoint request for bucket the way an S3
+// website endpoint does, by the bucket's website configuration. Only GET
+// and HEAD are allowed and the query is ignored. A bucket redirecting all
+// requests, or a routing rule without an error condition that matches the
+// key, answers with its redirect. A path ending in "/" serves the index
+// document under it, and a path without one whose index document exists
+// redirects to the path with the slash. Only objects readable by everyone
+// are served. An object written with x-amz-website-redirect-location
+// answers with a 301 to it; any other is served as an anonymous GetObject
+// would, Range and conditional headers included. Errors are answered by
+// websiteError.
+func (s *Server) serveWebsite(w http.ResponseWriter, r *http.Request, bucket string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeWebsiteError(w, r, s3err.ErrMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	b, err := s.meta.GetBucket(ctx, bucket)
+	if err != nil {
+		slog.Error("Website GetBucket error", "bucket", bucket, "error", err)
+		writeWebsiteError(w, r, s3err.ErrInternalError)
+		return
+	}
+	if b == nil {
+		writeWebsiteError(w, r, s3err.ErrNoSuchBucket)
+		return
+	}
+	cfg, err := s.bucketWebsite(ctx, bucket)
+	if err != nil {
+		slog.Error("Website configuration error", "bucket", bucket, "error", err)
+		writeWebsiteError(w, r, s3err.ErrInternalError)
+		return
+	}
+
+	req := website.Request{Scheme: "http", Host: r.Host, Key: strings.TrimPrefix(r.URL.Path, "/")}
+	if r.TLS != nil {
+		req.Scheme = "https"
+	}
+	rd := website.RedirectAll(cfg, req)
+	if rd == nil {
+		rd = website.Route(cfg, req, 0)
+	}
+	if rd != nil {
+		http.Redirect(w, r, rd.Location, rd.Code)
+		return
+	}
+
+	index := cfg.IndexDocument.Suffix
+	key := req.Key
+	dir := key == "" || strings.HasSuffix(key, "/")
+	if dir {
+		key += index
+	}
+	obj, err := s.meta.GetObject(ctx, bucket, key)
+	if err == nil && obj == nil && !dir {
+		// A "directory" with an index document is served with a trailing
+		// slash, so that relative links in the page resolve under it.
+		var idx *metadata.ObjectRecord
+		idx, err = s.meta.GetObject(ctx, bucket, key+"/"+index)
+		if err == nil && idx != nil && publicRead(idx.ACL) {
+			http.Redirect(w, r, (&url.URL{Path: "/" + key + "/"}).EscapedPath(), http.StatusFound)
+			return
+		}
+	}
+	if err != nil {
+		slog.Error("Website GetObject error", "bucket", bucket, "key", key, "error", err)
+		writeWebsiteError(w, r, s3err.ErrInternalError)
+		return
+	}
+	if obj == nil {
+		s.websiteError(w, r, bucket, cfg, req, s3err.ErrNoSuchKey)
+		return
+	}
+	if !publicRead(obj.ACL) {
+		s.websiteError(w, r, bucket, cfg, req, s3err.ErrAccessDenied)
+		return
+	}
+	if loc := obj.WebsiteRedirectLocation; loc != "" {
+		http.Redirect(w, r, loc, http.StatusMovedPermanently)
+		return
+	}
+	s.serveWebsiteObject(w, r, bucket, key)
+}
+
+// bucketWebsite returns the website configuration of bucket: its own, or
+// for a bucket without one, a configuration with the configured index
+// document.
+func (s *Server) bucketWebsite(ctx context.Context, bucket string) (*xmlutil.WebsiteConfiguration, error) {
+	if s.websites != nil {
+		doc, err := s.websites.GetBucketWebsite(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			cfg := &xmlutil.WebsiteConfiguration{}
+			if err := xml.Unmarshal(doc, cfg); err != nil {
+				return nil, fmt.Errorf("decoding website configuration: %w", err)
+			}
+			return cfg, nil
+		}
+	}
+	return &xmlutil.WebsiteConfiguration{
+		IndexDocument: &xmlutil.IndexDocument{Suffix: s.cfg.Server.Website.IndexDocument},
+	}, nil
+}
+
+// websiteError answers a website request for req that failed with err:
+// with the redirect of a routing rule conditioned on the error's status,
+// else, for a client error and an error document readable by everyone,
+// with that document and the error's status, else with the HTML error
+// page.
+func (s *Server) websiteError(w http.ResponseWriter, r *http.Request, bucket string, cfg *xmlutil.WebsiteConfiguration, req website.Request, err *s3err.S3Error) {
+	if rd := website.Route(cfg, req, err.HTTPStatus); rd != nil {
+		http.Redirect(w, r, rd.Location, rd.Code)
+		return
+	}
+	if doc := cfg.ErrorDocument; doc != nil && err.HTTPStatus >= 400 && err.HTTPStatus < 500 {
+		obj, gerr := s.meta.GetObject(r.Context(), bucket, doc.Key)
+		if gerr != nil {
+			slog.Error("Website error document error", "bucket", bucket, "key", doc.Key, "error", gerr)
+		}
+		if obj != nil && publicRead(obj.ACL) {
+			r = r.Clone(r.Context())
+			for _, name := range []string{"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+				r.Header.Del(name)
+			}
+			s.serveWebsiteObject(&errorDocumentWriter{ResponseWriter: w, status: err.HTTPStatus}, r, bucket, doc.Key)
+			return
+		}
+	}
+	writeWebsiteError(w, r, err)
+}
+
+// serveWebsiteObject serves bucket/key through the S3 GetObject handler,
+// stripped of anything that would make it more than an anonymous read.
+func (s *Server) serveWebsiteObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	req := r.Clone(r.Context())
+	setRequestPath(req, "/"+bucket+"/"+key)
+	req.URL.RawQuery = ""
+	req.RequestURI = req.URL.RequestURI()
+	for name := range req.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-") {
+			req.Header.Del(name)
+		}
+	}
+	req.Header.Del("Authorization")
+	s.dispatch(w, req)
+}
+
+// errorDocumentWriter serves an error document: it replaces the 200
+// status of the response with that of the error.
+type errorDocumentWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *errorDocumentWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK {
+		code = w.status
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorDocumentWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// publicRead reports whether acl grants everyone read access.
+func publicRead(acl json.RawMessage) bool {
+	var acp xmlutil.AccessControlPolicy
+	if len(acl) == 0 || json.Unmarshal(acl, &acp) != nil {
+		return false
+	}
+	for _, g := range acp.AccessControlList.Grants {
+		if g.Grantee.URI == allUsersGroup && (g.Permission == "READ" || g.Permission == "FULL_CONTROL") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeWebsiteError writes err as the HTML error page of a website
+// endpoint.
+func writeWebsiteError(w http.ResponseWriter, r *http.Request, err *s3err.S3Error) {
+	status := fmt.Sprintf("%d %s", err.HTTPStatus, http.StatusText(err.HTTPStatus))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(err.HTTPStatus)
+	if r.Method == http.MethodHead {
+		return
+	}
+	fmt.Fprintf(w, "<html>\n<head><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<ul>\n<li>Code: %s</li>\n<li>Message: %s</li>\n",
+		status, status, html.EscapeString(err.Code), html.EscapeString(err.Message))
+	if id := w.Header().Get("x-amz-request-id"); id != "" {
+		fmt.Fprintf(w, "<li>RequestId: %s</li>\n", html.EscapeString(id))
+	}
+	fmt.Fprint(w, "</ul>\n<hr/>\n</body>\n</html>\n")
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/config"
+	"github.com/bleepstore/bleepstore/internal/metadata"
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// newWebsiteServer returns a server with the website endpoint at
+// "web.local".
+func newWebsiteServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	meta, err := metadata.NewSQLiteStore(filepath.Join(dir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("creating metadata store: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	store, err := storage.NewLocalBackend(filepath.Join(dir, "objects"))
+	if err != nil {
+		t.Fatalf("creating storage backend: %v", err)
+	}
+	cfg := &config.Config{
+		Server: config.ServerConfig{Region: "us-east-1",
+			Website: config.WebsiteConfig{Domain: "web.local", IndexDocument: "index.html"}},
+		Auth: config.AuthConfig{AccessKey: "bleepstore", SecretKey: "bleepstore-secret"},
+	}
+	cfg.Metadata.Engine = "sqlite"
+	srv, err := New(cfg, meta, WithStorageBackend(store))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return srv
+}
+
+func TestWebsiteEndpoint(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.cfg.Server.Website = config.WebsiteConfig{Domain: "web.local", IndexDocument: "index.html"}
+	handler := srv.websiteMiddleware(srv.router)
+	put := func(key, body, acl, redirect string) {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/site/"+key, strings.NewReader(body))
+		if acl != "" {
+			req.Header.Set("x-amz-acl", acl)
+		}
+		if redirect != "" {
+			req.Header.Set("x-amz-website-redirect-location", redirect)
+		}
+		rec := httptest.NewRecorder()
+		srv.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s = %d %s", key, rec.Code, rec.Body.String())
+		}
+	}
+	get := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Host = "site.web.local:9000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	srv.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/site", nil))
+	put("index.html", "home", "public-read", "")
+	put("docs/index.html", "docs", "public-read", "")
+	put("old.html", "", "public-read", "/docs/")
+	put("away.html", "", "public-read", "https://example.com/")
+	put("private.html", "secret", "", "")
+
+	for _, tc := range []struct {
+		path, body string
+	}{
+		{"/", "home"},
+		{"/index.html", "home"},
+		{"/docs/", "docs"},
+		{"/docs/index.html?response-content-type=x", "docs"},
+	} {
+		if rec := get("GET", tc.path); rec.Code != http.StatusOK || rec.Body.String() != tc.body {
+			t.Errorf("GET %s = %d %q, want %q", tc.path, rec.Code, rec.Body.String(), tc.body)
+		}
+	}
+	if rec := get("HEAD", "/"); rec.Code != http.StatusOK || rec.Header().Get("Content-Length") != "4" {
+		t.Errorf("HEAD / = %d, Content-Length %q", rec.Code, rec.Header().Get("Content-Length"))
+	}
+
+	for _, tc := range []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/old.html", http.StatusMovedPermanently, "/docs/"},
+		{"/away.html", http.StatusMovedPermanently, "https://example.com/"},
+		{"/docs", http.StatusFound, "/docs/"},
+	} {
+		rec := get("GET", tc.path)
+		if rec.Code != tc.code || rec.Header().Get("Location") != tc.location {
+			t.Errorf("GET %s = %d to %q, want %d to %q", tc.path, rec.Code, rec.Header().Get("Location"), tc.code, tc.location)
+		}
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/private.html", http.StatusForbidden},
+		{"GET", "/missing.html", http.StatusNotFound},
+		{"PUT", "/index.html", http.StatusMethodNotAllowed},
+		{"DELETE", "/index.html", http.StatusMethodNotAllowed},
+	} {
+		rec := get(tc.method, tc.path)
+		if rec.Code != tc.code || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("%s %s = %d %s, want an HTML %d", tc.method, tc.path, rec.Code, rec.Header().Get("Content-Type"), tc.code)
+		}
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "nosuch.web.local"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "NoSuchBucket") {
+		t.Errorf("GET on a missing bucket = %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Other hosts are S3 requests as before.
+	req = httptest.NewRequest("GET", "/site/private.html", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "secret" {
+		t.Errorf("S3 GET = %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCustomDomains(t *testing.T) {
+	srv := newTestServerWithBackends(t)
+	srv.cfg.Server.Website.IndexDocument = "index.html"
+	srv.cfg.Server.CustomDomains = map[string]config.CustomDomainConfig{
+		"assets.example.com": {Bucket: "site"},
+		"www.example.com":    {Bucket: "site", Website: true},
+	}
+	resolver, err := newBucketResolver(srv.cfg.Server)
+	if err != nil {
+		t.Fatalf("newBucketResolver: %v", err)
+	}
+	handler := srv.websiteMiddleware(bucketResolverMiddleware(resolver)(srv.router))
+	do := func(method, host, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader("page"))
+		req.Host = host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	srv.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/site", nil))
+	if rec := do("PUT", "Assets.Example.com:9000", "/page.html"); rec.Code != http.StatusOK {
+		t.Fatalf("PUT on the custom domain = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("GET", "assets.example.com", "/page.html"); rec.Code != http.StatusOK || rec.Body.String() != "page" {
+		t.Errorf("GET on the custom domain = %d %q", rec.Code, rec.Body.String())
+	}
+	// The website domain answers as the website endpoint: anonymously, and
+	// only with objects readable by everyone.
+	if rec := do("GET", "www.example.com", "/page.html"); rec.Code != http.StatusForbidden {
+		t.Errorf("website GET of a private object = %d, want 403", rec.Code)
+	}
+	req := httptest.NewRequest("PUT", "/site/index.html", strings.NewReader("home"))
+	req.Header.Set("x-amz-acl", "public-read")
+	srv.router.ServeHTTP(httptest.NewRecorder(), req)
+	if rec := do("GET", "www.example.com", "/"); rec.Code != http.StatusOK || rec.Body.String() != "home" {
+		t.Errorf("website GET / = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := do("PUT", "www.example.com", "/index.html"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("website PUT = %d, want 405", rec.Code)
+	}
+
+	if _, err := newBucketResolver(config.ServerConfig{
+		CustomDomains: map[string]config.CustomDomainConfig{"cdn.example.com": {}},
+	}); err == nil {
+		t.Error("expected an error for a custom domain without a bucket")
+	}
+}
+
+func TestBucketWebsiteConfiguration(t *testing.T) {
+	srv := newWebsiteServer(t)
+	ctx := context.Background()
+	handler := srv.websiteMiddleware(srv.router)
+	get := func(bucket, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = bucket + ".web.local"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	public := http.Header{"X-Amz-Acl": {"public-read"}}
+
+	srv.probeRequest(ctx, "PUT", "/site", nil)
+	if res := srv.probeRequest(ctx, "GET", "/site?website", nil); res.code != http.StatusNotFound ||
+		!strings.Contains(res.body.String(), "NoSuchWebsiteConfiguration") {
+		t.Fatalf("GetBucketWebsite before put = %d %s", res.code, res.body.String())
+	}
+	if res := srv.probeRequest(ctx, "PUT", "/site?website", []byte(`<WebsiteConfiguration/>`)); res.code != http.StatusBadRequest {
+		t.Errorf("PutBucketWebsite without an index document = %d, want 400", res.code)
+	}
+	cfg := `<WebsiteConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+		<IndexDocument><Suffix>home.html</Suffix></IndexDocument>
+		<ErrorDocument><Key>error.html</Key></ErrorDocument>
+		<RoutingRules>
+			<RoutingRule><Condition><KeyPrefixEquals>docs/</KeyPrefixEquals></Condition>
+				<Redirect><ReplaceKeyPrefixWith>documents/</ReplaceKeyPrefixWith><HttpRedirectCode>302</HttpRedirectCode></Redirect></RoutingRule>
+			<RoutingRule><Condition><KeyPrefixEquals>shop/</KeyPrefixEquals><HttpErrorCodeReturnedEquals>404</HttpErrorCodeReturnedEquals></Condition>
+				<Redirect><HostName>shop.example.com</HostName><Protocol>https</Protocol></Redirect></RoutingRule>
+		</RoutingRules>
+	</WebsiteConfiguration>`
+	if res := srv.probeRequest(ctx, "PUT", "/site?website", []byte(cfg)); res.code != http.StatusOK {
+		t.Fatalf("PutBucketWebsite = %d %s", res.code, res.body.String())
+	}
+	if res := srv.probeRequest(ctx, "GET", "/site?website", nil); res.code != http.StatusOK ||
+		!strings.Contains(res.body.String(), "<Suffix>home.html</Suffix>") || !strings.Contains(res.body.String(), "shop.example.com") {
+		t.Errorf("GetBucketWebsite = %d %s", res.code, res.body.String())
+	}
+
+	srv.provisionRequest(ctx, "PUT", "/site/home.html", public, []byte("home"))
+	srv.provisionRequest(ctx, "PUT", "/site/error.html", public, []byte("oops"))
+	srv.provisionRequest(ctx, "PUT", "/site/private.html", nil, []byte("secret"))
+
+	for _, tc := range []struct {
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{"/", http.StatusOK, "home", ""},
+		{"/missing.html", http.StatusNotFound, "oops", ""},
+		{"/private.html", http.StatusForbidden, "oops", ""},
+		{"/docs/a.html", http.StatusFound, "", "http://site.web.local/documents/a.html"},
+		{"/shop/cart", http.StatusMovedPermanently, "", "https://shop.example.com/shop/cart"},
+	} {
+		rec := get("site", tc.path)
+		if rec.Code != tc.code || (tc.body != "" && rec.Body.String() != tc.body) || rec.Header().Get("Location") != tc.location {
+			t.Errorf("GET %s = %d %q to %q, want %d %q to %q", tc.path, rec.Code, rec.Body.String(),
+				rec.Header().Get("Location"), tc.code, tc.body, tc.location)
+		}
+	}
+
+	// A bucket redirecting every request.
+	srv.probeRequest(ctx, "PUT", "/moved", nil)
+	srv.probeRequest(ctx, "PUT", "/moved?website", []byte(`<WebsiteConfiguration><RedirectAllRequestsTo>
+		<HostName>new.example.com</HostName></RedirectAllRequestsTo></WebsiteConfiguration>`))
+	if rec := get("moved", "/a/b.html"); rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "http://new.example.com/a/b.html" {
+		t.Errorf("GET on a redirecting bucket = %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// Without a configuration, the bucket is served with the server's index
+	// document again.
+	if res := srv.probeRequest(ctx, "DELETE", "/site?website", nil); res.code != http.StatusNoContent {
+		t.Errorf("DeleteBucketWebsite = %d %s", res.code, res.body.String())
+	}
+	if rec := get("site", "/missing.html"); rec.Code != http.StatusNotFound || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("GET after DeleteBucketWebsite = %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdaptiveOptions configures an AdaptiveBackend. Zero fields take the
+// defaults noted.
+type AdaptiveOptions struct {
+	// InitialLimit is the number of concurrent operations allowed at
+	// startup (default: 16).
+	InitialLimit int
+	// MinLimit and MaxLimit bound the limit (defaults: 1 and 256).
+	MinLimit int
+	MaxLimit int
+	// TargetLatency is the latency above which an operation counts as a
+	// sign of overload (default: 500ms).
+	TargetLatency time.Duration
+	// OnChange, if not nil, is called with the limit and the number of
+	// operations in flight whenever either changes.
+	OnChange func(limit float64, inflight int)
+}
+
+// AdaptiveBackend limits the number of concurrent operations on the inner
+// backend, adjusting the limit to what the backend sustains instead of
+// using a fixed pool size. Operations beyond the limit wait for a slot, or
+// until their context ends.
+//
+// The limit follows AIMD: every operation that completes in time while the
+// limit is in use raises it by 1/limit, so by about one per round of
+// operations, and an error or an operation slower than the target latency
+// halves it. Only operations started after the last decrease can decrease
+// it again, so one overload episode halves the limit once rather than once
+// per operation caught in it. Not-found and context errors say nothing
+// about load and are ignored. PutObject and PutPart take as long as the
+// client takes to send the body, so only their errors count, not their
+// latency; GetObject counts the time to open the object, not to read it.
+type AdaptiveBackend struct {
+	inner   StorageBackend
+	limiter *aimdLimiter
+}
+
+// adaptiveDefragmenter is an AdaptiveBackend over a Defragmenter.
+type adaptiveDefragmenter struct {
+	*AdaptiveBackend
+}
+
+func (a adaptiveDefragmenter) DefragmentObject(ctx context.Context, bucket, key string) (bool, error) {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	ok, err := a.inner.(Defragmenter).DefragmentObject(ctx, bucket, key)
+	a.limiter.release(start, err, false)
+	return ok, err
+}
+
+// NewAdaptiveBackend wraps inner with an adaptive concurrency limit. The
+// result is a Defragmenter if inner is.
+func NewAdaptiveBackend(inner StorageBackend, opts AdaptiveOptions) (StorageBackend, error) {
+	if opts.MinLimit == 0 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit == 0 {
+		opts.MaxLimit = 256
+	}
+	if opts.InitialLimit == 0 {
+		opts.InitialLimit = min(16, opts.MaxLimit)
+	}
+	if opts.TargetLatency == 0 {
+		opts.TargetLatency = 500 * time.Millisecond
+	}
+	if opts.MinLimit < 1 || opts.MaxLimit < opts.MinLimit {
+		return nil, fmt.Errorf("concurrency limits must satisfy 1 <= min (%d) <= max (%d)", opts.MinLimit, opts.MaxLimit)
+	}
+	if opts.InitialLimit < opts.MinLimit || opts.InitialLimit > opts.MaxLimit {
+		return nil, fmt.Errorf("initial concurrency limit %d is not between %d and %d", opts.InitialLimit, opts.MinLimit, opts.MaxLimit)
+	}
+	if opts.TargetLatency < 0 {
+		return nil, fmt.Errorf("target latency %v is negative", opts.TargetLatency)
+	}
+	a := &AdaptiveBackend{inner: inner, limiter: newAIMDLimiter(opts)}
+	if _, ok := inner.(Defragmenter); ok {
+		return adaptiveDefragmenter{a}, nil
+	}
+	return a, nil
+}
+
+// Limit returns the current concurrency limit and the number of operations
+// in flight.
+func (a *AdaptiveBackend) Limit() (float64, int) {
+	a.limiter.mu.Lock()
+	defer a.limiter.mu.Unlock()
+	return a.limiter.limit, a.limiter.inflight
+}
+
+// aimdLimiter hands out slots up to an additively increased,
+// multiplicatively decreased limit.
+type aimdLimiter struct {
+	min, max float64
+	target   time.Duration
+	onChange func(limit float64, inflight int)
+	now      func() time.Time
+
+	mu           sync.Mutex
+	limit        float64
+	inflight     int
+	waiters      []chan struct{} // FIFO; closed when granted a slot
+	lastDecrease time.Time
+}
+
+func newAIMDLimiter(opts AdaptiveOptions) *aimdLimiter {
+	return &aimdLimiter{
+		min:      float64(opts.MinLimit),
+		max:      float64(opts.MaxLimit),
+		target:   opts.TargetLatency,
+		onChange: opts.OnChange,
+		now:      time.Now,
+		limit:    float64(opts.InitialLimit),
+	}
+}
+
+// acquire waits for a slot and returns the time the operation started.
+func (l *aimdLimiter) acquire(ctx context.Context) (time.Time, error) {
+	l.mu.Lock()
+	if l.inflight < int(l.limit) && len(l.waiters) == 0 {
+		l.inflight++
+		l.changed()
+		l.mu.Unlock()
+		return l.now(), nil
+	}
+	ch := make(chan struct{})
+	l.waiters = append(l.waiters, ch)
+	l.mu.Unlock()
+
+	select {
+	case <-ch:
+		return l.now(), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if i := slices.Index(l.waiters, ch); i >= 0 {
+			l.waiters = slices.Delete(l.waiters, i, i+1)
+			return time.Time{}, ctx.Err()
+		}
+		// Granted a slot as the context ended: pass it on.
+		l.inflight--
+		l.grant()
+		return time.Time{}, ctx.Err()
+	}
+}
+
+// release frees the slot of an operation started at start, adjusting the
+// limit by its outcome. The operation's latency counts only if timed.
+func (l *aimdLimiter) release(start time.Time, err error, timed bool) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	atLimit := l.inflight >= int(l.limit) || len(l.waiters) > 0
+	l.inflight--
+	switch {
+	case overloaded(err) || (timed && now.Sub(start) > l.target):
+		if start.After(l.lastDecrease) {
+			l.limit = math.Max(l.min, l.limit/2)
+			l.lastDecrease = now
+		}
+	case err == nil && atLimit:
+		l.limit = math.Min(l.max, l.limit+1/l.limit)
+	}
+	l.grant()
+}
+
+// grant hands free slots to waiters. Called with mu held.
+func (l *aimdLimiter) grant() {
+	for len(l.waiters) > 0 && l.inflight < int(l.limit) {
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+		l.inflight++
+	}
+	l.changed()
+}
+
+// changed reports the limit and the operations in flight. Called with mu
+// held.
+func (l *aimdLimiter) changed() {
+	if l.onChange != nil {
+		l.onChange(l.limit, l.inflight)
+	}
+}
+
+// overloaded reports whether err may be a sign that the backend is
+// overloaded: any error but a missing object or an ended context.
+func overloaded(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) &&
+		!strings.Contains(err.Error(), "not found")
+}
+
+// PutObject writes through to the inner backend.
+func (a *AdaptiveBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	n, etag, err := a.inner.PutObject(ctx, bucket, key, reader, size)
+	a.limiter.release(start, err, false)
+	return n, etag, err
+}
+
+// GetObject opens the object in the inner backend. The slot is released
+// once the object is open, not when the reader is closed.
+func (a *AdaptiveBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	rc, size, etag, err := a.inner.GetObject(ctx, bucket, key)
+	a.limiter.release(start, err, true)
+	return rc, size, etag, err
+}
+
+// DeleteObject deletes from the inner backend.
+func (a *AdaptiveBackend) DeleteObject(ctx context.Context, bucket, key string) error {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = a.inner.DeleteObject(ctx, bucket, key)
+	a.limiter.release(start, err, true)
+	return err
+}
+
+// CopyObject copies within the inner backend.
+func (a *AdaptiveBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (string, error) {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	etag, err := a.inner.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey)
+	a.limiter.release(start, err, true)
+	return etag, err
+}
+
+// PutPart writes a part to the inner backend.
+func (a *AdaptiveBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	etag, err := a.inner.PutPart(ctx, bucket, key, uploadID, partNumber, reader, size)
+	a.limiter.release(start, err, false)
+	return etag, err
+}
+
+// AssembleParts assembles parts in the inner backend.
+func (a *AdaptiveBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	etag, err := a.inner.AssembleParts(ctx, bucket, key, uploadID, partNumbers)
+	a.limiter.release(start, err, true)
+	return etag, err
+}
+
+// DeleteParts deletes parts from the inner backend.
+func (a *AdaptiveBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = a.inner.DeleteParts(ctx, bucket, key, uploadID)
+	a.limiter.release(start, err, true)
+	return err
+}
+
+// CreateBucket creates the bucket in the inner backend.
+func (a *AdaptiveBackend) CreateBucket(ctx context.Context, bucket string) error {
+	return a.inner.CreateBucket(ctx, bucket)
+}
+
+// DeleteBucket deletes the bucket from the inner backend.
+func (a *AdaptiveBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	return a.inner.DeleteBucket(ctx, bucket)
+}
+
+// ObjectExists checks the inner backend.
+func (a *AdaptiveBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	start, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	ok, err := a.inner.ObjectExists(ctx, bucket, key)
+	a.limiter.release(start, err, true)
+	return ok, err
+}
+
+// HealthCheck checks the inner backend. It bypasses the limit, so that a
+// backend busy up to its limit still reports healthy.
+func (a *AdaptiveBackend) HealthCheck(ctx context.Context) error {
+	return a.inner.HealthCheck(ctx)
+}
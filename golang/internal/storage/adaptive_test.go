@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAIMDLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	var reported float64
+	l := newAIMDLimiter(AdaptiveOptions{
+		InitialLimit: 2, MinLimit: 1, MaxLimit: 3, TargetLatency: time.Second,
+		OnChange: func(limit float64, inflight int) { reported = limit },
+	})
+	l.now = func() time.Time { return now }
+
+	// Operations beyond the limit wait for a slot.
+	a, _ := l.acquire(ctx)
+	b, _ := l.acquire(ctx)
+	granted := make(chan time.Time)
+	go func() {
+		start, _ := l.acquire(ctx)
+		granted <- start
+	}()
+	select {
+	case <-granted:
+		t.Fatal("operation beyond the limit started")
+	case <-time.After(20 * time.Millisecond):
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire with an ending context = %v", err)
+	}
+
+	// Completing in time at the limit raises it additively.
+	l.release(a, nil, true)
+	c := <-granted
+	if l.limit != 2.5 || reported != 2.5 {
+		t.Fatalf("limit after a fast operation at the limit = %v (reported %v), want 2.5", l.limit, reported)
+	}
+
+	// A slow operation halves it, but the others started before the
+	// decrease do not decrease it again.
+	now = now.Add(2 * time.Second)
+	l.release(b, nil, true)
+	if l.limit != 1.25 {
+		t.Fatalf("limit after a slow operation = %v, want 1.25", l.limit)
+	}
+	l.release(c, errors.New("503 SlowDown"), false)
+	if l.limit != 1.25 {
+		t.Fatalf("limit after a second decrease in one episode = %v, want 1.25", l.limit)
+	}
+
+	// Errors of operations started later halve it again, down to the
+	// minimum; missing objects and canceled contexts do not.
+	d, _ := l.acquire(ctx)
+	l.release(d, fmt.Errorf("object not found: b/k"), true)
+	e, _ := l.acquire(ctx)
+	l.release(e, context.Canceled, true)
+	if l.limit != 1.25 {
+		t.Fatalf("limit after neutral errors = %v, want 1.25", l.limit)
+	}
+	now = now.Add(time.Millisecond)
+	f, _ := l.acquire(ctx)
+	l.release(f, errors.New("database is locked"), true)
+	if l.limit != 1 {
+		t.Fatalf("limit after an error = %v, want the minimum 1", l.limit)
+	}
+
+	// It does not rise while operations stay below the limit, nor above
+	// the maximum.
+	for range 50 {
+		g, _ := l.acquire(ctx)
+		l.release(g, nil, true)
+	}
+	if l.limit != 2 {
+		t.Errorf("limit after operations one at a time = %v, want 2", l.limit)
+	}
+	held, _ := l.acquire(ctx)
+	for range 50 {
+		g, _ := l.acquire(ctx)
+		l.release(g, nil, true)
+	}
+	l.release(held, nil, true)
+	if l.limit != 3 {
+		t.Errorf("limit after many fast operations at the limit = %v, want the maximum 3", l.limit)
+	}
+	if l.inflight != 0 || len(l.waiters) != 0 {
+		t.Errorf("inflight %d, waiters %d after all operations", l.inflight, len(l.waiters))
+	}
+}
+
+func TestNewAdaptiveBackend(t *testing.T) {
+	mem, err := NewMemoryBackend(0, "none", "", 0, "")
+	if err != nil {
+		t.Fatalf("NewMemoryBackend failed: %v", err)
+	}
+	defer mem.Close()
+	for _, opts := range []AdaptiveOptions{
+		{MinLimit: 4, MaxLimit: 2},
+		{InitialLimit: 300},
+		{TargetLatency: -time.Second},
+	} {
+		if _, err := NewAdaptiveBackend(mem, opts); err == nil {
+			t.Errorf("NewAdaptiveBackend(%+v) succeeded", opts)
+		}
+	}
+	b, err := NewAdaptiveBackend(mem, AdaptiveOptions{})
+	if err != nil {
+		t.Fatalf("NewAdaptiveBackend with defaults: %v", err)
+	}
+	if limit, inflight := b.(*AdaptiveBackend).Limit(); limit != 16 || inflight != 0 {
+		t.Errorf("Limit() = %v, %d, want 16, 0", limit, inflight)
+	}
+}
@@ -64,6 +64,8 @@ type AWSGatewayBackend struct {
 	Prefix string
 	// client is the AWS S3 client (satisfying S3API interface).
 	client S3API
+	// uploadPartSize overrides awsUploadPartSize when positive.
+	uploadPartSize int64
 }
 
 // NewAWSGatewayBackend creates a new AWSGatewayBackend configured to proxy
@@ -71,6 +73,34 @@ type AWSGatewayBackend struct {
 // client using the default credential chain, with optional overrides for
 // custom endpoint, path-style addressing, and static credentials.
 func NewAWSGatewayBackend(ctx context.Context, bucket, region, prefix, endpointURL string, usePathStyle bool, accessKeyID, secretAccessKey string) (*AWSGatewayBackend, error) {
+	client, err := newS3Client(ctx, region, endpointURL, usePathStyle, accessKeyID, secretAccessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &AWSGatewayBackend{
+		Bucket: bucket,
+		Region: region,
+		Prefix: prefix,
+		client: client,
+	}
+
+	// Verify the upstream bucket is accessible.
+	_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot access upstream S3 bucket %q: %w", bucket, err)
+	}
+
+	slog.Info("AWS gateway backend initialized", "bucket", bucket, "region", region, "prefix", prefix)
+	return b, nil
+}
+
+// newS3Client builds an S3 client using the default credential chain, with
+// optional overrides for custom endpoint, path-style addressing, and static
+// credentials.
+func newS3Client(ctx context.Context, region, endpointURL string, usePathStyle bool, accessKeyID, secretAccessKey string) (*s3.Client, error) {
 	var loadOpts []func(*awsconfig.LoadOptions) error
 	loadOpts = append(loadOpts, awsconfig.WithRegion(region))
 
@@ -98,26 +128,7 @@ func NewAWSGatewayBackend(ctx context.Context, bucket, region, prefix, endpointU
 			o.UsePathStyle = true
 		})
 	}
-
-	client := s3.NewFromConfig(cfg, s3Opts...)
-
-	b := &AWSGatewayBackend{
-		Bucket: bucket,
-		Region: region,
-		Prefix: prefix,
-		client: client,
-	}
-
-	// Verify the upstream bucket is accessible.
-	_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(bucket),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("cannot access upstream S3 bucket %q: %w", bucket, err)
-	}
-
-	slog.Info("AWS gateway backend initialized", "bucket", bucket, "region", region, "prefix", prefix)
-	return b, nil
+	return s3.NewFromConfig(cfg, s3Opts...), nil
 }
 
 // NewAWSGatewayBackendWithClient creates an AWSGatewayBackend with a
@@ -142,33 +153,118 @@ func (b *AWSGatewayBackend) partKey(uploadID string, partNumber int) string {
 	return fmt.Sprintf("%s.parts/%s/%d", b.Prefix, uploadID, partNumber)
 }
 
-// PutObject uploads object data to the upstream S3 bucket. It reads all data,
-// computes MD5 locally for a consistent ETag, then uploads to S3.
+// awsUploadPartSize is the most of a body PutObject holds in memory. A
+// body that fits is sent with one PutObject; a larger one streams through
+// a native multipart upload of parts this size.
+const awsUploadPartSize = 8 << 20
+
+// PutObject streams object data to the upstream S3 bucket, computing MD5
+// locally for a consistent ETag. Memory use is bounded by the upload part
+// size whatever the object size.
 func (b *AWSGatewayBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
 	s3key := b.s3Key(bucket, key)
 
-	// Read all data to compute MD5 locally. AWS may return different ETags
-	// when server-side encryption is enabled, so we compute our own.
-	data, err := io.ReadAll(reader)
-	if err != nil {
+	// AWS may return different ETags when server-side encryption is
+	// enabled, so we compute our own as the data streams through.
+	h := md5.New()
+	body := io.TeeReader(reader, h)
+
+	var first bytes.Buffer
+	n, err := io.CopyN(&first, body, b.partSize())
+	if err != nil && err != io.EOF {
 		return 0, "", fmt.Errorf("reading object data: %w", err)
 	}
+	if err == io.EOF {
+		_, err = b.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(b.Bucket),
+			Key:           aws.String(s3key),
+			Body:          bytes.NewReader(first.Bytes()),
+			ContentLength: aws.Int64(n),
+		})
+		if err != nil {
+			return 0, "", fmt.Errorf("uploading to S3: %w", err)
+		}
+		return n, fmt.Sprintf(`"%x"`, h.Sum(nil)), nil
+	}
 
-	h := md5.New()
-	h.Write(data)
-	etag := fmt.Sprintf(`"%x"`, h.Sum(nil))
+	written, err := b.putMultipart(ctx, s3key, first.Bytes(), body)
+	if err != nil {
+		return 0, "", err
+	}
+	return written, fmt.Sprintf(`"%x"`, h.Sum(nil)), nil
+}
 
-	_, err = b.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:        aws.String(b.Bucket),
-		Key:           aws.String(s3key),
-		Body:          bytes.NewReader(data),
-		ContentLength: aws.Int64(int64(len(data))),
+// partSize returns the upload part size, which tests may lower.
+func (b *AWSGatewayBackend) partSize() int64 {
+	if b.uploadPartSize > 0 {
+		return b.uploadPartSize
+	}
+	return awsUploadPartSize
+}
+
+// putMultipart uploads buf, a full first part, and the rest of body as a
+// native multipart upload to s3key, reusing buf for every part. The upload
+// is aborted if any part fails.
+func (b *AWSGatewayBackend) putMultipart(ctx context.Context, s3key string, buf []byte, body io.Reader) (int64, error) {
+	createResp, err := b.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(s3key),
 	})
 	if err != nil {
-		return 0, "", fmt.Errorf("uploading to S3: %w", err)
+		return 0, fmt.Errorf("creating AWS multipart upload: %w", err)
+	}
+	awsUploadID := aws.ToString(createResp.UploadId)
+	abort := func() {
+		_, abortErr := b.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(b.Bucket),
+			Key:      aws.String(s3key),
+			UploadId: aws.String(awsUploadID),
+		})
+		if abortErr != nil {
+			slog.Warn("Failed to abort AWS multipart upload", "upload_id", awsUploadID, "error", abortErr)
+		}
 	}
 
-	return int64(len(data)), etag, nil
+	var (
+		written int64
+		parts   []types.CompletedPart
+	)
+	for part := buf; len(part) > 0; {
+		partNumber := aws.Int32(int32(len(parts) + 1))
+		resp, err := b.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(b.Bucket),
+			Key:           aws.String(s3key),
+			UploadId:      aws.String(awsUploadID),
+			PartNumber:    partNumber,
+			Body:          bytes.NewReader(part),
+			ContentLength: aws.Int64(int64(len(part))),
+		})
+		if err != nil {
+			abort()
+			return 0, fmt.Errorf("uploading part %d to S3: %w", *partNumber, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: resp.ETag, PartNumber: partNumber})
+		written += int64(len(part))
+
+		n, err := io.ReadFull(body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			abort()
+			return 0, fmt.Errorf("reading object data: %w", err)
+		}
+		part = buf[:n]
+	}
+
+	_, err = b.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.Bucket),
+		Key:             aws.String(s3key),
+		UploadId:        aws.String(awsUploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		abort()
+		return 0, fmt.Errorf("completing AWS multipart upload: %w", err)
+	}
+	return written, nil
 }
 
 // GetObject retrieves object data from the upstream S3 bucket.
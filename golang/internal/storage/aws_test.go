@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -359,6 +361,42 @@ func TestAWSPutObjectEmptyBody(t *testing.T) {
 	}
 }
 
+func TestAWSPutObjectStreamsInParts(t *testing.T) {
+	backend, mock := newTestAWSBackend(t)
+	backend.uploadPartSize = 4
+	ctx := context.Background()
+
+	content := "0123456789"
+	bytesWritten, etag, err := backend.PutObject(ctx, "my-bucket", "big.bin", strings.NewReader(content), -1)
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if bytesWritten != int64(len(content)) {
+		t.Errorf("bytesWritten = %d, want %d", bytesWritten, len(content))
+	}
+	if want := fmt.Sprintf(`"%x"`, md5.Sum([]byte(content))); etag != want {
+		t.Errorf("ETag = %s, want the plain MD5 %s", etag, want)
+	}
+	if mock.putObjectCalls != 0 {
+		t.Errorf("PutObject calls = %d, want a multipart upload", mock.putObjectCalls)
+	}
+	if got := string(mock.objects["bp/my-bucket/big.bin"]); got != content {
+		t.Errorf("upstream object = %q, want %q", got, content)
+	}
+
+	// A body that fails partway aborts the upload and keeps the object.
+	broken := io.MultiReader(strings.NewReader("abcdefgh"), iotest.ErrReader(errors.New("connection reset")))
+	if _, _, err := backend.PutObject(ctx, "my-bucket", "big.bin", broken, -1); err == nil {
+		t.Fatal("PutObject of a failing body succeeded")
+	}
+	if len(mock.multipartUploads) != 0 {
+		t.Errorf("%d multipart uploads left open", len(mock.multipartUploads))
+	}
+	if got := string(mock.objects["bp/my-bucket/big.bin"]); got != content {
+		t.Errorf("upstream object after failed PutObject = %q, want %q", got, content)
+	}
+}
+
 func TestAWSGetObjectNotFound(t *testing.T) {
 	backend, _ := newTestAWSBackend(t)
 	ctx := context.Background()
@@ -833,3 +871,32 @@ func keysOf(m map[string][]byte) []string {
 	}
 	return keys
 }
+
+func TestS3SourceLayouts(t *testing.T) {
+	mock := newMockS3Client()
+	mock.objects["bleep/photos/cat.jpg"] = []byte("gateway copy")
+	mock.objects["cat.jpg"] = []byte("replica copy")
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		src  *S3Source
+		want string
+	}{
+		{NewS3SourceWithClient("upstream", "bleep/", mock), "gateway copy"},
+		{NewS3SourceWithClient("", "", mock), "replica copy"},
+	} {
+		rc, err := tc.src.OpenObject(ctx, "photos", "cat.jpg")
+		if err != nil {
+			t.Fatalf("OpenObject (bucket %q): %v", tc.src.Bucket, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(got) != tc.want {
+			t.Errorf("OpenObject (bucket %q) = %q, want %q", tc.src.Bucket, got, tc.want)
+		}
+	}
+
+	if _, err := NewS3SourceWithClient("", "", mock).OpenObject(ctx, "photos", "missing"); err == nil {
+		t.Error("OpenObject of a missing object succeeded")
+	}
+}
@@ -34,6 +34,9 @@ import (
 type AzureBlobAPI interface {
 	// UploadBlob uploads data to a blob, overwriting if it already exists.
 	UploadBlob(ctx context.Context, containerName, blobName string, data []byte) error
+	// UploadBlobStream uploads a blob from r in blocks, holding only a few
+	// blocks in memory. The blob is left unchanged if reading r fails.
+	UploadBlobStream(ctx context.Context, containerName, blobName string, r io.Reader) error
 	// DownloadBlob downloads a blob's contents.
 	DownloadBlob(ctx context.Context, containerName, blobName string) ([]byte, error)
 	// DeleteBlob deletes a blob. Returns an error if the blob does not exist.
@@ -121,27 +124,32 @@ func blockID(uploadID string, partNumber int) string {
 	)
 }
 
-// PutObject uploads object data to the upstream Azure Blob container. It reads
-// all data, computes MD5 locally for a consistent ETag, then uploads to Azure.
+// PutObject streams object data to the upstream Azure Blob container,
+// computing MD5 locally for a consistent ETag.
 func (b *AzureGatewayBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
 	blobKey := b.blobName(bucket, key)
 
-	// Read all data to compute MD5 locally. Azure may return different ETags,
-	// so we compute our own for consistency.
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return 0, "", fmt.Errorf("reading object data: %w", err)
-	}
-
+	// Azure may return different ETags, so we compute our own as the data
+	// streams through.
 	h := md5.New()
-	h.Write(data)
-	etag := fmt.Sprintf(`"%x"`, h.Sum(nil))
-
-	if err := b.client.UploadBlob(ctx, b.Container, blobKey, data); err != nil {
+	counter := &countingReader{r: io.TeeReader(reader, h)}
+	if err := b.client.UploadBlobStream(ctx, b.Container, blobKey, counter); err != nil {
 		return 0, "", fmt.Errorf("uploading to Azure Blob: %w", err)
 	}
 
-	return int64(len(data)), etag, nil
+	return counter.n, fmt.Sprintf(`"%x"`, h.Sum(nil)), nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // GetObject retrieves object data from the upstream Azure Blob container.
@@ -60,6 +60,11 @@ func (c *realAzureClient) UploadBlob(ctx context.Context, containerName, blobNam
 	return err
 }
 
+func (c *realAzureClient) UploadBlobStream(ctx context.Context, containerName, blobName string, r io.Reader) error {
+	_, err := c.client.UploadStream(ctx, containerName, blobName, r, nil)
+	return err
+}
+
 func (c *realAzureClient) DownloadBlob(ctx context.Context, containerName, blobName string) ([]byte, error) {
 	resp, err := c.client.DownloadStream(ctx, containerName, blobName, nil)
 	if err != nil {
@@ -52,6 +52,14 @@ func (m *mockAzureClient) UploadBlob(ctx context.Context, containerName, blobNam
 	return nil
 }
 
+func (m *mockAzureClient) UploadBlobStream(ctx context.Context, containerName, blobName string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.UploadBlob(ctx, containerName, blobName, data)
+}
+
 func (m *mockAzureClient) DownloadBlob(ctx context.Context, containerName, blobName string) ([]byte, error) {
 	m.downloadCalls++
 	key := m.blobKey(containerName, blobName)
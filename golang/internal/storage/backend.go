@@ -53,3 +53,45 @@ type StorageBackend interface {
 	// HealthCheck verifies that the storage backend is operational.
 	HealthCheck(ctx context.Context) error
 }
+
+// Defragmenter is an optional interface for backends that may store
+// multipart-assembled objects as chains of parts. DefragmentObject rewrites
+// such an object into a single contiguous blob and reports whether it did;
+// objects that are already contiguous are left alone.
+type Defragmenter interface {
+	DefragmentObject(ctx context.Context, bucket, key string) (bool, error)
+}
+
+// Preloader is an optional interface for backends whose reads benefit from
+// warming a cache ahead of demand (e.g. the OS page cache for files on
+// disk). PreloadObject reads the object through and returns its size.
+type Preloader interface {
+	PreloadObject(ctx context.Context, bucket, key string) (int64, error)
+}
+
+// Purger is an optional interface for backends that keep data of deleted
+// objects until a later pass reclaims it: dead records in segment files,
+// unreferenced blobs or quarantined files. PurgeObject removes what is left
+// of bucket/key after DeleteObject now, and may reclaim the data of other
+// deleted objects along with it.
+type Purger interface {
+	PurgeObject(ctx context.Context, bucket, key string) error
+}
+
+// Replicator is an optional interface for backends that can stream their
+// contents to a peer instance and follow a peer's stream.
+type Replicator interface {
+	// StreamReplication writes the backend's full contents to w, followed
+	// by every change until ctx is done. flush is called whenever the
+	// stream has caught up.
+	StreamReplication(ctx context.Context, w io.Writer, flush func() error) error
+
+	// ApplyReplication replaces the backend's contents with the full state
+	// read from a peer's stream and calls synced once it is loaded. If
+	// follow is true it then applies the peer's changes until the stream
+	// ends; otherwise it returns after the full state.
+	ApplyReplication(ctx context.Context, r io.Reader, follow bool, synced func()) error
+
+	// Empty reports whether the backend holds no objects or parts.
+	Empty() bool
+}
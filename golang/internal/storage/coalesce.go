@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// coalesceChunkSize is the size of the reads that fill a spool file.
+const coalesceChunkSize = 256 << 10
+
+// CoalescingBackend shares one inner GetObject among concurrent GETs of the
+// same object. The first GET fetches the object into a spool file; GETs that
+// arrive while the fetch is in flight read the spool instead of fetching
+// again, each at its own pace and position. Readers it returns implement
+// io.Seeker, so a range GET seeks straight to its offset, waiting until
+// the fetch gets there, rather than reading and discarding what precedes
+// it.
+//
+// It is meant for backends where a GET is a remote fetch of the whole
+// object, such as the gateways. A write, copy or delete of a key detaches
+// its in-flight fetch, so later GETs do not join it.
+type CoalescingBackend struct {
+	inner StorageBackend
+	dir   string
+	onGet func(joined bool)
+
+	mu       sync.Mutex
+	inflight map[string]*spool
+}
+
+// coalescingDefragmenter is a CoalescingBackend over a Defragmenter.
+type coalescingDefragmenter struct {
+	*CoalescingBackend
+}
+
+func (c coalescingDefragmenter) DefragmentObject(ctx context.Context, bucket, key string) (bool, error) {
+	return c.inner.(Defragmenter).DefragmentObject(ctx, bucket, key)
+}
+
+// NewCoalescingBackend wraps inner, spooling shared fetches to files in dir
+// ("" for the system temporary directory). onGet, if not nil, is called for
+// each GetObject with whether it joined a fetch already in flight. The
+// result is a Defragmenter if inner is.
+func NewCoalescingBackend(inner StorageBackend, dir string, onGet func(joined bool)) StorageBackend {
+	c := &CoalescingBackend{inner: inner, dir: dir, onGet: onGet, inflight: make(map[string]*spool)}
+	if _, ok := inner.(Defragmenter); ok {
+		return coalescingDefragmenter{c}
+	}
+	return c
+}
+
+// spool is one shared fetch. The fill goroutine appends the object to file
+// and wakes readers waiting for bytes it had not written yet.
+type spool struct {
+	key   string // inflight map key
+	ready chan struct{}
+	// Set before ready is closed.
+	size    int64
+	etag    string
+	openErr error
+	file    *os.File
+	cancel  context.CancelFunc
+
+	refs int // guarded by CoalescingBackend.mu
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	written   int64
+	done      bool
+	err       error
+	abandoned bool // every reader has closed
+}
+
+func coalesceKey(bucket, key string) string {
+	return bucket + "\x00" + key
+}
+
+// GetObject returns a reader of the object, joining a fetch of it already
+// in flight if there is one.
+func (c *CoalescingBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	k := coalesceKey(bucket, key)
+	c.mu.Lock()
+	sp, joined := c.inflight[k]
+	if joined {
+		sp.refs++
+	} else {
+		sp = &spool{key: k, ready: make(chan struct{}), refs: 1}
+		sp.cond = sync.NewCond(&sp.mu)
+		c.inflight[k] = sp
+	}
+	c.mu.Unlock()
+	if c.onGet != nil {
+		c.onGet(joined)
+	}
+
+	if !joined {
+		c.open(ctx, sp, bucket, key)
+	} else {
+		select {
+		case <-sp.ready:
+		case <-ctx.Done():
+			c.release(sp)
+			return nil, 0, "", ctx.Err()
+		}
+	}
+	if sp.openErr != nil {
+		c.release(sp)
+		return nil, 0, "", sp.openErr
+	}
+	return &spoolReader{c: c, sp: sp}, sp.size, sp.etag, nil
+}
+
+// open starts the fetch of sp and closes sp.ready once its size and ETag,
+// or the error, are known. The fetch does not end with the context of the
+// GET that started it, only when every reader has closed.
+func (c *CoalescingBackend) open(ctx context.Context, sp *spool, bucket, key string) {
+	defer close(sp.ready)
+	fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	rc, size, etag, err := c.inner.GetObject(fetchCtx, bucket, key)
+	if err == nil {
+		sp.file, err = os.CreateTemp(c.dir, "bleepstore-coalesce-*")
+		if err != nil {
+			rc.Close()
+			err = fmt.Errorf("creating spool file: %w", err)
+		}
+	}
+	if err != nil {
+		cancel()
+		sp.openErr = err
+		c.detach(sp)
+		return
+	}
+	sp.size, sp.etag, sp.cancel = size, etag, cancel
+	go c.fill(sp, rc)
+}
+
+// fill copies the fetched object into the spool file.
+func (c *CoalescingBackend) fill(sp *spool, rc io.ReadCloser) {
+	defer rc.Close()
+	buf := make([]byte, coalesceChunkSize)
+	var err error
+	for {
+		n, rerr := rc.Read(buf)
+		if n > 0 {
+			if _, werr := sp.file.WriteAt(buf[:n], sp.written); werr != nil {
+				err = fmt.Errorf("writing spool file: %w", werr)
+				break
+			}
+			sp.mu.Lock()
+			sp.written += int64(n)
+			sp.mu.Unlock()
+			sp.cond.Broadcast()
+		}
+		if rerr == io.EOF {
+			if sp.written != sp.size {
+				err = io.ErrUnexpectedEOF
+			}
+			break
+		}
+		if rerr != nil {
+			err = rerr
+			break
+		}
+	}
+	c.detach(sp)
+
+	sp.mu.Lock()
+	sp.done, sp.err = true, err
+	abandoned := sp.abandoned
+	sp.mu.Unlock()
+	sp.cond.Broadcast()
+	if abandoned {
+		sp.remove()
+	}
+}
+
+// detach stops later GETs from joining sp.
+func (c *CoalescingBackend) detach(sp *spool) {
+	c.mu.Lock()
+	if c.inflight[sp.key] == sp {
+		delete(c.inflight, sp.key)
+	}
+	c.mu.Unlock()
+}
+
+// forget detaches the in-flight fetch of bucket/key, if any, because the
+// object is changing.
+func (c *CoalescingBackend) forget(bucket, key string) {
+	c.mu.Lock()
+	delete(c.inflight, coalesceKey(bucket, key))
+	c.mu.Unlock()
+}
+
+// release drops a reader's reference to sp. The last one stops the fetch
+// and removes the spool file once the fill goroutine has finished with it.
+func (c *CoalescingBackend) release(sp *spool) {
+	c.mu.Lock()
+	sp.refs--
+	last := sp.refs == 0
+	if last && c.inflight[sp.key] == sp {
+		delete(c.inflight, sp.key)
+	}
+	c.mu.Unlock()
+	if !last || sp.openErr != nil {
+		return
+	}
+	sp.cancel()
+	sp.mu.Lock()
+	sp.abandoned = true
+	done := sp.done
+	sp.mu.Unlock()
+	if done {
+		sp.remove()
+	}
+}
+
+// remove closes and deletes the spool file.
+func (sp *spool) remove() {
+	sp.file.Close()
+	if err := os.Remove(sp.file.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Could not remove spool file", "path", sp.file.Name(), "error", err)
+	}
+}
+
+// spoolReader reads a spool from its own offset, waiting for the fill
+// goroutine when it is ahead of it.
+type spoolReader struct {
+	c      *CoalescingBackend
+	sp     *spool
+	off    int64
+	closed bool
+}
+
+func (r *spoolReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	sp := r.sp
+	if r.off >= sp.size {
+		return 0, io.EOF
+	}
+	sp.mu.Lock()
+	for sp.written <= r.off && !sp.done {
+		sp.cond.Wait()
+	}
+	written, err := sp.written, sp.err
+	sp.mu.Unlock()
+	if r.off >= written {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	n, rerr := sp.file.ReadAt(p[:min(int64(len(p)), written-r.off)], r.off)
+	r.off += int64(n)
+	if rerr == io.EOF {
+		rerr = nil
+	}
+	return n, rerr
+}
+
+func (r *spoolReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.sp.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek to a negative offset")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *spoolReader) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.c.release(r.sp)
+	}
+	return nil
+}
+
+// PutObject writes through to the inner backend.
+func (c *CoalescingBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	c.forget(bucket, key)
+	return c.inner.PutObject(ctx, bucket, key, reader, size)
+}
+
+// DeleteObject deletes from the inner backend.
+func (c *CoalescingBackend) DeleteObject(ctx context.Context, bucket, key string) error {
+	c.forget(bucket, key)
+	return c.inner.DeleteObject(ctx, bucket, key)
+}
+
+// CopyObject copies within the inner backend.
+func (c *CoalescingBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (string, error) {
+	c.forget(dstBucket, dstKey)
+	return c.inner.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+// PutPart writes a part to the inner backend.
+func (c *CoalescingBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	return c.inner.PutPart(ctx, bucket, key, uploadID, partNumber, reader, size)
+}
+
+// AssembleParts assembles parts in the inner backend.
+func (c *CoalescingBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	c.forget(bucket, key)
+	return c.inner.AssembleParts(ctx, bucket, key, uploadID, partNumbers)
+}
+
+// DeleteParts deletes parts from the inner backend.
+func (c *CoalescingBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
+	return c.inner.DeleteParts(ctx, bucket, key, uploadID)
+}
+
+// CreateBucket creates the bucket in the inner backend.
+func (c *CoalescingBackend) CreateBucket(ctx context.Context, bucket string) error {
+	return c.inner.CreateBucket(ctx, bucket)
+}
+
+// DeleteBucket deletes the bucket from the inner backend.
+func (c *CoalescingBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	return c.inner.DeleteBucket(ctx, bucket)
+}
+
+// ObjectExists checks the inner backend.
+func (c *CoalescingBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	return c.inner.ObjectExists(ctx, bucket, key)
+}
+
+// HealthCheck checks the inner backend.
+func (c *CoalescingBackend) HealthCheck(ctx context.Context) error {
+	return c.inner.HealthCheck(ctx)
+}
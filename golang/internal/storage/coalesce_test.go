@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// gatedBackend counts GetObject calls and holds back the data they return
+// until release is closed.
+type gatedBackend struct {
+	*MemoryBackend
+	gets    atomic.Int32
+	release chan struct{}
+}
+
+func (g *gatedBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	g.gets.Add(1)
+	rc, size, etag, err := g.MemoryBackend.GetObject(ctx, bucket, key)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return &gatedReader{ReadCloser: rc, release: g.release}, size, etag, nil
+}
+
+type gatedReader struct {
+	io.ReadCloser
+	release chan struct{}
+}
+
+func (r *gatedReader) Read(p []byte) (int, error) {
+	<-r.release
+	return r.ReadCloser.Read(p)
+}
+
+func newTestCoalescing(t *testing.T) (*CoalescingBackend, *gatedBackend, string, map[bool]int) {
+	t.Helper()
+	mem, err := NewMemoryBackend(0, "none", "", 0, "")
+	if err != nil {
+		t.Fatalf("NewMemoryBackend failed: %v", err)
+	}
+	t.Cleanup(func() { mem.Close() })
+	gated := &gatedBackend{MemoryBackend: mem, release: make(chan struct{})}
+	dir := t.TempDir()
+	counts := map[bool]int{}
+	var mu sync.Mutex
+	c := NewCoalescingBackend(gated, dir, func(joined bool) {
+		mu.Lock()
+		counts[joined]++
+		mu.Unlock()
+	}).(*CoalescingBackend)
+	return c, gated, dir, counts
+}
+
+func TestCoalescingGetObject(t *testing.T) {
+	ctx := context.Background()
+	c, gated, dir, counts := newTestCoalescing(t)
+	data := bytes.Repeat([]byte("0123456789"), 100_000)
+	c.CreateBucket(ctx, "b")
+	if _, _, err := c.PutObject(ctx, "b", "k", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	// Readers that arrive while the first fetch is held back join it, each
+	// reading its own range.
+	offsets := []int64{0, 5, 400_000, 999_990}
+	readers := make([]io.ReadCloser, len(offsets))
+	for i := range offsets {
+		rc, size, _, err := c.GetObject(ctx, "b", "k")
+		if err != nil || size != int64(len(data)) {
+			t.Fatalf("GetObject %d = %d, %v", i, size, err)
+		}
+		readers[i] = rc
+	}
+	if n := gated.gets.Load(); n != 1 {
+		t.Fatalf("inner GetObject called %d times, want 1", n)
+	}
+	if counts[false] != 1 || counts[true] != 3 {
+		t.Errorf("onGet counts = %v", counts)
+	}
+
+	var wg sync.WaitGroup
+	for i, off := range offsets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rc := readers[i]
+			if _, err := rc.(io.Seeker).Seek(off, io.SeekStart); err != nil {
+				t.Errorf("Seek(%d): %v", off, err)
+				return
+			}
+			got, err := io.ReadAll(io.LimitReader(rc, 10))
+			if err != nil || !bytes.Equal(got, data[off:off+10]) {
+				t.Errorf("reading at %d = %q, %v", off, got, err)
+			}
+		}()
+	}
+	close(gated.release)
+	wg.Wait()
+
+	// A reader from the start gets the whole object.
+	readers[0].(io.Seeker).Seek(0, io.SeekStart)
+	if got, err := io.ReadAll(readers[0]); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("full read = %d bytes, %v", len(got), err)
+	}
+	for _, rc := range readers {
+		rc.Close()
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spool files left behind: %v", entries)
+	}
+
+	// Once the fetch is over, the next GET fetches again.
+	rc, _, _, err := c.GetObject(ctx, "b", "k")
+	if err != nil {
+		t.Fatalf("GetObject after the fetch: %v", err)
+	}
+	io.Copy(io.Discard, rc)
+	rc.Close()
+	if n := gated.gets.Load(); n != 2 {
+		t.Errorf("inner GetObject called %d times, want 2", n)
+	}
+}
+
+func TestCoalescingGetObjectDetached(t *testing.T) {
+	ctx := context.Background()
+	c, gated, _, _ := newTestCoalescing(t)
+	c.CreateBucket(ctx, "b")
+	c.PutObject(ctx, "b", "k", strings.NewReader("old"), 3)
+
+	first, _, _, err := c.GetObject(ctx, "b", "k")
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	// Overwriting the object detaches the fetch in flight.
+	c.PutObject(ctx, "b", "k", strings.NewReader("newer"), 5)
+	second, size, _, err := c.GetObject(ctx, "b", "k")
+	if err != nil || size != 5 {
+		t.Fatalf("GetObject after overwrite = %d, %v", size, err)
+	}
+	close(gated.release)
+	if got, _ := io.ReadAll(first); string(got) != "old" {
+		t.Errorf("first reader = %q, want old", got)
+	}
+	if got, _ := io.ReadAll(second); string(got) != "newer" {
+		t.Errorf("second reader = %q, want newer", got)
+	}
+	first.Close()
+	second.Close()
+	if n := gated.gets.Load(); n != 2 {
+		t.Errorf("inner GetObject called %d times, want 2", n)
+	}
+
+	// Errors reach the caller and are not shared with later GETs.
+	if _, _, _, err := c.GetObject(ctx, "b", "missing"); err == nil {
+		t.Error("GetObject of a missing object succeeded")
+	}
+	if len(c.inflight) != 0 {
+		t.Errorf("fetches in flight after an error: %d", len(c.inflight))
+	}
+}
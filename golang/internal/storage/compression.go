@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codecs for object data compressed at rest. The codec an object was
+// written with is recorded in its metadata; Size and ETag always describe
+// the uncompressed data.
+const (
+	CodecZstd = "zstd"
+	CodecGzip = "gzip"
+)
+
+// ValidCodec reports whether codec names a supported compression codec.
+func ValidCodec(codec string) bool {
+	return codec == CodecZstd || codec == CodecGzip
+}
+
+// NewCompressWriter returns a writer that compresses into w with codec.
+// Closing it flushes the compressed stream but does not close w.
+func NewCompressWriter(codec string, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case CodecZstd:
+		return zstd.NewWriter(w)
+	case CodecGzip:
+		return gzip.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %q", codec)
+}
+
+// NewDecompressReader returns a reader over the decompressed contents of rc.
+// Closing it also closes rc.
+func NewDecompressReader(codec string, rc io.ReadCloser) (io.ReadCloser, error) {
+	switch codec {
+	case CodecZstd:
+		dec, err := zstd.NewReader(rc, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("opening zstd stream: %w", err)
+		}
+		return &decompressReader{Reader: dec, close: dec.Close, src: rc}, nil
+	case CodecGzip:
+		dec, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		return &decompressReader{Reader: dec, close: func() { dec.Close() }, src: rc}, nil
+	}
+	rc.Close()
+	return nil, fmt.Errorf("unknown compression codec %q", codec)
+}
+
+// decompressReader releases its decoder and the compressed source on Close.
+type decompressReader struct {
+	io.Reader
+	close func()
+	src   io.Closer
+}
+
+func (d *decompressReader) Close() error {
+	d.close()
+	return d.src.Close()
+}
+
+// CompressReader returns a reader of r's contents compressed with codec,
+// produced by a goroutine as the result is read. The caller must Close it;
+// doing so before EOF stops the goroutine.
+func CompressReader(codec string, r io.Reader) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	cw, err := NewCompressWriter(codec, pw)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := io.Copy(cw, r)
+		if cerr := cw.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+	}()
+	return &compressReader{PipeReader: pr, done: done}, nil
+}
+
+type compressReader struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// Close stops the compressor and waits for it, so r is no longer read once
+// Close returns.
+func (c *compressReader) Close() error {
+	c.PipeReader.CloseWithError(io.ErrClosedPipe)
+	<-c.done
+	return nil
+}
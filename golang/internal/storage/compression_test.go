@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("round trip "), 1000)
+	for _, codec := range []string{CodecZstd, CodecGzip} {
+		rc, err := CompressReader(codec, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: CompressReader: %v", codec, err)
+		}
+		compressed, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: compressing: %v", codec, err)
+		}
+		if len(compressed) >= len(data) {
+			t.Errorf("%s: compressed %d bytes to %d", codec, len(data), len(compressed))
+		}
+
+		dec, err := NewDecompressReader(codec, io.NopCloser(bytes.NewReader(compressed)))
+		if err != nil {
+			t.Fatalf("%s: NewDecompressReader: %v", codec, err)
+		}
+		got, err := io.ReadAll(dec)
+		dec.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: decompressed %d bytes (%v), want the original %d", codec, len(got), err, len(data))
+		}
+	}
+}
+
+func TestCompressionUnknownCodec(t *testing.T) {
+	if ValidCodec("lz4") {
+		t.Error("ValidCodec(lz4) = true")
+	}
+	if _, err := CompressReader("lz4", bytes.NewReader(nil)); err == nil {
+		t.Error("CompressReader accepted an unknown codec")
+	}
+	if _, err := NewDecompressReader("lz4", io.NopCloser(bytes.NewReader(nil))); err == nil {
+		t.Error("NewDecompressReader accepted an unknown codec")
+	}
+}
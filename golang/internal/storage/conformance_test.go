@@ -0,0 +1,155 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/storage"
+	"github.com/bleepstore/bleepstore/internal/storage/storagetest"
+)
+
+func TestConformanceLocal(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		backend, err := storage.NewLocalBackend(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewLocalBackend: %v", err)
+		}
+		return backend
+	})
+}
+
+func TestConformanceJBOD(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		base := t.TempDir()
+		backend, err := storage.NewJBODBackend([]string{filepath.Join(base, "disk1"), filepath.Join(base, "disk2")}, storage.JBODOptions{})
+		if err != nil {
+			t.Fatalf("NewJBODBackend: %v", err)
+		}
+		return backend
+	})
+}
+
+func TestConformanceJBODIndexed(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		base := t.TempDir()
+		backend, err := storage.NewJBODBackend([]string{filepath.Join(base, "disk1"), filepath.Join(base, "disk2")},
+			storage.JBODOptions{IndexPath: filepath.Join(base, "disk1", ".placement", "index.db")})
+		if err != nil {
+			t.Fatalf("NewJBODBackend: %v", err)
+		}
+		t.Cleanup(func() { backend.Close() })
+		return backend
+	})
+}
+
+func TestConformancePacked(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		root := t.TempDir()
+		local, err := storage.NewLocalBackend(root)
+		if err != nil {
+			t.Fatalf("NewLocalBackend: %v", err)
+		}
+		// A low threshold exercises both packed and unpacked objects.
+		backend, err := storage.NewPackedBackend(local, filepath.Join(root, storage.PackDirName),
+			storage.PackOptions{ThresholdBytes: 16, SegmentBytes: 1024, CompactRatio: 0.5})
+		if err != nil {
+			t.Fatalf("NewPackedBackend: %v", err)
+		}
+		t.Cleanup(func() { backend.Close() })
+		return backend
+	})
+}
+
+func TestConformanceMemory(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		backend, err := storage.NewMemoryBackend(0, "none", "", 0, "")
+		if err != nil {
+			t.Fatalf("NewMemoryBackend: %v", err)
+		}
+		t.Cleanup(func() { backend.Close() })
+		return backend
+	})
+}
+
+func TestConformanceCoalescing(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		inner, err := storage.NewMemoryBackend(0, "none", "", 0, "")
+		if err != nil {
+			t.Fatalf("NewMemoryBackend: %v", err)
+		}
+		t.Cleanup(func() { inner.Close() })
+		return storage.NewCoalescingBackend(inner, t.TempDir(), nil)
+	})
+}
+
+func TestConformanceAdaptive(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		inner, err := storage.NewMemoryBackend(0, "none", "", 0, "")
+		if err != nil {
+			t.Fatalf("NewMemoryBackend: %v", err)
+		}
+		t.Cleanup(func() { inner.Close() })
+		b, err := storage.NewAdaptiveBackend(inner, storage.AdaptiveOptions{InitialLimit: 1})
+		if err != nil {
+			t.Fatalf("NewAdaptiveBackend: %v", err)
+		}
+		return b
+	})
+}
+
+func TestConformanceSQLite(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		backend, err := storage.NewSQLiteBackend(filepath.Join(t.TempDir(), "objects.db"))
+		if err != nil {
+			t.Fatalf("NewSQLiteBackend: %v", err)
+		}
+		t.Cleanup(func() { backend.Close() })
+		return backend
+	})
+}
+
+func TestConformanceMirror(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		base := t.TempDir()
+		var targets []storage.MirrorTarget
+		for _, tc := range []struct{ name, zone string }{{"a1", "a"}, {"a2", "a"}, {"b1", "b"}} {
+			local, err := storage.NewLocalBackend(filepath.Join(base, tc.name))
+			if err != nil {
+				t.Fatalf("NewLocalBackend: %v", err)
+			}
+			targets = append(targets, storage.MirrorTarget{Name: tc.name, Zone: tc.zone, Backend: local})
+		}
+		backend, err := storage.NewMirrorBackend(targets, 2, 0)
+		if err != nil {
+			t.Fatalf("NewMirrorBackend: %v", err)
+		}
+		return backend
+	})
+}
+
+func TestConformanceErasure(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		base := t.TempDir()
+		var disks []string
+		for _, name := range []string{"disk1", "disk2", "disk3", "disk4"} {
+			disks = append(disks, filepath.Join(base, name))
+		}
+		// A small block size makes the suite's objects span several stripes.
+		backend, err := storage.NewErasureBackend(disks, 2, 1024)
+		if err != nil {
+			t.Fatalf("NewErasureBackend: %v", err)
+		}
+		return backend
+	})
+}
+
+func TestConformanceDedup(t *testing.T) {
+	storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+		backend, err := storage.NewDedupBackend(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewDedupBackend: %v", err)
+		}
+		t.Cleanup(func() { backend.Close() })
+		return backend
+	})
+}
@@ -0,0 +1,552 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/bleepstore/bleepstore/internal/progress"
+	"github.com/bleepstore/bleepstore/internal/uid"
+)
+
+const (
+	// dedupIndexName is the bbolt index file under a dedup root.
+	dedupIndexName = "index.db"
+
+	// dedupBlobDir is the directory under a dedup root that holds the blobs.
+	dedupBlobDir = "blobs"
+)
+
+// Dedup index buckets: "objects" maps bucket\x00key to a dedupRef, "blobs"
+// maps a SHA-256 digest to the number of objects referencing it.
+var (
+	dedupObjectsBucket = []byte("objects")
+	dedupBlobsBucket   = []byte("blobs")
+)
+
+// GarbageCollector is an optional interface for backends that share stored
+// data between objects and free it only once nothing references it.
+type GarbageCollector interface {
+	CollectGarbage(ctx context.Context) (*GCResult, error)
+}
+
+// GCResult summarizes a garbage collection pass.
+type GCResult struct {
+	BlobsRemoved   int   `json:"blobs_removed"`
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+}
+
+// DedupBackend stores each distinct object body once, as a blob named by
+// its SHA-256 digest, so identical objects written under many keys and
+// buckets share disk space. Copies only add a reference.
+//
+// A bbolt index maps each key to its blob and counts the references to
+// every blob. A write stores the blob, fsyncs it, then commits the index.
+// Overwrites and deletes only drop a reference; blobs nothing references,
+// including those left by a crash before the index commit, are removed by
+// CollectGarbage.
+type DedupBackend struct {
+	RootDir string
+	index   *bolt.DB
+
+	// locks serialize storing a blob with collecting it, by digest.
+	locks [packLockStripes]sync.Mutex
+
+	// gcMu allows one collection pass at a time.
+	gcMu sync.Mutex
+}
+
+// dedupRef is the blob an object refers to.
+type dedupRef struct {
+	Size int64
+	Hash [sha256.Size]byte
+	ETag string
+}
+
+func (r dedupRef) encode() []byte {
+	b := make([]byte, 8, 8+sha256.Size+len(r.ETag))
+	binary.BigEndian.PutUint64(b, uint64(r.Size))
+	b = append(b, r.Hash[:]...)
+	return append(b, r.ETag...)
+}
+
+func decodeDedupRef(b []byte) (dedupRef, error) {
+	if len(b) < 8+sha256.Size {
+		return dedupRef{}, fmt.Errorf("corrupt dedup index entry (%d bytes)", len(b))
+	}
+	r := dedupRef{Size: int64(binary.BigEndian.Uint64(b)), ETag: string(b[8+sha256.Size:])}
+	copy(r.Hash[:], b[8:])
+	return r, nil
+}
+
+// NewDedupBackend opens (or creates) a deduplicating store under rootDir.
+func NewDedupBackend(rootDir string) (*DedupBackend, error) {
+	for _, dir := range []string{rootDir, filepath.Join(rootDir, ".tmp"), filepath.Join(rootDir, dedupBlobDir)} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating dedup directory %q: %w", dir, err)
+		}
+	}
+	db, err := bolt.Open(filepath.Join(rootDir, dedupIndexName), 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening dedup index: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(dedupObjectsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(dedupBlobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing dedup index: %w", err)
+	}
+	return &DedupBackend{RootDir: rootDir, index: db}, nil
+}
+
+// Close closes the index.
+func (d *DedupBackend) Close() error {
+	return d.index.Close()
+}
+
+// CleanTempFiles removes temp files left by writes that never completed.
+func (d *DedupBackend) CleanTempFiles() error {
+	tmpDir := filepath.Join(d.RootDir, ".tmp")
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return fmt.Errorf("reading temp directory: %w", err)
+	}
+	for _, e := range entries {
+		os.Remove(filepath.Join(tmpDir, e.Name()))
+	}
+	return nil
+}
+
+func (d *DedupBackend) blobPath(sum [sha256.Size]byte) string {
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(d.RootDir, dedupBlobDir, name[:2], name)
+}
+
+func (d *DedupBackend) tempPath() string {
+	return filepath.Join(d.RootDir, ".tmp", "tmp-"+uid.New())
+}
+
+func (d *DedupBackend) partDir(uploadID string) string {
+	return filepath.Join(d.RootDir, ".multipart", uploadID)
+}
+
+// lockBlob locks the stripe for a digest and returns the unlock function.
+func (d *DedupBackend) lockBlob(sum [sha256.Size]byte) func() {
+	mu := &d.locks[binary.BigEndian.Uint32(sum[:])%packLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// writeTemp copies r to a synced temp file, feeding every byte to extra
+// too, and returns the temp path, size and SHA-256 digest.
+func (d *DedupBackend) writeTemp(r io.Reader, extra io.Writer) (string, int64, [sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	tmpPath := d.tempPath()
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return "", 0, sum, fmt.Errorf("creating temp file: %w", err)
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h, extra), r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", 0, sum, fmt.Errorf("writing object data: %w", err)
+	}
+	copy(sum[:], h.Sum(nil))
+	return tmpPath, n, sum, nil
+}
+
+// commit makes the temp file the blob for ref.Hash, unless that blob is
+// already stored, and points bucket/key at it.
+func (d *DedupBackend) commit(bucket, key, tmpPath string, ref dedupRef) error {
+	unlock := d.lockBlob(ref.Hash)
+	defer unlock()
+
+	blob := d.blobPath(ref.Hash)
+	if _, err := os.Stat(blob); err == nil {
+		os.Remove(tmpPath)
+	} else {
+		if err := os.MkdirAll(filepath.Dir(blob), 0o755); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("creating blob directory: %w", err)
+		}
+		if err := os.Rename(tmpPath, blob); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("renaming temp file to blob: %w", err)
+		}
+	}
+	return d.setRef(bucket, key, &ref)
+}
+
+// addRefs adjusts the reference count of a blob by delta, dropping the
+// entry when it reaches zero.
+func addRefs(tx *bolt.Tx, sum [sha256.Size]byte, delta int64) error {
+	blobs := tx.Bucket(dedupBlobsBucket)
+	var n int64
+	if v := blobs.Get(sum[:]); len(v) == 8 {
+		n = int64(binary.BigEndian.Uint64(v))
+	}
+	n += delta
+	if n <= 0 {
+		return blobs.Delete(sum[:])
+	}
+	return blobs.Put(sum[:], binary.BigEndian.AppendUint64(nil, uint64(n)))
+}
+
+// setRef points bucket/key at ref, or removes it from the index when ref is
+// nil, dropping the reference held by any previous version.
+func (d *DedupBackend) setRef(bucket, key string, ref *dedupRef) error {
+	err := d.index.Update(func(tx *bolt.Tx) error {
+		objs := tx.Bucket(dedupObjectsBucket)
+		k := packKey(bucket, key)
+		if v := objs.Get(k); v != nil {
+			old, err := decodeDedupRef(v)
+			if err != nil {
+				return err
+			}
+			if err := addRefs(tx, old.Hash, -1); err != nil {
+				return err
+			}
+		}
+		if ref == nil {
+			return objs.Delete(k)
+		}
+		if err := addRefs(tx, ref.Hash, 1); err != nil {
+			return err
+		}
+		return objs.Put(k, ref.encode())
+	})
+	if err != nil {
+		return fmt.Errorf("updating dedup index: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the blob bucket/key refers to.
+func (d *DedupBackend) lookup(bucket, key string) (dedupRef, bool, error) {
+	var (
+		ref dedupRef
+		ok  bool
+	)
+	err := d.index.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(dedupObjectsBucket).Get(packKey(bucket, key))
+		if v == nil {
+			return nil
+		}
+		var err error
+		ref, err = decodeDedupRef(v)
+		ok = err == nil
+		return err
+	})
+	if err != nil {
+		return dedupRef{}, false, fmt.Errorf("reading dedup index: %w", err)
+	}
+	return ref, ok, nil
+}
+
+// PutObject stores the object's body as a blob, reusing an identical blob
+// if one is already stored. Returns the bytes written and the MD5 ETag.
+func (d *DedupBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	md := md5.New()
+	tmpPath, n, sum, err := d.writeTemp(reader, md)
+	if err != nil {
+		return 0, "", err
+	}
+	etag := fmt.Sprintf(`"%x"`, md.Sum(nil))
+	if err := d.commit(bucket, key, tmpPath, dedupRef{Size: n, Hash: sum, ETag: etag}); err != nil {
+		return 0, "", err
+	}
+	return n, etag, nil
+}
+
+// GetObject opens the blob bucket/key refers to. The returned file is
+// seekable.
+func (d *DedupBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	ref, ok, err := d.lookup(bucket, key)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if !ok {
+		return nil, 0, "", fmt.Errorf("object not found: %s/%s", bucket, key)
+	}
+	f, err := os.Open(d.blobPath(ref.Hash))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// Overwritten or deleted, and collected, since the lookup.
+			return nil, 0, "", fmt.Errorf("object not found: %s/%s", bucket, key)
+		}
+		return nil, 0, "", fmt.Errorf("opening blob for %q/%q: %w", bucket, key, err)
+	}
+	return f, ref.Size, ref.ETag, nil
+}
+
+// PreloadObject reads the object's blob through so its pages are resident
+// in the OS page cache.
+func (d *DedupBackend) PreloadObject(ctx context.Context, bucket, key string) (int64, error) {
+	rc, _, _, err := d.GetObject(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	n, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return n, fmt.Errorf("reading object %q/%q: %w", bucket, key, err)
+	}
+	return n, nil
+}
+
+// DeleteObject drops the object's reference to its blob. Idempotent.
+func (d *DedupBackend) DeleteObject(ctx context.Context, bucket, key string) error {
+	return d.setRef(bucket, key, nil)
+}
+
+// PurgeObject removes the blob bucket/key referred to, with every other
+// blob nothing references any more. A blob still shared with other objects
+// is kept.
+func (d *DedupBackend) PurgeObject(ctx context.Context, bucket, key string) error {
+	_, err := d.CollectGarbage(ctx)
+	return err
+}
+
+// CopyObject points the destination at the source's blob without copying
+// any data. Returns the new ETag.
+func (d *DedupBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (string, error) {
+	ref, ok, err := d.lookup(srcBucket, srcKey)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("source object not found: %s/%s", srcBucket, srcKey)
+	}
+	if strings.Contains(ref.ETag, "-") {
+		// A copy gets a plain MD5 ETag, as with the other backends, even
+		// when the source was assembled from parts.
+		rc, _, _, err := d.GetObject(ctx, srcBucket, srcKey)
+		if err != nil {
+			return "", err
+		}
+		md := md5.New()
+		_, err = io.Copy(md, rc)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading source object: %w", err)
+		}
+		ref.ETag = fmt.Sprintf(`"%x"`, md.Sum(nil))
+	}
+
+	// The source may since have been deleted and its blob collected.
+	unlock := d.lockBlob(ref.Hash)
+	defer unlock()
+	if _, err := os.Stat(d.blobPath(ref.Hash)); err != nil {
+		return "", fmt.Errorf("source object not found: %s/%s", srcBucket, srcKey)
+	}
+	if err := d.setRef(dstBucket, dstKey, &ref); err != nil {
+		return "", err
+	}
+	return ref.ETag, nil
+}
+
+// PutPart writes a multipart upload part to its own file; parts become a
+// blob only when assembled.
+func (d *DedupBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	dir := d.partDir(uploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating part directory: %w", err)
+	}
+	md := md5.New()
+	tmpPath, _, _, err := d.writeTemp(reader, md)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, fmt.Sprintf("%d", partNumber))); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("renaming part temp file: %w", err)
+	}
+	return fmt.Sprintf(`"%x"`, md.Sum(nil)), nil
+}
+
+// AssembleParts concatenates the parts into a blob, reusing an identical
+// blob if one is already stored, and removes the part files. Returns the
+// composite ETag.
+func (d *DedupBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	dir := d.partDir(uploadID)
+	readers := make([]io.Reader, 0, len(partNumbers))
+	hashes := make([]hash.Hash, 0, len(partNumbers))
+	for _, pn := range partNumbers {
+		f, err := os.Open(filepath.Join(dir, fmt.Sprintf("%d", pn)))
+		if err != nil {
+			return "", fmt.Errorf("opening part %d: %w", pn, err)
+		}
+		defer f.Close()
+		h := md5.New()
+		readers = append(readers, io.TeeReader(f, h))
+		hashes = append(hashes, h)
+	}
+	tmpPath, n, sum, err := d.writeTemp(io.MultiReader(readers...), io.Discard)
+	if err != nil {
+		return "", err
+	}
+
+	// Composite ETag format: "md5-of-concatenated-part-md5s-N"
+	composite := md5.New()
+	for _, h := range hashes {
+		composite.Write(h.Sum(nil))
+	}
+	etag := fmt.Sprintf(`"%x-%d"`, composite.Sum(nil), len(partNumbers))
+	if err := d.commit(bucket, key, tmpPath, dedupRef{Size: n, Hash: sum, ETag: etag}); err != nil {
+		return "", err
+	}
+	os.RemoveAll(dir)
+	return etag, nil
+}
+
+// DeleteParts removes all part files of the given multipart upload.
+func (d *DedupBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
+	return d.DeleteUploadParts(uploadID)
+}
+
+// DeleteUploadParts removes the parts directory of a multipart upload. It
+// is used by the startup reaper of expired uploads.
+func (d *DedupBackend) DeleteUploadParts(uploadID string) error {
+	dir := d.partDir(uploadID)
+	if err := os.RemoveAll(dir); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing part directory %q: %w", dir, err)
+	}
+	// Best-effort cleanup: remove .multipart dir if empty.
+	os.Remove(filepath.Dir(dir))
+	return nil
+}
+
+// CreateBucket is a no-op: blobs are shared by all buckets.
+func (d *DedupBackend) CreateBucket(ctx context.Context, bucket string) error {
+	return nil
+}
+
+// DeleteBucket drops the references of any objects left under the bucket.
+func (d *DedupBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	prefix := packKey(bucket, "")
+	err := d.index.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(dedupObjectsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			ref, err := decodeDedupRef(v)
+			if err != nil {
+				return err
+			}
+			if err := addRefs(tx, ref.Hash, -1); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updating dedup index: %w", err)
+	}
+	return nil
+}
+
+// ObjectExists reports whether bucket/key is in the index.
+func (d *DedupBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	_, ok, err := d.lookup(bucket, key)
+	return ok, err
+}
+
+// HealthCheck verifies the blob directory is accessible.
+func (d *DedupBackend) HealthCheck(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(d.RootDir, dedupBlobDir)); err != nil {
+		return fmt.Errorf("blob directory: %w", err)
+	}
+	return nil
+}
+
+// referenced reports whether the index holds a reference to the blob.
+func (d *DedupBackend) referenced(sum [sha256.Size]byte) (bool, error) {
+	var ok bool
+	err := d.index.View(func(tx *bolt.Tx) error {
+		ok = tx.Bucket(dedupBlobsBucket).Get(sum[:]) != nil
+		return nil
+	})
+	return ok, err
+}
+
+// CollectGarbage removes every blob that no object references: those
+// dropped by overwrites and deletes, and those stored by writes that
+// crashed before committing the index. Writes of the same content wait for
+// the blob's stripe lock, so a blob is never removed under a write that is
+// about to reference it.
+func (d *DedupBackend) CollectGarbage(ctx context.Context) (*GCResult, error) {
+	d.gcMu.Lock()
+	defer d.gcMu.Unlock()
+
+	res := &GCResult{}
+	scanned := int64(0)
+	root := filepath.Join(d.RootDir, dedupBlobDir)
+	err := filepath.WalkDir(root, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var sum [sha256.Size]byte
+		if e.IsDir() || hex.DecodedLen(len(e.Name())) != sha256.Size {
+			return nil
+		}
+		if _, err := hex.Decode(sum[:], []byte(e.Name())); err != nil {
+			return nil
+		}
+		scanned++
+		progress.Report(ctx, scanned, 0)
+		if ok, err := d.referenced(sum); err != nil || ok {
+			return err
+		}
+
+		unlock := d.lockBlob(sum)
+		defer unlock()
+		if ok, err := d.referenced(sum); err != nil || ok {
+			return err
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing blob: %w", err)
+		}
+		res.BlobsRemoved++
+		res.BytesReclaimed += info.Size()
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("collecting blobs: %w", err)
+	}
+	return res, nil
+}
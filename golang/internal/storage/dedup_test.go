@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestDedup(t *testing.T) *DedupBackend {
+	t.Helper()
+	d, err := NewDedupBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDedupBackend: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// countBlobs returns the number of blob files on disk.
+func countBlobs(t *testing.T, d *DedupBackend) int {
+	t.Helper()
+	n := 0
+	filepath.WalkDir(filepath.Join(d.RootDir, dedupBlobDir), func(_ string, e os.DirEntry, err error) error {
+		if err == nil && !e.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+func readDedup(t *testing.T, d *DedupBackend, bucket, key string) string {
+	t.Helper()
+	rc, _, _, err := d.GetObject(context.Background(), bucket, key)
+	if err != nil {
+		t.Fatalf("GetObject %s/%s: %v", bucket, key, err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	return string(data)
+}
+
+func TestDedupSharesIdenticalBlobs(t *testing.T) {
+	d := newTestDedup(t)
+	ctx := context.Background()
+	for _, loc := range [][2]string{{"a", "k1"}, {"a", "k2"}, {"b", "k1"}} {
+		if _, _, err := d.PutObject(ctx, loc[0], loc[1], strings.NewReader("same contents"), -1); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+	if _, err := d.CopyObject(ctx, "a", "k1", "c", "copy"); err != nil {
+		t.Fatalf("CopyObject: %v", err)
+	}
+	if _, _, err := d.PutObject(ctx, "a", "other", strings.NewReader("different"), -1); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if n := countBlobs(t, d); n != 2 {
+		t.Fatalf("%d blobs stored, want 2", n)
+	}
+	if got := readDedup(t, d, "c", "copy"); got != "same contents" {
+		t.Fatalf("copy reads %q", got)
+	}
+}
+
+func TestDedupCollectGarbage(t *testing.T) {
+	d := newTestDedup(t)
+	ctx := context.Background()
+	d.PutObject(ctx, "a", "k1", strings.NewReader("shared"), -1)
+	d.PutObject(ctx, "a", "k2", strings.NewReader("shared"), -1)
+	d.PutObject(ctx, "a", "k3", strings.NewReader("old version"), -1)
+
+	// Drop one of two references to "shared" and the only one to "old
+	// version"; a blob left by a crashed write is also unreferenced.
+	d.DeleteObject(ctx, "a", "k1")
+	d.PutObject(ctx, "a", "k3", strings.NewReader("new version"), -1)
+	orphan := filepath.Join(d.RootDir, dedupBlobDir, "ab", strings.Repeat("ab", 32))
+	os.MkdirAll(filepath.Dir(orphan), 0o755)
+	os.WriteFile(orphan, []byte("orphan"), 0o644)
+
+	res, err := d.CollectGarbage(ctx)
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if res.BlobsRemoved != 2 || res.BytesReclaimed != int64(len("old version")+len("orphan")) {
+		t.Fatalf("CollectGarbage = %+v, want 2 blobs, %d bytes", res, len("old version")+len("orphan"))
+	}
+	if got := readDedup(t, d, "a", "k2"); got != "shared" {
+		t.Fatalf("k2 reads %q after collection", got)
+	}
+	if got := readDedup(t, d, "a", "k3"); got != "new version" {
+		t.Fatalf("k3 reads %q after collection", got)
+	}
+
+	// Deleting the bucket's objects leaves nothing referenced.
+	if err := d.DeleteBucket(ctx, "a"); err != nil {
+		t.Fatalf("DeleteBucket: %v", err)
+	}
+	if _, err := d.CollectGarbage(ctx); err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if n := countBlobs(t, d); n != 0 {
+		t.Fatalf("%d blobs left after deleting every object", n)
+	}
+}
+
+func TestDedupIndexSurvivesReopen(t *testing.T) {
+	d := newTestDedup(t)
+	ctx := context.Background()
+	d.PutObject(ctx, "a", "k", strings.NewReader("persisted"), -1)
+	d.Close()
+
+	d, err := NewDedupBackend(d.RootDir)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer d.Close()
+	if res, err := d.CollectGarbage(ctx); err != nil || res.BlobsRemoved != 0 {
+		t.Fatalf("CollectGarbage after reopen = %+v, %v; want nothing removed", res, err)
+	}
+	if got := readDedup(t, d, "a", "k"); got != "persisted" {
+		t.Fatalf("read %q after reopen", got)
+	}
+}
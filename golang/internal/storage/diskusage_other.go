@@ -0,0 +1,11 @@
+//go:build !unix
+
+package storage
+
+import "errors"
+
+// diskUsage is not supported on this platform; JBOD placement falls back to
+// the first root.
+func diskUsage(path string) (total, free uint64, err error) {
+	return 0, 0, errors.New("disk usage not supported on this platform")
+}
@@ -0,0 +1,844 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/reedsolomon"
+
+	"github.com/bleepstore/bleepstore/internal/progress"
+)
+
+// Erasure shard file layout. Every disk holds one shard of each object at
+// <disk>/<bucket>/<key>: a header, then one record per stripe of a CRC-32C
+// followed by blockSize bytes of shard data. Fixed-size records let a read
+// seek to any stripe and tell a damaged block from a good one.
+const (
+	erasureMagic      = "BLEEPEC"
+	erasureVersion    = 1
+	erasureHeaderSize = 56
+	erasureCRCSize    = 4
+
+	// DefaultErasureBlockSize is the shard bytes per stripe.
+	DefaultErasureBlockSize = 64 * 1024
+)
+
+var erasureCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// errShardDamaged marks a shard block that is missing, short or fails
+	// its checksum.
+	errShardDamaged = errors.New("shard block damaged")
+	// errNotRewritten marks the shards a repair leaves in place.
+	errNotRewritten = errors.New("not rewritten")
+)
+
+// ErasureBackend stripes each object across several local disks with
+// Reed-Solomon parity: dataShards disks hold the data and parityShards disks
+// hold parity, so any parityShards disks can fail without losing an object.
+// Shard i of every object lives on disk i; keep the disks in config order.
+//
+// Writes need dataShards+1 disks so that a freshly written object still
+// survives one more failure. Reads reconstruct missing or corrupt blocks on
+// the fly. Rebuild rewrites the shards a replaced or damaged disk is missing.
+// Multipart parts are kept whole on one disk until the upload completes.
+type ErasureBackend struct {
+	disks        []*LocalBackend
+	dataShards   int
+	parityShards int
+	blockSize    int
+	enc          reedsolomon.Encoder
+
+	// locks serialize committing a write against repairing the same key.
+	locks [jbodLockStripes]sync.Mutex
+}
+
+// RebuildResult summarizes a rebuild run.
+type RebuildResult struct {
+	// Objects is the number of objects checked.
+	Objects int `json:"objects"`
+	// Repaired is the number of objects with at least one rewritten shard.
+	Repaired int `json:"repaired"`
+	// Shards is the number of shard files rewritten.
+	Shards int `json:"shards"`
+	// Unrecoverable lists objects with fewer intact shards than data shards.
+	Unrecoverable []string `json:"unrecoverable"`
+	// DryRun is true when damage was only reported.
+	DryRun bool `json:"dry_run"`
+}
+
+// Rebuilder is an optional interface for storage backends that keep
+// redundant copies or parity and can restore lost redundancy.
+type Rebuilder interface {
+	// Rebuild checks every object and rewrites its missing or damaged
+	// redundancy. With dryRun it only reports what it would rewrite.
+	Rebuild(ctx context.Context, dryRun bool) (*RebuildResult, error)
+}
+
+// NewErasureBackend creates an ErasureBackend over len(rootDirs) disks, of
+// which parityShards hold parity. blockSize 0 uses DefaultErasureBlockSize.
+func NewErasureBackend(rootDirs []string, parityShards, blockSize int) (*ErasureBackend, error) {
+	dataShards := len(rootDirs) - parityShards
+	if parityShards < 1 || dataShards < 1 {
+		return nil, fmt.Errorf("erasure backend needs at least one data and one parity disk, got %d disks with %d parity", len(rootDirs), parityShards)
+	}
+	if blockSize == 0 {
+		blockSize = DefaultErasureBlockSize
+	}
+	if blockSize < 0 {
+		return nil, fmt.Errorf("erasure block size must be positive, got %d", blockSize)
+	}
+	enc, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, fmt.Errorf("creating Reed-Solomon encoder: %w", err)
+	}
+	e := &ErasureBackend{dataShards: dataShards, parityShards: parityShards, blockSize: blockSize, enc: enc}
+	for _, dir := range rootDirs {
+		lb, err := NewLocalBackend(dir)
+		if err != nil {
+			return nil, err
+		}
+		e.disks = append(e.disks, lb)
+	}
+	return e, nil
+}
+
+// CleanTempFiles removes orphaned temp files from every disk. Called on
+// startup as part of crash-only recovery.
+func (e *ErasureBackend) CleanTempFiles() error {
+	for _, d := range e.disks {
+		if err := d.CleanTempFiles(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeQuorum is the number of shards a write must store.
+func (e *ErasureBackend) writeQuorum() int {
+	return min(len(e.disks), e.dataShards+1)
+}
+
+// stripeSize is the number of object bytes in one stripe.
+func (e *ErasureBackend) stripeSize() int {
+	return e.dataShards * e.blockSize
+}
+
+// shardHeader is the decoded header of a shard file.
+type shardHeader struct {
+	dataShards, parityShards, index int
+	blockSize                       int
+	size                            int64
+	// tag is the MD5 of the object; with written it identifies the
+	// version a shard belongs to.
+	tag     [md5.Size]byte
+	written int64
+}
+
+func (h *shardHeader) marshal() []byte {
+	b := make([]byte, erasureHeaderSize)
+	copy(b, erasureMagic)
+	b[7] = erasureVersion
+	b[8], b[9], b[10] = byte(h.dataShards), byte(h.parityShards), byte(h.index)
+	binary.BigEndian.PutUint32(b[12:], uint32(h.blockSize))
+	binary.BigEndian.PutUint64(b[16:], uint64(h.size))
+	copy(b[24:40], h.tag[:])
+	binary.BigEndian.PutUint64(b[40:], uint64(h.written))
+	binary.BigEndian.PutUint32(b[48:], crc32.Checksum(b[:48], erasureCRCTable))
+	return b
+}
+
+func parseShardHeader(b []byte) (*shardHeader, error) {
+	if len(b) < erasureHeaderSize || string(b[:7]) != erasureMagic || b[7] != erasureVersion {
+		return nil, fmt.Errorf("not an erasure shard")
+	}
+	if crc32.Checksum(b[:48], erasureCRCTable) != binary.BigEndian.Uint32(b[48:]) {
+		return nil, fmt.Errorf("shard header checksum mismatch")
+	}
+	h := &shardHeader{
+		dataShards:   int(b[8]),
+		parityShards: int(b[9]),
+		index:        int(b[10]),
+		blockSize:    int(binary.BigEndian.Uint32(b[12:])),
+		size:         int64(binary.BigEndian.Uint64(b[16:])),
+		written:      int64(binary.BigEndian.Uint64(b[40:])),
+	}
+	copy(h.tag[:], b[24:40])
+	return h, nil
+}
+
+// stripes returns the number of stripes in the object.
+func (h *shardHeader) stripes() int64 {
+	stripe := int64(h.dataShards * h.blockSize)
+	return (h.size + stripe - 1) / stripe
+}
+
+// sameVersion reports whether two shards belong to one write.
+func (h *shardHeader) sameVersion(o *shardHeader) bool {
+	return h.tag == o.tag && h.written == o.written && h.size == o.size &&
+		h.dataShards == o.dataShards && h.parityShards == o.parityShards && h.blockSize == o.blockSize
+}
+
+// shardSet is the open shards of one object version, indexed by shard.
+type shardSet struct {
+	hdr   *shardHeader
+	files []*os.File // nil where the shard is missing or from another version
+}
+
+func (s *shardSet) Close() error {
+	for _, f := range s.files {
+		if f != nil {
+			f.Close()
+		}
+	}
+	return nil
+}
+
+// openShards opens the newest version of bucket/key that has at least
+// dataShards shards. It returns nil if there is none. Shards of other
+// versions, left by a write that did not reach every disk, are ignored.
+func (e *ErasureBackend) openShards(bucket, key string) *shardSet {
+	type shard struct {
+		hdr *shardHeader
+		f   *os.File
+	}
+	shards := make([]shard, len(e.disks))
+	for i, d := range e.disks {
+		f, err := os.Open(d.objectPath(bucket, key))
+		if err != nil {
+			continue
+		}
+		buf := make([]byte, erasureHeaderSize)
+		if _, err := io.ReadFull(f, buf); err != nil {
+			f.Close()
+			continue
+		}
+		hdr, err := parseShardHeader(buf)
+		if err != nil || hdr.index != i || hdr.dataShards+hdr.parityShards != len(e.disks) {
+			f.Close()
+			continue
+		}
+		shards[i] = shard{hdr: hdr, f: f}
+	}
+
+	var best *shardHeader
+	for _, s := range shards {
+		if s.hdr == nil || (best != nil && s.hdr.written <= best.written) {
+			continue
+		}
+		n := 0
+		for _, o := range shards {
+			if o.hdr != nil && o.hdr.sameVersion(s.hdr) {
+				n++
+			}
+		}
+		if n >= s.hdr.dataShards {
+			best = s.hdr
+		}
+	}
+
+	set := &shardSet{hdr: best, files: make([]*os.File, len(e.disks))}
+	for i, s := range shards {
+		if s.f == nil {
+			continue
+		}
+		if best != nil && s.hdr.sameVersion(best) {
+			set.files[i] = s.f
+		} else {
+			s.f.Close()
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return set
+}
+
+// readBlock reads and checks one shard block into buf.
+func readBlock(f *os.File, hdr *shardHeader, stripe int64, buf []byte) error {
+	off := int64(erasureHeaderSize) + stripe*int64(erasureCRCSize+hdr.blockSize)
+	rec := make([]byte, erasureCRCSize+hdr.blockSize)
+	if _, err := f.ReadAt(rec, off); err != nil {
+		return errShardDamaged
+	}
+	if crc32.Checksum(rec[erasureCRCSize:], erasureCRCTable) != binary.BigEndian.Uint32(rec) {
+		return errShardDamaged
+	}
+	copy(buf, rec[erasureCRCSize:])
+	return nil
+}
+
+// readStripe reads one stripe into shards, reconstructing damaged blocks.
+// With all set, parity blocks are read and rebuilt too; otherwise parity is
+// read only as needed to rebuild data. It returns the indexes of damaged
+// blocks it saw.
+func (e *ErasureBackend) readStripe(set *shardSet, stripe int64, shards [][]byte, all bool) ([]int, error) {
+	var damaged []int
+	bs := set.hdr.blockSize
+	read := func(i int) {
+		shards[i] = shards[i][:bs]
+		if set.files[i] == nil || readBlock(set.files[i], set.hdr, stripe, shards[i]) != nil {
+			shards[i] = shards[i][:0]
+			damaged = append(damaged, i)
+		}
+	}
+	for i := 0; i < e.dataShards; i++ {
+		read(i)
+	}
+	if len(damaged) == 0 && !all {
+		return nil, nil
+	}
+	for i := e.dataShards; i < len(shards); i++ {
+		read(i)
+	}
+	if len(damaged) > e.parityShards {
+		return damaged, fmt.Errorf("stripe %d: %d of %d shards damaged", stripe, len(damaged), len(shards))
+	}
+	if len(damaged) == 0 {
+		return nil, nil
+	}
+	var err error
+	if all {
+		err = e.enc.Reconstruct(shards)
+	} else {
+		err = e.enc.ReconstructData(shards)
+	}
+	if err != nil {
+		return damaged, fmt.Errorf("stripe %d: reconstructing: %w", stripe, err)
+	}
+	return damaged, nil
+}
+
+// newShardBuffers allocates one block buffer per disk.
+func (e *ErasureBackend) newShardBuffers(blockSize int) [][]byte {
+	shards := make([][]byte, len(e.disks))
+	for i := range shards {
+		shards[i] = make([]byte, blockSize)
+	}
+	return shards
+}
+
+// shardWriter writes one shard file to a temp file on its disk.
+type shardWriter struct {
+	disk *LocalBackend
+	path string
+	f    *os.File
+	err  error
+}
+
+// createShardWriters opens a temp shard file on every disk, reserving the
+// header. A disk that fails keeps its error and is skipped from then on.
+func (e *ErasureBackend) createShardWriters(only map[int]bool) []*shardWriter {
+	ws := make([]*shardWriter, len(e.disks))
+	for i, d := range e.disks {
+		w := &shardWriter{disk: d, path: d.tempPath()}
+		ws[i] = w
+		if only != nil && !only[i] {
+			w.err = errNotRewritten
+			continue
+		}
+		w.f, w.err = os.Create(w.path)
+		if errors.Is(w.err, os.ErrNotExist) {
+			// A freshly replaced disk has no .tmp yet. Mkdir rather than
+			// MkdirAll, so an unmounted disk is not recreated on its parent.
+			if w.err = os.Mkdir(filepath.Dir(w.path), 0o755); w.err == nil {
+				w.f, w.err = os.Create(w.path)
+			}
+		}
+		if w.err == nil {
+			_, w.err = w.f.Write(make([]byte, erasureHeaderSize))
+		}
+	}
+	return ws
+}
+
+// writeBlock appends a checksummed block.
+func (w *shardWriter) writeBlock(block []byte) {
+	if w.err != nil {
+		return
+	}
+	rec := make([]byte, erasureCRCSize, erasureCRCSize+len(block))
+	binary.BigEndian.PutUint32(rec, crc32.Checksum(block, erasureCRCTable))
+	_, w.err = w.f.Write(append(rec, block...))
+}
+
+// finish writes the header, syncs and closes the temp file.
+func (w *shardWriter) finish(hdr []byte) {
+	if w.err == nil {
+		_, w.err = w.f.WriteAt(hdr, 0)
+	}
+	if w.err == nil {
+		w.err = w.f.Sync()
+	}
+	if w.f != nil {
+		if err := w.f.Close(); w.err == nil {
+			w.err = err
+		}
+	}
+}
+
+// abort removes the temp file.
+func (w *shardWriter) abort() {
+	if w.f != nil {
+		w.f.Close()
+		os.Remove(w.path)
+	}
+}
+
+// commitShards renames the finished temp files into place for bucket/key
+// if at least quorum of them succeeded; otherwise it removes them all.
+// Returns the number of shards committed.
+func (e *ErasureBackend) commitShards(bucket, key string, ws []*shardWriter, hdr *shardHeader, quorum int) (int, error) {
+	var errs []error
+	ok := 0
+	for i, w := range ws {
+		h := *hdr
+		h.index = i
+		w.finish(h.marshal())
+		if w.err == nil {
+			ok++
+		} else if w.err != errNotRewritten {
+			errs = append(errs, fmt.Errorf("disk %q: %w", w.disk.RootDir, w.err))
+		}
+	}
+	if ok < quorum {
+		for _, w := range ws {
+			w.abort()
+		}
+		return 0, fmt.Errorf("wrote %d of %d shards required: %w", ok, quorum, errors.Join(errs...))
+	}
+
+	committed := 0
+	for _, w := range ws {
+		if w.err != nil {
+			continue
+		}
+		objPath := w.disk.objectPath(bucket, key)
+		if err := os.MkdirAll(filepath.Dir(objPath), 0o755); err != nil {
+			w.abort()
+			errs = append(errs, fmt.Errorf("disk %q: %w", w.disk.RootDir, err))
+			continue
+		}
+		if err := os.Rename(w.path, objPath); err != nil {
+			os.Remove(w.path)
+			errs = append(errs, fmt.Errorf("disk %q: %w", w.disk.RootDir, err))
+			continue
+		}
+		committed++
+	}
+	if committed < quorum {
+		return committed, fmt.Errorf("committed %d of %d shards required: %w", committed, quorum, errors.Join(errs...))
+	}
+	if len(errs) > 0 {
+		slog.Warn("Erasure write missed disks", "bucket", bucket, "key", key, "error", errors.Join(errs...))
+	}
+	return committed, nil
+}
+
+// PutObject splits the object into stripes, encodes parity and writes one
+// shard per disk with the temp-fsync-rename pattern.
+func (e *ErasureBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	ws := e.createShardWriters(nil)
+	h := md5.New()
+	shards := e.newShardBuffers(e.blockSize)
+	stripe := make([]byte, e.stripeSize())
+	var total int64
+	for {
+		n, err := io.ReadFull(reader, stripe)
+		if n > 0 {
+			h.Write(stripe[:n])
+			total += int64(n)
+			clear(stripe[n:])
+			for i := 0; i < e.dataShards; i++ {
+				copy(shards[i], stripe[i*e.blockSize:(i+1)*e.blockSize])
+			}
+			if err := e.enc.Encode(shards); err != nil {
+				for _, w := range ws {
+					w.abort()
+				}
+				return 0, "", fmt.Errorf("encoding parity: %w", err)
+			}
+			for i, w := range ws {
+				w.writeBlock(shards[i])
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			for _, w := range ws {
+				w.abort()
+			}
+			return 0, "", fmt.Errorf("writing object data: %w", err)
+		}
+	}
+
+	hdr := &shardHeader{dataShards: e.dataShards, parityShards: e.parityShards, blockSize: e.blockSize,
+		size: total, written: time.Now().UnixNano()}
+	copy(hdr.tag[:], h.Sum(nil))
+	unlock := lockStripe(&e.locks, bucket, key)
+	defer unlock()
+	if _, err := e.commitShards(bucket, key, ws, hdr, e.writeQuorum()); err != nil {
+		return 0, "", err
+	}
+	return total, fmt.Sprintf(`"%x"`, hdr.tag), nil
+}
+
+// erasureReader streams an object stripe by stripe.
+type erasureReader struct {
+	e         *ErasureBackend
+	set       *shardSet
+	shards    [][]byte
+	stripe    int64
+	data      []byte // decoded stripe
+	buf       []byte // unread part of data
+	remaining int64
+}
+
+func (r *erasureReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		if _, err := r.e.readStripe(r.set, r.stripe, r.shards, false); err != nil {
+			return 0, err
+		}
+		r.buf = r.data[:0]
+		for i := 0; i < r.e.dataShards; i++ {
+			r.buf = append(r.buf, r.shards[i]...)
+		}
+		if int64(len(r.buf)) > r.remaining {
+			r.buf = r.buf[:r.remaining]
+		}
+		r.remaining -= int64(len(r.buf))
+		r.stripe++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *erasureReader) Close() error {
+	return r.set.Close()
+}
+
+// GetObject streams the object, reconstructing blocks from parity where a
+// disk is missing or a block fails its checksum.
+func (e *ErasureBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	set := e.openShards(bucket, key)
+	if set == nil {
+		return nil, 0, "", fmt.Errorf("object not found: %s/%s", bucket, key)
+	}
+	r := &erasureReader{
+		e:         e,
+		set:       set,
+		shards:    e.newShardBuffers(set.hdr.blockSize),
+		data:      make([]byte, 0, e.dataShards*set.hdr.blockSize),
+		remaining: set.hdr.size,
+	}
+	return r, set.hdr.size, fmt.Sprintf(`"%x"`, set.hdr.tag), nil
+}
+
+// DeleteObject removes the object's shards. Disks that cannot be reached
+// are tolerated up to the parity count; their stray shards are ignored by
+// reads once the other disks no longer hold the object.
+func (e *ErasureBackend) DeleteObject(ctx context.Context, bucket, key string) error {
+	unlock := lockStripe(&e.locks, bucket, key)
+	defer unlock()
+	var errs []error
+	for _, d := range e.disks {
+		if err := d.DeleteObject(ctx, bucket, key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > e.parityShards {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// CopyObject decodes the source and writes it as a new object.
+func (e *ErasureBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (string, error) {
+	rc, size, _, err := e.GetObject(ctx, srcBucket, srcKey)
+	if err != nil {
+		return "", fmt.Errorf("source object not found: %s/%s", srcBucket, srcKey)
+	}
+	defer rc.Close()
+	_, etag, err := e.PutObject(ctx, dstBucket, dstKey, rc, size)
+	if err != nil {
+		return "", fmt.Errorf("copying object data: %w", err)
+	}
+	return etag, nil
+}
+
+// partsDisk returns the disk holding the parts of uploadID, or nil.
+func (e *ErasureBackend) partsDisk(uploadID string) *LocalBackend {
+	for _, d := range e.disks {
+		if _, err := os.Stat(filepath.Join(d.RootDir, ".multipart", uploadID)); err == nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// PutPart stores the part whole on the disk already holding the upload's
+// parts, or on the first disk that accepts it.
+func (e *ErasureBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	if d := e.partsDisk(uploadID); d != nil {
+		return d.PutPart(ctx, bucket, key, uploadID, partNumber, reader, size)
+	}
+	var errs []error
+	for _, d := range e.disks {
+		partDir := filepath.Join(d.RootDir, ".multipart", uploadID)
+		if err := os.MkdirAll(partDir, 0o755); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return d.PutPart(ctx, bucket, key, uploadID, partNumber, reader, size)
+	}
+	return "", fmt.Errorf("no disk accepted the part: %w", errors.Join(errs...))
+}
+
+// AssembleParts erasure-codes the concatenated parts into the final object.
+// The ETag is the composite of the part MD5s, as on the local backend.
+func (e *ErasureBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	d := e.partsDisk(uploadID)
+	if d == nil {
+		return "", fmt.Errorf("no parts found for upload %s", uploadID)
+	}
+	partDir := filepath.Join(d.RootDir, ".multipart", uploadID)
+
+	var readers []io.Reader
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	composite := md5.New()
+	for _, pn := range partNumbers {
+		f, err := os.Open(filepath.Join(partDir, fmt.Sprintf("%d", pn)))
+		if err != nil {
+			return "", fmt.Errorf("opening part %d: %w", pn, err)
+		}
+		files = append(files, f)
+		ph := md5.New()
+		if _, err := io.Copy(ph, f); err != nil {
+			return "", fmt.Errorf("reading part %d: %w", pn, err)
+		}
+		composite.Write(ph.Sum(nil))
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", fmt.Errorf("reading part %d: %w", pn, err)
+		}
+		readers = append(readers, f)
+	}
+
+	if _, _, err := e.PutObject(ctx, bucket, key, io.MultiReader(readers...), -1); err != nil {
+		return "", err
+	}
+	os.RemoveAll(partDir)
+	return fmt.Sprintf(`"%x-%d"`, composite.Sum(nil), len(partNumbers)), nil
+}
+
+// DeleteParts removes the parts of the given upload from every disk.
+func (e *ErasureBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
+	for _, d := range e.disks {
+		if err := d.DeleteParts(ctx, bucket, key, uploadID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUploadParts removes the parts directory of an upload from every
+// disk. Used during startup reaping of expired uploads.
+func (e *ErasureBackend) DeleteUploadParts(uploadID string) error {
+	for _, d := range e.disks {
+		if err := d.DeleteUploadParts(uploadID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateBucket creates the bucket directory on every disk, tolerating as
+// many failed disks as there are parity shards.
+func (e *ErasureBackend) CreateBucket(ctx context.Context, bucket string) error {
+	var errs []error
+	for _, d := range e.disks {
+		if err := d.CreateBucket(ctx, bucket); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > e.parityShards {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// DeleteBucket removes the (empty) bucket directory from every disk.
+func (e *ErasureBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	var errs []error
+	for _, d := range e.disks {
+		if err := d.DeleteBucket(ctx, bucket); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > e.parityShards {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// ObjectExists reports whether enough shards of the object survive to read it.
+func (e *ErasureBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	set := e.openShards(bucket, key)
+	if set == nil {
+		return false, nil
+	}
+	set.Close()
+	return true, nil
+}
+
+// HealthCheck fails when fewer disks are accessible than a write needs.
+func (e *ErasureBackend) HealthCheck(ctx context.Context) error {
+	var errs []error
+	for _, d := range e.disks {
+		if err := d.HealthCheck(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("disk %q: %w", d.RootDir, err))
+		}
+	}
+	if healthy := len(e.disks) - len(errs); healthy < e.writeQuorum() {
+		return fmt.Errorf("%d of %d required disks healthy: %w", healthy, e.writeQuorum(), errors.Join(errs...))
+	}
+	return nil
+}
+
+// RepairObject checks every block of bucket/key and rewrites the shard files
+// that are missing, from an older version, or hold damaged blocks. It
+// returns the number of shards rewritten (or that would be, with dryRun).
+func (e *ErasureBackend) RepairObject(ctx context.Context, bucket, key string, dryRun bool) (int, error) {
+	unlock := lockStripe(&e.locks, bucket, key)
+	defer unlock()
+	set := e.openShards(bucket, key)
+	if set == nil {
+		return 0, fmt.Errorf("%s/%s: fewer than %d intact shards", bucket, key, e.dataShards)
+	}
+	defer set.Close()
+
+	bad := make(map[int]bool)
+	for i, f := range set.files {
+		if f == nil {
+			bad[i] = true
+		}
+	}
+	shards := e.newShardBuffers(set.hdr.blockSize)
+	for s := int64(0); s < set.hdr.stripes(); s++ {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		damaged, err := e.readStripe(set, s, shards, true)
+		if err != nil {
+			return 0, fmt.Errorf("%s/%s: %w", bucket, key, err)
+		}
+		for _, i := range damaged {
+			bad[i] = true
+		}
+	}
+	if len(bad) == 0 || dryRun {
+		return len(bad), nil
+	}
+
+	ws := e.createShardWriters(bad)
+	for s := int64(0); s < set.hdr.stripes(); s++ {
+		if _, err := e.readStripe(set, s, shards, true); err != nil {
+			for _, w := range ws {
+				w.abort()
+			}
+			return 0, fmt.Errorf("%s/%s: %w", bucket, key, err)
+		}
+		for i, w := range ws {
+			w.writeBlock(shards[i])
+		}
+	}
+	n, err := e.commitShards(bucket, key, ws, set.hdr, len(bad))
+	if err != nil {
+		return n, fmt.Errorf("%s/%s: %w", bucket, key, err)
+	}
+	return n, nil
+}
+
+// Rebuild walks every disk for objects and repairs each one. Run it after
+// replacing a failed disk, or periodically to catch silent corruption.
+func (e *ErasureBackend) Rebuild(ctx context.Context, dryRun bool) (*RebuildResult, error) {
+	objects := make(map[string]bool)
+	for _, d := range e.disks {
+		err := filepath.WalkDir(d.RootDir, func(path string, entry os.DirEntry, err error) error {
+			if err != nil {
+				// An unreadable or missing disk is what a rebuild repairs.
+				return nil
+			}
+			rel, relErr := filepath.Rel(d.RootDir, path)
+			if relErr != nil || rel == "." {
+				return nil
+			}
+			if entry.IsDir() {
+				if strings.HasPrefix(rel, ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.Contains(filepath.ToSlash(rel), "/") {
+				objects[filepath.ToSlash(rel)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scanning disk %q: %w", d.RootDir, err)
+		}
+	}
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &RebuildResult{DryRun: dryRun, Unrecoverable: []string{}}
+	for i, name := range names {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		progress.Report(ctx, int64(i), int64(len(names)))
+		bucket, key, _ := strings.Cut(name, "/")
+		result.Objects++
+		n, err := e.RepairObject(ctx, bucket, key, dryRun)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			slog.Warn("Erasure rebuild failed", "bucket", bucket, "key", key, "error", err)
+			result.Unrecoverable = append(result.Unrecoverable, name)
+			continue
+		}
+		if n > 0 {
+			result.Repaired++
+			result.Shards += n
+		}
+	}
+	return result, nil
+}
+
+var _ StorageBackend = (*ErasureBackend)(nil)
+var _ Rebuilder = (*ErasureBackend)(nil)
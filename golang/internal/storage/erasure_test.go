@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestErasure builds an erasure backend over n temp disks with a small
+// block size, so short test objects span several stripes.
+func newTestErasure(t *testing.T, n, parity int) (*ErasureBackend, []string) {
+	t.Helper()
+	base := t.TempDir()
+	var disks []string
+	for i := 0; i < n; i++ {
+		disks = append(disks, filepath.Join(base, fmt.Sprintf("disk%d", i)))
+	}
+	e, err := NewErasureBackend(disks, parity, 64)
+	if err != nil {
+		t.Fatalf("NewErasureBackend: %v", err)
+	}
+	if err := e.CreateBucket(context.Background(), "b"); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	return e, disks
+}
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+func readErasure(t *testing.T, e *ErasureBackend, key string) []byte {
+	t.Helper()
+	rc, _, _, err := e.GetObject(context.Background(), "b", key)
+	if err != nil {
+		t.Fatalf("GetObject %s: %v", key, err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return got
+}
+
+func TestErasureRoundTrip(t *testing.T) {
+	e, _ := newTestErasure(t, 5, 2)
+	ctx := context.Background()
+	// Stripes are 3 data shards * 64 bytes = 192 bytes.
+	for _, size := range []int{0, 1, 191, 192, 193, 1000, 4096} {
+		data := randomBytes(size)
+		key := fmt.Sprintf("obj-%d", size)
+		n, etag, err := e.PutObject(ctx, "b", key, bytes.NewReader(data), int64(size))
+		if err != nil {
+			t.Fatalf("PutObject %d: %v", size, err)
+		}
+		if n != int64(size) {
+			t.Errorf("size %d: wrote %d bytes", size, n)
+		}
+		if want := fmt.Sprintf(`"%x"`, md5.Sum(data)); etag != want {
+			t.Errorf("size %d: etag %s, want %s", size, etag, want)
+		}
+		rc, gotSize, _, err := e.GetObject(ctx, "b", key)
+		if err != nil {
+			t.Fatalf("GetObject %d: %v", size, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if gotSize != int64(size) || !bytes.Equal(got, data) {
+			t.Errorf("size %d: read back %d bytes (reported %d)", size, len(got), gotSize)
+		}
+	}
+}
+
+func TestErasureSurvivesParityDiskLosses(t *testing.T) {
+	e, disks := newTestErasure(t, 5, 2)
+	data := randomBytes(2000)
+	if _, _, err := e.PutObject(context.Background(), "b", "k", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	os.RemoveAll(disks[0])
+	os.RemoveAll(disks[3])
+	if got := readErasure(t, e, "k"); !bytes.Equal(got, data) {
+		t.Fatal("object changed after losing two disks")
+	}
+
+	os.RemoveAll(disks[1])
+	if _, _, _, err := e.GetObject(context.Background(), "b", "k"); err == nil {
+		t.Fatal("GetObject succeeded with three of five disks lost")
+	}
+}
+
+func TestErasureDetectsCorruptBlock(t *testing.T) {
+	e, disks := newTestErasure(t, 4, 1)
+	data := randomBytes(1000)
+	if _, _, err := e.PutObject(context.Background(), "b", "k", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	// Flip a byte in the second stripe of the first data shard.
+	path := filepath.Join(disks[0], "b", "k")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading shard: %v", err)
+	}
+	raw[erasureHeaderSize+(erasureCRCSize+64)+erasureCRCSize+10] ^= 0xff
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatalf("writing shard: %v", err)
+	}
+
+	if got := readErasure(t, e, "k"); !bytes.Equal(got, data) {
+		t.Fatal("corrupt block was returned instead of reconstructed")
+	}
+	n, err := e.RepairObject(context.Background(), "b", "k", false)
+	if err != nil || n != 1 {
+		t.Fatalf("RepairObject = %d, %v; want 1 shard", n, err)
+	}
+	if n, err := e.RepairObject(context.Background(), "b", "k", true); err != nil || n != 0 {
+		t.Fatalf("RepairObject after repair = %d, %v; want 0", n, err)
+	}
+}
+
+func TestErasureRebuildReplacedDisk(t *testing.T) {
+	e, disks := newTestErasure(t, 4, 2)
+	ctx := context.Background()
+	objects := make(map[string][]byte)
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("dir/obj-%d", i)
+		objects[key] = randomBytes(100 + 300*i)
+		if _, _, err := e.PutObject(ctx, "b", key, bytes.NewReader(objects[key]), -1); err != nil {
+			t.Fatalf("PutObject: %v", err)
+		}
+	}
+	// Replace disk 1 with an empty one.
+	os.RemoveAll(disks[1])
+	os.MkdirAll(disks[1], 0o755)
+
+	dry, err := e.Rebuild(ctx, true)
+	if err != nil {
+		t.Fatalf("Rebuild dry run: %v", err)
+	}
+	if !dry.DryRun || dry.Objects != 5 || dry.Repaired != 5 || dry.Shards != 5 {
+		t.Fatalf("dry run = %+v, want 5 objects each missing one shard", dry)
+	}
+	if _, err := os.Stat(filepath.Join(disks[1], "b", "dir", "obj-0")); !os.IsNotExist(err) {
+		t.Fatal("dry run wrote a shard")
+	}
+
+	result, err := e.Rebuild(ctx, false)
+	if err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if result.Repaired != 5 || result.Shards != 5 || len(result.Unrecoverable) != 0 {
+		t.Fatalf("rebuild = %+v", result)
+	}
+
+	// With disk 1 restored, losing two other disks is survivable again.
+	os.RemoveAll(disks[0])
+	os.RemoveAll(disks[3])
+	for key, data := range objects {
+		if got := readErasure(t, e, key); !bytes.Equal(got, data) {
+			t.Errorf("%s changed after rebuild", key)
+		}
+	}
+}
+
+func TestErasureRebuildReportsUnrecoverable(t *testing.T) {
+	e, disks := newTestErasure(t, 3, 1)
+	if _, _, err := e.PutObject(context.Background(), "b", "k", strings.NewReader("hello world"), -1); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	os.Remove(filepath.Join(disks[0], "b", "k"))
+	os.Remove(filepath.Join(disks[1], "b", "k"))
+
+	result, err := e.Rebuild(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if len(result.Unrecoverable) != 1 || result.Unrecoverable[0] != "b/k" {
+		t.Fatalf("Unrecoverable = %v, want [b/k]", result.Unrecoverable)
+	}
+}
+
+func TestErasureWriteQuorum(t *testing.T) {
+	e, disks := newTestErasure(t, 4, 2)
+	ctx := context.Background()
+	// Three of four disks meet the write quorum of data shards + 1.
+	os.RemoveAll(disks[2])
+	if _, _, err := e.PutObject(ctx, "b", "k", strings.NewReader("data"), 4); err != nil {
+		t.Fatalf("PutObject with one disk down: %v", err)
+	}
+	if err := e.HealthCheck(ctx); err != nil {
+		t.Fatalf("HealthCheck with one disk down: %v", err)
+	}
+
+	os.RemoveAll(disks[3])
+	if _, _, err := e.PutObject(ctx, "b", "k2", strings.NewReader("data"), 4); err == nil {
+		t.Fatal("PutObject succeeded below write quorum")
+	}
+	if exists, _ := e.ObjectExists(ctx, "b", "k2"); exists {
+		t.Fatal("failed write left a readable object")
+	}
+	if err := e.HealthCheck(ctx); err == nil {
+		t.Fatal("HealthCheck passed below write quorum")
+	}
+	if _, err := os.Stat(disks[3]); !os.IsNotExist(err) {
+		t.Fatal("write recreated a missing disk root")
+	}
+}
+
+func TestErasureOverwriteIgnoresStaleShards(t *testing.T) {
+	e, disks := newTestErasure(t, 3, 1)
+	ctx := context.Background()
+	if _, _, err := e.PutObject(ctx, "b", "k", strings.NewReader("old contents"), -1); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	// Keep disk 0's old shard in place while the overwrite lands on the rest.
+	stale, _ := os.ReadFile(filepath.Join(disks[0], "b", "k"))
+	if _, _, err := e.PutObject(ctx, "b", "k", strings.NewReader("new contents!"), -1); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	os.WriteFile(filepath.Join(disks[0], "b", "k"), stale, 0o644)
+
+	if got := readErasure(t, e, "k"); string(got) != "new contents!" {
+		t.Fatalf("read %q, want the overwrite", got)
+	}
+	if n, err := e.RepairObject(ctx, "b", "k", false); err != nil || n != 1 {
+		t.Fatalf("RepairObject = %d, %v; want the stale shard rewritten", n, err)
+	}
+}
+
+func TestErasureMultipart(t *testing.T) {
+	e, _ := newTestErasure(t, 4, 1)
+	ctx := context.Background()
+	parts := [][]byte{randomBytes(500), randomBytes(300)}
+	composite := md5.New()
+	for i, p := range parts {
+		etag, err := e.PutPart(ctx, "b", "k", "up1", i+1, bytes.NewReader(p), int64(len(p)))
+		if err != nil {
+			t.Fatalf("PutPart: %v", err)
+		}
+		if want := fmt.Sprintf(`"%x"`, md5.Sum(p)); etag != want {
+			t.Errorf("part %d etag %s, want %s", i+1, etag, want)
+		}
+		sum := md5.Sum(p)
+		composite.Write(sum[:])
+	}
+	etag, err := e.AssembleParts(ctx, "b", "k", "up1", []int{1, 2})
+	if err != nil {
+		t.Fatalf("AssembleParts: %v", err)
+	}
+	if want := fmt.Sprintf(`"%x-2"`, composite.Sum(nil)); etag != want {
+		t.Errorf("etag %s, want %s", etag, want)
+	}
+	if got := readErasure(t, e, "k"); !bytes.Equal(got, append(parts[0], parts[1]...)) {
+		t.Fatal("assembled object differs from the parts")
+	}
+}
+
+func TestNewErasureBackendValidation(t *testing.T) {
+	base := t.TempDir()
+	disks := []string{filepath.Join(base, "a"), filepath.Join(base, "b"), filepath.Join(base, "c")}
+	for _, tc := range []struct {
+		name      string
+		disks     []string
+		parity    int
+		blockSize int
+	}{
+		{"no parity", disks, 0, 0},
+		{"all parity", disks, 3, 0},
+		{"single disk", disks[:1], 1, 0},
+		{"negative block size", disks, 1, -1},
+	} {
+		if _, err := NewErasureBackend(tc.disks, tc.parity, tc.blockSize); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
@@ -60,6 +60,9 @@ type GCSWriter interface {
 type GCSAttrs struct {
 	Size int64
 	MD5  []byte // raw MD5 hash bytes
+	// ComponentCount is the number of source objects of a composite object
+	// (0 for objects written directly).
+	ComponentCount int64
 }
 
 // realGCSClient wraps the official GCS client to satisfy GCSAPI.
@@ -85,8 +88,9 @@ func (c *realGCSClient) Attrs(ctx context.Context, bucket, object string) (*GCSA
 		return nil, err
 	}
 	return &GCSAttrs{
-		Size: attrs.Size,
-		MD5:  attrs.MD5,
+		Size:           attrs.Size,
+		MD5:            attrs.MD5,
+		ComponentCount: attrs.ComponentCount,
 	}, nil
 }
 
@@ -98,8 +102,9 @@ func (c *realGCSClient) Copy(ctx context.Context, bucket, srcObject, dstObject s
 		return nil, err
 	}
 	return &GCSAttrs{
-		Size: attrs.Size,
-		MD5:  attrs.MD5,
+		Size:           attrs.Size,
+		MD5:            attrs.MD5,
+		ComponentCount: attrs.ComponentCount,
 	}, nil
 }
 
@@ -114,8 +119,9 @@ func (c *realGCSClient) Compose(ctx context.Context, bucket, dstObject string, s
 		return nil, err
 	}
 	return &GCSAttrs{
-		Size: attrs.Size,
-		MD5:  attrs.MD5,
+		Size:           attrs.Size,
+		MD5:            attrs.MD5,
+		ComponentCount: attrs.ComponentCount,
 	}, nil
 }
 
@@ -205,24 +211,22 @@ func (b *GCPGatewayBackend) partKey(uploadID string, partNumber int) string {
 	return fmt.Sprintf("%s.parts/%s/%d", b.Prefix, uploadID, partNumber)
 }
 
-// PutObject uploads object data to the upstream GCS bucket. It reads all data,
-// computes MD5 locally for a consistent ETag, then uploads to GCS.
+// PutObject streams object data to the upstream GCS bucket, computing MD5
+// locally for a consistent ETag.
 func (b *GCPGatewayBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
 	gcsName := b.gcsKey(bucket, key)
 
-	// Read all data to compute MD5 locally. GCS may return different ETags
-	// or no MD5 for composite objects, so we compute our own.
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return 0, "", fmt.Errorf("reading object data: %w", err)
-	}
-
+	// GCS may return different ETags or no MD5 for composite objects, so we
+	// compute our own as the data streams through.
+	// Canceling the writer's context abandons the upload, so a body that
+	// fails partway never replaces the object.
 	h := md5.New()
-	h.Write(data)
-	etag := fmt.Sprintf(`"%x"`, h.Sum(nil))
-
-	w := b.client.NewWriter(ctx, b.Bucket, gcsName)
-	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := b.client.NewWriter(wctx, b.Bucket, gcsName)
+	written, err := io.Copy(w, io.TeeReader(reader, h))
+	if err != nil {
+		cancel()
 		_ = w.Close()
 		return 0, "", fmt.Errorf("uploading to GCS: %w", err)
 	}
@@ -230,7 +234,7 @@ func (b *GCPGatewayBackend) PutObject(ctx context.Context, bucket, key string, r
 		return 0, "", fmt.Errorf("finalizing GCS upload: %w", err)
 	}
 
-	return int64(len(data)), etag, nil
+	return written, fmt.Sprintf(`"%x"`, h.Sum(nil)), nil
 }
 
 // GetObject retrieves object data from the upstream GCS bucket.
@@ -426,6 +430,60 @@ func (b *GCPGatewayBackend) chainCompose(ctx context.Context, sourceNames []stri
 	return allIntermediates, nil
 }
 
+// DefragmentObject rewrites a composite object (the result of Compose during
+// AssembleParts) as a regular single-component object. Composite objects have
+// no MD5 and read more slowly. The rewrite goes through a temporary object and
+// is only swapped in if the original is still the same composite object, so a
+// concurrent overwrite is not clobbered. Returns false if nothing was done.
+func (b *GCPGatewayBackend) DefragmentObject(ctx context.Context, bucket, key string) (bool, error) {
+	gcsName := b.gcsKey(bucket, key)
+
+	before, err := b.client.Attrs(ctx, b.Bucket, gcsName)
+	if err != nil {
+		if isGCSNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("reading attrs of %s/%s: %w", bucket, key, err)
+	}
+	if before.ComponentCount == 0 {
+		return false, nil
+	}
+
+	tmpName := gcsName + ".__defrag_tmp"
+	reader, err := b.client.NewReader(ctx, b.Bucket, gcsName)
+	if err != nil {
+		return false, fmt.Errorf("reading %s/%s for defrag: %w", bucket, key, err)
+	}
+	w := b.client.NewWriter(ctx, b.Bucket, tmpName)
+	_, copyErr := io.Copy(w, reader)
+	reader.Close()
+	if copyErr != nil {
+		_ = w.Close()
+		_ = b.client.Delete(ctx, b.Bucket, tmpName)
+		return false, fmt.Errorf("rewriting %s/%s: %w", bucket, key, copyErr)
+	}
+	if err := w.Close(); err != nil {
+		_ = b.client.Delete(ctx, b.Bucket, tmpName)
+		return false, fmt.Errorf("finalizing rewrite of %s/%s: %w", bucket, key, err)
+	}
+	defer func() {
+		if delErr := b.client.Delete(ctx, b.Bucket, tmpName); delErr != nil {
+			slog.Warn("Failed to clean up defrag temp object", "name", tmpName, "error", delErr)
+		}
+	}()
+
+	// Skip the swap if the object changed while we were copying it.
+	after, err := b.client.Attrs(ctx, b.Bucket, gcsName)
+	if err != nil || after.ComponentCount != before.ComponentCount || after.Size != before.Size {
+		return false, nil
+	}
+
+	if _, err := b.client.Copy(ctx, b.Bucket, tmpName, gcsName); err != nil {
+		return false, fmt.Errorf("replacing %s/%s with defragmented copy: %w", bucket, key, err)
+	}
+	return true, nil
+}
+
 // DeleteParts removes all temporary part objects for a multipart upload.
 // Lists objects under .parts/{upload_id}/ and deletes each one.
 func (b *GCPGatewayBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // mockGCSClient implements GCSAPI for unit testing.
@@ -25,16 +27,20 @@ type mockGCSClient struct {
 	composeCalls int
 	// attrsCalls tracks the number of attrs calls.
 	attrsCalls int
+	// components records the component count of composed objects.
+	components map[string]int64
 }
 
 func newMockGCSClient() *mockGCSClient {
 	return &mockGCSClient{
-		objects: make(map[string][]byte),
+		objects:    make(map[string][]byte),
+		components: make(map[string]int64),
 	}
 }
 
 // mockGCSWriter implements GCSWriter for testing.
 type mockGCSWriter struct {
+	ctx    context.Context
 	buf    *bytes.Buffer
 	client *mockGCSClient
 	key    string
@@ -45,13 +51,19 @@ func (w *mockGCSWriter) Write(p []byte) (n int, err error) {
 }
 
 func (w *mockGCSWriter) Close() error {
+	// Like the real writer, a canceled context abandons the upload.
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
 	w.client.objects[w.key] = w.buf.Bytes()
+	delete(w.client.components, w.key)
 	w.client.putCalls++
 	return nil
 }
 
 func (m *mockGCSClient) NewWriter(ctx context.Context, bucket, object string) GCSWriter {
 	return &mockGCSWriter{
+		ctx:    ctx,
 		buf:    &bytes.Buffer{},
 		client: m,
 		key:    object,
@@ -82,6 +94,9 @@ func (m *mockGCSClient) Attrs(ctx context.Context, bucket, object string) (*GCSA
 	if !ok {
 		return nil, fmt.Errorf("storage: object doesn't exist: not found")
 	}
+	if n := m.components[object]; n > 0 {
+		return &GCSAttrs{Size: int64(len(data)), ComponentCount: n}, nil
+	}
 	h := md5.Sum(data)
 	return &GCSAttrs{
 		Size: int64(len(data)),
@@ -98,6 +113,11 @@ func (m *mockGCSClient) Copy(ctx context.Context, bucket, srcObject, dstObject s
 	copied := make([]byte, len(data))
 	copy(copied, data)
 	m.objects[dstObject] = copied
+	if n := m.components[srcObject]; n > 0 {
+		m.components[dstObject] = n
+	} else {
+		delete(m.components, dstObject)
+	}
 
 	h := md5.Sum(copied)
 	return &GCSAttrs{
@@ -118,6 +138,7 @@ func (m *mockGCSClient) Compose(ctx context.Context, bucket, dstObject string, s
 	}
 	result := assembled.Bytes()
 	m.objects[dstObject] = result
+	m.components[dstObject] = int64(len(srcObjects))
 
 	h := md5.Sum(result)
 	return &GCSAttrs{
@@ -212,6 +233,22 @@ func TestGCPPutObjectEmptyBody(t *testing.T) {
 	}
 }
 
+func TestGCPPutObjectFailingBody(t *testing.T) {
+	backend, mock := newTestGCPBackend(t)
+	ctx := context.Background()
+
+	if _, _, err := backend.PutObject(ctx, "my-bucket", "obj.txt", strings.NewReader("original"), 8); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	broken := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))
+	if _, _, err := backend.PutObject(ctx, "my-bucket", "obj.txt", broken, -1); err == nil {
+		t.Fatal("PutObject of a failing body succeeded")
+	}
+	if got := string(mock.objects["bp/my-bucket/obj.txt"]); got != "original" {
+		t.Errorf("upstream object after failed PutObject = %q, want %q", got, "original")
+	}
+}
+
 func TestGCPGetObjectNotFound(t *testing.T) {
 	backend, _ := newTestGCPBackend(t)
 	ctx := context.Background()
@@ -490,6 +527,47 @@ func TestGCPAssemblePartsSingleCompose(t *testing.T) {
 	}
 }
 
+func TestGCPDefragmentObject(t *testing.T) {
+	backend, mock := newTestGCPBackend(t)
+	ctx := context.Background()
+
+	for i, part := range []string{"hello ", "world"} {
+		if _, err := backend.PutPart(ctx, "my-bucket", "frag.txt", "upload-defrag", i+1, strings.NewReader(part), int64(len(part))); err != nil {
+			t.Fatalf("PutPart %d failed: %v", i+1, err)
+		}
+	}
+	if _, err := backend.AssembleParts(ctx, "my-bucket", "frag.txt", "upload-defrag", []int{1, 2}); err != nil {
+		t.Fatalf("AssembleParts failed: %v", err)
+	}
+	finalKey := "bp/my-bucket/frag.txt"
+	if mock.components[finalKey] == 0 {
+		t.Fatal("assembled object should be composite")
+	}
+
+	done, err := backend.DefragmentObject(ctx, "my-bucket", "frag.txt")
+	if err != nil {
+		t.Fatalf("DefragmentObject failed: %v", err)
+	}
+	if !done {
+		t.Error("DefragmentObject should rewrite a composite object")
+	}
+	if mock.components[finalKey] != 0 {
+		t.Error("object should no longer be composite")
+	}
+	if got := string(mock.objects[finalKey]); got != "hello world" {
+		t.Errorf("content = %q, want %q", got, "hello world")
+	}
+	if _, ok := mock.objects[finalKey+".__defrag_tmp"]; ok {
+		t.Error("temp object not cleaned up")
+	}
+
+	// A second pass is a no-op.
+	done, err = backend.DefragmentObject(ctx, "my-bucket", "frag.txt")
+	if err != nil || done {
+		t.Errorf("second DefragmentObject = %v, %v; want false, nil", done, err)
+	}
+}
+
 func TestGCPAssemblePartsChainCompose(t *testing.T) {
 	backend, mock := newTestGCPBackend(t)
 	ctx := context.Background()
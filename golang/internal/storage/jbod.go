@@ -0,0 +1,645 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/bleepstore/bleepstore/internal/progress"
+)
+
+const (
+	// jbodLockStripes is the number of mutexes used to serialize writers and
+	// the rebalancer on the same object key.
+	jbodLockStripes = 256
+
+	// jbodUsageTTL is how long sampled free space is reused for placement.
+	jbodUsageTTL = time.Second
+)
+
+// jbodPlacementBucket is the bbolt bucket mapping bucket\x00key to the data
+// root holding the object.
+var jbodPlacementBucket = []byte("placement")
+
+// JBODBackend spreads objects across several local data roots ("just a bunch
+// of disks"). Each object lives on exactly one root. New objects are placed
+// by free-space-weighted rendezvous hashing: every root scores each key, with
+// roots weighted by their free space, so a disk with twice the free space
+// receives about twice the new objects, and the choice is stable while free
+// space is. Overwrites stay on the root that already holds the key so there
+// is never more than one live copy.
+//
+// With a placement index, the root of each object is recorded in a bbolt
+// file, so reads open the right root directly instead of probing every one.
+// The index is advisory: a missing or stale entry falls back to probing and
+// is corrected, so objects written before the index existed, or an index
+// lost with its disk, cost only the slower lookup.
+//
+// Rebalance moves objects between roots while the server is running. Moves
+// use the same temp-fsync-rename pattern as writes and hold the per-key
+// lock, so concurrent PUTs and DELETEs are never lost. A crash mid-move can
+// leave two identical copies, which is harmless: reads use whichever is found
+// first and the next rebalance or delete removes the extra.
+type JBODBackend struct {
+	roots  []*LocalBackend
+	byPath map[string]*LocalBackend
+	locks  [jbodLockStripes]sync.Mutex
+
+	// index records the root of each object, or is nil.
+	index *bolt.DB
+
+	// diskUsage reports a root's capacity; tests replace it.
+	diskUsage func(path string) (total, free uint64, err error)
+
+	// usageMu guards the free space sampled for placement.
+	usageMu   sync.Mutex
+	free      []uint64
+	freeAt    time.Time
+	freeKnown bool
+
+	// rebalanceMu ensures only one rebalance runs at a time.
+	rebalanceMu sync.Mutex
+}
+
+// JBODOptions configures a JBODBackend.
+type JBODOptions struct {
+	// IndexPath is the bbolt file recording which root holds each object.
+	// Empty disables the index; objects are then found by probing roots.
+	// Only one process may open an index at a time.
+	IndexPath string
+}
+
+// RebalanceResult summarizes a completed rebalance run.
+type RebalanceResult struct {
+	// ObjectsMoved is the number of objects migrated between roots.
+	ObjectsMoved int `json:"objects_moved"`
+	// BytesMoved is the total size of the migrated objects.
+	BytesMoved int64 `json:"bytes_moved"`
+	// Roots reports the per-root utilization after the run.
+	Roots []RootUsage `json:"roots"`
+}
+
+// RootUsage describes the capacity of one data root.
+type RootUsage struct {
+	Path       string `json:"path"`
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+}
+
+// Rebalancer is an optional interface for storage backends that can migrate
+// data between underlying devices while online.
+type Rebalancer interface {
+	// Rebalance moves objects from the fullest to the emptiest roots until
+	// their utilization differs by at most threshold (a fraction, e.g. 0.05).
+	Rebalance(ctx context.Context, threshold float64) (*RebalanceResult, error)
+}
+
+// NewJBODBackend creates a JBODBackend over the given root directories,
+// creating each one if needed.
+func NewJBODBackend(rootDirs []string, opts JBODOptions) (*JBODBackend, error) {
+	if len(rootDirs) == 0 {
+		return nil, fmt.Errorf("JBOD backend requires at least one root directory")
+	}
+	j := &JBODBackend{byPath: make(map[string]*LocalBackend), diskUsage: diskUsage}
+	for _, dir := range rootDirs {
+		lb, err := NewLocalBackend(dir)
+		if err != nil {
+			return nil, err
+		}
+		j.roots = append(j.roots, lb)
+		j.byPath[lb.RootDir] = lb
+	}
+
+	if opts.IndexPath != "" {
+		if err := os.MkdirAll(filepath.Dir(opts.IndexPath), 0o755); err != nil {
+			return nil, fmt.Errorf("creating placement index directory: %w", err)
+		}
+		db, err := bolt.Open(opts.IndexPath, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+		if err != nil {
+			return nil, fmt.Errorf("opening placement index: %w", err)
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(jbodPlacementBucket)
+			return err
+		})
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("initializing placement index: %w", err)
+		}
+		j.index = db
+	}
+	return j, nil
+}
+
+// Close closes the placement index, if any.
+func (j *JBODBackend) Close() error {
+	if j.index == nil {
+		return nil
+	}
+	return j.index.Close()
+}
+
+// CleanTempFiles removes orphaned temp files from every root. Called on
+// startup as part of crash-only recovery.
+func (j *JBODBackend) CleanTempFiles() error {
+	for _, r := range j.roots {
+		if err := r.CleanTempFiles(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockKey locks the stripe for bucket/key and returns the unlock function.
+func (j *JBODBackend) lockKey(bucket, key string) func() {
+	return lockStripe(&j.locks, bucket, key)
+}
+
+// lockStripe locks the mutex in locks that bucket/key hashes to and returns
+// the unlock function.
+func lockStripe(locks *[jbodLockStripes]sync.Mutex, bucket, key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(bucket))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	mu := &locks[h.Sum32()%jbodLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// holds reports whether root r has a file for bucket/key.
+func holds(r *LocalBackend, bucket, key string) bool {
+	info, err := os.Stat(r.objectPath(bucket, key))
+	return err == nil && !info.IsDir()
+}
+
+// locate returns the root that holds bucket/key, or nil if none does. It
+// tries the root recorded in the placement index first, then probes every
+// root and corrects the index to match.
+func (j *JBODBackend) locate(bucket, key string) *LocalBackend {
+	indexed := j.indexed(bucket, key)
+	if indexed != nil && holds(indexed, bucket, key) {
+		return indexed
+	}
+	for _, r := range j.roots {
+		if r != indexed && holds(r, bucket, key) {
+			j.record(bucket, key, r)
+			return r
+		}
+	}
+	if indexed != nil {
+		j.forget(bucket, key)
+	}
+	return nil
+}
+
+// indexed returns the root the placement index records for bucket/key, or
+// nil if there is no index, no entry, or the entry names an unknown root.
+func (j *JBODBackend) indexed(bucket, key string) *LocalBackend {
+	if j.index == nil {
+		return nil
+	}
+	var r *LocalBackend
+	j.index.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(jbodPlacementBucket).Get(packKey(bucket, key)); v != nil {
+			r = j.byPath[string(v)]
+		}
+		return nil
+	})
+	return r
+}
+
+// record notes in the placement index that root r holds bucket/key.
+func (j *JBODBackend) record(bucket, key string, r *LocalBackend) {
+	if j.index == nil {
+		return
+	}
+	err := j.index.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(jbodPlacementBucket).Put(packKey(bucket, key), []byte(r.RootDir))
+	})
+	if err != nil {
+		// The index is advisory; the next read probes the roots instead.
+		slog.Warn("Updating JBOD placement index failed", "bucket", bucket, "key", key, "error", err)
+	}
+}
+
+// forget removes bucket/key from the placement index.
+func (j *JBODBackend) forget(bucket, key string) {
+	if j.index == nil {
+		return
+	}
+	err := j.index.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(jbodPlacementBucket).Delete(packKey(bucket, key))
+	})
+	if err != nil {
+		slog.Warn("Updating JBOD placement index failed", "bucket", bucket, "key", key, "error", err)
+	}
+}
+
+// locateParts returns the root holding the parts of uploadID, or nil.
+func (j *JBODBackend) locateParts(uploadID string) *LocalBackend {
+	for _, r := range j.roots {
+		if _, err := os.Stat(filepath.Join(r.RootDir, ".multipart", uploadID)); err == nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// freeSpace returns the free bytes of each root, sampled at most once per
+// jbodUsageTTL. known is false if no root reported its free space.
+func (j *JBODBackend) freeSpace() (free []uint64, known bool) {
+	j.usageMu.Lock()
+	defer j.usageMu.Unlock()
+	if j.free == nil || time.Since(j.freeAt) >= jbodUsageTTL {
+		j.free = make([]uint64, len(j.roots))
+		j.freeKnown = false
+		for i, r := range j.roots {
+			if _, f, err := j.diskUsage(r.RootDir); err == nil {
+				j.free[i] = f
+				j.freeKnown = true
+			}
+		}
+		j.freeAt = time.Now()
+	}
+	return j.free, j.freeKnown
+}
+
+// placement picks the root for a new bucket/key of the given size (-1 if
+// unknown) by free-space-weighted rendezvous hashing. Roots without room
+// for the object are skipped; if no root reports enough free space, or free
+// space cannot be determined, every root is weighted equally.
+func (j *JBODBackend) placement(bucket, key string, size int64) *LocalBackend {
+	free, known := j.freeSpace()
+	weights := make([]float64, len(j.roots))
+	fits := false
+	for i, f := range free {
+		if known && f > uint64(max(size, 0)) {
+			weights[i] = float64(f - uint64(max(size, 0)))
+			fits = true
+		}
+	}
+	if !fits {
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	best, bestScore := j.roots[0], -1.0
+	for i, r := range j.roots {
+		if weights[i] == 0 {
+			continue
+		}
+		// A uniform draw in (0, 1); -w/ln(u) picks root i with probability
+		// proportional to its weight.
+		u := (float64(rendezvousScore(r.RootDir, bucket, key)>>11) + 0.5) / (1 << 53)
+		if score := -weights[i] / math.Log(u); score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	return best
+}
+
+// targetFor returns the root that should receive a write to bucket/key.
+func (j *JBODBackend) targetFor(bucket, key string, size int64) *LocalBackend {
+	if r := j.locate(bucket, key); r != nil {
+		return r
+	}
+	return j.placement(bucket, key, size)
+}
+
+// PutObject writes the object to the root that already holds the key, or to
+// the root chosen by placement for new keys.
+func (j *JBODBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	unlock := j.lockKey(bucket, key)
+	defer unlock()
+	r := j.targetFor(bucket, key, size)
+	n, etag, err := r.PutObject(ctx, bucket, key, reader, size)
+	if err != nil {
+		return 0, "", err
+	}
+	j.record(bucket, key, r)
+	return n, etag, nil
+}
+
+// GetObject opens the object from whichever root holds it.
+func (j *JBODBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	r := j.locate(bucket, key)
+	if r == nil {
+		return nil, 0, "", fmt.Errorf("object not found: %s/%s", bucket, key)
+	}
+	return r.GetObject(ctx, bucket, key)
+}
+
+// PreloadObject warms the page cache of the root holding the object.
+func (j *JBODBackend) PreloadObject(ctx context.Context, bucket, key string) (int64, error) {
+	r := j.locate(bucket, key)
+	if r == nil {
+		return 0, fmt.Errorf("object not found: %s/%s", bucket, key)
+	}
+	return r.PreloadObject(ctx, bucket, key)
+}
+
+// DeleteObject removes the object from every root (normally just one).
+func (j *JBODBackend) DeleteObject(ctx context.Context, bucket, key string) error {
+	unlock := j.lockKey(bucket, key)
+	defer unlock()
+	for _, r := range j.roots {
+		if err := r.DeleteObject(ctx, bucket, key); err != nil {
+			return err
+		}
+	}
+	j.forget(bucket, key)
+	return nil
+}
+
+// CopyObject copies srcBucket/srcKey to dstBucket/dstKey, placing the
+// destination like any other write.
+func (j *JBODBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (string, error) {
+	src := j.locate(srcBucket, srcKey)
+	if src == nil {
+		return "", fmt.Errorf("source object not found: %s/%s", srcBucket, srcKey)
+	}
+	srcFile, err := os.Open(src.objectPath(srcBucket, srcKey))
+	if err != nil {
+		return "", fmt.Errorf("opening source object: %w", err)
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat source object: %w", err)
+	}
+
+	_, etag, err := j.PutObject(ctx, dstBucket, dstKey, srcFile, info.Size())
+	if err != nil {
+		return "", fmt.Errorf("copying object data: %w", err)
+	}
+	return etag, nil
+}
+
+// PutPart writes a part to the root already holding the upload's parts, or
+// to the root placement chooses for the object key on the first part.
+// Placement of the parts directory is serialized so that parts uploaded in
+// parallel all land on the same root.
+func (j *JBODBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	unlock := j.lockKey(".multipart", uploadID)
+	r := j.locateParts(uploadID)
+	if r == nil {
+		r = j.placement(bucket, key, size)
+		partDir := filepath.Join(r.RootDir, ".multipart", uploadID)
+		if err := os.MkdirAll(partDir, 0o755); err != nil {
+			unlock()
+			return "", fmt.Errorf("creating part directory: %w", err)
+		}
+	}
+	unlock()
+	return r.PutPart(ctx, bucket, key, uploadID, partNumber, reader, size)
+}
+
+// AssembleParts concatenates the parts into the final object. The object is
+// written to the root already holding the key (if any) so an overwrite never
+// leaves a stale copy elsewhere; otherwise to the root holding the parts.
+func (j *JBODBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	partsRoot := j.locateParts(uploadID)
+	if partsRoot == nil {
+		return "", fmt.Errorf("no parts found for upload %s", uploadID)
+	}
+
+	unlock := j.lockKey(bucket, key)
+	defer unlock()
+
+	target := j.locate(bucket, key)
+	if target == nil {
+		target = partsRoot
+	}
+	partDir := filepath.Join(partsRoot.RootDir, ".multipart", uploadID)
+	etag, err := target.assemblePartsFrom(ctx, partDir, bucket, key, partNumbers)
+	if err != nil {
+		return "", err
+	}
+	j.record(bucket, key, target)
+	os.RemoveAll(partDir)
+	return etag, nil
+}
+
+// DeleteParts removes the parts of the given upload from every root.
+func (j *JBODBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
+	for _, r := range j.roots {
+		if err := r.DeleteParts(ctx, bucket, key, uploadID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUploadParts removes the parts directory of an upload from every
+// root. Used during startup reaping of expired uploads.
+func (j *JBODBackend) DeleteUploadParts(uploadID string) error {
+	for _, r := range j.roots {
+		if err := r.DeleteUploadParts(uploadID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateBucket creates the bucket directory on every root.
+func (j *JBODBackend) CreateBucket(ctx context.Context, bucket string) error {
+	for _, r := range j.roots {
+		if err := r.CreateBucket(ctx, bucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBucket removes the (empty) bucket directory from every root.
+func (j *JBODBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	for _, r := range j.roots {
+		if err := r.DeleteBucket(ctx, bucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ObjectExists reports whether any root holds the object.
+func (j *JBODBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	return j.locate(bucket, key) != nil, nil
+}
+
+// HealthCheck verifies that every root is accessible.
+func (j *JBODBackend) HealthCheck(ctx context.Context) error {
+	for _, r := range j.roots {
+		if err := r.HealthCheck(ctx); err != nil {
+			return fmt.Errorf("root %q: %w", r.RootDir, err)
+		}
+	}
+	return nil
+}
+
+// Usage reports the capacity of each root.
+func (j *JBODBackend) Usage() []RootUsage {
+	usage := make([]RootUsage, 0, len(j.roots))
+	for _, r := range j.roots {
+		total, free, _ := j.diskUsage(r.RootDir)
+		usage = append(usage, RootUsage{Path: r.RootDir, TotalBytes: total, FreeBytes: free})
+	}
+	return usage
+}
+
+// utilization returns the used fraction of a root's filesystem.
+func utilization(u RootUsage) float64 {
+	if u.TotalBytes == 0 {
+		return 0
+	}
+	return 1 - float64(u.FreeBytes)/float64(u.TotalBytes)
+}
+
+// Rebalance migrates objects from the most utilized root to the least
+// utilized one until the spread is within threshold or nothing more can be
+// moved. Roots that share a filesystem report identical utilization and are
+// therefore never rebalanced against each other.
+func (j *JBODBackend) Rebalance(ctx context.Context, threshold float64) (*RebalanceResult, error) {
+	j.rebalanceMu.Lock()
+	defer j.rebalanceMu.Unlock()
+
+	result := &RebalanceResult{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		usage := j.Usage()
+		src, dst := 0, 0
+		for i, u := range usage {
+			if utilization(u) > utilization(usage[src]) {
+				src = i
+			}
+			if utilization(u) < utilization(usage[dst]) {
+				dst = i
+			}
+		}
+		if src == dst || utilization(usage[src])-utilization(usage[dst]) <= threshold {
+			break
+		}
+
+		moved, n, err := j.moveLargest(ctx, j.roots[src], j.roots[dst], usage[src], usage[dst])
+		if err != nil {
+			return result, err
+		}
+		if !moved {
+			break
+		}
+		result.ObjectsMoved++
+		result.BytesMoved += n
+		progress.Report(ctx, int64(result.ObjectsMoved), 0)
+	}
+
+	result.Roots = j.Usage()
+	return result, nil
+}
+
+// moveLargest moves one object from src to dst: the largest object whose
+// move does not invert the imbalance. Returns false when no object fits.
+func (j *JBODBackend) moveLargest(ctx context.Context, src, dst *LocalBackend, srcUsage, dstUsage RootUsage) (bool, int64, error) {
+	type candidate struct {
+		bucket, key string
+		size        int64
+	}
+	var candidates []candidate
+
+	err := filepath.Walk(src.RootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, relErr := filepath.Rel(src.RootDir, path)
+		if relErr != nil || rel == "." {
+			return nil
+		}
+		if info.IsDir() {
+			if strings.HasPrefix(rel, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		candidates = append(candidates, candidate{bucket: parts[0], key: parts[1], size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("scanning root %q: %w", src.RootDir, err)
+	}
+
+	sort.Slice(candidates, func(a, b int) bool { return candidates[a].size > candidates[b].size })
+
+	// Moving more than half the free-space gap would just flip the imbalance.
+	gap := int64(dstUsage.FreeBytes) - int64(srcUsage.FreeBytes)
+	for _, c := range candidates {
+		if c.size > gap/2 || c.size == 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return false, 0, err
+		}
+		ok, err := j.moveObject(ctx, src, dst, c.bucket, c.key)
+		if err != nil {
+			return false, 0, err
+		}
+		if ok {
+			return true, c.size, nil
+		}
+	}
+	return false, 0, nil
+}
+
+// moveObject copies bucket/key from src to dst with temp-fsync-rename, then
+// removes the source copy. It holds the key lock throughout so a concurrent
+// overwrite or delete cannot be undone by the move. Returns false if the
+// object disappeared before it could be moved.
+func (j *JBODBackend) moveObject(ctx context.Context, src, dst *LocalBackend, bucket, key string) (bool, error) {
+	unlock := j.lockKey(bucket, key)
+	defer unlock()
+
+	f, err := os.Open(src.objectPath(bucket, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("opening %s/%s for move: %w", bucket, key, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return false, fmt.Errorf("stat %s/%s for move: %w", bucket, key, err)
+	}
+	_, _, err = dst.PutObject(ctx, bucket, key, f, info.Size())
+	f.Close()
+	if err != nil {
+		return false, fmt.Errorf("moving %s/%s: %w", bucket, key, err)
+	}
+	j.record(bucket, key, dst)
+
+	if err := src.DeleteObject(ctx, bucket, key); err != nil {
+		return false, fmt.Errorf("removing source copy of %s/%s: %w", bucket, key, err)
+	}
+	return true, nil
+}
+
+var _ StorageBackend = (*JBODBackend)(nil)
+var _ Rebalancer = (*JBODBackend)(nil)
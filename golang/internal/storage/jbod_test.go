@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestJBOD(t *testing.T, n int) *JBODBackend {
+	t.Helper()
+	base := t.TempDir()
+	var roots []string
+	for i := 0; i < n; i++ {
+		roots = append(roots, filepath.Join(base, "disk"+string(rune('a'+i))))
+	}
+	backend, err := NewJBODBackend(roots, JBODOptions{})
+	if err != nil {
+		t.Fatalf("NewJBODBackend failed: %v", err)
+	}
+	return backend
+}
+
+func readJBODObject(t *testing.T, backend *JBODBackend, bucket, key string) string {
+	t.Helper()
+	rc, _, _, err := backend.GetObject(context.Background(), bucket, key)
+	if err != nil {
+		t.Fatalf("GetObject(%s/%s) failed: %v", bucket, key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading object: %v", err)
+	}
+	return string(data)
+}
+
+func TestJBODOverwriteStaysOnSameRoot(t *testing.T) {
+	backend := newTestJBOD(t, 2)
+	ctx := context.Background()
+	backend.CreateBucket(ctx, "bkt")
+
+	if _, _, err := backend.PutObject(ctx, "bkt", "k", strings.NewReader("v1"), 2); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	first := backend.locate("bkt", "k")
+
+	// Force the object onto the other root, then overwrite it.
+	other := backend.roots[0]
+	if other == first {
+		other = backend.roots[1]
+	}
+	if ok, err := backend.moveObject(ctx, first, other, "bkt", "k"); err != nil || !ok {
+		t.Fatalf("moveObject = %v, %v", ok, err)
+	}
+	if _, _, err := backend.PutObject(ctx, "bkt", "k", strings.NewReader("v2"), 2); err != nil {
+		t.Fatalf("PutObject (overwrite) failed: %v", err)
+	}
+
+	if got := backend.locate("bkt", "k"); got != other {
+		t.Errorf("overwrite landed on %s, want %s", got.RootDir, other.RootDir)
+	}
+	if _, err := os.Stat(first.objectPath("bkt", "k")); !os.IsNotExist(err) {
+		t.Errorf("stale copy left on %s", first.RootDir)
+	}
+	if got := readJBODObject(t, backend, "bkt", "k"); got != "v2" {
+		t.Errorf("content = %q, want v2", got)
+	}
+
+	if err := backend.DeleteObject(ctx, "bkt", "k"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if exists, _ := backend.ObjectExists(ctx, "bkt", "k"); exists {
+		t.Error("object still exists after delete")
+	}
+}
+
+func TestJBODMultipartAssemble(t *testing.T) {
+	backend := newTestJBOD(t, 3)
+	ctx := context.Background()
+	backend.CreateBucket(ctx, "bkt")
+
+	for i, body := range []string{"hello ", "world"} {
+		if _, err := backend.PutPart(ctx, "bkt", "k", "upload1", i+1, strings.NewReader(body), int64(len(body))); err != nil {
+			t.Fatalf("PutPart %d failed: %v", i+1, err)
+		}
+	}
+
+	// All parts must land on a single root.
+	found := 0
+	for _, r := range backend.roots {
+		if _, err := os.Stat(filepath.Join(r.RootDir, ".multipart", "upload1")); err == nil {
+			found++
+		}
+	}
+	if found != 1 {
+		t.Fatalf("parts found on %d roots, want 1", found)
+	}
+
+	etag, err := backend.AssembleParts(ctx, "bkt", "k", "upload1", []int{1, 2})
+	if err != nil {
+		t.Fatalf("AssembleParts failed: %v", err)
+	}
+	if !strings.HasSuffix(etag, `-2"`) {
+		t.Errorf("etag = %s, want composite", etag)
+	}
+	if got := readJBODObject(t, backend, "bkt", "k"); got != "hello world" {
+		t.Errorf("content = %q", got)
+	}
+	if backend.locateParts("upload1") != nil {
+		t.Error("parts not cleaned up after assembly")
+	}
+}
+
+func TestJBODRebalanceSameFilesystem(t *testing.T) {
+	backend := newTestJBOD(t, 2)
+	ctx := context.Background()
+	backend.CreateBucket(ctx, "bkt")
+	backend.PutObject(ctx, "bkt", "k", strings.NewReader("data"), 4)
+
+	// Both roots share a filesystem, so utilization is identical and
+	// nothing should move.
+	result, err := backend.Rebalance(ctx, 0)
+	if err != nil {
+		t.Fatalf("Rebalance failed: %v", err)
+	}
+	if result.ObjectsMoved != 0 {
+		t.Errorf("ObjectsMoved = %d, want 0", result.ObjectsMoved)
+	}
+	if len(result.Roots) != 2 {
+		t.Errorf("len(Roots) = %d, want 2", len(result.Roots))
+	}
+}
+
+func TestJBODPlacementWeightedByFreeSpace(t *testing.T) {
+	backend := newTestJBOD(t, 3)
+	free := map[string]uint64{
+		backend.roots[0].RootDir: 600 << 30,
+		backend.roots[1].RootDir: 300 << 30,
+		backend.roots[2].RootDir: 100 << 30,
+	}
+	backend.diskUsage = func(path string) (uint64, uint64, error) {
+		return 1 << 40, free[path], nil
+	}
+
+	counts := make(map[string]int)
+	const n = 6000
+	for i := 0; i < n; i++ {
+		key := "key-" + strconv.Itoa(i)
+		r := backend.placement("bkt", key, 1024)
+		if again := backend.placement("bkt", key, 1024); again != r {
+			t.Fatalf("placement of %s is not stable", key)
+		}
+		counts[r.RootDir]++
+	}
+	for path, f := range free {
+		want := float64(n) * float64(f) / float64(1000<<30)
+		if got := float64(counts[path]); got < want*0.85 || got > want*1.15 {
+			t.Errorf("%s got %d objects, want about %.0f", filepath.Base(path), counts[path], want)
+		}
+	}
+
+	// A root without room for the object is skipped.
+	if r := backend.placement("bkt", "huge", 400<<30); r != backend.roots[0] {
+		t.Errorf("400 GiB object placed on %s, want the only root with room", filepath.Base(r.RootDir))
+	}
+}
+
+func TestJBODPlacementIndex(t *testing.T) {
+	base := t.TempDir()
+	roots := []string{filepath.Join(base, "diska"), filepath.Join(base, "diskb")}
+	indexPath := filepath.Join(base, "index.db")
+	open := func() *JBODBackend {
+		backend, err := NewJBODBackend(roots, JBODOptions{IndexPath: indexPath})
+		if err != nil {
+			t.Fatalf("NewJBODBackend failed: %v", err)
+		}
+		return backend
+	}
+	ctx := context.Background()
+
+	backend := open()
+	backend.CreateBucket(ctx, "bkt")
+	for i := 0; i < 20; i++ {
+		if _, _, err := backend.PutObject(ctx, "bkt", "k"+strconv.Itoa(i), strings.NewReader("data"), 4); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+	}
+	holder := backend.locate("bkt", "k0")
+	if backend.indexed("bkt", "k0") != holder {
+		t.Fatal("PutObject did not record the object's root")
+	}
+
+	// A move behind the index's back leaves a stale entry that reads correct.
+	other := backend.roots[0]
+	if other == holder {
+		other = backend.roots[1]
+	}
+	if _, _, err := other.PutObject(ctx, "bkt", "k0", strings.NewReader("data"), 4); err != nil {
+		t.Fatalf("PutObject on root failed: %v", err)
+	}
+	holder.DeleteObject(ctx, "bkt", "k0")
+	if got := readJBODObject(t, backend, "bkt", "k0"); got != "data" {
+		t.Errorf("content = %q after stale index entry", got)
+	}
+	if backend.indexed("bkt", "k0") != other {
+		t.Error("stale index entry was not corrected")
+	}
+
+	if err := backend.DeleteObject(ctx, "bkt", "k1"); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if backend.indexed("bkt", "k1") != nil {
+		t.Error("DeleteObject left an index entry")
+	}
+	backend.Close()
+
+	// Entries survive a restart, and a lost index only slows lookups down.
+	backend = open()
+	if backend.indexed("bkt", "k2") == nil {
+		t.Error("index entry lost across reopen")
+	}
+	backend.Close()
+	os.Remove(indexPath)
+	backend = open()
+	defer backend.Close()
+	for i := 2; i < 20; i++ {
+		if got := readJBODObject(t, backend, "bkt", "k"+strconv.Itoa(i)); got != "data" {
+			t.Errorf("k%d content = %q after losing the index", i, got)
+		}
+	}
+	if backend.indexed("bkt", "k2") == nil {
+		t.Error("lookup did not rebuild the index entry")
+	}
+}
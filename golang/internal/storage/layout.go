@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bleepstore/bleepstore/internal/uid"
+)
+
+const (
+	// LayoutFileName is the file at the top of a local data root that
+	// records the version of the on-disk layout.
+	LayoutFileName = ".layout"
+
+	// LayoutVersion is the layout this binary writes: objects at
+	// <root>/<bucket>/<key>, parts under .multipart, temp files under .tmp.
+	// Bump it, and teach preflight the steps, when that changes.
+	LayoutVersion = 1
+)
+
+// ErrLayoutTooNew is returned when a data root was written by a newer
+// BleepStore with a layout this binary does not know.
+var ErrLayoutTooNew = errors.New("storage layout is newer than this binary")
+
+// ReadLayout returns the layout version recorded in root, or 0 when root has
+// no layout file, as in roots created before the layout was versioned.
+func ReadLayout(root string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(root, LayoutFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading storage layout: %w", err)
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("parsing storage layout in %q: %w", root, err)
+	}
+	return version, nil
+}
+
+// stampLayout records LayoutVersion in root, refusing a root with a newer
+// layout. Version 1 is the layout roots had before it was versioned, so an
+// unversioned root is stamped as is.
+func stampLayout(root string) error {
+	version, err := ReadLayout(root)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > LayoutVersion:
+		return fmt.Errorf("%w: %q is at version %d, this binary knows up to %d", ErrLayoutTooNew, root, version, LayoutVersion)
+	case version == LayoutVersion:
+		return nil
+	}
+	tmp := filepath.Join(root, ".tmp", "layout-"+uid.New())
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(LayoutVersion)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("writing storage layout: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(root, LayoutFileName)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writing storage layout: %w", err)
+	}
+	return nil
+}
@@ -19,6 +19,12 @@ type LocalBackend struct {
 	// RootDir is the base directory under which all bucket and object data
 	// is stored.
 	RootDir string
+
+	// namer names object files under their bucket directory; nil names
+	// them after their keys.
+	namer ObjectNamer
+	// names records the key of each file name namer produces, or is nil.
+	names NameIndex
 }
 
 // NewLocalBackend creates a new LocalBackend rooted at the given directory.
@@ -32,6 +38,9 @@ func NewLocalBackend(rootDir string) (*LocalBackend, error) {
 	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
 		return nil, fmt.Errorf("creating temp directory %q: %w", tmpDir, err)
 	}
+	if err := stampLayout(rootDir); err != nil {
+		return nil, err
+	}
 	return &LocalBackend{RootDir: rootDir}, nil
 }
 
@@ -55,9 +64,38 @@ func (b *LocalBackend) CleanTempFiles() error {
 	return nil
 }
 
+// SetNamer names object files with namer, recording each name's key in
+// index before the file is written. index must be set for any namer other
+// than PlainNames, or files could not be traced back to their objects.
+// Objects already stored under other names are no longer found.
+func (b *LocalBackend) SetNamer(namer ObjectNamer, index NameIndex) {
+	b.namer, b.names = namer, index
+}
+
+// fileName returns the path of an object's file under its bucket directory.
+func (b *LocalBackend) fileName(bucket, key string) string {
+	if b.namer == nil {
+		return key
+	}
+	return b.namer.FileName(bucket, key)
+}
+
+// recordName records the key of an object's file name, if names are
+// indexed. It is called before the file is written, so no file is ever
+// left without a record.
+func (b *LocalBackend) recordName(ctx context.Context, bucket, key string) error {
+	if b.names == nil {
+		return nil
+	}
+	if err := b.names.RecordObjectName(ctx, bucket, b.fileName(bucket, key), key); err != nil {
+		return fmt.Errorf("recording file name of %q/%q: %w", bucket, key, err)
+	}
+	return nil
+}
+
 // objectPath returns the full filesystem path for an object.
 func (b *LocalBackend) objectPath(bucket, key string) string {
-	return filepath.Join(b.RootDir, bucket, key)
+	return filepath.Join(b.RootDir, bucket, filepath.FromSlash(b.fileName(bucket, key)))
 }
 
 // tempPath returns a unique temporary file path in the .tmp directory.
@@ -106,6 +144,11 @@ func (b *LocalBackend) PutObject(ctx context.Context, bucket, key string, reader
 		return 0, "", fmt.Errorf("closing temp file: %w", err)
 	}
 
+	if err := b.recordName(ctx, bucket, key); err != nil {
+		os.Remove(tmpPath)
+		return 0, "", err
+	}
+
 	// Atomic rename: temp -> final path.
 	if err := os.Rename(tmpPath, objPath); err != nil {
 		os.Remove(tmpPath)
@@ -139,6 +182,21 @@ func (b *LocalBackend) GetObject(ctx context.Context, bucket, key string) (io.Re
 	return file, info.Size(), "", nil
 }
 
+// PreloadObject reads the object file end to end so its pages are resident
+// in the OS page cache before clients request it.
+func (b *LocalBackend) PreloadObject(ctx context.Context, bucket, key string) (int64, error) {
+	rc, _, _, err := b.GetObject(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	n, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return n, fmt.Errorf("reading object file %q/%q: %w", bucket, key, err)
+	}
+	return n, nil
+}
+
 // DeleteObject removes the object file from the local filesystem.
 // Idempotent: deleting a non-existent file is not an error.
 // Also cleans up empty parent directories up to the bucket root.
@@ -239,12 +297,28 @@ func (b *LocalBackend) PutPart(ctx context.Context, bucket, key, uploadID string
 // AssembleParts concatenates the specified parts into a single object file.
 // Uses atomic write pattern. Returns the composite ETag.
 func (b *LocalBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	partDir := filepath.Join(b.RootDir, ".multipart", uploadID)
+	etag, err := b.assemblePartsFrom(ctx, partDir, bucket, key, partNumbers)
+	if err != nil {
+		return "", err
+	}
+
+	// Clean up part files.
+	os.RemoveAll(partDir)
+
+	return etag, nil
+}
+
+// assemblePartsFrom concatenates the numbered part files in partDir into the
+// object file for bucket/key under this backend's root. partDir may live on
+// a different filesystem (JBOD); the temp file is always on this root so the
+// final rename stays atomic.
+func (b *LocalBackend) assemblePartsFrom(ctx context.Context, partDir, bucket, key string, partNumbers []int) (string, error) {
 	objPath := b.objectPath(bucket, key)
 	if err := os.MkdirAll(filepath.Dir(objPath), 0o755); err != nil {
 		return "", fmt.Errorf("creating parent directories: %w", err)
 	}
 
-	partDir := filepath.Join(b.RootDir, ".multipart", uploadID)
 	tmpPath := b.tempPath()
 	tmpFile, err := os.Create(tmpPath)
 	if err != nil {
@@ -288,18 +362,18 @@ func (b *LocalBackend) AssembleParts(ctx context.Context, bucket, key, uploadID
 		return "", fmt.Errorf("closing assembled temp file: %w", err)
 	}
 
+	if err := b.recordName(ctx, bucket, key); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
 	if err := os.Rename(tmpPath, objPath); err != nil {
 		os.Remove(tmpPath)
 		return "", fmt.Errorf("renaming assembled file: %w", err)
 	}
 
 	// Composite ETag format: "md5-of-concatenated-part-md5s-N"
-	etag := fmt.Sprintf(`"%x-%d"`, compositeMD5.Sum(nil), len(partNumbers))
-
-	// Clean up part files.
-	os.RemoveAll(partDir)
-
-	return etag, nil
+	return fmt.Sprintf(`"%x-%d"`, compositeMD5.Sum(nil), len(partNumbers)), nil
 }
 
 // DeleteParts removes all part files associated with the given multipart upload.
@@ -357,7 +431,7 @@ func (b *LocalBackend) DeleteBucket(ctx context.Context, bucket string) error {
 
 // ObjectExists checks whether an object exists on the local filesystem.
 func (b *LocalBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
-	objPath := filepath.Join(b.RootDir, bucket, key)
+	objPath := b.objectPath(bucket, key)
 	info, err := os.Stat(objPath)
 	if err == nil {
 		// Make sure it's a file, not a directory.
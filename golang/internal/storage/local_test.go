@@ -2,11 +2,13 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func newTestBackend(t *testing.T) *LocalBackend {
@@ -413,3 +415,154 @@ func TestPutObjectOverwrite(t *testing.T) {
 		t.Errorf("data = %q, want %q", string(data), "version 2!!")
 	}
 }
+
+func TestWalkAndRemoveFiles(t *testing.T) {
+	backend := newTestBackend(t)
+	ctx := context.Background()
+	backend.CreateBucket(ctx, "b")
+	backend.PutObject(ctx, "b", "dir/obj", strings.NewReader("data"), 4)
+	backend.PutPart(ctx, "b", "k", "upload-1", 2, strings.NewReader("part"), 4)
+
+	var files []StoredFile
+	if err := backend.WalkFiles(ctx, func(f StoredFile) error {
+		files = append(files, f)
+		return nil
+	}); err != nil {
+		t.Fatalf("WalkFiles: %v", err)
+	}
+	if len(files) != 2 || files[0].Key != "dir/obj" || files[1].UploadID != "upload-1" || files[1].PartNumber != 2 {
+		t.Fatalf("files = %+v", files)
+	}
+
+	// A file rewritten since the walk is left alone.
+	stale := files[0]
+	stale.ModTime = stale.ModTime.Add(-time.Hour)
+	if err := backend.RemoveFile(ctx, stale, false); err != ErrFileChanged {
+		t.Fatalf("RemoveFile(stale) = %v, want ErrFileChanged", err)
+	}
+
+	if err := backend.RemoveFile(ctx, files[0], true); err != nil {
+		t.Fatalf("RemoveFile(quarantine): %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(backend.RootDir, ".quarantine", "objects", "b", "dir", "obj")); string(data) != "data" {
+		t.Errorf("quarantined file = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(backend.RootDir, "b", "dir")); !os.IsNotExist(err) {
+		t.Errorf("empty key directory left behind: %v", err)
+	}
+	if err := backend.RemoveFile(ctx, files[1], false); err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backend.RootDir, ".multipart", "upload-1")); !os.IsNotExist(err) {
+		t.Errorf("empty upload directory left behind: %v", err)
+	}
+}
+
+// mapNames is a NameIndex in memory.
+type mapNames map[string]string
+
+func (m mapNames) RecordObjectName(ctx context.Context, bucket, name, key string) error {
+	m[bucket+"/"+name] = key
+	return nil
+}
+
+func (m mapNames) ObjectNameKey(ctx context.Context, bucket, name string) (string, error) {
+	return m[bucket+"/"+name], nil
+}
+
+func TestHashedNames(t *testing.T) {
+	backend := newTestBackend(t)
+	namer, err := NewHashedNames("s3cret")
+	if err != nil {
+		t.Fatalf("NewHashedNames: %v", err)
+	}
+	names := mapNames{}
+	backend.SetNamer(namer, names)
+	ctx := context.Background()
+	backend.CreateBucket(ctx, "b")
+
+	const key = "customers/alice@example.com/invoice.pdf"
+	if _, _, err := backend.PutObject(ctx, "b", key, strings.NewReader("data"), 4); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	backend.PutPart(ctx, "b", "mp", "upload-1", 1, strings.NewReader("part"), 4)
+	if _, err := backend.AssembleParts(ctx, "b", "mp", "upload-1", []int{1}); err != nil {
+		t.Fatalf("AssembleParts: %v", err)
+	}
+	if _, err := backend.CopyObject(ctx, "b", key, "b", "copy"); err != nil {
+		t.Fatalf("CopyObject: %v", err)
+	}
+	if ok, _ := backend.ObjectExists(ctx, "b", key); !ok {
+		t.Fatal("ObjectExists = false")
+	}
+	rc, _, _, err := backend.GetObject(ctx, "b", key)
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "data" {
+		t.Errorf("data = %q", data)
+	}
+
+	// No path on disk reveals a key; a file without a recorded key is
+	// reported by name alone.
+	filepath.WalkDir(backend.RootDir, func(path string, d os.DirEntry, err error) error {
+		if strings.Contains(path, "alice") || strings.Contains(path, "customers") || strings.HasSuffix(path, "copy") {
+			t.Errorf("path %s reveals a key", path)
+		}
+		return nil
+	})
+	os.WriteFile(filepath.Join(backend.RootDir, "b", "stray"), []byte("x"), 0o644)
+	files := map[string]StoredFile{}
+	if err := backend.WalkFiles(ctx, func(f StoredFile) error {
+		files[f.Name] = f
+		return nil
+	}); err != nil {
+		t.Fatalf("WalkFiles: %v", err)
+	}
+	if f := files[namer.FileName("b", key)]; f.Key != key || len(files) != 4 {
+		t.Fatalf("files = %+v", files)
+	}
+	if f := files["stray"]; f.Key != "" {
+		t.Errorf("stray file = %+v", f)
+	}
+	if err := backend.RemoveFile(ctx, files["stray"], false); err != nil {
+		t.Fatalf("RemoveFile(stray): %v", err)
+	}
+
+	if err := backend.DeleteObject(ctx, "b", key); err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if ok, _ := backend.ObjectExists(ctx, "b", key); ok {
+		t.Error("object exists after DeleteObject")
+	}
+
+	// Without a name index, files could not be traced to their keys.
+	backend.SetNamer(namer, nil)
+	if err := backend.WalkFiles(ctx, func(StoredFile) error { return nil }); err == nil {
+		t.Error("WalkFiles without a name index succeeded")
+	}
+	if _, err := NewHashedNames(""); err == nil {
+		t.Error("NewHashedNames accepted an empty secret")
+	}
+}
+
+func TestLocalLayout(t *testing.T) {
+	root := t.TempDir()
+	if v, err := ReadLayout(root); err != nil || v != 0 {
+		t.Fatalf("ReadLayout before open = %d, %v", v, err)
+	}
+	if _, err := NewLocalBackend(root); err != nil {
+		t.Fatalf("NewLocalBackend: %v", err)
+	}
+	if v, err := ReadLayout(root); err != nil || v != LayoutVersion {
+		t.Errorf("ReadLayout after open = %d, %v; want %d", v, err, LayoutVersion)
+	}
+
+	// A root written by a newer binary is refused.
+	os.WriteFile(filepath.Join(root, LayoutFileName), []byte("99\n"), 0o644)
+	if _, err := NewLocalBackend(root); !errors.Is(err, ErrLayoutTooNew) {
+		t.Errorf("NewLocalBackend on a newer layout = %v, want ErrLayoutTooNew", err)
+	}
+}
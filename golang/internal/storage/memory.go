@@ -4,17 +4,11 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
-	"database/sql"
 	"fmt"
 	"io"
 	"log"
-	"os"
-	"path/filepath"
-	"sort"
 	"sync"
 	"time"
-
-	_ "modernc.org/sqlite" // Pure-Go SQLite driver
 )
 
 // memObject holds the raw data and precomputed ETag for an in-memory object.
@@ -31,8 +25,8 @@ type memPart struct {
 }
 
 // MemoryBackend implements the StorageBackend interface using in-memory maps.
-// It optionally supports snapshot persistence to a SQLite file so that data
-// survives restarts.
+// It optionally supports snapshot persistence to disk so that data survives
+// restarts; see memory_snapshot.go for the format.
 type MemoryBackend struct {
 	mu           sync.RWMutex
 	objects      map[string]memObject // key: "bucket/key"
@@ -43,14 +37,31 @@ type MemoryBackend struct {
 	persistence             string
 	snapshotPath            string
 	snapshotIntervalSeconds int
+	snapshotCompression     byte
 	stopCh                  chan struct{}
 	wg                      sync.WaitGroup
+
+	// Incremental snapshot state. dirtyObjects and dirtyParts hold the keys
+	// changed since the last snapshot and are nil when persistence is off.
+	// The rest is only touched by the snapshot writer.
+	dirtyObjects map[string]struct{}
+	dirtyParts   map[string]struct{}
+	snap         snapshotChain
+
+	// feeds are the replication streams receiving changes; see
+	// memory_replication.go.
+	feeds map[*replicationFeed]struct{}
 }
 
 // NewMemoryBackend creates a new MemoryBackend. If persistence is "snapshot",
 // it loads any existing snapshot from snapshotPath and starts a background
-// goroutine to write periodic snapshots.
-func NewMemoryBackend(maxSizeBytes int64, persistence string, snapshotPath string, snapshotIntervalSeconds int) (*MemoryBackend, error) {
+// goroutine to write periodic snapshots. snapshotCompression is "zstd" (the
+// default when empty) or "none".
+func NewMemoryBackend(maxSizeBytes int64, persistence string, snapshotPath string, snapshotIntervalSeconds int, snapshotCompression string) (*MemoryBackend, error) {
+	compression, err := parseSnapshotCompression(snapshotCompression)
+	if err != nil {
+		return nil, err
+	}
 	b := &MemoryBackend{
 		objects:                 make(map[string]memObject),
 		parts:                   make(map[string]memPart),
@@ -58,10 +69,13 @@ func NewMemoryBackend(maxSizeBytes int64, persistence string, snapshotPath strin
 		persistence:             persistence,
 		snapshotPath:            snapshotPath,
 		snapshotIntervalSeconds: snapshotIntervalSeconds,
+		snapshotCompression:     compression,
 		stopCh:                  make(chan struct{}),
 	}
 
 	if persistence == "snapshot" && snapshotPath != "" {
+		b.dirtyObjects = make(map[string]struct{})
+		b.dirtyParts = make(map[string]struct{})
 		if err := b.loadSnapshot(); err != nil {
 			return nil, fmt.Errorf("loading snapshot: %w", err)
 		}
@@ -118,6 +132,7 @@ func (b *MemoryBackend) PutObject(ctx context.Context, bucket, key string, reade
 
 	b.objects[ok] = memObject{Data: data, ETag: etag}
 	b.currentSize += delta
+	b.markObjectLocked(ok)
 
 	return dataLen, etag, nil
 }
@@ -151,6 +166,7 @@ func (b *MemoryBackend) DeleteObject(ctx context.Context, bucket, key string) er
 	if obj, found := b.objects[ok]; found {
 		b.currentSize -= int64(len(obj.Data))
 		delete(b.objects, ok)
+		b.markObjectLocked(ok)
 	}
 
 	return nil
@@ -185,6 +201,7 @@ func (b *MemoryBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBu
 	etag := computeETag(dataCopy)
 	b.objects[dstOK] = memObject{Data: dataCopy, ETag: etag}
 	b.currentSize += delta
+	b.markObjectLocked(dstOK)
 
 	return etag, nil
 }
@@ -214,6 +231,7 @@ func (b *MemoryBackend) PutPart(ctx context.Context, bucket, key, uploadID strin
 
 	b.parts[pk] = memPart{Data: data, ETag: etag}
 	b.currentSize += delta
+	b.markPartLocked(pk)
 
 	return etag, nil
 }
@@ -262,6 +280,7 @@ func (b *MemoryBackend) AssembleParts(ctx context.Context, bucket, key, uploadID
 	etag := fmt.Sprintf(`"%x-%d"`, compositeMD5.Sum(nil), len(partNumbers))
 	b.objects[ok] = memObject{Data: assembled, ETag: etag}
 	b.currentSize += delta
+	b.markObjectLocked(ok)
 
 	return etag, nil
 }
@@ -298,11 +317,34 @@ func (b *MemoryBackend) removePartsLocked(uploadID string) int64 {
 		if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
 			removed += int64(len(part.Data))
 			delete(b.parts, k)
+			b.markPartLocked(k)
 		}
 	}
 	return removed
 }
 
+// markObjectLocked records that the object at ok changed, for the next
+// snapshot and for replicas. The caller must hold b.mu.
+func (b *MemoryBackend) markObjectLocked(ok string) {
+	if b.dirtyObjects != nil {
+		b.dirtyObjects[ok] = struct{}{}
+	}
+	if len(b.feeds) > 0 {
+		b.publishLocked(b.objectRecordLocked(ok))
+	}
+}
+
+// markPartLocked records that the part at pk changed, for the next snapshot
+// and for replicas. The caller must hold b.mu.
+func (b *MemoryBackend) markPartLocked(pk string) {
+	if b.dirtyParts != nil {
+		b.dirtyParts[pk] = struct{}{}
+	}
+	if len(b.feeds) > 0 {
+		b.publishLocked(b.partRecordLocked(pk))
+	}
+}
+
 // CreateBucket is a no-op for the memory backend. Bucket existence is tracked
 // by the metadata store, not the storage backend.
 func (b *MemoryBackend) CreateBucket(ctx context.Context, bucket string) error {
@@ -365,253 +407,5 @@ func (b *MemoryBackend) snapshotLoop() {
 	}
 }
 
-// loadSnapshot restores the in-memory state from a SQLite snapshot file.
-// If the file does not exist, this is a no-op (fresh start).
-func (b *MemoryBackend) loadSnapshot() error {
-	if _, err := os.Stat(b.snapshotPath); os.IsNotExist(err) {
-		return nil
-	}
-
-	db, err := sql.Open("sqlite", b.snapshotPath)
-	if err != nil {
-		return fmt.Errorf("opening snapshot database: %w", err)
-	}
-	defer db.Close()
-
-	// Apply PRAGMAs for read performance.
-	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
-		return fmt.Errorf("setting journal mode: %w", err)
-	}
-
-	// Check if tables exist before querying.
-	var tableCount int
-	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name IN ('object_snapshots', 'part_snapshots')`).Scan(&tableCount)
-	if err != nil {
-		return fmt.Errorf("checking snapshot tables: %w", err)
-	}
-	if tableCount == 0 {
-		return nil
-	}
-
-	// Load objects.
-	if tableCount >= 1 {
-		rows, err := db.Query("SELECT bucket, key, data, etag FROM object_snapshots")
-		if err != nil {
-			return fmt.Errorf("querying object snapshots: %w", err)
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var bucket, key, etag string
-			var data []byte
-			if err := rows.Scan(&bucket, &key, &data, &etag); err != nil {
-				return fmt.Errorf("scanning object snapshot row: %w", err)
-			}
-			ok := objectKey(bucket, key)
-			b.objects[ok] = memObject{Data: data, ETag: etag}
-			b.currentSize += int64(len(data))
-		}
-		if err := rows.Err(); err != nil {
-			return fmt.Errorf("iterating object snapshot rows: %w", err)
-		}
-	}
-
-	// Load parts.
-	if tableCount >= 2 {
-		rows, err := db.Query("SELECT upload_id, part_number, data, etag FROM part_snapshots")
-		if err != nil {
-			return fmt.Errorf("querying part snapshots: %w", err)
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var uploadID, etag string
-			var partNumber int
-			var data []byte
-			if err := rows.Scan(&uploadID, &partNumber, &data, &etag); err != nil {
-				return fmt.Errorf("scanning part snapshot row: %w", err)
-			}
-			pk := partKey(uploadID, partNumber)
-			b.parts[pk] = memPart{Data: data, ETag: etag}
-			b.currentSize += int64(len(data))
-		}
-		if err := rows.Err(); err != nil {
-			return fmt.Errorf("iterating part snapshot rows: %w", err)
-		}
-	}
-
-	return nil
-}
-
-// writeSnapshot atomically writes the current in-memory state to a SQLite
-// snapshot file. It writes to a temporary file first, then renames it to
-// the final path for crash safety.
-func (b *MemoryBackend) writeSnapshot() error {
-	b.mu.RLock()
-	objectsCopy := make(map[string]memObject, len(b.objects))
-	for k, v := range b.objects {
-		objectsCopy[k] = v
-	}
-	partsCopy := make(map[string]memPart, len(b.parts))
-	for k, v := range b.parts {
-		partsCopy[k] = v
-	}
-	b.mu.RUnlock()
-
-	// Ensure the parent directory exists.
-	dir := filepath.Dir(b.snapshotPath)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("creating snapshot directory: %w", err)
-	}
-
-	tmpPath := b.snapshotPath + ".tmp"
-
-	// Remove any stale temp file from a previous failed attempt.
-	os.Remove(tmpPath)
-
-	db, err := sql.Open("sqlite", tmpPath)
-	if err != nil {
-		return fmt.Errorf("creating temp snapshot database: %w", err)
-	}
-
-	// Create schema.
-	schema := `
-		PRAGMA journal_mode = WAL;
-		PRAGMA synchronous = FULL;
-
-		CREATE TABLE object_snapshots (
-			bucket TEXT NOT NULL,
-			key    TEXT NOT NULL,
-			data   BLOB NOT NULL,
-			etag   TEXT NOT NULL,
-			PRIMARY KEY (bucket, key)
-		);
-
-		CREATE TABLE part_snapshots (
-			upload_id   TEXT NOT NULL,
-			part_number INTEGER NOT NULL,
-			data        BLOB NOT NULL,
-			etag        TEXT NOT NULL,
-			PRIMARY KEY (upload_id, part_number)
-		);
-	`
-	if _, err := db.Exec(schema); err != nil {
-		db.Close()
-		os.Remove(tmpPath)
-		return fmt.Errorf("creating snapshot schema: %w", err)
-	}
-
-	// Write objects.
-	tx, err := db.Begin()
-	if err != nil {
-		db.Close()
-		os.Remove(tmpPath)
-		return fmt.Errorf("beginning snapshot transaction: %w", err)
-	}
-
-	objStmt, err := tx.Prepare("INSERT INTO object_snapshots (bucket, key, data, etag) VALUES (?, ?, ?, ?)")
-	if err != nil {
-		tx.Rollback()
-		db.Close()
-		os.Remove(tmpPath)
-		return fmt.Errorf("preparing object insert: %w", err)
-	}
-	defer objStmt.Close()
-
-	// Sort keys for deterministic output.
-	objectKeys := make([]string, 0, len(objectsCopy))
-	for k := range objectsCopy {
-		objectKeys = append(objectKeys, k)
-	}
-	sort.Strings(objectKeys)
-
-	for _, ok := range objectKeys {
-		obj := objectsCopy[ok]
-		// Split "bucket/key" back into bucket and key.
-		bucket, key := splitObjectKey(ok)
-		if _, err := objStmt.Exec(bucket, key, obj.Data, obj.ETag); err != nil {
-			tx.Rollback()
-			db.Close()
-			os.Remove(tmpPath)
-			return fmt.Errorf("inserting object snapshot for %q: %w", ok, err)
-		}
-	}
-
-	partStmt, err := tx.Prepare("INSERT INTO part_snapshots (upload_id, part_number, data, etag) VALUES (?, ?, ?, ?)")
-	if err != nil {
-		tx.Rollback()
-		db.Close()
-		os.Remove(tmpPath)
-		return fmt.Errorf("preparing part insert: %w", err)
-	}
-	defer partStmt.Close()
-
-	// Sort part keys for deterministic output.
-	partKeys := make([]string, 0, len(partsCopy))
-	for k := range partsCopy {
-		partKeys = append(partKeys, k)
-	}
-	sort.Strings(partKeys)
-
-	for _, pk := range partKeys {
-		part := partsCopy[pk]
-		uploadID, partNumber := splitPartKey(pk)
-		if _, err := partStmt.Exec(uploadID, partNumber, part.Data, part.ETag); err != nil {
-			tx.Rollback()
-			db.Close()
-			os.Remove(tmpPath)
-			return fmt.Errorf("inserting part snapshot for %q: %w", pk, err)
-		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		db.Close()
-		os.Remove(tmpPath)
-		return fmt.Errorf("committing snapshot transaction: %w", err)
-	}
-
-	if err := db.Close(); err != nil {
-		os.Remove(tmpPath)
-		return fmt.Errorf("closing temp snapshot database: %w", err)
-	}
-
-	// Atomic rename: temp -> final path.
-	if err := os.Rename(tmpPath, b.snapshotPath); err != nil {
-		os.Remove(tmpPath)
-		return fmt.Errorf("renaming snapshot file: %w", err)
-	}
-
-	// Clean up WAL and SHM files from the temp database (they may linger
-	// after rename on some platforms).
-	os.Remove(tmpPath + "-wal")
-	os.Remove(tmpPath + "-shm")
-
-	return nil
-}
-
-// splitObjectKey splits a "bucket/key" string back into bucket and key.
-// The bucket is everything before the first slash; the key is the rest.
-func splitObjectKey(ok string) (bucket, key string) {
-	for i := 0; i < len(ok); i++ {
-		if ok[i] == '/' {
-			return ok[:i], ok[i+1:]
-		}
-	}
-	return ok, ""
-}
-
-// splitPartKey splits a "uploadID/partNumber" string back into its components.
-// The upload ID is everything before the last slash; the part number is the rest.
-func splitPartKey(pk string) (uploadID string, partNumber int) {
-	for i := len(pk) - 1; i >= 0; i-- {
-		if pk[i] == '/' {
-			uploadID = pk[:i]
-			fmt.Sscanf(pk[i+1:], "%d", &partNumber)
-			return
-		}
-	}
-	return pk, 0
-}
-
 // Ensure MemoryBackend implements StorageBackend at compile time.
 var _ StorageBackend = (*MemoryBackend)(nil)
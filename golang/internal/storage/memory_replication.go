@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A replication stream starts with replicationMagic and a version byte,
+// followed by records in the snapshot record encoding: a put for every
+// object and part, a recSync marking the end of the full state, then one
+// record per change. recHeartbeat is sent while idle so a follower can tell
+// a quiet primary from a dead connection.
+const (
+	replicationMagic   = "BLEEPREP"
+	replicationVersion = 1
+
+	// replicationBuffer is how many changes a stream may fall behind before
+	// it is dropped. The follower then reconnects and resynchronizes.
+	replicationBuffer = 4096
+
+	// ReplicationHeartbeat is how often an idle stream sends a heartbeat.
+	ReplicationHeartbeat = 10 * time.Second
+)
+
+// errReplicaTooSlow ends a stream whose reader fell replicationBuffer
+// changes behind.
+var errReplicaTooSlow = errors.New("replica fell too far behind")
+
+// replicationFeed delivers changes to one replication stream. The backend
+// closes ch when the stream falls too far behind.
+type replicationFeed struct {
+	ch chan snapshotRecord
+}
+
+// publishLocked sends rec to every replication stream, dropping streams
+// whose buffer is full. The caller must hold b.mu for writing.
+func (b *MemoryBackend) publishLocked(rec snapshotRecord) {
+	for f := range b.feeds {
+		select {
+		case f.ch <- rec:
+		default:
+			close(f.ch)
+			delete(b.feeds, f)
+		}
+	}
+}
+
+// StreamReplication writes the backend's contents to w and then every
+// change until ctx is done.
+func (b *MemoryBackend) StreamReplication(ctx context.Context, w io.Writer, flush func() error) error {
+	feed := &replicationFeed{ch: make(chan snapshotRecord, replicationBuffer)}
+
+	// Capture the full state and subscribe under one lock so that no
+	// change falls between them.
+	b.mu.Lock()
+	records := b.fullRecordsLocked()
+	if b.feeds == nil {
+		b.feeds = make(map[*replicationFeed]struct{})
+	}
+	b.feeds[feed] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.feeds, feed)
+		b.mu.Unlock()
+	}()
+
+	bw := bufio.NewWriterSize(w, 1<<20)
+	send := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		return flush()
+	}
+
+	if _, err := bw.Write(append([]byte(replicationMagic), replicationVersion)); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := writeSnapshotRecord(bw, rec); err != nil {
+			return err
+		}
+	}
+	if err := writeSnapshotRecord(bw, snapshotRecord{typ: recSync}); err != nil {
+		return err
+	}
+	if err := send(); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(ReplicationHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if err := writeSnapshotRecord(bw, snapshotRecord{typ: recHeartbeat}); err != nil {
+				return err
+			}
+			if err := send(); err != nil {
+				return err
+			}
+		case rec, ok := <-feed.ch:
+			if !ok {
+				return errReplicaTooSlow
+			}
+			if err := writeSnapshotRecord(bw, rec); err != nil {
+				return err
+			}
+			// Batch whatever else is queued before flushing.
+			if len(feed.ch) == 0 {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// ApplyReplication replaces the backend's contents with the full state read
+// from a peer's stream and, if follow is true, applies the peer's changes
+// until the stream ends.
+func (b *MemoryBackend) ApplyReplication(ctx context.Context, r io.Reader, follow bool, synced func()) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	header := make([]byte, len(replicationMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("reading replication header: %w", err)
+	}
+	if string(header[:len(replicationMagic)]) != replicationMagic {
+		return errors.New("not a replication stream")
+	}
+	if header[len(replicationMagic)] != replicationVersion {
+		return fmt.Errorf("unsupported replication version %d", header[len(replicationMagic)])
+	}
+
+	var full []snapshotRecord
+	for {
+		rec, err := readSnapshotRecord(br)
+		if err != nil {
+			return fmt.Errorf("reading replication state: %w", err)
+		}
+		if rec.typ == recSync {
+			break
+		}
+		if rec.typ != recHeartbeat {
+			full = append(full, rec)
+		}
+	}
+	b.replaceState(full)
+	if synced != nil {
+		synced()
+	}
+	if !follow {
+		return nil
+	}
+
+	for ctx.Err() == nil {
+		rec, err := readSnapshotRecord(br)
+		if err != nil {
+			return fmt.Errorf("reading replication stream: %w", err)
+		}
+		if rec.typ == recHeartbeat || rec.typ == recSync {
+			continue
+		}
+		b.mu.Lock()
+		b.applySnapshot([]snapshotRecord{rec})
+		if rec.typ == recPutObject || rec.typ == recDeleteObject {
+			b.markObjectLocked(rec.key)
+		} else {
+			b.markPartLocked(rec.key)
+		}
+		b.mu.Unlock()
+	}
+	return ctx.Err()
+}
+
+// replaceState replaces all objects and parts with records.
+func (b *MemoryBackend) replaceState(records []snapshotRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	old := b.fullRecordsLocked()
+	b.objects = make(map[string]memObject)
+	b.parts = make(map[string]memPart)
+	b.currentSize = 0
+	b.applySnapshot(records)
+
+	// Every key that existed before or exists now has changed as far as
+	// snapshots and downstream streams are concerned.
+	for _, rec := range append(old, records...) {
+		if rec.typ == recPutObject {
+			b.markObjectLocked(rec.key)
+		} else {
+			b.markPartLocked(rec.key)
+		}
+	}
+}
+
+// Empty reports whether the backend holds no objects or parts.
+func (b *MemoryBackend) Empty() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.objects) == 0 && len(b.parts) == 0
+}
+
+// Ensure MemoryBackend implements Replicator at compile time.
+var _ Replicator = (*MemoryBackend)(nil)
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// startReplication streams primary into replica over a pipe and returns
+// once the replica holds the primary's full state.
+func startReplication(t *testing.T, primary, replica *MemoryBackend) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	streamDone := make(chan error, 1)
+	go func() {
+		err := primary.StreamReplication(ctx, pw, func() error { return nil })
+		pw.CloseWithError(io.ErrClosedPipe)
+		streamDone <- err
+	}()
+	synced := make(chan struct{})
+	applyDone := make(chan error, 1)
+	go func() {
+		applyDone <- replica.ApplyReplication(ctx, pr, true, func() { close(synced) })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-streamDone; err != nil {
+			t.Errorf("StreamReplication: %v", err)
+		}
+		<-applyDone
+	})
+
+	select {
+	case <-synced:
+	case err := <-applyDone:
+		t.Fatalf("ApplyReplication before sync: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("replica did not sync")
+	}
+}
+
+// waitMemContents waits for b to hold exactly want.
+func waitMemContents(t *testing.T, b *MemoryBackend, want map[string]string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b.mu.RLock()
+		got := memContents(b)
+		b.mu.RUnlock()
+		equal := len(got) == len(want)
+		for k, v := range want {
+			if got[k] != v {
+				equal = false
+			}
+		}
+		if equal {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("objects = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMemoryReplication(t *testing.T) {
+	primary, _ := NewMemoryBackend(0, "none", "", 0, "")
+	replica, _ := NewMemoryBackend(0, "none", "", 0, "")
+	putMem(t, primary, "before", "one")
+	putMem(t, replica, "stale", "dropped on sync")
+
+	startReplication(t, primary, replica)
+	waitMemContents(t, replica, map[string]string{"bkt/before": "one"})
+
+	putMem(t, primary, "after", "two")
+	putMem(t, primary, "before", "changed")
+	primary.DeleteObject(context.Background(), "bkt", "after")
+	putMem(t, primary, "last", "three")
+	waitMemContents(t, replica, map[string]string{"bkt/before": "changed", "bkt/last": "three"})
+	assertMemContents(t, replica, map[string]string{"bkt/before": "changed", "bkt/last": "three"})
+}
+
+func TestMemoryReplicationBootstrap(t *testing.T) {
+	replica, _ := NewMemoryBackend(0, "none", "", 0, "")
+	putMem(t, replica, "kept", "survives restart")
+	restarted, _ := NewMemoryBackend(0, "none", "", 0, "")
+	if !restarted.Empty() || replica.Empty() {
+		t.Fatal("Empty() is wrong")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	go func() {
+		replica.StreamReplication(ctx, pw, func() error { return nil })
+		pw.Close()
+	}()
+	// Without follow, the apply returns as soon as the state is copied.
+	if err := restarted.ApplyReplication(ctx, pr, false, nil); err != nil {
+		t.Fatalf("ApplyReplication: %v", err)
+	}
+	assertMemContents(t, restarted, map[string]string{"bkt/kept": "survives restart"})
+}
+
+func TestMemoryReplicationRejectsGarbage(t *testing.T) {
+	b, _ := NewMemoryBackend(0, "none", "", 0, "")
+	err := b.ApplyReplication(context.Background(), io.LimitReader(zeroReader{}, 64), true, nil)
+	if err == nil {
+		t.Fatal("garbage stream accepted")
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newSnapshotBackend(t *testing.T, path, compression string) *MemoryBackend {
+	t.Helper()
+	b, err := NewMemoryBackend(0, "snapshot", path, 0, compression)
+	if err != nil {
+		t.Fatalf("NewMemoryBackend: %v", err)
+	}
+	return b
+}
+
+func putMem(t *testing.T, b *MemoryBackend, key, data string) {
+	t.Helper()
+	if _, _, err := b.PutObject(context.Background(), "bkt", key, strings.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("PutObject %s: %v", key, err)
+	}
+}
+
+// memContents returns every object in b as key -> data.
+func memContents(b *MemoryBackend) map[string]string {
+	got := make(map[string]string)
+	for k, obj := range b.objects {
+		got[k] = string(obj.Data)
+	}
+	return got
+}
+
+func assertMemContents(t *testing.T, b *MemoryBackend, want map[string]string) {
+	t.Helper()
+	got := memContents(b)
+	if len(got) != len(want) {
+		t.Fatalf("objects = %v, want %v", got, want)
+	}
+	var size int64
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("object %s = %q, want %q", k, got[k], v)
+		}
+		size += int64(len(v))
+	}
+	for _, part := range b.parts {
+		size += int64(len(part.Data))
+	}
+	if b.currentSize != size {
+		t.Errorf("currentSize = %d, want %d", b.currentSize, size)
+	}
+}
+
+func TestMemorySnapshotRoundTrip(t *testing.T) {
+	for _, compression := range []string{"zstd", "none"} {
+		t.Run(compression, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "memory.snap")
+			b := newSnapshotBackend(t, path, compression)
+			putMem(t, b, "a", strings.Repeat("compressible ", 1000))
+			putMem(t, b, "empty", "")
+			if _, err := b.PutPart(context.Background(), "bkt", "mp", "upload-1", 3, strings.NewReader("part"), 4); err != nil {
+				t.Fatalf("PutPart: %v", err)
+			}
+			if err := b.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat snapshot: %v", err)
+			}
+			if compression == "zstd" && info.Size() > 1000 {
+				t.Errorf("zstd snapshot is %d bytes, want it compressed", info.Size())
+			}
+
+			b = newSnapshotBackend(t, path, compression)
+			defer b.Close()
+			assertMemContents(t, b, map[string]string{
+				"bkt/a":     strings.Repeat("compressible ", 1000),
+				"bkt/empty": "",
+			})
+			rc, _, _, err := b.GetObject(context.Background(), "bkt", "a")
+			if err != nil {
+				t.Fatalf("GetObject: %v", err)
+			}
+			rc.Close()
+			if part := b.parts[partKey("upload-1", 3)]; string(part.Data) != "part" || part.ETag != computeETag([]byte("part")) {
+				t.Errorf("part = %+v", part)
+			}
+		})
+	}
+}
+
+func TestMemorySnapshotIncremental(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.snap")
+	b := newSnapshotBackend(t, path, "zstd")
+	putMem(t, b, "keep", strings.Repeat("k", 10000))
+	putMem(t, b, "gone", "bye")
+	putMem(t, b, "changed", "old")
+	if err := b.writeSnapshot(); err != nil {
+		t.Fatalf("full snapshot: %v", err)
+	}
+	generation := b.snap.generation
+
+	// Nothing changed: no file is written.
+	if err := b.writeSnapshot(); err != nil {
+		t.Fatalf("idle snapshot: %v", err)
+	}
+	if b.snap.deltas != 0 {
+		t.Fatalf("idle snapshot wrote a delta")
+	}
+
+	putMem(t, b, "changed", "new")
+	putMem(t, b, "added", "hello")
+	b.DeleteObject(context.Background(), "bkt", "gone")
+	if err := b.writeSnapshot(); err != nil {
+		t.Fatalf("delta snapshot: %v", err)
+	}
+	if b.snap.generation != generation || b.snap.deltas != 1 {
+		t.Fatalf("chain = %+v, want one delta on generation %x", b.snap, generation)
+	}
+	delta, err := readSnapshotFile(b.deltaPath(generation, 1))
+	if err != nil {
+		t.Fatalf("reading delta: %v", err)
+	}
+	if len(delta.records) != 3 {
+		t.Errorf("delta has %d records, want 3 (only the changes)", len(delta.records))
+	}
+	b.Close()
+
+	b = newSnapshotBackend(t, path, "zstd")
+	defer b.Close()
+	assertMemContents(t, b, map[string]string{
+		"bkt/keep":    strings.Repeat("k", 10000),
+		"bkt/changed": "new",
+		"bkt/added":   "hello",
+	})
+}
+
+func TestMemorySnapshotFallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.snap")
+	b := newSnapshotBackend(t, path, "zstd")
+	putMem(t, b, "v", "one")
+	if err := b.writeSnapshot(); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	putMem(t, b, "v", "two")
+	b.snap.forceFull = true
+	if err := b.writeSnapshot(); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	putMem(t, b, "w", "delta")
+	if err := b.writeSnapshot(); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	deltaPath := b.deltaPath(b.snap.generation, 1)
+	// Stop without the final snapshot on Close.
+	b.persistence = "none"
+	b.Close()
+
+	flipByte := func(path string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)/2] ^= 0xff
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A corrupt delta is dropped; the full snapshot it applies to is used.
+	flipByte(deltaPath)
+	b = newSnapshotBackend(t, path, "zstd")
+	assertMemContents(t, b, map[string]string{"bkt/v": "two"})
+	if !b.snap.forceFull {
+		t.Error("partial chain load should force a full snapshot next")
+	}
+	b.persistence = "none"
+	b.Close()
+
+	// A corrupt full snapshot falls back to the previous one.
+	flipByte(path)
+	b = newSnapshotBackend(t, path, "zstd")
+	assertMemContents(t, b, map[string]string{"bkt/v": "one"})
+	b.persistence = "none"
+	b.Close()
+
+	// With no good snapshot left, loading fails rather than starting empty.
+	flipByte(path + ".prev")
+	if _, err := NewMemoryBackend(0, "snapshot", path, 0, "zstd"); err == nil {
+		t.Fatal("loading corrupt snapshots succeeded")
+	}
+}
+
+func TestMemorySnapshotTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.snap")
+	b := newSnapshotBackend(t, path, "none")
+	putMem(t, b, "x", strings.Repeat("x", 4096))
+	b.Close()
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := f.Stat()
+	f.Truncate(info.Size() - 100)
+	f.Close()
+	if _, err := readSnapshotFile(path); err == nil {
+		t.Fatal("truncated snapshot accepted")
+	}
+}
+
+func TestMemorySnapshotLoadsSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.snap")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE object_snapshots (bucket TEXT, key TEXT, data BLOB, etag TEXT, PRIMARY KEY (bucket, key));
+		CREATE TABLE part_snapshots (upload_id TEXT, part_number INTEGER, data BLOB, etag TEXT, PRIMARY KEY (upload_id, part_number));
+		INSERT INTO object_snapshots VALUES ('bkt', 'legacy', X'6869', '"etag"');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("creating legacy snapshot: %v", err)
+	}
+
+	b := newSnapshotBackend(t, path, "zstd")
+	assertMemContents(t, b, map[string]string{"bkt/legacy": "hi"})
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The legacy file is replaced by the new format on the next snapshot.
+	b = newSnapshotBackend(t, path, "zstd")
+	defer b.Close()
+	assertMemContents(t, b, map[string]string{"bkt/legacy": "hi"})
+	rc, _, _, _ := b.GetObject(context.Background(), "bkt", "legacy")
+	data, _ := io.ReadAll(rc)
+	if string(data) != "hi" {
+		t.Errorf("GetObject = %q", data)
+	}
+	if isSQLiteFile(path) {
+		t.Error("snapshot still in SQLite format")
+	}
+}
@@ -0,0 +1,547 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// MirrorTarget is one copy location of a MirrorBackend, labelled with the
+// failure domain (rack, room, availability zone) it lives in.
+type MirrorTarget struct {
+	Name    string
+	Zone    string
+	Backend StorageBackend
+}
+
+// MirrorBackend stores each object on several targets. The targets for a
+// key are chosen by rendezvous hashing, so every node agrees on them without
+// a lookup table, and are spread across zones before any zone gets a second
+// copy: with copies >= zones, every zone holds a copy and losing a whole zone
+// loses no data.
+//
+// Writes go to all placed targets at once and succeed if the copies that
+// landed span at least minZones zones; otherwise the written copies are
+// removed and the write fails. A target that missed a write while down may
+// hold an old copy when it returns. ObjectPlacement reports such objects.
+type MirrorBackend struct {
+	targets  []MirrorTarget
+	zones    []string
+	copies   int
+	minZones int
+}
+
+// PlacementPolicy describes a replicated backend's targets and the rules
+// that place copies on them.
+type PlacementPolicy struct {
+	// Copies is the number of targets each object is written to.
+	Copies int `json:"copies"`
+	// MinZones is the number of distinct zones a write must reach.
+	MinZones int               `json:"min_zones"`
+	Zones    []string          `json:"zones"`
+	Targets  []PlacementTarget `json:"targets"`
+}
+
+// PlacementTarget describes one target and whether it passed a health check.
+type PlacementTarget struct {
+	Name    string `json:"name"`
+	Zone    string `json:"zone"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ObjectPlacement reports where the copies of one object are.
+type ObjectPlacement struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Placed lists the targets the policy assigns to the key, in read order.
+	Placed []string `json:"placed"`
+	// Copies lists the targets actually holding the object.
+	Copies []PlacementCopy `json:"copies"`
+	// Zones is the number of distinct zones holding a copy.
+	Zones int `json:"zones"`
+	// Satisfied is true when every placed target holds a copy and the
+	// copies agree in size.
+	Satisfied bool `json:"satisfied"`
+	// Divergent is true when copies differ in size, e.g. after a target
+	// missed an overwrite.
+	Divergent bool `json:"divergent"`
+}
+
+// PlacementCopy is one stored copy of an object.
+type PlacementCopy struct {
+	Target string `json:"target"`
+	Zone   string `json:"zone"`
+	Size   int64  `json:"size"`
+}
+
+// PlacementReporter is an optional interface for backends that keep several
+// copies of each object and can report where they are.
+type PlacementReporter interface {
+	// PlacementPolicy returns the policy and the current health of each target.
+	PlacementPolicy(ctx context.Context) *PlacementPolicy
+	// ObjectPlacement locates the copies of bucket/key.
+	ObjectPlacement(ctx context.Context, bucket, key string) (*ObjectPlacement, error)
+}
+
+// NewMirrorBackend creates a MirrorBackend writing copies of each object
+// (0 = every target) and requiring minZones distinct zones per write
+// (0 = as many zones as copies can cover). A target without a zone is a zone
+// of its own.
+func NewMirrorBackend(targets []MirrorTarget, copies, minZones int) (*MirrorBackend, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("mirror backend requires at least one target")
+	}
+	m := &MirrorBackend{}
+	names := make(map[string]bool)
+	zones := make(map[string]bool)
+	for _, t := range targets {
+		if t.Name == "" || t.Backend == nil {
+			return nil, fmt.Errorf("mirror target needs a name and a backend")
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("duplicate mirror target %q", t.Name)
+		}
+		names[t.Name] = true
+		if t.Zone == "" {
+			t.Zone = t.Name
+		}
+		if !zones[t.Zone] {
+			zones[t.Zone] = true
+			m.zones = append(m.zones, t.Zone)
+		}
+		m.targets = append(m.targets, t)
+	}
+	sort.Strings(m.zones)
+
+	m.copies = copies
+	if m.copies == 0 {
+		m.copies = len(m.targets)
+	}
+	if m.copies < 0 || m.copies > len(m.targets) {
+		return nil, fmt.Errorf("mirror copies must be between 1 and %d targets, got %d", len(m.targets), copies)
+	}
+	m.minZones = minZones
+	if m.minZones == 0 {
+		m.minZones = min(m.copies, len(m.zones))
+	}
+	if m.minZones < 0 || m.minZones > min(m.copies, len(m.zones)) {
+		return nil, fmt.Errorf("mirror min_zones must be between 1 and %d, got %d", min(m.copies, len(m.zones)), minZones)
+	}
+	return m, nil
+}
+
+// rendezvousScore ranks target for bucket/key.
+func rendezvousScore(target, bucket, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(target))
+	h.Write([]byte{0})
+	h.Write([]byte(bucket))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	// FNV-1a mixes its last bytes poorly; finish with the SplitMix64 mixer
+	// so that similar keys still rank targets independently.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// ranked returns every target ordered by rendezvous score for bucket/key.
+// The first copies targets, zones first, are the placement; the rest are
+// read fallbacks.
+func (m *MirrorBackend) ranked(bucket, key string) []*MirrorTarget {
+	byScore := make([]*MirrorTarget, len(m.targets))
+	scores := make(map[*MirrorTarget]uint64, len(m.targets))
+	for i := range m.targets {
+		byScore[i] = &m.targets[i]
+		scores[byScore[i]] = rendezvousScore(m.targets[i].Name, bucket, key)
+	}
+	sort.Slice(byScore, func(a, b int) bool { return scores[byScore[a]] > scores[byScore[b]] })
+
+	// Take the best target of each zone first, then fill the remaining
+	// copies by score.
+	out := make([]*MirrorTarget, 0, len(byScore))
+	used := make(map[*MirrorTarget]bool)
+	seen := make(map[string]bool)
+	for _, t := range byScore {
+		if len(out) < m.copies && !seen[t.Zone] {
+			seen[t.Zone] = true
+			used[t] = true
+			out = append(out, t)
+		}
+	}
+	for _, t := range byScore {
+		if !used[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// placement returns the targets that receive writes to bucket/key.
+func (m *MirrorBackend) placement(bucket, key string) []*MirrorTarget {
+	return m.ranked(bucket, key)[:m.copies]
+}
+
+// copyResult is the outcome of writing one copy.
+type copyResult struct {
+	target *MirrorTarget
+	etag   string
+	n      int64
+	err    error
+}
+
+// writeCopies runs write on every target concurrently and checks the
+// outcome against the zone quorum. If the quorum is missed, the copies that
+// were written are removed again.
+func (m *MirrorBackend) writeCopies(ctx context.Context, bucket, key string, targets []*MirrorTarget, write func(t *MirrorTarget) (int64, string, error)) (int64, string, error) {
+	results := make([]copyResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, etag, err := write(t)
+			results[i] = copyResult{target: t, etag: etag, n: n, err: err}
+		}()
+	}
+	wg.Wait()
+
+	var ok []copyResult
+	var errs []error
+	zones := make(map[string]bool)
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("target %q: %w", r.target.Name, r.err))
+			continue
+		}
+		ok = append(ok, r)
+		zones[r.target.Zone] = true
+	}
+	if len(zones) < m.minZones {
+		for _, r := range ok {
+			r.target.Backend.DeleteObject(ctx, bucket, key)
+		}
+		return 0, "", fmt.Errorf("wrote %s/%s to %d of %d zones required: %w", bucket, key, len(zones), m.minZones, errors.Join(errs...))
+	}
+	if len(errs) > 0 {
+		slog.Warn("Mirror write missed targets", "bucket", bucket, "key", key, "error", errors.Join(errs...))
+	}
+	return ok[0].n, ok[0].etag, nil
+}
+
+// PutObject streams the object to every placed target at once.
+func (m *MirrorBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	targets := m.placement(bucket, key)
+	readers, copyErr := fanOut(reader, targets)
+	n, etag, err := m.writeCopies(ctx, bucket, key, targets, func(t *MirrorTarget) (int64, string, error) {
+		n, etag, err := t.Backend.PutObject(ctx, bucket, key, readers[t], size)
+		closeFanOut(readers[t], err)
+		return n, etag, err
+	})
+	if cerr := <-copyErr; cerr != nil && err == nil {
+		return 0, "", fmt.Errorf("reading object data: %w", cerr)
+	}
+	return n, etag, err
+}
+
+// fanOut feeds reader to one pipe per target while the targets read them.
+// A target that fails closes its pipe and is dropped from the fan-out; the
+// rest go on. The channel yields the error reading reader once every pipe
+// is closed.
+func fanOut(reader io.Reader, targets []*MirrorTarget) (map[*MirrorTarget]*io.PipeReader, <-chan error) {
+	pipes := make([]*io.PipeWriter, len(targets))
+	readers := make(map[*MirrorTarget]*io.PipeReader, len(targets))
+	for i, t := range targets {
+		readers[t], pipes[i] = io.Pipe()
+	}
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(&fanOutWriter{pipes: pipes}, reader)
+		for _, p := range pipes {
+			p.CloseWithError(err)
+		}
+		copyErr <- err
+	}()
+	return readers, copyErr
+}
+
+// closeFanOut closes a target's pipe once the target is done with it,
+// failing it with the target's error or otherwise dropping anything the
+// target left unread, so the fan-out does not block on it.
+func closeFanOut(pr *io.PipeReader, err error) {
+	if err != nil {
+		pr.CloseWithError(err)
+	} else {
+		pr.CloseWithError(io.ErrClosedPipe)
+	}
+}
+
+// fanOutWriter copies each write to every pipe still open.
+type fanOutWriter struct {
+	pipes []*io.PipeWriter
+	dead  []bool
+}
+
+func (f *fanOutWriter) Write(p []byte) (int, error) {
+	if f.dead == nil {
+		f.dead = make([]bool, len(f.pipes))
+	}
+	alive := 0
+	for i, w := range f.pipes {
+		if f.dead[i] {
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			f.dead[i] = true
+			continue
+		}
+		alive++
+	}
+	if alive == 0 {
+		return 0, errors.New("every mirror target failed")
+	}
+	return len(p), nil
+}
+
+// GetObject reads the object from the first placed target that holds it,
+// falling back to the other targets.
+func (m *MirrorBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	var lastErr error
+	for _, t := range m.ranked(bucket, key) {
+		rc, size, etag, err := t.Backend.GetObject(ctx, bucket, key)
+		if err == nil {
+			return rc, size, etag, nil
+		}
+		lastErr = err
+	}
+	return nil, 0, "", lastErr
+}
+
+// PreloadObject warms the copy that reads are served from.
+func (m *MirrorBackend) PreloadObject(ctx context.Context, bucket, key string) (int64, error) {
+	for _, t := range m.ranked(bucket, key) {
+		if ok, _ := t.Backend.ObjectExists(ctx, bucket, key); !ok {
+			continue
+		}
+		if pl, ok := t.Backend.(Preloader); ok {
+			return pl.PreloadObject(ctx, bucket, key)
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("object not found: %s/%s", bucket, key)
+}
+
+// DeleteObject removes the object from every target. It fails only if no
+// target could be reached: a copy left on a target that is down is
+// unreferenced once the metadata is gone.
+func (m *MirrorBackend) DeleteObject(ctx context.Context, bucket, key string) error {
+	var errs []error
+	for _, t := range m.targets {
+		if err := t.Backend.DeleteObject(ctx, bucket, key); err != nil {
+			errs = append(errs, fmt.Errorf("target %q: %w", t.Name, err))
+		}
+	}
+	if len(errs) == len(m.targets) {
+		return errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		slog.Warn("Mirror delete missed targets", "bucket", bucket, "key", key, "error", errors.Join(errs...))
+	}
+	return nil
+}
+
+// CopyObject reads the source from one copy and writes the destination to
+// its own placement.
+func (m *MirrorBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (string, error) {
+	rc, size, _, err := m.GetObject(ctx, srcBucket, srcKey)
+	if err != nil {
+		return "", fmt.Errorf("source object not found: %s/%s", srcBucket, srcKey)
+	}
+	defer rc.Close()
+	_, etag, err := m.PutObject(ctx, dstBucket, dstKey, rc, size)
+	if err != nil {
+		return "", fmt.Errorf("copying object data: %w", err)
+	}
+	return etag, nil
+}
+
+// PutPart streams the part to every target placed for the final object,
+// so each can assemble its own copy.
+func (m *MirrorBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	targets := m.placement(bucket, key)
+	readers, copyErr := fanOut(reader, targets)
+	results := make([]copyResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			etag, err := t.Backend.PutPart(ctx, bucket, key, uploadID, partNumber, readers[t], size)
+			closeFanOut(readers[t], err)
+			results[i] = copyResult{target: t, etag: etag, err: err}
+		}()
+	}
+	wg.Wait()
+	cerr := <-copyErr
+
+	// A part missing from a target only fails that target's assembly, which
+	// the zone quorum then accounts for.
+	var errs []error
+	for _, r := range results {
+		if r.err == nil {
+			if cerr != nil {
+				return "", fmt.Errorf("reading part data: %w", cerr)
+			}
+			return r.etag, nil
+		}
+		errs = append(errs, fmt.Errorf("target %q: %w", r.target.Name, r.err))
+	}
+	return "", errors.Join(errs...)
+}
+
+// AssembleParts assembles the object on every placed target.
+func (m *MirrorBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	_, etag, err := m.writeCopies(ctx, bucket, key, m.placement(bucket, key), func(t *MirrorTarget) (int64, string, error) {
+		etag, err := t.Backend.AssembleParts(ctx, bucket, key, uploadID, partNumbers)
+		return 0, etag, err
+	})
+	if err != nil {
+		m.DeleteParts(ctx, bucket, key, uploadID)
+	}
+	return etag, err
+}
+
+// DeleteParts removes the upload's parts from every target.
+func (m *MirrorBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
+	var errs []error
+	for _, t := range m.targets {
+		if err := t.Backend.DeleteParts(ctx, bucket, key, uploadID); err != nil {
+			errs = append(errs, fmt.Errorf("target %q: %w", t.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteUploadParts removes the parts directory of an upload from every
+// target that keeps parts on disk. Used during startup reaping of expired
+// uploads.
+func (m *MirrorBackend) DeleteUploadParts(uploadID string) error {
+	var errs []error
+	for _, t := range m.targets {
+		if c, ok := t.Backend.(interface{ DeleteUploadParts(string) error }); ok {
+			if err := c.DeleteUploadParts(uploadID); err != nil {
+				errs = append(errs, fmt.Errorf("target %q: %w", t.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CreateBucket creates the bucket on every target.
+func (m *MirrorBackend) CreateBucket(ctx context.Context, bucket string) error {
+	for _, t := range m.targets {
+		if err := t.Backend.CreateBucket(ctx, bucket); err != nil {
+			return fmt.Errorf("target %q: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteBucket removes the bucket from every target.
+func (m *MirrorBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	for _, t := range m.targets {
+		if err := t.Backend.DeleteBucket(ctx, bucket); err != nil {
+			return fmt.Errorf("target %q: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// ObjectExists reports whether any target holds the object.
+func (m *MirrorBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	for _, t := range m.ranked(bucket, key) {
+		if ok, err := t.Backend.ObjectExists(ctx, bucket, key); err == nil && ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HealthCheck fails when the healthy targets span fewer zones than a write
+// needs.
+func (m *MirrorBackend) HealthCheck(ctx context.Context) error {
+	policy := m.PlacementPolicy(ctx)
+	zones := make(map[string]bool)
+	var errs []error
+	for _, t := range policy.Targets {
+		if t.Healthy {
+			zones[t.Zone] = true
+		} else {
+			errs = append(errs, fmt.Errorf("target %q: %s", t.Name, t.Error))
+		}
+	}
+	if len(zones) < m.minZones {
+		return fmt.Errorf("%d of %d required zones healthy: %w", len(zones), m.minZones, errors.Join(errs...))
+	}
+	return nil
+}
+
+// PlacementPolicy returns the policy and checks the health of each target.
+func (m *MirrorBackend) PlacementPolicy(ctx context.Context) *PlacementPolicy {
+	p := &PlacementPolicy{Copies: m.copies, MinZones: m.minZones, Zones: m.zones}
+	for _, t := range m.targets {
+		pt := PlacementTarget{Name: t.Name, Zone: t.Zone, Healthy: true}
+		if err := t.Backend.HealthCheck(ctx); err != nil {
+			pt.Healthy, pt.Error = false, err.Error()
+		}
+		p.Targets = append(p.Targets, pt)
+	}
+	return p
+}
+
+// ObjectPlacement checks every target for a copy of bucket/key.
+func (m *MirrorBackend) ObjectPlacement(ctx context.Context, bucket, key string) (*ObjectPlacement, error) {
+	p := &ObjectPlacement{Bucket: bucket, Key: key, Copies: []PlacementCopy{}}
+	held := make(map[string]bool)
+	zones := make(map[string]bool)
+	for _, t := range m.ranked(bucket, key) {
+		if len(p.Placed) < m.copies {
+			p.Placed = append(p.Placed, t.Name)
+		}
+		rc, size, _, err := t.Backend.GetObject(ctx, bucket, key)
+		if err != nil {
+			continue
+		}
+		rc.Close()
+		if len(p.Copies) > 0 && size != p.Copies[0].Size {
+			p.Divergent = true
+		}
+		p.Copies = append(p.Copies, PlacementCopy{Target: t.Name, Zone: t.Zone, Size: size})
+		held[t.Name] = true
+		zones[t.Zone] = true
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.Zones = len(zones)
+	p.Satisfied = !p.Divergent
+	for _, name := range p.Placed {
+		if !held[name] {
+			p.Satisfied = false
+		}
+	}
+	return p, nil
+}
+
+var _ StorageBackend = (*MirrorBackend)(nil)
+var _ PlacementReporter = (*MirrorBackend)(nil)
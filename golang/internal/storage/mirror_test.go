@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// flakyBackend is a LocalBackend that fails every call while down.
+type flakyBackend struct {
+	*LocalBackend
+	down bool
+}
+
+var errTargetDown = errors.New("target down")
+
+func (f *flakyBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	if f.down {
+		return 0, "", errTargetDown
+	}
+	return f.LocalBackend.PutObject(ctx, bucket, key, reader, size)
+}
+
+func (f *flakyBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	if f.down {
+		return "", errTargetDown
+	}
+	return f.LocalBackend.PutPart(ctx, bucket, key, uploadID, partNumber, reader, size)
+}
+
+func (f *flakyBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	if f.down {
+		return nil, 0, "", errTargetDown
+	}
+	return f.LocalBackend.GetObject(ctx, bucket, key)
+}
+
+func (f *flakyBackend) HealthCheck(ctx context.Context) error {
+	if f.down {
+		return errTargetDown
+	}
+	return f.LocalBackend.HealthCheck(ctx)
+}
+
+// newTestMirror builds a mirror over one flaky local target per "name:zone"
+// spec.
+func newTestMirror(t *testing.T, copies, minZones int, specs ...string) (*MirrorBackend, map[string]*flakyBackend) {
+	t.Helper()
+	base := t.TempDir()
+	backends := make(map[string]*flakyBackend)
+	var targets []MirrorTarget
+	for _, spec := range specs {
+		name, zone, _ := strings.Cut(spec, ":")
+		local, err := NewLocalBackend(filepath.Join(base, name))
+		if err != nil {
+			t.Fatalf("NewLocalBackend: %v", err)
+		}
+		backends[name] = &flakyBackend{LocalBackend: local}
+		targets = append(targets, MirrorTarget{Name: name, Zone: zone, Backend: backends[name]})
+	}
+	m, err := NewMirrorBackend(targets, copies, minZones)
+	if err != nil {
+		t.Fatalf("NewMirrorBackend: %v", err)
+	}
+	m.CreateBucket(context.Background(), "b")
+	return m, backends
+}
+
+func TestMirrorPlacementSpreadsZones(t *testing.T) {
+	m, _ := newTestMirror(t, 2, 0, "a1:a", "a2:a", "b1:b", "b2:b")
+	perTarget := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		key := "key-" + strconv.Itoa(i)
+		placed := m.placement("b", key)
+		if placed[0].Zone == placed[1].Zone {
+			t.Fatalf("%s placed twice in zone %s", key, placed[0].Zone)
+		}
+		for _, p := range placed {
+			perTarget[p.Name]++
+		}
+		if again := m.placement("b", key); again[0] != placed[0] || again[1] != placed[1] {
+			t.Fatalf("placement of %s is not stable", key)
+		}
+	}
+	for name, n := range perTarget {
+		// 800 copies over 4 targets: each should get roughly 200.
+		if n < 120 || n > 280 {
+			t.Errorf("target %s got %d of 800 copies", name, n)
+		}
+	}
+}
+
+func TestMirrorZoneFailure(t *testing.T) {
+	ctx := context.Background()
+	m, backends := newTestMirror(t, 3, 2, "a1:a", "b1:b", "c1:c")
+
+	// One zone down: the write still reaches the two zones it needs.
+	backends["c1"].down = true
+	if _, _, err := m.PutObject(ctx, "b", "k", strings.NewReader("hello"), 5); err != nil {
+		t.Fatalf("PutObject with one zone down: %v", err)
+	}
+	p, err := m.ObjectPlacement(ctx, "b", "k")
+	if err != nil {
+		t.Fatalf("ObjectPlacement: %v", err)
+	}
+	if p.Satisfied || p.Zones != 2 || len(p.Copies) != 2 {
+		t.Errorf("placement with c1 down = %+v, want 2 zones, unsatisfied", p)
+	}
+
+	// Reads fall back past a failed copy.
+	backends["a1"].down = true
+	rc, _, _, err := m.GetObject(ctx, "b", "k")
+	if err != nil {
+		t.Fatalf("GetObject with a1 and c1 down: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "hello" {
+		t.Errorf("GetObject = %q, want hello", data)
+	}
+
+	// Two zones down: the write misses its quorum and leaves nothing behind.
+	if _, _, err := m.PutObject(ctx, "b", "k2", strings.NewReader("x"), 1); err == nil {
+		t.Fatal("PutObject with two zones down succeeded")
+	}
+	if ok, _ := backends["b1"].ObjectExists(ctx, "b", "k2"); ok {
+		t.Error("copy of a failed write left on b1")
+	}
+	if err := m.HealthCheck(ctx); err == nil {
+		t.Error("HealthCheck passed with one of three zones healthy")
+	}
+
+	backends["a1"].down, backends["c1"].down = false, false
+	if err := m.HealthCheck(ctx); err != nil {
+		t.Errorf("HealthCheck: %v", err)
+	}
+}
+
+func TestMirrorPutPart(t *testing.T) {
+	ctx := context.Background()
+	m, backends := newTestMirror(t, 3, 2, "a1:a", "b1:b", "c1:c")
+
+	// A target that is down is skipped; the others get the streamed part.
+	backends["c1"].down = true
+	part := strings.Repeat("0123456789", 100000)
+	if _, err := m.PutPart(ctx, "b", "mp", "u1", 1, strings.NewReader(part), int64(len(part))); err != nil {
+		t.Fatalf("PutPart with c1 down: %v", err)
+	}
+	backends["c1"].down = false
+	if _, err := m.AssembleParts(ctx, "b", "mp", "u1", []int{1}); err != nil {
+		t.Fatalf("AssembleParts: %v", err)
+	}
+	for _, name := range []string{"a1", "b1"} {
+		rc, _, _, err := backends[name].GetObject(ctx, "b", "mp")
+		if err != nil {
+			t.Fatalf("GetObject on %s: %v", name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != part {
+			t.Errorf("%s assembled %d bytes, want %d", name, len(data), len(part))
+		}
+	}
+
+	// A failure reading the part fails the call.
+	errRead := errors.New("client went away")
+	body := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errRead))
+	if _, err := m.PutPart(ctx, "b", "mp", "u2", 1, body, 100); err == nil {
+		t.Error("PutPart with a failing reader succeeded")
+	}
+}
+
+func TestMirrorObjectPlacementDivergent(t *testing.T) {
+	ctx := context.Background()
+	m, backends := newTestMirror(t, 0, 0, "a1:a", "b1:b")
+	if _, _, err := m.PutObject(ctx, "b", "k", strings.NewReader("v1"), 2); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	p, _ := m.ObjectPlacement(ctx, "b", "k")
+	if !p.Satisfied || len(p.Placed) != 2 || p.Zones != 2 {
+		t.Errorf("placement = %+v, want satisfied on both zones", p)
+	}
+
+	// b1 misses an overwrite.
+	backends["b1"].down = true
+	if _, _, err := m.PutObject(ctx, "b", "k", strings.NewReader("v2 longer"), 9); err == nil {
+		t.Fatal("PutObject reached both zones with b1 down")
+	}
+	backends["b1"].down = false
+	backends["a1"].PutObject(ctx, "b", "k", strings.NewReader("v2 longer"), 9)
+	if p, _ := m.ObjectPlacement(ctx, "b", "k"); !p.Divergent || p.Satisfied {
+		t.Errorf("placement after a missed overwrite = %+v, want divergent", p)
+	}
+}
+
+func TestNewMirrorBackendValidation(t *testing.T) {
+	local, _ := NewLocalBackend(t.TempDir())
+	two := []MirrorTarget{{Name: "x", Zone: "a", Backend: local}, {Name: "y", Zone: "a", Backend: local}}
+	for _, tc := range []struct {
+		name             string
+		targets          []MirrorTarget
+		copies, minZones int
+	}{
+		{"no targets", nil, 0, 0},
+		{"duplicate name", []MirrorTarget{two[0], two[0]}, 0, 0},
+		{"too many copies", two, 3, 0},
+		{"more zones than exist", two, 2, 2},
+	} {
+		if _, err := NewMirrorBackend(tc.targets, tc.copies, tc.minZones); err == nil {
+			t.Errorf("%s: NewMirrorBackend succeeded", tc.name)
+		}
+	}
+	m, err := NewMirrorBackend(two, 0, 0)
+	if err != nil {
+		t.Fatalf("NewMirrorBackend: %v", err)
+	}
+	if m.copies != 2 || m.minZones != 1 {
+		t.Errorf("defaults = %d copies, %d zones, want 2 and 1", m.copies, m.minZones)
+	}
+}
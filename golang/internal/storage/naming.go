@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path"
+)
+
+// Object naming schemes for LocalBackend.
+const (
+	NamingPlain  = "plain"
+	NamingHashed = "hashed"
+)
+
+// ObjectNamer maps an object to the path of its file under the bucket
+// directory of a LocalBackend, with "/" separators.
+type ObjectNamer interface {
+	FileName(bucket, key string) string
+}
+
+// PlainNames names each object file after its key, so a key with "/"
+// separators lives in subdirectories. It is the default.
+type PlainNames struct{}
+
+// FileName returns key.
+func (PlainNames) FileName(bucket, key string) string {
+	return key
+}
+
+// HashedNames names each object file after the HMAC-SHA256 of its bucket
+// and key, fanned out over two levels of directories by the leading hex
+// digits, so the files on disk do not reveal key names. The secret keeps
+// names from being confirmed by hashing guessed keys; objects written with
+// one secret are not found with another.
+type HashedNames struct {
+	secret []byte
+}
+
+// NewHashedNames returns a HashedNames keyed by secret.
+func NewHashedNames(secret string) (*HashedNames, error) {
+	if secret == "" {
+		return nil, errors.New("hashed object names need a secret")
+	}
+	return &HashedNames{secret: []byte(secret)}, nil
+}
+
+// FileName returns ab/cd/abcd…, the hex HMAC of bucket and key.
+func (h *HashedNames) FileName(bucket, key string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(bucket))
+	mac.Write([]byte{0})
+	mac.Write([]byte(key))
+	name := hex.EncodeToString(mac.Sum(nil))
+	return path.Join(name[:2], name[2:4], name)
+}
+
+// NameIndex records which key each object file name stands for, so files
+// named by a one-way ObjectNamer can be traced back to their objects, for
+// example by orphan collection. The sqlite metadata store implements it.
+type NameIndex interface {
+	// RecordObjectName records that file name in bucket holds key. Records
+	// outlive their objects until the bucket is deleted.
+	RecordObjectName(ctx context.Context, bucket, name, key string) error
+
+	// ObjectNameKey returns the key recorded for name, or "" if none is.
+	ObjectNameKey(ctx context.Context, bucket, name string) (string, error)
+}
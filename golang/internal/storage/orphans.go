@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFileChanged is returned by RemoveFile when the file was replaced or
+// modified after it was walked.
+var ErrFileChanged = errors.New("file changed since it was walked")
+
+// StoredFile is one file of object or multipart part data. Object files
+// have Bucket and Key set, and Name when the file is not named after its
+// key; part files UploadID and PartNumber. An object file named by an
+// ObjectNamer whose key was never recorded has only Bucket and Name.
+type StoredFile struct {
+	Bucket     string    `json:"bucket,omitempty"`
+	Key        string    `json:"key,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	UploadID   string    `json:"upload_id,omitempty"`
+	PartNumber int       `json:"part_number,omitempty"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+}
+
+// OrphanSweeper is an optional interface for backends that keep every
+// object and part in a file of its own, so files left behind by failed
+// writes, which no metadata record refers to, can be found and removed.
+type OrphanSweeper interface {
+	// WalkFiles calls fn for every object and part file.
+	WalkFiles(ctx context.Context, fn func(StoredFile) error) error
+
+	// RemoveFile deletes f, or moves it under the quarantine directory if
+	// quarantine is set. It returns ErrFileChanged, leaving the file, if
+	// its size or modification time differ from f's.
+	RemoveFile(ctx context.Context, f StoredFile, quarantine bool) error
+}
+
+// quarantineDir is where RemoveFile moves quarantined files, keeping their
+// layout: objects/{bucket}/{file name} and multipart/{uploadID}/{partNumber}.
+const quarantineDir = ".quarantine"
+
+// WalkFiles calls fn for every object file under a bucket directory and
+// every part file under .multipart. Directories whose names start with a
+// dot at the root hold internal state and are skipped. Files named by an
+// ObjectNamer are reported with the key recorded in the name index.
+func (b *LocalBackend) WalkFiles(ctx context.Context, fn func(StoredFile) error) error {
+	if b.namer != nil && b.names == nil {
+		if _, plain := b.namer.(PlainNames); !plain {
+			return errors.New("object file names cannot be traced to keys without a name index")
+		}
+	}
+	entries, err := os.ReadDir(b.RootDir)
+	if err != nil {
+		return fmt.Errorf("reading storage root: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		bucket := e.Name()
+		bucketDir := filepath.Join(b.RootDir, bucket)
+		err := filepath.WalkDir(bucketDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil // removed while walking
+				}
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			rel, _ := filepath.Rel(bucketDir, path)
+			f := StoredFile{Bucket: bucket, Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()}
+			if b.names != nil {
+				f.Name = f.Key
+				if f.Key, err = b.names.ObjectNameKey(ctx, bucket, f.Name); err != nil {
+					return fmt.Errorf("looking up file name %s: %w", f.Name, err)
+				}
+			}
+			return fn(f)
+		})
+		if err != nil {
+			return fmt.Errorf("walking bucket %s: %w", bucket, err)
+		}
+	}
+
+	uploads, err := os.ReadDir(filepath.Join(b.RootDir, ".multipart"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading multipart directory: %w", err)
+	}
+	for _, u := range uploads {
+		if !u.IsDir() {
+			continue
+		}
+		parts, err := os.ReadDir(filepath.Join(b.RootDir, ".multipart", u.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("reading upload %s: %w", u.Name(), err)
+		}
+		for _, p := range parts {
+			n, err := strconv.Atoi(p.Name())
+			if err != nil || !p.Type().IsRegular() {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			info, err := p.Info()
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return err
+			}
+			if err := fn(StoredFile{UploadID: u.Name(), PartNumber: n, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeObject removes the quarantined copy of bucket/key's file, if orphan
+// collection moved one aside.
+func (b *LocalBackend) PurgeObject(ctx context.Context, bucket, key string) error {
+	stopAt := filepath.Join(b.RootDir, quarantineDir, "objects", bucket)
+	path := filepath.Join(stopAt, filepath.FromSlash(b.fileName(bucket, key)))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing quarantined %s: %w", path, err)
+	}
+	cleanEmptyParents(filepath.Dir(path), stopAt)
+	return nil
+}
+
+// RemoveFile deletes or quarantines f and removes the directories left
+// empty. The size and modification time check guards against deleting
+// data written to the same path since f was walked: the atomic writes of
+// this backend always give a replaced file a new modification time.
+func (b *LocalBackend) RemoveFile(ctx context.Context, f StoredFile, quarantine bool) error {
+	var path, stopAt, dest string
+	if f.UploadID != "" {
+		stopAt = filepath.Join(b.RootDir, ".multipart")
+		path = filepath.Join(stopAt, f.UploadID, strconv.Itoa(f.PartNumber))
+		dest = filepath.Join(b.RootDir, quarantineDir, "multipart", f.UploadID, strconv.Itoa(f.PartNumber))
+	} else {
+		name := f.Name
+		if name == "" {
+			name = b.fileName(f.Bucket, f.Key)
+		}
+		stopAt = filepath.Join(b.RootDir, f.Bucket)
+		path = filepath.Join(stopAt, filepath.FromSlash(name))
+		dest = filepath.Join(b.RootDir, quarantineDir, "objects", f.Bucket, filepath.FromSlash(name))
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("checking %s: %w", path, err)
+	}
+	if info.Size() != f.Size || !info.ModTime().Equal(f.ModTime) {
+		return ErrFileChanged
+	}
+
+	if quarantine {
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return fmt.Errorf("creating quarantine directory: %w", err)
+		}
+		err = os.Rename(path, dest)
+	} else {
+		err = os.Remove(path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing %s: %w", path, err)
+	}
+	cleanEmptyParents(filepath.Dir(path), stopAt)
+	return nil
+}
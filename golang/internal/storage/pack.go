@@ -0,0 +1,764 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/bleepstore/bleepstore/internal/progress"
+)
+
+const (
+	// PackDirName is the directory under a local data root that holds the
+	// segment files and their index.
+	PackDirName = ".segments"
+
+	// packIndexName is the bbolt index file inside the pack directory.
+	packIndexName = "index.db"
+
+	// packLockStripes is the number of per-key lock stripes.
+	packLockStripes = 256
+)
+
+// Pack index buckets: "objects" maps bucket\x00key to a packLoc, "segments"
+// maps a big-endian segment ID to its segStats.
+var (
+	packObjectsBucket  = []byte("objects")
+	packSegmentsBucket = []byte("segments")
+)
+
+// PackOptions configures a PackedBackend.
+type PackOptions struct {
+	// ThresholdBytes is the largest object stored in a segment.
+	ThresholdBytes int64
+	// SegmentBytes is the size at which the active segment is sealed and a
+	// new one started.
+	SegmentBytes int64
+	// CompactRatio is the fraction of dead bytes at which a sealed segment
+	// is rewritten by Compact.
+	CompactRatio float64
+}
+
+// Compactor is an optional interface for backends that store objects in
+// append-only files and must rewrite them to reclaim the space of
+// overwritten and deleted objects.
+type Compactor interface {
+	Compact(ctx context.Context) (*CompactResult, error)
+}
+
+// CompactResult summarizes a compaction pass.
+type CompactResult struct {
+	Segments       int   `json:"segments"`
+	ObjectsMoved   int   `json:"objects_moved"`
+	BytesReclaimed int64 `json:"bytes_reclaimed"`
+}
+
+// PackedBackend stores small objects by appending them to large segment
+// files instead of giving each its own file, so millions of tiny objects
+// cost a handful of inodes and back up as a few sequential files. Objects
+// above the threshold, multipart parts and everything else go to the inner
+// backend.
+//
+// A bbolt index records where each packed object lives and how many bytes
+// of each segment are still referenced. Writes append to the active
+// segment, fsync it, then commit the index; a crash between the two leaves
+// only unreferenced bytes, which are counted as dead on the next open.
+type PackedBackend struct {
+	inner StorageBackend
+	dir   string
+	opts  PackOptions
+	index *bolt.DB
+
+	locks [packLockStripes]sync.Mutex
+
+	// compactMu allows one compaction pass at a time.
+	compactMu sync.Mutex
+
+	// mu guards the active segment.
+	mu         sync.Mutex
+	active     *os.File
+	activeID   uint64
+	activeSize int64
+}
+
+// packLoc is where a packed object's data lives.
+type packLoc struct {
+	Segment uint64
+	Offset  int64
+	Length  int64
+	ETag    string
+}
+
+func (l packLoc) encode() []byte {
+	b := make([]byte, 24, 24+len(l.ETag))
+	binary.BigEndian.PutUint64(b[0:], l.Segment)
+	binary.BigEndian.PutUint64(b[8:], uint64(l.Offset))
+	binary.BigEndian.PutUint64(b[16:], uint64(l.Length))
+	return append(b, l.ETag...)
+}
+
+func decodePackLoc(b []byte) (packLoc, error) {
+	if len(b) < 24 {
+		return packLoc{}, fmt.Errorf("corrupt pack index entry (%d bytes)", len(b))
+	}
+	return packLoc{
+		Segment: binary.BigEndian.Uint64(b[0:]),
+		Offset:  int64(binary.BigEndian.Uint64(b[8:])),
+		Length:  int64(binary.BigEndian.Uint64(b[16:])),
+		ETag:    string(b[24:]),
+	}, nil
+}
+
+// segStats tracks a segment's written and unreferenced bytes.
+type segStats struct {
+	Size int64
+	Dead int64
+}
+
+func (s segStats) encode() []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[0:], uint64(s.Size))
+	binary.BigEndian.PutUint64(b[8:], uint64(s.Dead))
+	return b
+}
+
+func decodeSegStats(b []byte) segStats {
+	if len(b) < 16 {
+		return segStats{}
+	}
+	return segStats{
+		Size: int64(binary.BigEndian.Uint64(b[0:])),
+		Dead: int64(binary.BigEndian.Uint64(b[8:])),
+	}
+}
+
+func segKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+func packKey(bucket, key string) []byte {
+	return []byte(bucket + "\x00" + key)
+}
+
+// NewPackedBackend opens (or creates) the segment files and index in dir
+// and returns a backend that packs small objects there, passing everything
+// else to inner.
+func NewPackedBackend(inner StorageBackend, dir string, opts PackOptions) (*PackedBackend, error) {
+	if opts.ThresholdBytes <= 0 || opts.SegmentBytes <= 0 {
+		return nil, fmt.Errorf("pack threshold and segment size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating pack directory: %w", err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, packIndexName), 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening pack index: %w", err)
+	}
+	p := &PackedBackend{inner: inner, dir: dir, opts: opts, index: db}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(packObjectsBucket); err != nil {
+			return err
+		}
+		segs, err := tx.CreateBucketIfNotExists(packSegmentsBucket)
+		if err != nil {
+			return err
+		}
+		k, v := segs.Cursor().Last()
+		if k == nil {
+			p.activeID = 1
+			return segs.Put(segKey(p.activeID), segStats{}.encode())
+		}
+		// Bytes past the recorded size were appended by writes that never
+		// reached the index.
+		p.activeID = binary.BigEndian.Uint64(k)
+		st := decodeSegStats(v)
+		if info, err := os.Stat(p.segmentPath(p.activeID)); err == nil && info.Size() > st.Size {
+			st.Dead += info.Size() - st.Size
+			st.Size = info.Size()
+		}
+		p.activeSize = st.Size
+		return segs.Put(k, st.encode())
+	})
+	if err == nil {
+		p.active, err = p.openSegment(p.activeID)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening active segment: %w", err)
+	}
+	return p, nil
+}
+
+// Close syncs the active segment and closes the index.
+func (p *PackedBackend) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.active.Sync()
+	p.active.Close()
+	if cerr := p.index.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (p *PackedBackend) segmentPath(id uint64) string {
+	return filepath.Join(p.dir, fmt.Sprintf("seg-%016x.dat", id))
+}
+
+func (p *PackedBackend) openSegment(id uint64) (*os.File, error) {
+	return os.OpenFile(p.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+// lockKey locks the stripe for bucket/key and returns the unlock function.
+// It keeps the index and the inner backend consistent when the same key is
+// written with a small and a large body concurrently.
+func (p *PackedBackend) lockKey(bucket, key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(bucket))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	mu := &p.locks[h.Sum32()%packLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// appendData writes data to the active segment, sealing it first if data
+// would take it past SegmentBytes, and returns where the data landed.
+func (p *PackedBackend) appendData(data []byte) (uint64, int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.activeSize > 0 && p.activeSize+int64(len(data)) > p.opts.SegmentBytes {
+		if err := p.roll(); err != nil {
+			return 0, 0, err
+		}
+	}
+	off := p.activeSize
+	n, err := p.active.Write(data)
+	p.activeSize += int64(n)
+	if err != nil {
+		return 0, 0, fmt.Errorf("writing segment: %w", err)
+	}
+	if err := p.active.Sync(); err != nil {
+		return 0, 0, fmt.Errorf("syncing segment: %w", err)
+	}
+	return p.activeID, off, nil
+}
+
+// roll seals the active segment and starts the next one. Caller holds mu.
+func (p *PackedBackend) roll() error {
+	if err := p.active.Sync(); err != nil {
+		return fmt.Errorf("syncing segment: %w", err)
+	}
+	p.active.Close()
+	id := p.activeID + 1
+	err := p.index.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(packSegmentsBucket).Put(segKey(id), segStats{}.encode())
+	})
+	if err != nil {
+		return fmt.Errorf("registering segment: %w", err)
+	}
+	f, err := p.openSegment(id)
+	if err != nil {
+		return fmt.Errorf("creating segment: %w", err)
+	}
+	p.active, p.activeID, p.activeSize = f, id, 0
+	return nil
+}
+
+// updateSeg applies fn to a segment's stats. Segments already removed by
+// compaction are ignored.
+func updateSeg(tx *bolt.Tx, id uint64, fn func(*segStats)) error {
+	segs := tx.Bucket(packSegmentsBucket)
+	v := segs.Get(segKey(id))
+	if v == nil {
+		return nil
+	}
+	st := decodeSegStats(v)
+	fn(&st)
+	return segs.Put(segKey(id), st.encode())
+}
+
+// setLoc points bucket/key at loc, or removes it from the index when loc is
+// nil, counting the bytes of any previous location as dead.
+func (p *PackedBackend) setLoc(bucket, key string, loc *packLoc) error {
+	err := p.index.Update(func(tx *bolt.Tx) error {
+		objs := tx.Bucket(packObjectsBucket)
+		k := packKey(bucket, key)
+		if v := objs.Get(k); v != nil {
+			old, err := decodePackLoc(v)
+			if err != nil {
+				return err
+			}
+			if err := updateSeg(tx, old.Segment, func(st *segStats) { st.Dead += old.Length }); err != nil {
+				return err
+			}
+		} else if loc == nil {
+			return nil
+		}
+		if loc == nil {
+			return objs.Delete(k)
+		}
+		end := loc.Offset + loc.Length
+		if err := updateSeg(tx, loc.Segment, func(st *segStats) { st.Size = max(st.Size, end) }); err != nil {
+			return err
+		}
+		return objs.Put(k, loc.encode())
+	})
+	if err != nil {
+		return fmt.Errorf("updating pack index: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the packed location of bucket/key, if it is packed.
+func (p *PackedBackend) lookup(bucket, key string) (packLoc, bool, error) {
+	var (
+		loc packLoc
+		ok  bool
+	)
+	err := p.index.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(packObjectsBucket).Get(packKey(bucket, key))
+		if v == nil {
+			return nil
+		}
+		var err error
+		loc, err = decodePackLoc(v)
+		ok = err == nil
+		return err
+	})
+	if err != nil {
+		return packLoc{}, false, fmt.Errorf("reading pack index: %w", err)
+	}
+	return loc, ok, nil
+}
+
+// packedReader is a seekable reader over one record of a segment file.
+type packedReader struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (r *packedReader) Close() error { return r.f.Close() }
+
+// openPacked opens bucket/key's record if the object is packed. A segment
+// removed by a concurrent compaction is retried at the record's new
+// location.
+func (p *PackedBackend) openPacked(bucket, key string) (*packedReader, packLoc, bool, error) {
+	for attempt := 0; ; attempt++ {
+		loc, ok, err := p.lookup(bucket, key)
+		if err != nil || !ok {
+			return nil, packLoc{}, false, err
+		}
+		f, err := os.Open(p.segmentPath(loc.Segment))
+		if errors.Is(err, fs.ErrNotExist) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, packLoc{}, false, fmt.Errorf("opening segment for %q/%q: %w", bucket, key, err)
+		}
+		return &packedReader{SectionReader: io.NewSectionReader(f, loc.Offset, loc.Length), f: f}, loc, true, nil
+	}
+}
+
+// PutObject packs the object if it fits under the threshold and writes it
+// to the inner backend otherwise. A body of unknown size is buffered up to
+// the threshold to decide.
+func (p *PackedBackend) PutObject(ctx context.Context, bucket, key string, reader io.Reader, size int64) (int64, string, error) {
+	unlock := p.lockKey(bucket, key)
+	defer unlock()
+
+	if size <= p.opts.ThresholdBytes {
+		buf, err := io.ReadAll(io.LimitReader(reader, p.opts.ThresholdBytes+1))
+		if err != nil {
+			return 0, "", fmt.Errorf("reading object data: %w", err)
+		}
+		if int64(len(buf)) <= p.opts.ThresholdBytes {
+			return p.putPacked(ctx, bucket, key, buf)
+		}
+		reader = io.MultiReader(bytes.NewReader(buf), reader)
+	}
+	n, etag, err := p.inner.PutObject(ctx, bucket, key, reader, size)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := p.setLoc(bucket, key, nil); err != nil {
+		return 0, "", err
+	}
+	return n, etag, nil
+}
+
+// putPacked appends data as bucket/key. The caller holds the key's lock.
+func (p *PackedBackend) putPacked(ctx context.Context, bucket, key string, data []byte) (int64, string, error) {
+	etag := fmt.Sprintf(`"%x"`, md5.Sum(data))
+	seg, off, err := p.appendData(data)
+	if err != nil {
+		return 0, "", fmt.Errorf("packing %q/%q: %w", bucket, key, err)
+	}
+	loc := &packLoc{Segment: seg, Offset: off, Length: int64(len(data)), ETag: etag}
+	if err := p.setLoc(bucket, key, loc); err != nil {
+		return 0, "", err
+	}
+	// An earlier, larger version may still be a file in the inner backend.
+	if err := p.inner.DeleteObject(ctx, bucket, key); err != nil {
+		slog.Warn("Failed to remove unpacked copy of packed object", "bucket", bucket, "key", key, "error", err)
+	}
+	return int64(len(data)), etag, nil
+}
+
+// GetObject reads a packed object from its segment, or the object from the
+// inner backend. Packed objects are returned as a seekable reader.
+func (p *PackedBackend) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, int64, string, error) {
+	rc, loc, ok, err := p.openPacked(bucket, key)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if !ok {
+		return p.inner.GetObject(ctx, bucket, key)
+	}
+	return rc, loc.Length, loc.ETag, nil
+}
+
+// PreloadObject reads the object through so its pages are resident in the
+// OS page cache.
+func (p *PackedBackend) PreloadObject(ctx context.Context, bucket, key string) (int64, error) {
+	rc, _, _, err := p.GetObject(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	n, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return n, fmt.Errorf("reading object %q/%q: %w", bucket, key, err)
+	}
+	return n, nil
+}
+
+// DeleteObject drops the object from the index and the inner backend.
+func (p *PackedBackend) DeleteObject(ctx context.Context, bucket, key string) error {
+	unlock := p.lockKey(bucket, key)
+	defer unlock()
+	if err := p.setLoc(bucket, key, nil); err != nil {
+		return err
+	}
+	return p.inner.DeleteObject(ctx, bucket, key)
+}
+
+// CopyObject repacks a packed source and delegates everything else.
+func (p *PackedBackend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (string, error) {
+	rc, _, ok, err := p.openPacked(srcBucket, srcKey)
+	if err != nil {
+		return "", err
+	}
+	unlock := p.lockKey(dstBucket, dstKey)
+	defer unlock()
+	if ok {
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading source object: %w", err)
+		}
+		_, etag, err := p.putPacked(ctx, dstBucket, dstKey, data)
+		return etag, err
+	}
+	etag, err := p.inner.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey)
+	if err != nil {
+		return "", err
+	}
+	if err := p.setLoc(dstBucket, dstKey, nil); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+// PutPart delegates to the inner backend; parts are never packed.
+func (p *PackedBackend) PutPart(ctx context.Context, bucket, key, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	return p.inner.PutPart(ctx, bucket, key, uploadID, partNumber, reader, size)
+}
+
+// AssembleParts assembles the object in the inner backend and drops any
+// packed version of it.
+func (p *PackedBackend) AssembleParts(ctx context.Context, bucket, key, uploadID string, partNumbers []int) (string, error) {
+	unlock := p.lockKey(bucket, key)
+	defer unlock()
+	etag, err := p.inner.AssembleParts(ctx, bucket, key, uploadID, partNumbers)
+	if err != nil {
+		return "", err
+	}
+	if err := p.setLoc(bucket, key, nil); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+// DeleteParts delegates to the inner backend.
+func (p *PackedBackend) DeleteParts(ctx context.Context, bucket, key, uploadID string) error {
+	return p.inner.DeleteParts(ctx, bucket, key, uploadID)
+}
+
+// DeleteUploadParts removes an upload's parts if the inner backend can.
+func (p *PackedBackend) DeleteUploadParts(uploadID string) error {
+	if c, ok := p.inner.(interface{ DeleteUploadParts(string) error }); ok {
+		return c.DeleteUploadParts(uploadID)
+	}
+	return nil
+}
+
+// CreateBucket delegates to the inner backend.
+func (p *PackedBackend) CreateBucket(ctx context.Context, bucket string) error {
+	return p.inner.CreateBucket(ctx, bucket)
+}
+
+// DeleteBucket removes the bucket from the inner backend and drops any
+// index entries left under it.
+func (p *PackedBackend) DeleteBucket(ctx context.Context, bucket string) error {
+	if err := p.inner.DeleteBucket(ctx, bucket); err != nil {
+		return err
+	}
+	prefix := packKey(bucket, "")
+	err := p.index.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(packObjectsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			loc, err := decodePackLoc(v)
+			if err != nil {
+				return err
+			}
+			if err := updateSeg(tx, loc.Segment, func(st *segStats) { st.Dead += loc.Length }); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updating pack index: %w", err)
+	}
+	return nil
+}
+
+// ObjectExists reports whether the object is packed or in the inner backend.
+func (p *PackedBackend) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	_, ok, err := p.lookup(bucket, key)
+	if err != nil || ok {
+		return ok, err
+	}
+	return p.inner.ObjectExists(ctx, bucket, key)
+}
+
+// HealthCheck checks the inner backend and the pack directory.
+func (p *PackedBackend) HealthCheck(ctx context.Context) error {
+	if err := p.inner.HealthCheck(ctx); err != nil {
+		return err
+	}
+	if _, err := os.Stat(p.dir); err != nil {
+		return fmt.Errorf("pack directory: %w", err)
+	}
+	return nil
+}
+
+// Compact rewrites the live records of every sealed segment whose dead
+// bytes reach CompactRatio of its size into the active segment, then
+// deletes the old segment. Objects written or deleted while a segment is
+// being compacted keep their new state; their moved copies become dead.
+func (p *PackedBackend) Compact(ctx context.Context) (*CompactResult, error) {
+	return p.compact(ctx, p.opts.CompactRatio)
+}
+
+// PurgeObject removes the dead records of deleted objects, bucket/key's
+// among them, from every segment: the active segment is sealed if it holds
+// any, then every segment with dead bytes is compacted. Data of the inner
+// backend is purged by it.
+func (p *PackedBackend) PurgeObject(ctx context.Context, bucket, key string) error {
+	p.mu.Lock()
+	var st segStats
+	err := p.index.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(packSegmentsBucket).Get(segKey(p.activeID)); v != nil {
+			st = decodeSegStats(v)
+		}
+		return nil
+	})
+	if err == nil && st.Dead > 0 {
+		err = p.roll()
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if _, err := p.compact(ctx, 0); err != nil {
+		return err
+	}
+	if purger, ok := p.inner.(Purger); ok {
+		return purger.PurgeObject(ctx, bucket, key)
+	}
+	return nil
+}
+
+// compact rewrites the sealed segments whose dead bytes reach ratio of
+// their size.
+func (p *PackedBackend) compact(ctx context.Context, ratio float64) (*CompactResult, error) {
+	p.compactMu.Lock()
+	defer p.compactMu.Unlock()
+
+	p.mu.Lock()
+	activeID := p.activeID
+	p.mu.Unlock()
+
+	type record struct {
+		key []byte
+		loc packLoc
+	}
+	candidates := map[uint64]segStats{}
+	live := map[uint64][]record{}
+	err := p.index.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(packSegmentsBucket).ForEach(func(k, v []byte) error {
+			id, st := binary.BigEndian.Uint64(k), decodeSegStats(v)
+			if id != activeID && st.Dead > 0 && float64(st.Dead) >= ratio*float64(st.Size) {
+				candidates[id] = st
+			}
+			return nil
+		})
+		if err != nil || len(candidates) == 0 {
+			return err
+		}
+		return tx.Bucket(packObjectsBucket).ForEach(func(k, v []byte) error {
+			loc, err := decodePackLoc(v)
+			if err != nil {
+				return err
+			}
+			if _, ok := candidates[loc.Segment]; ok {
+				live[loc.Segment] = append(live[loc.Segment], record{key: bytes.Clone(k), loc: loc})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading pack index: %w", err)
+	}
+
+	res := &CompactResult{}
+	done := int64(0)
+	for id, st := range candidates {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		progress.Report(ctx, done, int64(len(candidates)))
+		done++
+		src, err := os.Open(p.segmentPath(id))
+		if err != nil && (len(live[id]) > 0 || !errors.Is(err, fs.ErrNotExist)) {
+			return res, fmt.Errorf("opening segment: %w", err)
+		}
+		var moved []record
+		var movedBytes int64
+		for _, rec := range live[id] {
+			data := make([]byte, rec.loc.Length)
+			if _, err := src.ReadAt(data, rec.loc.Offset); err != nil {
+				src.Close()
+				return res, fmt.Errorf("reading segment %d: %w", id, err)
+			}
+			seg, off, err := p.appendData(data)
+			if err != nil {
+				src.Close()
+				return res, err
+			}
+			moved = append(moved, record{key: rec.key, loc: packLoc{Segment: seg, Offset: off, Length: rec.loc.Length, ETag: rec.loc.ETag}})
+			movedBytes += rec.loc.Length
+		}
+		if src != nil {
+			src.Close()
+		}
+
+		err = p.index.Update(func(tx *bolt.Tx) error {
+			objs := tx.Bucket(packObjectsBucket)
+			for i, m := range moved {
+				old := live[id][i].loc
+				cur := objs.Get(m.key)
+				if cur != nil && bytes.Equal(cur, old.encode()) {
+					if err := objs.Put(m.key, m.loc.encode()); err != nil {
+						return err
+					}
+				}
+				end := m.loc.Offset + m.loc.Length
+				err := updateSeg(tx, m.loc.Segment, func(st *segStats) {
+					st.Size = max(st.Size, end)
+					if cur == nil || !bytes.Equal(cur, old.encode()) {
+						st.Dead += m.loc.Length
+					}
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Bucket(packSegmentsBucket).Delete(segKey(id))
+		})
+		if err != nil {
+			return res, fmt.Errorf("updating pack index: %w", err)
+		}
+		if err := os.Remove(p.segmentPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return res, fmt.Errorf("removing segment: %w", err)
+		}
+		res.Segments++
+		res.ObjectsMoved += len(moved)
+		res.BytesReclaimed += st.Size - movedBytes
+	}
+	return res, nil
+}
+
+// PackIndex is a read-only view of a pack directory for offline tools such
+// as bleepstore-meta verify.
+type PackIndex struct {
+	p *PackedBackend
+}
+
+// OpenPackIndex opens the pack index under root read-only. It returns nil
+// when root has no pack directory.
+func OpenPackIndex(root string) (*PackIndex, error) {
+	dir := filepath.Join(root, PackDirName)
+	path := filepath.Join(dir, packIndexName)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening pack index %s (is the server running?): %w", path, err)
+	}
+	return &PackIndex{p: &PackedBackend{dir: dir, index: db}}, nil
+}
+
+// Lookup returns the size of bucket/key if it is packed.
+func (pi *PackIndex) Lookup(bucket, key string) (int64, bool, error) {
+	loc, ok, err := pi.p.lookup(bucket, key)
+	return loc.Length, ok, err
+}
+
+// Open returns a reader over the packed data of bucket/key.
+func (pi *PackIndex) Open(bucket, key string) (io.ReadCloser, error) {
+	rc, _, ok, err := pi.p.openPacked(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("object not packed: %s/%s", bucket, key)
+	}
+	return rc, nil
+}
+
+// Close closes the index.
+func (pi *PackIndex) Close() error {
+	return pi.p.index.Close()
+}
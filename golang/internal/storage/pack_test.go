@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestPacked(t *testing.T, root string, segmentBytes int64) *PackedBackend {
+	t.Helper()
+	local, err := NewLocalBackend(root)
+	if err != nil {
+		t.Fatalf("NewLocalBackend failed: %v", err)
+	}
+	p, err := NewPackedBackend(local, filepath.Join(root, PackDirName),
+		PackOptions{ThresholdBytes: 8, SegmentBytes: segmentBytes, CompactRatio: 0.5})
+	if err != nil {
+		t.Fatalf("NewPackedBackend failed: %v", err)
+	}
+	return p
+}
+
+func putPacked(t *testing.T, p *PackedBackend, key, data string) {
+	t.Helper()
+	if _, _, err := p.PutObject(context.Background(), "bkt", key, strings.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("PutObject(%s) failed: %v", key, err)
+	}
+}
+
+func readPacked(t *testing.T, p *PackedBackend, key string) string {
+	t.Helper()
+	rc, _, _, err := p.GetObject(context.Background(), "bkt", key)
+	if err != nil {
+		t.Fatalf("GetObject(%s) failed: %v", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return string(data)
+}
+
+// segmentFiles returns the names of the segment files in p's directory.
+func segmentFiles(t *testing.T, p *PackedBackend) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(p.dir, "seg-*.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestPackedSmallObjectsSkipFiles(t *testing.T) {
+	root := t.TempDir()
+	p := newTestPacked(t, root, 1024)
+	defer p.Close()
+	ctx := context.Background()
+	p.CreateBucket(ctx, "bkt")
+
+	putPacked(t, p, "small", "tiny")
+	putPacked(t, p, "large", "more than eight bytes")
+	if _, err := os.Stat(filepath.Join(root, "bkt", "small")); !os.IsNotExist(err) {
+		t.Errorf("small object has its own file (stat err %v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "bkt", "large")); err != nil {
+		t.Errorf("large object file: %v", err)
+	}
+
+	// Shrinking an unpacked object moves it into a segment, and growing a
+	// packed one moves it out.
+	putPacked(t, p, "large", "now tiny")
+	putPacked(t, p, "small", "now more than eight bytes")
+	if _, err := os.Stat(filepath.Join(root, "bkt", "large")); !os.IsNotExist(err) {
+		t.Errorf("shrunk object kept its file (stat err %v)", err)
+	}
+	if got := readPacked(t, p, "large"); got != "now tiny" {
+		t.Errorf("large = %q", got)
+	}
+	if got := readPacked(t, p, "small"); got != "now more than eight bytes" {
+		t.Errorf("small = %q", got)
+	}
+	if _, ok, _ := p.lookup("bkt", "small"); ok {
+		t.Error("grown object still in the pack index")
+	}
+
+	// Unknown-size bodies are buffered to decide.
+	if _, _, err := p.PutObject(ctx, "bkt", "unknown", strings.NewReader("abc"), -1); err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+	if _, ok, _ := p.lookup("bkt", "unknown"); !ok {
+		t.Error("small unknown-size object was not packed")
+	}
+}
+
+func TestPackedSegmentRollover(t *testing.T) {
+	p := newTestPacked(t, t.TempDir(), 16)
+	defer p.Close()
+
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		putPacked(t, p, k, "sixbyt")
+	}
+	if n := len(segmentFiles(t, p)); n != 3 {
+		t.Errorf("segments = %d, want 3", n)
+	}
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		if got := readPacked(t, p, k); got != "sixbyt" {
+			t.Errorf("%s = %q", k, got)
+		}
+	}
+}
+
+func TestPackedCompaction(t *testing.T) {
+	root := t.TempDir()
+	p := newTestPacked(t, root, 16)
+	ctx := context.Background()
+
+	// Segment 1 holds a and b, segment 2 holds c and d.
+	for _, k := range []string{"a", "b", "c", "d"} {
+		putPacked(t, p, k, k+"-val1")
+	}
+	first := segmentFiles(t, p)[0]
+
+	// Kill a; segment 1 is now half dead.
+	p.DeleteObject(ctx, "bkt", "a")
+	res, err := p.Compact(ctx)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if res.Segments != 1 || res.ObjectsMoved != 1 || res.BytesReclaimed != 6 {
+		t.Errorf("result = %+v, want 1 segment, 1 moved, 6 reclaimed", res)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("compacted segment still exists (stat err %v)", err)
+	}
+	if ok, _ := p.ObjectExists(ctx, "bkt", "a"); ok {
+		t.Error("deleted object exists")
+	}
+	for _, k := range []string{"b", "c", "d"} {
+		if got := readPacked(t, p, k); got != k+"-val1" {
+			t.Errorf("%s = %q", k, got)
+		}
+	}
+
+	// The index survives a restart.
+	p.Close()
+	p = newTestPacked(t, root, 16)
+	defer p.Close()
+	for _, k := range []string{"b", "c", "d"} {
+		if got := readPacked(t, p, k); got != k+"-val1" {
+			t.Errorf("after reopen %s = %q", k, got)
+		}
+	}
+	putPacked(t, p, "e", "e-val1")
+	if got := readPacked(t, p, "e"); got != "e-val1" {
+		t.Errorf("e = %q", got)
+	}
+}
+
+func TestPackedPurgeObject(t *testing.T) {
+	p := newTestPacked(t, t.TempDir(), 1024)
+	defer p.Close()
+	ctx := context.Background()
+
+	// Both records stay in the active segment, below any compaction ratio.
+	putPacked(t, p, "a", "secret-a")
+	putPacked(t, p, "b", "keep-b")
+	p.DeleteObject(ctx, "bkt", "a")
+	if err := p.PurgeObject(ctx, "bkt", "a"); err != nil {
+		t.Fatalf("PurgeObject failed: %v", err)
+	}
+	for _, name := range segmentFiles(t, p) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("secret-a")) {
+			t.Errorf("%s still holds the purged object", filepath.Base(name))
+		}
+	}
+	if got := readPacked(t, p, "b"); got != "keep-b" {
+		t.Errorf("b = %q", got)
+	}
+}
+
+func TestPackedRecoversUnindexedTail(t *testing.T) {
+	root := t.TempDir()
+	p := newTestPacked(t, root, 1024)
+	putPacked(t, p, "a", "first")
+	p.Close()
+
+	// Simulate a crash after an append reached the segment but not the index.
+	f, err := os.OpenFile(filepath.Join(root, PackDirName, "seg-0000000000000001.dat"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("junk")
+	f.Close()
+
+	p = newTestPacked(t, root, 1024)
+	defer p.Close()
+	putPacked(t, p, "b", "second")
+	if got := readPacked(t, p, "a"); got != "first" {
+		t.Errorf("a = %q", got)
+	}
+	if got := readPacked(t, p, "b"); got != "second" {
+		t.Errorf("b = %q", got)
+	}
+	var st segStats
+	p.index.View(func(tx *bolt.Tx) error {
+		st = decodeSegStats(tx.Bucket(packSegmentsBucket).Get(segKey(1)))
+		return nil
+	})
+	if st.Size != 15 || st.Dead != 4 {
+		t.Errorf("segment stats = %+v, want size 15, dead 4", st)
+	}
+}
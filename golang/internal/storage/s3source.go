@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Source reads objects from an S3-compatible service holding copies of
+// this instance's data, to repair objects found damaged. With Bucket empty
+// the source uses the same bucket and key names (another BleepStore
+// instance replicating this one); otherwise it is the upstream bucket of an
+// AWS gateway deployment and objects are read from {Prefix}{bucket}/{key}.
+type S3Source struct {
+	Bucket string
+	Prefix string
+	client S3API
+}
+
+// NewS3Source creates an S3Source over a client built like the AWS gateway
+// backend's.
+func NewS3Source(ctx context.Context, bucket, prefix, region, endpointURL string, usePathStyle bool, accessKeyID, secretAccessKey string) (*S3Source, error) {
+	client, err := newS3Client(ctx, region, endpointURL, usePathStyle, accessKeyID, secretAccessKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewS3SourceWithClient(bucket, prefix, client), nil
+}
+
+// NewS3SourceWithClient creates an S3Source with a pre-configured client.
+func NewS3SourceWithClient(bucket, prefix string, client S3API) *S3Source {
+	return &S3Source{Bucket: bucket, Prefix: prefix, client: client}
+}
+
+// OpenObject returns the source's copy of bucket/key.
+func (s *S3Source) OpenObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	if s.Bucket != "" {
+		bucket, key = s.Bucket, s.Prefix+bucket+"/"+key
+	}
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isAWSNotFound(err) {
+			return nil, fmt.Errorf("object not found at source: %s/%s", bucket, key)
+		}
+		return nil, fmt.Errorf("getting object from source: %w", err)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ReplicaAttrs are the object attributes copied to a replica along with
+// its data.
+type ReplicaAttrs struct {
+	ContentType        string
+	ContentEncoding    string
+	ContentLanguage    string
+	ContentDisposition string
+	CacheControl       string
+	// Expires is an HTTP date; it is dropped if it does not parse.
+	Expires      string
+	StorageClass string
+	Metadata     map[string]string
+}
+
+// S3Target writes replicas of objects to an S3-compatible service, for
+// bucket replication.
+type S3Target struct {
+	client S3API
+}
+
+// NewS3Target creates an S3Target over a client built like the AWS gateway
+// backend's.
+func NewS3Target(ctx context.Context, region, endpointURL string, usePathStyle bool, accessKeyID, secretAccessKey string) (*S3Target, error) {
+	client, err := newS3Client(ctx, region, endpointURL, usePathStyle, accessKeyID, secretAccessKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewS3TargetWithClient(client), nil
+}
+
+// NewS3TargetWithClient creates an S3Target with a pre-configured client.
+func NewS3TargetWithClient(client S3API) *S3Target {
+	return &S3Target{client: client}
+}
+
+// PutObject writes size bytes from body to bucket/key on the target.
+// body must be seekable so the request can be signed and retried.
+func (t *S3Target) PutObject(ctx context.Context, bucket, key string, body io.ReadSeeker, size int64, attrs ReplicaAttrs) error {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		Metadata:      attrs.Metadata,
+	}
+	if attrs.ContentType != "" {
+		input.ContentType = aws.String(attrs.ContentType)
+	}
+	if attrs.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(attrs.ContentEncoding)
+	}
+	if attrs.ContentLanguage != "" {
+		input.ContentLanguage = aws.String(attrs.ContentLanguage)
+	}
+	if attrs.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(attrs.ContentDisposition)
+	}
+	if attrs.CacheControl != "" {
+		input.CacheControl = aws.String(attrs.CacheControl)
+	}
+	if expires, err := http.ParseTime(attrs.Expires); err == nil {
+		input.Expires = aws.Time(expires)
+	}
+	if attrs.StorageClass != "" {
+		input.StorageClass = types.StorageClass(attrs.StorageClass)
+	}
+	if _, err := t.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("putting replica %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// DeleteObject deletes bucket/key on the target. Deleting a missing object
+// is not an error.
+func (t *S3Target) DeleteObject(ctx context.Context, bucket, key string) error {
+	_, err := t.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil && !isAWSNotFound(err) {
+		return fmt.Errorf("deleting replica %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// ObjectExists reports whether bucket/key exists on the target.
+func (t *S3Target) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	_, err := t.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+	if isAWSNotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("checking replica %s/%s: %w", bucket, key, err)
+}
+
+// ReplicaInfo describes a replica on the target.
+type ReplicaInfo struct {
+	Size int64
+	// ETag is unquoted.
+	ETag string
+}
+
+// StatObject returns the size and ETag of bucket/key on the target, or nil
+// if it does not exist.
+func (t *S3Target) StatObject(ctx context.Context, bucket, key string) (*ReplicaInfo, error) {
+	out, err := t.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isAWSNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("checking replica %s/%s: %w", bucket, key, err)
+	}
+	return &ReplicaInfo{Size: aws.ToInt64(out.ContentLength), ETag: strings.Trim(aws.ToString(out.ETag), `"`)}, nil
+}
@@ -0,0 +1,266 @@
+// Package storagetest provides a conformance suite for storage.StorageBackend
+// implementations, so every backend stores, copies and assembles object data
+// the same way.
+//
+// A backend's test file calls RunSuite with a factory returning an empty
+// backend:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.RunSuite(t, func(t *testing.T) storage.StorageBackend {
+//			return newTestBackend(t)
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/storage"
+)
+
+// Factory returns a new, empty backend. It should register any cleanup
+// with t.Cleanup.
+type Factory func(t *testing.T) storage.StorageBackend
+
+// RunSuite runs every conformance case as a subtest, each against a fresh
+// backend from factory.
+func RunSuite(t *testing.T, factory Factory) {
+	cases := []struct {
+		name string
+		fn   func(t *testing.T, b storage.StorageBackend)
+	}{
+		{"HealthCheck", testHealthCheck},
+		{"PutGetObject", testPutGetObject},
+		{"OverwriteObject", testOverwriteObject},
+		{"DeleteObject", testDeleteObject},
+		{"CopyObject", testCopyObject},
+		{"MultipartAssemble", testMultipartAssemble},
+		{"DeleteParts", testDeleteParts},
+		{"EmptyObject", testEmptyObject},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := factory(t)
+			c.fn(t, b)
+		})
+	}
+}
+
+// quotedMD5 returns the quoted hex MD5 ETag of data.
+func quotedMD5(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// compositeETag returns the S3 multipart ETag for the given parts.
+func compositeETag(parts ...[]byte) string {
+	var sums []byte
+	for _, p := range parts {
+		sum := md5.Sum(p)
+		sums = append(sums, sum[:]...)
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(parts))
+}
+
+func createBucket(t *testing.T, b storage.StorageBackend, name string) {
+	t.Helper()
+	if err := b.CreateBucket(context.Background(), name); err != nil {
+		t.Fatalf("CreateBucket(%s): %v", name, err)
+	}
+}
+
+func put(t *testing.T, b storage.StorageBackend, bucket, key string, data []byte) string {
+	t.Helper()
+	n, etag, err := b.PutObject(context.Background(), bucket, key, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("PutObject(%s/%s): %v", bucket, key, err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("PutObject(%s/%s) wrote %d bytes, want %d", bucket, key, n, len(data))
+	}
+	return etag
+}
+
+// read returns an object's data, failing the test if the reported size
+// does not match.
+func read(t *testing.T, b storage.StorageBackend, bucket, key string) []byte {
+	t.Helper()
+	rc, size, _, err := b.GetObject(context.Background(), bucket, key)
+	if err != nil {
+		t.Fatalf("GetObject(%s/%s): %v", bucket, key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading %s/%s: %v", bucket, key, err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("GetObject(%s/%s) size = %d, read %d bytes", bucket, key, size, len(data))
+	}
+	return data
+}
+
+func exists(t *testing.T, b storage.StorageBackend, bucket, key string) bool {
+	t.Helper()
+	ok, err := b.ObjectExists(context.Background(), bucket, key)
+	if err != nil {
+		t.Fatalf("ObjectExists(%s/%s): %v", bucket, key, err)
+	}
+	return ok
+}
+
+func testHealthCheck(t *testing.T, b storage.StorageBackend) {
+	if err := b.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck: %v", err)
+	}
+}
+
+func testPutGetObject(t *testing.T, b storage.StorageBackend) {
+	createBucket(t, b, "data")
+	data := []byte("hello, conformance")
+	if etag := put(t, b, "data", "nested/dir/key.txt", data); etag != quotedMD5(data) {
+		t.Errorf("PutObject ETag = %s, want %s", etag, quotedMD5(data))
+	}
+	if got := read(t, b, "data", "nested/dir/key.txt"); !bytes.Equal(got, data) {
+		t.Errorf("GetObject = %q, want %q", got, data)
+	}
+	if !exists(t, b, "data", "nested/dir/key.txt") {
+		t.Error("ObjectExists = false after PutObject")
+	}
+	if exists(t, b, "data", "nested/dir") {
+		t.Error("ObjectExists is true for a key prefix")
+	}
+	if _, _, _, err := b.GetObject(context.Background(), "data", "missing"); err == nil {
+		t.Error("GetObject(missing) succeeded")
+	}
+}
+
+func testOverwriteObject(t *testing.T, b storage.StorageBackend) {
+	createBucket(t, b, "data")
+	put(t, b, "data", "key", []byte("a much longer first version"))
+	put(t, b, "data", "key", []byte("short"))
+	if got := read(t, b, "data", "key"); string(got) != "short" {
+		t.Errorf("GetObject after overwrite = %q", got)
+	}
+}
+
+func testDeleteObject(t *testing.T, b storage.StorageBackend) {
+	ctx := context.Background()
+	createBucket(t, b, "data")
+	put(t, b, "data", "key", []byte("x"))
+	put(t, b, "data", "keep", []byte("y"))
+
+	if err := b.DeleteObject(ctx, "data", "key"); err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if exists(t, b, "data", "key") {
+		t.Error("object exists after DeleteObject")
+	}
+	if !exists(t, b, "data", "keep") {
+		t.Error("DeleteObject removed another object")
+	}
+	// Deleting a missing object is not an error.
+	if err := b.DeleteObject(ctx, "data", "key"); err != nil {
+		t.Errorf("DeleteObject(missing): %v", err)
+	}
+}
+
+func testCopyObject(t *testing.T, b storage.StorageBackend) {
+	ctx := context.Background()
+	createBucket(t, b, "src")
+	createBucket(t, b, "dst")
+	data := []byte(strings.Repeat("copy me ", 100))
+	put(t, b, "src", "from", data)
+
+	etag, err := b.CopyObject(ctx, "src", "from", "dst", "to")
+	if err != nil {
+		t.Fatalf("CopyObject: %v", err)
+	}
+	if etag != quotedMD5(data) {
+		t.Errorf("CopyObject ETag = %s, want %s", etag, quotedMD5(data))
+	}
+	if got := read(t, b, "dst", "to"); !bytes.Equal(got, data) {
+		t.Error("copied data differs from source")
+	}
+	if got := read(t, b, "src", "from"); !bytes.Equal(got, data) {
+		t.Error("CopyObject changed the source")
+	}
+	if _, err := b.CopyObject(ctx, "src", "missing", "dst", "to2"); err == nil {
+		t.Error("CopyObject(missing source) succeeded")
+	}
+}
+
+func testMultipartAssemble(t *testing.T, b storage.StorageBackend) {
+	ctx := context.Background()
+	createBucket(t, b, "mp")
+	parts := [][]byte{
+		bytes.Repeat([]byte("a"), 1000),
+		bytes.Repeat([]byte("b"), 1000),
+		[]byte("tail"),
+	}
+	for i, p := range parts {
+		etag, err := b.PutPart(ctx, "mp", "big", "upload-1", i+1, bytes.NewReader(p), int64(len(p)))
+		if err != nil {
+			t.Fatalf("PutPart(%d): %v", i+1, err)
+		}
+		if etag != quotedMD5(p) {
+			t.Errorf("PutPart(%d) ETag = %s, want %s", i+1, etag, quotedMD5(p))
+		}
+	}
+	// Re-uploading a part replaces it.
+	parts[1] = bytes.Repeat([]byte("B"), 1000)
+	if _, err := b.PutPart(ctx, "mp", "big", "upload-1", 2, bytes.NewReader(parts[1]), int64(len(parts[1]))); err != nil {
+		t.Fatalf("PutPart(2, again): %v", err)
+	}
+
+	etag, err := b.AssembleParts(ctx, "mp", "big", "upload-1", []int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("AssembleParts: %v", err)
+	}
+	if want := compositeETag(parts...); etag != want {
+		t.Errorf("AssembleParts ETag = %s, want %s", etag, want)
+	}
+	if got := read(t, b, "mp", "big"); !bytes.Equal(got, bytes.Join(parts, nil)) {
+		t.Errorf("assembled object has %d bytes, want the concatenated parts", len(got))
+	}
+}
+
+func testDeleteParts(t *testing.T, b storage.StorageBackend) {
+	ctx := context.Background()
+	createBucket(t, b, "mp")
+	for n := 1; n <= 2; n++ {
+		if _, err := b.PutPart(ctx, "mp", "obj", "upload-2", n, strings.NewReader("part"), 4); err != nil {
+			t.Fatalf("PutPart(%d): %v", n, err)
+		}
+	}
+	if err := b.DeleteParts(ctx, "mp", "obj", "upload-2"); err != nil {
+		t.Fatalf("DeleteParts: %v", err)
+	}
+	if _, err := b.AssembleParts(ctx, "mp", "obj", "upload-2", []int{1, 2}); err == nil {
+		t.Error("AssembleParts succeeded after DeleteParts")
+	}
+	if exists(t, b, "mp", "obj") {
+		t.Error("DeleteParts left an object behind")
+	}
+}
+
+func testEmptyObject(t *testing.T, b storage.StorageBackend) {
+	createBucket(t, b, "data")
+	if etag := put(t, b, "data", "empty", nil); etag != quotedMD5(nil) {
+		t.Errorf("PutObject(empty) ETag = %s, want %s", etag, quotedMD5(nil))
+	}
+	if got := read(t, b, "data", "empty"); len(got) != 0 {
+		t.Errorf("GetObject(empty) = %q", got)
+	}
+	if !exists(t, b, "data", "empty") {
+		t.Error("empty object does not exist")
+	}
+}
@@ -0,0 +1,157 @@
+// Package website validates bucket website configurations and applies
+// their redirects and routing rules to requests for the website endpoint.
+package website
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+// ErrInvalidConfig is wrapped by the errors Validate returns for a website
+// configuration it does not accept.
+var ErrInvalidConfig = errors.New("invalid website configuration")
+
+// maxRoutingRules is the most routing rules a configuration may hold, as in
+// S3.
+const maxRoutingRules = 50
+
+// Validate checks a configuration. It either redirects every request, and
+// then holds nothing else, or names an index document.
+func Validate(cfg *xmlutil.WebsiteConfiguration) error {
+	if all := cfg.RedirectAllRequestsTo; all != nil {
+		if cfg.IndexDocument != nil || cfg.ErrorDocument != nil || cfg.RoutingRules != nil {
+			return fmt.Errorf("%w: RedirectAllRequestsTo cannot be combined with other elements", ErrInvalidConfig)
+		}
+		if all.HostName == "" {
+			return fmt.Errorf("%w: RedirectAllRequestsTo requires a HostName", ErrInvalidConfig)
+		}
+		return validProtocol(all.Protocol)
+	}
+	if cfg.IndexDocument == nil || cfg.IndexDocument.Suffix == "" {
+		return fmt.Errorf("%w: an IndexDocument Suffix is required", ErrInvalidConfig)
+	}
+	if strings.Contains(cfg.IndexDocument.Suffix, "/") {
+		return fmt.Errorf("%w: the IndexDocument Suffix cannot contain a slash", ErrInvalidConfig)
+	}
+	if cfg.ErrorDocument != nil && cfg.ErrorDocument.Key == "" {
+		return fmt.Errorf("%w: an ErrorDocument Key is required", ErrInvalidConfig)
+	}
+	if cfg.RoutingRules == nil {
+		return nil
+	}
+	if len(cfg.RoutingRules.Rules) > maxRoutingRules {
+		return fmt.Errorf("%w: more than %d routing rules", ErrInvalidConfig, maxRoutingRules)
+	}
+	for i := range cfg.RoutingRules.Rules {
+		rule := &cfg.RoutingRules.Rules[i]
+		if c := rule.Condition; c != nil && c.HTTPErrorCodeReturnedEquals != "" {
+			if code, err := strconv.Atoi(c.HTTPErrorCodeReturnedEquals); err != nil || code < 400 || code > 599 {
+				return fmt.Errorf("%w: routing rule %d: HttpErrorCodeReturnedEquals must be a 4xx or 5xx code", ErrInvalidConfig, i+1)
+			}
+		}
+		rd := &rule.Redirect
+		if rd.ReplaceKeyWith != "" && rd.ReplaceKeyPrefixWith != "" {
+			return fmt.Errorf("%w: routing rule %d: ReplaceKeyWith and ReplaceKeyPrefixWith are mutually exclusive", ErrInvalidConfig, i+1)
+		}
+		if rd.HTTPRedirectCode != "" {
+			if code, err := strconv.Atoi(rd.HTTPRedirectCode); err != nil || code < 300 || code > 399 {
+				return fmt.Errorf("%w: routing rule %d: HttpRedirectCode must be a 3xx code", ErrInvalidConfig, i+1)
+			}
+		}
+		if err := validProtocol(rd.Protocol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validProtocol checks the Protocol of a redirect.
+func validProtocol(protocol string) error {
+	if protocol != "" && protocol != "http" && protocol != "https" {
+		return fmt.Errorf("%w: Protocol must be http or https", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Request is what the redirects of a website request depend on.
+type Request struct {
+	// Scheme and Host are those the request was made with.
+	Scheme string
+	Host   string
+	// Key is the requested key, without the leading slash and before the
+	// index document is appended.
+	Key string
+}
+
+// Redirect is where, and with which status code, a request is redirected.
+type Redirect struct {
+	Location string
+	Code     int
+}
+
+// RedirectAll returns the redirect of every request to a bucket whose
+// configuration has RedirectAllRequestsTo, or nil. The key is kept.
+func RedirectAll(cfg *xmlutil.WebsiteConfiguration, req Request) *Redirect {
+	all := cfg.RedirectAllRequestsTo
+	if all == nil {
+		return nil
+	}
+	return &Redirect{Location: location(all, req, req.Key), Code: 301}
+}
+
+// Route returns the redirect of the first routing rule that applies to
+// req, or nil. With status 0 it considers the rules without an
+// HttpErrorCodeReturnedEquals condition, which apply before the request is
+// served; otherwise only those whose condition is status, which apply when
+// the request fails with it.
+func Route(cfg *xmlutil.WebsiteConfiguration, req Request, status int) *Redirect {
+	if cfg.RoutingRules == nil {
+		return nil
+	}
+	want := ""
+	if status != 0 {
+		want = strconv.Itoa(status)
+	}
+	for i := range cfg.RoutingRules.Rules {
+		rule := &cfg.RoutingRules.Rules[i]
+		var prefix, code string
+		if c := rule.Condition; c != nil {
+			prefix, code = c.KeyPrefixEquals, c.HTTPErrorCodeReturnedEquals
+		}
+		if code != want || !strings.HasPrefix(req.Key, prefix) {
+			continue
+		}
+		rd := &rule.Redirect
+		key := req.Key
+		switch {
+		case rd.ReplaceKeyWith != "":
+			key = rd.ReplaceKeyWith
+		case rd.ReplaceKeyPrefixWith != "":
+			key = rd.ReplaceKeyPrefixWith + strings.TrimPrefix(req.Key, prefix)
+		}
+		redirect := &Redirect{Location: location(rd, req, key), Code: 301}
+		if rd.HTTPRedirectCode != "" {
+			redirect.Code, _ = strconv.Atoi(rd.HTTPRedirectCode)
+		}
+		return redirect
+	}
+	return nil
+}
+
+// location returns the URL of key on the redirect's host and protocol,
+// each defaulting to the request's.
+func location(rd *xmlutil.WebsiteRedirect, req Request, key string) string {
+	u := url.URL{Scheme: req.Scheme, Host: req.Host, Path: "/" + key}
+	if rd.Protocol != "" {
+		u.Scheme = rd.Protocol
+	}
+	if rd.HostName != "" {
+		u.Host = rd.HostName
+	}
+	return u.String()
+}
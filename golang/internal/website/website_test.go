@@ -0,0 +1,98 @@
+package website
+
+import (
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/bleepstore/bleepstore/internal/xmlutil"
+)
+
+func parse(t *testing.T, doc string) *xmlutil.WebsiteConfiguration {
+	t.Helper()
+	cfg := &xmlutil.WebsiteConfiguration{}
+	if err := xml.Unmarshal([]byte(doc), cfg); err != nil {
+		t.Fatalf("decoding %s: %v", doc, err)
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	index := `<IndexDocument><Suffix>index.html</Suffix></IndexDocument>`
+	for name, doc := range map[string]string{
+		"empty":              `<WebsiteConfiguration/>`,
+		"index with a slash": `<WebsiteConfiguration><IndexDocument><Suffix>a/index.html</Suffix></IndexDocument></WebsiteConfiguration>`,
+		"redirect all without host": `<WebsiteConfiguration><RedirectAllRequestsTo><Protocol>https</Protocol>
+			</RedirectAllRequestsTo></WebsiteConfiguration>`,
+		"redirect all and index": `<WebsiteConfiguration><RedirectAllRequestsTo><HostName>example.com</HostName>
+			</RedirectAllRequestsTo>` + index + `</WebsiteConfiguration>`,
+		"bad protocol": `<WebsiteConfiguration><RedirectAllRequestsTo><HostName>example.com</HostName>
+			<Protocol>ftp</Protocol></RedirectAllRequestsTo></WebsiteConfiguration>`,
+		"empty error document": `<WebsiteConfiguration>` + index + `<ErrorDocument/></WebsiteConfiguration>`,
+		"bad redirect code": `<WebsiteConfiguration>` + index + `<RoutingRules><RoutingRule>
+			<Redirect><HttpRedirectCode>200</HttpRedirectCode></Redirect></RoutingRule></RoutingRules></WebsiteConfiguration>`,
+		"bad error code": `<WebsiteConfiguration>` + index + `<RoutingRules><RoutingRule>
+			<Condition><HttpErrorCodeReturnedEquals>302</HttpErrorCodeReturnedEquals></Condition>
+			<Redirect><HostName>example.com</HostName></Redirect></RoutingRule></RoutingRules></WebsiteConfiguration>`,
+		"both key replacements": `<WebsiteConfiguration>` + index + `<RoutingRules><RoutingRule>
+			<Redirect><ReplaceKeyWith>a</ReplaceKeyWith><ReplaceKeyPrefixWith>b</ReplaceKeyPrefixWith></Redirect>
+			</RoutingRule></RoutingRules></WebsiteConfiguration>`,
+	} {
+		if err := Validate(parse(t, doc)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: Validate = %v, want ErrInvalidConfig", name, err)
+		}
+	}
+
+	for _, doc := range []string{
+		`<WebsiteConfiguration>` + index + `<ErrorDocument><Key>404.html</Key></ErrorDocument></WebsiteConfiguration>`,
+		`<WebsiteConfiguration><RedirectAllRequestsTo><HostName>example.com</HostName></RedirectAllRequestsTo></WebsiteConfiguration>`,
+	} {
+		if err := Validate(parse(t, doc)); err != nil {
+			t.Errorf("Validate(%s) = %v", doc, err)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	cfg := parse(t, `<WebsiteConfiguration><IndexDocument><Suffix>index.html</Suffix></IndexDocument>
+		<RoutingRules>
+			<RoutingRule><Condition><KeyPrefixEquals>docs/</KeyPrefixEquals></Condition>
+				<Redirect><ReplaceKeyPrefixWith>documents/</ReplaceKeyPrefixWith></Redirect></RoutingRule>
+			<RoutingRule><Condition><KeyPrefixEquals>old</KeyPrefixEquals></Condition>
+				<Redirect><ReplaceKeyWith>new.html</ReplaceKeyWith><HttpRedirectCode>302</HttpRedirectCode></Redirect></RoutingRule>
+			<RoutingRule><Condition><HttpErrorCodeReturnedEquals>404</HttpErrorCodeReturnedEquals></Condition>
+				<Redirect><HostName>fallback.example.com</HostName><Protocol>https</Protocol></Redirect></RoutingRule>
+		</RoutingRules></WebsiteConfiguration>`)
+	req := func(key string) Request { return Request{Scheme: "http", Host: "site.web.local", Key: key} }
+
+	for _, tc := range []struct {
+		key      string
+		status   int
+		location string
+		code     int
+	}{
+		{"docs/a b.html", 0, "http://site.web.local/documents/a%20b.html", 301},
+		{"old/page.html", 0, "http://site.web.local/new.html", 302},
+		{"missing.html", 404, "https://fallback.example.com/missing.html", 301},
+	} {
+		rd := Route(cfg, req(tc.key), tc.status)
+		if rd == nil || rd.Location != tc.location || rd.Code != tc.code {
+			t.Errorf("Route(%q, %d) = %+v, want %d to %s", tc.key, tc.status, rd, tc.code, tc.location)
+		}
+	}
+	if rd := Route(cfg, req("missing.html"), 0); rd != nil {
+		t.Errorf("error rule applied without an error: %+v", rd)
+	}
+	if rd := Route(cfg, req("private.html"), 403); rd != nil {
+		t.Errorf("404 rule applied to a 403: %+v", rd)
+	}
+
+	all := parse(t, `<WebsiteConfiguration><RedirectAllRequestsTo><HostName>example.com</HostName>
+		<Protocol>https</Protocol></RedirectAllRequestsTo></WebsiteConfiguration>`)
+	if rd := RedirectAll(all, req("a/b.html")); rd == nil || rd.Location != "https://example.com/a/b.html" || rd.Code != 301 {
+		t.Errorf("RedirectAll = %+v", rd)
+	}
+	if RedirectAll(cfg, req("a")) != nil {
+		t.Error("RedirectAll without RedirectAllRequestsTo")
+	}
+}
@@ -38,6 +38,7 @@ type Owner struct {
 type Bucket struct {
 	Name         string `xml:"Name"`
 	CreationDate string `xml:"CreationDate"`
+	BucketRegion string `xml:"BucketRegion,omitempty"`
 }
 
 // ListAllMyBucketsResult is the XML structure for ListBuckets responses.
@@ -214,6 +215,156 @@ type AccessControlPolicy struct {
 	AccessControlList ACL      `xml:"AccessControlList"`
 }
 
+// ReplicationConfiguration is the XML body of PutBucketReplication and the
+// response of GetBucketReplication. Request bodies are accepted with or
+// without the S3 namespace; responses carry it.
+type ReplicationConfiguration struct {
+	XMLName xml.Name          `xml:"ReplicationConfiguration"`
+	Xmlns   string            `xml:"xmlns,attr,omitempty"`
+	Role    string            `xml:"Role,omitempty"`
+	Rules   []ReplicationRule `xml:"Rule"`
+}
+
+// ReplicationRule is one rule of a replication configuration. Prefix is the
+// legacy form of Filter.Prefix.
+type ReplicationRule struct {
+	ID                      string                   `xml:"ID,omitempty"`
+	Priority                int                      `xml:"Priority,omitempty"`
+	Status                  string                   `xml:"Status"`
+	Prefix                  *string                  `xml:"Prefix"`
+	Filter                  *ReplicationFilter       `xml:"Filter"`
+	Destination             ReplicationDestination   `xml:"Destination"`
+	DeleteMarkerReplication *DeleteMarkerReplication `xml:"DeleteMarkerReplication"`
+}
+
+// ReplicationFilter selects the objects a replication rule applies to.
+// Tag and And are decoded only so that rules using them can be rejected.
+type ReplicationFilter struct {
+	Prefix string    `xml:"Prefix"`
+	Tag    *struct{} `xml:"Tag"`
+	And    *struct{} `xml:"And"`
+}
+
+// ReplicationDestination names the bucket objects are replicated to.
+type ReplicationDestination struct {
+	Bucket       string `xml:"Bucket"`
+	StorageClass string `xml:"StorageClass,omitempty"`
+}
+
+// DeleteMarkerReplication holds whether a rule replicates deletions.
+type DeleteMarkerReplication struct {
+	Status string `xml:"Status"`
+}
+
+// WebsiteConfiguration is the XML body of PutBucketWebsite and the
+// response of GetBucketWebsite. Request bodies are accepted with or
+// without the S3 namespace; responses carry it.
+type WebsiteConfiguration struct {
+	XMLName               xml.Name         `xml:"WebsiteConfiguration"`
+	Xmlns                 string           `xml:"xmlns,attr,omitempty"`
+	RedirectAllRequestsTo *WebsiteRedirect `xml:"RedirectAllRequestsTo"`
+	IndexDocument         *IndexDocument   `xml:"IndexDocument"`
+	ErrorDocument         *ErrorDocument   `xml:"ErrorDocument"`
+	RoutingRules          *RoutingRules    `xml:"RoutingRules"`
+}
+
+// IndexDocument names the object served for a request ending in "/".
+type IndexDocument struct {
+	Suffix string `xml:"Suffix"`
+}
+
+// ErrorDocument names the object served with 4xx errors.
+type ErrorDocument struct {
+	Key string `xml:"Key"`
+}
+
+// RoutingRules holds the routing rules of a website configuration.
+type RoutingRules struct {
+	Rules []RoutingRule `xml:"RoutingRule"`
+}
+
+// RoutingRule redirects the requests that match its condition, or every
+// request without one.
+type RoutingRule struct {
+	Condition *RoutingCondition `xml:"Condition"`
+	Redirect  WebsiteRedirect   `xml:"Redirect"`
+}
+
+// RoutingCondition selects requests by key prefix and, to redirect on
+// errors, by the status code the request would otherwise get.
+type RoutingCondition struct {
+	KeyPrefixEquals             string `xml:"KeyPrefixEquals,omitempty"`
+	HTTPErrorCodeReturnedEquals string `xml:"HttpErrorCodeReturnedEquals,omitempty"`
+}
+
+// WebsiteRedirect describes where a request is redirected, by a routing
+// rule or for every request (RedirectAllRequestsTo, which uses only
+// HostName and Protocol).
+type WebsiteRedirect struct {
+	HostName             string `xml:"HostName,omitempty"`
+	HTTPRedirectCode     string `xml:"HttpRedirectCode,omitempty"`
+	Protocol             string `xml:"Protocol,omitempty"`
+	ReplaceKeyPrefixWith string `xml:"ReplaceKeyPrefixWith,omitempty"`
+	ReplaceKeyWith       string `xml:"ReplaceKeyWith,omitempty"`
+}
+
+// InventoryConfiguration is the XML body of PutBucketInventoryConfiguration
+// and the response of GetBucketInventoryConfiguration. Request bodies are
+// accepted with or without the S3 namespace; responses carry it.
+type InventoryConfiguration struct {
+	XMLName                xml.Name                 `xml:"InventoryConfiguration"`
+	Xmlns                  string                   `xml:"xmlns,attr,omitempty"`
+	Destination            InventoryDestination     `xml:"Destination"`
+	IsEnabled              bool                     `xml:"IsEnabled"`
+	Filter                 *InventoryFilter         `xml:"Filter"`
+	ID                     string                   `xml:"Id"`
+	IncludedObjectVersions string                   `xml:"IncludedObjectVersions"`
+	OptionalFields         *InventoryOptionalFields `xml:"OptionalFields"`
+	Schedule               InventorySchedule        `xml:"Schedule"`
+}
+
+// InventoryDestination holds where inventory reports are written.
+type InventoryDestination struct {
+	S3BucketDestination InventoryS3BucketDestination `xml:"S3BucketDestination"`
+}
+
+// InventoryS3BucketDestination names the bucket, key prefix and format of
+// inventory reports. Encryption is decoded only so that configurations
+// using it can be rejected.
+type InventoryS3BucketDestination struct {
+	AccountID  string    `xml:"AccountId,omitempty"`
+	Bucket     string    `xml:"Bucket"`
+	Format     string    `xml:"Format"`
+	Prefix     string    `xml:"Prefix,omitempty"`
+	Encryption *struct{} `xml:"Encryption"`
+}
+
+// InventoryFilter selects the objects an inventory lists.
+type InventoryFilter struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// InventoryOptionalFields lists the columns an inventory adds to Bucket
+// and Key.
+type InventoryOptionalFields struct {
+	Fields []string `xml:"Field"`
+}
+
+// InventorySchedule holds how often inventory reports are produced.
+type InventorySchedule struct {
+	Frequency string `xml:"Frequency"`
+}
+
+// ListInventoryConfigurationsResult is the XML response for
+// ListBucketInventoryConfigurations.
+type ListInventoryConfigurationsResult struct {
+	XMLName                 xml.Name                 `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListInventoryConfigurationsResult"`
+	ContinuationToken       string                   `xml:"ContinuationToken,omitempty"`
+	InventoryConfigurations []InventoryConfiguration `xml:"InventoryConfiguration"`
+	IsTruncated             bool                     `xml:"IsTruncated"`
+	NextContinuationToken   string                   `xml:"NextContinuationToken,omitempty"`
+}
+
 // ACL holds the list of grants in an access control policy.
 type ACL struct {
 	Grants []Grant `xml:"Grant"`
@@ -367,6 +518,35 @@ func RenderAccessControlPolicy(w http.ResponseWriter, acp *AccessControlPolicy)
 	writeXML(w, http.StatusOK, acp)
 }
 
+// RenderReplicationConfiguration writes a ReplicationConfiguration XML
+// response.
+func RenderReplicationConfiguration(w http.ResponseWriter, cfg *ReplicationConfiguration) {
+	out := *cfg
+	out.Xmlns = s3NS
+	writeXML(w, http.StatusOK, &out)
+}
+
+// RenderWebsiteConfiguration writes a WebsiteConfiguration XML response.
+func RenderWebsiteConfiguration(w http.ResponseWriter, cfg *WebsiteConfiguration) {
+	out := *cfg
+	out.Xmlns = s3NS
+	writeXML(w, http.StatusOK, &out)
+}
+
+// RenderInventoryConfiguration writes an InventoryConfiguration XML
+// response.
+func RenderInventoryConfiguration(w http.ResponseWriter, cfg *InventoryConfiguration) {
+	out := *cfg
+	out.Xmlns = s3NS
+	writeXML(w, http.StatusOK, &out)
+}
+
+// RenderListInventoryConfigurationsResult writes a
+// ListInventoryConfigurationsResult XML response.
+func RenderListInventoryConfigurationsResult(w http.ResponseWriter, result *ListInventoryConfigurationsResult) {
+	writeXML(w, http.StatusOK, result)
+}
+
 // FormatTimeS3 formats a time.Time as an S3-compatible ISO 8601 string
 // with millisecond precision (e.g., "2006-01-02T15:04:05.000Z").
 func FormatTimeS3(t time.Time) string {
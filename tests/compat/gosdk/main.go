@@ -0,0 +1,282 @@
+// Command bleepstore-s3-gosdk runs single S3 operations through
+// aws-sdk-go-v2, so the multi-SDK test suite can drive the Go SDK the way
+// it drives the CLI clients. It reads the endpoint and credentials from
+// the same BLEEPSTORE_* environment variables as the suite.
+//
+// Usage:
+//
+//	bleepstore-s3-gosdk create-bucket BUCKET
+//	bleepstore-s3-gosdk put-object BUCKET KEY < body
+//	bleepstore-s3-gosdk get-object BUCKET KEY > body
+//	bleepstore-s3-gosdk list-objects BUCKET PREFIX DELIMITER MAX_KEYS
+//
+// Commands with a result print it as JSON. A failed operation prints its
+// error to stderr and exits 1; a missing bucket or key on head-bucket and
+// head-object exits 2.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// partSize is the part size of upload-file, which uploads larger files in
+// parts.
+const partSize = 5 << 20
+
+// commands maps each command to its argument count and implementation.
+var commands = map[string]struct {
+	args int
+	run  func(ctx context.Context, c *s3.Client, args []string) (any, error)
+}{
+	"create-bucket":  {1, createBucket},
+	"delete-bucket":  {1, deleteBucket},
+	"head-bucket":    {1, headBucket},
+	"list-buckets":   {0, listBuckets},
+	"put-object":     {2, putObject},
+	"get-object":     {2, getObject},
+	"head-object":    {2, headObject},
+	"delete-object":  {2, deleteObject},
+	"delete-objects": {-1, deleteObjects},
+	"copy-object":    {3, copyObject},
+	"list-objects":   {4, listObjects},
+	"upload-file":    {3, uploadFile},
+	"download-file":  {3, downloadFile},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fail("usage: bleepstore-s3-gosdk COMMAND [ARGS...]")
+	}
+	cmd, ok := commands[os.Args[1]]
+	args := os.Args[2:]
+	switch {
+	case !ok:
+		fail("unknown command %q", os.Args[1])
+	case cmd.args >= 0 && len(args) != cmd.args:
+		fail("%s takes %d arguments, got %d", os.Args[1], cmd.args, len(args))
+	case cmd.args < 0 && len(args) < 1:
+		fail("%s takes a bucket and keys", os.Args[1])
+	}
+
+	result, err := cmd.run(context.Background(), newClient(), args)
+	if err != nil {
+		var re *smithyhttp.ResponseError
+		if errors.As(err, &re) && re.HTTPStatusCode() == http.StatusNotFound &&
+			(os.Args[1] == "head-bucket" || os.Args[1] == "head-object") {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fail("%s: %v", os.Args[1], err)
+	}
+	if result != nil {
+		json.NewEncoder(os.Stdout).Encode(result)
+	}
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+func env(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// newClient returns a path-style client of the BleepStore endpoint.
+func newClient() *s3.Client {
+	return s3.New(s3.Options{
+		BaseEndpoint: aws.String(env("BLEEPSTORE_ENDPOINT", "http://localhost:9000")),
+		Region:       env("BLEEPSTORE_REGION", "us-east-1"),
+		Credentials: credentials.NewStaticCredentialsProvider(
+			env("BLEEPSTORE_ACCESS_KEY", "bleepstore"), env("BLEEPSTORE_SECRET_KEY", "bleepstore-secret"), ""),
+		UsePathStyle:     true,
+		RetryMaxAttempts: 1,
+	})
+}
+
+func createBucket(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	_, err := c.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: &args[0]})
+	return nil, err
+}
+
+func deleteBucket(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	_, err := c.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: &args[0]})
+	return nil, err
+}
+
+func headBucket(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	_, err := c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &args[0]})
+	return nil, err
+}
+
+func listBuckets(ctx context.Context, c *s3.Client, _ []string) (any, error) {
+	out, err := c.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, b := range out.Buckets {
+		names = append(names, aws.ToString(b.Name))
+	}
+	return names, nil
+}
+
+func putObject(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	body, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.PutObject(ctx, &s3.PutObjectInput{Bucket: &args[0], Key: &args[1], Body: bytes.NewReader(body)})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"etag": aws.ToString(out.ETag)}, nil
+}
+
+func getObject(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	out, err := c.GetObject(ctx, &s3.GetObjectInput{Bucket: &args[0], Key: &args[1]})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	_, err = io.Copy(os.Stdout, out.Body)
+	return nil, err
+}
+
+func headObject(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	out, err := c.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &args[0], Key: &args[1]})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"size":         aws.ToInt64(out.ContentLength),
+		"etag":         aws.ToString(out.ETag),
+		"content_type": aws.ToString(out.ContentType),
+	}, nil
+}
+
+func deleteObject(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	_, err := c.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &args[0], Key: &args[1]})
+	return nil, err
+}
+
+func deleteObjects(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	var objects []types.ObjectIdentifier
+	for _, key := range args[1:] {
+		objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+	}
+	out, err := c.DeleteObjects(ctx, &s3.DeleteObjectsInput{Bucket: &args[0], Delete: &types.Delete{Objects: objects}})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Errors) > 0 {
+		return nil, fmt.Errorf("deleting %s: %s", aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Code))
+	}
+	return nil, nil
+}
+
+func copyObject(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	_, err := c.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     &args[0],
+		Key:        &args[2],
+		CopySource: aws.String(args[0] + "/" + args[1]),
+	})
+	return nil, err
+}
+
+func listObjects(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	maxKeys, err := strconv.Atoi(args[3])
+	if err != nil {
+		return nil, fmt.Errorf("bad max keys %q", args[3])
+	}
+	in := &s3.ListObjectsV2Input{Bucket: &args[0], MaxKeys: aws.Int32(int32(maxKeys))}
+	if args[1] != "" {
+		in.Prefix = &args[1]
+	}
+	if args[2] != "" {
+		in.Delimiter = &args[2]
+	}
+	out, err := c.ListObjectsV2(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string][]string{"keys": {}, "prefixes": {}}
+	for _, o := range out.Contents {
+		result["keys"] = append(result["keys"], aws.ToString(o.Key))
+	}
+	for _, p := range out.CommonPrefixes {
+		result["prefixes"] = append(result["prefixes"], aws.ToString(p.Prefix))
+	}
+	return result, nil
+}
+
+// uploadFile uploads a file in one PutObject, or in parts of partSize when
+// it is larger.
+func uploadFile(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	bucket, key := &args[0], &args[1]
+	data, err := os.ReadFile(args[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= partSize {
+		_, err := c.PutObject(ctx, &s3.PutObjectInput{Bucket: bucket, Key: key, Body: bytes.NewReader(data)})
+		return nil, err
+	}
+
+	mpu, err := c.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: bucket, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	var parts []types.CompletedPart
+	for n, off := int32(1), 0; off < len(data); n, off = n+1, off+partSize {
+		end := min(off+partSize, len(data))
+		out, err := c.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket: bucket, Key: key, UploadId: mpu.UploadId, PartNumber: aws.Int32(n),
+			Body: bytes.NewReader(data[off:end]),
+		})
+		if err != nil {
+			c.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: bucket, Key: key, UploadId: mpu.UploadId})
+			return nil, err
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(n)})
+	}
+	_, err = c.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket: bucket, Key: key, UploadId: mpu.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	return nil, err
+}
+
+func downloadFile(ctx context.Context, c *s3.Client, args []string) (any, error) {
+	out, err := c.GetObject(ctx, &s3.GetObjectInput{Bucket: &args[0], Key: &args[1]})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	f, err := os.Create(args[2])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, out.Body); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return nil, f.Close()
+}
@@ -0,0 +1,81 @@
+"""Summarize a compatibility matrix run.
+
+Reads the JUnit XML report each client's run wrote (<client>.xml in the
+results directory) and prints a scenario x client matrix as Markdown,
+also written to matrix.md there. Exits 1 if any scenario failed or a
+client produced no report.
+
+Usage:
+    python summarize.py RESULTS_DIR CLIENT...
+"""
+
+from __future__ import annotations
+
+import os
+import re
+import sys
+import xml.etree.ElementTree as ET
+
+MARKS = {"pass": "✅", "fail": "❌", "skip": "⏭️"}
+
+
+def load(path: str) -> dict[str, str]:
+    """Return the outcome of each scenario in one client's report."""
+    outcomes: dict[str, str] = {}
+    for case in ET.parse(path).iter("testcase"):
+        cls = case.get("classname", "").rsplit(".", 1)[-1]
+        # Drop the [client] parameter id, the same for every case of a run.
+        name = re.sub(r"\[[^\]]*\]$", "", case.get("name", ""))
+        scenario = f"{cls}::{name}" if cls else name
+        if case.find("failure") is not None or case.find("error") is not None:
+            outcomes[scenario] = "fail"
+        elif case.find("skipped") is not None:
+            outcomes[scenario] = "skip"
+        else:
+            outcomes[scenario] = "pass"
+    return outcomes
+
+
+def main() -> int:
+    if len(sys.argv) < 3:
+        print(__doc__, file=sys.stderr)
+        return 2
+    results, clients = sys.argv[1], sys.argv[2:]
+
+    reports: dict[str, dict[str, str] | None] = {}
+    for client in clients:
+        path = os.path.join(results, f"{client}.xml")
+        reports[client] = load(path) if os.path.exists(path) else None
+
+    scenarios = sorted({s for r in reports.values() if r for s in r})
+    lines = [
+        "| Scenario | " + " | ".join(clients) + " |",
+        "|---|" + "---|" * len(clients),
+    ]
+    for scenario in scenarios:
+        cells = [MARKS.get((reports[c] or {}).get(scenario, ""), "—") for c in clients]
+        lines.append(f"| {scenario} | " + " | ".join(cells) + " |")
+
+    totals = []
+    ok = True
+    for client in clients:
+        report = reports[client]
+        if report is None:
+            totals.append("no report")
+            ok = False
+            continue
+        passed = sum(1 for o in report.values() if o == "pass")
+        failed = sum(1 for o in report.values() if o == "fail")
+        ok = ok and failed == 0
+        totals.append(f"{'PASS' if failed == 0 else 'FAIL'} {passed}/{len(report)}")
+    lines.append("| **Result** | " + " | ".join(totals) + " |")
+
+    table = "\n".join(lines) + "\n"
+    with open(os.path.join(results, "matrix.md"), "w") as f:
+        f.write(table)
+    print(table)
+    return 0 if ok else 1
+
+
+if __name__ == "__main__":
+    sys.exit(main())
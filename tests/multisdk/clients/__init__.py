@@ -2,6 +2,7 @@
 
 from __future__ import annotations
 
+import os
 import shutil
 
 from .boto3_client import Boto3Client
@@ -9,7 +10,12 @@ from .boto3_resource import Boto3ResourceClient
 
 
 def discover_clients() -> list:
-    """Return all available S3 clients. Skip those whose CLI tool is not installed."""
+    """Return all available S3 clients. Skip those whose CLI tool is not installed.
+
+    BLEEPSTORE_CLIENTS (comma-separated client names) restricts the run to
+    those clients and fails if one of them is not available, so a matrix run
+    cannot pass by skipping the client it was meant to test.
+    """
     clients: list = [Boto3Client(), Boto3ResourceClient()]
 
     if shutil.which("aws"):
@@ -32,4 +38,16 @@ def discover_clients() -> list:
 
         clients.append(RcloneClient())
 
+    if shutil.which("bleepstore-s3-gosdk"):
+        from .gosdk import GoSdkClient
+
+        clients.append(GoSdkClient())
+
+    wanted = [n.strip() for n in os.environ.get("BLEEPSTORE_CLIENTS", "").split(",") if n.strip()]
+    if wanted:
+        missing = set(wanted) - {c.name for c in clients}
+        if missing:
+            raise RuntimeError(f"requested S3 clients not available: {', '.join(sorted(missing))}")
+        clients = [c for c in clients if c.name in wanted]
+
     return clients
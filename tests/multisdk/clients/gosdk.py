@@ -0,0 +1,80 @@
+"""aws-sdk-go-v2 S3 client implementation.
+
+Drives the Go SDK through the bleepstore-s3-gosdk helper in
+tests/compat/gosdk, which runs one operation per invocation and reads the
+same BLEEPSTORE_* environment variables as these tests.
+"""
+
+from __future__ import annotations
+
+import json
+
+from .base import CliS3Client, S3ClientError
+
+HELPER = "bleepstore-s3-gosdk"
+
+
+class GoSdkClient(CliS3Client):
+    name = "gosdk"
+
+    def _call(self, *args: str, input_data: bytes | None = None) -> bytes:
+        result = self._run(HELPER, *args, input_data=input_data, check=False)
+        if result.returncode == 2:
+            raise S3ClientError(result.stderr.decode(), 404)
+        if result.returncode != 0:
+            raise S3ClientError(result.stderr.decode(), result.returncode)
+        return result.stdout
+
+    def _json(self, *args: str, input_data: bytes | None = None):
+        return json.loads(self._call(*args, input_data=input_data))
+
+    def create_bucket(self, bucket: str) -> None:
+        self._call("create-bucket", bucket)
+
+    def delete_bucket(self, bucket: str) -> None:
+        self._call("delete-bucket", bucket)
+
+    def head_bucket(self, bucket: str) -> int:
+        try:
+            self._call("head-bucket", bucket)
+            return 200
+        except S3ClientError as e:
+            if e.status_code == 404:
+                return 404
+            raise
+
+    def list_buckets(self) -> list[str]:
+        return self._json("list-buckets")
+
+    def put_object(self, bucket: str, key: str, body: bytes) -> str:
+        return self._json("put-object", bucket, key, input_data=body)["etag"]
+
+    def get_object(self, bucket: str, key: str) -> bytes:
+        return self._call("get-object", bucket, key)
+
+    def head_object(self, bucket: str, key: str) -> dict:
+        return self._json("head-object", bucket, key)
+
+    def delete_object(self, bucket: str, key: str) -> None:
+        self._call("delete-object", bucket, key)
+
+    def delete_objects(self, bucket: str, keys: list[str]) -> None:
+        self._call("delete-objects", bucket, *keys)
+
+    def copy_object(self, bucket: str, src_key: str, dst_key: str) -> None:
+        self._call("copy-object", bucket, src_key, dst_key)
+
+    def list_objects(
+        self,
+        bucket: str,
+        prefix: str = "",
+        delimiter: str = "",
+        max_keys: int = 1000,
+    ) -> dict:
+        return self._json("list-objects", bucket, prefix, delimiter, str(max_keys))
+
+    def upload_file(self, bucket: str, key: str, path: str) -> None:
+        self._call("upload-file", bucket, key, path)
+
+    def download_file(self, bucket: str, key: str, path: str) -> None:
+        self._call("download-file", bucket, key, path)
@@ -0,0 +1,102 @@
+#!/usr/bin/env bash
+#
+# BleepStore — Client SDK Compatibility Matrix
+#
+# Runs the multi-SDK scenarios (tests/multisdk) once per client, each in its
+# own container built from compat/Dockerfile, and reports per-client
+# pass/fail as a scenario x client matrix. Exits non-zero if any client
+# failed a scenario, so compatibility regressions block a release.
+#
+# Usage:
+#   BLEEPSTORE_ENDPOINT=http://localhost:9013 ./run_compat_matrix.sh [client...]
+#
+# Examples:
+#   ./run_compat_matrix.sh                    # boto3 awscli gosdk rclone s3cmd
+#   ./run_compat_matrix.sh gosdk rclone       # Only these clients
+#
+# Requires: Docker
+#
+# Environment:
+#   BLEEPSTORE_ENDPOINT    Server URL (default: http://localhost:9000)
+#   BLEEPSTORE_ACCESS_KEY  Access key (default: bleepstore)
+#   BLEEPSTORE_SECRET_KEY  Secret key (default: bleepstore-secret)
+#   BLEEPSTORE_REGION      Region (default: us-east-1)
+#   COMPAT_IMAGE           Image tag (default: bleepstore-compat)
+#   COMPAT_RESULTS         Report directory (default: tests/compat/results)
+#
+set -euo pipefail
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+cd "$SCRIPT_DIR"
+
+ENDPOINT="${BLEEPSTORE_ENDPOINT:-http://localhost:9000}"
+ACCESS_KEY="${BLEEPSTORE_ACCESS_KEY:-bleepstore}"
+SECRET_KEY="${BLEEPSTORE_SECRET_KEY:-bleepstore-secret}"
+REGION="${BLEEPSTORE_REGION:-us-east-1}"
+IMAGE="${COMPAT_IMAGE:-bleepstore-compat}"
+RESULTS="${COMPAT_RESULTS:-$SCRIPT_DIR/compat/results}"
+
+CLIENTS=("$@")
+if [ ${#CLIENTS[@]} -eq 0 ]; then
+    CLIENTS=(boto3 awscli gosdk rclone s3cmd)
+fi
+
+# Check Docker
+if ! command -v docker &>/dev/null; then
+    echo "Error: Docker is required but not installed."
+    exit 1
+fi
+if ! docker info &>/dev/null 2>&1; then
+    echo "Error: Docker daemon is not running."
+    exit 1
+fi
+
+# On Linux the containers share the host network; elsewhere a localhost
+# endpoint is reached through host.docker.internal.
+NETWORK_ARGS=()
+CONTAINER_ENDPOINT="$ENDPOINT"
+if [ "$(uname)" = "Linux" ]; then
+    NETWORK_ARGS=(--network host)
+else
+    CONTAINER_ENDPOINT="$(echo "$ENDPOINT" | sed -E 's#://(localhost|127\.0\.0\.1)#://host.docker.internal#')"
+fi
+
+echo "BleepStore Client Compatibility Matrix"
+echo "  Endpoint: $ENDPOINT"
+echo "  Clients:  ${CLIENTS[*]}"
+echo "  Results:  $RESULTS"
+echo "=============================================="
+
+echo ""
+echo "Building $IMAGE..."
+docker build --quiet -f compat/Dockerfile -t "$IMAGE" . >/dev/null
+
+rm -rf "$RESULTS"
+mkdir -p "$RESULTS"
+
+for client in "${CLIENTS[@]}"; do
+    echo ""
+    echo "--- $client ---"
+    # A failing client is reported in the matrix; keep going.
+    docker run --rm "${NETWORK_ARGS[@]}" \
+        --user "$(id -u):$(id -g)" \
+        -e "HOME=/tmp" \
+        -e "BLEEPSTORE_ENDPOINT=$CONTAINER_ENDPOINT" \
+        -e "BLEEPSTORE_ACCESS_KEY=$ACCESS_KEY" \
+        -e "BLEEPSTORE_SECRET_KEY=$SECRET_KEY" \
+        -e "BLEEPSTORE_REGION=$REGION" \
+        -e "BLEEPSTORE_CLIENTS=$client" \
+        -v "$SCRIPT_DIR/multisdk:/tests/multisdk:ro" \
+        -v "$RESULTS:/results" \
+        "$IMAGE" \
+        python -m pytest multisdk/ -q --tb=line -p no:cacheprovider \
+            --junitxml="/results/$client.xml" || true
+done
+
+echo ""
+echo "=============================================="
+docker run --rm \
+    --user "$(id -u):$(id -g)" \
+    -v "$SCRIPT_DIR/compat:/tests/compat:ro" \
+    -v "$RESULTS:/results" \
+    "$IMAGE" \
+    python compat/summarize.py /results "${CLIENTS[@]}"